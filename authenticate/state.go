@@ -134,6 +134,10 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 		CAFile:                  cfg.Options.CAFile,
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		Compression:             cfg.Options.GRPCCompression,
+		TLSMinVersion:           cfg.Options.GetGRPCTLSMinVersion(),
+		TLSCipherSuites:         cfg.Options.GetGRPCTLSCipherSuites(),
+		MaxRecvMsgSize:          cfg.Options.GRPCServerMaxSendMsgSize,
 		WithInsecure:            cfg.Options.GRPCInsecure,
 		InstallationID:          cfg.Options.InstallationID,
 		ServiceName:             cfg.Options.Services,
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const (
+	// DefaultChangeRetryInitialInterval is the default initial interval to wait before
+	// retrying a failed configuration change.
+	DefaultChangeRetryInitialInterval = time.Millisecond * 500
+	// DefaultChangeRetryMaxInterval is the default maximum interval to wait before
+	// retrying a failed configuration change.
+	DefaultChangeRetryMaxInterval = time.Minute
+)
+
+// A FallibleChangeListener is called when configuration changes and may fail.
+type FallibleChangeListener = func(*Config) error
+
+// A RetryChangeListener calls a FallibleChangeListener when configuration changes
+// and retries the change if it fails.
+type RetryChangeListener struct {
+	li FallibleChangeListener
+
+	mu      sync.Mutex
+	backoff *backoff.ExponentialBackOff
+	timer   *time.Timer
+	gen     uint64
+	stopped bool
+}
+
+// NewRetryChangeListener creates a new RetryChangeListener which calls li and, if it
+// fails, retries the change with an exponential backoff between initialInterval and
+// maxInterval. A new configuration replaces any pending retry and a successful
+// apply resets the backoff.
+func NewRetryChangeListener(li FallibleChangeListener, initialInterval, maxInterval time.Duration) *RetryChangeListener {
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = initialInterval
+	bo.MaxInterval = maxInterval
+	bo.MaxElapsedTime = 0
+	bo.Reset()
+
+	return &RetryChangeListener{
+		li:      li,
+		backoff: bo,
+	}
+}
+
+// OnConfigChange applies the configuration, replacing any pending retry. It does
+// nothing once the listener is stopped.
+func (rcl *RetryChangeListener) OnConfigChange(cfg *Config) {
+	rcl.mu.Lock()
+	defer rcl.mu.Unlock()
+
+	if rcl.stopped {
+		return
+	}
+	rcl.stopTimerLocked()
+	rcl.applyLocked(cfg, rcl.gen)
+}
+
+// Stop cancels any pending retry and ignores any further configuration changes. A
+// change being applied when Stop is called completes before Stop returns.
+func (rcl *RetryChangeListener) Stop() {
+	rcl.mu.Lock()
+	defer rcl.mu.Unlock()
+
+	rcl.stopped = true
+	rcl.stopTimerLocked()
+}
+
+// stopTimerLocked cancels the pending retry. The retry may already be waiting on
+// the lock, so the generation is bumped for it to notice it's been cancelled.
+func (rcl *RetryChangeListener) stopTimerLocked() {
+	if rcl.timer != nil {
+		rcl.timer.Stop()
+		rcl.timer = nil
+	}
+	rcl.gen++
+}
+
+func (rcl *RetryChangeListener) applyLocked(cfg *Config, gen uint64) {
+	err := rcl.li(cfg)
+	if err == nil {
+		rcl.backoff.Reset()
+		return
+	}
+
+	next := rcl.backoff.NextBackOff()
+	log.Error().Err(err).Dur("retry_in", next).Msg("config: failed to apply configuration change")
+	rcl.timer = time.AfterFunc(next, func() {
+		rcl.mu.Lock()
+		defer rcl.mu.Unlock()
+
+		// a newer configuration has been applied or the listener was stopped
+		if rcl.gen != gen {
+			return
+		}
+		rcl.timer = nil
+		rcl.applyLocked(cfg, gen)
+	})
+}
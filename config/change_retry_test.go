@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryChangeListener(t *testing.T) {
+	const (
+		failures        = 3
+		initialInterval = time.Millisecond * 20
+	)
+
+	var mu sync.Mutex
+	var calls []time.Time
+	done := make(chan struct{})
+	li := NewRetryChangeListener(func(cfg *Config) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, time.Now())
+		if len(calls) <= failures {
+			return errors.New("port in use")
+		}
+		close(done)
+		return nil
+	}, initialInterval, time.Second)
+
+	li.OnConfigChange(&Config{Options: NewDefaultOptions()})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected config change to be retried until it succeeded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, calls, failures+1)
+	minInterval := initialInterval / 2 // account for the backoff randomization
+	for i := 1; i < len(calls); i++ {
+		assert.GreaterOrEqual(t, calls[i].Sub(calls[i-1]), minInterval,
+			"retry %d should be spaced by the backoff", i)
+		minInterval = time.Duration(float64(minInterval) * 1.5)
+	}
+}
+
+func TestRetryChangeListenerStop(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	li := NewRetryChangeListener(func(cfg *Config) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		return errors.New("port in use")
+	}, time.Millisecond*10, time.Millisecond*10)
+
+	li.OnConfigChange(&Config{Options: NewDefaultOptions()})
+	li.Stop()
+	li.OnConfigChange(&Config{Options: NewDefaultOptions()})
+	time.Sleep(time.Millisecond * 100)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, calls, "pending retries and new changes should be ignored once stopped")
+}
@@ -120,6 +120,9 @@ func (src *FileOrEnvironmentSource) onConfigChange(evt fsnotify.Event) {
 	if err == nil {
 		cfg = &Config{Options: options}
 		metrics.SetConfigInfo(cfg.Options.Services, "local", cfg.Checksum(), true)
+		for _, change := range DiffConfig(src.config, cfg) {
+			log.Info().Str("option", change.Path).Str("old", change.Old).Str("new", change.New).Msg("config: option changed")
+		}
 	} else {
 		log.Error().Err(err).Msg("config: error updating config")
 		metrics.SetConfigInfo(cfg.Options.Services, "local", cfg.Checksum(), false)
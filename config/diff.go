@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// redactedValue replaces the values of secret options in a Change.
+const redactedValue = "<redacted>"
+
+// secretOptions are the options whose values are redacted in a Change.
+var secretOptions = map[string]bool{
+	"certificate_key":                      true,
+	"cookie_secret":                        true,
+	"databroker_storage_connection_string": true,
+	"idp_client_secret":                    true,
+	"idp_service_account":                  true,
+	"key":                                  true,
+	"kubernetes_service_account_token":     true,
+	"metrics_basic_auth":                   true,
+	"metrics_certificate_key":              true,
+	"set_request_headers":                  true,
+	"shared_secret":                        true,
+	"signing_key":                          true,
+	"tls_client_key":                       true,
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// A Change is a difference between the options of two configs.
+type Change struct {
+	// Path identifies the changed option by its config key. Elements of lists and
+	// maps are identified by their index or key, such as "policy[0].from".
+	Path string
+	// Old and New are the formatted old and new values. The values of secrets are
+	// redacted.
+	Old, New string
+}
+
+// String returns a human-readable description of the change.
+func (c Change) String() string {
+	return c.Path + ": " + c.Old + " -> " + c.New
+}
+
+// DiffConfig returns the differences between the options of the old and new configs,
+// ordered by the position of the options. Lists are compared element by element
+// and maps key by key, in sorted order. An added or removed element is reported
+// as a change of each of its non-zero fields.
+func DiffConfig(oldCfg, newCfg *Config) []Change {
+	var changes []Change
+	diffValues(&changes, "",
+		reflect.ValueOf(optionsOrZero(oldCfg)).Elem(),
+		reflect.ValueOf(optionsOrZero(newCfg)).Elem(),
+		false)
+	return changes
+}
+
+func optionsOrZero(cfg *Config) *Options {
+	if cfg == nil || cfg.Options == nil {
+		return new(Options)
+	}
+	return cfg.Options
+}
+
+func diffValues(changes *[]Change, path string, oldValue, newValue reflect.Value, secret bool) {
+	if isDiffLeaf(oldValue.Type()) {
+		if !leafEqual(oldValue, newValue) {
+			c := Change{Path: path, Old: formatDiffValue(oldValue), New: formatDiffValue(newValue)}
+			if secret {
+				c.Old, c.New = redactedValue, redactedValue
+			}
+			*changes = append(*changes, c)
+		}
+		return
+	}
+
+	switch oldValue.Kind() {
+	case reflect.Ptr:
+		if oldValue.IsNil() && newValue.IsNil() {
+			return
+		}
+		diffValues(changes, path, derefOrZero(oldValue), derefOrZero(newValue), secret)
+	case reflect.Struct:
+		for i := 0; i < oldValue.NumField(); i++ {
+			field := oldValue.Type().Field(i)
+			name, squash, ok := diffFieldName(field)
+			if !ok {
+				continue
+			}
+			fieldPath := path
+			if !squash {
+				fieldPath = joinDiffPath(path, name)
+			}
+			diffValues(changes, fieldPath, oldValue.Field(i), newValue.Field(i), secret || secretOptions[name])
+		}
+	case reflect.Slice, reflect.Array:
+		length := oldValue.Len()
+		if newValue.Len() > length {
+			length = newValue.Len()
+		}
+		zero := reflect.Zero(oldValue.Type().Elem())
+		for i := 0; i < length; i++ {
+			o, n := zero, zero
+			if i < oldValue.Len() {
+				o = oldValue.Index(i)
+			}
+			if i < newValue.Len() {
+				n = newValue.Index(i)
+			}
+			diffValues(changes, path+"["+strconv.Itoa(i)+"]", o, n, secret)
+		}
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, k := range oldValue.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, k := range newValue.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		zero := reflect.Zero(oldValue.Type().Elem())
+		for _, name := range names {
+			o, n := oldValue.MapIndex(keys[name]), newValue.MapIndex(keys[name])
+			if !o.IsValid() {
+				o = zero
+			}
+			if !n.IsValid() {
+				n = zero
+			}
+			diffValues(changes, path+"["+name+"]", o, n, secret)
+		}
+	}
+}
+
+// isDiffLeaf returns true if values of the type are compared as a whole, rather
+// than field by field or element by element.
+func isDiffLeaf(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return isDiffLeaf(typ.Elem())
+	case reflect.Struct:
+		// only this package's types are compared field by field
+		return typ.PkgPath() != reflect.TypeOf(Options{}).PkgPath()
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return false
+	}
+	return true
+}
+
+func leafEqual(oldValue, newValue reflect.Value) bool {
+	if m, ok := oldValue.Interface().(proto.Message); ok {
+		if oldValue.Kind() == reflect.Ptr && (oldValue.IsNil() || newValue.IsNil()) {
+			return oldValue.IsNil() == newValue.IsNil()
+		}
+		return proto.Equal(m, newValue.Interface().(proto.Message))
+	}
+	return reflect.DeepEqual(oldValue.Interface(), newValue.Interface())
+}
+
+func formatDiffValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "<nil>"
+	}
+	if !v.Type().Implements(stringerType) && reflect.PtrTo(v.Type()).Implements(stringerType) {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func derefOrZero(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return reflect.Zero(v.Type().Elem())
+	}
+	return v.Elem()
+}
+
+// diffFieldName returns the name of the field in a Change. Fields are named by
+// their config key, falling back to the field name. Unexported and ignored
+// fields aren't compared.
+func diffFieldName(field reflect.StructField) (name string, squash, ok bool) {
+	if field.PkgPath != "" || field.Tag.Get("hash") == "ignore" {
+		return "", false, false
+	}
+	tag := field.Tag.Get("mapstructure")
+	if tag == "-" {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "squash" {
+			return "", true, true
+		}
+	}
+	if parts[0] == "" {
+		return field.Name, false, true
+	}
+	return parts[0], false, true
+}
+
+func joinDiffPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfig(t *testing.T) {
+	newPolicy := func(from, to string) Policy {
+		urls, err := ParseWeightedUrls(to)
+		require.NoError(t, err)
+		p := Policy{From: from, To: urls}
+		require.NoError(t, p.Validate())
+		return p
+	}
+
+	newConfig := func(metricsAddr, sharedKey string, policies ...Policy) *Config {
+		options := NewDefaultOptions()
+		options.MetricsAddr = metricsAddr
+		options.SharedKey = sharedKey
+		options.Policies = policies
+		return &Config{Options: options}
+	}
+
+	oldConfig := newConfig("127.0.0.1:9901", "OLD-SECRET",
+		newPolicy("https://a.example.com", "https://a.internal"))
+	changes := DiffConfig(oldConfig, newConfig("127.0.0.1:9902", "NEW-SECRET",
+		newPolicy("https://a.example.com", "https://a.internal"),
+		newPolicy("https://b.example.com", "https://b.internal")))
+	assert.Equal(t, []Change{
+		{Path: "shared_secret", Old: "<redacted>", New: "<redacted>"},
+		{Path: "policy[1].from", Old: `""`, New: `"https://b.example.com"`},
+		{Path: "policy[1].to[0].URL", Old: "", New: "https://b.internal"},
+		{Path: "metrics_address", Old: `"127.0.0.1:9901"`, New: `"127.0.0.1:9902"`},
+	}, changes)
+	assert.Equal(t, `metrics_address: "127.0.0.1:9901" -> "127.0.0.1:9902"`, changes[3].String())
+
+	assert.Empty(t, DiffConfig(oldConfig, newConfig("127.0.0.1:9901", "OLD-SECRET",
+		newPolicy("https://a.example.com", "https://a.internal"))),
+		"unchanged options should not be reported")
+}
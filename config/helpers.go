@@ -17,6 +17,24 @@ const (
 	StorageRedisName = "redis"
 	// StorageInMemoryName is the name of the in-memory storage backend
 	StorageInMemoryName = "memory"
+	// StorageFirestoreName is the name of the Google Cloud Firestore storage backend
+	StorageFirestoreName = "firestore"
+)
+
+// A DataBrokerDeleteMode sets how the databroker deletes the records of a type.
+// Record types are given as a list rather than as map keys, since map keys are
+// case-insensitive in the config.
+type DataBrokerDeleteMode struct {
+	Type string `mapstructure:"type" yaml:"type"`
+	Mode string `mapstructure:"mode" yaml:"mode"`
+}
+
+const (
+	// DeleteModeSoft keeps deleted records, flagged as deleted, until they're
+	// permanently deleted after the retention.
+	DeleteModeSoft = "soft"
+	// DeleteModeImmediate removes the data of deleted records right away.
+	DeleteModeImmediate = "immediate"
 )
 
 // IsValidService checks to see if a service is a valid service mode
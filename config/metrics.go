@@ -1,47 +1,179 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-multierror"
+	prom "github.com/prometheus/client_golang/prometheus"
 
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
 // A MetricsManager manages metrics for a given configuration.
 type MetricsManager struct {
-	mu             sync.RWMutex
-	installationID string
-	serviceName    string
-	addr           string
-	basicAuth      string
-	handler        http.Handler
+	mu               sync.RWMutex
+	installationID   string
+	serviceName      string
+	addr             string
+	pathPrefix       string
+	basicAuth        string
+	eventTimestamps  string
+	nativeHistograms bool
+	handler          http.Handler
+	tenants          *metrics.TenantRegistries
+	sinks            *metrics.MetricSinks
+	retry            *RetryChangeListener
+
+	snapshotInstallationID  string
+	snapshotEventTimestamps []string
+
+	statsdAddr           string
+	statsdInterval       time.Duration
+	statsdInstallationID string
+	statsdForwarder      *metrics.StatsDForwarder
+
+	cloudWatchNamespace      string
+	cloudWatchRegion         string
+	cloudWatchInterval       time.Duration
+	cloudWatchInstallationID string
+	cloudWatchBackend        string
+	cloudWatchForwarder      *metrics.CloudWatchForwarder
+
+	otlpAddr           string
+	otlpInterval       time.Duration
+	otlpInsecure       bool
+	otlpCAFile         string
+	otlpHeaders        map[string]string
+	otlpServiceName    string
+	otlpInstallationID string
+	otlpForwarder      *metrics.OTLPForwarder
+}
+
+// DefaultStatsDInterval is the default interval at which metrics are forwarded to StatsD.
+const DefaultStatsDInterval = time.Second * 10
+
+// DefaultCloudWatchInterval is the default interval at which metrics are forwarded
+// to CloudWatch.
+const DefaultCloudWatchInterval = time.Minute
+
+// DefaultOTLPInterval is the default interval at which metrics are pushed to the
+// OTLP collector.
+const DefaultOTLPInterval = time.Second * 10
+
+// newCloudWatchClient creates the CloudWatch client of the metrics manager. It's
+// replaced in tests.
+var newCloudWatchClient = func(region string) (metrics.CloudWatchClient, error) {
+	return metrics.NewCloudWatchClient(context.Background(), region)
+}
+
+// A MetricsManagerOption customizes a MetricsManager.
+type MetricsManagerOption func(*metricsManagerConfig)
+
+type metricsManagerConfig struct {
+	retryInitialInterval time.Duration
+	retryMaxInterval     time.Duration
+}
+
+// WithMetricsChangeRetryIntervals sets the initial and maximum intervals of the
+// backoff between retries of a configuration change which failed to apply.
+func WithMetricsChangeRetryIntervals(initialInterval, maxInterval time.Duration) MetricsManagerOption {
+	return func(cfg *metricsManagerConfig) {
+		cfg.retryInitialInterval = initialInterval
+		cfg.retryMaxInterval = maxInterval
+	}
 }
 
 // NewMetricsManager creates a new MetricsManager.
-func NewMetricsManager(src Source) *MetricsManager {
-	mgr := &MetricsManager{}
+func NewMetricsManager(src Source, options ...MetricsManagerOption) *MetricsManager {
+	cfg := metricsManagerConfig{
+		retryInitialInterval: DefaultChangeRetryInitialInterval,
+		retryMaxInterval:     DefaultChangeRetryMaxInterval,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	mgr := &MetricsManager{
+		tenants: metrics.NewTenantRegistries(),
+		sinks:   metrics.NewMetricSinks(metrics.DefaultMetricSinkInterval),
+	}
 	metrics.RegisterInfoMetrics()
-	src.OnConfigChange(mgr.OnConfigChange)
-	mgr.OnConfigChange(src.GetConfig())
+	mgr.retry = NewRetryChangeListener(mgr.applyConfig, cfg.retryInitialInterval, cfg.retryMaxInterval)
+	src.OnConfigChange(mgr.retry.OnConfigChange)
+	mgr.retry.OnConfigChange(src.GetConfig())
 	return mgr
 }
 
-// Close closes any underlying http server.
+// Close stops forwarding metrics to StatsD, CloudWatch, the OTLP collector and the
+// registered sinks. Pending retries of failed configuration changes are cancelled
+// and further changes are ignored, so that they don't restart the forwarders.
+// There is no http server to shut down: the metrics_addr listener belongs to envoy,
+// which proxies it to ServeHTTP, so reloads don't leak sockets here.
 func (mgr *MetricsManager) Close() error {
-	return nil
+	// the retry listener is stopped before locking, as a change it's applying
+	// holds the lock
+	if mgr.retry != nil {
+		mgr.retry.Stop()
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	_ = mgr.sinks.Close()
+	_ = mgr.closeCloudWatchLocked()
+	_ = mgr.closeOTLPLocked()
+	return mgr.closeStatsDLocked()
 }
 
 // OnConfigChange updates the metrics manager when configuration is changed.
 func (mgr *MetricsManager) OnConfigChange(cfg *Config) {
+	if err := mgr.applyConfig(cfg); err != nil {
+		log.Error().Err(err).Msg("metrics: failed to apply configuration")
+	}
+}
+
+func (mgr *MetricsManager) applyConfig(cfg *Config) error {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
 	mgr.updateInfo(cfg)
-	mgr.updateServer(cfg)
+	mgr.snapshotInstallationID = cfg.Options.InstallationID
+	mgr.snapshotEventTimestamps = cfg.Options.MetricsEventTimestamps
+	mgr.tenants.SetTenants(cfg.Options.MetricsTenants)
+
+	// each sink is applied independently, so that the prometheus handler is served
+	// even if an optional forwarder fails to start. Only the failed sinks are
+	// re-applied on retry, as the others remember their settings.
+	var errs *multierror.Error
+	for _, update := range []func(*Config) error{
+		mgr.updateServer,
+		mgr.updateStatsD,
+		mgr.updateCloudWatch,
+		mgr.updateOTLP,
+	} {
+		if err := update(cfg); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
 }
 
 func (mgr *MetricsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +187,119 @@ func (mgr *MetricsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mgr.handler.ServeHTTP(w, r)
 }
 
+// Mount registers the metrics handler on router under the metrics_path_prefix,
+// so metrics can be scraped from the main HTTP server rather than a dedicated
+// listener. The prefix is served like /metrics, and tenants under
+// {prefix}/{tenant}. Requests outside of the prefix, or all of them if none is
+// configured, are left to the router's other routes.
+func (mgr *MetricsManager) Mount(router *mux.Router) {
+	router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		_, ok := mgr.trimPathPrefix(r.URL.Path)
+		return ok
+	}).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := mgr.trimPathPrefix(r.URL.Path)
+		if !ok {
+			// the prefix changed since the request was matched
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/metrics" + path
+		r2.URL.RawPath = ""
+		mgr.ServeHTTP(w, r2)
+	})
+}
+
+// trimPathPrefix returns the rest of the path after the metrics path prefix, and
+// whether the path is under it.
+func (mgr *MetricsManager) trimPathPrefix(path string) (string, bool) {
+	mgr.mu.RLock()
+	prefix := mgr.pathPrefix
+	mgr.mu.RUnlock()
+
+	if prefix == "" {
+		return "", false
+	}
+	if path == prefix {
+		return "", true
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):], true
+	}
+	return "", false
+}
+
+// TenantRegistry returns the metrics registry for the given tenant. Metrics
+// registered with it are served under /metrics/{tenant}. It returns false if the
+// tenant is not one of the configured metrics tenants.
+func (mgr *MetricsManager) TenantRegistry(tenant string) (prom.Registerer, bool) {
+	return mgr.tenants.Registry(tenant)
+}
+
+// RegisterSink registers a sink which receives the same metrics as prometheus.
+// Metrics are exported to it every metrics.DefaultMetricSinkInterval.
+func (mgr *MetricsManager) RegisterSink(sink metrics.MetricSink) error {
+	return mgr.sinks.Register(sink)
+}
+
+// UnregisterSink unregisters a sink.
+func (mgr *MetricsManager) UnregisterSink(sink metrics.MetricSink) {
+	mgr.sinks.Unregister(sink)
+}
+
+// WriteSnapshot writes a point-in-time snapshot of the metrics, including the
+// envoy stats, to w in the prometheus text exposition format. It doesn't require
+// the metrics http server to be enabled.
+func (mgr *MetricsManager) WriteSnapshot(ctx context.Context, w io.Writer) error {
+	mgr.mu.RLock()
+	installationID, eventTimestamps := mgr.snapshotInstallationID, mgr.snapshotEventTimestamps
+	mgr.mu.RUnlock()
+
+	handler, err := metrics.PrometheusHandler(EnvoyAdminURL, installationID,
+		metrics.WithEventTimestamps(eventTimestamps))
+	if err != nil {
+		return fmt.Errorf("metrics: failed to create prometheus handler: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/metrics", nil)
+	if err != nil {
+		return err
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return fmt.Errorf("metrics: unexpected status code writing snapshot: %d", rec.Code)
+	}
+	_, err = io.Copy(w, rec.Body)
+	return err
+}
+
+// WriteSnapshotFile writes a snapshot of the metrics to the file at path. The
+// file is replaced atomically, so a partial snapshot is never observed.
+func (mgr *MetricsManager) WriteSnapshotFile(ctx context.Context, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("metrics: failed to create snapshot file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	err = mgr.WriteSnapshot(ctx, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("metrics: failed to write snapshot file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("metrics: failed to write snapshot file: %w", err)
+	}
+	return nil
+}
+
 func (mgr *MetricsManager) updateInfo(cfg *Config) {
 	serviceName := telemetry.ServiceName(cfg.Options.Services)
 	if serviceName == mgr.serviceName {
@@ -71,32 +316,233 @@ func (mgr *MetricsManager) updateInfo(cfg *Config) {
 	mgr.serviceName = serviceName
 }
 
-func (mgr *MetricsManager) updateServer(cfg *Config) {
+// updateServer swaps the handler serving the metrics. The metrics_addr listener
+// itself belongs to envoy, as the metrics-ingress listener, which envoy rebinds
+// when the address changes, so there is no port to release or acquire here. Only
+// the socket file of a unix socket address is removed once it's no longer used.
+func (mgr *MetricsManager) updateServer(cfg *Config) error {
+	eventTimestamps := strings.Join(cfg.Options.MetricsEventTimestamps, ",")
 	if cfg.Options.MetricsAddr == mgr.addr &&
+		cfg.Options.MetricsPathPrefix == mgr.pathPrefix &&
 		cfg.Options.MetricsBasicAuth == mgr.basicAuth &&
-		cfg.Options.InstallationID == mgr.installationID {
-		return
+		cfg.Options.InstallationID == mgr.installationID &&
+		eventTimestamps == mgr.eventTimestamps &&
+		cfg.Options.MetricsNativeHistograms == mgr.nativeHistograms {
+		return nil
+	}
+
+	if path, ok := MetricsSocketPath(mgr.addr); ok && cfg.Options.MetricsAddr != mgr.addr {
+		// envoy unlinks a stale socket file when binding, but not when it closes
+		// the listener, so the socket of the previous address is removed here
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", path).Msg("metrics: failed to remove unix socket")
+		}
 	}
 
 	mgr.addr = cfg.Options.MetricsAddr
+	mgr.pathPrefix = cfg.Options.MetricsPathPrefix
 	mgr.basicAuth = cfg.Options.MetricsBasicAuth
 	mgr.installationID = cfg.Options.InstallationID
+	mgr.eventTimestamps = eventTimestamps
+	mgr.nativeHistograms = cfg.Options.MetricsNativeHistograms
 	mgr.handler = nil
 
-	if mgr.addr == "" {
+	if mgr.addr == "" && mgr.pathPrefix == "" {
 		log.Info().Msg("metrics: http server disabled")
-		return
+		return nil
 	}
 
-	handler, err := metrics.PrometheusHandler(EnvoyAdminURL, mgr.installationID)
+	promHandler, err := metrics.PrometheusHandler(EnvoyAdminURL, mgr.installationID,
+		metrics.WithEventTimestamps(cfg.Options.MetricsEventTimestamps),
+		metrics.WithNativeHistograms(cfg.Options.MetricsNativeHistograms))
 	if err != nil {
-		log.Error().Err(err).Msg("metrics: failed to create prometheus handler")
-		return
+		// forget the failed settings so the change is re-applied on retry
+		mgr.addr, mgr.pathPrefix, mgr.basicAuth, mgr.installationID, mgr.eventTimestamps = "", "", "", "", ""
+		mgr.nativeHistograms = false
+		return fmt.Errorf("metrics: failed to create prometheus handler: %w", err)
 	}
 
+	mux := http.NewServeMux()
+	mux.Handle("/", promHandler)
+	mux.Handle("/metrics", promHandler)
+	mux.Handle(metrics.TenantMetricsPathPrefix, mgr.tenants)
+	var handler http.Handler = mux
+
 	if username, password, ok := cfg.Options.GetMetricsBasicAuth(); ok {
 		handler = middleware.RequireBasicAuth(username, password)(handler)
 	}
 
 	mgr.handler = handler
+	return nil
+}
+
+func (mgr *MetricsManager) updateStatsD(cfg *Config) error {
+	interval := cfg.Options.StatsDInterval
+	if interval <= 0 {
+		interval = DefaultStatsDInterval
+	}
+	if cfg.Options.StatsDAddr == mgr.statsdAddr &&
+		interval == mgr.statsdInterval &&
+		cfg.Options.InstallationID == mgr.statsdInstallationID {
+		return nil
+	}
+
+	if err := mgr.closeStatsDLocked(); err != nil {
+		log.Warn().Err(err).Msg("metrics: failed to stop statsd forwarder")
+	}
+	mgr.statsdAddr = cfg.Options.StatsDAddr
+	mgr.statsdInterval = interval
+	mgr.statsdInstallationID = cfg.Options.InstallationID
+
+	if mgr.statsdAddr == "" {
+		return nil
+	}
+
+	fwd, err := metrics.NewStatsDForwarder(mgr.statsdAddr, interval, mgr.statsdInstallationID)
+	if err != nil {
+		// forget the failed settings so the change is re-applied on retry
+		mgr.statsdAddr = ""
+		return fmt.Errorf("metrics: failed to start statsd forwarder: %w", err)
+	}
+	log.Info().Str("addr", mgr.statsdAddr).Dur("interval", interval).Msg("metrics: forwarding to statsd")
+	mgr.statsdForwarder = fwd
+	return nil
+}
+
+func (mgr *MetricsManager) closeStatsDLocked() error {
+	if mgr.statsdForwarder == nil {
+		return nil
+	}
+	err := mgr.statsdForwarder.Close()
+	mgr.statsdForwarder = nil
+	return err
+}
+
+func (mgr *MetricsManager) updateCloudWatch(cfg *Config) error {
+	interval := cfg.Options.CloudWatchInterval
+	if interval <= 0 {
+		interval = DefaultCloudWatchInterval
+	}
+	if cfg.Options.CloudWatchNamespace == mgr.cloudWatchNamespace &&
+		cfg.Options.CloudWatchRegion == mgr.cloudWatchRegion &&
+		interval == mgr.cloudWatchInterval &&
+		cfg.Options.InstallationID == mgr.cloudWatchInstallationID &&
+		cfg.Options.DataBrokerStorageType == mgr.cloudWatchBackend {
+		return nil
+	}
+
+	_ = mgr.closeCloudWatchLocked()
+	mgr.cloudWatchNamespace = cfg.Options.CloudWatchNamespace
+	mgr.cloudWatchRegion = cfg.Options.CloudWatchRegion
+	mgr.cloudWatchInterval = interval
+	mgr.cloudWatchInstallationID = cfg.Options.InstallationID
+	mgr.cloudWatchBackend = cfg.Options.DataBrokerStorageType
+
+	if mgr.cloudWatchNamespace == "" {
+		return nil
+	}
+
+	fwd, err := mgr.newCloudWatchForwarderLocked()
+	if err != nil {
+		// forget the failed settings so the change is re-applied on retry
+		mgr.cloudWatchNamespace = ""
+		return fmt.Errorf("metrics: failed to start cloudwatch forwarder: %w", err)
+	}
+	log.Info().
+		Str("namespace", mgr.cloudWatchNamespace).
+		Str("region", mgr.cloudWatchRegion).
+		Dur("interval", interval).
+		Msg("metrics: forwarding to cloudwatch")
+	mgr.cloudWatchForwarder = fwd
+	return nil
+}
+
+func (mgr *MetricsManager) newCloudWatchForwarderLocked() (*metrics.CloudWatchForwarder, error) {
+	if mgr.cloudWatchRegion == "" {
+		return nil, fmt.Errorf("cloudwatch region is required")
+	}
+	client, err := newCloudWatchClient(mgr.cloudWatchRegion)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.NewCloudWatchForwarder(client, mgr.cloudWatchNamespace, mgr.cloudWatchInterval,
+		mgr.cloudWatchInstallationID, mgr.cloudWatchBackend)
+}
+
+func (mgr *MetricsManager) closeCloudWatchLocked() error {
+	if mgr.cloudWatchForwarder == nil {
+		return nil
+	}
+	err := mgr.cloudWatchForwarder.Close()
+	mgr.cloudWatchForwarder = nil
+	return err
+}
+
+func (mgr *MetricsManager) updateOTLP(cfg *Config) error {
+	interval := cfg.Options.OTLPMetricsInterval
+	if interval <= 0 {
+		interval = DefaultOTLPInterval
+	}
+	if cfg.Options.OTLPMetricsAddr == mgr.otlpAddr &&
+		interval == mgr.otlpInterval &&
+		cfg.Options.OTLPMetricsInsecure == mgr.otlpInsecure &&
+		cfg.Options.OTLPMetricsCAFile == mgr.otlpCAFile &&
+		reflect.DeepEqual(cfg.Options.OTLPMetricsHeaders, mgr.otlpHeaders) &&
+		mgr.serviceName == mgr.otlpServiceName &&
+		cfg.Options.InstallationID == mgr.otlpInstallationID {
+		return nil
+	}
+
+	if err := mgr.closeOTLPLocked(); err != nil {
+		log.Warn().Err(err).Msg("metrics: failed to stop otlp forwarder")
+	}
+	mgr.otlpAddr = cfg.Options.OTLPMetricsAddr
+	mgr.otlpInterval = interval
+	mgr.otlpInsecure = cfg.Options.OTLPMetricsInsecure
+	mgr.otlpCAFile = cfg.Options.OTLPMetricsCAFile
+	mgr.otlpHeaders = cfg.Options.OTLPMetricsHeaders
+	mgr.otlpServiceName = mgr.serviceName
+	mgr.otlpInstallationID = cfg.Options.InstallationID
+
+	if mgr.otlpAddr == "" {
+		return nil
+	}
+
+	fwd, err := mgr.newOTLPForwarderLocked()
+	if err != nil {
+		// forget the failed settings so the change is re-applied on retry
+		mgr.otlpAddr = ""
+		return fmt.Errorf("metrics: failed to start otlp forwarder: %w", err)
+	}
+	log.Info().Str("addr", mgr.otlpAddr).Dur("interval", interval).Msg("metrics: exporting to otlp collector")
+	mgr.otlpForwarder = fwd
+	return nil
+}
+
+func (mgr *MetricsManager) newOTLPForwarderLocked() (*metrics.OTLPForwarder, error) {
+	options := []metrics.OTLPOption{
+		metrics.WithOTLPInsecure(mgr.otlpInsecure),
+		metrics.WithOTLPHeaders(mgr.otlpHeaders),
+	}
+	if !mgr.otlpInsecure {
+		rootCAs, err := cryptutil.GetCertPoolFromFiles(mgr.otlpCAFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, metrics.WithOTLPTLSConfig(&tls.Config{
+			RootCAs:    rootCAs,
+			MinVersion: tls.VersionTLS12,
+		}))
+	}
+	return metrics.NewOTLPForwarder(mgr.otlpAddr, mgr.otlpInterval, mgr.otlpServiceName, mgr.otlpInstallationID,
+		options...)
+}
+
+func (mgr *MetricsManager) closeOTLPLocked() error {
+	if mgr.otlpForwarder == nil {
+		return nil
+	}
+	err := mgr.otlpForwarder.Close()
+	mgr.otlpForwarder = nil
+	return err
 }
@@ -1,14 +1,26 @@
 package config
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 )
 
 func TestMetricsManager(t *testing.T) {
@@ -57,3 +69,333 @@ func TestMetricsManagerBasicAuth(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 }
+
+func TestMetricsManagerBasicAuthBcrypt(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("y"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			MetricsAddr:      "ADDRESS",
+			MetricsBasicAuth: base64.StdEncoding.EncodeToString([]byte("x:" + string(hash))),
+		},
+	})
+	mgr := NewMetricsManager(src)
+	srv1 := httptest.NewServer(mgr)
+	defer srv1.Close()
+
+	getStatusCode := func(username, password string) int {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/metrics", srv1.URL), nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(username, password)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, getStatusCode("x", "y"))
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode("x", string(hash)), "the hash itself should not be accepted")
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode("x", "z"))
+}
+
+func TestMetricsManagerTenants(t *testing.T) {
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			MetricsAddr:    "ADDRESS",
+			MetricsTenants: []string{"a", "b"},
+		},
+	})
+	mgr := NewMetricsManager(src)
+	srv := httptest.NewServer(mgr)
+	defer srv.Close()
+
+	for _, tenant := range []string{"a", "b"} {
+		reg, ok := mgr.TenantRegistry(tenant)
+		require.True(t, ok)
+		counter := prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tenant_" + tenant + "_total",
+			Help: "A tenant counter",
+		})
+		require.NoError(t, reg.Register(counter))
+		counter.Inc()
+	}
+	_, ok := mgr.TenantRegistry("c")
+	assert.False(t, ok)
+
+	scrape := func(path string) (int, string) {
+		res, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		bs, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(bs)
+	}
+
+	status, body := scrape("/metrics/a")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "tenant_a_total 1")
+	assert.NotContains(t, body, "tenant_b_total")
+
+	status, body = scrape("/metrics/b")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "tenant_b_total 1")
+	assert.NotContains(t, body, "tenant_a_total")
+
+	status, _ = scrape("/metrics/c")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = scrape("/metrics")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "tenant_a_total")
+}
+
+func TestMetricsManagerMount(t *testing.T) {
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			MetricsPathPrefix: "/internal/metrics",
+			MetricsBasicAuth:  base64.StdEncoding.EncodeToString([]byte("x:y")),
+			MetricsTenants:    []string{"a"},
+		},
+	})
+	mgr := NewMetricsManager(src)
+	defer mgr.Close()
+
+	router := mux.NewRouter()
+	router.Path("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ROOT")
+	})
+	mgr.Mount(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	get := func(path string, auth bool) (int, string) {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		require.NoError(t, err)
+		if auth {
+			req.SetBasicAuth("x", "y")
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		bs, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(bs)
+	}
+
+	status, body := get("/internal/metrics", true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "pomerium_build_info")
+
+	status, _ = get("/internal/metrics", false)
+	assert.Equal(t, http.StatusUnauthorized, status, "basic auth should still be required")
+
+	status, _ = get("/internal/metrics/a", true)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = get("/internal/metrics/b", true)
+	assert.Equal(t, http.StatusNotFound, status, "only the configured tenants should be served")
+
+	status, body = get("/", false)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ROOT", body, "other routes should not be affected")
+
+	status, _ = get("/internal/metricsfoo", true)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	src.SetConfig(&Config{Options: &Options{}})
+	status, _ = get("/internal/metrics", true)
+	assert.Equal(t, http.StatusNotFound, status, "metrics should no longer be served once the prefix is removed")
+}
+
+func TestMetricsManagerUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+	src := NewStaticSource(&Config{Options: &Options{MetricsAddr: "unix:" + path}})
+	mgr := NewMetricsManager(src)
+	defer mgr.Close()
+	assert.NotNil(t, mgr.handler)
+
+	// the socket is bound by envoy
+	require.NoError(t, ioutil.WriteFile(path, nil, 0o600))
+
+	src.SetConfig(&Config{Options: &Options{MetricsAddr: "127.0.0.1:9902"}})
+	assert.NoFileExists(t, path, "the socket should be removed when the address changes")
+}
+
+func TestMetricsManagerStatsD(t *testing.T) {
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer receiver.Close()
+
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			StatsDAddr:     receiver.LocalAddr().String(),
+			StatsDInterval: time.Millisecond * 10,
+		},
+	})
+	mgr := NewMetricsManager(src)
+
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(time.Second*5)))
+	buf := make([]byte, 2048)
+	n, _, err := receiver.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.NotZero(t, n)
+
+	assert.NoError(t, mgr.Close())
+	assert.Nil(t, mgr.statsdForwarder, "close should stop the forwarder")
+}
+
+func TestMetricsManagerOTLP(t *testing.T) {
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			MetricsAddr:     "127.0.0.1:9902",
+			OTLPMetricsAddr: "127.0.0.1:1",
+		},
+	})
+	mgr := NewMetricsManager(src)
+
+	// the collector is unreachable, which must not prevent serving prometheus metrics
+	assert.NotNil(t, mgr.handler)
+	fwd := mgr.otlpForwarder
+	assert.NotNil(t, fwd)
+
+	src.SetConfig(&Config{
+		Options: &Options{
+			MetricsAddr:     "127.0.0.1:9902",
+			OTLPMetricsAddr: "127.0.0.1:2",
+		},
+	})
+	assert.NotNil(t, mgr.otlpForwarder)
+	assert.NotSame(t, fwd, mgr.otlpForwarder, "changing the collector address should replace the forwarder")
+	fwd = mgr.otlpForwarder
+
+	src.SetConfig(&Config{
+		Options: &Options{
+			MetricsAddr:         "127.0.0.1:9902",
+			OTLPMetricsAddr:     "127.0.0.1:2",
+			OTLPMetricsInsecure: true,
+			OTLPMetricsHeaders:  map[string]string{"Authorization": "Bearer TOKEN"},
+		},
+	})
+	assert.NotNil(t, mgr.otlpForwarder)
+	assert.NotSame(t, fwd, mgr.otlpForwarder, "changing the collector connection should replace the forwarder")
+
+	assert.NoError(t, mgr.Close())
+	assert.Nil(t, mgr.otlpForwarder, "close should stop the forwarder")
+}
+
+type cloudWatchClientFunc func(ctx context.Context, namespace string, data []metrics.CloudWatchDatum) error
+
+func (f cloudWatchClientFunc) PutMetricData(ctx context.Context, namespace string, data []metrics.CloudWatchDatum) error {
+	return f(ctx, namespace, data)
+}
+
+func TestMetricsManagerCloudWatch(t *testing.T) {
+	namespaces := make(chan string, 100)
+	regions := make(chan string, 1)
+	defer func(original func(string) (metrics.CloudWatchClient, error)) { newCloudWatchClient = original }(newCloudWatchClient)
+	newCloudWatchClient = func(region string) (metrics.CloudWatchClient, error) {
+		regions <- region
+		return cloudWatchClientFunc(func(ctx context.Context, namespace string, data []metrics.CloudWatchDatum) error {
+			select {
+			case namespaces <- namespace:
+			default:
+			}
+			return nil
+		}), nil
+	}
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			CloudWatchNamespace: "Pomerium",
+			CloudWatchRegion:    "us-east-1",
+			CloudWatchInterval:  time.Millisecond * 10,
+		},
+	})
+	mgr := NewMetricsManager(src)
+	assert.Equal(t, "us-east-1", <-regions)
+	metrics.RecordDataBrokerWebhookEventDropped(context.Background())
+
+	select {
+	case namespace := <-namespaces:
+		assert.Equal(t, "Pomerium", namespace)
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected metrics to be forwarded to cloudwatch")
+	}
+
+	src.SetConfig(&Config{Options: &Options{}})
+	assert.Nil(t, mgr.cloudWatchForwarder, "removing the namespace should stop the forwarder")
+	assert.NoError(t, mgr.Close())
+}
+
+func TestMetricsManagerForwarderFailure(t *testing.T) {
+	defer func(original func(string) (metrics.CloudWatchClient, error)) { newCloudWatchClient = original }(newCloudWatchClient)
+	newCloudWatchClient = func(region string) (metrics.CloudWatchClient, error) {
+		return nil, fmt.Errorf("no credentials")
+	}
+
+	mgr := &MetricsManager{
+		tenants: metrics.NewTenantRegistries(),
+		sinks:   metrics.NewMetricSinks(metrics.DefaultMetricSinkInterval),
+	}
+	defer func() { _ = mgr.Close() }()
+	err := mgr.applyConfig(&Config{
+		Options: &Options{
+			MetricsAddr:         "127.0.0.1:9902",
+			CloudWatchNamespace: "Pomerium",
+			CloudWatchRegion:    "us-east-1",
+		},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no credentials")
+	}
+	assert.NotNil(t, mgr.handler, "a failing forwarder must not prevent serving prometheus metrics")
+	assert.Equal(t, "", mgr.cloudWatchNamespace, "the failed forwarder should be re-applied on retry")
+}
+
+func TestMetricsManagerCloseCancelsRetry(t *testing.T) {
+	var calls int32
+	defer func(original func(string) (metrics.CloudWatchClient, error)) { newCloudWatchClient = original }(newCloudWatchClient)
+	newCloudWatchClient = func(region string) (metrics.CloudWatchClient, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, fmt.Errorf("no credentials")
+	}
+
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			CloudWatchNamespace: "Pomerium",
+			CloudWatchRegion:    "us-east-1",
+		},
+	})
+	mgr := NewMetricsManager(src, WithMetricsChangeRetryIntervals(time.Millisecond*10, time.Millisecond*10))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 1
+	}, time.Second*5, time.Millisecond*10, "the failed change should be retried")
+
+	require.NoError(t, mgr.Close())
+	closed := atomic.LoadInt32(&calls)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, closed, atomic.LoadInt32(&calls), "the change should not be retried once closed")
+}
+
+func TestMetricsManagerSnapshot(t *testing.T) {
+	src := NewStaticSource(&Config{
+		Options: &Options{
+			InstallationID: "INSTALLATION",
+			Services:       "all",
+		},
+	})
+	mgr := NewMetricsManager(src)
+	defer mgr.Close()
+
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	require.NoError(t, mgr.WriteSnapshotFile(context.Background(), path))
+
+	bs, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), `pomerium_build_info{`)
+	assert.Contains(t, string(bs), `installation_id="INSTALLATION"`)
+	assert.Contains(t, string(bs), `pomerium_envoy_stats_available`)
+
+	matches, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Empty(t, matches, "should not leave temporary files behind")
+}
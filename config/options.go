@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/pomerium/pomerium/internal/directory/azure"
 	"github.com/pomerium/pomerium/internal/directory/github"
@@ -26,11 +28,13 @@ import (
 	"github.com/pomerium/pomerium/internal/hashutil"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/middleware"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
 // DisableHeaderKey is the key used to check whether to disable setting header
@@ -69,6 +73,10 @@ type Options struct {
 	// SharedKey is the shared secret authorization key used to mutually authenticate
 	// requests between services.
 	SharedKey string `mapstructure:"shared_secret" yaml:"shared_secret,omitempty"`
+	// PreviousSharedKeys are keys which were previously the shared secret. They're
+	// only used by the databroker, to read the records written with them, so that
+	// the shared secret can be rotated without losing the stored records.
+	PreviousSharedKeys []string `mapstructure:"previous_shared_secrets" yaml:"previous_shared_secrets,omitempty"`
 
 	// Services is a list enabled service mode. If none are selected, "all" is used.
 	// Available options are : "all", "authenticate", "proxy".
@@ -182,10 +190,40 @@ type Options struct {
 
 	DefaultUpstreamTimeout time.Duration `mapstructure:"default_upstream_timeout" yaml:"default_upstream_timeout,omitempty"`
 
-	// Address/Port to bind to for prometheus metrics
+	// Address/Port to bind to for prometheus metrics, or unix:{path} for a unix
+	// domain socket
 	MetricsAddr string `mapstructure:"metrics_address" yaml:"metrics_address,omitempty"`
+	// - the octal file mode of the metrics unix domain socket
+	MetricsSocketMode string `mapstructure:"metrics_socket_mode" yaml:"metrics_socket_mode,omitempty"`
+	// - also serve prometheus metrics from the main HTTP server under this path
+	MetricsPathPrefix string `mapstructure:"metrics_path_prefix" yaml:"metrics_path_prefix,omitempty"`
 	// - require basic auth for prometheus metrics, base64 encoded user:pass string
 	MetricsBasicAuth string `mapstructure:"metrics_basic_auth" yaml:"metrics_basic_auth,omitempty"`
+	// - serve separate metrics for each tenant under /metrics/{tenant}
+	MetricsTenants []string `mapstructure:"metrics_tenants" yaml:"metrics_tenants,omitempty"`
+	// - expose the event time, rather than the scrape time, for these metric families
+	MetricsEventTimestamps []string `mapstructure:"metrics_event_timestamps" yaml:"metrics_event_timestamps,omitempty"`
+	// - expose the number of session records associated with each route
+	MetricsRouteSessionCounts bool `mapstructure:"metrics_route_session_counts" yaml:"metrics_route_session_counts,omitempty"`
+	// - expose the key values of the effective databroker config as labels of an info metric
+	MetricsDataBrokerConfigInfo bool `mapstructure:"metrics_databroker_config_info" yaml:"metrics_databroker_config_info,omitempty"`
+	// - expose the databroker's histograms as native histograms to protobuf scrapes
+	MetricsNativeHistograms bool `mapstructure:"metrics_native_histograms" yaml:"metrics_native_histograms,omitempty"`
+	// - write a snapshot of the metrics to this file on SIGUSR1
+	MetricsSnapshotFile string `mapstructure:"metrics_snapshot_file" yaml:"metrics_snapshot_file,omitempty"`
+	// - forward metrics to a StatsD (DogStatsD) server
+	StatsDAddr     string        `mapstructure:"statsd_address" yaml:"statsd_address,omitempty"`
+	StatsDInterval time.Duration `mapstructure:"statsd_interval" yaml:"statsd_interval,omitempty"`
+	// - forward the databroker and storage metrics to CloudWatch
+	CloudWatchNamespace string        `mapstructure:"cloudwatch_namespace" yaml:"cloudwatch_namespace,omitempty"`
+	CloudWatchRegion    string        `mapstructure:"cloudwatch_region" yaml:"cloudwatch_region,omitempty"`
+	CloudWatchInterval  time.Duration `mapstructure:"cloudwatch_interval" yaml:"cloudwatch_interval,omitempty"`
+	// - push metrics to an OpenTelemetry collector with OTLP over gRPC
+	OTLPMetricsAddr     string            `mapstructure:"otlp_metrics_address" yaml:"otlp_metrics_address,omitempty"`
+	OTLPMetricsInterval time.Duration     `mapstructure:"otlp_metrics_interval" yaml:"otlp_metrics_interval,omitempty"`
+	OTLPMetricsInsecure bool              `mapstructure:"otlp_metrics_insecure" yaml:"otlp_metrics_insecure,omitempty"`
+	OTLPMetricsCAFile   string            `mapstructure:"otlp_metrics_ca_file" yaml:"otlp_metrics_ca_file,omitempty"`
+	OTLPMetricsHeaders  map[string]string `mapstructure:"otlp_metrics_headers" yaml:"otlp_metrics_headers,omitempty"`
 	// - TLS options
 	MetricsCertificate        string `mapstructure:"metrics_certificate" yaml:"metrics_certificate,omitempty"`
 	MetricsCertificateKey     string `mapstructure:"metrics_certificate_key" yaml:"metrics_certificate_key,omitempty"`
@@ -229,10 +267,24 @@ type Options struct {
 	GRPCClientTimeout       time.Duration `mapstructure:"grpc_client_timeout" yaml:"grpc_client_timeout,omitempty"`
 	GRPCClientDNSRoundRobin bool          `mapstructure:"grpc_client_dns_roundrobin" yaml:"grpc_client_dns_roundrobin,omitempty"`
 
+	// GRPCCompression enables gzip compression of gRPC requests between services.
+	GRPCCompression bool `mapstructure:"grpc_compression" yaml:"grpc_compression,omitempty"`
+
+	// GRPCTLSMinVersion sets the minimum TLS version of gRPC connections between
+	// services, "1.2" or "1.3".
+	GRPCTLSMinVersion string `mapstructure:"grpc_tls_min_version" yaml:"grpc_tls_min_version,omitempty"`
+	// GRPCTLSCipherSuites sets the TLS 1.2 cipher suites of gRPC connections between
+	// services, by their OpenSSL names.
+	GRPCTLSCipherSuites []string `mapstructure:"grpc_tls_cipher_suites" yaml:"grpc_tls_cipher_suites,omitempty"`
+
 	// GRPCServerMaxConnectionAge sets MaxConnectionAge in the grpc ServerParameters used to create GRPC Services
 	GRPCServerMaxConnectionAge time.Duration `mapstructure:"grpc_server_max_connection_age" yaml:"grpc_server_max_connection_age,omitempty"`
 	// GRPCServerMaxConnectionAgeGrace sets MaxConnectionAgeGrace in the grpc ServerParameters used to create GRPC Services
 	GRPCServerMaxConnectionAgeGrace time.Duration `mapstructure:"grpc_server_max_connection_age_grace,omitempty" yaml:"grpc_server_max_connection_age_grace,omitempty"` //nolint: lll
+	// GRPCServerMaxRecvMsgSize sets the maximum message size in bytes the databroker gRPC server can receive
+	GRPCServerMaxRecvMsgSize int `mapstructure:"grpc_server_max_recv_msg_size" yaml:"grpc_server_max_recv_msg_size,omitempty"`
+	// GRPCServerMaxSendMsgSize sets the maximum message size in bytes the databroker gRPC server can send
+	GRPCServerMaxSendMsgSize int `mapstructure:"grpc_server_max_send_msg_size" yaml:"grpc_server_max_send_msg_size,omitempty"`
 
 	// ForwardAuthEndpoint allows for a given route to be used as a forward-auth
 	// endpoint instead of a reverse proxy. Some third-party proxies that do not
@@ -254,6 +306,45 @@ type Options struct {
 	DataBrokerStorageCertKeyFile      string `mapstructure:"databroker_storage_key_file" yaml:"databroker_storage_key_file,omitempty"`
 	DataBrokerStorageCAFile           string `mapstructure:"databroker_storage_ca_file" yaml:"databroker_storage_ca_file,omitempty"`
 	DataBrokerStorageCertSkipVerify   bool   `mapstructure:"databroker_storage_tls_skip_verify" yaml:"databroker_storage_tls_skip_verify,omitempty"`
+	// DataBrokerStorageCA is a base64-encoded PEM certificate authority for storage
+	// connections, added to those of DataBrokerStorageCAFile.
+	DataBrokerStorageCA string `mapstructure:"databroker_storage_ca" yaml:"databroker_storage_ca,omitempty"`
+	// DataBrokerStorageCertReloadInterval is the minimum interval between checks of
+	// the storage certificate files for changes.
+	DataBrokerStorageCertReloadInterval time.Duration `mapstructure:"databroker_storage_cert_reload_interval" yaml:"databroker_storage_cert_reload_interval,omitempty"`
+	// DataBrokerStoragePoolSize is the maximum number of storage connections, and
+	// DataBrokerStorageMinIdleConns the minimum number of idle ones.
+	DataBrokerStoragePoolSize     int `mapstructure:"databroker_storage_pool_size" yaml:"databroker_storage_pool_size,omitempty"`
+	DataBrokerStorageMinIdleConns int `mapstructure:"databroker_storage_min_idle_conns" yaml:"databroker_storage_min_idle_conns,omitempty"`
+	// DataBrokerStorageKeyPrefix namespaces the keys of the redis storage backend.
+	DataBrokerStorageKeyPrefix string `mapstructure:"databroker_storage_key_prefix" yaml:"databroker_storage_key_prefix,omitempty"`
+	// DataBrokerStorageChangeCompression is the codec the change log of the redis
+	// storage backend is compressed with.
+	DataBrokerStorageChangeCompression string `mapstructure:"databroker_storage_change_compression" yaml:"databroker_storage_change_compression,omitempty"`
+	// DataBrokerStorageCredentialsFile is the credentials file used to authenticate
+	// to Firestore. If unset, Application Default Credentials are used.
+	DataBrokerStorageCredentialsFile string `mapstructure:"databroker_storage_credentials_file" yaml:"databroker_storage_credentials_file,omitempty"`
+	// DataBrokerMinProtocolVersion is the minimum sync protocol version databroker
+	// clients must advertise. 0 accepts all clients.
+	DataBrokerMinProtocolVersion int `mapstructure:"databroker_min_protocol_version" yaml:"databroker_min_protocol_version,omitempty"`
+	// DataBrokerDeleteModes sets how the records of each of the types are deleted.
+	DataBrokerDeleteModes []DataBrokerDeleteMode `mapstructure:"databroker_delete_modes" yaml:"databroker_delete_modes,omitempty"`
+	// DataBrokerAdminAddress is the address of the listener of the databroker admin
+	// service, which serves the operational RPCs with mutual TLS. The admin service
+	// is disabled if empty.
+	DataBrokerAdminAddress      string `mapstructure:"databroker_admin_address" yaml:"databroker_admin_address,omitempty"`
+	DataBrokerAdminCertFile     string `mapstructure:"databroker_admin_cert_file" yaml:"databroker_admin_cert_file,omitempty"`
+	DataBrokerAdminKeyFile      string `mapstructure:"databroker_admin_key_file" yaml:"databroker_admin_key_file,omitempty"`
+	DataBrokerAdminClientCAFile string `mapstructure:"databroker_admin_client_ca_file" yaml:"databroker_admin_client_ca_file,omitempty"`
+	// DataBrokerKafkaBrokers are the addresses of the Kafka brokers the databroker
+	// publishes record changes to. Changes are only published if set.
+	DataBrokerKafkaBrokers []string `mapstructure:"databroker_kafka_brokers" yaml:"databroker_kafka_brokers,omitempty"`
+	DataBrokerKafkaTLS     bool     `mapstructure:"databroker_kafka_tls" yaml:"databroker_kafka_tls,omitempty"`
+	DataBrokerKafkaTopic   string   `mapstructure:"databroker_kafka_topic" yaml:"databroker_kafka_topic,omitempty"`
+	// DataBrokerKafkaSerialization is the serialization of the published record
+	// changes: json (the default), protobuf or cloudevents.
+	DataBrokerKafkaSerialization  string `mapstructure:"databroker_kafka_serialization" yaml:"databroker_kafka_serialization,omitempty"`
+	DataBrokerKafkaIncludePayload bool   `mapstructure:"databroker_kafka_include_payload" yaml:"databroker_kafka_include_payload,omitempty"`
 
 	// ClientCA is the base64-encoded certificate authority to validate client mTLS certificates against.
 	ClientCA string `mapstructure:"client_ca" yaml:"client_ca,omitempty"`
@@ -516,7 +607,7 @@ func (o *Options) Validate() error {
 
 	switch o.DataBrokerStorageType {
 	case StorageInMemoryName:
-	case StorageRedisName:
+	case StorageRedisName, StorageFirestoreName:
 		if o.DataBrokerStorageConnectionString == "" {
 			return errors.New("config: missing databroker storage backend dsn")
 		}
@@ -627,6 +718,75 @@ func (o *Options) Validate() error {
 			return fmt.Errorf("config: bad databroker cert file %w", err)
 		}
 	}
+	if strings.ContainsAny(o.DataBrokerStorageKeyPrefix, "{}") {
+		return fmt.Errorf("config: databroker_storage_key_prefix must not contain braces")
+	}
+	if o.DataBrokerStorageChangeCompression != "" && !databroker.IsSupportedCompression(o.DataBrokerStorageChangeCompression) {
+		return fmt.Errorf("config: unsupported databroker_storage_change_compression: %s", o.DataBrokerStorageChangeCompression)
+	}
+	if o.DataBrokerStorageCertReloadInterval < 0 {
+		return fmt.Errorf("config: databroker_storage_cert_reload_interval must not be negative")
+	}
+	if o.DataBrokerStoragePoolSize < 0 {
+		return fmt.Errorf("config: databroker_storage_pool_size must not be negative: %d", o.DataBrokerStoragePoolSize)
+	}
+	if o.DataBrokerStorageMinIdleConns < 0 {
+		return fmt.Errorf("config: databroker_storage_min_idle_conns must not be negative: %d", o.DataBrokerStorageMinIdleConns)
+	}
+	if o.DataBrokerStoragePoolSize > 0 && o.DataBrokerStorageMinIdleConns > o.DataBrokerStoragePoolSize {
+		return fmt.Errorf("config: databroker_storage_min_idle_conns must not exceed databroker_storage_pool_size: %d > %d",
+			o.DataBrokerStorageMinIdleConns, o.DataBrokerStoragePoolSize)
+	}
+
+	if o.DataBrokerStorageCredentialsFile != "" {
+		if _, err := os.Stat(o.DataBrokerStorageCredentialsFile); err != nil {
+			return fmt.Errorf("config: bad databroker storage credentials file: %w", err)
+		}
+	}
+
+	if o.DataBrokerMinProtocolVersion < 0 {
+		return fmt.Errorf("config: databroker min protocol version must not be negative: %d", o.DataBrokerMinProtocolVersion)
+	}
+
+	deleteModeTypes := make(map[string]struct{}, len(o.DataBrokerDeleteModes))
+	for _, deleteMode := range o.DataBrokerDeleteModes {
+		if deleteMode.Type == "" {
+			return fmt.Errorf("config: databroker delete mode type is required")
+		}
+		if _, ok := deleteModeTypes[deleteMode.Type]; ok {
+			return fmt.Errorf("config: duplicate databroker delete mode for %s", deleteMode.Type)
+		}
+		deleteModeTypes[deleteMode.Type] = struct{}{}
+		switch deleteMode.Mode {
+		case DeleteModeSoft, DeleteModeImmediate:
+		default:
+			return fmt.Errorf("config: unsupported databroker delete mode for %s: %s", deleteMode.Type, deleteMode.Mode)
+		}
+	}
+
+	if o.DataBrokerAdminAddress != "" {
+		if o.DataBrokerAdminCertFile == "" || o.DataBrokerAdminKeyFile == "" {
+			return fmt.Errorf("config: databroker admin cert and key files are required")
+		}
+		if _, err := cryptutil.CertificateFromFile(o.DataBrokerAdminCertFile, o.DataBrokerAdminKeyFile); err != nil {
+			return fmt.Errorf("config: bad databroker admin cert: %w", err)
+		}
+		if o.DataBrokerAdminClientCAFile == "" {
+			return fmt.Errorf("config: databroker admin client ca file is required")
+		}
+		if _, err := os.Stat(o.DataBrokerAdminClientCAFile); err != nil {
+			return fmt.Errorf("config: bad databroker admin client ca file: %w", err)
+		}
+	}
+
+	if len(o.DataBrokerKafkaBrokers) > 0 && o.DataBrokerKafkaTopic == "" {
+		return fmt.Errorf("config: databroker kafka topic is required")
+	}
+	switch o.DataBrokerKafkaSerialization {
+	case "", "json", "protobuf", "cloudevents":
+	default:
+		return fmt.Errorf("config: unsupported databroker kafka serialization: %s", o.DataBrokerKafkaSerialization)
+	}
 
 	if o.DataBrokerStorageCAFile != "" {
 		if _, err := os.Stat(o.DataBrokerStorageCAFile); err != nil {
@@ -634,6 +794,18 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.OTLPMetricsCAFile != "" {
+		if _, err := os.Stat(o.OTLPMetricsCAFile); err != nil {
+			return fmt.Errorf("config: bad otlp metrics ca file: %w", err)
+		}
+	}
+
+	if o.DataBrokerStorageCA != "" {
+		if _, err := o.GetDataBrokerStorageCA(); err != nil {
+			return fmt.Errorf("config: bad databroker ca: %w", err)
+		}
+	}
+
 	if o.ClientCA != "" {
 		if _, err := base64.StdEncoding.DecodeString(o.ClientCA); err != nil {
 			return fmt.Errorf("config: bad client ca base64: %w", err)
@@ -695,6 +867,24 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.MetricsSocketMode != "" {
+		if _, err := ParseMetricsSocketMode(o.MetricsSocketMode); err != nil {
+			return fmt.Errorf("config: invalid metrics_socket_mode: %w", err)
+		}
+	}
+
+	if o.MetricsPathPrefix != "" {
+		if err := ValidateMetricsPathPrefix(o.MetricsPathPrefix); err != nil {
+			return fmt.Errorf("config: invalid metrics_path_prefix: %w", err)
+		}
+	}
+
+	for _, tenant := range o.MetricsTenants {
+		if tenant == "" || strings.Contains(tenant, "/") {
+			return fmt.Errorf("config: invalid metrics_tenants: %q must be a non-empty path segment", tenant)
+		}
+	}
+
 	// validate metrics basic auth
 	if o.MetricsBasicAuth != "" {
 		str, err := base64.StdEncoding.DecodeString(o.MetricsBasicAuth)
@@ -705,6 +895,12 @@ func (o *Options) Validate() error {
 		if !strings.Contains(string(str), ":") {
 			return fmt.Errorf("config: metrics_basic_auth should contain a user name and password separated by a colon")
 		}
+
+		if _, password, _ := o.GetMetricsBasicAuth(); middleware.IsBcryptHash(password) {
+			if _, err := bcrypt.Cost([]byte(password)); err != nil {
+				return fmt.Errorf("config: metrics_basic_auth password is not a valid bcrypt hash: %w", err)
+			}
+		}
 	}
 
 	if o.MetricsCertificate != "" && o.MetricsCertificateKey != "" {
@@ -721,6 +917,19 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if err := o.validateMetricsClientCA(); err != nil {
+		return err
+	}
+
+	if o.GRPCTLSMinVersion != "" {
+		if _, err := cryptutil.GetTLSVersion(o.GRPCTLSMinVersion); err != nil {
+			return fmt.Errorf("config: invalid grpc_tls_min_version: %w", err)
+		}
+	}
+	if _, err := cryptutil.GetTLSCipherSuites(o.GRPCTLSCipherSuites); err != nil {
+		return fmt.Errorf("config: invalid grpc_tls_cipher_suites: %w", err)
+	}
+
 	return nil
 }
 
@@ -782,6 +991,51 @@ func (o *Options) GetSignOutRedirectURL() (*url.URL, error) {
 	return urlutil.ParseAndValidateURL(rawurl)
 }
 
+// validateMetricsClientCA validates the metrics client CA. Client certificates are
+// only verified by a metrics listener serving TLS, so without a metrics certificate
+// the client CA is ignored with a warning, as it was before it was supported.
+func (o *Options) validateMetricsClientCA() error {
+	if o.MetricsClientCA == "" && o.MetricsClientCAFile == "" {
+		return nil
+	}
+	if cert, err := o.GetMetricsCertificate(); err != nil || cert == nil {
+		log.Warn().Msg("config: metrics_client_ca is ignored without a metrics_certificate, client certificates are not required")
+		return nil
+	}
+
+	if o.MetricsClientCA != "" {
+		bs, err := base64.StdEncoding.DecodeString(o.MetricsClientCA)
+		if err != nil {
+			return fmt.Errorf("config: metrics_client_ca must be a base64 encoded string")
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(bs) {
+			return fmt.Errorf("config: metrics_client_ca contains no PEM certificates")
+		}
+		return nil
+	}
+	if _, err := os.Stat(o.MetricsClientCAFile); err != nil {
+		return fmt.Errorf("config: bad metrics_client_ca_file: %w", err)
+	}
+	return nil
+}
+
+// GetGRPCTLSMinVersion returns the minimum TLS version of gRPC connections between
+// services. It defaults to TLS 1.2.
+func (o *Options) GetGRPCTLSMinVersion() uint16 {
+	version, err := cryptutil.GetTLSVersion(o.GRPCTLSMinVersion)
+	if err != nil {
+		return tls.VersionTLS12
+	}
+	return version
+}
+
+// GetGRPCTLSCipherSuites returns the TLS 1.2 cipher suites of gRPC connections
+// between services. nil uses the defaults.
+func (o *Options) GetGRPCTLSCipherSuites() []uint16 {
+	cipherSuites, _ := cryptutil.GetTLSCipherSuites(o.GRPCTLSCipherSuites)
+	return cipherSuites
+}
+
 // GetMetricsCertificate returns the metrics certificate to use for TLS. `nil` will be
 // returned if there is no certificate.
 func (o *Options) GetMetricsCertificate() (*tls.Certificate, error) {
@@ -825,6 +1079,23 @@ func (o *Options) GetAllPolicies() []Policy {
 	return policies
 }
 
+// GetDataBrokerStorageCA returns the PEM-encoded databroker storage certificate
+// authority, or nil if none is set. An error is returned unless it's base64
+// encoded and contains a PEM certificate.
+func (o *Options) GetDataBrokerStorageCA() ([]byte, error) {
+	if o.DataBrokerStorageCA == "" {
+		return nil, nil
+	}
+	bs, err := base64.StdEncoding.DecodeString(o.DataBrokerStorageCA)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(bs) {
+		return nil, fmt.Errorf("no PEM-encoded certificates found")
+	}
+	return bs, nil
+}
+
 // GetMetricsBasicAuth gets the metrics basic auth username and password.
 func (o *Options) GetMetricsBasicAuth() (username, password string, ok bool) {
 	if o.MetricsBasicAuth == "" {
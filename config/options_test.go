@@ -45,8 +45,81 @@ func Test_Validate(t *testing.T) {
 	invalidStorageType.DataBrokerStorageType = "foo"
 	missingStorageDSN := testOptions()
 	missingStorageDSN.DataBrokerStorageType = "redis"
+	missingFirestoreDSN := testOptions()
+	missingFirestoreDSN.DataBrokerStorageType = StorageFirestoreName
+	badStorageCredentialsFile := testOptions()
+	badStorageCredentialsFile.DataBrokerStorageCredentialsFile = "missing-credentials.json"
 	badSignoutRedirectURL := testOptions()
 	badSignoutRedirectURL.SignOutRedirectURLString = "--"
+	badMetricsBasicAuthHash := testOptions()
+	badMetricsBasicAuthHash.MetricsBasicAuth = base64.StdEncoding.EncodeToString([]byte("x:$2a$10$invalid"))
+	badDeleteMode := testOptions()
+	badDeleteMode.DataBrokerDeleteModes = []DataBrokerDeleteMode{{Type: "TYPE", Mode: "hard"}}
+	duplicateDeleteMode := testOptions()
+	duplicateDeleteMode.DataBrokerDeleteModes = []DataBrokerDeleteMode{
+		{Type: "TYPE", Mode: DeleteModeSoft},
+		{Type: "TYPE", Mode: DeleteModeImmediate},
+	}
+	metricsClientCAWithoutCert := testOptions()
+	metricsClientCAWithoutCert.MetricsClientCAFile = "./testdata/ca.pem"
+	badMetricsClientCA := testOptions()
+	badMetricsClientCA.MetricsCertificateFile = "./testdata/example-cert.pem"
+	badMetricsClientCA.MetricsCertificateKeyFile = "./testdata/example-key.pem"
+	badMetricsClientCA.MetricsClientCA = base64.StdEncoding.EncodeToString([]byte("not a certificate"))
+	goodMetricsClientCA := testOptions()
+	goodMetricsClientCA.MetricsCertificateFile = "./testdata/example-cert.pem"
+	goodMetricsClientCA.MetricsCertificateKeyFile = "./testdata/example-key.pem"
+	goodMetricsClientCA.MetricsClientCAFile = "./testdata/ca.pem"
+	metricsSocket := testOptions()
+	metricsSocket.MetricsAddr = "unix:/run/pomerium/metrics.sock"
+	metricsSocket.MetricsSocketMode = "0660"
+	relativeMetricsSocket := testOptions()
+	relativeMetricsSocket.MetricsAddr = "unix:metrics.sock"
+	badMetricsSocketMode := testOptions()
+	badMetricsSocketMode.MetricsAddr = "/run/pomerium/metrics.sock"
+	badMetricsSocketMode.MetricsSocketMode = "rw-rw----"
+	otlpMetricsCA := testOptions()
+	otlpMetricsCA.OTLPMetricsAddr = "otel-collector:4317"
+	otlpMetricsCA.OTLPMetricsCAFile = "./testdata/ca.pem"
+	missingOTLPMetricsCA := testOptions()
+	missingOTLPMetricsCA.OTLPMetricsAddr = "otel-collector:4317"
+	missingOTLPMetricsCA.OTLPMetricsCAFile = "./testdata/missing-ca.pem"
+	storagePool := testOptions()
+	storagePool.DataBrokerStoragePoolSize = 10
+	storagePool.DataBrokerStorageMinIdleConns = 10
+	negativeStoragePoolSize := testOptions()
+	negativeStoragePoolSize.DataBrokerStoragePoolSize = -1
+	negativeStorageMinIdleConns := testOptions()
+	negativeStorageMinIdleConns.DataBrokerStorageMinIdleConns = -1
+	storageMinIdleConnsExceedsPoolSize := testOptions()
+	storageMinIdleConnsExceedsPoolSize.DataBrokerStoragePoolSize = 5
+	storageMinIdleConnsExceedsPoolSize.DataBrokerStorageMinIdleConns = 10
+	badStorageCA := testOptions()
+	badStorageCA.DataBrokerStorageCA = base64.StdEncoding.EncodeToString([]byte("NOT PEM"))
+	missingAdminClientCA := testOptions()
+	missingAdminClientCA.DataBrokerAdminAddress = ":5444"
+	missingAdminClientCA.DataBrokerAdminCertFile = "./testdata/example-cert.pem"
+	missingAdminClientCA.DataBrokerAdminKeyFile = "./testdata/example-key.pem"
+	missingAdminCert := testOptions()
+	missingAdminCert.DataBrokerAdminAddress = ":5444"
+	missingAdminCert.DataBrokerAdminClientCAFile = "./testdata/ca.pem"
+	kafka := testOptions()
+	kafka.DataBrokerKafkaBrokers = []string{"kafka:9092"}
+	kafka.DataBrokerKafkaTopic = "changes"
+	kafka.DataBrokerKafkaSerialization = "cloudevents"
+	missingKafkaTopic := testOptions()
+	missingKafkaTopic.DataBrokerKafkaBrokers = []string{"kafka:9092"}
+	badKafkaSerialization := testOptions()
+	badKafkaSerialization.DataBrokerKafkaBrokers = []string{"kafka:9092"}
+	badKafkaSerialization.DataBrokerKafkaTopic = "changes"
+	badKafkaSerialization.DataBrokerKafkaSerialization = "avro"
+	grpcTLS := testOptions()
+	grpcTLS.GRPCTLSMinVersion = "1.3"
+	grpcTLS.GRPCTLSCipherSuites = []string{"ECDHE-RSA-AES128-GCM-SHA256"}
+	badGRPCTLSMinVersion := testOptions()
+	badGRPCTLSMinVersion.GRPCTLSMinVersion = "1.0"
+	badGRPCTLSCipherSuite := testOptions()
+	badGRPCTLSCipherSuite.GRPCTLSCipherSuites = []string{"RC4-SHA"}
 
 	missingSharedSecretWithPersistence := testOptions()
 	missingSharedSecretWithPersistence.SharedKey = ""
@@ -65,7 +138,33 @@ func Test_Validate(t *testing.T) {
 		{"policy file specified", badPolicyFile, true},
 		{"invalid databroker storage type", invalidStorageType, true},
 		{"missing databroker storage dsn", missingStorageDSN, true},
+		{"missing databroker firestore dsn", missingFirestoreDSN, true},
+		{"bad databroker storage credentials file", badStorageCredentialsFile, true},
 		{"invalid signout redirect url", badSignoutRedirectURL, true},
+		{"invalid metrics basic auth bcrypt hash", badMetricsBasicAuthHash, true},
+		{"metrics client ca without metrics certificate is ignored", metricsClientCAWithoutCert, false},
+		{"invalid metrics client ca", badMetricsClientCA, true},
+		{"metrics client ca with metrics certificate", goodMetricsClientCA, false},
+		{"metrics unix socket", metricsSocket, false},
+		{"relative metrics unix socket", relativeMetricsSocket, true},
+		{"invalid metrics socket mode", badMetricsSocketMode, true},
+		{"otlp metrics ca file", otlpMetricsCA, false},
+		{"missing otlp metrics ca file", missingOTLPMetricsCA, true},
+		{"databroker storage pool", storagePool, false},
+		{"negative databroker storage pool size", negativeStoragePoolSize, true},
+		{"negative databroker storage min idle conns", negativeStorageMinIdleConns, true},
+		{"databroker storage min idle conns exceeds pool size", storageMinIdleConnsExceedsPoolSize, true},
+		{"invalid databroker storage ca", badStorageCA, true},
+		{"unsupported databroker delete mode", badDeleteMode, true},
+		{"duplicate databroker delete mode", duplicateDeleteMode, true},
+		{"databroker admin without client ca", missingAdminClientCA, true},
+		{"databroker admin without cert", missingAdminCert, true},
+		{"databroker kafka sink", kafka, false},
+		{"databroker kafka sink without topic", missingKafkaTopic, true},
+		{"unsupported databroker kafka serialization", badKafkaSerialization, true},
+		{"grpc tls settings", grpcTLS, false},
+		{"unsupported grpc tls min version", badGRPCTLSMinVersion, true},
+		{"unsupported grpc tls cipher suite", badGRPCTLSCipherSuite, true},
 		{"no shared key with databroker persistence", missingSharedSecretWithPersistence, true},
 	}
 	for _, tt := range tests {
@@ -79,6 +178,25 @@ func Test_Validate(t *testing.T) {
 	}
 }
 
+func TestOptions_GetDataBrokerStorageCA(t *testing.T) {
+	caPEM, err := ioutil.ReadFile("./testdata/ca.pem")
+	require.NoError(t, err)
+
+	o := NewDefaultOptions()
+	ca, err := o.GetDataBrokerStorageCA()
+	assert.NoError(t, err)
+	assert.Nil(t, ca)
+
+	o.DataBrokerStorageCA = base64.StdEncoding.EncodeToString(caPEM)
+	ca, err = o.GetDataBrokerStorageCA()
+	assert.NoError(t, err)
+	assert.Equal(t, caPEM, ca)
+
+	o.DataBrokerStorageCA = "NOT BASE64"
+	_, err = o.GetDataBrokerStorageCA()
+	assert.Error(t, err)
+}
+
 func Test_bindEnvs(t *testing.T) {
 	o := new(Options)
 	o.viper = viper.New()
@@ -23,6 +23,7 @@ func NewTracingOptions(o *Options) (*TracingOptions, error) {
 		Service:             telemetry.ServiceName(o.Services),
 		JaegerAgentEndpoint: o.TracingJaegerAgentEndpoint,
 		SampleRate:          o.TracingSampleRate,
+		InstallationID:      o.InstallationID,
 	}
 
 	switch o.TracingProvider {
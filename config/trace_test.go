@@ -28,6 +28,12 @@ func Test_NewTracingOptions(t *testing.T) {
 			&TracingOptions{Provider: "datadog", Service: "pomerium"},
 			false,
 		},
+		{
+			"installation_id",
+			&Options{TracingProvider: "datadog", InstallationID: "INSTALLATION-1"},
+			&TracingOptions{Provider: "datadog", Service: "pomerium", InstallationID: "INSTALLATION-1"},
+			false,
+		},
 		{
 			"jaeger_good",
 			&Options{TracingProvider: "jaeger", TracingJaegerAgentEndpoint: "foo", TracingJaegerCollectorEndpoint: "http://foo", Services: ServiceAll},
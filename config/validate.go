@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -40,8 +41,32 @@ func GetEnvoyDNSLookupFamily(value string) envoy_config_cluster_v3.Cluster_DnsLo
 	return envoy_config_cluster_v3.Cluster_AUTO
 }
 
+// MetricsUnixSocketPrefix is the prefix of a metrics address which is the path of
+// a unix domain socket.
+const MetricsUnixSocketPrefix = "unix:"
+
+// MetricsSocketPath returns the path of the unix domain socket the metrics are
+// served on, if the metrics address is one: either unix:{path} or an absolute
+// path.
+func MetricsSocketPath(addr string) (string, bool) {
+	if strings.HasPrefix(addr, MetricsUnixSocketPrefix) {
+		return strings.TrimPrefix(addr, MetricsUnixSocketPrefix), true
+	}
+	if filepath.IsAbs(addr) {
+		return addr, true
+	}
+	return "", false
+}
+
 // ValidateMetricsAddress validates address for the metrics
 func ValidateMetricsAddress(addr string) error {
+	if path, ok := MetricsSocketPath(addr); ok {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("expected an absolute unix socket path")
+		}
+		return nil
+	}
+
 	_, port, err := net.SplitHostPort(addr)
 	if err != nil || port == "" {
 		return fmt.Errorf("expected host:port")
@@ -57,3 +82,27 @@ func ValidateMetricsAddress(addr string) error {
 
 	return nil
 }
+
+// ParseMetricsSocketMode parses the octal file mode of the metrics unix socket.
+func ParseMetricsSocketMode(mode string) (uint32, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("expected an octal file mode, such as 0660")
+	}
+	return uint32(m), nil
+}
+
+// ValidateMetricsPathPrefix validates the path prefix the metrics are served
+// under by the main HTTP server.
+func ValidateMetricsPathPrefix(prefix string) error {
+	if !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("must start with a /")
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("must not end with a /")
+	}
+	if prefix == "/.pomerium" || strings.HasPrefix(prefix, "/.pomerium/") {
+		return fmt.Errorf("must not be under /.pomerium")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package databroker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// An adminServer implements the data broker admin service interface. It doesn't
+// authenticate requests itself: it's only served with mutual TLS, so every
+// request comes from a client with a certificate signed by the admin client CA.
+type adminServer struct {
+	srv *dataBrokerServer
+}
+
+func (srv adminServer) Quiesce(ctx context.Context, req *databrokerpb.QuiesceRequest) (*databrokerpb.QuiesceResponse, error) {
+	return srv.srv.server.Quiesce(ctx, req)
+}
+
+func (srv adminServer) Unquiesce(ctx context.Context, req *databrokerpb.UnquiesceRequest) (*databrokerpb.UnquiesceResponse, error) {
+	return srv.srv.server.Unquiesce(ctx, req)
+}
+
+func (srv adminServer) DumpChangeLog(ctx context.Context, req *databrokerpb.DumpChangeLogRequest) (*databrokerpb.DumpChangeLogResponse, error) {
+	return srv.srv.server.DumpChangeLog(ctx, req)
+}
+
+func (srv adminServer) InvalidateCache(ctx context.Context, req *databrokerpb.InvalidateCacheRequest) (*databrokerpb.InvalidateCacheResponse, error) {
+	return srv.srv.server.InvalidateCache(ctx, req)
+}
+
+// newAdminGRPCServer returns the gRPC server of the admin service, which
+// requires a client certificate signed by the admin client CA. It returns nil if
+// the admin service is disabled.
+func newAdminGRPCServer(cfg *config.Config, srv *dataBrokerServer) (*grpc.Server, error) {
+	if cfg.Options.DataBrokerAdminAddress == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := getAdminTLSConfig(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("databroker: invalid admin tls config: %w", err)
+	}
+	grpcServer := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+	}, GRPCServerOptions(cfg)...)...)
+	databrokerpb.RegisterDataBrokerAdminServiceServer(grpcServer, adminServer{srv: srv})
+	return grpcServer, nil
+}
+
+// getAdminTLSConfig returns the TLS config of the admin listener. Only the admin
+// client CA is trusted to sign client certificates, not the system CAs.
+func getAdminTLSConfig(o *config.Options) (*tls.Config, error) {
+	cert, err := cryptutil.CertificateFromFile(o.DataBrokerAdminCertFile, o.DataBrokerAdminKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(o.DataBrokerAdminClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin client ca file (%s): %w", o.DataBrokerAdminClientCAFile, err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("failed to append any PEM-encoded certificates from %s", o.DataBrokerAdminClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// setAdminEnabled sets whether the admin service is enabled, in which case the
+// operational RPCs are no longer served by the data-plane service.
+func (srv *dataBrokerServer) setAdminEnabled(cfg *config.Config) {
+	var enabled int32
+	if cfg.Options.DataBrokerAdminAddress != "" {
+		enabled = 1
+	}
+	atomic.StoreInt32(&srv.adminEnabled, enabled)
+}
+
+// requireDataPlaneAdmin returns PermissionDenied if the operational RPCs are
+// served by the admin service.
+func (srv *dataBrokerServer) requireDataPlaneAdmin() error {
+	if atomic.LoadInt32(&srv.adminEnabled) != 0 {
+		return status.Error(codes.PermissionDenied, "operational RPCs are only served by the databroker admin service")
+	}
+	return nil
+}
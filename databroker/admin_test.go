@@ -0,0 +1,174 @@
+package databroker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+type testCertificateAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCertificateAuthority(t *testing.T, name string) *testCertificateAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificateAuthority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM-encoded certificate and key of a leaf certificate signed
+// by the certificate authority.
+func (ca *testCertificateAuthority) issue(t *testing.T, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestAdminService(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	dir := t.TempDir()
+	writeFile := func(name string, data []byte) string {
+		fileName := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(fileName, data, 0o600))
+		return fileName
+	}
+
+	ca := newTestCertificateAuthority(t, "Admin CA")
+	serverCert, serverKey := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	rogueCert, rogueKey := newTestCertificateAuthority(t, "Rogue CA").issue(t, x509.ExtKeyUsageClientAuth)
+
+	sharedKey := cryptutil.NewKey()
+	cfg := &config.Config{Options: config.NewDefaultOptions()}
+	cfg.Options.SharedKey = base64.StdEncoding.EncodeToString(sharedKey)
+	cfg.Options.DataBrokerAdminAddress = "127.0.0.1:0"
+	cfg.Options.DataBrokerAdminCertFile = writeFile("server.pem", serverCert)
+	cfg.Options.DataBrokerAdminKeyFile = writeFile("server-key.pem", serverKey)
+	cfg.Options.DataBrokerAdminClientCAFile = writeFile("ca.pem", ca.pem)
+
+	srv := newDataBrokerServer(cfg)
+	defer func() { _ = srv.server.Close() }()
+
+	serve := func(grpcServer *grpc.Server) string {
+		li, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() { _ = grpcServer.Serve(li) }()
+		t.Cleanup(grpcServer.Stop)
+		return li.Addr().String()
+	}
+
+	adminGRPCServer, err := newAdminGRPCServer(cfg, srv)
+	require.NoError(t, err)
+	adminAddr := serve(adminGRPCServer)
+
+	dataPlaneGRPCServer := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(dataPlaneGRPCServer, srv)
+	dataPlaneAddr := serve(dataPlaneGRPCServer)
+
+	dialAdmin := func(t *testing.T, certificates ...tls.Certificate) databroker.DataBrokerAdminServiceClient {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(ca.pem)
+		cc, err := grpc.DialContext(ctx, adminAddr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certificates,
+		})))
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = cc.Close() })
+		return databroker.NewDataBrokerAdminServiceClient(cc)
+	}
+	keyPair := func(t *testing.T, certPEM, keyPEM []byte) tls.Certificate {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		require.NoError(t, err)
+		return cert
+	}
+
+	t.Run("admin listener with a valid client certificate", func(t *testing.T) {
+		client := dialAdmin(t, keyPair(t, clientCert, clientKey))
+		_, err := client.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		assert.NoError(t, err)
+		_, err = client.Quiesce(ctx, &databroker.QuiesceRequest{})
+		assert.NoError(t, err)
+		_, err = client.Unquiesce(ctx, &databroker.UnquiesceRequest{})
+		assert.NoError(t, err)
+	})
+	t.Run("admin listener without a client certificate", func(t *testing.T) {
+		client := dialAdmin(t)
+		_, err := client.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		assert.Error(t, err)
+	})
+	t.Run("admin listener with a client certificate from another ca", func(t *testing.T) {
+		client := dialAdmin(t, keyPair(t, rogueCert, rogueKey))
+		_, err := client.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		assert.Error(t, err)
+	})
+	t.Run("data-plane listener", func(t *testing.T) {
+		cc, err := grpc.DialContext(ctx, dataPlaneAddr,
+			grpc.WithInsecure(),
+			grpc.WithUnaryInterceptor(grpcutil.WithUnarySignedJWT(sharedKey)))
+		require.NoError(t, err)
+		defer func() { _ = cc.Close() }()
+
+		_, err = databroker.NewDataBrokerServiceClient(cc).DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "the data-plane service should reject operational RPCs")
+		_, err = databroker.NewDataBrokerServiceClient(cc).Quiesce(ctx, &databroker.QuiesceRequest{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "the data-plane service should reject operational RPCs")
+		_, err = databroker.NewDataBrokerAdminServiceClient(cc).DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err), "the admin service shouldn't be served on the data-plane listener")
+		_, err = databroker.NewDataBrokerServiceClient(cc).Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: "1"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "data-plane RPCs should still be served")
+	})
+}
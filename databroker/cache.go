@@ -12,6 +12,7 @@ import (
 
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 
 	"github.com/pomerium/pomerium/config"
@@ -31,10 +32,13 @@ import (
 type DataBroker struct {
 	dataBrokerServer *dataBrokerServer
 	manager          *manager.Manager
+	routeSessions    *routeSessionCounter
 
 	localListener                net.Listener
 	localGRPCServer              *grpc.Server
 	localGRPCConnection          *grpc.ClientConn
+	adminListener                net.Listener
+	adminGRPCServer              *grpc.Server
 	dataBrokerStorageType        string // TODO remove in v0.11
 	deprecatedCacheClusterDomain string // TODO: remove in v0.11
 
@@ -57,10 +61,10 @@ func New(cfg *config.Config) (*DataBroker, error) {
 
 	// No metrics handler because we have one in the control plane.  Add one
 	// if we no longer register with that grpc Server
-	localGRPCServer := grpc.NewServer(
+	localGRPCServer := grpc.NewServer(append([]grpc.ServerOption{
 		grpc.StreamInterceptor(si),
 		grpc.UnaryInterceptor(ui),
-	)
+	}, GRPCServerOptions(cfg)...)...)
 
 	clientStatsHandler := telemetry.NewGRPCClientStatsHandler(cfg.Options.Services)
 	clientDialOptions := []grpc.DialOption{
@@ -68,6 +72,7 @@ func New(cfg *config.Config) (*DataBroker, error) {
 		grpc.WithChainUnaryInterceptor(clientStatsHandler.UnaryInterceptor, grpcutil.WithUnarySignedJWT(sharedKey)),
 		grpc.WithChainStreamInterceptor(grpcutil.WithStreamSignedJWT(sharedKey)),
 		grpc.WithStatsHandler(clientStatsHandler.Handler),
+		grpc.WithDefaultCallOptions(GRPCCallOptions(cfg)...),
 	}
 
 	localGRPCConnection, err := grpc.DialContext(
@@ -87,6 +92,7 @@ func New(cfg *config.Config) (*DataBroker, error) {
 
 	c := &DataBroker{
 		dataBrokerServer:             dataBrokerServer,
+		routeSessions:                newRouteSessionCounter(databroker.NewDataBrokerServiceClient(localGRPCConnection)),
 		localListener:                localListener,
 		localGRPCServer:              localGRPCServer,
 		localGRPCConnection:          localGRPCConnection,
@@ -95,6 +101,17 @@ func New(cfg *config.Config) (*DataBroker, error) {
 	}
 	c.Register(c.localGRPCServer)
 
+	c.adminGRPCServer, err = newAdminGRPCServer(cfg, dataBrokerServer)
+	if err != nil {
+		return nil, err
+	}
+	if c.adminGRPCServer != nil {
+		c.adminListener, err = net.Listen("tcp", cfg.Options.DataBrokerAdminAddress)
+		if err != nil {
+			return nil, fmt.Errorf("databroker: failed to listen on admin address: %w", err)
+		}
+	}
+
 	err = c.update(cfg)
 	if err != nil {
 		return nil, err
@@ -117,6 +134,7 @@ func (c *DataBroker) OnConfigChange(cfg *config.Config) {
 func (c *DataBroker) Register(grpcServer *grpc.Server) {
 	databroker.RegisterDataBrokerServiceServer(grpcServer, c.dataBrokerServer)
 	directory.RegisterDirectoryServiceServer(grpcServer, c)
+	grpc_health_v1.RegisterHealthServer(grpcServer, &healthServer{server: c.dataBrokerServer.server})
 }
 
 // Run runs the databroker components.
@@ -125,14 +143,31 @@ func (c *DataBroker) Run(ctx context.Context) error {
 	eg.Go(func() error {
 		return c.localGRPCServer.Serve(c.localListener)
 	})
+	if c.adminGRPCServer != nil {
+		eg.Go(func() error {
+			return c.adminGRPCServer.Serve(c.adminListener)
+		})
+	}
 	eg.Go(func() error {
 		<-ctx.Done()
+		// drain the server so that sync clients reconnect elsewhere and
+		// in-flight writes complete before the server stops
+		_ = c.dataBrokerServer.server.Drain(context.Background())
 		c.localGRPCServer.Stop()
+		if c.adminGRPCServer != nil {
+			c.adminGRPCServer.Stop()
+		}
+		if err := c.dataBrokerServer.server.Close(); err != nil {
+			log.Error().Err(err).Msg("databroker: error closing storage")
+		}
 		return nil
 	})
 	eg.Go(func() error {
 		return c.manager.Run(ctx)
 	})
+	eg.Go(func() error {
+		return c.routeSessions.Run(ctx)
+	})
 	return eg.Wait()
 }
 
@@ -178,6 +213,7 @@ func (c *DataBroker) update(cfg *config.Config) error {
 	} else {
 		c.manager.UpdateConfig(options...)
 	}
+	c.routeSessions.OnConfigChange(cfg)
 
 	return nil
 }
@@ -4,18 +4,24 @@ package databroker
 import (
 	"context"
 	"encoding/base64"
+	"sort"
 	"sync/atomic"
 
+	"google.golang.org/grpc"
+
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
 // A dataBrokerServer implements the data broker service interface.
 type dataBrokerServer struct {
-	server    *databroker.Server
-	sharedKey atomic.Value
+	server       *databroker.Server
+	sharedKey    atomic.Value
+	adminEnabled int32
 }
 
 // newDataBrokerServer creates a new databroker service server.
@@ -23,6 +29,7 @@ func newDataBrokerServer(cfg *config.Config) *dataBrokerServer {
 	srv := &dataBrokerServer{}
 	srv.server = databroker.New(srv.getOptions(cfg)...)
 	srv.setKey(cfg)
+	srv.setAdminEnabled(cfg)
 	return srv
 }
 
@@ -30,25 +37,112 @@ func newDataBrokerServer(cfg *config.Config) *dataBrokerServer {
 func (srv *dataBrokerServer) OnConfigChange(cfg *config.Config) {
 	srv.server.UpdateConfig(srv.getOptions(cfg)...)
 	srv.setKey(cfg)
+	srv.setAdminEnabled(cfg)
 }
 
 func (srv *dataBrokerServer) getOptions(cfg *config.Config) []databroker.ServerOption {
-	cert, _ := cfg.Options.GetDataBrokerCertificate()
-	return []databroker.ServerOption{
+	options := []databroker.ServerOption{
 		databroker.WithInstallationID(cfg.Options.InstallationID),
+		databroker.WithListenAddress(cfg.Options.GRPCAddr),
 		databroker.WithSharedKey(cfg.Options.SharedKey),
+		databroker.WithPreviousSharedKeys(cfg.Options.PreviousSharedKeys),
 		databroker.WithStorageType(cfg.Options.DataBrokerStorageType),
 		databroker.WithStorageConnectionString(cfg.Options.DataBrokerStorageConnectionString),
+		databroker.WithStorageKeyPrefix(cfg.Options.DataBrokerStorageKeyPrefix),
+		databroker.WithStorageChangeCompression(cfg.Options.DataBrokerStorageChangeCompression),
 		databroker.WithStorageCAFile(cfg.Options.DataBrokerStorageCAFile),
-		databroker.WithStorageCertificate(cert),
+		databroker.WithStorageCertificateFiles(cfg.Options.DataBrokerStorageCertFile, cfg.Options.DataBrokerStorageCertKeyFile),
 		databroker.WithStorageCertSkipVerify(cfg.Options.DataBrokerStorageCertSkipVerify),
+		databroker.WithStorageCredentialsFile(cfg.Options.DataBrokerStorageCredentialsFile),
+		databroker.WithStoragePoolSize(cfg.Options.DataBrokerStoragePoolSize),
+		databroker.WithStorageMinIdleConns(cfg.Options.DataBrokerStorageMinIdleConns),
+		databroker.WithConfigInfoMetric(cfg.Options.MetricsDataBrokerConfigInfo),
+		databroker.WithMinProtocolVersion(cfg.Options.DataBrokerMinProtocolVersion),
+	}
+	if ca, err := cfg.Options.GetDataBrokerStorageCA(); err != nil {
+		log.Error().Err(err).Msg("databroker: invalid storage certificate authority, ignoring it")
+	} else if ca != nil {
+		options = append(options, databroker.WithStorageCAPEM(ca))
+	}
+	if cfg.Options.DataBrokerStorageCertReloadInterval > 0 {
+		options = append(options,
+			databroker.WithStorageCertificateReloadInterval(cfg.Options.DataBrokerStorageCertReloadInterval))
+	}
+	options = append(options, getDeleteModeOptions(cfg)...)
+	options = append(options, getKafkaOptions(cfg)...)
+	return append(options, getMessageSizeOptions(cfg)...)
+}
+
+// getKafkaOptions returns the options of the Kafka sink of the record changes, if
+// Kafka brokers are configured.
+func getKafkaOptions(cfg *config.Config) []databroker.ServerOption {
+	if len(cfg.Options.DataBrokerKafkaBrokers) == 0 {
+		return nil
+	}
+
+	serialization := databroker.ChangeSerializationJSON
+	if cfg.Options.DataBrokerKafkaSerialization != "" {
+		var err error
+		serialization, err = databroker.ParseChangeSerialization(cfg.Options.DataBrokerKafkaSerialization)
+		if err != nil {
+			log.Error().Err(err).Msg("databroker: invalid kafka serialization, not publishing record changes")
+			return nil
+		}
+	}
+	return []databroker.ServerOption{
+		databroker.WithKafkaSink(nil, databroker.KafkaSink{
+			Brokers:        cfg.Options.DataBrokerKafkaBrokers,
+			TLS:            cfg.Options.DataBrokerKafkaTLS,
+			Topic:          cfg.Options.DataBrokerKafkaTopic,
+			Serialization:  serialization,
+			IncludePayload: cfg.Options.DataBrokerKafkaIncludePayload,
+		}),
+	}
+}
+
+// getDeleteModeOptions returns the options of the record types which are deleted
+// immediately. They're sorted, so that reloading the same config doesn't change
+// the options.
+func getDeleteModeOptions(cfg *config.Config) []databroker.ServerOption {
+	var recordTypes []string
+	for _, deleteMode := range cfg.Options.DataBrokerDeleteModes {
+		if deleteMode.Mode == config.DeleteModeImmediate {
+			recordTypes = append(recordTypes, deleteMode.Type)
+		}
+	}
+	sort.Strings(recordTypes)
+
+	options := make([]databroker.ServerOption, 0, len(recordTypes))
+	for _, recordType := range recordTypes {
+		options = append(options, databroker.WithImmediateDelete(recordType))
+	}
+	return options
+}
+
+// GRPCServerOptions returns the options for a gRPC server serving the databroker.
+func GRPCServerOptions(cfg *config.Config) []grpc.ServerOption {
+	return databroker.GRPCServerOptions(getMessageSizeOptions(cfg)...)
+}
+
+// GRPCCallOptions returns the options for gRPC clients of the databroker.
+func GRPCCallOptions(cfg *config.Config) []grpc.CallOption {
+	return databroker.GRPCCallOptions(getMessageSizeOptions(cfg)...)
+}
+
+func getMessageSizeOptions(cfg *config.Config) []databroker.ServerOption {
+	return []databroker.ServerOption{
+		databroker.WithMaxRecvMsgSize(cfg.Options.GRPCServerMaxRecvMsgSize),
+		databroker.WithMaxSendMsgSize(cfg.Options.GRPCServerMaxSendMsgSize),
 	}
 }
 
 func (srv *dataBrokerServer) setKey(cfg *config.Config) {
-	bs, _ := base64.StdEncoding.DecodeString(cfg.Options.SharedKey)
-	if bs == nil {
-		bs = make([]byte, 0)
+	bs, err := base64.StdEncoding.DecodeString(cfg.Options.SharedKey)
+	if err != nil || len(bs) != cryptutil.DefaultKeySize {
+		// an empty key disables JWT verification, so fail closed by using a key
+		// no client can know
+		log.Error().Err(err).Msg("databroker: invalid shared secret, rejecting all requests")
+		bs = cryptutil.NewKey()
 	}
 	srv.sharedKey.Store(bs)
 }
@@ -74,6 +168,27 @@ func (srv *dataBrokerServer) Put(ctx context.Context, req *databrokerpb.PutReque
 	return srv.server.Put(ctx, req)
 }
 
+func (srv *dataBrokerServer) Patch(ctx context.Context, req *databrokerpb.PatchRequest) (*databrokerpb.PatchResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	return srv.server.Patch(ctx, req)
+}
+
+func (srv *dataBrokerServer) Undelete(ctx context.Context, req *databrokerpb.UndeleteRequest) (*databrokerpb.UndeleteResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	return srv.server.Undelete(ctx, req)
+}
+
+func (srv *dataBrokerServer) ReplaceAll(ctx context.Context, req *databrokerpb.ReplaceAllRequest) (*databrokerpb.ReplaceAllResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	return srv.server.ReplaceAll(ctx, req)
+}
+
 func (srv *dataBrokerServer) Sync(req *databrokerpb.SyncRequest, stream databrokerpb.DataBrokerService_SyncServer) error {
 	if err := grpcutil.RequireSignedJWT(stream.Context(), srv.sharedKey.Load().([]byte)); err != nil {
 		return err
@@ -87,3 +202,57 @@ func (srv *dataBrokerServer) SyncLatest(req *databrokerpb.SyncLatestRequest, str
 	}
 	return srv.server.SyncLatest(req, stream)
 }
+
+func (srv *dataBrokerServer) Quiesce(ctx context.Context, req *databrokerpb.QuiesceRequest) (*databrokerpb.QuiesceResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	if err := srv.requireDataPlaneAdmin(); err != nil {
+		return nil, err
+	}
+	return srv.server.Quiesce(ctx, req)
+}
+
+func (srv *dataBrokerServer) Unquiesce(ctx context.Context, req *databrokerpb.UnquiesceRequest) (*databrokerpb.UnquiesceResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	if err := srv.requireDataPlaneAdmin(); err != nil {
+		return nil, err
+	}
+	return srv.server.Unquiesce(ctx, req)
+}
+
+func (srv *dataBrokerServer) DumpChangeLog(ctx context.Context, req *databrokerpb.DumpChangeLogRequest) (*databrokerpb.DumpChangeLogResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	if err := srv.requireDataPlaneAdmin(); err != nil {
+		return nil, err
+	}
+	return srv.server.DumpChangeLog(ctx, req)
+}
+
+func (srv *dataBrokerServer) InvalidateCache(ctx context.Context, req *databrokerpb.InvalidateCacheRequest) (*databrokerpb.InvalidateCacheResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	if err := srv.requireDataPlaneAdmin(); err != nil {
+		return nil, err
+	}
+	return srv.server.InvalidateCache(ctx, req)
+}
+
+func (srv *dataBrokerServer) PauseSync(ctx context.Context, req *databrokerpb.PauseSyncRequest) (*databrokerpb.PauseSyncResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	return srv.server.PauseSync(ctx, req)
+}
+
+func (srv *dataBrokerServer) ResumeSync(ctx context.Context, req *databrokerpb.ResumeSyncRequest) (*databrokerpb.ResumeSyncResponse, error) {
+	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+		return nil, err
+	}
+	return srv.server.ResumeSync(ctx, req)
+}
@@ -2,22 +2,29 @@ package databroker
 
 import (
 	"context"
+	"io/ioutil"
 	"net"
+	"path/filepath"
 	"strconv"
 	"testing"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/pomerium/pomerium/config"
 	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
 const bufSize = 1024 * 1024
@@ -130,3 +137,97 @@ func BenchmarkSync(b *testing.B) {
 		}
 	}
 }
+
+func TestServerInvalidSharedKey(t *testing.T) {
+	srv := &dataBrokerServer{server: internal_databroker.New()}
+	srv.setKey(&config.Config{Options: &config.Options{SharedKey: "NOT A VALID KEY"}})
+
+	key := srv.sharedKey.Load().([]byte)
+	require.NotEmpty(t, key, "an invalid shared key should not disable JWT verification")
+
+	err := grpcutil.RequireSignedJWT(context.Background(), key)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServerPreviousSharedKeys(t *testing.T) {
+	ctx := context.Background()
+	previousKey := cryptutil.NewBase64Key()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+services: databroker
+insecure_server: true
+shared_secret: `+cryptutil.NewBase64Key()+`
+previous_shared_secrets:
+  - `+previousKey+`
+`), 0o600))
+	src, err := config.NewFileOrEnvironmentSource(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{previousKey}, src.GetConfig().Options.PreviousSharedKeys)
+
+	srv := newDataBrokerServer(src.GetConfig())
+	defer func() { _ = srv.server.Close() }()
+
+	any, _ := ptypes.MarshalAny(new(user.User))
+	_, err = srv.server.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1", Data: any},
+	})
+	require.NoError(t, err)
+	_, err = srv.server.Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: "1"})
+	assert.NoError(t, err, "records should be written with the shared key")
+}
+
+func TestServerDeleteModes(t *testing.T) {
+	ctx := context.Background()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+services: databroker
+insecure_server: true
+shared_secret: `+cryptutil.NewBase64Key()+`
+databroker_delete_modes:
+  - type: IMMEDIATE
+    mode: immediate
+  - type: SOFT
+    mode: soft
+`), 0o600))
+	src, err := config.NewFileOrEnvironmentSource(configFile)
+	require.NoError(t, err)
+
+	srv := newDataBrokerServer(src.GetConfig())
+	defer func() { _ = srv.server.Close() }()
+
+	any, _ := ptypes.MarshalAny(new(user.User))
+	for _, recordType := range []string{"IMMEDIATE", "SOFT"} {
+		_, err := srv.server.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: recordType, Id: "1", Data: any},
+		})
+		require.NoError(t, err)
+		_, err = srv.server.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: recordType, Id: "1", DeletedAt: timestamppb.Now()},
+		})
+		require.NoError(t, err)
+	}
+
+	// changes returns the number of changes of the type which hold the data of
+	// the record, and whether the latest one is a deletion
+	changes := func(recordType string) (withData int, deleted bool) {
+		res, err := srv.server.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{Type: recordType, IncludeData: true})
+		require.NoError(t, err)
+		for _, record := range res.GetRecords() {
+			if record.GetData() != nil {
+				withData++
+			}
+			deleted = record.GetDeletedAt() != nil
+		}
+		return withData, deleted
+	}
+
+	withData, deleted := changes("IMMEDIATE")
+	assert.Equal(t, 0, withData, "the data of immediately deleted records should be removed")
+	assert.True(t, deleted, "the deletion should be synced")
+
+	withData, deleted = changes("SOFT")
+	assert.Equal(t, 1, withData, "soft-deleted records should remain in the change log")
+	assert.True(t, deleted, "the deletion should be synced")
+}
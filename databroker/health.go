@@ -0,0 +1,50 @@
+package databroker
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// healthCheckTimeout bounds the storage probe of a health check, so that a
+// readiness probe without a deadline doesn't hang on a dead storage connection.
+const healthCheckTimeout = 5 * time.Second
+
+// dataBrokerServiceName is the name of the databroker gRPC service, which health
+// checks may be made for.
+const dataBrokerServiceName = "databroker.DataBrokerService"
+
+// A healthServer implements the gRPC health checking protocol for the databroker,
+// reporting it as serving while its storage can be reached. Health checks don't
+// require a signed JWT, so that they can be used by readiness probes.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	server *databroker.Server
+}
+
+func (srv *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	switch req.GetService() {
+	case "", dataBrokerServiceName:
+	default:
+		return nil, status.Errorf(codes.NotFound, "unknown service: %s", req.GetService())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	if err := srv.server.Check(ctx); err != nil {
+		log.Warn().Err(err).Msg("databroker: health check failed")
+		return &grpc_health_v1.HealthCheckResponse{
+			Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		}, nil
+	}
+	return &grpc_health_v1.HealthCheckResponse{
+		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+	}, nil
+}
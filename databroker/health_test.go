@@ -0,0 +1,30 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+)
+
+func TestHealthServer(t *testing.T) {
+	ctx := context.Background()
+	srv := &healthServer{server: internal_databroker.New()}
+
+	res, err := srv.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.GetStatus())
+
+	res, err = srv.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: dataBrokerServiceName})
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.GetStatus())
+
+	_, err = srv.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
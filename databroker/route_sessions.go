@@ -0,0 +1,131 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// routeSessionCountInterval is the interval at which route session counts are
+// recomputed.
+const routeSessionCountInterval = time.Minute
+
+// A routeSessionRoute is a route for which sessions are counted.
+type routeSessionRoute struct {
+	id    string
+	from  string
+	hosts []string
+}
+
+// A routeSessionCounter periodically counts the session records associated with
+// each configured route. A session is associated with a route if the route's host
+// is one of the session's audiences.
+type routeSessionCounter struct {
+	client databroker.DataBrokerServiceClient
+
+	mu      sync.Mutex
+	enabled bool
+	routes  []routeSessionRoute
+}
+
+func newRouteSessionCounter(client databroker.DataBrokerServiceClient) *routeSessionCounter {
+	return &routeSessionCounter{client: client}
+}
+
+// OnConfigChange updates the counted routes.
+func (c *routeSessionCounter) OnConfigChange(cfg *config.Config) {
+	var routes []routeSessionRoute
+	for _, p := range cfg.Options.GetAllPolicies() {
+		id, err := p.RouteID()
+		if err != nil || p.Source == nil {
+			continue
+		}
+		hosts := []string{p.Source.Host}
+		if hostname := p.Source.Hostname(); hostname != p.Source.Host {
+			hosts = append(hosts, hostname)
+		}
+		routes = append(routes, routeSessionRoute{
+			id:    fmt.Sprint(id),
+			from:  p.From,
+			hosts: hosts,
+		})
+	}
+
+	c.mu.Lock()
+	c.enabled = cfg.Options.MetricsRouteSessionCounts
+	c.routes = routes
+	c.mu.Unlock()
+}
+
+// Run counts sessions every routeSessionCountInterval until the context is done.
+func (c *routeSessionCounter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(routeSessionCountInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.count(ctx); err != nil {
+			log.Warn().Err(err).Msg("databroker: failed to count route sessions")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *routeSessionCounter) count(ctx context.Context) error {
+	c.mu.Lock()
+	enabled, routes := c.enabled, c.routes
+	c.mu.Unlock()
+
+	if !enabled || len(routes) == 0 {
+		metrics.SetDataBrokerRouteSessions(nil)
+		return nil
+	}
+
+	records, _, _, err := databroker.InitialSync(ctx, c.client, &databroker.SyncLatestRequest{
+		Type: grpcutil.GetTypeURL(new(session.Session)),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	counts := make([]metrics.RouteSessionCount, len(routes))
+	for i, route := range routes {
+		counts[i] = metrics.RouteSessionCount{RouteID: route.id, From: route.from}
+	}
+	for _, record := range records {
+		var s session.Session
+		if err := record.GetData().UnmarshalTo(&s); err != nil {
+			continue
+		}
+		if s.GetExpiresAt() != nil && s.GetExpiresAt().AsTime().Before(now) {
+			continue
+		}
+		audiences := make(map[string]struct{}, len(s.GetAudience()))
+		for _, audience := range s.GetAudience() {
+			audiences[audience] = struct{}{}
+		}
+		for i, route := range routes {
+			for _, host := range route.hosts {
+				if _, ok := audiences[host]; ok {
+					counts[i].Count++
+					break
+				}
+			}
+		}
+	}
+	metrics.SetDataBrokerRouteSessions(counts)
+	return nil
+}
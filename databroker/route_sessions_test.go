@@ -0,0 +1,106 @@
+package databroker
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricproducer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+func TestRouteSessionCounter(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	li := bufconn.Listen(bufSize)
+	s := grpc.NewServer()
+	srv := &dataBrokerServer{server: internal_databroker.New()}
+	srv.sharedKey.Store([]byte{})
+	databroker.RegisterDataBrokerServiceServer(s, srv)
+	go func() { _ = s.Serve(li) }()
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return li.Dial()
+	}), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := databroker.NewDataBrokerServiceClient(conn)
+
+	putSession := func(id string, expiresAt time.Time, audience ...string) {
+		data, err := anypb.New(&session.Session{
+			Id:        id,
+			ExpiresAt: timestamppb.New(expiresAt),
+			Audience:  audience,
+		})
+		require.NoError(t, err)
+		_, err = client.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: data.GetTypeUrl(), Id: id, Data: data},
+		})
+		require.NoError(t, err)
+	}
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	putSession("1", future, "authenticate.example.com", "a.example.com")
+	putSession("2", future, "authenticate.example.com", "a.example.com", "b.example.com:8443")
+	putSession("3", future, "authenticate.example.com", "c.example.com")
+	putSession("4", past, "authenticate.example.com", "a.example.com")
+
+	var policies []config.Policy
+	for _, from := range []string{"https://a.example.com", "https://b.example.com:8443", "https://d.example.com"} {
+		to, err := config.ParseWeightedUrls("https://to.example.com")
+		require.NoError(t, err)
+		p := config.Policy{From: from, To: to}
+		require.NoError(t, p.Validate())
+		policies = append(policies, p)
+	}
+
+	getCounts := func() map[string]int64 {
+		counts := map[string]int64{}
+		for _, producer := range metricproducer.GlobalManager().GetAll() {
+			for _, m := range producer.Read() {
+				if m.Descriptor.Name != metrics.DataBrokerRouteSessions {
+					continue
+				}
+				for _, ts := range m.TimeSeries {
+					for i, key := range m.Descriptor.LabelKeys {
+						if key.Key == metrics.FromLabel {
+							counts[ts.LabelValues[i].Value] = ts.Points[0].Value.(int64)
+						}
+					}
+				}
+			}
+		}
+		return counts
+	}
+
+	counter := newRouteSessionCounter(client)
+	counter.OnConfigChange(&config.Config{Options: &config.Options{
+		Policies:                  policies,
+		MetricsRouteSessionCounts: true,
+	}})
+	require.NoError(t, counter.count(ctx))
+	assert.Equal(t, map[string]int64{
+		"https://a.example.com":      2,
+		"https://b.example.com:8443": 1,
+		"https://d.example.com":      0,
+	}, getCounts(), "should only count unexpired sessions of configured routes")
+
+	t.Run("disabled", func(t *testing.T) {
+		counter.OnConfigChange(&config.Config{Options: &config.Options{Policies: policies}})
+		require.NoError(t, counter.count(ctx))
+		assert.Empty(t, getCounts())
+	})
+}
@@ -62,7 +62,8 @@ func Run(ctx context.Context, configFile string) error {
 	defer traceMgr.Close()
 
 	// setup the control plane
-	controlPlane, err := controlplane.NewServer(src.GetConfig().Options.Services, metricsMgr)
+	controlPlane, err := controlplane.NewServer(src.GetConfig().Options.Services, metricsMgr,
+		databroker_service.GRPCServerOptions(src.GetConfig())...)
 	if err != nil {
 		return fmt.Errorf("error creating control plane: %w", err)
 	}
@@ -120,6 +121,7 @@ func Run(ctx context.Context, configFile string) error {
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
+	go writeMetricsSnapshots(ctx, src, metricsMgr)
 	go func(ctx context.Context) {
 		ch := make(chan os.Signal, 2)
 		defer signal.Stop(ch)
@@ -240,3 +242,31 @@ func setupProxy(src config.Source, controlPlane *controlplane.Server) error {
 
 	return nil
 }
+
+// writeMetricsSnapshots writes a snapshot of the metrics to the configured
+// metrics snapshot file each time SIGUSR1 is received.
+func writeMetricsSnapshots(ctx context.Context, src config.Source, metricsMgr *config.MetricsManager) {
+	ch := make(chan os.Signal, 1)
+	defer signal.Stop(ch)
+
+	signal.Notify(ch, syscall.SIGUSR1)
+
+	for {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return
+		}
+
+		path := src.GetConfig().Options.MetricsSnapshotFile
+		if path == "" {
+			log.Warn().Msg("metrics: received SIGUSR1, but no metrics snapshot file is configured")
+			continue
+		}
+		if err := metricsMgr.WriteSnapshotFile(ctx, path); err != nil {
+			log.Error().Err(err).Msg("metrics: failed to write snapshot")
+			continue
+		}
+		log.Info().Str("file", path).Msg("metrics: wrote snapshot")
+	}
+}
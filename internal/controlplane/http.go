@@ -51,4 +51,5 @@ func (srv *Server) addHTTPMiddleware() {
 
 	// metrics
 	root.Handle("/metrics", srv.metricsMgr)
+	srv.metricsMgr.Mount(root)
 }
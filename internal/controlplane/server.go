@@ -11,6 +11,7 @@ import (
 	"github.com/gorilla/mux"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 
@@ -24,6 +25,18 @@ import (
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
+const (
+	// grpcKeepaliveTime is how long a connection may be idle before the server
+	// pings the client to check that it is still alive.
+	grpcKeepaliveTime = time.Minute
+	// grpcKeepaliveTimeout is how long the server waits for a ping ack before
+	// closing the connection.
+	grpcKeepaliveTimeout = time.Second * 20
+	// grpcKeepaliveMinTime is the most frequently clients may send keepalive
+	// pings. Clients pinging more often are disconnected.
+	grpcKeepaliveMinTime = time.Second * 10
+)
+
 type versionedConfig struct {
 	*config.Config
 	version int64
@@ -55,8 +68,9 @@ type Server struct {
 	metricsMgr    *config.MetricsManager
 }
 
-// NewServer creates a new Server. Listener ports are chosen by the OS.
-func NewServer(name string, metricsMgr *config.MetricsManager) (*Server, error) {
+// NewServer creates a new Server. Listener ports are chosen by the OS. Any
+// additional gRPC server options are applied to the gRPC server.
+func NewServer(name string, metricsMgr *config.MetricsManager, grpcOptions ...grpc.ServerOption) (*Server, error) {
 	srv := &Server{
 		metricsMgr: metricsMgr,
 	}
@@ -74,11 +88,19 @@ func NewServer(name string, metricsMgr *config.MetricsManager) (*Server, error)
 	ui, si := grpcutil.AttachMetadataInterceptors(
 		metadata.Pairs(grpcutil.MetadataKeyPomeriumVersion, version.FullVersion()),
 	)
-	srv.GRPCServer = grpc.NewServer(
+	srv.GRPCServer = grpc.NewServer(append([]grpc.ServerOption{
 		grpc.StatsHandler(telemetry.NewGRPCServerStatsHandler(name)),
 		grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor(), ui),
 		grpc.ChainStreamInterceptor(requestid.StreamServerInterceptor(), si),
-	)
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    grpcKeepaliveTime,
+			Timeout: grpcKeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             grpcKeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+	}, grpcOptions...)...)
 	reflection.Register(srv.GRPCServer)
 	srv.registerAccessLogHandlers()
 
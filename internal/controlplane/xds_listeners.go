@@ -1,6 +1,7 @@
 package controlplane
 
 import (
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"net"
@@ -20,6 +21,7 @@ import (
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -192,6 +194,8 @@ func (srv *Server) buildMetricsListener(cfg *config.Config) (*envoy_config_liste
 			},
 		}
 
+		// a client certificate is verified during the handshake, before metrics_basic_auth
+		// is checked by the metrics handler, so both can be required
 		if cfg.Options.MetricsClientCA != "" {
 			bs, err := base64.StdEncoding.DecodeString(cfg.Options.MetricsClientCA)
 			if err != nil {
@@ -224,6 +228,10 @@ func (srv *Server) buildMetricsListener(cfg *config.Config) (*envoy_config_liste
 		}
 	}
 
+	if path, ok := config.MetricsSocketPath(cfg.Options.MetricsAddr); ok {
+		return buildMetricsSocketListener(cfg, path, filterChain)
+	}
+
 	// we ignore the host part of the address, only binding to
 	host, port, err := net.SplitHostPort(cfg.Options.MetricsAddr)
 	if err != nil {
@@ -245,6 +253,29 @@ func (srv *Server) buildMetricsListener(cfg *config.Config) (*envoy_config_liste
 	return li, nil
 }
 
+// buildMetricsSocketListener builds the metrics listener on a unix domain socket,
+// so that the metrics aren't exposed on any network interface. Envoy unlinks a
+// stale socket file before binding.
+func buildMetricsSocketListener(cfg *config.Config, path string, filterChain *envoy_config_listener_v3.FilterChain) (*envoy_config_listener_v3.Listener, error) {
+	pipe := &envoy_config_core_v3.Pipe{Path: path}
+	if cfg.Options.MetricsSocketMode != "" {
+		mode, err := config.ParseMetricsSocketMode(cfg.Options.MetricsSocketMode)
+		if err != nil {
+			return nil, fmt.Errorf("metrics_socket_mode %s: %w", cfg.Options.MetricsSocketMode, err)
+		}
+		pipe.Mode = mode
+	}
+
+	li := &envoy_config_listener_v3.Listener{
+		Name: "metrics-ingress",
+		Address: &envoy_config_core_v3.Address{
+			Address: &envoy_config_core_v3.Address_Pipe{Pipe: pipe},
+		},
+		FilterChains: []*envoy_config_listener_v3.FilterChain{filterChain},
+	}
+	return li, nil
+}
+
 func (srv *Server) buildFilterChains(
 	options *config.Options, addr string,
 	callback func(tlsDomain string, httpDomains []string) (*envoy_config_listener_v3.FilterChain, error),
@@ -553,6 +584,7 @@ func (srv *Server) buildGRPCListener(cfg *config.Config) (*envoy_config_listener
 			}
 			tlsContext := srv.buildDownstreamTLSContext(cfg, tlsDomain)
 			if tlsContext != nil {
+				tlsContext.CommonTlsContext.TlsParams = buildGRPCTLSParams(cfg.Options)
 				tlsConfig := marshalAny(tlsContext)
 				filterChain.TransportSocket = &envoy_config_core_v3.TransportSocket{
 					Name: "tls",
@@ -582,6 +614,19 @@ func (srv *Server) buildGRPCListener(cfg *config.Config) (*envoy_config_listener
 	return li, nil
 }
 
+// buildGRPCTLSParams returns the TLS parameters of the gRPC listener, which use
+// the grpc_tls_min_version and grpc_tls_cipher_suites options if set.
+func buildGRPCTLSParams(options *config.Options) *envoy_extensions_transport_sockets_tls_v3.TlsParameters {
+	params := proto.Clone(tlsParams).(*envoy_extensions_transport_sockets_tls_v3.TlsParameters)
+	if options.GetGRPCTLSMinVersion() == tls.VersionTLS13 {
+		params.TlsMinimumProtocolVersion = envoy_extensions_transport_sockets_tls_v3.TlsParameters_TLSv1_3
+	}
+	if len(options.GetGRPCTLSCipherSuites()) > 0 {
+		params.CipherSuites = options.GRPCTLSCipherSuites
+	}
+	return params
+}
+
 func (srv *Server) buildGRPCHTTPConnectionManagerFilter() (*envoy_config_listener_v3.Filter, error) {
 	rc, err := srv.buildRouteConfiguration("grpc", []*envoy_config_route_v3.VirtualHost{{
 		Name:    "grpc",
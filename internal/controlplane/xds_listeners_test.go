@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -105,6 +106,25 @@ func Test_buildMetricsHTTPConnectionManagerFilter(t *testing.T) {
 }`, li)
 }
 
+func Test_buildMetricsSocketListener(t *testing.T) {
+	srv, _ := NewServer("TEST", nil)
+	for _, addr := range []string{"unix:/run/pomerium/metrics.sock", "/run/pomerium/metrics.sock"} {
+		li, err := srv.buildMetricsListener(&config.Config{
+			Options: &config.Options{
+				MetricsAddr:       addr,
+				MetricsSocketMode: "0660",
+			},
+		})
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `{
+			"pipe": {
+				"path": "/run/pomerium/metrics.sock",
+				"mode": 432
+			}
+		}`, li.GetAddress())
+	}
+}
+
 func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 	srv, _ := NewServer("TEST", nil)
 
@@ -661,6 +681,20 @@ func Test_hostMatchesDomain(t *testing.T) {
 	assert.False(t, hostMatchesDomain(mustParseURL(t, "http://example.com:81"), "example.com:80"))
 }
 
+func Test_buildGRPCTLSParams(t *testing.T) {
+	params := buildGRPCTLSParams(&config.Options{})
+	assert.Equal(t, tlsParams.GetCipherSuites(), params.GetCipherSuites())
+	assert.Equal(t, envoy_extensions_transport_sockets_tls_v3.TlsParameters_TLSv1_2, params.GetTlsMinimumProtocolVersion())
+
+	params = buildGRPCTLSParams(&config.Options{
+		GRPCTLSMinVersion:   "1.3",
+		GRPCTLSCipherSuites: []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+	})
+	assert.Equal(t, []string{"ECDHE-RSA-AES128-GCM-SHA256"}, params.GetCipherSuites())
+	assert.Equal(t, envoy_extensions_transport_sockets_tls_v3.TlsParameters_TLSv1_3, params.GetTlsMinimumProtocolVersion())
+	assert.Len(t, tlsParams.GetCipherSuites(), 6, "the shared tls parameters should not be modified")
+}
+
 func Test_buildRouteConfiguration(t *testing.T) {
 	srv := &Server{filemgr: filemgr.NewManager()}
 	virtualHosts := make([]*envoy_config_route_v3.VirtualHost, 10)
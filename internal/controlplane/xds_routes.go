@@ -96,6 +96,19 @@ func (srv *Server) buildPomeriumHTTPRoutes(options *config.Options, domain strin
 			return nil, err
 		}
 		routes = append(routes, r)
+		// metrics served by the main HTTP server
+		if options.MetricsPathPrefix != "" {
+			r, err = srv.buildControlPlanePathRoute(options.MetricsPathPrefix, false)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, r)
+			r, err = srv.buildControlPlanePrefixRoute(options.MetricsPathPrefix+"/", false)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, r)
+		}
 		// per #837, only add robots.txt if there are no unauthenticated routes
 		if !hasPublicPolicyMatchingURL(options, url.URL{Scheme: "https", Host: domain, Path: "/robots.txt"}) {
 			r, err := srv.buildControlPlanePathRoute("/robots.txt", false)
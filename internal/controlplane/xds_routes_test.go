@@ -163,6 +163,34 @@ func Test_buildPomeriumHTTPRoutes(t *testing.T) {
 			`+routeString("prefix", "/.well-known/pomerium/", false)+`
 		]`, routes)
 	})
+
+	t.Run("with metrics path prefix", func(t *testing.T) {
+		options := &config.Options{
+			Services:              "proxy",
+			AuthenticateURLString: "https://authenticate.example.com",
+			MetricsPathPrefix:     "/internal/metrics",
+			Policies: []config.Policy{{
+				From:                             "https://from.example.com",
+				To:                               mustParseWeightedURLs(t, "https://to.example.com"),
+				AllowPublicUnauthenticatedAccess: true,
+			}},
+		}
+		_ = options.Policies[0].Validate()
+		routes, err := srv.buildPomeriumHTTPRoutes(options, "from.example.com")
+		require.NoError(t, err)
+
+		testutil.AssertProtoJSONEqual(t, `[
+			`+routeString("path", "/.pomerium/jwt", true)+`,
+			`+routeString("path", "/ping", false)+`,
+			`+routeString("path", "/healthz", false)+`,
+			`+routeString("path", "/.pomerium", false)+`,
+			`+routeString("prefix", "/.pomerium/", false)+`,
+			`+routeString("path", "/.well-known/pomerium", false)+`,
+			`+routeString("prefix", "/.well-known/pomerium/", false)+`,
+			`+routeString("path", "/internal/metrics", false)+`,
+			`+routeString("prefix", "/internal/metrics/", false)+`
+		]`, routes)
+	})
 }
 
 func Test_buildControlPlanePathRoute(t *testing.T) {
@@ -0,0 +1,83 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// An operationLimiter bounds the number of concurrent requests which are part of
+// the same logical sync operation. Excess requests are queued.
+type operationLimiter struct {
+	mu         sync.Mutex
+	operations map[string]*operationSemaphore
+	queued     int64
+}
+
+type operationSemaphore struct {
+	slots chan struct{}
+	refs  int
+}
+
+// acquire waits for a slot for the sync operation the request is tagged with, if
+// any. The returned function must be called to release the slot.
+func (l *operationLimiter) acquire(ctx context.Context, cfg *serverConfig) (release func(), err error) {
+	operation, ok := grpcutil.SyncOperationFromGRPCRequest(ctx)
+	limit := cfg.syncConcurrency
+	if !ok || limit <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	if l.operations == nil {
+		l.operations = make(map[string]*operationSemaphore)
+	}
+	sem, ok := l.operations[operation]
+	if !ok {
+		sem = &operationSemaphore{slots: make(chan struct{}, limit)}
+		l.operations[operation] = sem
+	}
+	sem.refs++
+	l.mu.Unlock()
+
+	done := func() {
+		l.mu.Lock()
+		sem.refs--
+		if sem.refs == 0 {
+			delete(l.operations, operation)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case sem.slots <- struct{}{}:
+	default:
+		// all the slots are in use, so queue the request
+		l.addQueued(ctx, cfg, 1)
+		select {
+		case sem.slots <- struct{}{}:
+			l.addQueued(ctx, cfg, -1)
+		case <-ctx.Done():
+			l.addQueued(ctx, cfg, -1)
+			done()
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		<-sem.slots
+		done()
+	}, nil
+}
+
+func (l *operationLimiter) addQueued(ctx context.Context, cfg *serverConfig, delta int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queued += delta
+	if cfg.queueDepthMetrics {
+		metrics.SetDataBrokerQueueDepth(ctx, "sync_operation", l.queued)
+	}
+}
@@ -0,0 +1,61 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+func TestOperationLimiter_QueueDepth(t *testing.T) {
+	view.Unregister(metrics.DataBrokerViews...)
+	require.NoError(t, view.Register(metrics.DataBrokerViews...))
+	defer view.Unregister(metrics.DataBrokerViews...)
+
+	getQueueDepth := func() int64 {
+		rows, err := view.RetrieveData(metrics.DataBrokerQueueDepthView.Name)
+		require.NoError(t, err)
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == metrics.TagKeyQueue && tag.Value == "sync_operation" {
+					return int64(row.Data.(*view.LastValueData).Value)
+				}
+			}
+		}
+		return 0
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		grpcutil.SyncOperationMetadataKey, "directory-sync",
+	))
+	cfg := newServerConfig(WithSyncConcurrency(1), WithQueueDepthMetrics(true))
+
+	var limiter operationLimiter
+	release, err := limiter.acquire(ctx, cfg)
+	require.NoError(t, err)
+
+	acquired := make(chan func(), 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			release, err := limiter.acquire(ctx, cfg)
+			if assert.NoError(t, err) {
+				acquired <- release
+			}
+		}()
+	}
+	assert.Eventually(t, func() bool { return getQueueDepth() == 3 }, time.Second*5, time.Millisecond*10)
+
+	release()
+	(<-acquired)()
+	assert.Eventually(t, func() bool { return getQueueDepth() == 1 }, time.Second*5, time.Millisecond*10)
+	(<-acquired)()
+	(<-acquired)()
+	assert.Eventually(t, func() bool { return getQueueDepth() == 0 }, time.Second*5, time.Millisecond*10)
+}
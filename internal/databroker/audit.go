@@ -0,0 +1,235 @@
+package databroker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// DefaultAuditBufferSize is the default maximum number of audit events buffered
+// for the audit sink.
+const DefaultAuditBufferSize = 1000
+
+// An AuditSink writes the audit log of the writes to the databroker, such as to a
+// file, a webhook or Kafka.
+type AuditSink interface {
+	// WriteAuditEvent writes the JSON audit event. It returns once the event is
+	// written.
+	WriteAuditEvent(ctx context.Context, event []byte) error
+}
+
+// An AuditBackpressurePolicy determines what happens to writes while the audit
+// sink is slow or unavailable.
+type AuditBackpressurePolicy int
+
+const (
+	// AuditBackpressureDrop buffers the audit events, up to the audit buffer
+	// size, and drops them while the buffer is full, so that writes never wait
+	// for the audit sink. Dropped events are counted.
+	AuditBackpressureDrop AuditBackpressurePolicy = iota
+	// AuditBackpressureBuffer buffers the audit events, up to the audit buffer
+	// size, and makes writes wait for room while the buffer is full.
+	AuditBackpressureBuffer
+	// AuditBackpressureBlock makes every write wait until the audit sink has
+	// written its event, and returns an error if it can't, for strict auditing.
+	// The write is stored by then.
+	AuditBackpressureBlock
+)
+
+// String returns the name of the policy.
+func (policy AuditBackpressurePolicy) String() string {
+	switch policy {
+	case AuditBackpressureDrop:
+		return "drop"
+	case AuditBackpressureBuffer:
+		return "buffer"
+	case AuditBackpressureBlock:
+		return "block"
+	}
+	return fmt.Sprintf("AuditBackpressurePolicy(%d)", int(policy))
+}
+
+// WithAuditSink writes an audit event for every write to the given sink. The
+// event is written once the write is stored, so that failed writes aren't
+// audited.
+func WithAuditSink(sink AuditSink) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.auditSink = sink
+	}
+}
+
+// WithOnAuditBackpressure sets what happens to writes while the audit sink is
+// slow or unavailable.
+func WithOnAuditBackpressure(policy AuditBackpressurePolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onAuditBackpressure = policy
+	}
+}
+
+// WithAuditBufferSize sets the maximum number of audit events buffered for the
+// audit sink, under the drop and buffer policies.
+func WithAuditBufferSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.auditBufferSize = size
+	}
+}
+
+// An auditEvent is the JSON representation of a write written to the audit sink.
+type auditEvent struct {
+	Time           time.Time `json:"time"`
+	Operation      string    `json:"operation"`
+	Type           string    `json:"type"`
+	ID             string    `json:"id,omitempty"`
+	Records        int       `json:"records,omitempty"`
+	Actor          string    `json:"actor,omitempty"`
+	Peer           string    `json:"peer,omitempty"`
+	InstallationID string    `json:"installation_id,omitempty"`
+}
+
+// newAuditEvent returns the audit event of a write of the record, by its last
+// writer. The operation defaults to a put or delete.
+func newAuditEvent(operation string, record *databroker.Record) auditEvent {
+	if operation == "" {
+		operation = "put"
+		if record.GetDeletedAt() != nil {
+			operation = "delete"
+		}
+	}
+	return auditEvent{
+		Time:           time.Now(),
+		Operation:      operation,
+		Type:           record.GetType(),
+		ID:             record.GetId(),
+		Actor:          record.GetLastWriter().GetActor(),
+		Peer:           record.GetLastWriter().GetPeer(),
+		InstallationID: record.GetLastWriter().GetInstallationId(),
+	}
+}
+
+// auditLog delivers the buffered audit events to the audit sink in order. The
+// zero value is ready to use.
+type auditLog struct {
+	mu     sync.Mutex
+	sink   AuditSink
+	queue  chan []byte
+	cancel context.CancelFunc
+}
+
+// getQueue returns the buffer of the audit events of the sink, starting their
+// delivery if the sink or the buffer size changed.
+func (l *auditLog) getQueue(log zerolog.Logger, sink AuditSink, size int) chan []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.queue != nil && l.sink == sink && cap(l.queue) == size {
+		return l.queue
+	}
+	l.stopLocked(log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.sink, l.queue, l.cancel = sink, make(chan []byte, size), cancel
+	go deliverAuditEvents(ctx, log, sink, l.queue)
+	return l.queue
+}
+
+// stop stops the delivery of the audit events. Events still buffered are dropped.
+func (l *auditLog) stop(log zerolog.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopLocked(log)
+}
+
+func (l *auditLog) stopLocked(log zerolog.Logger) {
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	if dropped := len(l.queue); dropped > 0 {
+		log.Warn().Int("events", dropped).Msg("audit log stopped, dropping buffered audit events")
+	}
+	l.sink, l.queue, l.cancel = nil, nil, nil
+}
+
+// deliverAuditEvents writes the queued events to the sink in order, retrying each
+// with backoff until it's written, until ctx is done.
+func deliverAuditEvents(ctx context.Context, log zerolog.Logger, sink AuditSink, queue <-chan []byte) {
+	for {
+		var event []byte
+		select {
+		case <-ctx.Done():
+			return
+		case event = <-queue:
+		}
+
+		backoff := changeFeedRetryBackoff
+		for {
+			err := sink.WriteAuditEvent(ctx, event)
+			if err == nil {
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Msg("failed to write audit event, retrying")
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextChangeFeedBackoff(backoff)
+		}
+	}
+}
+
+// writeAuditEvents writes the audit events of a stored write according to the
+// audit backpressure policy. An error is returned if the block policy couldn't
+// write them, or the buffer policy had no room for them before ctx was done.
+func (srv *Server) writeAuditEvents(ctx context.Context, events ...auditEvent) error {
+	cfg := srv.getConfig()
+	if cfg.auditSink == nil {
+		return nil
+	}
+
+	var queue chan []byte
+	if cfg.onAuditBackpressure != AuditBackpressureBlock {
+		queue = srv.auditLog.getQueue(srv.log, cfg.auditSink, cfg.auditBufferSize)
+	}
+	for _, evt := range events {
+		body, err := json.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit event: %w", err)
+		}
+
+		switch cfg.onAuditBackpressure {
+		case AuditBackpressureBlock:
+			if err := cfg.auditSink.WriteAuditEvent(ctx, body); err != nil {
+				return status.Errorf(codes.Unavailable, "failed to write audit event: %v", err)
+			}
+		case AuditBackpressureBuffer:
+			select {
+			case queue <- body:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		default:
+			select {
+			case queue <- body:
+			default:
+				srv.log.Warn().
+					Str("operation", evt.Operation).
+					Str("type", evt.Type).
+					Str("id", evt.ID).
+					Msg("audit buffer is full, dropping audit event")
+				metrics.RecordDataBrokerAuditEventDropped(ctx)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package databroker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// A stalledAuditSink doesn't write any audit event until it's unblocked.
+type stalledAuditSink struct {
+	started   chan struct{}
+	startOnce sync.Once
+	unblock   chan struct{}
+
+	mu     sync.Mutex
+	events []auditEvent
+}
+
+func newStalledAuditSink() *stalledAuditSink {
+	return &stalledAuditSink{started: make(chan struct{}), unblock: make(chan struct{})}
+}
+
+func (sink *stalledAuditSink) WriteAuditEvent(ctx context.Context, event []byte) error {
+	sink.startOnce.Do(func() { close(sink.started) })
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-sink.unblock:
+	}
+
+	var evt auditEvent
+	if err := json.Unmarshal(event, &evt); err != nil {
+		return err
+	}
+	sink.mu.Lock()
+	sink.events = append(sink.events, evt)
+	sink.mu.Unlock()
+	return nil
+}
+
+func (sink *stalledAuditSink) written() []string {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	var ids []string
+	for _, evt := range sink.events {
+		ids = append(ids, evt.ID)
+	}
+	return ids
+}
+
+func TestServer_AuditBackpressure(t *testing.T) {
+	view.Unregister(metrics.DataBrokerAuditEventsDroppedView)
+	require.NoError(t, view.Register(metrics.DataBrokerAuditEventsDroppedView))
+	defer view.Unregister(metrics.DataBrokerAuditEventsDroppedView)
+
+	dropped := func() int64 {
+		rows, err := view.RetrieveData(metrics.DataBrokerAuditEventsDroppedView.Name)
+		require.NoError(t, err)
+		if len(rows) == 0 {
+			return 0
+		}
+		return rows[0].Data.(*view.CountData).Value
+	}
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	put := func(ctx context.Context, srv *Server, id string) error {
+		_, err := srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: id}})
+		return err
+	}
+	stored := func(srv *Server, id string) bool {
+		_, err := srv.Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: id})
+		return err == nil
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		sink := newStalledAuditSink()
+		srv := newServer(newServerConfig(WithAuditSink(sink), WithAuditBufferSize(1)))
+		defer func() { _ = srv.Close() }()
+
+		before := dropped()
+		require.NoError(t, put(ctx, srv, "1"))
+		<-sink.started
+		require.NoError(t, put(ctx, srv, "2"), "the event should be buffered")
+		require.NoError(t, put(ctx, srv, "3"), "the write shouldn't wait for the full buffer")
+		assert.True(t, stored(srv, "3"))
+		assert.Equal(t, before+1, dropped(), "the event should be dropped")
+
+		close(sink.unblock)
+		require.Eventually(t, func() bool { return len(sink.written()) == 2 }, time.Second*5, time.Millisecond*10)
+		assert.Equal(t, []string{"1", "2"}, sink.written())
+	})
+	t.Run("buffer", func(t *testing.T) {
+		sink := newStalledAuditSink()
+		srv := newServer(newServerConfig(
+			WithAuditSink(sink),
+			WithOnAuditBackpressure(AuditBackpressureBuffer),
+			WithAuditBufferSize(1)))
+		defer func() { _ = srv.Close() }()
+
+		before := dropped()
+		require.NoError(t, put(ctx, srv, "1"))
+		<-sink.started
+		require.NoError(t, put(ctx, srv, "2"), "the event should be buffered")
+
+		shortCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+		defer cancel()
+		assert.ErrorIs(t, put(shortCtx, srv, "3"), context.DeadlineExceeded, "the write should wait for room in the buffer")
+		assert.True(t, stored(srv, "3"), "the write should be stored before its event is buffered")
+
+		errc := make(chan error, 1)
+		go func() { errc <- put(ctx, srv, "4") }()
+		close(sink.unblock)
+		assert.NoError(t, <-errc, "the write should proceed once there's room in the buffer")
+		require.Eventually(t, func() bool { return len(sink.written()) == 3 }, time.Second*5, time.Millisecond*10)
+		assert.Equal(t, []string{"1", "2", "4"}, sink.written())
+		assert.Equal(t, before, dropped(), "no event should be dropped")
+	})
+	t.Run("block", func(t *testing.T) {
+		sink := newStalledAuditSink()
+		srv := newServer(newServerConfig(
+			WithAuditSink(sink),
+			WithOnAuditBackpressure(AuditBackpressureBlock)))
+		defer func() { _ = srv.Close() }()
+
+		shortCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+		defer cancel()
+		assert.Equal(t, codes.Unavailable, status.Code(put(shortCtx, srv, "1")),
+			"the write should fail without its audit event")
+		assert.True(t, stored(srv, "1"), "the write should be stored before its event is written")
+
+		close(sink.unblock)
+		require.NoError(t, put(ctx, srv, "2"))
+		assert.True(t, stored(srv, "2"))
+		assert.Equal(t, []string{"2"}, sink.written(), "the event should be written before the write returns")
+	})
+}
+
+// A failingPutBackend fails every put with err.
+type failingPutBackend struct {
+	storage.Backend
+	err error
+}
+
+func (backend *failingPutBackend) Put(_ context.Context, _ *databroker.Record) error {
+	return backend.err
+}
+
+func TestServer_AuditFailedWrite(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"version conflict", storage.ErrVersionConflict, codes.Aborted},
+		{"storage error", errors.New("STORAGE ERROR"), codes.Unknown},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := newStalledAuditSink()
+			close(sink.unblock)
+			srv := newServer(newServerConfig(
+				WithAuditSink(sink),
+				WithOnAuditBackpressure(AuditBackpressureBlock)))
+			defer func() { _ = srv.Close() }()
+			srv.backend = &failingPutBackend{Backend: inmemory.New(), err: tc.err}
+
+			_, err := srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: "1"}})
+			assert.Equal(t, tc.code, status.Code(err))
+			assert.Empty(t, sink.written(), "a failed write shouldn't be audited")
+		})
+	}
+}
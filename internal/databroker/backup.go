@@ -0,0 +1,356 @@
+package databroker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// backupMagic identifies a databroker backup.
+var backupMagic = []byte("pomerium-databroker-backup\n")
+
+// backupFormatVersion is the version of the backup format written by Backup. It
+// must be incremented whenever the format changes.
+const backupFormatVersion = 1
+
+// maxBackupFrameSize limits the size of a single encrypted record in a backup so
+// that a corrupt backup doesn't cause a huge allocation.
+const maxBackupFrameSize = 64 << 20
+
+// A RestoreOption customizes a restore.
+type RestoreOption func(*restoreConfig)
+
+type restoreConfig struct {
+	overwrite bool
+}
+
+// WithRestoreOverwrite allows restoring over a store which isn't empty. The
+// records of the store are deleted before the backup is restored.
+func WithRestoreOverwrite() RestoreOption {
+	return func(cfg *restoreConfig) {
+		cfg.overwrite = true
+	}
+}
+
+// Backup writes all the records of the storage to w, for disaster recovery. Both
+// the current records and the changes retained by the storage are written, so
+// that a restore preserves soft-deleted records and when each change was made,
+// and so when it's deleted permanently.
+//
+// Each record is encrypted with the shared secret, so the secret, or a previous
+// one, is needed to restore the backup. The format is:
+//
+//	magic
+//	uvarint format version
+//	for each record: uvarint length, followed by the encrypted record
+//	uvarint 0
+//
+// The current records whose changes are no longer retained are written first,
+// followed by the changes in version order.
+func (srv *Server) Backup(ctx context.Context, w io.Writer) error {
+	ctx, span := trace.StartSpan(ctx, "databroker.Backup")
+	defer span.End()
+
+	cfg := srv.getConfig()
+	if cfg.secret == nil {
+		return status.Error(codes.FailedPrecondition, "databroker: a shared secret is required to back up the databroker")
+	}
+	aead, err := cryptutil.NewAEADCipher(cfg.secret)
+	if err != nil {
+		return err
+	}
+
+	backend, _, err := srv.getBackend()
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[loadedRecordKey]struct{})
+	err = syncChanges(ctx, backend, func(change *databroker.Record) error {
+		changed[loadedRecordKey{recordType: change.GetType(), id: change.GetId()}] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bkw := &backupWriter{w: bw, aead: aead}
+	bkw.write(backupMagic)
+	bkw.writeUvarint(backupFormatVersion)
+
+	_, err = srv.streamAll(ctx, backend, srv.getAllPageSizeFor(&databroker.SyncLatestRequest{}), func(page []*databroker.Record) error {
+		for _, record := range page {
+			if _, ok := changed[loadedRecordKey{recordType: record.GetType(), id: record.GetId()}]; ok {
+				continue
+			}
+			bkw.writeRecord(record)
+		}
+		return bkw.err
+	})
+	if err != nil {
+		return fmt.Errorf("databroker: error writing backup: %w", err)
+	}
+
+	err = syncChanges(ctx, backend, func(change *databroker.Record) error {
+		bkw.writeRecord(change)
+		return bkw.err
+	})
+	if err != nil {
+		return fmt.Errorf("databroker: error writing backup: %w", err)
+	}
+
+	bkw.writeUvarint(0)
+	if bkw.err != nil {
+		return fmt.Errorf("databroker: error writing backup: %w", bkw.err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("databroker: error writing backup: %w", err)
+	}
+	return nil
+}
+
+// Restore restores a backup written by Backup, such as to rebuild an empty
+// in-memory storage or to seed a new durable storage. The records are written in
+// the order they were backed up with the times they were modified at, so records
+// deleted before the backup are restored as deleted, and are deleted permanently
+// as they would have been. The storage assigns new versions to the records.
+//
+// A backup can't be restored over a store which isn't empty, unless the overwrite
+// option is given. If the backup is invalid or truncated an error is returned,
+// and the records read before the error are left restored.
+func (srv *Server) Restore(ctx context.Context, r io.Reader, options ...RestoreOption) error {
+	ctx, span := trace.StartSpan(ctx, "databroker.Restore")
+	defer span.End()
+
+	var rcfg restoreConfig
+	for _, option := range options {
+		option(&rcfg)
+	}
+
+	if err := srv.checkSafeMode(); err != nil {
+		return err
+	}
+	cfg := srv.getConfig()
+	aeads, err := newBackupCiphers(append([][]byte{cfg.secret}, cfg.previousSecrets...))
+	if err != nil {
+		return err
+	}
+
+	endWrite, err := srv.beginWrite()
+	if err != nil {
+		return err
+	}
+	defer endWrite()
+
+	backend, _, err := srv.getBackend()
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, backupMagic) {
+		return status.Error(codes.InvalidArgument, "databroker: invalid backup")
+	}
+	formatVersion, err := binary.ReadUvarint(br)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "databroker: error reading backup: %v", err)
+	}
+	if formatVersion != backupFormatVersion {
+		return status.Errorf(codes.InvalidArgument, "databroker: unsupported backup format version: %d", formatVersion)
+	}
+
+	if rcfg.overwrite {
+		err = deleteAllRecords(ctx, backend)
+	} else {
+		err = checkEmpty(ctx, backend)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx = storage.WithPreserveModifiedAt(ctx)
+	for {
+		record, err := readBackupRecord(br, aeads)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "databroker: error reading backup: %v", err)
+		}
+		if record == nil {
+			return nil
+		}
+
+		record.Version = 0
+		if err := backend.Put(ctx, record); err != nil {
+			return err
+		}
+		srv.recordLoads.invalidate(loadedRecordKey{recordType: record.GetType(), id: record.GetId()})
+	}
+}
+
+// checkEmpty returns an error if the backend has any records or retained changes.
+func checkEmpty(ctx context.Context, backend storage.Backend) error {
+	recordTypes, err := backend.ListRecordTypes(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream, err := backend.Sync(ctx, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+	hasChanges := stream.Next(false)
+	if err := stream.Err(); err != nil {
+		return err
+	}
+
+	if len(recordTypes) > 0 || hasChanges {
+		return status.Error(codes.FailedPrecondition, "databroker: refusing to restore a backup over a store which isn't empty")
+	}
+	return nil
+}
+
+// deleteAllRecords deletes all the current records of the backend.
+func deleteAllRecords(ctx context.Context, backend storage.Backend) error {
+	records, _, err := backend.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		record = proto.Clone(record).(*databroker.Record)
+		record.DeletedAt = timestamppb.Now()
+		if err := backend.Put(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncChanges calls fn with each of the changes retained by the backend, in
+// version order.
+func syncChanges(ctx context.Context, backend storage.Backend, fn func(change *databroker.Record) error) error {
+	stream, err := backend.Sync(ctx, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+
+	for stream.Next(false) {
+		change := stream.Record()
+		if change == nil {
+			// the change failed verification, which is returned by Err
+			break
+		}
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+func newBackupCiphers(secrets [][]byte) ([]cipher.AEAD, error) {
+	var aeads []cipher.AEAD
+	for _, secret := range secrets {
+		if secret == nil {
+			continue
+		}
+		aead, err := cryptutil.NewAEADCipher(secret)
+		if err != nil {
+			return nil, err
+		}
+		aeads = append(aeads, aead)
+	}
+	if len(aeads) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "databroker: a shared secret is required to restore a backup")
+	}
+	return aeads, nil
+}
+
+// readBackupRecord reads the next record of a backup, decrypting it with the first
+// of the ciphers which can. It returns nil at the end of the backup.
+func readBackupRecord(br *bufio.Reader, aeads []cipher.AEAD) (*databroker.Record, error) {
+	sz, err := binary.ReadUvarint(br)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if sz == 0 {
+		return nil, nil
+	}
+	if sz > maxBackupFrameSize {
+		return nil, fmt.Errorf("record too large: %d", sz)
+	}
+
+	bs := make([]byte, sz)
+	if _, err := io.ReadFull(br, bs); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	for _, aead := range aeads {
+		plaintext, err := cryptutil.Decrypt(aead, bs, backupMagic)
+		if err != nil {
+			continue
+		}
+		record := new(databroker.Record)
+		if err := proto.Unmarshal(plaintext, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+	return nil, errors.New("record can't be decrypted with the shared secret")
+}
+
+// A backupWriter writes backup data, remembering the first error.
+type backupWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  [binary.MaxVarintLen64]byte
+	err  error
+}
+
+func (bkw *backupWriter) write(bs []byte) {
+	if bkw.err != nil {
+		return
+	}
+	_, bkw.err = bkw.w.Write(bs)
+}
+
+func (bkw *backupWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(bkw.buf[:], v)
+	bkw.write(bkw.buf[:n])
+}
+
+func (bkw *backupWriter) writeRecord(record *databroker.Record) {
+	if bkw.err != nil {
+		return
+	}
+	bs, err := proto.Marshal(record)
+	if err != nil {
+		bkw.err = err
+		return
+	}
+	ciphertext := cryptutil.Encrypt(bkw.aead, bs, backupMagic)
+	bkw.writeUvarint(uint64(len(ciphertext)))
+	bkw.write(ciphertext)
+}
@@ -0,0 +1,98 @@
+package databroker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestServer_BackupRestore(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	sharedKey := cryptutil.NewBase64Key()
+	srv := newServer(newServerConfig(WithSharedKey(sharedKey)))
+
+	data1, err := anypb.New(&user.User{Id: "u1", Name: "ONE"})
+	require.NoError(t, err)
+	data2, err := anypb.New(&user.User{Id: "u2", Name: "TWO"})
+	require.NoError(t, err)
+	put1, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: data1.GetTypeUrl(), Id: "u1", Data: data1},
+	})
+	require.NoError(t, err)
+	_, err = srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: data2.GetTypeUrl(), Id: "u2", Data: data2},
+	})
+	require.NoError(t, err)
+	deleted, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: data2.GetTypeUrl(), Id: "u2", DeletedAt: timestamppb.Now()},
+	})
+	require.NoError(t, err)
+
+	var backup bytes.Buffer
+	require.NoError(t, srv.Backup(ctx, &backup))
+	assert.NotContains(t, backup.String(), "ONE", "records should be encrypted")
+
+	t.Run("round trip", func(t *testing.T) {
+		restored := newServer(newServerConfig(WithSharedKey(sharedKey)))
+		require.NoError(t, restored.Restore(ctx, bytes.NewReader(backup.Bytes())))
+
+		got, err := restored.Get(ctx, &databroker.GetRequest{Type: data1.GetTypeUrl(), Id: "u1"})
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(data1, got.GetRecord().GetData()))
+		assert.True(t, proto.Equal(put1.GetRecord().GetModifiedAt(), got.GetRecord().GetModifiedAt()),
+			"the modification time should be preserved")
+
+		_, err = restored.Get(ctx, &databroker.GetRequest{Type: data2.GetTypeUrl(), Id: "u2"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "deleted records should stay deleted")
+
+		changes, err := restored.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{})
+		require.NoError(t, err)
+		require.Len(t, changes.GetRecords(), 3)
+		last := changes.GetRecords()[2]
+		assert.True(t, proto.Equal(deleted.GetRecord().GetDeletedAt(), last.GetDeletedAt()))
+		assert.True(t, proto.Equal(deleted.GetRecord().GetModifiedAt(), last.GetModifiedAt()))
+
+		undeleted, err := restored.Undelete(ctx, &databroker.UndeleteRequest{Type: data2.GetTypeUrl(), Id: "u2"})
+		require.NoError(t, err, "soft-deleted records should still be restorable")
+		assert.True(t, proto.Equal(data2, undeleted.GetRecord().GetData()))
+
+		err = restored.Restore(ctx, bytes.NewReader(backup.Bytes()))
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), "a backup shouldn't be restored over existing records")
+
+		require.NoError(t, restored.Restore(ctx, bytes.NewReader(backup.Bytes()), WithRestoreOverwrite()))
+		_, err = restored.Get(ctx, &databroker.GetRequest{Type: data2.GetTypeUrl(), Id: "u2"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "the backup should replace the existing records")
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		restored := newServer(newServerConfig(WithSharedKey(cryptutil.NewBase64Key())))
+		err := restored.Restore(ctx, bytes.NewReader(backup.Bytes()))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("previous key", func(t *testing.T) {
+		restored := newServer(newServerConfig(
+			WithSharedKey(cryptutil.NewBase64Key()),
+			WithPreviousSharedKeys([]string{sharedKey}),
+		))
+		require.NoError(t, restored.Restore(ctx, bytes.NewReader(backup.Bytes())))
+	})
+	t.Run("truncated", func(t *testing.T) {
+		restored := newServer(newServerConfig(WithSharedKey(sharedKey)))
+		err := restored.Restore(ctx, bytes.NewReader(backup.Bytes()[:backup.Len()-1]))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,31 @@
+package databroker
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// setCacheHints sets the trailing metadata hinting how long the client may cache
+// the record of a Get response, if any record types are cacheable. The ttl is that
+// of the record's type, but no later than the record's expiry.
+func (srv *Server) setCacheHints(ctx context.Context, record *databroker.Record) {
+	cfg := srv.getConfig()
+	if len(cfg.cacheTTLs) == 0 {
+		return
+	}
+
+	ttl := cfg.cacheTTLs[record.GetType()]
+	if expiresAt, ok := storage.ExpiresAt(record); ok && ttl > 0 {
+		if remaining := time.Until(expiresAt); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	// this fails outside of a gRPC call, where there's no client to hint
+	_ = grpc.SetTrailer(ctx, grpcutil.CacheControlMetadata(ttl))
+}
@@ -0,0 +1,217 @@
+package databroker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	changeFeedMaxRetryBackoff = 10 * time.Second
+
+	// cloudEventsContentType is the content type of a CloudEvents JSON event.
+	cloudEventsContentType = "application/cloudevents+json"
+	// cloudEventsSpecVersion is the version of the CloudEvents spec of the events.
+	cloudEventsSpecVersion = "1.0"
+	// cloudEventsTypePrefix is the prefix of the CloudEvents type of a record
+	// change, which is followed by the operation.
+	cloudEventsTypePrefix = "io.pomerium.databroker.record."
+	// cloudEventsSourcePrefix is the prefix of the CloudEvents source of a record
+	// change, which is followed by the installation id.
+	cloudEventsSourcePrefix = "urn:pomerium:databroker"
+)
+
+// changeFeedRetryBackoff is the time waited before the first retry of a change
+// feed, or of the delivery of a change by a sink. It doubles after each retry, up
+// to changeFeedMaxRetryBackoff.
+var changeFeedRetryBackoff = 100 * time.Millisecond
+
+// A changeEvent is the JSON representation of a record change sent to the sinks
+// of the change feed.
+type changeEvent struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id"`
+	Version   uint64          `json:"version"`
+	Operation string          `json:"operation"`
+	Time      time.Time       `json:"time"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// marshalChangeEvent returns the JSON change event of the record, with its data
+// as the payload if includePayload is set.
+func marshalChangeEvent(record *databroker.Record, includePayload bool) ([]byte, error) {
+	evt := changeEvent{
+		Type:      record.GetType(),
+		ID:        record.GetId(),
+		Version:   record.GetVersion(),
+		Operation: "put",
+		Time:      record.GetModifiedAt().AsTime(),
+	}
+	if record.GetDeletedAt() != nil {
+		evt.Operation = "delete"
+	}
+	if includePayload && record.GetData() != nil {
+		payload, err := protojson.Marshal(record.GetData())
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		evt.Payload = payload
+	}
+	return json.Marshal(evt)
+}
+
+// A cloudEvent is the CloudEvents JSON representation of a record change, with
+// its JSON change event as the data.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// marshalCloudEvent returns the CloudEvents JSON event of the record change. The
+// source is the databroker of the installation, the subject the record, and the
+// id is unique per record version, so that redeliveries can be deduplicated.
+func marshalCloudEvent(record *databroker.Record, includePayload bool, installationID string) ([]byte, error) {
+	data, err := marshalChangeEvent(record, includePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := "put"
+	if record.GetDeletedAt() != nil {
+		operation = "delete"
+	}
+	source := cloudEventsSourcePrefix
+	if installationID != "" {
+		source += ":" + installationID
+	}
+	return json.Marshal(cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              fmt.Sprintf("%s/%s/%d", record.GetType(), record.GetId(), record.GetVersion()),
+		Source:          source,
+		Type:            cloudEventsTypePrefix + operation,
+		Subject:         record.GetType() + "/" + record.GetId(),
+		Time:            record.GetModifiedAt().AsTime(),
+		DataContentType: "application/json",
+		Data:            data,
+	})
+}
+
+// startChangeFeedsLocked starts the configured sinks of the changes to the backend
+// after its current version: the webhooks and the Kafka sink. The returned
+// function stops them.
+func (srv *Server) startChangeFeedsLocked(backend storage.Backend) (stop func(), err error) {
+	if len(srv.cfg.webhookURLs) == 0 && srv.cfg.kafkaSink == nil {
+		return func() {}, nil
+	}
+
+	if srv.cfg.kafkaSink != nil {
+		if srv.cfg.kafkaSink.Topic == "" {
+			return nil, fmt.Errorf("kafka sink topic is required")
+		}
+		if srv.cfg.kafkaProducer == nil && len(srv.cfg.kafkaSink.Brokers) == 0 {
+			return nil, fmt.Errorf("kafka sink brokers are required")
+		}
+	}
+
+	_, version, err := backend.GetAll(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the latest record version for the change feed: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(srv.cfg.webhookURLs) > 0 {
+		n := srv.newWebhookNotifierLocked(ctx)
+		go runChangeFeed(ctx, srv.log, "webhook", backend, version, n.enqueue)
+	}
+	if srv.cfg.kafkaSink != nil {
+		p := srv.newKafkaPublisherLocked(ctx)
+		go runChangeFeed(ctx, srv.log, "kafka", backend, version, p.enqueue)
+	}
+	return cancel, nil
+}
+
+func (srv *Server) stopChangeFeedsLocked() {
+	if srv.stopChangeFeeds != nil {
+		srv.stopChangeFeeds()
+		srv.stopChangeFeeds = nil
+	}
+}
+
+// runChangeFeed reads the changes from the backend after the given version and
+// passes them to handle in version order, until ctx is done. Since the changes
+// are read from the backend's change log, like a Sync stream, a handle which
+// blocks holds back its own feed, but never the writes. The server version record
+// is skipped.
+func runChangeFeed(
+	ctx context.Context,
+	log zerolog.Logger,
+	name string,
+	backend storage.Backend,
+	version uint64,
+	handle func(ctx context.Context, record *databroker.Record),
+) {
+	backoff := changeFeedRetryBackoff
+	for {
+		stream, err := backend.Sync(ctx, version)
+		if err == nil {
+			for stream.Next(true) {
+				record := stream.Record()
+				if record == nil {
+					// the record failed verification, which is returned by Err
+					break
+				}
+				version = record.GetVersion()
+				if record.GetType() != recordTypeServerVersion {
+					handle(ctx, record)
+				}
+				backoff = changeFeedRetryBackoff
+			}
+			err = stream.Err()
+			_ = stream.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).
+			Str("sink", name).
+			Uint64("record_version", version).
+			Msg("change feed stream failed, retrying")
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		backoff = nextChangeFeedBackoff(backoff)
+	}
+}
+
+func nextChangeFeedBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > changeFeedMaxRetryBackoff {
+		backoff = changeFeedMaxRetryBackoff
+	}
+	return backoff
+}
+
+// sleepContext waits for the given duration. It returns false if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,70 @@
+package databroker
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// DefaultChangeLogLimit is the default number of changes returned by DumpChangeLog.
+const DefaultChangeLogLimit = 100
+
+// DumpChangeLog returns the changes after the requested version, in version
+// order, for diagnosing sync discrepancies. Only the changes still retained by
+// the storage backend are returned. The data of each change is omitted unless
+// it's explicitly requested.
+func (srv *Server) DumpChangeLog(ctx context.Context, req *databroker.DumpChangeLogRequest) (*databroker.DumpChangeLogResponse, error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.grpc.DumpChangeLog")
+	defer span.End()
+	srv.log.Info().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Str("type", req.GetType()).
+		Uint64("after_version", req.GetAfterVersion()).
+		Uint32("limit", req.GetLimit()).
+		Bool("include_data", req.GetIncludeData()).
+		Msg("dump change log")
+
+	limit := DefaultChangeLogLimit
+	if req.GetLimit() > 0 {
+		limit = int(req.GetLimit())
+	}
+	if maxLimit := srv.getConfig().getAllMaxPageSize; limit > maxLimit {
+		limit = maxLimit
+	}
+
+	backend, serverVersion, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := backend.Sync(ctx, req.GetAfterVersion())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.Close() }()
+
+	res := &databroker.DumpChangeLogResponse{ServerVersion: serverVersion}
+	for len(res.Records) < limit && stream.Next(false) {
+		record := stream.Record()
+		if record == nil {
+			// the record failed verification, which is returned by Err
+			break
+		}
+		if req.GetType() != "" && record.GetType() != req.GetType() {
+			continue
+		}
+		if !req.GetIncludeData() {
+			record = proto.Clone(record).(*databroker.Record)
+			record.Data = nil
+		}
+		res.Records = append(res.Records, record)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,58 @@
+package databroker
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// syncCompressionMinSize is the minimum size of a marshaled record for it to be
+// compressed. Smaller records rarely compress well enough to be worth it.
+const syncCompressionMinSize = 256
+
+// negotiateSyncCompression returns the first of the server's codecs which the
+// client accepts, or "" if there is none.
+func negotiateSyncCompression(serverCodecs, clientCodecs []string) string {
+	for _, codec := range serverCodecs {
+		for _, accepted := range clientCodecs {
+			if codec == accepted {
+				return codec
+			}
+		}
+	}
+	return ""
+}
+
+// compressSyncResponse replaces the record of the response with its compressed
+// form. The record is sent uncompressed if it's too small or doesn't compress.
+func (srv *Server) compressSyncResponse(ctx context.Context, codec string, res *databroker.SyncResponse) {
+	if codec == "" || res.GetRecord() == nil {
+		return
+	}
+
+	data, err := proto.Marshal(res.GetRecord())
+	if err != nil {
+		srv.log.Warn().Err(err).Msg("error marshaling record for compression")
+		return
+	}
+	if len(data) < syncCompressionMinSize {
+		return
+	}
+
+	compressed, err := databroker.Compress(codec, data)
+	if err != nil {
+		srv.log.Warn().Err(err).Str("compression", codec).Msg("error compressing record")
+		return
+	}
+	if len(compressed) >= len(data) {
+		return
+	}
+
+	res.Record = nil
+	res.CompressedRecord = compressed
+	res.Compression = codec
+	metrics.RecordDataBrokerSyncCompressionSavedBytes(ctx, codec, int64(len(data)-len(compressed)))
+}
@@ -3,48 +3,454 @@ package databroker
 import (
 	"crypto/tls"
 	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
 )
 
 var (
 	// DefaultDeletePermanentlyAfter is the default amount of time to wait before deleting
 	// a record permanently.
 	DefaultDeletePermanentlyAfter = time.Hour
+	// DefaultMinimumRetention is the default minimum amount of time to wait before
+	// deleting records permanently.
+	DefaultMinimumRetention = time.Minute
 	// DefaultStorageType is the default storage type that Server use
 	DefaultStorageType = "memory"
 	// DefaultGetAllPageSize is the default page size for GetAll calls.
 	DefaultGetAllPageSize = 50
+	// DefaultDrainTimeout is the default amount of time to wait for in-flight
+	// writes to complete when draining.
+	DefaultDrainTimeout = time.Second * 10
+	// DefaultSyncDrainFlushTimeout is the default maximum amount of time Sync
+	// streams spend flushing pending changes when draining, under the flush policy.
+	DefaultSyncDrainFlushTimeout = time.Second * 5
+	// DefaultExpiryScanInterval is the default interval between scans for
+	// expired records.
+	DefaultExpiryScanInterval = time.Minute
+	// DefaultRetentionInterval is the default interval between applications of
+	// the retention policies.
+	DefaultRetentionInterval = time.Minute
+	// DefaultGetAllMaxPageSize is the default maximum page size a client may
+	// request for GetAll calls.
+	DefaultGetAllMaxPageSize = 1000
+	// DefaultStorageWarmupTimeout is the default amount of time to wait for the
+	// storage warmup to complete on startup.
+	DefaultStorageWarmupTimeout = time.Second * 30
+	// DefaultReadCacheTTL is the default maximum age of read cache entries.
+	DefaultReadCacheTTL = time.Minute * 5
+	// DefaultStorageCertificateReloadInterval is the default minimum interval
+	// between checks of the storage client certificate files for changes.
+	DefaultStorageCertificateReloadInterval = time.Minute
+	// DefaultCleanupReserve is the default amount of time reserved before a
+	// request's deadline for rolling back a cascaded delete.
+	DefaultCleanupReserve = time.Millisecond * 250
+	// DefaultSlowOperationSampleRate is the default fraction of the slow storage
+	// operations which are logged.
+	DefaultSlowOperationSampleRate = 1.0
+	// DefaultReadYourWritesTimeout is the default maximum time a read with a
+	// consistency token waits for the storage to catch up with the write.
+	DefaultReadYourWritesTimeout = time.Second
 )
 
+// A StorageRoute is a storage backend for the records of a type, other than the
+// default storage backend.
+type StorageRoute struct {
+	// Type is the storage type, such as "memory" or "redis".
+	Type string
+	// ConnectionString is the connection string of the storage.
+	ConnectionString string
+}
+
 type serverConfig struct {
-	installationID          string
-	deletePermanentlyAfter  time.Duration
-	secret                  []byte
-	storageType             string
-	storageConnectionString string
-	storageCAFile           string
-	storageCertSkipVerify   bool
-	storageCertificate      *tls.Certificate
-	getAllPageSize          int
+	installationID               string
+	installationQuotas           map[string]InstallationQuota
+	listenAddress                string
+	deletePermanentlyAfter       time.Duration
+	requestedRetention           time.Duration // deletePermanentlyAfter before it's raised to the minimum retention
+	deletePermanentlyAfterByType map[string]time.Duration
+	minimumRetention             time.Duration
+	sweepWindows                 []string
+	disableSweep                 bool
+	immediateDeleteTypes         []string
+	deletedGracePeriod           time.Duration
+	onSyncVersionGap             SyncVersionGapPolicy
+	recordQuotas                 map[string]int
+	cacheTTLs                    map[string]time.Duration
+	dedupeIdenticalPuts          bool
+	drainTimeout                 time.Duration
+	onSyncDrain                  SyncDrainPolicy
+	syncDrainFlushTimeout        time.Duration
+	secret                       []byte
+	previousSecrets              [][]byte
+	onSharedKeyChange            SharedKeyChangePolicy
+	onStorageInitFailure         StorageInitFailurePolicy
+	onOversizedPage              OversizedPagePolicy
+	onResync                     ResyncPolicy
+	resyncConcurrency            int
+	resyncSnapshotMaxAge         time.Duration
+	encryptedFields              map[string][]string
+	typeEncryptionKeys           map[string][][]byte
+	invalidSharedKey             bool
+	storageType                  string
+	memoryPersistPath            string
+	memoryPersistDurability      inmemory.PersistDurability
+	memoryPersistInterval        time.Duration
+	memoryCompactOnStartup       bool
+	storageConnectionString      string
+	storageKeyPrefix             string
+	storageChangeCompression     string
+	storageRoutes                map[string]StorageRoute
+	storageShards                map[string]StorageRoute
+	criticalRecordTypes          []string
+	storageCAFile                string
+	storageCAFiles               []string
+	storageCertSkipVerify        bool
+	storageCertificate           *tls.Certificate
+	storageCertificatePEM        []byte
+	storageCertificateFile       string
+	storageKeyFile               string
+	storageCertReloadInterval    time.Duration
+	storageKeyPEM                []byte
+	storageCAPEM                 []byte
+	storageCredentialsFile       string
+	storageUsername              string
+	storagePasswordFile          string
+	storageSecretClient          KubernetesSecretClient
+	storageSecret                *KubernetesSecretRef
+	storageSecretError           string
+	storagePoolSize              int
+	storageMinIdleConns          int
+	storageDialTimeout           time.Duration
+	storageStatementTimeout      time.Duration
+	storageWatchdogThreshold     int
+	slowOperationThreshold       time.Duration
+	slowOperationSampleRate      float64
+	maxConcurrentStorageOps      int
+	storageDNSRefreshInterval    time.Duration
+	storageTCPKeepAlive          *time.Duration
+	storageRecordTypeMetrics     bool
+	storageKnownRecordTypes      []string
+	strictRecordTypes            bool
+	globallyUniqueIDs            bool
+	storageWarmup                bool
+	storageWarmupRecordTypes     []string
+	getAllPageSize               int
+	getAllPageSizeByType         map[string]int
+	getAllMaxPageSize            int
+	getAllMaxResults             int
+	maxSyncStreams               int
+	maxRecvMsgSize               int
+	maxSendMsgSize               int
+	syncKeepalive                time.Duration
+	syncCompression              []string
+	acceptedSchemaVersions       []int
+	minProtocolVersion           int
+	requireExpiryTypes           []string
+	requireExpiryStrict          bool
+	syncConcurrency              int
+	syncSendConcurrency          int
+	syncPauseBufferSize          int
+	maxNotificationBufferBytes   int64
+	syncWeights                  map[string]int
+	queueDepthMetrics            bool
+	configInfoMetric             bool
+	readCacheSize                int
+	readCacheTTL                 time.Duration
+	serveStaleOnError            bool
+	negativeCacheTTL             time.Duration
+	expiryScanEnabled            bool
+	expiryScanInterval           time.Duration
+	expirySkewTolerance          time.Duration
+	recordAgeSampleInterval      time.Duration
+	retentionPolicies            map[string][]storage.RetentionPolicy
+	retentionInterval            time.Duration
+	maxVersionsPerRecord         int
+	idGenerator                  func() string
+	recordValidators             map[string]RecordValidator
+	loaders                      map[string]RecordLoader
+	loaderTTL                    time.Duration
+	deleteStrategies             map[string][]storage.DeleteStrategy
+	cleanupReserve               time.Duration
+	reportReplicaLag             bool
+	lastWriteMetrics             bool
+	readYourWritesTimeout        time.Duration
+	webhookURLs                  []string
+	webhookIncludePayload        bool
+	webhookSerialization         ChangeSerialization
+	webhookBufferSize            int
+	webhookMaxAttempts           int
+	kafkaProducer                KafkaProducer
+	kafkaSink                    *KafkaSink
+	auditSink                    AuditSink
+	onAuditBackpressure          AuditBackpressurePolicy
+	auditBufferSize              int
+	recordSigning                bool
+	recordSigningAcceptUnsigned  bool
+	recordSigner                 storage.Signer
+	recordVerifiers              []storage.Verifier
 }
 
 func newServerConfig(options ...ServerOption) *serverConfig {
 	cfg := new(serverConfig)
 	WithDeletePermanentlyAfter(DefaultDeletePermanentlyAfter)(cfg)
+	WithDrainTimeout(DefaultDrainTimeout)(cfg)
+	WithSyncDrainFlushTimeout(DefaultSyncDrainFlushTimeout)(cfg)
+	WithExpiryScanInterval(DefaultExpiryScanInterval)(cfg)
+	WithLoaderTTL(DefaultLoaderTTL)(cfg)
+	WithResyncSnapshotMaxAge(DefaultResyncSnapshotMaxAge)(cfg)
+	WithRetentionInterval(DefaultRetentionInterval)(cfg)
 	WithStorageType(DefaultStorageType)(cfg)
 	WithGetAllPageSize(DefaultGetAllPageSize)(cfg)
+	WithGetAllMaxPageSize(DefaultGetAllMaxPageSize)(cfg)
+	WithReadCacheTTL(DefaultReadCacheTTL)(cfg)
+	WithStorageCertificateReloadInterval(DefaultStorageCertificateReloadInterval)(cfg)
+	WithSyncPauseBufferSize(DefaultSyncPauseBufferSize)(cfg)
+	WithCleanupReserve(DefaultCleanupReserve)(cfg)
+	WithMinimumRetention(DefaultMinimumRetention)(cfg)
+	WithWebhookBufferSize(DefaultWebhookBufferSize)(cfg)
+	WithWebhookMaxAttempts(DefaultWebhookMaxAttempts)(cfg)
+	WithAuditBufferSize(DefaultAuditBufferSize)(cfg)
+	WithSlowOperationSampleRate(DefaultSlowOperationSampleRate)(cfg)
+	WithReadYourWritesTimeout(DefaultReadYourWritesTimeout)(cfg)
 	for _, option := range options {
 		option(cfg)
 	}
+	cfg.requestedRetention = cfg.deletePermanentlyAfter
+	if cfg.deletePermanentlyAfter < cfg.minimumRetention {
+		cfg.deletePermanentlyAfter = cfg.minimumRetention
+	}
 	return cfg
 }
 
+// typeDeletePermanentlyAfter returns the deletePermanentlyAfter durations set for
+// record types, raised to the minimum retention.
+func (cfg *serverConfig) typeDeletePermanentlyAfter() map[string]time.Duration {
+	if len(cfg.deletePermanentlyAfterByType) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(cfg.deletePermanentlyAfterByType))
+	for recordType, dur := range cfg.deletePermanentlyAfterByType {
+		if dur < cfg.minimumRetention {
+			dur = cfg.minimumRetention
+		}
+		durations[recordType] = dur
+	}
+	return durations
+}
+
+// storageCAFilePaths returns all the configured storage CA files and directories.
+func (cfg *serverConfig) storageCAFilePaths() []string {
+	var paths []string
+	if cfg.storageCAFile != "" {
+		paths = append(paths, cfg.storageCAFile)
+	}
+	for _, p := range cfg.storageCAFiles {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// storageTLSConfig returns the TLS configuration for storage connections.
+func (cfg *serverConfig) storageTLSConfig() (*tls.Config, error) {
+	caCertPool, err := cryptutil.GetCertPoolFromFiles(cfg.storageCAFilePaths()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load databroker storage CA: %w", err)
+	}
+	if len(cfg.storageCAPEM) > 0 && !caCertPool.AppendCertsFromPEM(cfg.storageCAPEM) {
+		return nil, fmt.Errorf("failed to load databroker storage CA: no PEM-encoded certificates found")
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs: caCertPool,
+		// nolint: gosec
+		InsecureSkipVerify: cfg.storageCertSkipVerify,
+	}
+	switch {
+	case len(cfg.storageCertificatePEM) > 0 || len(cfg.storageKeyPEM) > 0:
+		cert, err := tls.X509KeyPair(cfg.storageCertificatePEM, cfg.storageKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load databroker storage certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.storageCertificateFile != "" || cfg.storageKeyFile != "":
+		reloader, err := cryptutil.NewCertificateReloader(cfg.storageCertificateFile, cfg.storageKeyFile,
+			cfg.storageCertReloadInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load databroker storage certificate: %w", err)
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	case cfg.storageCertificate != nil:
+		tlsConfig.Certificates = []tls.Certificate{*cfg.storageCertificate}
+	}
+	return tlsConfig, nil
+}
+
 // A ServerOption customizes the server.
 type ServerOption func(*serverConfig)
 
+// A SyncVersionGapPolicy determines how a Sync stream is handled when changes
+// after the client's record version are no longer available, for example because
+// the change log was compacted.
+type SyncVersionGapPolicy int
+
+const (
+	// SyncVersionGapResync aborts the stream in the same way as a server version
+	// change, so that the client re-syncs all the latest records.
+	SyncVersionGapResync SyncVersionGapPolicy = iota
+	// SyncVersionGapReset fails the stream with an OutOfRange error, which the
+	// client can detect with databroker.IsResetRequired.
+	SyncVersionGapReset
+)
+
+// String returns the name of the policy.
+func (policy SyncVersionGapPolicy) String() string {
+	switch policy {
+	case SyncVersionGapResync:
+		return "resync"
+	case SyncVersionGapReset:
+		return "reset"
+	}
+	return fmt.Sprintf("SyncVersionGapPolicy(%d)", int(policy))
+}
+
+// A SharedKeyChangePolicy determines how the server handles a change of the shared
+// key while it's running.
+type SharedKeyChangePolicy int
+
+const (
+	// SharedKeyChangeRecreate recreates the storage backend with the new key, as
+	// for any other change. Records written with the old key fail verification
+	// unless it's given as a previous key.
+	SharedKeyChangeRecreate SharedKeyChangePolicy = iota
+	// SharedKeyChangeRotate rotates the key of the storage backend in place, if
+	// nothing else changed, so that open Sync streams carry on across the change.
+	// The old key is kept to verify the records written with it.
+	SharedKeyChangeRotate
+)
+
+// String returns the name of the policy.
+func (policy SharedKeyChangePolicy) String() string {
+	switch policy {
+	case SharedKeyChangeRecreate:
+		return "recreate"
+	case SharedKeyChangeRotate:
+		return "rotate"
+	}
+	return fmt.Sprintf("SharedKeyChangePolicy(%d)", int(policy))
+}
+
+// A StorageInitFailurePolicy determines how the server handles a storage backend
+// which can't be reached when it's created, such as at startup.
+type StorageInitFailurePolicy int
+
+const (
+	// StorageInitFailureRetryOnRequest logs the failure, and tries to connect to
+	// the storage again on each request until it succeeds.
+	StorageInitFailureRetryOnRequest StorageInitFailurePolicy = iota
+	// StorageInitFailureFailFast logs the failure and exits the process.
+	StorageInitFailureFailFast
+	// StorageInitFailureStartDegraded fails requests with Unavailable, and retries
+	// connecting to the storage in the background with backoff, until it succeeds
+	// and the server starts serving.
+	StorageInitFailureStartDegraded
+)
+
+// String returns the name of the policy.
+func (policy StorageInitFailurePolicy) String() string {
+	switch policy {
+	case StorageInitFailureRetryOnRequest:
+		return "retry-on-request"
+	case StorageInitFailureFailFast:
+		return "fail-fast"
+	case StorageInitFailureStartDegraded:
+		return "start-degraded"
+	}
+	return fmt.Sprintf("StorageInitFailurePolicy(%d)", int(policy))
+}
+
+// An OversizedPagePolicy determines how SyncLatest handles a page of records from
+// the storage backend which is larger than the maximum message size.
+type OversizedPagePolicy int
+
+const (
+	// OversizedPageSplit splits the page into a message per record. A record which
+	// is too large to send on its own fails the stream with ResourceExhausted.
+	OversizedPageSplit OversizedPagePolicy = iota
+	// OversizedPageSkip splits the page in the same way, but skips and logs the
+	// records which are too large to send on their own, so that the client gets
+	// all the others.
+	OversizedPageSkip
+)
+
+// String returns the name of the policy.
+func (policy OversizedPagePolicy) String() string {
+	switch policy {
+	case OversizedPageSplit:
+		return "split"
+	case OversizedPageSkip:
+		return "skip"
+	}
+	return fmt.Sprintf("OversizedPagePolicy(%d)", int(policy))
+}
+
+// A ResyncPolicy determines how the full re-syncs of SyncLatest are served, for
+// example when a compaction of the change log makes many clients re-sync at once.
+type ResyncPolicy int
+
+const (
+	// ResyncIndependent reads the records from the storage for every re-sync.
+	ResyncIndependent ResyncPolicy = iota
+	// ResyncCoordinated serves the re-syncs from a snapshot of the records shared
+	// between them, and admits at most the re-sync concurrency at once, so that a
+	// stampede of re-syncs doesn't hit the storage all at once.
+	ResyncCoordinated
+)
+
+// String returns the name of the policy.
+func (policy ResyncPolicy) String() string {
+	switch policy {
+	case ResyncIndependent:
+		return "independent"
+	case ResyncCoordinated:
+		return "coordinated"
+	}
+	return fmt.Sprintf("ResyncPolicy(%d)", int(policy))
+}
+
+// A SyncDrainPolicy determines how open Sync streams are closed when the server
+// is drained for shutdown.
+type SyncDrainPolicy int
+
+const (
+	// SyncDrainClose closes the streams right away. Changes which weren't sent
+	// yet are picked up by the clients when they reconnect elsewhere.
+	SyncDrainClose SyncDrainPolicy = iota
+	// SyncDrainFlush waits for the in-flight writes to complete and sends the
+	// pending changes before closing the streams, up to the sync drain flush
+	// timeout, so that clients are as up-to-date as possible when they reconnect.
+	SyncDrainFlush
+)
+
+// String returns the name of the policy.
+func (policy SyncDrainPolicy) String() string {
+	switch policy {
+	case SyncDrainClose:
+		return "close"
+	case SyncDrainFlush:
+		return "flush"
+	}
+	return fmt.Sprintf("SyncDrainPolicy(%d)", int(policy))
+}
+
 // WithDeletePermanentlyAfter sets the deletePermanentlyAfter duration.
 // If a record is deleted via Delete, it will be permanently deleted after
 // the given duration.
@@ -54,6 +460,324 @@ func WithDeletePermanentlyAfter(dur time.Duration) ServerOption {
 	}
 }
 
+// WithDeletePermanentlyAfterForType sets the deletePermanentlyAfter duration for
+// the records of the given type, overriding the duration set by
+// WithDeletePermanentlyAfter. A duration of 0 deletes the records of the type
+// permanently at the next sweep. It may be given more than once.
+func WithDeletePermanentlyAfterForType(recordType string, dur time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.deletePermanentlyAfterByType == nil {
+			cfg.deletePermanentlyAfterByType = make(map[string]time.Duration)
+		}
+		cfg.deletePermanentlyAfterByType[recordType] = dur
+	}
+}
+
+// WithMinimumRetention sets the minimum deletePermanentlyAfter duration, to guard
+// against records being deleted permanently right away by mistake. Shorter
+// durations, including those set for a type, are raised to it, with a warning. 0
+// allows any duration.
+func WithMinimumRetention(dur time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.minimumRetention = dur
+	}
+}
+
+// WithSweepWindows restricts the sweeps which permanently remove expired changes
+// from the in-memory and Redis storage to the given daily windows, formatted as
+// time of day ranges in UTC such as "01:00-05:00". Changes which expire outside
+// the windows are removed once a window opens. If unset, sweeps run at any time.
+func WithSweepWindows(windows []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.sweepWindows = windows
+	}
+}
+
+// WithDisableSweep disables the sweeps which permanently remove expired changes
+// from the in-memory and Redis storage, for deployments where an external process,
+// such as a TTL in the database or a cron job, removes them instead. Deleted
+// records are still recorded, but never permanently removed by the databroker.
+func WithDisableSweep(disabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.disableSweep = disabled
+	}
+}
+
+// WithImmediateDelete causes deleted records of the given type to be removed
+// immediately, rather than soft-deleted. The record data is permanently removed
+// from storage, including from the change log, and only the deletion is synced.
+// It may be given more than once.
+func WithImmediateDelete(recordType string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.immediateDeleteTypes = append(cfg.immediateDeleteTypes, recordType)
+	}
+}
+
+// WithDeletedRecordGracePeriod sets how long deleted records keep being returned by
+// GetAll, flagged as deleted, so that consumers can reconcile the deletion. 0
+// disables the grace period.
+func WithDeletedRecordGracePeriod(gracePeriod time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.deletedGracePeriod = gracePeriod
+	}
+}
+
+// WithEncryptedFields encrypts only the given fields of records of the given type
+// in storage, rather than the whole record, so that the other fields remain
+// readable by the storage. Fields are dot-separated paths of protobuf field names
+// and must be string or bytes fields. It may be given more than once.
+func WithEncryptedFields(recordType string, paths []string) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.encryptedFields == nil {
+			cfg.encryptedFields = make(map[string][]string)
+		}
+		cfg.encryptedFields[recordType] = paths
+	}
+}
+
+// WithEncryptionKeyForType encrypts the records of the given type in storage with
+// a key derived from the given base64-encoded 32-byte key, rather than the shared
+// key. Records of other types are encrypted with the shared key. To rotate the key
+// of a type, give it again with the new key: the last key given for a type is
+// used to encrypt, while the earlier ones are kept to decrypt the records written
+// with them. Keys for types are ignored if encrypted fields are set.
+func WithEncryptionKeyForType(recordType, key string) ServerOption {
+	return func(cfg *serverConfig) {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(decoded) != cryptutil.DefaultKeySize {
+			log.Error().Err(err).Str("type", recordType).
+				Msgf("encryption key for type must be %d bytes long, using the shared key instead", cryptutil.DefaultKeySize)
+			return
+		}
+		if cfg.typeEncryptionKeys == nil {
+			cfg.typeEncryptionKeys = make(map[string][][]byte)
+		}
+		cfg.typeEncryptionKeys[recordType] = append(cfg.typeEncryptionKeys[recordType], decoded)
+	}
+}
+
+// WithRecordQuota limits the number of records of the given type. Puts which would
+// create a new record beyond the quota are rejected, but existing records can
+// still be updated or deleted. It may be given more than once.
+func WithRecordQuota(recordType string, max int) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.recordQuotas == nil {
+			cfg.recordQuotas = make(map[string]int)
+		}
+		cfg.recordQuotas[recordType] = max
+	}
+}
+
+// WithCacheableType hints to clients that Get responses for records of the given
+// type may be cached for up to the ttl, or until the record expires if sooner, in
+// the x-pomerium-cache-control trailing metadata. Responses for other types are
+// hinted as not cacheable once any type is cacheable. Clients which cache should
+// still invalidate their copies from Sync. It may be given more than once.
+func WithCacheableType(recordType string, ttl time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.cacheTTLs == nil {
+			cfg.cacheTTLs = make(map[string]time.Duration)
+		}
+		cfg.cacheTTLs[recordType] = ttl
+	}
+}
+
+// WithRecordValidator registers a validator for the records of the given type.
+// Puts of records which the validator rejects fail with InvalidArgument. It may be
+// given more than once.
+func WithRecordValidator(recordType string, validator RecordValidator) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.recordValidators == nil {
+			cfg.recordValidators = make(map[string]RecordValidator)
+		}
+		cfg.recordValidators[recordType] = validator
+	}
+}
+
+// WithLoader registers a loader for the records of the given type, which makes the
+// databroker a read-through cache for an external source of truth: a Get which
+// misses in the storage loads the record, and caches it in-process for the loader
+// ttl. Concurrent misses for the same record share a single load. Loaded records
+// aren't written to the storage, so they aren't synced.
+func WithLoader(recordType string, loader RecordLoader) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.loaders == nil {
+			cfg.loaders = make(map[string]RecordLoader)
+		}
+		cfg.loaders[recordType] = loader
+	}
+}
+
+// WithLoaderTTL sets how long records loaded by a loader set with WithLoader are
+// cached for. 0 disables caching, though concurrent misses are still coalesced.
+func WithLoaderTTL(ttl time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.loaderTTL = ttl
+	}
+}
+
+// WithDeleteStrategy registers a delete strategy for the records of the given type,
+// which is applied before a record of the type is deleted, to cascade the delete to
+// the records which reference it or veto it. Vetoed deletes fail with
+// FailedPrecondition. It may be given more than once, in which case the strategies
+// are applied in order.
+func WithDeleteStrategy(recordType string, strategy storage.DeleteStrategy) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.deleteStrategies == nil {
+			cfg.deleteStrategies = make(map[string][]storage.DeleteStrategy)
+		}
+		cfg.deleteStrategies[recordType] = append(cfg.deleteStrategies[recordType], strategy)
+	}
+}
+
+// WithCleanupReserve sets the amount of time reserved before a request's deadline
+// for rolling back a cascaded delete which fails part way. A cascade isn't started,
+// or is stopped and rolled back, once no more than that is left, and fails with
+// DeadlineExceeded, so that records aren't left partially deleted. 0 disables the
+// reserve.
+func WithCleanupReserve(reserve time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.cleanupReserve = reserve
+	}
+}
+
+// WithLastWriteTimestampMetrics sets whether the time of the latest write of each
+// record type is reported in the databroker_last_write_timestamp_seconds metric,
+// for alerting when a type stops being written. To bound cardinality, record types
+// other than the built-in record types and those set by
+// WithStorageKnownRecordTypes are reported as "other".
+func WithLastWriteTimestampMetrics(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.lastWriteMetrics = enabled
+	}
+}
+
+// WithRecordSigning sets whether the records written to storage are signed, and
+// the records read from it verified, so that records modified in storage by
+// anything but the databroker are rejected. Records are signed with an HMAC keyed
+// by the shared key, unless a signer is set by WithRecordSigner.
+func WithRecordSigning(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.recordSigning = enabled
+	}
+}
+
+// WithRecordSigningAcceptUnsigned sets whether records without a signature are
+// accepted when record signing is enabled, such as while the records written
+// before it was enabled are rewritten. It defaults to false, since unsigned
+// records would otherwise bypass verification.
+func WithRecordSigningAcceptUnsigned(accept bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.recordSigningAcceptUnsigned = accept
+	}
+}
+
+// WithRecordSigner enables record signing with the given signer, such as one
+// backed by an HSM, rather than the shared key. Records are verified with the
+// verifier of the algorithm and key id of their signature among the given
+// verifiers, the signer, if it's also a verifier, and the shared keys, so that
+// records signed before a change of signer are still accepted.
+func WithRecordSigner(signer storage.Signer, verifiers ...storage.Verifier) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.recordSigning = true
+		cfg.recordSigner = signer
+		cfg.recordVerifiers = verifiers
+	}
+}
+
+// WithReportReplicaLag sets whether SyncLatest streams report the latest record
+// version of the primary, and how far the records lag behind it, when the storage
+// may read from a replica. Clients can use it to retry against the primary.
+func WithReportReplicaLag(report bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.reportReplicaLag = report
+	}
+}
+
+// WithReadYourWritesTimeout sets the maximum time a read with the consistency
+// token of a write waits for the storage, such as a lagging replica, to catch up
+// with the write. Reads which time out fail with Unavailable.
+func WithReadYourWritesTimeout(timeout time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.readYourWritesTimeout = timeout
+	}
+}
+
+// WithWebhookURL adds a URL to which record changes are POSTed as JSON events
+// with the type, id, version and operation of the record. If a shared key is set,
+// each event is signed with an HMAC of its body, keyed by the shared key, in the
+// X-Pomerium-Signature header. Deliveries are retried with backoff, and never delay writes.
+func WithWebhookURL(rawURL string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.webhookURLs = append(cfg.webhookURLs, rawURL)
+	}
+}
+
+// WithWebhookIncludePayload sets whether webhook events include the data of the
+// record, as JSON. The data is sent decrypted, even with an encrypted storage.
+func WithWebhookIncludePayload(include bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.webhookIncludePayload = include
+	}
+}
+
+// WithWebhookSerialization sets the serialization of the webhook events: JSON
+// events, or CloudEvents JSON events which are POSTed in the structured mode.
+// The protobuf serialization isn't supported for webhooks.
+func WithWebhookSerialization(serialization ChangeSerialization) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.webhookSerialization = serialization
+	}
+}
+
+// WithWebhookBufferSize sets the maximum number of record changes buffered for
+// each webhook URL. Changes are dropped for a URL while its buffer is full.
+func WithWebhookBufferSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.webhookBufferSize = size
+	}
+}
+
+// WithWebhookMaxAttempts sets the number of times the delivery of a record change
+// to a webhook URL is attempted before it's given up on.
+func WithWebhookMaxAttempts(attempts int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.webhookMaxAttempts = attempts
+	}
+}
+
+// WithOnSyncVersionGap sets how Sync streams are handled when the changes after
+// the client's record version are no longer available.
+func WithOnSyncVersionGap(policy SyncVersionGapPolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onSyncVersionGap = policy
+	}
+}
+
+// WithDrainTimeout sets the maximum amount of time to wait for in-flight writes
+// to complete when the server is drained.
+func WithDrainTimeout(timeout time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.drainTimeout = timeout
+	}
+}
+
+// WithOnSyncDrain sets how open Sync streams are closed when the server is drained.
+func WithOnSyncDrain(policy SyncDrainPolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onSyncDrain = policy
+	}
+}
+
+// WithSyncDrainFlushTimeout sets the maximum amount of time Sync streams spend
+// flushing pending changes when the server is drained, under the flush policy.
+// Streams still flushing after it are closed.
+func WithSyncDrainFlushTimeout(timeout time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncDrainFlushTimeout = timeout
+	}
+}
+
 // WithGetAllPageSize sets the page size for GetAll calls.
 func WithGetAllPageSize(pageSize int) ServerOption {
 	return func(cfg *serverConfig) {
@@ -61,6 +785,315 @@ func WithGetAllPageSize(pageSize int) ServerOption {
 	}
 }
 
+// WithGetAllPageSizeForType sets the page size for GetAll calls for the given
+// record type, overriding the page size set by WithGetAllPageSize. It may be given
+// more than once.
+func WithGetAllPageSizeForType(recordType string, pageSize int) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.getAllPageSizeByType == nil {
+			cfg.getAllPageSizeByType = make(map[string]int)
+		}
+		cfg.getAllPageSizeByType[recordType] = pageSize
+	}
+}
+
+// WithGetAllMaxPageSize sets the maximum page size a client may request for
+// GetAll calls.
+func WithGetAllMaxPageSize(pageSize int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.getAllMaxPageSize = pageSize
+	}
+}
+
+// WithGetAllMaxResults sets the maximum number of records returned by a GetAll
+// call. Streams with more records are truncated, and end with a cursor which
+// continues them. 0 means unlimited.
+func WithGetAllMaxResults(maxResults int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.getAllMaxResults = maxResults
+	}
+}
+
+// WithMaxSyncStreams sets the maximum number of concurrent Sync streams. New
+// streams beyond the limit are rejected with ResourceExhausted. 0 means unlimited.
+func WithMaxSyncStreams(maxSyncStreams int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxSyncStreams = maxSyncStreams
+	}
+}
+
+// WithMaxRecvMsgSize sets the maximum size in bytes of messages the gRPC server can
+// receive. 0 uses the gRPC default of 4MB.
+func WithMaxRecvMsgSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxRecvMsgSize = size
+	}
+}
+
+// WithMaxSendMsgSize sets the maximum size in bytes of messages the gRPC server can
+// send. Query responses are truncated to fit, and SyncLatest handles records which
+// don't fit as set by WithOnOversizedPage. 0 uses the gRPC default.
+func WithMaxSendMsgSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxSendMsgSize = size
+	}
+}
+
+// WithSyncKeepalive sets the interval at which heartbeats are sent on idle Sync
+// streams. A heartbeat is a SyncResponse without a record, so it's only sent to
+// clients which set accept_heartbeats on the SyncRequest. 0 disables heartbeats.
+func WithSyncKeepalive(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncKeepalive = interval
+	}
+}
+
+// WithSyncCompression sets the compression codecs the server may use for records
+// sent on Sync streams, in order of preference. The first codec also advertised by
+// the client is used. Clients which don't advertise any of them receive
+// uncompressed records. If unset, records are never compressed.
+func WithSyncCompression(codecs []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncCompression = codecs
+	}
+}
+
+// WithSyncConcurrency sets the maximum number of concurrent writes for a single
+// logical sync operation, as tagged by the sync operation request metadata. Excess
+// writes are queued. 0 means unlimited.
+func WithSyncConcurrency(concurrency int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncConcurrency = concurrency
+	}
+}
+
+// WithIDGenerator sets the function which mints the ids of records put without
+// one. If unset, ids are random (version 4) UUIDs. Minted ids that are already in
+// use are skipped, so the generator needn't be globally unique.
+func WithIDGenerator(generator func() string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.idGenerator = generator
+	}
+}
+
+// WithSyncSendConcurrency sets the maximum number of records being sent on Sync
+// streams at once. When set, the sends are shared between the streams in
+// proportion to their weights, so that streams with many records to send can't
+// starve the others. 0 means unlimited, and sends aren't scheduled.
+func WithSyncSendConcurrency(concurrency int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncSendConcurrency = concurrency
+	}
+}
+
+// WithSyncPauseBufferSize sets the maximum number of changes buffered for a Sync
+// stream paused with PauseSync. Once the buffer is full, the changes remain in the
+// storage backend's change log until the stream is resumed.
+func WithSyncPauseBufferSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.syncPauseBufferSize = size
+	}
+}
+
+// WithMaxNotificationBufferBytes bounds the total size of the changes buffered for
+// all the paused Sync streams. Once it's reached, the slowest streams, those with
+// the most buffered, are shed first: their buffers are released and they end with a
+// ResourceExhausted error, so that their clients sync the changes from the change
+// log again. 0 means unlimited.
+func WithMaxNotificationBufferBytes(maxBytes int64) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxNotificationBufferBytes = maxBytes
+	}
+}
+
+// WithSyncWeight sets the scheduling weight of Sync streams from the given client
+// service, as given by the service sync label. A stream with twice the weight gets
+// twice the share of the sends. Streams default to a weight of 1. It may be given
+// more than once.
+func WithSyncWeight(service string, weight int) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.syncWeights == nil {
+			cfg.syncWeights = make(map[string]int)
+		}
+		cfg.syncWeights[service] = weight
+	}
+}
+
+// WithAcceptedSchemaVersions sets the record schema versions accepted by Put. Records
+// with any other schema version are rejected. If unset, all schema versions are accepted.
+func WithAcceptedSchemaVersions(versions []int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.acceptedSchemaVersions = versions
+	}
+}
+
+// WithMinProtocolVersion sets the minimum sync protocol version clients must
+// advertise to open SyncLatest and Sync streams. Older clients, and clients which
+// don't advertise a version, are rejected and told to upgrade. 0 accepts all
+// clients.
+func WithMinProtocolVersion(version int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.minProtocolVersion = version
+	}
+}
+
+// WithRequireExpiry checks that records of the given type written with Put or
+// ReplaceAll have an expiry, in their top-level `expires_at` field. Records without
+// one are counted by the databroker_records_without_expiry_total metric, and are
+// rejected in strict mode. It may be given more than once.
+func WithRequireExpiry(recordType string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.requireExpiryTypes = append(cfg.requireExpiryTypes, recordType)
+	}
+}
+
+// WithRequireExpiryStrict rejects records without an expiry for the types given
+// with WithRequireExpiry, rather than only counting them.
+func WithRequireExpiryStrict(strict bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.requireExpiryStrict = strict
+	}
+}
+
+// WithDedupeIdenticalPuts enables skipping Puts whose data is byte-identical to
+// the current record. The existing record and version are returned instead, and
+// no change is sent to sync streams.
+func WithDedupeIdenticalPuts(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.dedupeIdenticalPuts = enabled
+	}
+}
+
+// WithQueueDepthMetrics enables metrics for the depth of internal queues.
+func WithQueueDepthMetrics(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.queueDepthMetrics = enabled
+	}
+}
+
+// WithConfigInfoMetric enables the databroker_config_info metric, which exposes
+// the key values of the effective config as labels.
+func WithConfigInfoMetric(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.configInfoMetric = enabled
+	}
+}
+
+// WithReadCacheSize sets the number of records to cache in-process in front of
+// storage. 0 disables the cache.
+func WithReadCacheSize(size int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.readCacheSize = size
+	}
+}
+
+// WithReadCacheTTL sets the maximum age of read cache entries, after which they
+// are refetched even if no change was observed. 0 disables expiry.
+func WithReadCacheTTL(ttl time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.readCacheTTL = ttl
+	}
+}
+
+// WithServeStaleOnError serves the last cached value of a record from the read
+// cache when reading it from storage fails, rather than failing the read. Such
+// responses are flagged as stale. This trades consistency for availability while
+// storage is unreachable, and only applies when the read cache is enabled.
+func WithServeStaleOnError(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.serveStaleOnError = enabled
+	}
+}
+
+// WithExpiryScanEnabled enables a background scan which deletes records whose
+// embedded expiry timestamp has passed. It is intended for storage backends
+// without native per-record expiry.
+func WithExpiryScanEnabled(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.expiryScanEnabled = enabled
+	}
+}
+
+// WithExpirySkewTolerance sets how long after their expiry records are deleted by
+// the expiry scan, to tolerate clock skew between nodes, so that a record isn't
+// deleted prematurely by a node whose clock is ahead.
+func WithExpirySkewTolerance(tolerance time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.expirySkewTolerance = tolerance
+	}
+}
+
+// WithExpiryScanInterval sets the interval between scans for expired records.
+func WithExpiryScanInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.expiryScanInterval = interval
+	}
+}
+
+// WithRetentionPolicy adds a retention policy for the records of the given type,
+// which is applied in the background. It may be given more than once, in which
+// case the policies of a type are composed and a record is reclaimed by whichever
+// triggers first.
+func WithRetentionPolicy(recordType string, policy storage.RetentionPolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.retentionPolicies == nil {
+			cfg.retentionPolicies = make(map[string][]storage.RetentionPolicy)
+		}
+		cfg.retentionPolicies[recordType] = append(cfg.retentionPolicies[recordType], policy)
+	}
+}
+
+// WithMaxVersionsPerRecord keeps at most the given number of versions of each
+// record, of every type, pruning the oldest previous versions from the change log
+// at the retention interval. 0 keeps every version.
+func WithMaxVersionsPerRecord(max int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxVersionsPerRecord = max
+	}
+}
+
+// WithRetentionInterval sets the interval between applications of the retention
+// policies.
+func WithRetentionInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.retentionInterval = interval
+	}
+}
+
+// WithRecordAgeSampleInterval sets the interval at which the age of every stored
+// record is sampled for the databroker_record_age_seconds metric. 0 disables
+// sampling.
+func WithRecordAgeSampleInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.recordAgeSampleInterval = interval
+	}
+}
+
+// WithNegativeCacheTTL sets how long not-found results are cached for. Cached
+// results are invalidated as soon as the record is written. 0 disables the cache.
+func WithNegativeCacheTTL(ttl time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.negativeCacheTTL = ttl
+	}
+}
+
+// WithStorageWarmup enables warming up the storage backend on startup. Connections
+// are opened before any requests are served, and the records of the types given
+// to WithStorageWarmupRecordTypes are prefetched into the read cache.
+func WithStorageWarmup(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageWarmup = enabled
+	}
+}
+
+// WithStorageWarmupRecordTypes sets the record types to prefetch into the read
+// cache when the storage warmup is enabled.
+func WithStorageWarmupRecordTypes(recordTypes []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageWarmupRecordTypes = recordTypes
+	}
+}
+
 // WithInstallationID sets the installation id in the config.
 func WithInstallationID(installationID string) ServerOption {
 	return func(cfg *serverConfig) {
@@ -68,15 +1101,113 @@ func WithInstallationID(installationID string) ServerOption {
 	}
 }
 
-// WithSharedKey sets the secret in the config.
+// WithInstallationQuota limits the requests of the installation with the given
+// id, as identified by the x-pomerium-installation-id request metadata. Requests
+// beyond the quota are rejected with ResourceExhausted. If the id is empty, the
+// quota applies to each installation without its own quota, and to requests
+// without an installation id. It may be given more than once. Since the quotas
+// are enforced by gRPC interceptors, changes require a restart.
+func WithInstallationQuota(installationID string, quota InstallationQuota) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.installationQuotas == nil {
+			cfg.installationQuotas = make(map[string]InstallationQuota)
+		}
+		cfg.installationQuotas[installationID] = quota
+	}
+}
+
+// WithListenAddress sets the address the server is listening on. It is only used
+// for diagnostics.
+func WithListenAddress(addr string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.listenAddress = addr
+	}
+}
+
+// WithSharedKey sets the secret in the config. If the shared key is invalid the
+// server enters a safe mode in which all writes are rejected.
 func WithSharedKey(sharedKey string) ServerOption {
 	return func(cfg *serverConfig) {
 		key, err := base64.StdEncoding.DecodeString(sharedKey)
 		if err != nil || len(key) != cryptutil.DefaultKeySize {
 			log.Error().Err(err).Msgf("shared key is required and must be %d bytes long", cryptutil.DefaultKeySize)
+			cfg.secret = nil
+			cfg.invalidSharedKey = true
 			return
 		}
 		cfg.secret = key
+		cfg.invalidSharedKey = false
+	}
+}
+
+// WithPreviousSharedKeys sets base64-encoded 32-byte keys which were previously
+// the shared key. They're only used to verify and decrypt the records written
+// with them, so that records written before the shared key was changed can still
+// be read. Records are always written with the shared key, and read with it first
+// and then each of the previous keys in order. Invalid keys are logged, by their
+// index, and ignored.
+func WithPreviousSharedKeys(keys []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.previousSecrets = nil
+		for i, key := range keys {
+			decoded, err := base64.StdEncoding.DecodeString(key)
+			if err != nil || len(decoded) != cryptutil.DefaultKeySize {
+				log.Error().Err(err).Int("index", i).
+					Msgf("previous shared key must be %d bytes long, ignoring it", cryptutil.DefaultKeySize)
+				continue
+			}
+			cfg.previousSecrets = append(cfg.previousSecrets, decoded)
+		}
+	}
+}
+
+// WithOnSharedKeyChange sets how a change of the shared key is handled while the
+// server is running.
+func WithOnSharedKeyChange(policy SharedKeyChangePolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onSharedKeyChange = policy
+	}
+}
+
+// WithOnStorageInitFailure sets how the server handles a storage backend which
+// can't be reached when it's created.
+func WithOnStorageInitFailure(policy StorageInitFailurePolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onStorageInitFailure = policy
+	}
+}
+
+// WithOnOversizedPage sets how SyncLatest handles a page of records larger than
+// the maximum message size set by WithMaxSendMsgSize.
+func WithOnOversizedPage(policy OversizedPagePolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onOversizedPage = policy
+	}
+}
+
+// WithOnResync sets how the full re-syncs of SyncLatest are served. Requests with
+// a cursor or a consistency token are always served from the storage.
+func WithOnResync(policy ResyncPolicy) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.onResync = policy
+	}
+}
+
+// WithResyncConcurrency sets the maximum number of re-syncs served at once under
+// the coordinated re-sync policy. Excess re-syncs are queued. 0 means no limit.
+func WithResyncConcurrency(concurrency int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.resyncConcurrency = concurrency
+	}
+}
+
+// WithResyncSnapshotMaxAge sets how long the snapshot of the records is shared
+// between re-syncs under the coordinated re-sync policy. 0 only shares it between
+// re-syncs which overlap. Clients catch up from the snapshot's record version
+// with Sync, so an older snapshot is still consistent.
+func WithResyncSnapshotMaxAge(maxAge time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.resyncSnapshotMaxAge = maxAge
 	}
 }
 
@@ -87,6 +1218,40 @@ func WithStorageType(typ string) ServerOption {
 	}
 }
 
+// WithMemoryPersistPath sets a file the in-memory storage backend persists its
+// state to when the server is closed, and restores it from on startup.
+func WithMemoryPersistPath(path string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.memoryPersistPath = path
+	}
+}
+
+// WithMemoryPersistDurability sets how often the in-memory storage backend writes
+// its state to the persist path, which bounds the writes lost on a crash. The
+// default only writes it when the server is closed.
+func WithMemoryPersistDurability(durability inmemory.PersistDurability) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.memoryPersistDurability = durability
+	}
+}
+
+// WithMemoryPersistInterval sets the interval between writes of the in-memory
+// storage backend's state with periodic persist durability.
+func WithMemoryPersistInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.memoryPersistInterval = interval
+	}
+}
+
+// WithMemoryCompactOnStartup drops the expired changes of deleted records from the
+// in-memory storage backend when it's created, after its state is restored from
+// the persist path, rather than waiting for them to be swept.
+func WithMemoryCompactOnStartup(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.memoryCompactOnStartup = enabled
+	}
+}
+
 // WithStorageConnectionString sets the DSN for storage.
 func WithStorageConnectionString(connStr string) ServerOption {
 	return func(cfg *serverConfig) {
@@ -94,6 +1259,42 @@ func WithStorageConnectionString(connStr string) ServerOption {
 	}
 }
 
+// WithStorageRoute stores the records of the given type in the given storage,
+// rather than the default storage. Routes with the same storage type and
+// connection string share a backend. It may be given more than once.
+func WithStorageRoute(recordType string, route StorageRoute) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.storageRoutes == nil {
+			cfg.storageRoutes = make(map[string]StorageRoute)
+		}
+		cfg.storageRoutes[recordType] = route
+	}
+}
+
+// WithStorageShard adds the given storage as a shard, by name, in place of the
+// default storage. Records are distributed across the shards by a consistent hash
+// of their type and id, on which the shards are placed by name, so adding or
+// removing a shard only moves about 1/N of the records. Records which move aren't
+// migrated. It may be given more than once.
+func WithStorageShard(name string, shard StorageRoute) ServerOption {
+	return func(cfg *serverConfig) {
+		if cfg.storageShards == nil {
+			cfg.storageShards = make(map[string]StorageRoute)
+		}
+		cfg.storageShards[name] = shard
+	}
+}
+
+// WithCriticalRecordType marks the records of the given type as critical, so that
+// the server isn't healthy while the storage route of the type is. The default
+// storage and the storage shards are always critical, while other storage routes
+// failing only degrade the server. It may be given more than once.
+func WithCriticalRecordType(recordType string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.criticalRecordTypes = append(cfg.criticalRecordTypes, recordType)
+	}
+}
+
 // WithStorageCAFile sets the CA file in the config.
 func WithStorageCAFile(filePath string) ServerOption {
 	return func(cfg *serverConfig) {
@@ -101,6 +1302,92 @@ func WithStorageCAFile(filePath string) ServerOption {
 	}
 }
 
+// WithStorageCAPEM sets PEM-encoded certificate authorities for storage, as an
+// alternative to a CA file. They are loaded in addition to any CA files.
+func WithStorageCAPEM(caPEM []byte) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCAPEM = caPEM
+	}
+}
+
+// WithStorageCredentialsFile sets the credentials file used to authenticate to
+// Firestore storage. If empty, Application Default Credentials are used.
+func WithStorageCredentialsFile(filePath string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCredentialsFile = filePath
+	}
+}
+
+// WithStorageUsername sets the username used to authenticate to Redis storage
+// with ACLs. It takes precedence over any username in the connection string.
+func WithStorageUsername(username string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageUsername = username
+	}
+}
+
+// WithStoragePasswordFile sets a file containing the password used to
+// authenticate to Redis storage. It takes precedence over any password in the
+// connection string. Trailing newlines are ignored.
+func WithStoragePasswordFile(filePath string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storagePasswordFile = filePath
+	}
+}
+
+// WithStorageCAFiles sets additional CA files in the config. Each path may be
+// a PEM file or a directory of PEM files. These are loaded in addition to the
+// file set by WithStorageCAFile.
+func WithStorageCAFiles(filePaths []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCAFiles = filePaths
+	}
+}
+
+// WithStorageTCPKeepAlive sets the TCP keepalive period for storage connections,
+// so that connections silently dropped by stateful firewalls are detected
+// promptly. 0 disables keepalives. If unset the storage client's default is used.
+func WithStorageTCPKeepAlive(period time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageTCPKeepAlive = &period
+	}
+}
+
+// WithStorageRecordTypeMetrics enables the record_type label on storage operation
+// metrics. To bound cardinality, record types other than the built-in record types
+// and those set by WithStorageKnownRecordTypes are reported as "other".
+func WithStorageRecordTypeMetrics(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageRecordTypeMetrics = enabled
+	}
+}
+
+// WithStorageKnownRecordTypes sets additional record types to report in the
+// record_type label on storage operation metrics.
+func WithStorageKnownRecordTypes(recordTypes []string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageKnownRecordTypes = recordTypes
+	}
+}
+
+// WithStrictRecordTypes rejects Get and GetAll calls for record types other than
+// the built-in record types and those set with WithStorageKnownRecordTypes, with
+// InvalidArgument, rather than returning no records.
+func WithStrictRecordTypes(strict bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.strictRecordTypes = strict
+	}
+}
+
+// WithGloballyUniqueIDs rejects Puts of a record whose id is already used by a
+// record of a different type, with AlreadyExists. By default each record type has
+// its own namespace of ids.
+func WithGloballyUniqueIDs(enabled bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.globallyUniqueIDs = enabled
+	}
+}
+
 // WithStorageCertSkipVerify sets the storageCertSkipVerify in the config.
 func WithStorageCertSkipVerify(storageCertSkipVerify bool) ServerOption {
 	return func(cfg *serverConfig) {
@@ -114,3 +1401,190 @@ func WithStorageCertificate(certificate *tls.Certificate) ServerOption {
 		cfg.storageCertificate = certificate
 	}
 }
+
+// WithStorageCertificatePEM sets the storage client certificate from PEM-encoded
+// certificate and key bytes. It takes precedence over WithStorageCertificate.
+func WithStorageCertificatePEM(certPEM, keyPEM []byte) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCertificatePEM = certPEM
+		cfg.storageKeyPEM = keyPEM
+	}
+}
+
+// WithStorageCertificateFiles sets the storage client certificate from the given
+// certificate and key files. The files are watched for changes, so that new
+// storage connections present the current certificate after it's rotated. It
+// takes precedence over WithStorageCertificate, but not WithStorageCertificatePEM.
+func WithStorageCertificateFiles(certFile, keyFile string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCertificateFile = certFile
+		cfg.storageKeyFile = keyFile
+	}
+}
+
+// WithStorageCertificateReloadInterval sets the minimum interval between checks of
+// the storage client certificate files for changes. The files are checked when a
+// new storage connection is made. Zero checks them on every connection.
+func WithStorageCertificateReloadInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCertReloadInterval = interval
+	}
+}
+
+// WithStorageKeyPrefix namespaces the keys of the redis storage, so that
+// multiple installations sharing a redis server are isolated from each other.
+// The records, changes and version change notifications of each prefix are
+// separate. Firestore collections are namespaced by the connection string
+// instead.
+func WithStorageKeyPrefix(prefix string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageKeyPrefix = prefix
+	}
+}
+
+// WithStorageChangeCompression compresses the records stored in the change log of
+// the redis storage with the given codec. Changes stored while it was enabled are
+// still read once it's disabled.
+func WithStorageChangeCompression(codec string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageChangeCompression = codec
+	}
+}
+
+// WithStoragePoolSize sets the maximum number of storage connections. It takes
+// precedence over any pool size set in the connection string.
+//
+// There is no SQL backend with a database/sql pool to tune: the redis client pool
+// is bounded by this option, and its connection lifetime is set by the
+// max_conn_age connection string param.
+func WithStoragePoolSize(poolSize int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storagePoolSize = poolSize
+	}
+}
+
+// WithStorageMinIdleConns sets the minimum number of idle storage connections. It
+// takes precedence over any minimum set in the connection string.
+func WithStorageMinIdleConns(minIdleConns int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageMinIdleConns = minIdleConns
+	}
+}
+
+// WithStorageDialTimeout sets the timeout for establishing storage connections. It
+// takes precedence over any timeout set in the connection string.
+func WithStorageDialTimeout(dialTimeout time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageDialTimeout = dialTimeout
+	}
+}
+
+// WithStorageStatementTimeout sets the maximum duration of each Redis or Firestore
+// storage operation, independently of the request deadline. Operations which run
+// longer are cancelled and fail with storage.ErrStatementTimeout. 0 disables the
+// timeout.
+func WithStorageStatementTimeout(timeout time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageStatementTimeout = timeout
+	}
+}
+
+// WithMaxConcurrentStorageOps limits the number of storage operations in flight at
+// once. Operations beyond the limit wait for a free slot. 0 is unlimited.
+func WithMaxConcurrentStorageOps(max int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.maxConcurrentStorageOps = max
+	}
+}
+
+// WithStorageWatchdogThreshold recycles the connection to the storage after the
+// given number of consecutive operations time out, such as by exceeding the
+// statement timeout. This recovers from connections which get stuck without being
+// closed. 0 disables the watchdog.
+func WithStorageWatchdogThreshold(threshold int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageWatchdogThreshold = threshold
+	}
+}
+
+// WithSlowOperationThreshold logs the storage operations which take longer than
+// the given duration, with the operation, record type and duration, to find
+// pathological queries. 0 disables the log.
+func WithSlowOperationThreshold(threshold time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.slowOperationThreshold = threshold
+	}
+}
+
+// WithSlowOperationSampleRate sets the fraction of the slow storage operations
+// which are logged, between 0 and 1. 0 disables the log.
+func WithSlowOperationSampleRate(rate float64) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.slowOperationSampleRate = rate
+	}
+}
+
+// WithStorageDNSRefreshInterval sets the interval at which the storage endpoint
+// hostnames are re-resolved. Connections to IPs which have been removed are closed.
+// 0 disables refreshes.
+func WithStorageDNSRefreshInterval(interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageDNSRefreshInterval = interval
+	}
+}
+
+// storagePassword returns the password read from the storage password file, if
+// set.
+func (cfg *serverConfig) storagePassword() (string, error) {
+	if cfg.storagePasswordFile == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(cfg.storagePasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read databroker storage password file: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// requiresExpiry returns true if records of the given type must have an expiry.
+func (cfg *serverConfig) requiresExpiry(recordType string) bool {
+	for _, t := range cfg.requireExpiryTypes {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+// isCriticalBackend returns true if the server isn't healthy while the storage
+// backend isn't: the default storage, a storage shard, or the storage route of a
+// critical record type.
+func (cfg *serverConfig) isCriticalBackend(health storage.BackendHealth) bool {
+	if health.Default || len(health.RecordTypes) == 0 {
+		return true
+	}
+	for _, recordType := range health.RecordTypes {
+		for _, t := range cfg.criticalRecordTypes {
+			if t == recordType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allRetentionPolicies returns the retention policies by record type, including
+// the policy which applies the max versions per record to every type.
+func (cfg *serverConfig) allRetentionPolicies() map[string][]storage.RetentionPolicy {
+	if cfg.maxVersionsPerRecord <= 0 {
+		return cfg.retentionPolicies
+	}
+
+	policies := make(map[string][]storage.RetentionPolicy, len(cfg.retentionPolicies)+1)
+	for recordType, p := range cfg.retentionPolicies {
+		policies[recordType] = p
+	}
+	anyPolicies := append([]storage.RetentionPolicy{}, cfg.retentionPolicies[storage.AnyRecordType]...)
+	policies[storage.AnyRecordType] = append(anyPolicies, storage.NewMaxVersionsRetentionPolicy(cfg.maxVersionsPerRecord))
+	return policies
+}
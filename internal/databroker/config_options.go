@@ -0,0 +1,886 @@
+package databroker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// ServerConfigOptions is the full server configuration as a plain struct. It is an
+// alternative to passing the individual ServerOptions. Zero values leave the
+// corresponding setting at its default.
+type ServerConfigOptions struct {
+	InstallationID         string
+	InstallationQuotas     map[string]InstallationQuota
+	ListenAddress          string
+	DeletePermanentlyAfter time.Duration
+	// DeletePermanentlyAfterByType overrides DeletePermanentlyAfter for the records
+	// of each type. An override of 0 is kept, to delete the records right away.
+	DeletePermanentlyAfterByType map[string]time.Duration
+	MinimumRetention             *time.Duration // a pointer so that the minimum can be disabled with 0
+	SweepWindows                 []string
+	DisableSweep                 bool
+	ImmediateDeleteTypes         []string
+	DeletedRecordGracePeriod     time.Duration
+	OnSyncVersionGap             SyncVersionGapPolicy
+	RecordQuotas                 map[string]int
+	CacheableTypes               map[string]time.Duration
+	DedupeIdenticalPuts          bool
+	DrainTimeout                 time.Duration
+	OnSyncDrain                  SyncDrainPolicy
+	SyncDrainFlushTimeout        time.Duration
+	CleanupReserve               time.Duration
+	ReportReplicaLag             bool
+	LastWriteTimestampMetrics    bool
+	RecordSigning                bool
+	RecordSigningAcceptUnsigned  bool
+	ReadYourWritesTimeout        time.Duration
+	WebhookURLs                  []string
+	WebhookIncludePayload        bool
+	WebhookSerialization         ChangeSerialization
+	WebhookBufferSize            int
+	WebhookMaxAttempts           int
+	KafkaBrokers                 []string
+	KafkaTLS                     bool
+	KafkaTopic                   string
+	KafkaSerialization           ChangeSerialization
+	KafkaIncludePayload          bool
+	KafkaBufferSize              int
+	OnAuditBackpressure          AuditBackpressurePolicy
+	AuditBufferSize              int
+	SharedKey                    string
+	PreviousSharedKeys           []string
+	OnSharedKeyChange            SharedKeyChangePolicy
+	OnStorageInitFailure         StorageInitFailurePolicy
+	OnOversizedPage              OversizedPagePolicy
+	OnResync                     ResyncPolicy
+	ResyncConcurrency            int
+	ResyncSnapshotMaxAge         time.Duration
+	MaxNotificationBufferBytes   int64
+	EncryptedFields              map[string][]string
+	EncryptionKeysForTypes       map[string][]string
+	StorageType                  string
+	MemoryPersistPath            string
+	MemoryPersistDurability      inmemory.PersistDurability
+	MemoryPersistInterval        time.Duration
+	MemoryCompactOnStartup       bool
+	StorageConnectionString      string
+	StorageRoutes                map[string]StorageRoute
+	StorageShards                map[string]StorageRoute
+	CriticalRecordTypes          []string
+	StorageKeyPrefix             string
+	StorageChangeCompression     string
+	StorageCAFile                string
+	StorageCAFiles               []string
+	StorageCertSkipVerify        bool
+	StorageCertificate           *tls.Certificate
+	StorageCertificatePEM        []byte
+	StorageCertificateKeyPEM     []byte
+	StorageCertificateFile       string
+	StorageKeyFile               string
+	StorageCertReloadInterval    time.Duration
+	StorageCAPEM                 []byte
+	StorageCredentialsFile       string
+	StorageUsername              string
+	StoragePasswordFile          string
+	StoragePoolSize              int
+	StorageMinIdleConns          int
+	StorageDialTimeout           time.Duration
+	StorageStatementTimeout      time.Duration
+	StorageWatchdogThreshold     int
+	SlowOperationThreshold       time.Duration
+	SlowOperationSampleRate      float64
+	MaxConcurrentStorageOps      int
+	StorageDNSRefreshInterval    time.Duration
+	// StorageTCPKeepAlive is a pointer so that keepalives can be disabled with 0.
+	StorageTCPKeepAlive      *time.Duration
+	StorageRecordTypeMetrics bool
+	StorageKnownRecordTypes  []string
+	StrictRecordTypes        bool
+	GloballyUniqueIDs        bool
+	StorageWarmup            bool
+	StorageWarmupRecordTypes []string
+	GetAllPageSize           int
+	GetAllPageSizeByType     map[string]int
+	GetAllMaxPageSize        int
+	GetAllMaxResults         int
+	MaxSyncStreams           int
+	MaxRecvMsgSize           int
+	MaxSendMsgSize           int
+	SyncKeepalive            time.Duration
+	SyncCompression          []string
+	AcceptedSchemaVersions   []int
+	MinProtocolVersion       int
+	RequireExpiryTypes       []string
+	RequireExpiryStrict      bool
+	SyncConcurrency          int
+	SyncSendConcurrency      int
+	SyncPauseBufferSize      int
+	SyncWeights              map[string]int
+	QueueDepthMetrics        bool
+	ConfigInfoMetric         bool
+	ReadCacheSize            int
+	ReadCacheTTL             time.Duration
+	ServeStaleOnError        bool
+	NegativeCacheTTL         time.Duration
+	LoaderTTL                time.Duration
+	ExpiryScanEnabled        bool
+	ExpiryScanInterval       time.Duration
+	ExpirySkewTolerance      time.Duration
+	RecordAgeSampleInterval  time.Duration
+	// RetentionMaxVersions and RetentionMaxIdleAge are retention policies by
+	// record type. Both may be given for the same type.
+	RetentionMaxVersions map[string]int
+	RetentionMaxIdleAge  map[string]time.Duration
+	RetentionInterval    time.Duration
+	MaxVersionsPerRecord int
+}
+
+// NewServerConfigFromOptions validates the options and returns a ServerOption which
+// applies them. It is equivalent to applying each of the individual ServerOptions.
+// All validation errors are returned together.
+func NewServerConfigFromOptions(opts ServerConfigOptions) (ServerOption, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var options []ServerOption
+	add := func(option ServerOption) { options = append(options, option) }
+
+	if opts.InstallationID != "" {
+		add(WithInstallationID(opts.InstallationID))
+	}
+	for installationID, quota := range opts.InstallationQuotas {
+		add(WithInstallationQuota(installationID, quota))
+	}
+	if opts.ListenAddress != "" {
+		add(WithListenAddress(opts.ListenAddress))
+	}
+	if opts.DeletePermanentlyAfter != 0 {
+		add(WithDeletePermanentlyAfter(opts.DeletePermanentlyAfter))
+	}
+	for recordType, dur := range opts.DeletePermanentlyAfterByType {
+		add(WithDeletePermanentlyAfterForType(recordType, dur))
+	}
+	if opts.MinimumRetention != nil {
+		add(WithMinimumRetention(*opts.MinimumRetention))
+	}
+	if len(opts.SweepWindows) > 0 {
+		add(WithSweepWindows(opts.SweepWindows))
+	}
+	if opts.DisableSweep {
+		add(WithDisableSweep(opts.DisableSweep))
+	}
+	for _, recordType := range opts.ImmediateDeleteTypes {
+		add(WithImmediateDelete(recordType))
+	}
+	if opts.DeletedRecordGracePeriod != 0 {
+		add(WithDeletedRecordGracePeriod(opts.DeletedRecordGracePeriod))
+	}
+	for recordType, max := range opts.RecordQuotas {
+		add(WithRecordQuota(recordType, max))
+	}
+	for recordType, ttl := range opts.CacheableTypes {
+		add(WithCacheableType(recordType, ttl))
+	}
+	if opts.DedupeIdenticalPuts {
+		add(WithDedupeIdenticalPuts(opts.DedupeIdenticalPuts))
+	}
+	if opts.OnSyncVersionGap != SyncVersionGapResync {
+		add(WithOnSyncVersionGap(opts.OnSyncVersionGap))
+	}
+	if opts.DrainTimeout != 0 {
+		add(WithDrainTimeout(opts.DrainTimeout))
+	}
+	if opts.OnSyncDrain != SyncDrainClose {
+		add(WithOnSyncDrain(opts.OnSyncDrain))
+	}
+	if opts.SyncDrainFlushTimeout != 0 {
+		add(WithSyncDrainFlushTimeout(opts.SyncDrainFlushTimeout))
+	}
+	if opts.CleanupReserve != 0 {
+		add(WithCleanupReserve(opts.CleanupReserve))
+	}
+	if opts.ReportReplicaLag {
+		add(WithReportReplicaLag(opts.ReportReplicaLag))
+	}
+	if opts.LastWriteTimestampMetrics {
+		add(WithLastWriteTimestampMetrics(opts.LastWriteTimestampMetrics))
+	}
+	if opts.RecordSigning {
+		add(WithRecordSigning(opts.RecordSigning))
+	}
+	if opts.RecordSigningAcceptUnsigned {
+		add(WithRecordSigningAcceptUnsigned(opts.RecordSigningAcceptUnsigned))
+	}
+	if opts.ReadYourWritesTimeout != 0 {
+		add(WithReadYourWritesTimeout(opts.ReadYourWritesTimeout))
+	}
+	for _, rawURL := range opts.WebhookURLs {
+		add(WithWebhookURL(rawURL))
+	}
+	if opts.WebhookIncludePayload {
+		add(WithWebhookIncludePayload(opts.WebhookIncludePayload))
+	}
+	if opts.WebhookSerialization != ChangeSerializationJSON {
+		add(WithWebhookSerialization(opts.WebhookSerialization))
+	}
+	if opts.WebhookBufferSize != 0 {
+		add(WithWebhookBufferSize(opts.WebhookBufferSize))
+	}
+	if opts.WebhookMaxAttempts != 0 {
+		add(WithWebhookMaxAttempts(opts.WebhookMaxAttempts))
+	}
+	if len(opts.KafkaBrokers) > 0 {
+		add(WithKafkaSink(nil, KafkaSink{
+			Brokers:        opts.KafkaBrokers,
+			TLS:            opts.KafkaTLS,
+			Topic:          opts.KafkaTopic,
+			Serialization:  opts.KafkaSerialization,
+			BufferSize:     opts.KafkaBufferSize,
+			IncludePayload: opts.KafkaIncludePayload,
+		}))
+	}
+	if opts.OnAuditBackpressure != AuditBackpressureDrop {
+		add(WithOnAuditBackpressure(opts.OnAuditBackpressure))
+	}
+	if opts.AuditBufferSize != 0 {
+		add(WithAuditBufferSize(opts.AuditBufferSize))
+	}
+	if opts.SharedKey != "" {
+		add(WithSharedKey(opts.SharedKey))
+	}
+	if len(opts.PreviousSharedKeys) > 0 {
+		add(WithPreviousSharedKeys(opts.PreviousSharedKeys))
+	}
+	if opts.OnSharedKeyChange != SharedKeyChangeRecreate {
+		add(WithOnSharedKeyChange(opts.OnSharedKeyChange))
+	}
+	if opts.OnStorageInitFailure != StorageInitFailureRetryOnRequest {
+		add(WithOnStorageInitFailure(opts.OnStorageInitFailure))
+	}
+	if opts.OnOversizedPage != OversizedPageSplit {
+		add(WithOnOversizedPage(opts.OnOversizedPage))
+	}
+	if opts.OnResync != ResyncIndependent {
+		add(WithOnResync(opts.OnResync))
+	}
+	if opts.ResyncConcurrency != 0 {
+		add(WithResyncConcurrency(opts.ResyncConcurrency))
+	}
+	if opts.ResyncSnapshotMaxAge != 0 {
+		add(WithResyncSnapshotMaxAge(opts.ResyncSnapshotMaxAge))
+	}
+	for recordType, keys := range opts.EncryptionKeysForTypes {
+		for _, key := range keys {
+			add(WithEncryptionKeyForType(recordType, key))
+		}
+	}
+	for recordType, paths := range opts.EncryptedFields {
+		add(WithEncryptedFields(recordType, paths))
+	}
+	if opts.StorageType != "" {
+		add(WithStorageType(opts.StorageType))
+	}
+	if opts.MemoryPersistPath != "" {
+		add(WithMemoryPersistPath(opts.MemoryPersistPath))
+	}
+	if opts.MemoryPersistDurability != inmemory.PersistOnShutdown {
+		add(WithMemoryPersistDurability(opts.MemoryPersistDurability))
+	}
+	if opts.MemoryPersistInterval != 0 {
+		add(WithMemoryPersistInterval(opts.MemoryPersistInterval))
+	}
+	if opts.MemoryCompactOnStartup {
+		add(WithMemoryCompactOnStartup(opts.MemoryCompactOnStartup))
+	}
+	if opts.StorageConnectionString != "" {
+		add(WithStorageConnectionString(opts.StorageConnectionString))
+	}
+	for recordType, route := range opts.StorageRoutes {
+		add(WithStorageRoute(recordType, route))
+	}
+	for name, shard := range opts.StorageShards {
+		add(WithStorageShard(name, shard))
+	}
+	for _, recordType := range opts.CriticalRecordTypes {
+		add(WithCriticalRecordType(recordType))
+	}
+	if opts.StorageKeyPrefix != "" {
+		add(WithStorageKeyPrefix(opts.StorageKeyPrefix))
+	}
+	if opts.StorageChangeCompression != "" {
+		add(WithStorageChangeCompression(opts.StorageChangeCompression))
+	}
+	if opts.StorageCAFile != "" {
+		add(WithStorageCAFile(opts.StorageCAFile))
+	}
+	if len(opts.StorageCAFiles) > 0 {
+		add(WithStorageCAFiles(opts.StorageCAFiles))
+	}
+	if opts.StorageCertSkipVerify {
+		add(WithStorageCertSkipVerify(opts.StorageCertSkipVerify))
+	}
+	if opts.StorageCredentialsFile != "" {
+		add(WithStorageCredentialsFile(opts.StorageCredentialsFile))
+	}
+	if opts.StorageUsername != "" {
+		add(WithStorageUsername(opts.StorageUsername))
+	}
+	if opts.StoragePasswordFile != "" {
+		add(WithStoragePasswordFile(opts.StoragePasswordFile))
+	}
+	if opts.StorageCertificate != nil {
+		add(WithStorageCertificate(opts.StorageCertificate))
+	}
+	if len(opts.StorageCertificatePEM) > 0 || len(opts.StorageCertificateKeyPEM) > 0 {
+		add(WithStorageCertificatePEM(opts.StorageCertificatePEM, opts.StorageCertificateKeyPEM))
+	}
+	if opts.StorageCertificateFile != "" || opts.StorageKeyFile != "" {
+		add(WithStorageCertificateFiles(opts.StorageCertificateFile, opts.StorageKeyFile))
+	}
+	if opts.StorageCertReloadInterval != 0 {
+		add(WithStorageCertificateReloadInterval(opts.StorageCertReloadInterval))
+	}
+	if len(opts.StorageCAPEM) > 0 {
+		add(WithStorageCAPEM(opts.StorageCAPEM))
+	}
+	if opts.StoragePoolSize != 0 {
+		add(WithStoragePoolSize(opts.StoragePoolSize))
+	}
+	if opts.StorageMinIdleConns != 0 {
+		add(WithStorageMinIdleConns(opts.StorageMinIdleConns))
+	}
+	if opts.StorageDialTimeout != 0 {
+		add(WithStorageDialTimeout(opts.StorageDialTimeout))
+	}
+	if opts.StorageStatementTimeout != 0 {
+		add(WithStorageStatementTimeout(opts.StorageStatementTimeout))
+	}
+	if opts.StorageWatchdogThreshold != 0 {
+		add(WithStorageWatchdogThreshold(opts.StorageWatchdogThreshold))
+	}
+	if opts.MaxConcurrentStorageOps != 0 {
+		add(WithMaxConcurrentStorageOps(opts.MaxConcurrentStorageOps))
+	}
+	if opts.SlowOperationThreshold != 0 {
+		add(WithSlowOperationThreshold(opts.SlowOperationThreshold))
+	}
+	if opts.SlowOperationSampleRate != 0 {
+		add(WithSlowOperationSampleRate(opts.SlowOperationSampleRate))
+	}
+	if opts.StorageDNSRefreshInterval != 0 {
+		add(WithStorageDNSRefreshInterval(opts.StorageDNSRefreshInterval))
+	}
+	if opts.StorageTCPKeepAlive != nil {
+		add(WithStorageTCPKeepAlive(*opts.StorageTCPKeepAlive))
+	}
+	if opts.StorageRecordTypeMetrics {
+		add(WithStorageRecordTypeMetrics(opts.StorageRecordTypeMetrics))
+	}
+	if len(opts.StorageKnownRecordTypes) > 0 {
+		add(WithStorageKnownRecordTypes(opts.StorageKnownRecordTypes))
+	}
+	if opts.StrictRecordTypes {
+		add(WithStrictRecordTypes(opts.StrictRecordTypes))
+	}
+	if opts.GloballyUniqueIDs {
+		add(WithGloballyUniqueIDs(opts.GloballyUniqueIDs))
+	}
+	if opts.StorageWarmup {
+		add(WithStorageWarmup(opts.StorageWarmup))
+	}
+	if len(opts.StorageWarmupRecordTypes) > 0 {
+		add(WithStorageWarmupRecordTypes(opts.StorageWarmupRecordTypes))
+	}
+	if opts.GetAllPageSize != 0 {
+		add(WithGetAllPageSize(opts.GetAllPageSize))
+	}
+	for recordType, pageSize := range opts.GetAllPageSizeByType {
+		add(WithGetAllPageSizeForType(recordType, pageSize))
+	}
+	if opts.GetAllMaxPageSize != 0 {
+		add(WithGetAllMaxPageSize(opts.GetAllMaxPageSize))
+	}
+	if opts.GetAllMaxResults != 0 {
+		add(WithGetAllMaxResults(opts.GetAllMaxResults))
+	}
+	if opts.MaxSyncStreams != 0 {
+		add(WithMaxSyncStreams(opts.MaxSyncStreams))
+	}
+	if opts.MaxRecvMsgSize != 0 {
+		add(WithMaxRecvMsgSize(opts.MaxRecvMsgSize))
+	}
+	if opts.MaxSendMsgSize != 0 {
+		add(WithMaxSendMsgSize(opts.MaxSendMsgSize))
+	}
+	if opts.SyncKeepalive != 0 {
+		add(WithSyncKeepalive(opts.SyncKeepalive))
+	}
+	if len(opts.SyncCompression) > 0 {
+		add(WithSyncCompression(opts.SyncCompression))
+	}
+	if len(opts.AcceptedSchemaVersions) > 0 {
+		add(WithAcceptedSchemaVersions(opts.AcceptedSchemaVersions))
+	}
+	if opts.MinProtocolVersion != 0 {
+		add(WithMinProtocolVersion(opts.MinProtocolVersion))
+	}
+	for _, recordType := range opts.RequireExpiryTypes {
+		add(WithRequireExpiry(recordType))
+	}
+	if opts.RequireExpiryStrict {
+		add(WithRequireExpiryStrict(opts.RequireExpiryStrict))
+	}
+	if opts.SyncConcurrency != 0 {
+		add(WithSyncConcurrency(opts.SyncConcurrency))
+	}
+	if opts.SyncSendConcurrency != 0 {
+		add(WithSyncSendConcurrency(opts.SyncSendConcurrency))
+	}
+	if opts.SyncPauseBufferSize != 0 {
+		add(WithSyncPauseBufferSize(opts.SyncPauseBufferSize))
+	}
+	if opts.MaxNotificationBufferBytes != 0 {
+		add(WithMaxNotificationBufferBytes(opts.MaxNotificationBufferBytes))
+	}
+	for service, weight := range opts.SyncWeights {
+		add(WithSyncWeight(service, weight))
+	}
+	if opts.QueueDepthMetrics {
+		add(WithQueueDepthMetrics(opts.QueueDepthMetrics))
+	}
+	if opts.ConfigInfoMetric {
+		add(WithConfigInfoMetric(opts.ConfigInfoMetric))
+	}
+	if opts.ReadCacheSize != 0 {
+		add(WithReadCacheSize(opts.ReadCacheSize))
+	}
+	if opts.ReadCacheTTL != 0 {
+		add(WithReadCacheTTL(opts.ReadCacheTTL))
+	}
+	if opts.ServeStaleOnError {
+		add(WithServeStaleOnError(opts.ServeStaleOnError))
+	}
+	if opts.NegativeCacheTTL != 0 {
+		add(WithNegativeCacheTTL(opts.NegativeCacheTTL))
+	}
+	if opts.LoaderTTL != 0 {
+		add(WithLoaderTTL(opts.LoaderTTL))
+	}
+	if opts.ExpiryScanEnabled {
+		add(WithExpiryScanEnabled(opts.ExpiryScanEnabled))
+	}
+	if opts.ExpiryScanInterval != 0 {
+		add(WithExpiryScanInterval(opts.ExpiryScanInterval))
+	}
+	if opts.ExpirySkewTolerance != 0 {
+		add(WithExpirySkewTolerance(opts.ExpirySkewTolerance))
+	}
+	if opts.RecordAgeSampleInterval != 0 {
+		add(WithRecordAgeSampleInterval(opts.RecordAgeSampleInterval))
+	}
+	for recordType, max := range opts.RetentionMaxVersions {
+		add(WithRetentionPolicy(recordType, storage.NewMaxVersionsRetentionPolicy(max)))
+	}
+	for recordType, maxIdleAge := range opts.RetentionMaxIdleAge {
+		add(WithRetentionPolicy(recordType, storage.NewMaxIdleAgeRetentionPolicy(maxIdleAge)))
+	}
+	if opts.MaxVersionsPerRecord != 0 {
+		add(WithMaxVersionsPerRecord(opts.MaxVersionsPerRecord))
+	}
+	if opts.RetentionInterval != 0 {
+		add(WithRetentionInterval(opts.RetentionInterval))
+	}
+
+	return func(cfg *serverConfig) {
+		for _, option := range options {
+			option(cfg)
+		}
+	}, nil
+}
+
+func (opts *ServerConfigOptions) validate() error {
+	var errs *multierror.Error
+	addf := func(format string, args ...interface{}) {
+		errs = multierror.Append(errs, fmt.Errorf(format, args...))
+	}
+
+	if opts.SharedKey != "" {
+		key, err := base64.StdEncoding.DecodeString(opts.SharedKey)
+		if err != nil || len(key) != cryptutil.DefaultKeySize {
+			addf("shared key must be a base64-encoded %d byte key", cryptutil.DefaultKeySize)
+		}
+	}
+	for _, previousKey := range opts.PreviousSharedKeys {
+		key, err := base64.StdEncoding.DecodeString(previousKey)
+		if err != nil || len(key) != cryptutil.DefaultKeySize {
+			addf("previous shared key must be a base64-encoded %d byte key", cryptutil.DefaultKeySize)
+		}
+	}
+	switch opts.StorageType {
+	case "", config.StorageInMemoryName, config.StorageRedisName, config.StorageFirestoreName:
+	default:
+		addf("unsupported storage type: %s", opts.StorageType)
+	}
+	if (opts.StorageType == config.StorageRedisName || opts.StorageType == config.StorageFirestoreName) &&
+		opts.StorageConnectionString == "" {
+		addf("storage connection string is required for storage type: %s", opts.StorageType)
+	}
+	routedRecordTypes := make([]string, 0, len(opts.StorageRoutes))
+	for recordType := range opts.StorageRoutes {
+		routedRecordTypes = append(routedRecordTypes, recordType)
+	}
+	sort.Strings(routedRecordTypes)
+	for _, recordType := range routedRecordTypes {
+		route := opts.StorageRoutes[recordType]
+		switch route.Type {
+		case config.StorageInMemoryName:
+		case config.StorageRedisName, config.StorageFirestoreName:
+			if route.ConnectionString == "" {
+				addf("storage connection string is required for the storage route of type %s", recordType)
+			}
+		default:
+			addf("unsupported storage type for the storage route of type %s: %s", recordType, route.Type)
+		}
+	}
+	for _, recordType := range opts.CriticalRecordTypes {
+		if _, ok := opts.StorageRoutes[recordType]; !ok {
+			addf("critical record type has no storage route: %s", recordType)
+		}
+	}
+	shardNames := make([]string, 0, len(opts.StorageShards))
+	for name := range opts.StorageShards {
+		shardNames = append(shardNames, name)
+	}
+	sort.Strings(shardNames)
+	for _, name := range shardNames {
+		shard := opts.StorageShards[name]
+		switch shard.Type {
+		case config.StorageInMemoryName:
+		case config.StorageRedisName, config.StorageFirestoreName:
+			if shard.ConnectionString == "" {
+				addf("storage connection string is required for storage shard %s", name)
+			}
+		default:
+			addf("unsupported storage type for storage shard %s: %s", name, shard.Type)
+		}
+		if first := opts.StorageShards[shardNames[0]]; shard.Type != first.Type {
+			addf("storage shards must have the same storage type: %s is %s, %s is %s",
+				shardNames[0], first.Type, name, shard.Type)
+		}
+	}
+	if len(opts.StorageShards) > 0 && len(opts.StorageRoutes) > 0 {
+		addf("storage routes can't be combined with storage shards")
+	}
+
+	if len(opts.StorageCertificatePEM) > 0 || len(opts.StorageCertificateKeyPEM) > 0 {
+		if _, err := tls.X509KeyPair(opts.StorageCertificatePEM, opts.StorageCertificateKeyPEM); err != nil {
+			addf("invalid storage certificate PEM: %v", err)
+		}
+	}
+	if strings.ContainsAny(opts.StorageKeyPrefix, "{}") {
+		addf("storage key prefix must not contain braces: %s", opts.StorageKeyPrefix)
+	}
+	if opts.StorageChangeCompression != "" && !databroker.IsSupportedCompression(opts.StorageChangeCompression) {
+		addf("unsupported storage change compression codec: %s", opts.StorageChangeCompression)
+	}
+	if (opts.StorageCertificateFile == "") != (opts.StorageKeyFile == "") {
+		addf("storage certificate file and key file must be set together")
+	}
+	if _, err := storage.ParseSweepWindows(opts.SweepWindows); err != nil {
+		addf("%v", err)
+	}
+	if opts.SlowOperationSampleRate < 0 || opts.SlowOperationSampleRate > 1 {
+		addf("slow operation sample rate must be between 0 and 1: %v", opts.SlowOperationSampleRate)
+	}
+	for _, rawURL := range opts.WebhookURLs {
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addf("invalid webhook url: %s", rawURL)
+		}
+	}
+	if len(opts.KafkaBrokers) > 0 && opts.KafkaTopic == "" {
+		addf("kafka topic is required with kafka brokers")
+	}
+	if len(opts.KafkaBrokers) == 0 && opts.KafkaTopic != "" {
+		addf("kafka brokers are required with a kafka topic")
+	}
+	if opts.MaxNotificationBufferBytes < 0 {
+		addf("max notification buffer bytes must not be negative: %d", opts.MaxNotificationBufferBytes)
+	}
+	if opts.StoragePoolSize > 0 && opts.StorageMinIdleConns > opts.StoragePoolSize {
+		addf("storage min idle conns must not exceed the storage pool size: %d > %d", opts.StorageMinIdleConns, opts.StoragePoolSize)
+	}
+	if len(opts.StorageCAPEM) > 0 && !x509.NewCertPool().AppendCertsFromPEM(opts.StorageCAPEM) {
+		addf("invalid storage CA PEM: no PEM-encoded certificates found")
+	}
+
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"storage pool size", opts.StoragePoolSize},
+		{"storage min idle conns", opts.StorageMinIdleConns},
+		{"get all page size", opts.GetAllPageSize},
+		{"get all max page size", opts.GetAllMaxPageSize},
+		{"get all max results", opts.GetAllMaxResults},
+		{"max sync streams", opts.MaxSyncStreams},
+		{"max recv msg size", opts.MaxRecvMsgSize},
+		{"max send msg size", opts.MaxSendMsgSize},
+		{"sync concurrency", opts.SyncConcurrency},
+		{"resync concurrency", opts.ResyncConcurrency},
+		{"storage watchdog threshold", opts.StorageWatchdogThreshold},
+		{"max concurrent storage ops", opts.MaxConcurrentStorageOps},
+		{"sync send concurrency", opts.SyncSendConcurrency},
+		{"sync pause buffer size", opts.SyncPauseBufferSize},
+		{"webhook buffer size", opts.WebhookBufferSize},
+		{"webhook max attempts", opts.WebhookMaxAttempts},
+		{"kafka buffer size", opts.KafkaBufferSize},
+		{"audit buffer size", opts.AuditBufferSize},
+		{"read cache size", opts.ReadCacheSize},
+		{"min protocol version", opts.MinProtocolVersion},
+		{"max versions per record", opts.MaxVersionsPerRecord},
+	} {
+		if v.value < 0 {
+			addf("%s must not be negative: %d", v.name, v.value)
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"delete permanently after", opts.DeletePermanentlyAfter},
+		{"deleted record grace period", opts.DeletedRecordGracePeriod},
+		{"drain timeout", opts.DrainTimeout},
+		{"sync drain flush timeout", opts.SyncDrainFlushTimeout},
+		{"cleanup reserve", opts.CleanupReserve},
+		{"read your writes timeout", opts.ReadYourWritesTimeout},
+		{"storage dial timeout", opts.StorageDialTimeout},
+		{"storage dns refresh interval", opts.StorageDNSRefreshInterval},
+		{"storage statement timeout", opts.StorageStatementTimeout},
+		{"slow operation threshold", opts.SlowOperationThreshold},
+		{"sync keepalive", opts.SyncKeepalive},
+		{"read cache ttl", opts.ReadCacheTTL},
+		{"negative cache ttl", opts.NegativeCacheTTL},
+		{"loader ttl", opts.LoaderTTL},
+		{"resync snapshot max age", opts.ResyncSnapshotMaxAge},
+		{"expiry scan interval", opts.ExpiryScanInterval},
+		{"expiry skew tolerance", opts.ExpirySkewTolerance},
+		{"record age sample interval", opts.RecordAgeSampleInterval},
+		{"memory persist interval", opts.MemoryPersistInterval},
+		{"retention interval", opts.RetentionInterval},
+		{"storage cert reload interval", opts.StorageCertReloadInterval},
+	} {
+		if v.value < 0 {
+			addf("%s must not be negative: %s", v.name, v.value)
+		}
+	}
+	switch opts.OnSyncVersionGap {
+	case SyncVersionGapResync, SyncVersionGapReset:
+	default:
+		addf("unsupported sync version gap policy: %s", opts.OnSyncVersionGap)
+	}
+	switch opts.OnSharedKeyChange {
+	case SharedKeyChangeRecreate, SharedKeyChangeRotate:
+	default:
+		addf("unsupported shared key change policy: %s", opts.OnSharedKeyChange)
+	}
+	switch opts.OnStorageInitFailure {
+	case StorageInitFailureRetryOnRequest, StorageInitFailureFailFast, StorageInitFailureStartDegraded:
+	default:
+		addf("unsupported storage init failure policy: %s", opts.OnStorageInitFailure)
+	}
+	switch opts.OnOversizedPage {
+	case OversizedPageSplit, OversizedPageSkip:
+	default:
+		addf("unsupported oversized page policy: %s", opts.OnOversizedPage)
+	}
+	switch opts.OnResync {
+	case ResyncIndependent, ResyncCoordinated:
+	default:
+		addf("unsupported resync policy: %s", opts.OnResync)
+	}
+	switch opts.OnSyncDrain {
+	case SyncDrainClose, SyncDrainFlush:
+	default:
+		addf("unsupported sync drain policy: %s", opts.OnSyncDrain)
+	}
+	switch opts.WebhookSerialization {
+	case ChangeSerializationJSON, ChangeSerializationCloudEvents:
+	default:
+		addf("unsupported webhook serialization: %s", opts.WebhookSerialization)
+	}
+	switch opts.KafkaSerialization {
+	case ChangeSerializationJSON, ChangeSerializationProtobuf, ChangeSerializationCloudEvents:
+	default:
+		addf("unsupported kafka serialization: %s", opts.KafkaSerialization)
+	}
+	switch opts.OnAuditBackpressure {
+	case AuditBackpressureDrop, AuditBackpressureBuffer, AuditBackpressureBlock:
+	default:
+		addf("unsupported audit backpressure policy: %s", opts.OnAuditBackpressure)
+	}
+	switch opts.MemoryPersistDurability {
+	case inmemory.PersistOnShutdown, inmemory.PersistPeriodic, inmemory.PersistEveryWrite:
+	default:
+		addf("unsupported memory persist durability: %s", opts.MemoryPersistDurability)
+	}
+	if opts.MinimumRetention != nil && *opts.MinimumRetention < 0 {
+		addf("minimum retention must not be negative: %s", *opts.MinimumRetention)
+	}
+	if opts.StorageTCPKeepAlive != nil && *opts.StorageTCPKeepAlive < 0 {
+		addf("storage tcp keepalive must not be negative: %s", *opts.StorageTCPKeepAlive)
+	}
+	if opts.ServeStaleOnError && opts.ReadCacheSize == 0 {
+		addf("serve stale on error requires a read cache size")
+	}
+	if opts.GetAllPageSize > 0 && opts.GetAllMaxPageSize > 0 && opts.GetAllPageSize > opts.GetAllMaxPageSize {
+		addf("get all page size %d must not exceed the max page size %d", opts.GetAllPageSize, opts.GetAllMaxPageSize)
+	}
+	recordTypes := make([]string, 0, len(opts.GetAllPageSizeByType))
+	for recordType := range opts.GetAllPageSizeByType {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	for _, recordType := range recordTypes {
+		pageSize := opts.GetAllPageSizeByType[recordType]
+		if pageSize <= 0 {
+			addf("get all page size for type %s must be positive: %d", recordType, pageSize)
+		} else if opts.GetAllMaxPageSize > 0 && pageSize > opts.GetAllMaxPageSize {
+			addf("get all page size %d for type %s must not exceed the max page size %d",
+				pageSize, recordType, opts.GetAllMaxPageSize)
+		}
+	}
+	syncWeightServices := make([]string, 0, len(opts.SyncWeights))
+	for service := range opts.SyncWeights {
+		syncWeightServices = append(syncWeightServices, service)
+	}
+	sort.Strings(syncWeightServices)
+	for _, service := range syncWeightServices {
+		if weight := opts.SyncWeights[service]; weight <= 0 {
+			addf("sync weight for service %q must be positive: %d", service, weight)
+		}
+	}
+	installationIDs := make([]string, 0, len(opts.InstallationQuotas))
+	for installationID := range opts.InstallationQuotas {
+		installationIDs = append(installationIDs, installationID)
+	}
+	sort.Strings(installationIDs)
+	for _, installationID := range installationIDs {
+		quota := opts.InstallationQuotas[installationID]
+		if quota.RequestsPerSecond < 0 || quota.Burst < 0 || quota.MaxConcurrentRequests < 0 {
+			addf("installation quota for %q must not be negative", installationID)
+		}
+	}
+	quotaRecordTypes := make([]string, 0, len(opts.RecordQuotas))
+	for recordType := range opts.RecordQuotas {
+		quotaRecordTypes = append(quotaRecordTypes, recordType)
+	}
+	sort.Strings(quotaRecordTypes)
+	for _, recordType := range quotaRecordTypes {
+		if max := opts.RecordQuotas[recordType]; max < 0 {
+			addf("record quota for type %s must not be negative: %d", recordType, max)
+		}
+	}
+	cacheableRecordTypes := make([]string, 0, len(opts.CacheableTypes))
+	for recordType := range opts.CacheableTypes {
+		cacheableRecordTypes = append(cacheableRecordTypes, recordType)
+	}
+	sort.Strings(cacheableRecordTypes)
+	for _, recordType := range cacheableRecordTypes {
+		if ttl := opts.CacheableTypes[recordType]; ttl <= 0 {
+			addf("cache ttl for type %s must be positive: %s", recordType, ttl)
+		}
+	}
+	retentionRecordTypes := make([]string, 0, len(opts.RetentionMaxVersions))
+	for recordType := range opts.RetentionMaxVersions {
+		retentionRecordTypes = append(retentionRecordTypes, recordType)
+	}
+	sort.Strings(retentionRecordTypes)
+	for _, recordType := range retentionRecordTypes {
+		if max := opts.RetentionMaxVersions[recordType]; max <= 0 {
+			addf("retention max versions for type %s must be positive: %d", recordType, max)
+		}
+	}
+	deleteRecordTypes := make([]string, 0, len(opts.DeletePermanentlyAfterByType))
+	for recordType := range opts.DeletePermanentlyAfterByType {
+		deleteRecordTypes = append(deleteRecordTypes, recordType)
+	}
+	sort.Strings(deleteRecordTypes)
+	for _, recordType := range deleteRecordTypes {
+		if dur := opts.DeletePermanentlyAfterByType[recordType]; dur < 0 {
+			addf("delete permanently after for type %s must not be negative: %s", recordType, dur)
+		}
+	}
+	idleAgeRecordTypes := make([]string, 0, len(opts.RetentionMaxIdleAge))
+	for recordType := range opts.RetentionMaxIdleAge {
+		idleAgeRecordTypes = append(idleAgeRecordTypes, recordType)
+	}
+	sort.Strings(idleAgeRecordTypes)
+	for _, recordType := range idleAgeRecordTypes {
+		if maxIdleAge := opts.RetentionMaxIdleAge[recordType]; maxIdleAge <= 0 {
+			addf("retention max idle age for type %s must be positive: %s", recordType, maxIdleAge)
+		}
+	}
+	encryptedRecordTypes := make([]string, 0, len(opts.EncryptedFields))
+	for recordType := range opts.EncryptedFields {
+		encryptedRecordTypes = append(encryptedRecordTypes, recordType)
+	}
+	sort.Strings(encryptedRecordTypes)
+	for _, recordType := range encryptedRecordTypes {
+		paths := opts.EncryptedFields[recordType]
+		if len(paths) == 0 {
+			addf("encrypted fields for type %s must not be empty", recordType)
+		}
+		for _, path := range paths {
+			if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+				addf("invalid encrypted field path for type %s: %q", recordType, path)
+			}
+		}
+	}
+	keyRecordTypes := make([]string, 0, len(opts.EncryptionKeysForTypes))
+	for recordType := range opts.EncryptionKeysForTypes {
+		keyRecordTypes = append(keyRecordTypes, recordType)
+	}
+	sort.Strings(keyRecordTypes)
+	for _, recordType := range keyRecordTypes {
+		keys := opts.EncryptionKeysForTypes[recordType]
+		if len(keys) == 0 {
+			addf("encryption keys for type %s must not be empty", recordType)
+		}
+		for _, raw := range keys {
+			key, err := base64.StdEncoding.DecodeString(raw)
+			if err != nil || len(key) != cryptutil.DefaultKeySize {
+				addf("encryption key for type %s must be a base64-encoded %d byte key", recordType, cryptutil.DefaultKeySize)
+			}
+		}
+	}
+	if len(opts.EncryptionKeysForTypes) > 0 && len(opts.EncryptedFields) > 0 {
+		addf("encryption keys for types can't be combined with encrypted fields")
+	}
+	for _, codec := range opts.SyncCompression {
+		if !databroker.IsSupportedCompression(codec) {
+			addf("unsupported sync compression codec: %s", codec)
+		}
+	}
+	for _, v := range opts.AcceptedSchemaVersions {
+		if v < 0 {
+			addf("accepted schema version must not be negative: %d", v)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
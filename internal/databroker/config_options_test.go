@@ -0,0 +1,253 @@
+package databroker
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+func TestNewServerConfigFromOptions(t *testing.T) {
+	sharedKey := cryptutil.NewBase64Key()
+
+	t.Run("equivalent", func(t *testing.T) {
+		option, err := NewServerConfigFromOptions(ServerConfigOptions{
+			InstallationID:               "INSTALLATION-1",
+			DeletePermanentlyAfter:       time.Minute,
+			SharedKey:                    sharedKey,
+			StorageType:                  "redis",
+			StorageConnectionString:      "redis://localhost:6379",
+			StorageCAFiles:               []string{"/etc/ssl/ca.pem"},
+			StoragePoolSize:              20,
+			StorageMinIdleConns:          5,
+			StorageWarmup:                true,
+			StorageWarmupRecordTypes:     []string{"type.googleapis.com/session.Session"},
+			GetAllPageSize:               10,
+			GetAllPageSizeByType:         map[string]int{"DIRECTORY": 2},
+			MaxSyncStreams:               5,
+			SyncKeepalive:                time.Second * 30,
+			AcceptedSchemaVersions:       []int{1, 2},
+			ExpiryScanEnabled:            true,
+			DeletePermanentlyAfterByType: map[string]time.Duration{"DIRECTORY": 0},
+			KafkaBrokers:                 []string{"kafka-1:9092", "kafka-2:9092"},
+			KafkaTopic:                   "changes",
+			KafkaSerialization:           ChangeSerializationCloudEvents,
+		})
+		require.NoError(t, err)
+
+		expect := newServerConfig(
+			WithInstallationID("INSTALLATION-1"),
+			WithDeletePermanentlyAfter(time.Minute),
+			WithSharedKey(sharedKey),
+			WithStorageType("redis"),
+			WithStorageConnectionString("redis://localhost:6379"),
+			WithStorageCAFiles([]string{"/etc/ssl/ca.pem"}),
+			WithStoragePoolSize(20),
+			WithStorageMinIdleConns(5),
+			WithStorageWarmup(true),
+			WithStorageWarmupRecordTypes([]string{"type.googleapis.com/session.Session"}),
+			WithGetAllPageSize(10),
+			WithGetAllPageSizeForType("DIRECTORY", 2),
+			WithMaxSyncStreams(5),
+			WithSyncKeepalive(time.Second*30),
+			WithAcceptedSchemaVersions([]int{1, 2}),
+			WithExpiryScanEnabled(true),
+			WithDeletePermanentlyAfterForType("DIRECTORY", 0),
+			WithKafkaSink(nil, KafkaSink{
+				Brokers:       []string{"kafka-1:9092", "kafka-2:9092"},
+				Topic:         "changes",
+				Serialization: ChangeSerializationCloudEvents,
+			}),
+		)
+		assert.Equal(t, expect, newServerConfig(option))
+	})
+	t.Run("defaults", func(t *testing.T) {
+		option, err := NewServerConfigFromOptions(ServerConfigOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, newServerConfig(), newServerConfig(option))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		negativeRetention := -time.Second
+		_, err := NewServerConfigFromOptions(ServerConfigOptions{
+			SharedKey:                    "NOT A VALID KEY",
+			StorageType:                  "UNKNOWN",
+			GetAllPageSize:               -1,
+			DrainTimeout:                 -time.Second,
+			MinimumRetention:             &negativeRetention,
+			CleanupReserve:               -time.Second,
+			GetAllPageSizeByType:         map[string]int{"DIRECTORY": 0},
+			DeletePermanentlyAfterByType: map[string]time.Duration{"DIRECTORY": -time.Minute},
+			OnSyncVersionGap:             SyncVersionGapPolicy(5),
+			PreviousSharedKeys:           []string{"NOT A VALID KEY"},
+			OnSharedKeyChange:            SharedKeyChangePolicy(5),
+			OnStorageInitFailure:         StorageInitFailurePolicy(5),
+			OnOversizedPage:              OversizedPagePolicy(5),
+			OnResync:                     ResyncPolicy(5),
+			OnSyncDrain:                  SyncDrainPolicy(5),
+			MemoryPersistDurability:      inmemory.PersistDurability(5),
+			SyncCompression:              []string{"br"},
+			StorageCAPEM:                 []byte("NOT PEM"),
+			StorageCertificatePEM:        []byte("NOT PEM"),
+			SweepWindows:                 []string{"1am-5am"},
+			EncryptionKeysForTypes:       map[string][]string{"SESSION": {"NOT A VALID KEY"}},
+			ServeStaleOnError:            true,
+			RetentionMaxVersions:         map[string]int{"SESSION": 0},
+			CacheableTypes:               map[string]time.Duration{"SESSION": 0},
+			RetentionMaxIdleAge:          map[string]time.Duration{"SESSION": -time.Hour},
+			StorageCertificateFile:       "/etc/ssl/storage.pem",
+			StorageCertReloadInterval:    -time.Second,
+			StorageKeyPrefix:             "{a}",
+			StorageChangeCompression:     "br",
+			SyncPauseBufferSize:          -1,
+			StoragePoolSize:              5,
+			StorageMinIdleConns:          10,
+			MaxNotificationBufferBytes:   -1,
+			WebhookURLs:                  []string{"ftp://example.com/hook"},
+			WebhookBufferSize:            -1,
+			SlowOperationSampleRate:      1.5,
+			MaxVersionsPerRecord:         -1,
+			StorageRoutes: map[string]StorageRoute{
+				"session": {Type: "redis"},
+				"user":    {Type: "postgres"},
+			},
+			StorageShards: map[string]StorageRoute{
+				"a": {Type: "memory"},
+				"b": {Type: "redis"},
+			},
+			CriticalRecordTypes:  []string{"session", "group"},
+			OnAuditBackpressure:  AuditBackpressurePolicy(5),
+			WebhookSerialization: ChangeSerializationProtobuf,
+			AuditBufferSize:      -1,
+			KafkaTopic:           "changes",
+			KafkaSerialization:   ChangeSerialization(5),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "shared key")
+		assert.Contains(t, err.Error(), "unsupported webhook serialization: protobuf")
+		assert.Contains(t, err.Error(), "unsupported audit backpressure policy: AuditBackpressurePolicy(5)")
+		assert.Contains(t, err.Error(), "audit buffer size must not be negative")
+		assert.Contains(t, err.Error(), "critical record type has no storage route: group")
+		assert.Contains(t, err.Error(), "unsupported storage type: UNKNOWN")
+		assert.Contains(t, err.Error(), "get all page size must not be negative")
+		assert.Contains(t, err.Error(), "drain timeout must not be negative")
+		assert.Contains(t, err.Error(), "minimum retention must not be negative")
+		assert.Contains(t, err.Error(), "cleanup reserve must not be negative")
+		assert.Contains(t, err.Error(), "get all page size for type DIRECTORY must be positive")
+		assert.Contains(t, err.Error(), "unsupported sync version gap policy: SyncVersionGapPolicy(5)")
+		assert.Contains(t, err.Error(), "previous shared key must be a base64-encoded 32 byte key")
+		assert.Contains(t, err.Error(), "unsupported shared key change policy: SharedKeyChangePolicy(5)")
+		assert.Contains(t, err.Error(), "unsupported storage init failure policy: StorageInitFailurePolicy(5)")
+		assert.Contains(t, err.Error(), "unsupported oversized page policy: OversizedPagePolicy(5)")
+		assert.Contains(t, err.Error(), "unsupported resync policy: ResyncPolicy(5)")
+		assert.Contains(t, err.Error(), "unsupported sync drain policy: SyncDrainPolicy(5)")
+		assert.Contains(t, err.Error(), "unsupported memory persist durability: PersistDurability(5)")
+		assert.Contains(t, err.Error(), "unsupported sync compression codec: br")
+		assert.Contains(t, err.Error(), "invalid storage CA PEM")
+		assert.Contains(t, err.Error(), "invalid storage certificate PEM")
+		assert.Contains(t, err.Error(), "storage connection string is required for the storage route of type session")
+		assert.Contains(t, err.Error(), "unsupported storage type for the storage route of type user: postgres")
+		assert.Contains(t, err.Error(), "storage connection string is required for storage shard b")
+		assert.Contains(t, err.Error(), "storage shards must have the same storage type: a is memory, b is redis")
+		assert.Contains(t, err.Error(), "storage routes can't be combined with storage shards")
+		assert.Contains(t, err.Error(), `invalid sweep window "1am-5am"`)
+		assert.Contains(t, err.Error(), "encryption key for type SESSION must be a base64-encoded 32 byte key")
+		assert.Contains(t, err.Error(), "serve stale on error requires a read cache size")
+		assert.Contains(t, err.Error(), "retention max versions for type SESSION must be positive: 0")
+		assert.Contains(t, err.Error(), "cache ttl for type SESSION must be positive: 0s")
+		assert.Contains(t, err.Error(), "retention max idle age for type SESSION must be positive: -1h0m0s")
+		assert.Contains(t, err.Error(), "delete permanently after for type DIRECTORY must not be negative: -1m0s")
+		assert.Contains(t, err.Error(), "storage certificate file and key file must be set together")
+		assert.Contains(t, err.Error(), "storage cert reload interval must not be negative")
+		assert.Contains(t, err.Error(), "storage key prefix must not contain braces: {a}")
+		assert.Contains(t, err.Error(), "unsupported storage change compression codec: br")
+		assert.Contains(t, err.Error(), "sync pause buffer size must not be negative: -1")
+		assert.Contains(t, err.Error(), "max notification buffer bytes must not be negative: -1")
+		assert.Contains(t, err.Error(), "storage min idle conns must not exceed the storage pool size: 10 > 5")
+		assert.Contains(t, err.Error(), "invalid webhook url: ftp://example.com/hook")
+		assert.Contains(t, err.Error(), "webhook buffer size must not be negative: -1")
+		assert.Contains(t, err.Error(), "slow operation sample rate must be between 0 and 1: 1.5")
+		assert.Contains(t, err.Error(), "max versions per record must not be negative: -1")
+		assert.Contains(t, err.Error(), "kafka brokers are required with a kafka topic")
+		assert.Contains(t, err.Error(), "unsupported kafka serialization: ChangeSerialization(5)")
+	})
+}
+
+func TestServerConfig_storageTLSConfig(t *testing.T) {
+	const (
+		caFile   = "../../pkg/cryptutil/testdata/ca.pem"
+		certFile = "../../pkg/cryptutil/testdata/example-cert.pem"
+		keyFile  = "../../pkg/cryptutil/testdata/example-key.pem"
+	)
+	caPEM, err := ioutil.ReadFile(caFile)
+	require.NoError(t, err)
+	certPEM, err := ioutil.ReadFile(certFile)
+	require.NoError(t, err)
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	require.NoError(t, err)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+
+	fromFiles, err := newServerConfig(
+		WithStorageCAFile(caFile),
+		WithStorageCertificate(&cert),
+	).storageTLSConfig()
+	require.NoError(t, err)
+
+	fromPEM, err := newServerConfig(
+		WithStorageCAPEM(caPEM),
+		WithStorageCertificatePEM(certPEM, keyPEM),
+	).storageTLSConfig()
+	require.NoError(t, err)
+
+	assert.True(t, fromFiles.RootCAs.Equal(fromPEM.RootCAs), "root CAs should match")
+	assert.Equal(t, fromFiles.Certificates, fromPEM.Certificates)
+
+	reloaded, err := newServerConfig(
+		WithStorageCertificateFiles(certFile, keyFile),
+		WithStorageCertificate(&tls.Certificate{}),
+	).storageTLSConfig()
+	require.NoError(t, err)
+	assert.Empty(t, reloaded.Certificates, "the certificate files should take precedence")
+	if assert.NotNil(t, reloaded.GetClientCertificate) {
+		clientCert, err := reloaded.GetClientCertificate(&tls.CertificateRequestInfo{})
+		require.NoError(t, err)
+		assert.Equal(t, cert.Certificate, clientCert.Certificate)
+	}
+
+	_, err = newServerConfig(WithStorageCertificateFiles(certFile, "missing.pem")).storageTLSConfig()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to load databroker storage certificate")
+	}
+
+	_, err = newServerConfig(WithStorageCertificatePEM(certPEM, []byte("NOT PEM"))).storageTLSConfig()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to load databroker storage certificate")
+	}
+	_, err = newServerConfig(WithStorageCAPEM([]byte("NOT PEM"))).storageTLSConfig()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to load databroker storage CA")
+	}
+}
+
+func TestServerConfig_storagePassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("P@ss:word\n"), 0o600))
+
+	password, err := newServerConfig(WithStoragePasswordFile(passwordFile)).storagePassword()
+	require.NoError(t, err)
+	assert.Equal(t, "P@ss:word", password)
+
+	password, err = newServerConfig().storagePassword()
+	require.NoError(t, err)
+	assert.Empty(t, password)
+
+	_, err = newServerConfig(WithStoragePasswordFile(passwordFile + ".missing")).storagePassword()
+	assert.Error(t, err)
+}
@@ -154,6 +154,10 @@ func (src *ConfigSource) runUpdater(cfg *config.Config) {
 		CAFile:                  cfg.Options.CAFile,
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		Compression:             cfg.Options.GRPCCompression,
+		TLSMinVersion:           cfg.Options.GetGRPCTLSMinVersion(),
+		TLSCipherSuites:         cfg.Options.GetGRPCTLSCipherSuites(),
+		MaxRecvMsgSize:          cfg.Options.GRPCServerMaxSendMsgSize,
 		WithInsecure:            cfg.Options.GRPCInsecure,
 		ServiceName:             cfg.Options.Services,
 		SignedJWTKey:            sharedKey,
@@ -0,0 +1,65 @@
+package databroker
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+var errInvalidConsistencyToken = errors.New("invalid consistency token")
+
+// encodeConsistencyToken encodes the version of a write as an opaque token, which
+// requires the reads made with it to reflect at least that write.
+func encodeConsistencyToken(serverVersion, recordVersion uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", serverVersion, recordVersion)))
+}
+
+func decodeConsistencyToken(token string) (serverVersion, recordVersion uint64, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, 0, errInvalidConsistencyToken
+	}
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &serverVersion, &recordVersion); err != nil {
+		return 0, 0, errInvalidConsistencyToken
+	}
+	return serverVersion, recordVersion, nil
+}
+
+// withConsistencyToken prepares a read to reflect at least the write of the
+// consistency token, if any. The read bypasses the caches, and the backend is
+// waited on, up to the read-your-writes timeout, to catch up with the write. A
+// token from before the server version changed is ignored, since the records it
+// refers to are gone.
+func (srv *Server) withConsistencyToken(
+	ctx context.Context,
+	backend storage.Backend,
+	serverVersion uint64,
+	token string,
+) (context.Context, error) {
+	if token == "" {
+		return ctx, nil
+	}
+	tokenServerVersion, recordVersion, err := decodeConsistencyToken(token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if tokenServerVersion != serverVersion {
+		return ctx, nil
+	}
+
+	waitCtx, clearTimeout := context.WithTimeout(ctx, srv.getConfig().readYourWritesTimeout)
+	defer clearTimeout()
+	if err := storage.WaitForVersion(waitCtx, backend, recordVersion); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, status.Errorf(codes.Unavailable, "storage has not caught up with the write of the consistency token: %v", err)
+	}
+	return storage.WithConsistency(ctx, storage.ConsistencyStrong), nil
+}
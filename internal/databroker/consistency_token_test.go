@@ -0,0 +1,113 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// A delayedReplicaBackend writes to the primary and reads from a replica, which
+// the writes are replicated to after a delay.
+type delayedReplicaBackend struct {
+	storage.Backend
+	primary storage.Backend
+	delay   time.Duration
+}
+
+func (backend *delayedReplicaBackend) Put(ctx context.Context, record *databroker.Record) error {
+	if err := backend.primary.Put(ctx, record); err != nil {
+		return err
+	}
+	replicated := proto.Clone(record).(*databroker.Record)
+	time.AfterFunc(backend.delay, func() {
+		_ = backend.Backend.Put(context.Background(), replicated)
+	})
+	return nil
+}
+
+func TestServer_ConsistencyToken(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	newLaggingServer := func(delay time.Duration, options ...ServerOption) *Server {
+		srv := newServer(newServerConfig(options...))
+		srv.backend = &delayedReplicaBackend{Backend: inmemory.New(), primary: inmemory.New(), delay: delay}
+		return srv
+	}
+
+	t.Run("get", func(t *testing.T) {
+		srv := newLaggingServer(time.Millisecond * 200)
+		res, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: "1"},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.GetConsistencyToken())
+
+		_, err = srv.Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: "1"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "the replica should lag behind without the token")
+
+		got, err := srv.Get(ctx, &databroker.GetRequest{
+			Type:             "TYPE",
+			Id:               "1",
+			ConsistencyToken: res.GetConsistencyToken(),
+		})
+		require.NoError(t, err, "the write should be visible with the token")
+		assert.Equal(t, res.GetRecord().GetVersion(), got.GetRecord().GetVersion())
+	})
+	t.Run("sync latest", func(t *testing.T) {
+		srv := newLaggingServer(time.Millisecond * 200)
+		res, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: "1"},
+		})
+		require.NoError(t, err)
+
+		client := newTestClient(t, srv)
+		stream, err := client.SyncLatest(ctx, &databroker.SyncLatestRequest{
+			ConsistencyToken: res.GetConsistencyToken(),
+		})
+		require.NoError(t, err)
+		var ids []string
+		for {
+			res, err := stream.Recv()
+			require.NoError(t, err)
+			if res.GetVersions() != nil {
+				break
+			}
+			ids = append(ids, res.GetRecord().GetId())
+		}
+		assert.Equal(t, []string{"1"}, ids)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		srv := newLaggingServer(time.Second*5, WithReadYourWritesTimeout(time.Millisecond*50))
+		res, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: "1"},
+		})
+		require.NoError(t, err)
+
+		_, err = srv.Get(ctx, &databroker.GetRequest{
+			Type:             "TYPE",
+			Id:               "1",
+			ConsistencyToken: res.GetConsistencyToken(),
+		})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	})
+	t.Run("invalid", func(t *testing.T) {
+		srv := newLaggingServer(0)
+		_, err := srv.Get(ctx, &databroker.GetRequest{
+			Type:             "TYPE",
+			Id:               "1",
+			ConsistencyToken: "NOT A TOKEN",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
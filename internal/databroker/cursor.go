@@ -0,0 +1,66 @@
+package databroker
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// limitSyncLatestRecords returns the records after the cursor, up to the max
+// results, in type and id order. If records remain, the cursor to continue from
+// is also returned.
+func limitSyncLatestRecords(records []*databroker.Record, cursor string, maxResults int) ([]*databroker.Record, string, error) {
+	if cursor == "" && (maxResults <= 0 || len(records) <= maxResults) {
+		return records, "", nil
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return compareRecordKeys(records[i].GetType(), records[i].GetId(), records[j].GetType(), records[j].GetId()) < 0
+	})
+
+	if cursor != "" {
+		afterType, afterID, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		records = records[sort.Search(len(records), func(i int) bool {
+			return compareRecordKeys(records[i].GetType(), records[i].GetId(), afterType, afterID) > 0
+		}):]
+	}
+
+	if maxResults <= 0 || len(records) <= maxResults {
+		return records, "", nil
+	}
+	records = records[:maxResults]
+	last := records[len(records)-1]
+	return records, encodeCursor(last.GetType(), last.GetId()), nil
+}
+
+func compareRecordKeys(type1, id1, type2, id2 string) int {
+	if c := strings.Compare(type1, type2); c != 0 {
+		return c
+	}
+	return strings.Compare(id1, id2)
+}
+
+// encodeCursor encodes the key of a record as an opaque cursor.
+func encodeCursor(recordType, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(recordType + "\x00" + id))
+}
+
+func decodeCursor(cursor string) (recordType, id string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", errInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "\x00", 2)
+	if len(parts) != 2 {
+		return "", "", errInvalidCursor
+	}
+	return parts[0], parts[1], nil
+}
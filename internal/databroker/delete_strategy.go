@@ -0,0 +1,35 @@
+package databroker
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// withDeleteStrategies returns the backend with the delete strategies registered
+// for each record type applied to the deletes made through it. It's wrapped per
+// write, rather than when the backend is created, so that registering strategies
+// doesn't recreate the backend.
+func (srv *Server) withDeleteStrategies(db storage.Backend) storage.Backend {
+	cfg := srv.getConfig()
+	if len(cfg.deleteStrategies) == 0 {
+		return db
+	}
+	return storage.NewReferentialIntegrityBackend(cfg.deleteStrategies, cfg.cleanupReserve, db)
+}
+
+// deleteStrategyError returns a FailedPrecondition error if the write failed
+// because a delete strategy vetoed a delete, a DeadlineExceeded error if a cascade
+// ran out of time, and err otherwise.
+func deleteStrategyError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrDeleteVetoed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, storage.ErrDeadlineBudgetExhausted):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return err
+}
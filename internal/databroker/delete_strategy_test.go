@@ -0,0 +1,66 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestServer_DeleteStrategy(t *testing.T) {
+	ctx := context.Background()
+
+	userType := "type.googleapis.com/user.User"
+	sessionType := "type.googleapis.com/session.Session"
+	srv := newServer(newServerConfig(
+		WithDeleteStrategy(userType, storage.NewCascadeDeleteStrategy(sessionType,
+			func(referenced, record *databroker.Record) bool {
+				var s session.Session
+				if err := record.GetData().UnmarshalTo(&s); err != nil {
+					return false
+				}
+				return s.GetUserId() == referenced.GetId()
+			})),
+	))
+
+	for _, u := range []string{"u1", "u2"} {
+		data, err := anypb.New(&user.User{Id: u})
+		require.NoError(t, err)
+		_, err = srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: userType, Id: u, Data: data},
+		})
+		require.NoError(t, err)
+	}
+	for id, userID := range map[string]string{"s1": "u1", "s2": "u1", "s3": "u2"} {
+		data, err := anypb.New(&session.Session{Id: id, UserId: userID})
+		require.NoError(t, err)
+		_, err = srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: sessionType, Id: id, Data: data},
+		})
+		require.NoError(t, err)
+	}
+
+	_, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: userType, Id: "u1", DeletedAt: timestamppb.Now()},
+	})
+	require.NoError(t, err)
+
+	for id, deleted := range map[string]bool{"s1": true, "s2": true, "s3": false} {
+		_, err := srv.Get(ctx, &databroker.GetRequest{Type: sessionType, Id: id})
+		if deleted {
+			assert.Equal(t, codes.NotFound, status.Code(err), "the sessions of the deleted user should be deleted with it: %s", id)
+		} else {
+			assert.NoError(t, err, "the sessions of other users should be kept: %s", id)
+		}
+	}
+}
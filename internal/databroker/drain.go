@@ -0,0 +1,85 @@
+package databroker
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errDraining is returned to clients when the server is draining.
+var errDraining = status.Error(codes.Unavailable, "databroker is draining, reconnect to another server")
+
+// Drain gracefully drains the server in preparation for shutdown. New writes and
+// Sync streams are rejected, existing Sync streams are closed with an Unavailable
+// status so that clients reconnect elsewhere, and in-flight writes are given up to
+// the configured drain timeout to complete. Under the flush sync drain policy,
+// Sync streams send the changes of the in-flight writes before they're closed.
+//
+// Clients reconnecting to another server resume syncing from the last record
+// version they received, so no full re-sync is required.
+func (srv *Server) Drain(ctx context.Context) error {
+	srv.drainOnce.Do(func() {
+		atomic.StoreInt32(&srv.draining, 1)
+		close(srv.drainedC())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, srv.getConfig().drainTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		// acquiring the write lock waits for all in-flight writes to complete
+		srv.writeMu.Lock()
+		srv.writeMu.Unlock()
+		srv.writesDrainedOnce.Do(func() { close(srv.writesDrainedC()) })
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		srv.log.Warn().Msg("timed out waiting for in-flight writes to complete during drain")
+		return ctx.Err()
+	case <-done:
+	}
+
+	srv.log.Info().Msg("drained")
+	return nil
+}
+
+func (srv *Server) isDraining() bool {
+	return atomic.LoadInt32(&srv.draining) == 1
+}
+
+// drainedC returns a channel which is closed when the server starts draining.
+func (srv *Server) drainedC() chan struct{} {
+	srv.drainInitOnce.Do(func() {
+		srv.drained = make(chan struct{})
+	})
+	return srv.drained
+}
+
+// writesDrainedC returns a channel which is closed once the in-flight writes have
+// completed after the server started draining.
+func (srv *Server) writesDrainedC() chan struct{} {
+	srv.writesDrainedInitOnce.Do(func() {
+		srv.writesDrained = make(chan struct{})
+	})
+	return srv.writesDrained
+}
+
+// beginWrite marks the start of a write. The returned function must be called when
+// the write completes. An error is returned if the server is draining.
+func (srv *Server) beginWrite() (end func(), err error) {
+	if srv.isDraining() {
+		return nil, errDraining
+	}
+	srv.writeMu.RLock()
+	// re-check in case draining started while we were waiting for the lock
+	if srv.isDraining() {
+		srv.writeMu.RUnlock()
+		return nil, errDraining
+	}
+	return srv.writeMu.RUnlock, nil
+}
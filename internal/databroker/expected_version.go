@@ -0,0 +1,38 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// expectVersion checks that the record is at the expected version before it's
+// put, and returns a context which has the storage compare the version again as
+// it's put. The first check covers backends which can't compare it atomically,
+// for writers on this server, since the record is locked. The second covers
+// writers on other servers sharing the storage.
+func (srv *Server) expectVersion(
+	ctx context.Context,
+	db storage.Backend,
+	record *databroker.Record,
+	expectedVersion uint64,
+) (context.Context, error) {
+	ctx = storage.WithExpectedVersion(ctx, record.GetType(), record.GetId(), expectedVersion)
+
+	// a stale cached record would hide a conflict
+	current, err := db.Get(storage.WithConsistency(ctx, storage.ConsistencyStrong), record.GetType(), record.GetId())
+	if errors.Is(err, storage.ErrNotFound) {
+		current = nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := storage.CheckExpectedVersion(ctx, record, current); err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return ctx, nil
+}
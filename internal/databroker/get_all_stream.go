@@ -0,0 +1,60 @@
+package databroker
+
+import (
+	"context"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// GetAllStream streams all the records of the given type, or of every type if it's
+// empty, without reading them all into memory first. The records are read from
+// the storage a page of the configured GetAll page size at a time, and each page
+// is only read once the records of the previous one have been received.
+//
+// The records channel is closed once all the records have been sent, and then at
+// most one error is sent on the error channel before it's closed. Cancelling ctx
+// stops reading pages and fails the stream with the context's error.
+func (srv *Server) GetAllStream(ctx context.Context, recordType string) (<-chan *databroker.Record, <-chan error) {
+	records := make(chan *databroker.Record)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(records)
+
+		if err := srv.getAllStream(ctx, recordType, records); err != nil {
+			errs <- err
+		}
+	}()
+
+	return records, errs
+}
+
+func (srv *Server) getAllStream(ctx context.Context, recordType string, records chan<- *databroker.Record) error {
+	if recordType != "" {
+		if err := srv.getConfig().checkRecordType(recordType); err != nil {
+			return err
+		}
+	}
+
+	backend, _, err := srv.getBackend()
+	if err != nil {
+		return err
+	}
+
+	pageSize := srv.getAllPageSizeFor(&databroker.SyncLatestRequest{Type: recordType})
+	_, err = srv.streamAll(ctx, backend, pageSize, func(page []*databroker.Record) error {
+		for _, record := range page {
+			if recordType != "" && record.GetType() != recordType {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case records <- record:
+			}
+		}
+		return ctx.Err()
+	})
+	return err
+}
@@ -0,0 +1,56 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestServer_GetAllStream(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(newServerConfig(WithGetAllPageSize(3)))
+	defer func() { _ = srv.Close() }()
+
+	for i := 0; i < 10; i++ {
+		for _, recordType := range []string{"A", "B"} {
+			_, err := srv.Put(ctx, &databroker.PutRequest{
+				Record: &databroker.Record{Type: recordType, Id: fmt.Sprint(i)},
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("type", func(t *testing.T) {
+		records, errs := srv.GetAllStream(ctx, "A")
+		var ids []string
+		for record := range records {
+			assert.Equal(t, "A", record.GetType())
+			ids = append(ids, record.GetId())
+		}
+		assert.NoError(t, <-errs)
+		assert.Len(t, ids, 10)
+	})
+	t.Run("all types", func(t *testing.T) {
+		records, errs := srv.GetAllStream(ctx, "")
+		n := 0
+		for range records {
+			n++
+		}
+		assert.NoError(t, <-errs)
+		assert.Equal(t, 20, n)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		records, errs := srv.GetAllStream(ctx, "A")
+		<-records
+		cancel()
+		for range records {
+		}
+		assert.ErrorIs(t, <-errs, context.Canceled)
+	})
+}
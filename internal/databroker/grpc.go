@@ -0,0 +1,40 @@
+package databroker
+
+import (
+	"google.golang.org/grpc"
+)
+
+// GRPCServerOptions returns the options for a gRPC server serving the databroker.
+// Since gRPC server options are only applied when the server is created, changes
+// require a restart.
+func GRPCServerOptions(options ...ServerOption) []grpc.ServerOption {
+	cfg := newServerConfig(options...)
+	var serverOptions []grpc.ServerOption
+	if cfg.maxRecvMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(cfg.maxRecvMsgSize))
+	}
+	if cfg.maxSendMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxSendMsgSize(cfg.maxSendMsgSize))
+	}
+	if len(cfg.installationQuotas) > 0 {
+		iq := newInstallationQuotas(cfg.installationQuotas)
+		serverOptions = append(serverOptions,
+			grpc.ChainUnaryInterceptor(iq.unaryInterceptor),
+			grpc.ChainStreamInterceptor(iq.streamInterceptor))
+	}
+	return serverOptions
+}
+
+// GRPCCallOptions returns the options for gRPC clients calling a databroker
+// configured with the given options, so that the client limits match the server's.
+func GRPCCallOptions(options ...ServerOption) []grpc.CallOption {
+	cfg := newServerConfig(options...)
+	var callOptions []grpc.CallOption
+	if cfg.maxRecvMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(cfg.maxRecvMsgSize))
+	}
+	if cfg.maxSendMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(cfg.maxSendMsgSize))
+	}
+	return callOptions
+}
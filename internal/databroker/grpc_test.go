@@ -0,0 +1,211 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// newGRPCTestClient returns a client of a server with the given options, served
+// with the gRPC server options for them.
+func newGRPCTestClient(t *testing.T, options ...ServerOption) databroker.DataBrokerServiceClient {
+	t.Helper()
+
+	srv := newServer(newServerConfig(options...))
+
+	li := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer(GRPCServerOptions(options...)...)
+	databroker.RegisterDataBrokerServiceServer(gs, srv)
+	go func() { _ = gs.Serve(li) }()
+	t.Cleanup(gs.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return li.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(GRPCCallOptions(options...)...))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+
+	return databroker.NewDataBrokerServiceClient(cc)
+}
+
+func TestGRPCServerOptions(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	newClient := newGRPCTestClient
+
+	// above the 4MB gRPC default
+	data, err := anypb.New(wrapperspb.Bytes(make([]byte, 5*1024*1024)))
+	require.NoError(t, err)
+	put := func(client databroker.DataBrokerServiceClient) error {
+		_, err := client.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: "1", Data: data},
+		})
+		return err
+	}
+
+	t.Run("default", func(t *testing.T) {
+		client := newClient(t)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(put(client)))
+	})
+	t.Run("installation quotas", func(t *testing.T) {
+		client := newClient(t,
+			WithInstallationQuota("", InstallationQuota{RequestsPerSecond: 1000, Burst: 1000}),
+			WithInstallationQuota("noisy", InstallationQuota{RequestsPerSecond: 0.001, Burst: 2}))
+		get := func(installationID string) error {
+			_, err := client.Get(grpcutil.WithOutgoingInstallationID(ctx, installationID),
+				&databroker.GetRequest{Type: "TYPE", Id: "1"})
+			return err
+		}
+
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, codes.NotFound, status.Code(get("noisy")))
+		}
+		assert.Equal(t, codes.ResourceExhausted, status.Code(get("noisy")))
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, codes.NotFound, status.Code(get("quiet")), "other installations should be unaffected")
+		}
+	})
+	t.Run("installation concurrency", func(t *testing.T) {
+		client := newClient(t,
+			WithInstallationQuota("noisy", InstallationQuota{MaxConcurrentRequests: 1}))
+
+		putSmall := func() error {
+			_, err := client.Put(ctx, &databroker.PutRequest{
+				Record: &databroker.Record{Type: "OTHER", Id: "1"},
+			})
+			return err
+		}
+		require.NoError(t, putSmall())
+		_, recordVersion, serverVersion, err := databroker.InitialSync(ctx, client, &databroker.SyncLatestRequest{})
+		require.NoError(t, err)
+
+		// the open stream holds the only request the installation may have in flight
+		stream, err := client.Sync(grpcutil.WithOutgoingInstallationID(ctx, "noisy"), &databroker.SyncRequest{
+			ServerVersion: serverVersion,
+			RecordVersion: recordVersion,
+		})
+		require.NoError(t, err)
+		require.NoError(t, putSmall())
+		_, err = stream.Recv()
+		require.NoError(t, err)
+
+		_, err = client.Get(grpcutil.WithOutgoingInstallationID(ctx, "noisy"),
+			&databroker.GetRequest{Type: "TYPE", Id: "1"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		_, err = client.Get(grpcutil.WithOutgoingInstallationID(ctx, "quiet"),
+			&databroker.GetRequest{Type: "TYPE", Id: "1"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+	t.Run("raised", func(t *testing.T) {
+		client := newClient(t,
+			WithMaxRecvMsgSize(8*1024*1024),
+			WithMaxSendMsgSize(8*1024*1024))
+		require.NoError(t, put(client))
+
+		res, err := client.Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: "1"})
+		require.NoError(t, err)
+		assert.Equal(t, "1", res.GetRecord().GetId())
+	})
+}
+
+func TestQueryMaxSendMsgSize(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(newServerConfig(WithMaxSendMsgSize(2500)))
+
+	data, err := anypb.New(wrapperspb.Bytes(make([]byte, 1000)))
+	require.NoError(t, err)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		_, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: id, Data: data},
+		})
+		require.NoError(t, err)
+	}
+
+	// two records fit in each response, so the client pages through the rest
+	var pages []int
+	for offset := int64(0); offset < 5; {
+		res, err := srv.Query(ctx, &databroker.QueryRequest{Type: "TYPE", Offset: offset, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), res.GetTotalCount())
+		require.NotEmpty(t, res.GetRecords())
+
+		pages = append(pages, len(res.GetRecords()))
+		offset += int64(len(res.GetRecords()))
+	}
+	assert.Equal(t, []int{2, 2, 1}, pages)
+
+	big, err := anypb.New(wrapperspb.Bytes(make([]byte, 5000)))
+	require.NoError(t, err)
+	_, err = srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "BIG", Id: "1", Data: big},
+	})
+	require.NoError(t, err)
+	_, err = srv.Query(ctx, &databroker.QueryRequest{Type: "BIG", Limit: 10})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestSyncLatestMaxSendMsgSize(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	data, err := anypb.New(wrapperspb.Bytes(make([]byte, 1000)))
+	require.NoError(t, err)
+	big, err := anypb.New(wrapperspb.Bytes(make([]byte, 5000)))
+	require.NoError(t, err)
+	putAll := func(client databroker.DataBrokerServiceClient, withBig bool) {
+		for i := 0; i < 10; i++ {
+			_, err := client.Put(ctx, &databroker.PutRequest{
+				Record: &databroker.Record{Type: "TYPE", Id: fmt.Sprint(i), Data: data},
+			})
+			require.NoError(t, err)
+		}
+		if withBig {
+			// the record is stored, and only the response is too large to send
+			_, err := client.Put(ctx, &databroker.PutRequest{
+				Record: &databroker.Record{Type: "TYPE", Id: "big", Data: big},
+			})
+			require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		}
+	}
+
+	t.Run("split", func(t *testing.T) {
+		// each record fits in a message, but the page of all of them doesn't
+		client := newGRPCTestClient(t, WithMaxSendMsgSize(2500), WithMaxRecvMsgSize(10000))
+		putAll(client, false)
+
+		records, _, _, err := databroker.InitialSync(ctx, client, &databroker.SyncLatestRequest{})
+		require.NoError(t, err)
+		assert.Len(t, records, 10)
+
+		putAll(client, true)
+		_, _, _, err = databroker.InitialSync(ctx, client, &databroker.SyncLatestRequest{})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+	t.Run("skip", func(t *testing.T) {
+		client := newGRPCTestClient(t, WithMaxSendMsgSize(2500), WithMaxRecvMsgSize(10000),
+			WithOnOversizedPage(OversizedPageSkip))
+		putAll(client, true)
+
+		records, _, _, err := databroker.InitialSync(ctx, client, &databroker.SyncLatestRequest{})
+		require.NoError(t, err)
+		assert.Len(t, records, 10, "the record which doesn't fit should be skipped")
+	})
+}
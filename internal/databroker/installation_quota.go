@@ -0,0 +1,120 @@
+package databroker
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// An InstallationQuota limits the requests of an installation, so that one
+// installation can't starve the others. Zero values are unlimited.
+type InstallationQuota struct {
+	// RequestsPerSecond is the sustained rate of requests.
+	RequestsPerSecond float64
+	// Burst is the number of requests which may be made at once above the rate.
+	// If unset, it defaults to the rate, rounded up.
+	Burst int
+	// MaxConcurrentRequests is the maximum number of in-flight requests,
+	// including open streams.
+	MaxConcurrentRequests int
+}
+
+// installationQuotas enforces the quotas of each installation.
+type installationQuotas struct {
+	defaultQuota InstallationQuota
+	quotas       map[string]InstallationQuota
+
+	mu     sync.Mutex
+	states map[string]*installationQuotaState
+}
+
+type installationQuotaState struct {
+	limiter  *rate.Limiter
+	inFlight int
+}
+
+func newInstallationQuotas(quotas map[string]InstallationQuota) *installationQuotas {
+	iq := &installationQuotas{
+		quotas: make(map[string]InstallationQuota, len(quotas)),
+		states: make(map[string]*installationQuotaState),
+	}
+	for installationID, quota := range quotas {
+		if installationID == "" {
+			iq.defaultQuota = quota
+		} else {
+			iq.quotas[installationID] = quota
+		}
+	}
+	return iq
+}
+
+// acquire reserves a request for the installation of the request. The returned
+// function must be called once the request completes.
+func (iq *installationQuotas) acquire(ctx context.Context) (release func(), err error) {
+	installationID, _ := grpcutil.InstallationIDFromGRPCRequest(ctx)
+	quota, ok := iq.quotas[installationID]
+	if !ok {
+		quota = iq.defaultQuota
+	}
+
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+
+	state, ok := iq.states[installationID]
+	if !ok {
+		state = new(installationQuotaState)
+		if quota.RequestsPerSecond > 0 {
+			burst := quota.Burst
+			if burst <= 0 {
+				burst = int(math.Ceil(quota.RequestsPerSecond))
+			}
+			state.limiter = rate.NewLimiter(rate.Limit(quota.RequestsPerSecond), burst)
+		}
+		iq.states[installationID] = state
+	}
+
+	if quota.MaxConcurrentRequests > 0 && state.inFlight >= quota.MaxConcurrentRequests {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"installation %q exceeded its quota of %d concurrent requests", installationID, quota.MaxConcurrentRequests)
+	}
+	if state.limiter != nil && !state.limiter.Allow() {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"installation %q exceeded its quota of %g requests per second", installationID, quota.RequestsPerSecond)
+	}
+
+	state.inFlight++
+	return func() {
+		iq.mu.Lock()
+		state.inFlight--
+		iq.mu.Unlock()
+	}, nil
+}
+
+func (iq *installationQuotas) unaryInterceptor(
+	ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	release, err := iq.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+func (iq *installationQuotas) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	release, err := iq.acquire(ss.Context())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, ss)
+}
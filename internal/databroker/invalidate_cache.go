@@ -0,0 +1,42 @@
+package databroker
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// InvalidateCache drops records from the read cache, so that changes made to the
+// storage out-of-band, for example during maintenance, are observed without a
+// restart. Either the entire cache, every record of a type, or a single record
+// is invalidated.
+func (srv *Server) InvalidateCache(ctx context.Context, req *databroker.InvalidateCacheRequest) (*databroker.InvalidateCacheResponse, error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.grpc.InvalidateCache")
+	defer span.End()
+	srv.log.Info().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Str("type", req.GetType()).
+		Str("id", req.GetId()).
+		Msg("invalidate cache")
+
+	if req.GetType() == "" && req.GetId() != "" {
+		return nil, status.Error(codes.InvalidArgument, "invalidating a record by id requires a type")
+	}
+
+	backend, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	if !storage.InvalidateCache(backend, req.GetType(), req.GetId()) {
+		return nil, status.Error(codes.FailedPrecondition, "databroker read cache is not enabled")
+	}
+
+	return &databroker.InvalidateCacheResponse{ServerVersion: version}, nil
+}
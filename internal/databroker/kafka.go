@@ -0,0 +1,273 @@
+package databroker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+const (
+	// DefaultKafkaBufferSize is the default maximum number of record changes
+	// buffered for the Kafka topic.
+	DefaultKafkaBufferSize = 1000
+
+	kafkaProduceTimeout = 10 * time.Second
+)
+
+// A KafkaProducer produces messages to Kafka, such as with a Kafka client's
+// synchronous producer.
+type KafkaProducer interface {
+	// Produce produces a message with the given key and value to the topic. It
+	// returns once the message is acknowledged by the brokers.
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// A ChangeSerialization is the serialization of the record changes published to
+// Kafka.
+type ChangeSerialization int
+
+// Change serializations.
+const (
+	// ChangeSerializationJSON serializes a change as its JSON event, like the
+	// webhook events.
+	ChangeSerializationJSON ChangeSerialization = iota
+	// ChangeSerializationProtobuf serializes a change as its databroker.Record.
+	ChangeSerializationProtobuf
+	// ChangeSerializationCloudEvents serializes a change as a CloudEvents JSON
+	// event, with its JSON event as the data.
+	ChangeSerializationCloudEvents
+)
+
+// ParseChangeSerialization parses the name of a change serialization, as returned
+// by its String method.
+func ParseChangeSerialization(name string) (ChangeSerialization, error) {
+	for _, serialization := range []ChangeSerialization{
+		ChangeSerializationJSON,
+		ChangeSerializationProtobuf,
+		ChangeSerializationCloudEvents,
+	} {
+		if serialization.String() == name {
+			return serialization, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported change serialization: %s", name)
+}
+
+func (serialization ChangeSerialization) String() string {
+	switch serialization {
+	case ChangeSerializationJSON:
+		return "json"
+	case ChangeSerializationProtobuf:
+		return "protobuf"
+	case ChangeSerializationCloudEvents:
+		return "cloudevents"
+	}
+	return fmt.Sprintf("ChangeSerialization(%d)", int(serialization))
+}
+
+// A KafkaSink describes the Kafka topic record changes are published to.
+type KafkaSink struct {
+	// Brokers are the addresses of the Kafka brokers the changes are produced to,
+	// when no producer is given.
+	Brokers []string
+	// TLS sets whether the connections to the brokers use TLS, verified with the
+	// system certificate authorities.
+	TLS           bool
+	Topic         string
+	Serialization ChangeSerialization
+
+	// BufferSize is the maximum number of record changes buffered while Kafka is
+	// unavailable. 0 uses DefaultKafkaBufferSize.
+	BufferSize int
+	// IncludePayload sets whether the published changes include the data of the
+	// record. The data is sent decrypted, even with an encrypted storage.
+	IncludePayload bool
+}
+
+func (sink KafkaSink) withDefaults() KafkaSink {
+	if sink.BufferSize <= 0 {
+		sink.BufferSize = DefaultKafkaBufferSize
+	}
+	return sink
+}
+
+// WithKafkaSink publishes record changes to the Kafka topic of the sink with the
+// given producer. If the producer is nil, the changes are produced to the brokers
+// of the sink with a Kafka client, acknowledged once replicated to all the in-sync
+// replicas. Each change is keyed by the id of its record, so the changes of a
+// record land on the same partition, in order. Changes are read from the backend's
+// change feed, so writes never wait for Kafka: while Kafka is unavailable, changes
+// are buffered and their publish is retried with backoff, and once the buffer is
+// full the feed falls behind the change log until Kafka catches up.
+//
+// While the server runs, delivery is at least once, so consumers may see a change
+// again. The position of the feed isn't persisted though: when the server stops,
+// or the storage or the sink is reconfigured, the changes which are buffered or
+// not yet read are never published, and the new feed starts from the latest
+// change. Consumers which can't miss a change must resync, such as with
+// SyncLatest, after the databroker restarts.
+func WithKafkaSink(producer KafkaProducer, sink KafkaSink) ServerOption {
+	return func(cfg *serverConfig) {
+		sink = sink.withDefaults()
+		cfg.kafkaProducer = producer
+		cfg.kafkaSink = &sink
+	}
+}
+
+// A kafkaWriterProducer is a KafkaProducer which produces messages with a
+// kafka-go writer.
+type kafkaWriterProducer struct {
+	writer    *kafka.Writer
+	transport *kafka.Transport
+}
+
+func newKafkaWriterProducer(sink KafkaSink) *kafkaWriterProducer {
+	transport := &kafka.Transport{}
+	if sink.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return &kafkaWriterProducer{
+		writer: &kafka.Writer{
+			Addr:      kafka.TCP(sink.Brokers...),
+			Transport: transport,
+			// the changes of a record are keyed by its id, so that they land on the
+			// same partition
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// each change is produced on its own and retried by the publisher, so
+			// that the changes of a record are never reordered
+			BatchSize:   1,
+			MaxAttempts: 1,
+		},
+		transport: transport,
+	}
+}
+
+func (p *kafkaWriterProducer) Produce(ctx context.Context, topic string, key, value []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Topic: topic,
+		Key:   key,
+		Value: value,
+	})
+}
+
+func (p *kafkaWriterProducer) Close() error {
+	err := p.writer.Close()
+	p.transport.CloseIdleConnections()
+	return err
+}
+
+type kafkaMessage struct {
+	key, value []byte
+	version    uint64
+}
+
+// A kafkaPublisher publishes the record changes of a storage backend to a Kafka
+// topic, one at a time in version order.
+type kafkaPublisher struct {
+	log            zerolog.Logger
+	producer       KafkaProducer
+	sink           KafkaSink
+	installationID string
+	queue          chan kafkaMessage
+}
+
+// newKafkaPublisherLocked creates a Kafka publisher for the configured sink, and
+// starts its publishing until ctx is done. If no producer is configured, a Kafka
+// client is created for the brokers of the sink, and closed once ctx is done.
+func (srv *Server) newKafkaPublisherLocked(ctx context.Context) *kafkaPublisher {
+	producer := srv.cfg.kafkaProducer
+	if producer == nil {
+		writer := newKafkaWriterProducer(*srv.cfg.kafkaSink)
+		go func() {
+			<-ctx.Done()
+			if err := writer.Close(); err != nil {
+				srv.log.Warn().Err(err).Msg("failed to close kafka writer")
+			}
+		}()
+		producer = writer
+	}
+
+	p := &kafkaPublisher{
+		log:            srv.log,
+		producer:       producer,
+		sink:           *srv.cfg.kafkaSink,
+		installationID: srv.cfg.installationID,
+		queue:          make(chan kafkaMessage, srv.cfg.kafkaSink.BufferSize),
+	}
+	go p.publish(ctx)
+	return p
+}
+
+// enqueue queues the change for publishing. It blocks while the buffer is full,
+// so that no change is dropped.
+func (p *kafkaPublisher) enqueue(ctx context.Context, record *databroker.Record) {
+	value, err := p.marshal(record)
+	if err != nil {
+		p.log.Error().Err(err).
+			Str("type", record.GetType()).
+			Str("id", record.GetId()).
+			Msg("failed to marshal kafka record change")
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case p.queue <- kafkaMessage{key: []byte(record.GetId()), value: value, version: record.GetVersion()}:
+	}
+}
+
+func (p *kafkaPublisher) marshal(record *databroker.Record) ([]byte, error) {
+	switch p.sink.Serialization {
+	case ChangeSerializationJSON:
+		return marshalChangeEvent(record, p.sink.IncludePayload)
+	case ChangeSerializationProtobuf:
+		if !p.sink.IncludePayload {
+			record = proto.Clone(record).(*databroker.Record)
+			record.Data = nil
+		}
+		return proto.Marshal(record)
+	case ChangeSerializationCloudEvents:
+		return marshalCloudEvent(record, p.sink.IncludePayload, p.installationID)
+	}
+	return nil, fmt.Errorf("unsupported kafka serialization: %s", p.sink.Serialization)
+}
+
+// publish produces the queued changes in order, until ctx is done. A change is
+// retried with backoff until it's acknowledged, so that a later change of the same
+// record is never published before it.
+func (p *kafkaPublisher) publish(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-p.queue:
+			backoff := changeFeedRetryBackoff
+			for {
+				produceCtx, clearTimeout := context.WithTimeout(ctx, kafkaProduceTimeout)
+				err := p.producer.Produce(produceCtx, p.sink.Topic, msg.key, msg.value)
+				clearTimeout()
+				if err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				p.log.Warn().Err(err).
+					Str("topic", p.sink.Topic).
+					Uint64("record_version", msg.version).
+					Msg("failed to publish record change to kafka, retrying")
+				if !sleepContext(ctx, backoff) {
+					return
+				}
+				backoff = nextChangeFeedBackoff(backoff)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type fakeKafkaProducer struct {
+	mu       sync.Mutex
+	failures int
+	topics   []string
+	messages map[string][]*databroker.Record
+	count    int
+}
+
+func (producer *fakeKafkaProducer) Produce(ctx context.Context, topic string, key, value []byte) error {
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+
+	if producer.failures > 0 {
+		producer.failures--
+		return errors.New("kafka unavailable")
+	}
+	var record databroker.Record
+	if err := proto.Unmarshal(value, &record); err != nil {
+		return err
+	}
+	producer.topics = append(producer.topics, topic)
+	producer.messages[string(key)] = append(producer.messages[string(key)], &record)
+	producer.count++
+	return nil
+}
+
+func TestServer_KafkaSink(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	producer := &fakeKafkaProducer{failures: 3, messages: map[string][]*databroker.Record{}}
+	srv := New(WithKafkaSink(producer, KafkaSink{
+		Topic:         "changes",
+		Serialization: ChangeSerializationProtobuf,
+		BufferSize:    1,
+	}))
+	defer func() { _ = srv.Close() }()
+
+	// the writes don't wait for the unavailable producer
+	expected := map[string][]uint64{}
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"a", "b"} {
+			record := &databroker.Record{Type: "TYPE", Id: id}
+			if i == 2 {
+				record.DeletedAt = timestamppb.Now()
+			}
+			res, err := srv.Put(ctx, &databroker.PutRequest{Record: record})
+			require.NoError(t, err)
+			expected[id] = append(expected[id], res.GetRecord().GetVersion())
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		producer.mu.Lock()
+		defer producer.mu.Unlock()
+		return producer.count == 6
+	}, time.Second*5, time.Millisecond*10)
+
+	producer.mu.Lock()
+	defer producer.mu.Unlock()
+	for id, versions := range expected {
+		var published []uint64
+		for _, record := range producer.messages[id] {
+			assert.Equal(t, id, record.GetId())
+			published = append(published, record.GetVersion())
+		}
+		assert.Equal(t, versions, published, "the changes of %s should be published in order", id)
+		assert.NotNil(t, producer.messages[id][2].GetDeletedAt())
+	}
+	assert.Equal(t, []string{"changes", "changes", "changes", "changes", "changes", "changes"}, producer.topics)
+}
+
+// A fakeKafkaTransport is a kafka-go transport which stands in for a Kafka broker
+// with single partition topics.
+type fakeKafkaTransport struct {
+	mu       sync.Mutex
+	produced []kafka.Message
+}
+
+func (transport *fakeKafkaTransport) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	switch req := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{
+			Brokers: []metadataAPI.ResponseBroker{{Host: "localhost", Port: 9092}},
+		}
+		for _, topic := range req.TopicNames {
+			res.Topics = append(res.Topics, metadataAPI.ResponseTopic{
+				Name:       topic,
+				Partitions: []metadataAPI.ResponsePartition{{}},
+			})
+		}
+		return res, nil
+	case *produceAPI.Request:
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+
+		res := new(produceAPI.Response)
+		for _, topic := range req.Topics {
+			for _, partition := range topic.Partitions {
+				for {
+					record, err := partition.RecordSet.Records.ReadRecord()
+					if errors.Is(err, io.EOF) {
+						break
+					} else if err != nil {
+						return nil, err
+					}
+					key, err := protocol.ReadAll(record.Key)
+					if err != nil {
+						return nil, err
+					}
+					value, err := protocol.ReadAll(record.Value)
+					if err != nil {
+						return nil, err
+					}
+					transport.produced = append(transport.produced, kafka.Message{Topic: topic.Topic, Key: key, Value: value})
+				}
+			}
+			res.Topics = append(res.Topics, produceAPI.ResponseTopic{
+				Topic:      topic.Topic,
+				Partitions: []produceAPI.ResponsePartition{{}},
+			})
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unexpected kafka request: %T", req)
+}
+
+func TestKafkaWriterProducer(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	transport := new(fakeKafkaTransport)
+	producer := newKafkaWriterProducer(KafkaSink{Brokers: []string{"localhost:9092"}})
+	producer.writer.Transport = transport
+	defer func() { _ = producer.Close() }()
+
+	require.NoError(t, producer.Produce(ctx, "changes", []byte("a"), []byte("1")))
+	require.NoError(t, producer.Produce(ctx, "changes", []byte("b"), []byte("2")))
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	require.Len(t, transport.produced, 2)
+	for i, expected := range []kafka.Message{
+		{Topic: "changes", Key: []byte("a"), Value: []byte("1")},
+		{Topic: "changes", Key: []byte("b"), Value: []byte("2")},
+	} {
+		assert.Equal(t, expected.Topic, transport.produced[i].Topic)
+		assert.Equal(t, expected.Key, transport.produced[i].Key)
+		assert.Equal(t, expected.Value, transport.produced[i].Value)
+	}
+}
+
+func TestServer_KafkaSinkWithoutBrokers(t *testing.T) {
+	srv := New(WithKafkaSink(nil, KafkaSink{Topic: "changes"}))
+	defer func() { _ = srv.Close() }()
+
+	_, err := srv.Put(context.Background(), &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "a"},
+	})
+	assert.Error(t, err, "the storage shouldn't be initialized without kafka brokers")
+}
@@ -0,0 +1,66 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// A syncSender serializes sends on a Sync stream so that heartbeats can be sent
+// from a separate goroutine.
+type syncSender struct {
+	stream databroker.DataBrokerService_SyncServer
+
+	mu       sync.Mutex
+	lastSent time.Time
+}
+
+func newSyncSender(stream databroker.DataBrokerService_SyncServer) *syncSender {
+	return &syncSender{
+		stream:   stream,
+		lastSent: time.Now(),
+	}
+}
+
+func (s *syncSender) send(res *databroker.SyncResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSent = time.Now()
+	return s.stream.Send(res)
+}
+
+// runHeartbeats sends an empty SyncResponse whenever nothing has been sent on the
+// stream for the given interval. It returns when the context is done or a send
+// fails.
+func (s *syncSender) runHeartbeats(ctx context.Context, interval time.Duration, serverVersion uint64) error {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		s.mu.Lock()
+		idle := time.Since(s.lastSent)
+		var err error
+		if idle >= interval {
+			s.lastSent = time.Now()
+			idle = 0
+			err = s.stream.Send(&databroker.SyncResponse{
+				ServerVersion: serverVersion,
+			})
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		timer.Reset(interval - idle)
+	}
+}
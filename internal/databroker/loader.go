@@ -0,0 +1,117 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	// DefaultLoaderTTL is the default time loaded records are cached for.
+	DefaultLoaderTTL = time.Minute
+	// loadedRecordsCacheSize is the maximum number of loaded records cached.
+	loadedRecordsCacheSize = 10000
+)
+
+// A RecordLoader loads the record of its type with the given id from an external
+// source of truth. It returns storage.ErrNotFound if there's no such record.
+type RecordLoader func(ctx context.Context, id string) (*databroker.Record, error)
+
+type loadedRecordKey struct {
+	recordType, id string
+}
+
+type loadedRecord struct {
+	record    *databroker.Record
+	expiresAt time.Time
+}
+
+// recordLoads caches the records loaded by record loaders, and coalesces the
+// concurrent loads of the same record. The zero value is ready to use.
+type recordLoads struct {
+	group singleflight.Group
+
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+func (loads *recordLoads) get(key loadedRecordKey) (*databroker.Record, bool) {
+	loads.mu.Lock()
+	defer loads.mu.Unlock()
+
+	if loads.cache == nil {
+		return nil, false
+	}
+	v, ok := loads.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(loadedRecord)
+	if !time.Now().Before(entry.expiresAt) {
+		loads.cache.Remove(key)
+		return nil, false
+	}
+	return entry.record, true
+}
+
+func (loads *recordLoads) add(key loadedRecordKey, record *databroker.Record, ttl time.Duration) {
+	loads.mu.Lock()
+	defer loads.mu.Unlock()
+
+	if loads.cache == nil {
+		loads.cache, _ = lru.New(loadedRecordsCacheSize)
+	}
+	loads.cache.Add(key, loadedRecord{record: record, expiresAt: time.Now().Add(ttl)})
+}
+
+func (loads *recordLoads) invalidate(key loadedRecordKey) {
+	loads.mu.Lock()
+	defer loads.mu.Unlock()
+
+	if loads.cache != nil {
+		loads.cache.Remove(key)
+	}
+}
+
+// loadRecord returns the record of the given type and id from the loader for its
+// type, on a miss in the storage. Loaded records are cached for the loader ttl,
+// and concurrent misses for the same record share a single load. It returns
+// storage.ErrNotFound for types without a loader.
+func (srv *Server) loadRecord(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	cfg := srv.getConfig()
+	loader, ok := cfg.loaders[recordType]
+	if !ok || loader == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	key := loadedRecordKey{recordType: recordType, id: id}
+	if record, ok := srv.recordLoads.get(key); ok {
+		return proto.Clone(record).(*databroker.Record), nil
+	}
+
+	v, err, _ := srv.recordLoads.group.Do(recordType+"\x00"+id, func() (interface{}, error) {
+		record, err := loader(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if record.GetType() == "" {
+			record.Type = recordType
+		}
+		if record.GetId() == "" {
+			record.Id = id
+		}
+		srv.recordLoads.add(key, record, cfg.loaderTTL)
+		return record, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(v.(*databroker.Record)).(*databroker.Record), nil
+}
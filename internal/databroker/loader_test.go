@@ -0,0 +1,65 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestServer_Loader(t *testing.T) {
+	ctx := context.Background()
+
+	var loads int32
+	srv := newServer(newServerConfig(WithLoader("EXTERNAL", func(ctx context.Context, id string) (*databroker.Record, error) {
+		atomic.AddInt32(&loads, 1)
+		if id == "missing" {
+			return nil, storage.ErrNotFound
+		}
+		// give the concurrent misses time to coalesce
+		time.Sleep(50 * time.Millisecond)
+		data, err := anypb.New(wrapperspb.String("LOADED " + id))
+		if err != nil {
+			return nil, err
+		}
+		return &databroker.Record{Data: data}, nil
+	})))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := srv.Get(ctx, &databroker.GetRequest{Type: "EXTERNAL", Id: "1"})
+			if assert.NoError(t, err) {
+				assert.Equal(t, "1", res.GetRecord().GetId())
+				assert.Equal(t, "EXTERNAL", res.GetRecord().GetType())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "concurrent misses should share a load")
+
+	res, err := srv.Get(ctx, &databroker.GetRequest{Type: "EXTERNAL", Id: "1"})
+	require.NoError(t, err)
+	var data wrapperspb.StringValue
+	require.NoError(t, res.GetRecord().GetData().UnmarshalTo(&data))
+	assert.Equal(t, "LOADED 1", data.GetValue())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "the loaded record should be cached")
+
+	_, err = srv.Get(ctx, &databroker.GetRequest{Type: "EXTERNAL", Id: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = srv.Get(ctx, &databroker.GetRequest{Type: "OTHER", Id: "1"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "types without a loader shouldn't be loaded")
+}
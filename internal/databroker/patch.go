@@ -0,0 +1,156 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const recordLockStripes = 64
+
+// recordLocks serializes writes to the same record, so that a patch's read and
+// write aren't interleaved with other writes from this server.
+type recordLocks [recordLockStripes]sync.Mutex
+
+func (locks *recordLocks) lock(recordType, id string) (unlock func()) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(recordType))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(id))
+	mu := &locks[h.Sum32()%recordLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Patch updates individual fields of a record's data. The latest version of the
+// record is read, the fields are merged into it and the record is written back,
+// all while holding the record's lock, so concurrent patches to different fields
+// aren't lost. Writers on other servers sharing the storage aren't locked out, so
+// they should set the expected version to detect conflicts.
+func (srv *Server) Patch(ctx context.Context, req *databroker.PatchRequest) (*databroker.PatchResponse, error) {
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.Patch")
+	defer span.End()
+
+	log.Ctx(ctx).Info().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Str("type", req.GetType()).
+		Str("id", req.GetId()).
+		Int("fields", len(req.GetFields())).
+		Msg("patch")
+
+	if err := srv.checkSafeMode(); err != nil {
+		return nil, err
+	}
+
+	release, err := srv.syncOps.acquire(ctx, srv.getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	endWrite, err := srv.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer endWrite()
+
+	unlockRecord := srv.recordLocks.lock(req.GetType(), req.GetId())
+	defer unlockRecord()
+
+	db, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	// a stale cached record would cause the patch to overwrite newer changes
+	current, err := db.Get(storage.WithConsistency(ctx, storage.ConsistencyStrong), req.GetType(), req.GetId())
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && current.GetDeletedAt() != nil) {
+		return nil, status.Error(codes.NotFound, "record not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if req.GetExpectedVersion() != 0 && req.GetExpectedVersion() != current.GetVersion() {
+		return nil, status.Errorf(codes.Aborted,
+			"record %s/%s is at version %d, expected version %d",
+			req.GetType(), req.GetId(), current.GetVersion(), req.GetExpectedVersion())
+	}
+
+	record := proto.Clone(current).(*databroker.Record)
+	record.Data, err = applyPatch(record.GetData(), req.GetFields())
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.validateRecord(record); err != nil {
+		return nil, err
+	}
+
+	srv.stampLastWriter(ctx, req.GetActor(), record)
+	srv.recordRecordBytes(ctx, record)
+	if err := db.Put(ctx, record); err != nil {
+		return nil, err
+	}
+	srv.recordLastWrite(ctx, record.GetType(), record.GetModifiedAt().AsTime())
+	if err := srv.writeAuditEvents(ctx, newAuditEvent("patch", record)); err != nil {
+		return nil, err
+	}
+	return &databroker.PatchResponse{
+		ServerVersion: version,
+		Record:        record,
+	}, nil
+}
+
+// applyPatch sets the given top-level fields of the data. Fields are named by
+// their JSON or proto name and their values are parsed from their JSON
+// representation.
+func applyPatch(data *anypb.Any, fields map[string]*structpb.Value) (*anypb.Any, error) {
+	if data == nil {
+		return nil, status.Error(codes.FailedPrecondition, "record has no data to patch")
+	}
+	msg, err := data.UnmarshalNew()
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to unmarshal record data: %v", err)
+	}
+
+	bs, err := protojson.Marshal(&structpb.Struct{Fields: fields})
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid patch: %v", err)
+	}
+	patch := msg.ProtoReflect().New()
+	if err := protojson.Unmarshal(bs, patch.Interface()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid patch: %v", err)
+	}
+
+	dst := msg.ProtoReflect()
+	fds := dst.Descriptor().Fields()
+	for name := range fields {
+		fd := fds.ByJSONName(name)
+		if fd == nil {
+			fd = fds.ByName(protoreflect.Name(name))
+		}
+		if fd == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid patch: unknown field %s", name)
+		}
+
+		if patch.Has(fd) {
+			dst.Set(fd, patch.Get(fd))
+		} else {
+			dst.Clear(fd)
+		}
+	}
+
+	return anypb.New(msg)
+}
@@ -0,0 +1,39 @@
+package databroker
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// checkProtocolVersion rejects clients which advertise a sync protocol version
+// below the configured minimum. Clients which don't advertise one predate
+// versioning, so they are rejected too.
+func (srv *Server) checkProtocolVersion(ctx context.Context) error {
+	minVersion := srv.getConfig().minProtocolVersion
+	if minVersion <= 0 {
+		return nil
+	}
+
+	version, ok := grpcutil.ProtocolVersionFromGRPCRequest(ctx)
+	if ok && version >= minVersion {
+		return nil
+	}
+
+	srv.log.Warn().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Int("protocol_version", version).
+		Int("min_protocol_version", minVersion).
+		Msg("rejected client below the minimum protocol version")
+	if !ok {
+		return status.Errorf(codes.FailedPrecondition,
+			"client did not advertise a protocol version, the minimum supported version is %d: upgrade the client",
+			minVersion)
+	}
+	return status.Errorf(codes.FailedPrecondition,
+		"client protocol version %d is below the minimum supported version %d: upgrade the client",
+		version, minVersion)
+}
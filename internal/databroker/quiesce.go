@@ -0,0 +1,116 @@
+package databroker
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// DefaultQuiesceTimeout is the default maximum time the server remains quiesced.
+const DefaultQuiesceTimeout = time.Minute
+
+type quiesceState struct {
+	timer *time.Timer
+}
+
+// Quiesce pauses new writes, waits for in-flight writes to complete and flushes
+// the storage backend, for example so that a consistent backup can be taken.
+// Writes made while quiesced wait until Unquiesce is called or the timeout
+// elapses, after which writes resume automatically.
+func (srv *Server) Quiesce(ctx context.Context, req *databroker.QuiesceRequest) (*databroker.QuiesceResponse, error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.grpc.Quiesce")
+	defer span.End()
+
+	timeout := DefaultQuiesceTimeout
+	if req.Timeout != nil {
+		timeout = req.GetTimeout().AsDuration()
+		if timeout <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "quiesce timeout must be positive: %s", timeout)
+		}
+	}
+	deadline := time.Now().Add(timeout)
+
+	srv.quiesceMu.Lock()
+	defer srv.quiesceMu.Unlock()
+
+	if srv.quiesce != nil {
+		return nil, status.Error(codes.FailedPrecondition, "databroker is already quiesced")
+	}
+
+	// acquiring the write lock waits for all in-flight writes to complete, and
+	// queues any new writes until it is released
+	acquired := make(chan struct{})
+	go func() {
+		srv.writeMu.Lock()
+		close(acquired)
+	}()
+
+	waitCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	select {
+	case <-waitCtx.Done():
+		go func() {
+			<-acquired
+			srv.writeMu.Unlock()
+		}()
+		return nil, status.Error(codes.DeadlineExceeded, "timed out waiting for in-flight writes to complete")
+	case <-acquired:
+	}
+
+	backend, version, err := srv.getBackend()
+	if err == nil {
+		err = storage.Flush(waitCtx, backend)
+	}
+	if err != nil {
+		srv.writeMu.Unlock()
+		return nil, status.Errorf(codes.Internal, "failed to flush storage: %v", err)
+	}
+
+	state := &quiesceState{}
+	state.timer = time.AfterFunc(time.Until(deadline), func() {
+		srv.quiesceMu.Lock()
+		defer srv.quiesceMu.Unlock()
+
+		if srv.quiesce != state {
+			return
+		}
+		srv.log.Warn().Dur("timeout", timeout).Msg("quiesce timed out, resuming writes")
+		srv.unquiesceLocked()
+	})
+	srv.quiesce = state
+
+	srv.log.Info().Dur("timeout", timeout).Msg("quiesced")
+	return &databroker.QuiesceResponse{ServerVersion: version}, nil
+}
+
+// Unquiesce resumes writes paused by Quiesce. Calling it when the server isn't
+// quiesced does nothing.
+func (srv *Server) Unquiesce(ctx context.Context, req *databroker.UnquiesceRequest) (*databroker.UnquiesceResponse, error) {
+	_, span := trace.StartSpan(ctx, "databroker.grpc.Unquiesce")
+	defer span.End()
+
+	srv.quiesceMu.Lock()
+	if srv.quiesce != nil {
+		srv.quiesce.timer.Stop()
+		srv.unquiesceLocked()
+		srv.log.Info().Msg("unquiesced")
+	}
+	srv.quiesceMu.Unlock()
+
+	_, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.UnquiesceResponse{ServerVersion: version}, nil
+}
+
+func (srv *Server) unquiesceLocked() {
+	srv.quiesce = nil
+	srv.writeMu.Unlock()
+}
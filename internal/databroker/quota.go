@@ -0,0 +1,88 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// lockRecordQuota checks that putting the record won't exceed the quota for its
+// type. Updates to existing records and deletes are always allowed. The returned
+// function must be called once the record has been put, so that concurrent puts
+// can't exceed the quota.
+func (srv *Server) lockRecordQuota(ctx context.Context, db storage.Backend, record *databroker.Record) (unlock func(), err error) {
+	quota, ok := srv.getConfig().recordQuotas[record.GetType()]
+	if !ok || record.GetDeletedAt() != nil {
+		return func() {}, nil
+	}
+
+	srv.quotaMu.Lock()
+	unlock = srv.quotaMu.Unlock
+
+	_, err = db.Get(ctx, record.GetType(), record.GetId())
+	switch {
+	case err == nil:
+		return unlock, nil
+	case errors.Is(err, storage.ErrNotFound):
+	default:
+		unlock()
+		return nil, err
+	}
+
+	count, err := countRecords(ctx, db, record.GetType())
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if count >= quota {
+		unlock()
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"record %s/%s would exceed the quota of %d records for the type",
+			record.GetType(), record.GetId(), quota)
+	}
+	return unlock, nil
+}
+
+// lockRecordQuotaForReplaceAll checks that replacing all the records of a type
+// won't exceed the quota for the type.
+func (srv *Server) lockRecordQuotaForReplaceAll(recordType string, records []*databroker.Record) (unlock func(), err error) {
+	quota, ok := srv.getConfig().recordQuotas[recordType]
+	if !ok {
+		return func() {}, nil
+	}
+
+	count := 0
+	for _, record := range records {
+		if record.GetDeletedAt() == nil {
+			count++
+		}
+	}
+	if count > quota {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"%d records would exceed the quota of %d records for type %s",
+			count, quota, recordType)
+	}
+
+	srv.quotaMu.Lock()
+	return srv.quotaMu.Unlock, nil
+}
+
+func countRecords(ctx context.Context, db storage.Backend, recordType string) (int, error) {
+	records, _, err := db.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, record := range records {
+		if record.GetType() == recordType && record.GetDeletedAt() == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,64 @@
+package databroker
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// builtinRecordTypes returns the record types stored by pomerium itself.
+func builtinRecordTypes() []string {
+	return []string{
+		grpcutil.GetTypeURL(new(directory.Group)),
+		grpcutil.GetTypeURL(new(directory.User)),
+		grpcutil.GetTypeURL(new(session.Session)),
+		grpcutil.GetTypeURL(new(user.ServiceAccount)),
+		grpcutil.GetTypeURL(new(user.User)),
+	}
+}
+
+var builtinRecordTypeSet = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, recordType := range builtinRecordTypes() {
+		set[recordType] = struct{}{}
+	}
+	return set
+}()
+
+// isKnownRecordType returns true if the record type is one of the built-in record
+// types or the known record types.
+func (cfg *serverConfig) isKnownRecordType(recordType string) bool {
+	if _, ok := builtinRecordTypeSet[recordType]; ok {
+		return true
+	}
+	for _, known := range cfg.storageKnownRecordTypes {
+		if recordType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTypeLabel returns the record type to use as a metric label. To bound
+// cardinality, record types other than the built-in record types and the known
+// record types are reported as "other".
+func (cfg *serverConfig) recordTypeLabel(recordType string) string {
+	if cfg.isKnownRecordType(recordType) {
+		return recordType
+	}
+	return metrics.StorageRecordTypeOther
+}
+
+// checkRecordType returns an InvalidArgument error if strict record types are
+// enabled and the record type is unknown.
+func (cfg *serverConfig) checkRecordType(recordType string) error {
+	if !cfg.strictRecordTypes || cfg.isKnownRecordType(recordType) {
+		return nil
+	}
+	return status.Errorf(codes.InvalidArgument, "unknown record type: %s", recordType)
+}
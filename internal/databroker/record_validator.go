@@ -0,0 +1,29 @@
+package databroker
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// A RecordValidator checks that the payload of a record is valid before it's
+// written. The returned error describes why the record is invalid.
+type RecordValidator func(record *databroker.Record) error
+
+// validateRecord returns an error if the record is rejected by the validator
+// registered for its type. Records of types without a validator and deletions
+// are always accepted.
+func (srv *Server) validateRecord(record *databroker.Record) error {
+	if record.GetDeletedAt() != nil {
+		return nil
+	}
+	validate, ok := srv.getConfig().recordValidators[record.GetType()]
+	if !ok || validate == nil {
+		return nil
+	}
+	if err := validate(record); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid record %s/%s: %v", record.GetType(), record.GetId(), err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// setReplicaLag sets the latest record version of the primary in the versions,
+// along with how far the records lag behind it, if the backend may read from a
+// replica. The primary version is read after the records, so the lag may be
+// overstated by the writes made meanwhile, but is never understated.
+func (srv *Server) setReplicaLag(ctx context.Context, backend storage.Backend, versions *databroker.Versions) {
+	primaryVersion, err := storage.PrimaryVersion(ctx, backend)
+	if errors.Is(err, storage.ErrUnsupported) {
+		return
+	} else if err != nil {
+		srv.log.Warn().Err(err).
+			Str("peer", grpcutil.GetPeerAddr(ctx)).
+			Msg("failed to get the primary version, not reporting replica lag")
+		return
+	}
+
+	versions.PrimaryRecordVersion = primaryVersion
+	if primaryVersion > versions.GetLatestRecordVersion() {
+		versions.ReplicaLag = primaryVersion - versions.GetLatestRecordVersion()
+	}
+}
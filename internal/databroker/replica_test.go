@@ -0,0 +1,85 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// A laggingReplicaBackend reads from a replica which lags behind the primary.
+type laggingReplicaBackend struct {
+	storage.Backend
+	primary storage.Backend
+}
+
+func (backend *laggingReplicaBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	_, version, err := backend.primary.GetAll(ctx)
+	return version, err
+}
+
+func TestServer_ReplicaLag(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	primary, replica := inmemory.New(), inmemory.New()
+	for i := 1; i <= 5; i++ {
+		record := &databroker.Record{Type: "TYPE", Id: fmt.Sprint(i)}
+		require.NoError(t, primary.Put(ctx, record))
+		// the replica hasn't caught up with the last 3 changes
+		if i <= 2 {
+			require.NoError(t, replica.Put(ctx, record))
+		}
+	}
+
+	latestVersions := func(t *testing.T, srv *Server, req *databroker.SyncLatestRequest) *databroker.Versions {
+		client := newTestClient(t, srv)
+		stream, err := client.SyncLatest(ctx, req)
+		require.NoError(t, err)
+		for {
+			res, err := stream.Recv()
+			require.NoError(t, err)
+			if versions := res.GetVersions(); versions != nil {
+				return versions
+			}
+		}
+	}
+
+	t.Run("report", func(t *testing.T) {
+		srv := newServer(newServerConfig(WithReportReplicaLag(true)))
+		srv.backend = &laggingReplicaBackend{Backend: replica, primary: primary}
+
+		for _, req := range []*databroker.SyncLatestRequest{
+			{},
+			{SortBy: "id"},
+		} {
+			versions := latestVersions(t, srv, req)
+			assert.Equal(t, uint64(2), versions.GetLatestRecordVersion(), "the version should be the replica's")
+			assert.Equal(t, uint64(5), versions.GetPrimaryRecordVersion())
+			assert.Equal(t, uint64(3), versions.GetReplicaLag())
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		srv := newServer(newServerConfig())
+		srv.backend = &laggingReplicaBackend{Backend: replica, primary: primary}
+
+		versions := latestVersions(t, srv, &databroker.SyncLatestRequest{})
+		assert.Zero(t, versions.GetPrimaryRecordVersion())
+		assert.Zero(t, versions.GetReplicaLag())
+	})
+	t.Run("no replica", func(t *testing.T) {
+		srv := newServer(newServerConfig(WithReportReplicaLag(true)))
+		srv.backend = primary
+
+		versions := latestVersions(t, srv, &databroker.SyncLatestRequest{})
+		assert.Equal(t, uint64(5), versions.GetLatestRecordVersion())
+		assert.Zero(t, versions.GetPrimaryRecordVersion(), "nothing should be reported without a replica")
+	})
+}
@@ -0,0 +1,27 @@
+package databroker
+
+import (
+	"context"
+
+	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// startRequestSpan starts the span of a call, tagged with the call's request id.
+// The request id is taken from the incoming metadata, or generated if the caller
+// didn't send one. The returned context carries the span, the request id and a
+// logger which includes it, so that the storage operations made for the call are
+// traced and logged with the same request id.
+func (srv *Server) startRequestSpan(ctx context.Context, name string) (context.Context, *octrace.Span) {
+	requestID := requestid.FromIncomingContext(ctx)
+	ctx = requestid.WithValue(ctx, requestID)
+	logger := srv.log.With().Str(storage.RequestIDAttribute, requestID).Logger()
+	ctx = logger.WithContext(ctx)
+
+	ctx, span := trace.StartSpan(ctx, name)
+	span.AddAttributes(octrace.StringAttribute(storage.RequestIDAttribute, requestID))
+	return ctx, span
+}
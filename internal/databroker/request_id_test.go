@@ -0,0 +1,82 @@
+package databroker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestServer_RequestID(t *testing.T) {
+	exporter := new(testSpanExporter)
+	octrace.RegisterExporter(exporter)
+	defer octrace.UnregisterExporter(exporter)
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.AlwaysSample()})
+	defer octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(1e-4)})
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	var buf bytes.Buffer
+	srv := newServer(newServerConfig())
+	srv.log = zerolog.New(&buf).Level(zerolog.DebugLevel)
+	client := newTestClient(t, srv)
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", "REQUEST-1")
+	_, err := client.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1"},
+	})
+	require.NoError(t, err)
+	_, err = client.Get(ctx, &databroker.GetRequest{Type: "TYPE", Id: "1"})
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"databroker.grpc.Put", "databroker.storage.Put",
+		"databroker.grpc.Get", "databroker.storage.Get",
+	} {
+		var sd *octrace.SpanData
+		require.Eventually(t, func() bool {
+			sd = exporter.find(name)
+			return sd != nil
+		}, time.Second*5, time.Millisecond*10, "%s span should be exported", name)
+		assert.Equal(t, "REQUEST-1", sd.Attributes["request-id"], "%s span should carry the request id", name)
+	}
+	assert.Equal(t, exporter.find("databroker.grpc.Get").SpanID, exporter.find("databroker.storage.Get").ParentSpanID,
+		"storage spans should be children of the request's span")
+
+	operations := map[string]string{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		switch entry["message"] {
+		case "get", "put":
+			assert.Equal(t, "REQUEST-1", entry["request-id"], "%s should be logged with the request id", entry["message"])
+		case "storage: operation":
+			operations[entry["operation"].(string)], _ = entry["request-id"].(string)
+		}
+	}
+	assert.Equal(t, "REQUEST-1", operations["get"], "storage operations should be logged with the request id")
+	assert.Equal(t, "REQUEST-1", operations["put"], "storage operations should be logged with the request id")
+
+	t.Run("generated", func(t *testing.T) {
+		ctx, span := srv.startRequestSpan(context.Background(), "test")
+		defer span.End()
+		var logged bytes.Buffer
+		logger := zerolog.Ctx(ctx).Output(&logged)
+		logger.Info().Msg("test")
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(logged.Bytes(), &entry))
+		assert.NotEmpty(t, entry["request-id"], "a request id should be generated")
+	})
+}
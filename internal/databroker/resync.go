@@ -0,0 +1,110 @@
+package databroker
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// DefaultResyncSnapshotMaxAge is the default time the snapshot of the records is
+// shared between re-syncs, under the coordinated re-sync policy.
+const DefaultResyncSnapshotMaxAge = 5 * time.Second
+
+// resyncSnapshot is a snapshot of all the records of the storage, as of the latest
+// record version.
+type resyncSnapshot struct {
+	serverVersion       uint64
+	records             []*databroker.Record
+	latestRecordVersion uint64
+	takenAt             time.Time
+}
+
+// resyncCoordinator coordinates the re-syncs of SyncLatest under the coordinated
+// re-sync policy: concurrent re-syncs share a single read of the records, which
+// is kept for the snapshot max age, and at most the re-sync concurrency are
+// admitted at once. The zero value is ready to use.
+type resyncCoordinator struct {
+	group singleflight.Group
+
+	mu       sync.Mutex
+	slots    chan struct{}
+	snapshot *resyncSnapshot
+}
+
+// admit waits until the re-sync can be served, while at most limit are served at
+// once. The returned function must be called once the re-sync is done.
+func (c *resyncCoordinator) admit(ctx context.Context, limit int) (release func(), err error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	if c.slots == nil || cap(c.slots) != limit {
+		// re-syncs admitted before a change of the limit release their old slots
+		c.slots = make(chan struct{}, limit)
+	}
+	slots := c.slots
+	c.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return func() { <-slots }, nil
+}
+
+// getSnapshot returns a snapshot of all the records of the backend. A snapshot
+// of the same server version taken less than maxAge ago is reused, and concurrent
+// calls share a single read.
+func (c *resyncCoordinator) getSnapshot(backend storage.Backend, serverVersion uint64, maxAge time.Duration) (*resyncSnapshot, error) {
+	c.mu.Lock()
+	snapshot := c.snapshot
+	c.mu.Unlock()
+	if snapshot != nil && snapshot.serverVersion == serverVersion && time.Since(snapshot.takenAt) < maxAge {
+		return snapshot, nil
+	}
+
+	v, err, _ := c.group.Do(strconv.FormatUint(serverVersion, 10), func() (interface{}, error) {
+		// the read isn't bound to any one re-sync, so that a client going away
+		// doesn't fail the others sharing it
+		records, latestRecordVersion, err := backend.GetAll(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		snapshot := &resyncSnapshot{
+			serverVersion:       serverVersion,
+			records:             records,
+			latestRecordVersion: latestRecordVersion,
+			takenAt:             time.Now(),
+		}
+		if maxAge > 0 {
+			c.mu.Lock()
+			c.snapshot = snapshot
+			c.mu.Unlock()
+			time.AfterFunc(maxAge, func() { c.clearSnapshot(snapshot) })
+		}
+		return snapshot, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*resyncSnapshot), nil
+}
+
+// clearSnapshot drops the snapshot once it's too old to be shared, so that the
+// records aren't held on to.
+func (c *resyncCoordinator) clearSnapshot(snapshot *resyncSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.snapshot == snapshot {
+		c.snapshot = nil
+	}
+}
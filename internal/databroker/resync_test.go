@@ -0,0 +1,119 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// getAllCountingBackend counts the reads of all the records, and the most reads
+// in progress at once.
+type getAllCountingBackend struct {
+	storage.Backend
+	delay time.Duration
+
+	mu            sync.Mutex
+	calls         int
+	inFlight      int
+	maxConcurrent int
+}
+
+func (backend *getAllCountingBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	backend.mu.Lock()
+	backend.calls++
+	backend.inFlight++
+	if backend.inFlight > backend.maxConcurrent {
+		backend.maxConcurrent = backend.inFlight
+	}
+	backend.mu.Unlock()
+
+	time.Sleep(backend.delay)
+
+	backend.mu.Lock()
+	backend.inFlight--
+	backend.mu.Unlock()
+	return backend.Backend.GetAll(ctx)
+}
+
+func TestServer_Resync(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	const clients = 5
+
+	// resync compacts the change log past the version of several clients, and
+	// re-syncs every one of them at once
+	resync := func(t *testing.T, options ...ServerOption) *getAllCountingBackend {
+		srv := newServer(newServerConfig(options...))
+		counting := &getAllCountingBackend{Backend: inmemory.New(), delay: 20 * time.Millisecond}
+		srv.backend = &compactingBackend{Backend: counting, compacted: 3}
+		client := newTestClient(t, srv)
+
+		for i := 0; i < 5; i++ {
+			_, err := srv.Put(ctx, &databroker.PutRequest{
+				Record: &databroker.Record{Type: "TYPE", Id: fmt.Sprint(i)},
+			})
+			require.NoError(t, err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func(recordVersion uint64) {
+				defer wg.Done()
+
+				stream, err := client.Sync(ctx, &databroker.SyncRequest{ServerVersion: srv.version, RecordVersion: recordVersion})
+				require.NoError(t, err)
+				_, err = stream.Recv()
+				assert.Equal(t, codes.Aborted, status.Code(err))
+
+				latest, err := client.SyncLatest(ctx, &databroker.SyncLatestRequest{})
+				require.NoError(t, err)
+				var records int
+				for {
+					res, err := latest.Recv()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(t, err)
+					if res.GetRecord() != nil {
+						records++
+					}
+				}
+				assert.Equal(t, 5, records)
+			}(uint64(i % 2))
+		}
+		wg.Wait()
+		return counting
+	}
+
+	t.Run("independent", func(t *testing.T) {
+		backend := resync(t)
+		assert.Equal(t, clients, backend.calls)
+		assert.Greater(t, backend.maxConcurrent, 1)
+	})
+	t.Run("shared snapshot", func(t *testing.T) {
+		backend := resync(t, WithOnResync(ResyncCoordinated))
+		assert.Equal(t, 1, backend.calls, "the re-syncs should share a snapshot")
+	})
+	t.Run("staggered", func(t *testing.T) {
+		backend := resync(t,
+			WithOnResync(ResyncCoordinated),
+			WithResyncConcurrency(1),
+			WithResyncSnapshotMaxAge(0))
+		assert.Equal(t, clients, backend.calls)
+		assert.Equal(t, 1, backend.maxConcurrent, "the re-syncs should be admitted one at a time")
+	})
+}
@@ -2,27 +2,36 @@
 package databroker
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/firestore"
 	"github.com/pomerium/pomerium/pkg/storage/inmemory"
 	"github.com/pomerium/pomerium/pkg/storage/redis"
 )
@@ -40,6 +49,47 @@ type Server struct {
 	mu      sync.RWMutex
 	version uint64
 	backend storage.Backend
+	// secretRotators are the encrypted backends of the backend, and
+	// rotatedSecrets the shared keys they were rotated from in place
+	secretRotators []storage.SecretRotator
+	rotatedSecrets [][]byte
+	// stopChangeFeeds stops the change feeds of the backend
+	stopChangeFeeds func()
+	// stopStorageSecretWatch stops watching the storage secret for changes
+	stopStorageSecretWatch func()
+	// storageInitErr is set while the server is degraded after the storage failed
+	// to initialize, and stopStorageInitRetry stops retrying it
+	storageInitErr       error
+	stopStorageInitRetry func()
+
+	syncStreams   int64
+	syncOps       operationLimiter
+	syncScheduler syncScheduler
+	syncPauses    syncPauses
+	recordLoads   recordLoads
+	resyncs       resyncCoordinator
+	auditLog      auditLog
+
+	// quotaMu serializes writes to record types with a quota
+	quotaMu sync.Mutex
+	// uniqueIDMu serializes writes when ids are globally unique
+	uniqueIDMu sync.Mutex
+	// recordLocks serializes writes to the same record
+	recordLocks recordLocks
+
+	// quiesceMu guards quiesce, which is set while writes are paused by Quiesce
+	quiesceMu sync.Mutex
+	quiesce   *quiesceState
+
+	writeMu       sync.RWMutex
+	draining      int32
+	drainOnce     sync.Once
+	drainInitOnce sync.Once
+	drained       chan struct{}
+
+	writesDrainedOnce     sync.Once
+	writesDrainedInitOnce sync.Once
+	writesDrained         chan struct{}
 }
 
 // New creates a new server.
@@ -51,11 +101,17 @@ func New(options ...ServerOption) *Server {
 	return srv
 }
 
-func (srv *Server) initVersion() {
+// initVersion creates the storage backend, and gets the server version from it,
+// or saves a new one. An error is returned if the storage can't be reached.
+//
+// Reading the server version record doubles as the storage health check: none of
+// the supported backends (memory, redis, firestore) is SQL, so there is no fixed
+// probe query to replace, and the read already exercises the records keyspace and
+// the permissions to it.
+func (srv *Server) initVersion() error {
 	db, _, err := srv.getBackendLocked()
 	if err != nil {
-		log.Error().Err(err).Msg("failed to init server version")
-		return
+		return fmt.Errorf("failed to init server version: %w", err)
 	}
 
 	// Get version from storage first.
@@ -67,11 +123,10 @@ func (srv *Server) initVersion() {
 			srv.log.Debug().Uint64("server_version", sv.Value).Msg("got db version from Backend")
 			srv.version = sv.Value
 		}
-		return
+		return nil
 	case errors.Is(err, storage.ErrNotFound): // no server version, so we'll create a new one
 	case err != nil:
-		log.Error().Err(err).Msg("failed to retrieve server version")
-		return
+		return fmt.Errorf("failed to retrieve server version: %w", err)
 	}
 
 	srv.version = cryptutil.NewRandomUInt64()
@@ -83,6 +138,7 @@ func (srv *Server) initVersion() {
 	}); err != nil {
 		srv.log.Warn().Err(err).Msg("failed to save server version.")
 	}
+	return nil
 }
 
 // UpdateConfig updates the server with the new options.
@@ -90,58 +146,180 @@ func (srv *Server) UpdateConfig(options ...ServerOption) {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
 
+	srv.stopStorageSecretWatchLocked()
 	cfg := newServerConfig(options...)
-	if cmp.Equal(cfg, srv.cfg, cmp.AllowUnexported(serverConfig{})) {
+	unresolved := *cfg
+	resolveStorageSecret(cfg)
+	srv.updateConfigLocked(cfg)
+	srv.watchStorageSecretLocked(unresolved)
+}
+
+// updateConfigLocked updates the server with the new config, re-creating the
+// storage backend if anything which affects it changed.
+func (srv *Server) updateConfigLocked(cfg *serverConfig) {
+	srv.recordSharedKeyChangeLocked(cfg)
+	if configEqual(cfg, srv.cfg) {
 		log.Debug().Msg("databroker: no changes detected, re-using existing DBs")
+		srv.cfg = cfg
 		return
 	}
+	if srv.rotateSharedKeyLocked(cfg) {
+		srv.cfg = cfg
+		return
+	}
+	if srv.cfg == nil {
+		srv.logStartup(cfg)
+	}
+	if cfg.invalidSharedKey {
+		srv.log.Error().Msg(errInvalidSharedKeyMessage)
+	}
+	if cfg.requestedRetention != cfg.deletePermanentlyAfter {
+		srv.log.Warn().
+			Dur("delete_permanently_after", cfg.requestedRetention).
+			Dur("minimum_retention", cfg.minimumRetention).
+			Msg("delete permanently after is below the minimum retention, using the minimum retention")
+	}
+	for recordType, dur := range cfg.deletePermanentlyAfterByType {
+		if dur < cfg.minimumRetention {
+			srv.log.Warn().
+				Str("type", recordType).
+				Dur("delete_permanently_after", dur).
+				Dur("minimum_retention", cfg.minimumRetention).
+				Msg("delete permanently after for type is below the minimum retention, using the minimum retention")
+		}
+	}
 	srv.cfg = cfg
+	metrics.SetDataBrokerDeletePermanentlyAfter(context.Background(), cfg.deletePermanentlyAfter)
+	setConfigInfoMetric(cfg)
 
+	srv.stopStorageInitRetryLocked()
 	if srv.backend != nil {
+		srv.stopChangeFeedsLocked()
 		err := srv.backend.Close()
 		if err != nil {
 			log.Error().Err(err).Msg("databroker: error closing backend")
 		}
 		srv.backend = nil
 	}
+	srv.secretRotators, srv.rotatedSecrets = nil, nil
+
+	srv.initStorageLocked()
+}
+
+// configEqual reports whether the configs are the same, apart from the given
+// fields. Functions and clients can't be compared, and neither the id generator,
+// the record validators, the loaders, the delete strategies nor the storage secret
+// client affect the backend, so they're always ignored. The storage settings resolved
+// from the storage secret are compared instead of its client, the Kafka sink
+// instead of its producer, and whether records are signed instead of the signer
+// and verifiers.
+func configEqual(a, b *serverConfig, ignoredFields ...string) bool {
+	ignoredFields = append([]string{"idGenerator", "recordValidators", "loaders", "deleteStrategies",
+		"storageSecretClient", "kafkaProducer", "recordSigner", "recordVerifiers", "auditSink"}, ignoredFields...)
+	return cmp.Equal(a, b, cmp.AllowUnexported(serverConfig{}),
+		cmpopts.IgnoreFields(serverConfig{}, ignoredFields...))
+}
+
+// Close closes the storage backend. For the in-memory backend this persists its
+// state if a persist path is set.
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.stopStorageSecretWatchLocked()
+	srv.stopStorageInitRetryLocked()
+	srv.auditLog.stop(srv.log)
+	if srv.backend == nil {
+		return nil
+	}
+	srv.stopChangeFeedsLocked()
+	err := srv.backend.Close()
+	srv.backend = nil
+	srv.secretRotators, srv.rotatedSecrets = nil, nil
+	return err
+}
+
+// logStartup logs a single event summarizing the effective configuration. Secrets
+// are never logged.
+func (srv *Server) logStartup(cfg *serverConfig) {
+	srv.log.Info().
+		Str("storage_type", cfg.storageType).
+		Str("storage_connection_string", redactConnectionString(cfg.storageConnectionString)).
+		Int("get_all_page_size", cfg.getAllPageSize).
+		Dur("delete_permanently_after", cfg.deletePermanentlyAfter).
+		Bool("storage_tls_client_certificate", cfg.storageCertificate != nil || len(cfg.storageCertificatePEM) > 0).
+		Bool("storage_tls_custom_ca", len(cfg.storageCAFilePaths()) > 0 || len(cfg.storageCAPEM) > 0).
+		Bool("storage_tls_skip_verify", cfg.storageCertSkipVerify).
+		Bool("encryption_at_rest", cfg.secret != nil && cfg.storageType != config.StorageInMemoryName).
+		Str("listen_address", cfg.listenAddress).
+		Msg("startup")
+}
 
-	srv.initVersion()
+func redactConnectionString(connStr string) string {
+	if connStr == "" {
+		return ""
+	}
+	u, err := url.Parse(connStr)
+	if err != nil || u.Scheme == "" {
+		return "REDACTED"
+	}
+	return u.Redacted()
 }
 
 // Get gets a record from the in-memory list.
 func (srv *Server) Get(ctx context.Context, req *databroker.GetRequest) (*databroker.GetResponse, error) {
-	_, span := trace.StartSpan(ctx, "databroker.grpc.Get")
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.Get")
 	defer span.End()
-	srv.log.Info().
+	log.Ctx(ctx).Info().
 		Str("peer", grpcutil.GetPeerAddr(ctx)).
 		Str("type", req.GetType()).
 		Str("id", req.GetId()).
 		Msg("get")
 
+	if err := srv.getConfig().checkRecordType(req.GetType()); err != nil {
+		return nil, err
+	}
+
 	db, version, err := srv.getBackend()
 	if err != nil {
 		return nil, err
 	}
+	if req.GetStrongConsistency() {
+		ctx = storage.WithConsistency(ctx, storage.ConsistencyStrong)
+	}
+	ctx, err = srv.withConsistencyToken(ctx, db, version, req.GetConsistencyToken())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetIncludeDeleted() {
+		ctx = storage.WithIncludeDeleted(ctx)
+	}
+	ctx, stale := storage.WithStaleReadTracking(ctx)
 	record, err := db.Get(ctx, req.GetType(), req.GetId())
+	if errors.Is(err, storage.ErrNotFound) {
+		record, err = srv.loadRecord(ctx, req.GetType(), req.GetId())
+	}
 	switch {
 	case errors.Is(err, storage.ErrNotFound):
 		return nil, status.Error(codes.NotFound, "record not found")
 	case err != nil:
 		return nil, status.Error(codes.Internal, err.Error())
-	case record.DeletedAt != nil:
+	case record.DeletedAt != nil && !req.GetIncludeDeleted():
 		return nil, status.Error(codes.NotFound, "record not found")
 	}
+	srv.setCacheHints(ctx, record)
 	return &databroker.GetResponse{
 		Record:        record,
 		ServerVersion: version,
+		Stale:         stale(),
 	}, nil
 }
 
 // Query queries for records.
 func (srv *Server) Query(ctx context.Context, req *databroker.QueryRequest) (*databroker.QueryResponse, error) {
-	_, span := trace.StartSpan(ctx, "databroker.grpc.Query")
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.Query")
 	defer span.End()
-	srv.log.Info().
+	log.Ctx(ctx).Info().
 		Str("peer", grpcutil.GetPeerAddr(ctx)).
 		Str("type", req.GetType()).
 		Str("query", req.GetQuery()).
@@ -173,47 +351,286 @@ func (srv *Server) Query(ctx context.Context, req *databroker.QueryRequest) (*da
 	}
 
 	records, totalCount := databroker.ApplyOffsetAndLimit(filtered, int(req.GetOffset()), int(req.GetLimit()))
-	return &databroker.QueryResponse{
+	res := &databroker.QueryResponse{
 		Records:    records,
 		TotalCount: int64(totalCount),
-	}, nil
+	}
+	if err := fitQueryResponse(res, srv.getConfig().maxSendMsgSize); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 // Put updates a record in the in-memory list, or adds a new one.
 func (srv *Server) Put(ctx context.Context, req *databroker.PutRequest) (*databroker.PutResponse, error) {
-	_, span := trace.StartSpan(ctx, "databroker.grpc.Put")
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.Put")
 	defer span.End()
 	record := req.GetRecord()
 
-	srv.log.Info().
+	log.Ctx(ctx).Info().
 		Str("peer", grpcutil.GetPeerAddr(ctx)).
 		Str("type", record.GetType()).
 		Str("id", record.GetId()).
 		Msg("put")
 
+	if err := srv.checkSafeMode(); err != nil {
+		return nil, err
+	}
+	if err := srv.checkSchemaVersion(record); err != nil {
+		return nil, err
+	}
+	if err := srv.checkExpiry(ctx, record); err != nil {
+		return nil, err
+	}
+	if err := srv.validateRecord(record); err != nil {
+		return nil, err
+	}
+
+	release, err := srv.syncOps.acquire(ctx, srv.getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	endWrite, err := srv.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer endWrite()
+
 	db, version, err := srv.getBackend()
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Put(ctx, record); err != nil {
+
+	var unlockRecord func()
+	if record.GetId() == "" && record.GetDeletedAt() == nil {
+		unlockRecord, err = srv.assignRecordID(ctx, db, record)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		unlockRecord = srv.recordLocks.lock(record.GetType(), record.GetId())
+	}
+	defer unlockRecord()
+
+	unlockQuota, err := srv.lockRecordQuota(ctx, db, record)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockQuota()
+
+	unlockUniqueID, err := srv.lockUniqueID(ctx, db, record)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockUniqueID()
+
+	if req.GetExpectedVersion() != 0 {
+		ctx, err = srv.expectVersion(ctx, db, record, req.GetExpectedVersion())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if srv.getConfig().dedupeIdenticalPuts {
+		existing, err := getIdenticalRecord(ctx, db, record)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return &databroker.PutResponse{
+				ServerVersion:    version,
+				Record:           existing,
+				ConsistencyToken: encodeConsistencyToken(version, existing.GetVersion()),
+			}, nil
+		}
+	}
+
+	srv.stampLastWriter(ctx, req.GetActor(), record)
+	srv.recordRecordBytes(ctx, record)
+	if err := srv.withDeleteStrategies(db).Put(ctx, record); errors.Is(err, storage.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	} else if err != nil {
+		return nil, deleteStrategyError(err)
+	}
+	srv.recordLastWrite(ctx, record.GetType(), record.GetModifiedAt().AsTime())
+	srv.recordLoads.invalidate(loadedRecordKey{recordType: record.GetType(), id: record.GetId()})
+	if err := srv.writeAuditEvents(ctx, newAuditEvent("", record)); err != nil {
 		return nil, err
 	}
 	return &databroker.PutResponse{
+		ServerVersion:    version,
+		Record:           record,
+		ConsistencyToken: encodeConsistencyToken(version, record.GetVersion()),
+	}, nil
+}
+
+// maxIDGeneratorAttempts is the number of ids minted for a record before giving up
+// on finding one which isn't in use.
+const maxIDGeneratorAttempts = 10
+
+// assignRecordID sets the id of a record put without one to a newly minted id
+// which isn't in use, and locks the record. The returned function must be called
+// to unlock it.
+func (srv *Server) assignRecordID(ctx context.Context, db storage.Backend, record *databroker.Record) (unlock func(), err error) {
+	generate := srv.getConfig().idGenerator
+	if generate == nil {
+		generate = uuid.NewString
+	}
+
+	ctx = storage.WithConsistency(ctx, storage.ConsistencyStrong)
+	for i := 0; i < maxIDGeneratorAttempts; i++ {
+		id := generate()
+		if id == "" {
+			continue
+		}
+
+		// lock the record first so a concurrent put can't claim the same id
+		unlock := srv.recordLocks.lock(record.GetType(), id)
+		_, err := db.Get(ctx, record.GetType(), id)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			record.Id = id
+			return unlock, nil
+		case err != nil:
+			unlock()
+			return nil, err
+		}
+		unlock()
+	}
+	return nil, status.Errorf(codes.Internal,
+		"failed to generate an unused record id after %d attempts", maxIDGeneratorAttempts)
+}
+
+// ReplaceAll atomically replaces all the records of a type.
+func (srv *Server) ReplaceAll(ctx context.Context, req *databroker.ReplaceAllRequest) (*databroker.ReplaceAllResponse, error) {
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.ReplaceAll")
+	defer span.End()
+
+	log.Ctx(ctx).Info().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Str("type", req.GetType()).
+		Int("records", len(req.GetRecords())).
+		Msg("replace all")
+
+	if err := srv.checkSafeMode(); err != nil {
+		return nil, err
+	}
+
+	for _, record := range req.GetRecords() {
+		if record.GetType() != req.GetType() {
+			return nil, status.Errorf(codes.InvalidArgument, "record type %s does not match %s", record.GetType(), req.GetType())
+		}
+		if err := srv.checkSchemaVersion(record); err != nil {
+			return nil, err
+		}
+		if err := srv.checkExpiry(ctx, record); err != nil {
+			return nil, err
+		}
+		if err := srv.validateRecord(record); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := srv.syncOps.acquire(ctx, srv.getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	endWrite, err := srv.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer endWrite()
+
+	db, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+	unlockQuota, err := srv.lockRecordQuotaForReplaceAll(req.GetType(), req.GetRecords())
+	if err != nil {
+		return nil, err
+	}
+	defer unlockQuota()
+
+	for _, record := range req.GetRecords() {
+		srv.stampLastWriter(ctx, req.GetActor(), record)
+		srv.recordRecordBytes(ctx, record)
+	}
+	if err := srv.withDeleteStrategies(db).ReplaceAll(ctx, req.GetType(), req.GetRecords()); err != nil {
+		return nil, deleteStrategyError(err)
+	}
+	srv.recordLastWrite(ctx, req.GetType(), time.Now())
+	writer := srv.newRecordWriter(ctx, req.GetActor())
+	if err := srv.writeAuditEvents(ctx, auditEvent{
+		Time:           time.Now(),
+		Operation:      "replace_all",
+		Type:           req.GetType(),
+		Records:        len(req.GetRecords()),
+		Actor:          writer.GetActor(),
+		Peer:           writer.GetPeer(),
+		InstallationID: writer.GetInstallationId(),
+	}); err != nil {
+		return nil, err
+	}
+	return &databroker.ReplaceAllResponse{
 		ServerVersion: version,
-		Record:        record,
+		Records:       req.GetRecords(),
 	}, nil
 }
 
 // Sync streams updates for the given record type.
-func (srv *Server) Sync(req *databroker.SyncRequest, stream databroker.DataBrokerService_SyncServer) error {
+//
+// Changes aren't pushed into per-stream notification buffers. Each stream reads
+// them from the storage backend's change log as it sends them, so a stalled
+// stream stops reading rather than accumulating changes, and its memory is
+// bounded by the batch it last read and the gRPC flow control window. Only a
+// stream paused with PauseSync reads ahead into a buffer, bounded by the sync
+// pause buffer size, and the buffers of all the paused streams are bounded by the
+// max notification buffer bytes, beyond which the slowest streams are shed.
+func (srv *Server) Sync(req *databroker.SyncRequest, stream databroker.DataBrokerService_SyncServer) (err error) {
 	_, span := trace.StartSpan(stream.Context(), "databroker.grpc.Sync")
 	defer span.End()
+
+	labels, err := parseSyncLabels(req.GetLabels())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	compression := negotiateSyncCompression(srv.getConfig().syncCompression, req.GetAcceptCompression())
+	st := newSyncTrace(span, req, labels, compression)
+	defer func() { st.end(err) }()
+
 	srv.log.Info().
 		Str("peer", grpcutil.GetPeerAddr(stream.Context())).
+		Str("client_service", labels.service).
+		Str("client_instance", labels.instance).
 		Uint64("server_version", req.GetServerVersion()).
 		Uint64("record_version", req.GetRecordVersion()).
+		Str("compression", compression).
 		Msg("sync")
 
+	if srv.isDraining() {
+		return errDraining
+	}
+
+	if err := srv.checkProtocolVersion(stream.Context()); err != nil {
+		return err
+	}
+
+	if !srv.acquireSyncStream() {
+		srv.log.Warn().
+			Str("peer", grpcutil.GetPeerAddr(stream.Context())).
+			Str("client_service", labels.service).
+			Str("client_instance", labels.instance).
+			Int("max_sync_streams", srv.getConfig().maxSyncStreams).
+			Msg("rejected sync stream, maximum number of streams reached")
+		metrics.RecordDataBrokerSyncStreamRejected(stream.Context())
+		return status.Error(codes.ResourceExhausted, "maximum number of sync streams reached")
+	}
+	defer srv.releaseSyncStream()
+
 	backend, serverVersion, err := srv.getBackend()
 	if err != nil {
 		return err
@@ -221,6 +638,7 @@ func (srv *Server) Sync(req *databroker.SyncRequest, stream databroker.DataBroke
 
 	// reset record version if the server versions don't match
 	if req.GetServerVersion() != serverVersion {
+		st.resync("server version mismatch")
 		return status.Errorf(codes.Aborted, "invalid server version, got %d, expected: %d", req.GetServerVersion(), serverVersion)
 	}
 
@@ -228,34 +646,180 @@ func (srv *Server) Sync(req *databroker.SyncRequest, stream databroker.DataBroke
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	recordStream, err := backend.Sync(ctx, req.GetRecordVersion())
+	// the record stream stops waiting for changes separately from the stream, so
+	// that the pending changes can be flushed when the server starts draining
+	waitCtx, stopWaiting := context.WithCancel(ctx)
+	defer stopWaiting()
+	var flushing int32
+
+	// close the stream when the server starts draining
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-srv.drainedC():
+		}
+		cfg := srv.getConfig()
+		if cfg.onSyncDrain != SyncDrainFlush {
+			cancel()
+			return
+		}
+
+		timer := time.NewTimer(cfg.syncDrainFlushTimeout)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			cancel()
+			return
+		case <-srv.writesDrainedC():
+		}
+		atomic.StoreInt32(&flushing, 1)
+		stopWaiting()
+
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			cancel()
+		}
+	}()
+
+	var pause *syncPause
+	if streamID := req.GetStreamId(); streamID != "" {
+		var ok bool
+		if pause, ok = srv.syncPauses.register(streamID); !ok {
+			return status.Errorf(codes.AlreadyExists, "sync stream already exists: %s", streamID)
+		}
+		defer srv.syncPauses.unregister(streamID)
+	}
+
+	cfg := srv.getConfig()
+	recordStream, err := backend.Sync(waitCtx, req.GetRecordVersion())
 	if err != nil {
 		return err
 	}
+	if pause != nil {
+		recordStream = newPausableRecordStream(waitCtx, &srv.syncPauses, pause,
+			cfg.syncPauseBufferSize, cfg.maxNotificationBufferBytes, recordStream)
+	}
 	defer func() { _ = recordStream.Close() }()
 
-	for recordStream.Next(true) {
-		err = stream.Send(&databroker.SyncResponse{
+	var scheduled *syncSchedulerStream
+	if cfg.syncSendConcurrency > 0 {
+		scheduled = srv.syncScheduler.register(cfg.syncWeight(labels.service))
+		defer srv.syncScheduler.unregister(scheduled)
+	}
+
+	sender := newSyncSender(stream)
+	if interval := srv.getConfig().syncKeepalive; interval > 0 && req.GetAcceptHeartbeats() {
+		go func() {
+			// a failed heartbeat means the stream is broken, so stop syncing
+			if err := sender.runHeartbeats(ctx, interval, serverVersion); err != nil && ctx.Err() == nil {
+				cancel()
+			}
+		}()
+	}
+
+	// the records available without waiting make up a batch
+	next := func() bool {
+		if recordStream.Next(false) {
+			return true
+		}
+		st.endBatch()
+		if recordStream.Next(true) {
+			return true
+		}
+		// the changes of the drained writes may have arrived as the stream
+		// stopped waiting
+		return atomic.LoadInt32(&flushing) == 1 && recordStream.Next(false)
+	}
+
+	expectedVersion := req.GetRecordVersion() + 1
+	for next() {
+		record := recordStream.Record()
+		if record == nil {
+			// a record which fails verification ends the stream with its error,
+			// rather than being sent
+			if err := recordStream.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if record.GetVersion() > expectedVersion {
+			st.resync("record version unavailable")
+			return srv.syncVersionGapError(ctx, req.GetRecordVersion(), record.GetVersion())
+		}
+		expectedVersion = record.GetVersion() + 1
+
+		res := &databroker.SyncResponse{
 			ServerVersion: serverVersion,
-			Record:        recordStream.Record(),
-		})
+			Record:        record,
+		}
+		srv.compressSyncResponse(ctx, compression, res)
+		if scheduled != nil {
+			if err := srv.syncScheduler.acquire(ctx, scheduled, cfg.syncSendConcurrency); err != nil {
+				return err
+			}
+			err = sender.send(res)
+			srv.syncScheduler.release(cfg.syncSendConcurrency)
+		} else {
+			err = sender.send(res)
+		}
 		if err != nil {
 			return err
 		}
+		st.delivered(record)
+		metrics.RecordDataBrokerSyncRecordSent(ctx, labels.service, labels.instance)
 	}
 
+	if srv.isDraining() {
+		return errDraining
+	}
 	return recordStream.Err()
 }
 
+// syncVersionGapError returns the error for a Sync stream which is missing changes
+// between the requested record version and the first available change.
+func (srv *Server) syncVersionGapError(ctx context.Context, requested, available uint64) error {
+	policy := srv.getConfig().onSyncVersionGap
+	srv.log.Warn().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Uint64("record_version", requested).
+		Uint64("available_record_version", available).
+		Stringer("policy", policy).
+		Msg("sync record version is no longer available")
+
+	if policy == SyncVersionGapReset {
+		return status.Errorf(codes.OutOfRange,
+			"record version %d is no longer available, reset required", requested)
+	}
+	return status.Errorf(codes.Aborted,
+		"record version %d is no longer available, re-sync required", requested)
+}
+
 // SyncLatest returns the latest value of every record in the databroker as a stream of records.
+//
+// If the server has a maximum number of results, the stream is truncated at it
+// and the final versions include a cursor which continues the stream.
 func (srv *Server) SyncLatest(req *databroker.SyncLatestRequest, stream databroker.DataBrokerService_SyncLatestServer) error {
 	_, span := trace.StartSpan(stream.Context(), "databroker.grpc.SyncLatest")
 	defer span.End()
 	srv.log.Info().
 		Str("peer", grpcutil.GetPeerAddr(stream.Context())).
 		Str("type", req.GetType()).
+		Strs("types", req.GetTypes()).
 		Msg("sync latest")
 
+	if err := srv.checkProtocolVersion(stream.Context()); err != nil {
+		return err
+	}
+
+	matchType, err := srv.syncLatestTypeMatcher(req)
+	if err != nil {
+		return err
+	}
+
 	backend, serverVersion, err := srv.getBackend()
 	if err != nil {
 		return err
@@ -265,42 +829,374 @@ func (srv *Server) SyncLatest(req *databroker.SyncLatestRequest, stream databrok
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	records, latestRecordVersion, err := backend.GetAll(ctx)
+	ctx, err = srv.withConsistencyToken(ctx, backend, serverVersion, req.GetConsistencyToken())
 	if err != nil {
 		return err
 	}
 
+	// full re-syncs are served from a shared snapshot under the coordinated policy
+	cfg := srv.getConfig()
+	coordinated := cfg.onResync == ResyncCoordinated && req.GetCursor() == "" && req.GetConsistencyToken() == ""
+	if coordinated {
+		release, err := srv.resyncs.admit(ctx, cfg.resyncConcurrency)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	// always send the server version last in case there are no records
+	sendVersions := func(latestRecordVersion uint64, nextCursor string) error {
+		versions := &databroker.Versions{
+			ServerVersion:       serverVersion,
+			LatestRecordVersion: latestRecordVersion,
+			NextCursor:          nextCursor,
+		}
+		if srv.getConfig().reportReplicaLag {
+			srv.setReplicaLag(ctx, backend, versions)
+		}
+		return stream.Send(&databroker.SyncLatestResponse{
+			Response: &databroker.SyncLatestResponse_Versions{
+				Versions: versions,
+			},
+		})
+	}
+
+	pageSize := srv.getAllPageSizeFor(req)
+
+	// unless the records have to be ordered, send them as they're read from the
+	// storage, using the page size as the batch size
+	if !coordinated && req.GetCursor() == "" && req.GetSortBy() == "" && srv.getConfig().getAllMaxResults <= 0 {
+		latestRecordVersion, err := srv.streamAll(ctx, backend, pageSize, func(records []*databroker.Record) error {
+			for _, record := range records {
+				if !matchType(record.GetType()) {
+					continue
+				}
+				if err := srv.sendSyncLatestRecord(stream, record); err != nil {
+					return err
+				}
+			}
+			// stop early if the client has gone away
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+		return sendVersions(latestRecordVersion, "")
+	}
+
+	var records []*databroker.Record
+	var latestRecordVersion uint64
+	if coordinated {
+		snapshot, err := srv.resyncs.getSnapshot(backend, serverVersion, cfg.resyncSnapshotMaxAge)
+		if err != nil {
+			return err
+		}
+		records, latestRecordVersion = snapshot.records, snapshot.latestRecordVersion
+	} else {
+		records, latestRecordVersion, err = backend.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var filtered []*databroker.Record
 	for _, record := range records {
-		if req.GetType() == "" || req.GetType() == record.GetType() {
-			err = stream.Send(&databroker.SyncLatestResponse{
-				Response: &databroker.SyncLatestResponse_Record{
-					Record: record,
-				},
-			})
-			if err != nil {
+		if matchType(record.GetType()) {
+			filtered = append(filtered, record)
+		}
+	}
+
+	filtered, nextCursor, err := limitSyncLatestRecords(filtered, req.GetCursor(), srv.getConfig().getAllMaxResults)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if sortBy := req.GetSortBy(); sortBy != "" && !sortSyncLatestRecords(filtered, sortBy, req.GetSortDescending()) {
+		srv.log.Warn().
+			Str("peer", grpcutil.GetPeerAddr(ctx)).
+			Str("sort_by", sortBy).
+			Msg("unsupported sync latest sort, returning records unsorted")
+	}
+
+	for len(filtered) > 0 {
+		page := filtered
+		if len(page) > pageSize {
+			page = page[:pageSize]
+		}
+		filtered = filtered[len(page):]
+
+		for _, record := range page {
+			if err := srv.sendSyncLatestRecord(stream, record); err != nil {
 				return err
 			}
 		}
+
+		// stop early if the client has gone away
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 	}
 
-	// always send the server version last in case there are no records
-	return stream.Send(&databroker.SyncLatestResponse{
-		Response: &databroker.SyncLatestResponse_Versions{
-			Versions: &databroker.Versions{
-				ServerVersion:       serverVersion,
-				LatestRecordVersion: latestRecordVersion,
-			},
+	return sendVersions(latestRecordVersion, nextCursor)
+}
+
+// sendSyncLatestRecord sends a record on a SyncLatest stream, in a message of its
+// own so that pages larger than the max message size are split. A record which
+// doesn't fit in a message fails the stream, or is skipped by the skip policy.
+func (srv *Server) sendSyncLatestRecord(stream databroker.DataBrokerService_SyncLatestServer, record *databroker.Record) error {
+	res := &databroker.SyncLatestResponse{
+		Response: &databroker.SyncLatestResponse_Record{
+			Record: record,
 		},
+	}
+	cfg := srv.getConfig()
+	if cfg.maxSendMsgSize > 0 && proto.Size(res) > cfg.maxSendMsgSize {
+		if cfg.onOversizedPage == OversizedPageSkip {
+			srv.log.Warn().
+				Str("peer", grpcutil.GetPeerAddr(stream.Context())).
+				Str("type", record.GetType()).
+				Str("id", record.GetId()).
+				Int("size", proto.Size(res)).
+				Msg("record exceeds the maximum message size, skipping it")
+			return nil
+		}
+		return status.Errorf(codes.ResourceExhausted,
+			"record %s/%s exceeds the maximum message size of %d bytes",
+			record.GetType(), record.GetId(), cfg.maxSendMsgSize)
+	}
+	return stream.Send(res)
+}
+
+// syncLatestTypeMatcher returns a function which reports whether records of a
+// type are requested by the SyncLatest request: all the types if the request
+// has none, or else any of its type and types.
+func (srv *Server) syncLatestTypeMatcher(req *databroker.SyncLatestRequest) (func(recordType string) bool, error) {
+	types := req.GetTypes()
+	if req.GetType() != "" {
+		types = append([]string{req.GetType()}, types...)
+	}
+	if len(types) == 0 {
+		return func(string) bool { return true }, nil
+	}
+
+	cfg := srv.getConfig()
+	requested := make(map[string]struct{}, len(types))
+	for _, recordType := range types {
+		if err := cfg.checkRecordType(recordType); err != nil {
+			return nil, err
+		}
+		requested[recordType] = struct{}{}
+	}
+	return func(recordType string) bool {
+		_, ok := requested[recordType]
+		return ok
+	}, nil
+}
+
+// getAllPageSizeFor returns the page size to use for the given request. The page
+// size configured for the requested type takes precedence over the default. An
+// override in the request is honored but clamped to the configured maximum page size.
+func (srv *Server) getAllPageSizeFor(req *databroker.SyncLatestRequest) int {
+	cfg := srv.getConfig()
+	pageSize := cfg.getAllPageSize
+	if typePageSize, ok := cfg.getAllPageSizeByType[req.GetType()]; ok && req.GetType() != "" {
+		pageSize = typePageSize
+	}
+	if req.GetPageSize() > 0 {
+		pageSize = int(req.GetPageSize())
+	}
+	if cfg.getAllMaxPageSize > 0 && pageSize > cfg.getAllMaxPageSize {
+		pageSize = cfg.getAllMaxPageSize
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultGetAllPageSize
+	}
+	return pageSize
+}
+
+// streamAll streams all the records of the backend in pages of pageSize, and
+// records how long it took to read each page, so that the page size can be tuned.
+// Backends which can't stream read all the records for their first page.
+func (srv *Server) streamAll(ctx context.Context, backend storage.Backend, pageSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	storageType := srv.getConfig().storageType
+	start := time.Now()
+	return storage.StreamAll(ctx, backend, pageSize, func(records []*databroker.Record) error {
+		metrics.RecordStorageGetAllPage(ctx, storageType, pageSize, time.Since(start))
+		err := fn(records)
+		start = time.Now()
+		return err
+	})
+}
+
+func (srv *Server) getConfig() *serverConfig {
+	srv.mu.RLock()
+	cfg := srv.cfg
+	srv.mu.RUnlock()
+	return cfg
+}
+
+// recordRecordBytes records the size of a record being written.
+func (srv *Server) recordRecordBytes(ctx context.Context, record *databroker.Record) {
+	metrics.RecordDataBrokerRecordBytes(ctx,
+		srv.getConfig().recordTypeLabel(record.GetType()),
+		int64(proto.Size(record)))
+}
+
+// recordLastWrite records the time of a write of the record type, if last write
+// timestamp metrics are enabled.
+func (srv *Server) recordLastWrite(ctx context.Context, recordType string, t time.Time) {
+	if cfg := srv.getConfig(); cfg.lastWriteMetrics {
+		metrics.SetDataBrokerLastWriteTimestamp(ctx, cfg.recordTypeLabel(recordType), t)
+	}
+}
+
+// stampLastWriter records who is writing the record. The actor is taken from the
+// request, or from the request metadata if not set. It does not affect the record
+// version or checksum.
+func (srv *Server) stampLastWriter(ctx context.Context, actor string, record *databroker.Record) {
+	if record == nil {
+		return
+	}
+	record.LastWriter = srv.newRecordWriter(ctx, actor)
+}
+
+// newRecordWriter returns the writer of the request.
+func (srv *Server) newRecordWriter(ctx context.Context, actor string) *databroker.RecordWriter {
+	if actor == "" {
+		actor, _ = grpcutil.ActorFromGRPCRequest(ctx)
+	}
+	return &databroker.RecordWriter{
+		InstallationId: srv.getConfig().installationID,
+		Actor:          actor,
+		Peer:           grpcutil.GetPeerAddr(ctx),
+	}
+}
+
+// getIdenticalRecord returns the current record if the given record would not
+// change it, or nil otherwise. Deletions are never considered identical.
+func getIdenticalRecord(ctx context.Context, db storage.Backend, record *databroker.Record) (*databroker.Record, error) {
+	if record.GetDeletedAt() != nil {
+		return nil, nil
+	}
+	existing, err := db.Get(storage.WithConsistency(ctx, storage.ConsistencyStrong), record.GetType(), record.GetId())
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if existing.GetDeletedAt() != nil ||
+		existing.GetSchemaVersion() != record.GetSchemaVersion() ||
+		!bytes.Equal(storage.ComputeChecksum(existing), storage.ComputeChecksum(record)) {
+		return nil, nil
+	}
+	return existing, nil
+}
+
+// setConfigInfoMetric exports the key values of the config in the
+// databroker_config_info metric, if enabled. The storage type is only exported if
+// it's supported, so that the labels are bounded.
+func setConfigInfoMetric(cfg *serverConfig) {
+	if !cfg.configInfoMetric {
+		metrics.ClearDataBrokerConfigInfo()
+		return
+	}
+
+	storageType := cfg.storageType
+	switch storageType {
+	case config.StorageInMemoryName, config.StorageRedisName, config.StorageFirestoreName:
+	default:
+		storageType = "unsupported"
+	}
+	metrics.SetDataBrokerConfigInfo(metrics.DataBrokerConfigInfo{
+		StorageType:       storageType,
+		GetAllPageSize:    cfg.getAllPageSize,
+		EncryptionEnabled: cfg.secret != nil,
+		ReadOnly:          cfg.invalidSharedKey,
 	})
 }
 
+// errInvalidSharedKeyMessage explains why the server is in safe mode and how to fix it.
+const errInvalidSharedKeyMessage = "databroker: shared secret is missing or invalid, " +
+	"rejecting all writes. Set shared_secret to the same base64-encoded 32-byte key " +
+	"on every pomerium service, for example the output of `head -c32 /dev/urandom | base64`"
+
+// checkSafeMode returns an error if writes are disabled because the shared key
+// is invalid.
+func (srv *Server) checkSafeMode() error {
+	if srv.getConfig().invalidSharedKey {
+		return status.Error(codes.FailedPrecondition, errInvalidSharedKeyMessage)
+	}
+	return nil
+}
+
+// checkSchemaVersion returns an error if the record's schema version is not one of
+// the accepted schema versions. Deletions are always accepted so that records of
+// an old schema can be removed.
+func (srv *Server) checkSchemaVersion(record *databroker.Record) error {
+	accepted := srv.getConfig().acceptedSchemaVersions
+	if len(accepted) == 0 || record.GetDeletedAt() != nil {
+		return nil
+	}
+	for _, v := range accepted {
+		if int64(v) == int64(record.GetSchemaVersion()) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.FailedPrecondition,
+		"record %s/%s has schema version %d, but only schema versions %v are accepted",
+		record.GetType(), record.GetId(), record.GetSchemaVersion(), accepted)
+}
+
+// checkExpiry checks that the record has an expiry, if its type requires one.
+// A record without one is counted, and rejected in strict mode. Deletions are
+// always accepted.
+func (srv *Server) checkExpiry(ctx context.Context, record *databroker.Record) error {
+	cfg := srv.getConfig()
+	if record.GetDeletedAt() != nil || !cfg.requiresExpiry(record.GetType()) {
+		return nil
+	}
+	if _, ok := storage.ExpiresAt(record); ok {
+		return nil
+	}
+
+	metrics.RecordDataBrokerRecordWithoutExpiry(ctx, cfg.recordTypeLabel(record.GetType()))
+	if !cfg.requireExpiryStrict {
+		srv.log.Warn().
+			Str("type", record.GetType()).
+			Str("id", record.GetId()).
+			Msg("record written without expiry")
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition,
+		"record %s/%s has no expiry, but one is required for the type", record.GetType(), record.GetId())
+}
+
+// acquireSyncStream reserves a slot for a new sync stream. It returns false if
+// the maximum number of sync streams has been reached.
+func (srv *Server) acquireSyncStream() bool {
+	n := atomic.AddInt64(&srv.syncStreams, 1)
+	if maxSyncStreams := srv.getConfig().maxSyncStreams; maxSyncStreams > 0 && n > int64(maxSyncStreams) {
+		atomic.AddInt64(&srv.syncStreams, -1)
+		return false
+	}
+	return true
+}
+
+func (srv *Server) releaseSyncStream() {
+	atomic.AddInt64(&srv.syncStreams, -1)
+}
+
 func (srv *Server) getBackend() (backend storage.Backend, version uint64, err error) {
 	// double-checked locking:
 	// first try the read lock, then re-try with the write lock, and finally create a new backend if nil
 	srv.mu.RLock()
 	backend = srv.backend
 	version = srv.version
+	storageInitErr := srv.storageInitErr
 	srv.mu.RUnlock()
+	if storageInitErr != nil {
+		return nil, 0, status.Errorf(codes.Unavailable, "databroker storage is unavailable: %v", storageInitErr)
+	}
 	if backend == nil {
 		srv.mu.Lock()
 		backend = srv.backend
@@ -332,41 +1228,360 @@ func (srv *Server) getBackendLocked() (backend storage.Backend, version uint64,
 	return backend, version, nil
 }
 
+// connectStorageLocked creates a storage backend with connect, and bounds its
+// operations by the configured statement timeout, if any. If the storage
+// watchdog is enabled, the backend is re-created with connect after repeated
+// timeouts.
+func (srv *Server) connectStorageLocked(name string, connect func() (storage.Backend, error)) (storage.Backend, error) {
+	statementTimeout := srv.cfg.storageStatementTimeout
+	connectWithTimeout := func() (storage.Backend, error) {
+		backend, err := connect()
+		if err != nil {
+			return nil, err
+		}
+		if statementTimeout > 0 {
+			backend = storage.NewStatementTimeoutBackend(statementTimeout, backend)
+		}
+		return backend, nil
+	}
+
+	if srv.cfg.storageWatchdogThreshold <= 0 {
+		return connectWithTimeout()
+	}
+	return storage.NewWatchdogBackend(name, srv.cfg.storageWatchdogThreshold, connectWithTimeout)
+}
+
 func (srv *Server) newBackendLocked() (backend storage.Backend, err error) {
-	caCertPool, err := cryptutil.GetCertPool("", srv.cfg.storageCAFile)
+	if srv.cfg.storageSecretError != "" {
+		return nil, errors.New(srv.cfg.storageSecretError)
+	}
+	if len(srv.cfg.storageShards) > 0 {
+		backend, err = srv.newShardedBackendLocked()
+	} else {
+		backend, err = srv.newStorageLocked(srv.cfg.storageType, srv.cfg.storageConnectionString, srv.cfg.memoryPersistPath)
+	}
 	if err != nil {
-		log.Warn().Err(err).Msg("failed to read databroker CA file")
+		return nil, err
+	}
+	if len(srv.cfg.storageRoutes) > 0 {
+		backend, err = srv.newRoutedBackendLocked(backend)
+		if err != nil {
+			return nil, err
+		}
 	}
-	tlsConfig := &tls.Config{
-		RootCAs: caCertPool,
-		// nolint: gosec
-		InsecureSkipVerify: srv.cfg.storageCertSkipVerify,
+	if srv.cfg.slowOperationThreshold > 0 && srv.cfg.slowOperationSampleRate > 0 {
+		backend = storage.NewSlowOperationLogBackend(srv.cfg.slowOperationThreshold, srv.cfg.slowOperationSampleRate, backend)
 	}
-	if srv.cfg.storageCertificate != nil {
-		tlsConfig.Certificates = []tls.Certificate{*srv.cfg.storageCertificate}
+	if srv.cfg.maxConcurrentStorageOps > 0 {
+		backend = storage.NewConcurrencyLimitBackend(srv.cfg.maxConcurrentStorageOps, backend)
+	}
+	if srv.cfg.expiryScanEnabled {
+		backend = storage.NewExpiryBackendWithSkewTolerance(srv.cfg.expiryScanInterval, srv.cfg.expirySkewTolerance, backend)
+	}
+	if policies := srv.cfg.allRetentionPolicies(); len(policies) > 0 {
+		backend = storage.NewRetentionBackend(srv.cfg.retentionInterval, policies, backend)
+	}
+	if srv.cfg.recordAgeSampleInterval > 0 {
+		backend = storage.NewRecordAgeSamplerBackend(srv.cfg.recordAgeSampleInterval, srv.cfg.recordTypeLabel, backend)
+	}
+	if srv.cfg.deletedGracePeriod > 0 {
+		backend = storage.NewDeletedGracePeriodBackend(srv.cfg.deletedGracePeriod, backend)
+	}
+	if srv.cfg.negativeCacheTTL > 0 {
+		backend, err = storage.NewNegativeCacheBackend(srv.cfg.negativeCacheTTL, backend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create negative cache: %w", err)
+		}
+	}
+	if srv.cfg.readCacheSize > 0 {
+		if srv.cfg.serveStaleOnError {
+			backend, err = storage.NewStaleOnErrorReadCacheBackend(srv.cfg.readCacheSize, srv.cfg.readCacheTTL, backend)
+		} else {
+			backend, err = storage.NewReadCacheBackend(srv.cfg.readCacheSize, srv.cfg.readCacheTTL, backend)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create read cache: %w", err)
+		}
+	}
+	backend = storage.NewTracingBackend(backend)
+	if srv.cfg.storageWarmup {
+		srv.warmupBackend(backend)
+	}
+	srv.stopChangeFeeds, err = srv.startChangeFeedsLocked(backend)
+	if err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// newStorageLocked creates a new storage backend of the given type, before any of
+// the server-wide decorators are applied.
+func (srv *Server) newStorageLocked(storageType, connectionString, memoryPersistPath string) (backend storage.Backend, err error) {
+	tlsConfig, tlsErr := srv.cfg.storageTLSConfig()
+	sweepWindows, err := storage.ParseSweepWindows(srv.cfg.sweepWindows)
+	if err != nil {
+		return nil, err
 	}
 
-	switch srv.cfg.storageType {
+	switch storageType {
 	case config.StorageInMemoryName:
 		srv.log.Info().Msg("using in-memory store")
-		return inmemory.New(), nil
+		options := []inmemory.Option{
+			inmemory.WithPersistPath(memoryPersistPath),
+			inmemory.WithPersistDurability(srv.cfg.memoryPersistDurability),
+			inmemory.WithImmediateDelete(srv.cfg.immediateDeleteTypes),
+			inmemory.WithSweepWindows(sweepWindows),
+			inmemory.WithDisableSweep(srv.cfg.disableSweep),
+			inmemory.WithCompactOnStartup(srv.cfg.memoryCompactOnStartup),
+			inmemory.WithTypeExpiries(srv.cfg.typeDeletePermanentlyAfter()),
+			inmemory.WithRecordTypeMetrics(srv.cfg.storageRecordTypeMetrics),
+			inmemory.WithKnownRecordTypes(append(builtinRecordTypes(), srv.cfg.storageKnownRecordTypes...)),
+		}
+		if srv.cfg.memoryPersistInterval > 0 {
+			options = append(options, inmemory.WithPersistInterval(srv.cfg.memoryPersistInterval))
+		}
+		backend = srv.newSignedBackendLocked(inmemory.New(options...))
 	case config.StorageRedisName:
 		srv.log.Info().Msg("using redis store")
-		backend, err = redis.New(
-			srv.cfg.storageConnectionString,
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		password, err := srv.cfg.storagePassword()
+		if err != nil {
+			return nil, err
+		}
+		options := []redis.Option{
 			redis.WithTLSConfig(tlsConfig),
-		)
+			redis.WithCredentials(srv.cfg.storageUsername, password),
+			redis.WithPoolSize(srv.cfg.storagePoolSize),
+			redis.WithMinIdleConns(srv.cfg.storageMinIdleConns),
+			redis.WithDialTimeout(srv.cfg.storageDialTimeout),
+			redis.WithDNSRefreshInterval(srv.cfg.storageDNSRefreshInterval),
+			redis.WithImmediateDelete(srv.cfg.immediateDeleteTypes),
+			redis.WithSweepWindows(sweepWindows),
+			redis.WithDisableSweep(srv.cfg.disableSweep),
+			redis.WithRecordTypeMetrics(srv.cfg.storageRecordTypeMetrics),
+			redis.WithKnownRecordTypes(append(builtinRecordTypes(), srv.cfg.storageKnownRecordTypes...)),
+			redis.WithKeyPrefix(srv.cfg.storageKeyPrefix),
+			redis.WithChangeCompression(srv.cfg.storageChangeCompression),
+			redis.WithTypeExpiries(srv.cfg.typeDeletePermanentlyAfter()),
+		}
+		if srv.cfg.storageTCPKeepAlive != nil {
+			options = append(options, redis.WithTCPKeepAlive(*srv.cfg.storageTCPKeepAlive))
+		}
+		backend, err = srv.connectStorageLocked(config.StorageRedisName, func() (storage.Backend, error) {
+			backend, err := redis.New(connectionString, options...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create new redis storage: %w", err)
+			}
+			return backend, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		backend, err = srv.newEncryptedBackendLocked(srv.newSignedBackendLocked(storage.NewChecksumBackend(backend)))
+		if err != nil {
+			return nil, err
+		}
+	case config.StorageFirestoreName:
+		srv.log.Info().Msg("using firestore store")
+		options := []firestore.Option{
+			firestore.WithCredentialsFile(srv.cfg.storageCredentialsFile),
+			firestore.WithTypeExpiries(srv.cfg.typeDeletePermanentlyAfter()),
+			firestore.WithRecordTypeMetrics(srv.cfg.storageRecordTypeMetrics),
+			firestore.WithKnownRecordTypes(append(builtinRecordTypes(), srv.cfg.storageKnownRecordTypes...)),
+		}
+		if srv.cfg.deletePermanentlyAfter > 0 {
+			options = append(options, firestore.WithExpiry(srv.cfg.deletePermanentlyAfter))
+		}
+		backend, err = srv.connectStorageLocked(config.StorageFirestoreName, func() (storage.Backend, error) {
+			backend, err := firestore.New(connectionString, options...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create new firestore storage: %w", err)
+			}
+			return backend, nil
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create new redis storage: %w", err)
+			return nil, err
+		}
+		backend, err = srv.newEncryptedBackendLocked(srv.newSignedBackendLocked(storage.NewChecksumBackend(backend)))
+		if err != nil {
+			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("unsupported storage type: %s", srv.cfg.storageType)
+		return nil, fmt.Errorf("unsupported storage type: %s", storageType)
+	}
+	return backend, nil
+}
+
+// newRoutedBackendLocked routes the records of the types with a storage route to
+// their own storage backends, and all other records to the default backend.
+func (srv *Server) newRoutedBackendLocked(defaultBackend storage.Backend) (storage.Backend, error) {
+	backends := map[StorageRoute]storage.Backend{
+		{Type: srv.cfg.storageType, ConnectionString: srv.cfg.storageConnectionString}: defaultBackend,
+	}
+	closeAll := func() {
+		for _, backend := range backends {
+			_ = backend.Close()
+		}
+	}
+
+	routes := make(map[string]storage.Backend, len(srv.cfg.storageRoutes))
+	for recordType, route := range srv.cfg.storageRoutes {
+		backend, ok := backends[route]
+		if !ok {
+			var err error
+			backend, err = srv.newStorageLocked(route.Type, route.ConnectionString, "")
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("failed to create storage for record type %s: %w", recordType, err)
+			}
+			backends[route] = backend
+		}
+		routes[recordType] = backend
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultStorageWarmupTimeout)
+	defer cancel()
+	backend, err := storage.NewRoutedBackend(ctx, defaultBackend, routes)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("failed to create routed storage: %w", err)
+	}
+	return backend, nil
+}
+
+// newShardedBackendLocked distributes the records across the storage shards.
+func (srv *Server) newShardedBackendLocked() (storage.Backend, error) {
+	shards := make(map[string]storage.Backend, len(srv.cfg.storageShards))
+	closeAll := func() {
+		for _, backend := range shards {
+			_ = backend.Close()
+		}
 	}
-	if srv.cfg.secret != nil {
-		backend, err = storage.NewEncryptedBackend(srv.cfg.secret, backend)
+
+	for name, shard := range srv.cfg.storageShards {
+		backend, err := srv.newStorageLocked(shard.Type, shard.ConnectionString, "")
 		if err != nil {
-			return nil, err
+			closeAll()
+			return nil, fmt.Errorf("failed to create storage for shard %s: %w", name, err)
+		}
+		shards[name] = backend
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultStorageWarmupTimeout)
+	defer cancel()
+	backend, err := storage.NewShardedBackend(ctx, shards)
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("failed to create sharded storage: %w", err)
+	}
+	return backend, nil
+}
+
+// newEncryptedBackendLocked encrypts the records stored in the backend with the
+// shared key, if set. Only the configured fields are encrypted for record types
+// with encrypted fields. Records are also verified with the previous shared keys.
+func (srv *Server) newEncryptedBackendLocked(backend storage.Backend) (storage.Backend, error) {
+	var err error
+	switch {
+	case srv.cfg.secret == nil:
+		return backend, nil
+	case len(srv.cfg.encryptedFields) > 0:
+		backend, err = storage.NewFieldEncryptedBackend(srv.cfg.secret, srv.cfg.encryptedFields, backend)
+	default:
+		backend, err = storage.NewTypeKeyEncryptedBackend(srv.cfg.secret, srv.cfg.typeEncryptionKeys, backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rotator, ok := backend.(storage.SecretRotator); ok {
+		if len(srv.cfg.previousSecrets) > 0 {
+			if err := rotator.RotateSecret(srv.cfg.secret, srv.cfg.previousSecrets); err != nil {
+				return nil, err
+			}
 		}
+		srv.secretRotators = append(srv.secretRotators, rotator)
 	}
 	return backend, nil
 }
+
+// newSignedBackendLocked signs the records stored in the backend, if record
+// signing is enabled, with the record signer or else the shared key. The records
+// are signed as stored, so under encryption the signature covers the ciphertext.
+func (srv *Server) newSignedBackendLocked(backend storage.Backend) storage.Backend {
+	if !srv.cfg.recordSigning {
+		return backend
+	}
+
+	options := []storage.SignedBackendOption{
+		storage.WithAcceptUnsignedRecords(srv.cfg.recordSigningAcceptUnsigned),
+	}
+	verifiers := append([]storage.Verifier{}, srv.cfg.recordVerifiers...)
+	if srv.cfg.recordSigner != nil {
+		for _, secret := range append([][]byte{srv.cfg.secret}, srv.cfg.previousSecrets...) {
+			if secret != nil {
+				verifiers = append(verifiers, storage.NewHMACSigner(secret))
+			}
+		}
+		return storage.NewSignedBackend(srv.cfg.recordSigner, verifiers, backend, options...)
+	}
+
+	if srv.cfg.secret == nil {
+		srv.log.Warn().Msg("record signing requires a shared key, records will not be signed")
+		return backend
+	}
+	backend = storage.NewSharedKeySignedBackend(srv.cfg.secret, verifiers, backend, options...)
+	rotator := backend.(storage.SecretRotator)
+	if len(srv.cfg.previousSecrets) > 0 {
+		// rotating the shared key signed backend can't fail
+		_ = rotator.RotateSecret(srv.cfg.secret, srv.cfg.previousSecrets)
+	}
+	srv.secretRotators = append(srv.secretRotators, rotator)
+	return backend
+}
+
+// warmupBackend warms up the backend before it is used. Failures are logged but
+// otherwise ignored, as warming up is only an optimization.
+func (srv *Server) warmupBackend(backend storage.Backend) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultStorageWarmupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := storage.Warmup(ctx, backend, srv.cfg.storageWarmupRecordTypes)
+	if err != nil {
+		srv.log.Warn().Err(err).Msg("failed to warm up storage")
+		return
+	}
+	srv.log.Info().
+		Strs("record_types", srv.cfg.storageWarmupRecordTypes).
+		Dur("duration", time.Since(start)).
+		Msg("warmed up storage")
+}
+
+// fitQueryResponse truncates the records in a query response so that it fits within
+// the max message size. Clients can query for the remaining records with an offset.
+func fitQueryResponse(res *databroker.QueryResponse, maxMsgSize int) error {
+	if maxMsgSize <= 0 {
+		return nil
+	}
+
+	size := proto.Size(&databroker.QueryResponse{TotalCount: res.GetTotalCount()})
+	for i, record := range res.GetRecords() {
+		n := proto.Size(record)
+		// field tag + length prefix + record
+		size += 1 + protowire.SizeBytes(n)
+		if size > maxMsgSize {
+			if i == 0 {
+				return status.Errorf(codes.ResourceExhausted,
+					"record %s/%s exceeds the maximum message size of %d bytes",
+					record.GetType(), record.GetId(), maxMsgSize)
+			}
+			res.Records = res.Records[:i]
+			break
+		}
+	}
+	return nil
+}
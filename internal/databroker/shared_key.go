@@ -0,0 +1,58 @@
+package databroker
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+// recordSharedKeyChangeLocked logs and counts a change of the shared key, however
+// it's applied. Reloads which keep the same key aren't counted.
+func (srv *Server) recordSharedKeyChangeLocked(cfg *serverConfig) {
+	if srv.cfg == nil || bytes.Equal(srv.cfg.secret, cfg.secret) {
+		return
+	}
+	metrics.RecordDataBrokerKeyRotation(context.Background())
+	srv.log.Info().
+		Bool("valid", cfg.secret != nil).
+		Str("policy", cfg.onSharedKeyChange.String()).
+		Msg("shared key changed")
+}
+
+// rotateSharedKeyLocked rotates the shared key of the backend in place, rather
+// than recreating it, if the policy is to rotate and the shared key, along with
+// the previous keys, is all that changed. The replaced key becomes a previous key
+// of the backend, so the records written with it, including those still to be
+// delivered on open Sync streams, are still verified. It reports whether the key
+// was rotated.
+func (srv *Server) rotateSharedKeyLocked(cfg *serverConfig) bool {
+	if srv.cfg == nil || srv.backend == nil || cfg.onSharedKeyChange != SharedKeyChangeRotate {
+		return false
+	}
+	// without a valid key before and after there's nothing to rotate between
+	if srv.cfg.secret == nil || cfg.secret == nil {
+		return false
+	}
+	if !configEqual(cfg, srv.cfg, "secret", "previousSecrets") {
+		return false
+	}
+
+	rotatedSecrets := srv.rotatedSecrets
+	if !bytes.Equal(srv.cfg.secret, cfg.secret) {
+		rotatedSecrets = append(rotatedSecrets[:len(rotatedSecrets):len(rotatedSecrets)], srv.cfg.secret)
+	}
+	previousSecrets := append(append([][]byte{}, cfg.previousSecrets...), rotatedSecrets...)
+	for _, rotator := range srv.secretRotators {
+		if err := rotator.RotateSecret(cfg.secret, previousSecrets); err != nil {
+			srv.log.Error().Err(err).Msg("failed to rotate shared key, recreating the backend")
+			return false
+		}
+	}
+	srv.rotatedSecrets = rotatedSecrets
+
+	srv.log.Info().
+		Int("previous_keys", len(previousSecrets)).
+		Msg("rotated shared key in place")
+	return true
+}
@@ -0,0 +1,119 @@
+package databroker
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestServer_RotateSharedKey(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	oldKey := base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	newKey := base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	options := func(sharedKey string, policy SharedKeyChangePolicy) []ServerOption {
+		return []ServerOption{
+			WithStorageType("memory"),
+			WithSharedKey(sharedKey),
+			WithOnSharedKeyChange(policy),
+		}
+	}
+
+	sync := func(t *testing.T, srv *Server) <-chan string {
+		client := newTestClient(t, srv)
+		stream, err := client.Sync(ctx, &databroker.SyncRequest{ServerVersion: srv.version})
+		require.NoError(t, err)
+		received := make(chan string)
+		go func() {
+			defer close(received)
+			for {
+				res, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				if res.GetRecord().GetType() == "TYPE" {
+					received <- res.GetRecord().GetId()
+				}
+			}
+		}()
+		return received
+	}
+	put := func(t *testing.T, srv *Server, id string) {
+		_, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: id},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("rotate", func(t *testing.T) {
+		srv := New(options(oldKey, SharedKeyChangeRotate)...)
+		defer srv.Close()
+		received := sync(t, srv)
+
+		put(t, srv, "1")
+		assert.Equal(t, "1", <-received)
+
+		version := srv.version
+		srv.UpdateConfig(options(newKey, SharedKeyChangeRotate)...)
+		assert.Equal(t, version, srv.version, "the server version should not change")
+
+		put(t, srv, "2")
+		select {
+		case id, ok := <-received:
+			assert.True(t, ok, "the stream should not be closed")
+			assert.Equal(t, "2", id, "changes should still be delivered")
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the change")
+		}
+	})
+	t.Run("other changes", func(t *testing.T) {
+		srv := New(options(oldKey, SharedKeyChangeRotate)...)
+		defer srv.Close()
+
+		previous := srv.backend
+		srv.UpdateConfig(append(options(newKey, SharedKeyChangeRotate), WithGetAllPageSize(10))...)
+		assert.NotSame(t, previous, srv.backend, "the backend should be recreated when anything else changes")
+	})
+}
+
+func TestServer_KeyRotationMetric(t *testing.T) {
+	view.Unregister(metrics.DataBrokerKeyRotationsView)
+	require.NoError(t, view.Register(metrics.DataBrokerKeyRotationsView))
+	defer view.Unregister(metrics.DataBrokerKeyRotationsView)
+
+	count := func() int64 {
+		rows, err := view.RetrieveData(metrics.DataBrokerKeyRotationsView.Name)
+		require.NoError(t, err)
+		if len(rows) == 0 {
+			return 0
+		}
+		return rows[0].Data.(*view.CountData).Value
+	}
+
+	key1 := base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	key2 := base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	srv := New(WithSharedKey(key1))
+	defer srv.Close()
+	assert.Equal(t, int64(0), count(), "the initial key is not a rotation")
+
+	srv.UpdateConfig(WithSharedKey(key1))
+	srv.UpdateConfig(WithSharedKey(key1), WithGetAllPageSize(10))
+	assert.Equal(t, int64(0), count(), "reloads which keep the key should not be counted")
+
+	srv.UpdateConfig(WithSharedKey(key2))
+	srv.UpdateConfig(WithSharedKey(key2))
+	assert.Equal(t, int64(1), count())
+
+	srv.UpdateConfig(WithSharedKey(key1), WithOnSharedKeyChange(SharedKeyChangeRotate))
+	assert.Equal(t, int64(2), count(), "rotations in place should be counted too")
+}
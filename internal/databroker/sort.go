@@ -0,0 +1,68 @@
+package databroker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// syncLatestSorts are the supported sorts for SyncLatest, comparing records by
+// their sort key.
+var syncLatestSorts = map[string]func(a, b *databroker.Record) int{
+	"version": func(a, b *databroker.Record) int {
+		return compareUint64(a.GetVersion(), b.GetVersion())
+	},
+	"modified_at": func(a, b *databroker.Record) int {
+		if c := compareInt64(a.GetModifiedAt().GetSeconds(), b.GetModifiedAt().GetSeconds()); c != 0 {
+			return c
+		}
+		return compareInt64(int64(a.GetModifiedAt().GetNanos()), int64(b.GetModifiedAt().GetNanos()))
+	},
+	"type": func(a, b *databroker.Record) int { return 0 },
+	"id": func(a, b *databroker.Record) int {
+		return strings.Compare(a.GetId(), b.GetId())
+	},
+}
+
+// sortSyncLatestRecords sorts the records by the given sort key, with ties
+// ordered by type and id. It returns false if the sort isn't supported, in
+// which case the records are left as they are.
+func sortSyncLatestRecords(records []*databroker.Record, sortBy string, descending bool) bool {
+	compare, ok := syncLatestSorts[sortBy]
+	if !ok {
+		return false
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		c := compare(records[i], records[j])
+		if c == 0 {
+			c = compareRecordKeys(records[i].GetType(), records[i].GetId(), records[j].GetType(), records[j].GetId())
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+	return true
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package databroker
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const storageInitMaxRetryBackoff = 30 * time.Second
+
+// storageInitRetryBackoff is the time waited before the first retry of a storage
+// which failed to initialize in the start-degraded mode. It doubles after each
+// retry, up to storageInitMaxRetryBackoff.
+var storageInitRetryBackoff = 500 * time.Millisecond
+
+// osExit exits the process in the fail-fast mode. It's replaced in tests.
+var osExit = os.Exit
+
+// initStorageLocked initializes the storage backend and the server version,
+// handling a failure according to the storage init failure policy.
+func (srv *Server) initStorageLocked() {
+	err := srv.initVersion()
+	if err == nil {
+		return
+	}
+
+	switch srv.cfg.onStorageInitFailure {
+	case StorageInitFailureFailFast:
+		srv.log.Error().Err(err).Msg("databroker: storage initialization failed, exiting")
+		osExit(1)
+	case StorageInitFailureStartDegraded:
+		srv.log.Error().Err(err).Msg("databroker: storage initialization failed, starting degraded")
+		srv.storageInitErr = err
+		srv.retryStorageInitLocked()
+	default:
+		srv.log.Error().Err(err).Msg("databroker: storage initialization failed")
+	}
+}
+
+// retryStorageInitLocked retries initializing the storage with backoff in the
+// background, until it succeeds and the server is no longer degraded.
+func (srv *Server) retryStorageInitLocked() {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.stopStorageInitRetry = cancel
+	go func() {
+		backoff := storageInitRetryBackoff
+		for sleepContext(ctx, backoff) {
+			srv.mu.Lock()
+			if ctx.Err() != nil {
+				srv.mu.Unlock()
+				return
+			}
+			err := srv.initVersion()
+			if err == nil {
+				srv.log.Info().Msg("databroker: storage initialized, serving")
+				srv.storageInitErr = nil
+				srv.stopStorageInitRetryLocked()
+				srv.mu.Unlock()
+				return
+			}
+			srv.storageInitErr = err
+			srv.mu.Unlock()
+
+			srv.log.Warn().Err(err).Dur("backoff", backoff).Msg("databroker: storage initialization failed, retrying")
+			backoff *= 2
+			if backoff > storageInitMaxRetryBackoff {
+				backoff = storageInitMaxRetryBackoff
+			}
+		}
+	}()
+}
+
+func (srv *Server) stopStorageInitRetryLocked() {
+	if srv.stopStorageInitRetry != nil {
+		srv.stopStorageInitRetry()
+		srv.stopStorageInitRetry = nil
+	}
+	srv.storageInitErr = nil
+}
+
+// Healthy reports whether the server is serving. It's false while the server is
+// degraded because the storage failed to initialize, or while the default
+// storage, a storage shard or the storage route of a critical record type is
+// unhealthy.
+func (srv *Server) Healthy() bool {
+	srv.mu.RLock()
+	storageInitErr := srv.storageInitErr
+	srv.mu.RUnlock()
+	if storageInitErr != nil {
+		return false
+	}
+
+	for _, h := range srv.BackendHealth() {
+		if !h.Healthy() && srv.getConfig().isCriticalBackend(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns an error if the server isn't serving, like Healthy, or if its
+// storage can't be reached. Unlike Healthy, it probes the storage, so that a dead
+// connection is noticed before a write fails on it. The probe fails once ctx is
+// done.
+func (srv *Server) Check(ctx context.Context) error {
+	backend, _, err := srv.getBackend()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range storage.GetBackendHealth(backend) {
+		if !h.Healthy() && srv.getConfig().isCriticalBackend(h) {
+			return h.Err
+		}
+	}
+	return storage.Check(ctx, backend)
+}
+
+// BackendHealth returns the health of each of the storage backends the records
+// are routed to, by storage route or shard. It's nil if there's a single storage
+// backend, or it isn't created yet.
+func (srv *Server) BackendHealth() []storage.BackendHealth {
+	srv.mu.RLock()
+	backend := srv.backend
+	srv.mu.RUnlock()
+	if backend == nil {
+		return nil
+	}
+	return storage.GetBackendHealth(backend)
+}
@@ -0,0 +1,157 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+// An unreachableBackend fails every read until it's reachable.
+type unreachableBackend struct {
+	storage.Backend
+	reachable int32
+}
+
+func (backend *unreachableBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	if atomic.LoadInt32(&backend.reachable) == 0 {
+		return nil, errors.New("connection refused")
+	}
+	return backend.Backend.Get(ctx, recordType, id)
+}
+
+func TestServer_OnStorageInitFailure(t *testing.T) {
+	originalBackoff := storageInitRetryBackoff
+	storageInitRetryBackoff = time.Millisecond * 10
+	defer func() { storageInitRetryBackoff = originalBackoff }()
+
+	t.Run("start degraded", func(t *testing.T) {
+		ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+		defer clearTimeout()
+
+		backend := &unreachableBackend{Backend: inmemory.New()}
+		srv := newServer(newServerConfig(WithOnStorageInitFailure(StorageInitFailureStartDegraded)))
+		srv.backend = backend
+		srv.mu.Lock()
+		srv.initStorageLocked()
+		srv.mu.Unlock()
+		defer func() { _ = srv.Close() }()
+
+		assert.False(t, srv.Healthy())
+		_, err := srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: "1"}})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+
+		// the storage comes up after the server
+		atomic.StoreInt32(&backend.reachable, 1)
+		require.Eventually(t, srv.Healthy, time.Second*5, time.Millisecond*10)
+
+		_, err = srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: "1"}})
+		assert.NoError(t, err)
+		srv.mu.RLock()
+		assert.NotEqual(t, uint64(11), srv.version, "the server version should be initialized from the storage")
+		srv.mu.RUnlock()
+	})
+	t.Run("fail fast", func(t *testing.T) {
+		var code int
+		osExit = func(c int) { code = c }
+		defer func() { osExit = os.Exit }()
+
+		srv := newServer(newServerConfig(WithOnStorageInitFailure(StorageInitFailureFailFast)))
+		srv.backend = &unreachableBackend{Backend: inmemory.New()}
+		srv.mu.Lock()
+		srv.initStorageLocked()
+		srv.mu.Unlock()
+		defer func() { _ = srv.Close() }()
+
+		assert.Equal(t, 1, code)
+	})
+}
+
+// A disconnectingBackend's record streams fail once it's disconnected, and it
+// can't be synced again.
+type disconnectingBackend struct {
+	storage.Backend
+	streamCtx  context.Context
+	disconnect context.CancelFunc
+}
+
+func newDisconnectingBackend() *disconnectingBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &disconnectingBackend{Backend: inmemory.New(), streamCtx: ctx, disconnect: cancel}
+}
+
+func (backend *disconnectingBackend) Sync(_ context.Context, version uint64) (storage.RecordStream, error) {
+	if backend.streamCtx.Err() != nil {
+		return nil, errors.New("connection refused")
+	}
+	return backend.Backend.Sync(backend.streamCtx, version)
+}
+
+func TestServer_BackendHealth(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	sessions, users := newDisconnectingBackend(), newDisconnectingBackend()
+	backend, err := storage.NewRoutedBackend(ctx, inmemory.New(), map[string]storage.Backend{
+		"session": sessions,
+		"user":    users,
+	})
+	require.NoError(t, err)
+	srv := newServer(newServerConfig(WithCriticalRecordType("user")))
+	srv.backend = backend
+	defer func() { _ = srv.Close() }()
+
+	assert.True(t, srv.Healthy())
+
+	sessions.disconnect()
+	require.Eventually(t, func() bool {
+		return !srv.BackendHealth()[1].Healthy()
+	}, time.Second*5, time.Millisecond*10)
+	health := srv.BackendHealth()
+	require.Len(t, health, 3)
+	assert.True(t, health[0].Healthy(), "the default storage should be healthy")
+	assert.Equal(t, []string{"session"}, health[1].RecordTypes)
+	assert.False(t, health[1].Healthy(), "the session storage should be unhealthy")
+	assert.Equal(t, []string{"user"}, health[2].RecordTypes)
+	assert.True(t, health[2].Healthy(), "the user storage should be healthy")
+	assert.True(t, srv.Healthy(), "a storage route of a non-critical type failing should only degrade the server")
+
+	users.disconnect()
+	require.Eventually(t, func() bool {
+		return !srv.Healthy()
+	}, time.Second*5, time.Millisecond*10, "a storage route of a critical type failing should fail the server")
+}
+
+// A checkedBackend fails its storage checks with err.
+type checkedBackend struct {
+	storage.Backend
+	err error
+}
+
+func (backend *checkedBackend) Check(ctx context.Context) error {
+	return backend.err
+}
+
+func TestServer_Check(t *testing.T) {
+	ctx := context.Background()
+
+	srv := newServer(newServerConfig())
+	defer func() { _ = srv.Close() }()
+	assert.NoError(t, srv.Check(ctx), "the in-memory storage should always be reachable")
+
+	srv.mu.Lock()
+	srv.backend = &checkedBackend{Backend: srv.backend, err: errors.New("connection refused")}
+	srv.mu.Unlock()
+	assert.EqualError(t, srv.Check(ctx), "connection refused")
+}
@@ -0,0 +1,153 @@
+package databroker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultStorageSecretRefreshInterval is the default interval at which the
+	// storage secret is checked for changes.
+	DefaultStorageSecretRefreshInterval = time.Minute
+
+	storageSecretTimeout = 10 * time.Second
+)
+
+// A KubernetesSecretClient reads Kubernetes secrets, such as with an in-cluster
+// client.
+type KubernetesSecretClient interface {
+	// GetSecret returns the data of the secret with the given namespace and name.
+	// An error is returned if the secret doesn't exist.
+	GetSecret(ctx context.Context, namespace, name string) (map[string][]byte, error)
+}
+
+// A KubernetesSecretRef references a Kubernetes secret which holds the storage
+// connection string and, optionally, the TLS material for storage connections.
+// Empty keys default to the keys of a Kubernetes TLS secret and
+// "connection_string".
+type KubernetesSecretRef struct {
+	Namespace string
+	Name      string
+
+	ConnectionStringKey string
+	CertificateKey      string
+	KeyKey              string
+	CAKey               string
+
+	// RefreshInterval is the interval at which the secret is checked for changes.
+	// 0 uses DefaultStorageSecretRefreshInterval.
+	RefreshInterval time.Duration
+}
+
+func (ref KubernetesSecretRef) withDefaults() KubernetesSecretRef {
+	if ref.ConnectionStringKey == "" {
+		ref.ConnectionStringKey = "connection_string"
+	}
+	if ref.CertificateKey == "" {
+		ref.CertificateKey = "tls.crt"
+	}
+	if ref.KeyKey == "" {
+		ref.KeyKey = "tls.key"
+	}
+	if ref.CAKey == "" {
+		ref.CAKey = "ca.crt"
+	}
+	if ref.RefreshInterval <= 0 {
+		ref.RefreshInterval = DefaultStorageSecretRefreshInterval
+	}
+	return ref
+}
+
+// WithStorageKubernetesSecret sets the storage connection string, and the storage
+// client certificate and CA if present, from the referenced Kubernetes secret. The
+// secret is read with the given client when the config is updated, and re-read at
+// the refresh interval, so that the storage is reconnected after the secret is
+// rotated. It takes precedence over the other storage connection string,
+// certificate and CA options. If the secret can't be read, or has no connection
+// string, the storage fails to connect rather than falling back to them.
+func WithStorageKubernetesSecret(client KubernetesSecretClient, ref KubernetesSecretRef) ServerOption {
+	return func(cfg *serverConfig) {
+		ref = ref.withDefaults()
+		cfg.storageSecretClient = client
+		cfg.storageSecret = &ref
+	}
+}
+
+// resolveStorageSecret sets the storage settings of the config from its storage
+// secret, if any. If the secret can't be read, the error is recorded in the
+// config, so that the backend fails closed.
+func resolveStorageSecret(cfg *serverConfig) {
+	if cfg.storageSecret == nil {
+		return
+	}
+	ref := cfg.storageSecret
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), storageSecretTimeout)
+	defer clearTimeout()
+	data, err := cfg.storageSecretClient.GetSecret(ctx, ref.Namespace, ref.Name)
+	if err == nil && len(data[ref.ConnectionStringKey]) == 0 {
+		err = fmt.Errorf("missing key %s", ref.ConnectionStringKey)
+	}
+	if err != nil {
+		cfg.storageSecretError = fmt.Sprintf("failed to read databroker storage secret %s/%s: %v",
+			ref.Namespace, ref.Name, err)
+		return
+	}
+
+	cfg.storageSecretError = ""
+	cfg.storageConnectionString = string(bytes.TrimSpace(data[ref.ConnectionStringKey]))
+	if cert, key := data[ref.CertificateKey], data[ref.KeyKey]; len(cert) > 0 || len(key) > 0 {
+		cfg.storageCertificatePEM, cfg.storageKeyPEM = cert, key
+	}
+	if ca := data[ref.CAKey]; len(ca) > 0 {
+		cfg.storageCAPEM = ca
+	}
+}
+
+// watchStorageSecretLocked re-reads the storage secret at its refresh interval,
+// and updates the server when the settings resolved from it into the given config
+// change. The config must be the one before the secret was resolved.
+func (srv *Server) watchStorageSecretLocked(unresolved serverConfig) {
+	if unresolved.storageSecret == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.stopStorageSecretWatch = cancel
+	ticker := time.NewTicker(unresolved.storageSecret.RefreshInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// the secret is read without the lock, so that a slow read doesn't
+			// block requests
+			cfg := unresolved
+			resolveStorageSecret(&cfg)
+			srv.mu.Lock()
+			if ctx.Err() == nil {
+				if !configEqual(&cfg, srv.cfg) {
+					srv.log.Info().
+						Str("namespace", cfg.storageSecret.Namespace).
+						Str("name", cfg.storageSecret.Name).
+						Msg("storage secret changed")
+					srv.updateConfigLocked(&cfg)
+				}
+			}
+			srv.mu.Unlock()
+		}
+	}()
+}
+
+func (srv *Server) stopStorageSecretWatchLocked() {
+	if srv.stopStorageSecretWatch != nil {
+		srv.stopStorageSecretWatch()
+		srv.stopStorageSecretWatch = nil
+	}
+}
@@ -0,0 +1,85 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKubernetesSecretClient struct {
+	mu      sync.Mutex
+	secrets map[string]map[string][]byte
+}
+
+func (client *fakeKubernetesSecretClient) GetSecret(_ context.Context, namespace, name string) (map[string][]byte, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	data, ok := client.secrets[namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("secrets %q not found", name)
+	}
+	return data, nil
+}
+
+func (client *fakeKubernetesSecretClient) set(namespace, name string, data map[string][]byte) {
+	client.mu.Lock()
+	client.secrets[namespace+"/"+name] = data
+	client.mu.Unlock()
+}
+
+func TestServer_StorageKubernetesSecret(t *testing.T) {
+	client := &fakeKubernetesSecretClient{secrets: map[string]map[string][]byte{}}
+	client.set("pomerium", "storage", map[string][]byte{
+		"connection_string": []byte("redis://redis-1:6379\n"),
+		"tls.crt":           []byte("CERT-1"),
+		"tls.key":           []byte("KEY-1"),
+		"ca.crt":            []byte("CA-1"),
+	})
+
+	srv := New(
+		WithStorageConnectionString("redis://fallback:6379"),
+		WithStorageKubernetesSecret(client, KubernetesSecretRef{
+			Namespace:       "pomerium",
+			Name:            "storage",
+			RefreshInterval: time.Millisecond * 10,
+		}),
+	)
+	defer func() { _ = srv.Close() }()
+
+	cfg := srv.getConfig()
+	assert.Equal(t, "redis://redis-1:6379", cfg.storageConnectionString)
+	assert.Equal(t, []byte("CERT-1"), cfg.storageCertificatePEM)
+	assert.Equal(t, []byte("KEY-1"), cfg.storageKeyPEM)
+	assert.Equal(t, []byte("CA-1"), cfg.storageCAPEM)
+	_, _, err := srv.getBackend()
+	assert.NoError(t, err)
+
+	t.Run("rotated", func(t *testing.T) {
+		client.set("pomerium", "storage", map[string][]byte{
+			"connection_string": []byte("redis://redis-2:6379"),
+		})
+		assert.Eventually(t, func() bool {
+			return srv.getConfig().storageConnectionString == "redis://redis-2:6379"
+		}, time.Second*5, time.Millisecond*10)
+		cfg := srv.getConfig()
+		assert.Empty(t, cfg.storageCertificatePEM, "the certificate removed from the secret should be removed")
+		assert.Empty(t, cfg.storageCAPEM)
+	})
+	t.Run("missing", func(t *testing.T) {
+		srv := New(
+			WithStorageConnectionString("redis://fallback:6379"),
+			WithStorageKubernetesSecret(client, KubernetesSecretRef{Namespace: "pomerium", Name: "missing"}),
+		)
+		defer func() { _ = srv.Close() }()
+
+		_, _, err := srv.getBackend()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read databroker storage secret pomerium/missing")
+	})
+}
@@ -0,0 +1,57 @@
+package databroker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// The labels a client may attach to a Sync request.
+const (
+	syncLabelService  = "service"
+	syncLabelInstance = "instance"
+)
+
+// maxSyncLabelLength is the maximum length of a sync label value.
+const maxSyncLabelLength = 64
+
+var syncLabelValueRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+
+// syncLabels identify the client of a Sync stream. They are attached to the
+// per-stream metrics and logs.
+type syncLabels struct {
+	service  string
+	instance string
+}
+
+// parseSyncLabels validates the labels of a Sync request. Only known labels are
+// accepted and their values are restricted, so that clients can't cause a
+// cardinality blowup in metrics.
+func parseSyncLabels(labels map[string]string) (syncLabels, error) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parsed syncLabels
+	for _, k := range keys {
+		v := labels[k]
+		if len(v) > maxSyncLabelLength {
+			return parsed, fmt.Errorf("sync label %s must be at most %d characters", k, maxSyncLabelLength)
+		}
+		if !syncLabelValueRE.MatchString(v) {
+			return parsed, fmt.Errorf("sync label %s contains invalid characters", k)
+		}
+
+		switch k {
+		case syncLabelService:
+			parsed.service = v
+		case syncLabelInstance:
+			parsed.instance = v
+		default:
+			return parsed, fmt.Errorf("unknown sync label: %s", k)
+		}
+	}
+	return parsed, nil
+}
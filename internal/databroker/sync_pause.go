@@ -0,0 +1,335 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// DefaultSyncPauseBufferSize is the default maximum number of changes buffered for
+// a paused Sync stream.
+const DefaultSyncPauseBufferSize = 1000
+
+// syncPausePollInterval is how often a paused stream checks for new changes to
+// buffer, while the buffer isn't full.
+const syncPausePollInterval = time.Second
+
+// syncPauses tracks the Sync streams which can be paused, by stream id, and the
+// total size of the changes buffered for them.
+type syncPauses struct {
+	mu            sync.Mutex
+	streams       map[string]*syncPause
+	bufferedBytes int64
+}
+
+// register registers a stream with the given id. It returns false if the id is
+// already in use.
+func (p *syncPauses) register(streamID string) (*syncPause, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.streams[streamID]; ok {
+		return nil, false
+	}
+	if p.streams == nil {
+		p.streams = make(map[string]*syncPause)
+	}
+	pause := &syncPause{id: streamID, shed: make(chan struct{})}
+	p.streams[streamID] = pause
+	return pause, true
+}
+
+func (p *syncPauses) unregister(streamID string) {
+	p.mu.Lock()
+	if pause, ok := p.streams[streamID]; ok {
+		p.releaseLocked(pause, pause.bufferedBytes)
+		delete(p.streams, streamID)
+	}
+	p.mu.Unlock()
+}
+
+// reserve reserves size bytes for a change buffered for the paused stream. If the
+// buffers of all the streams would then exceed maxBytes, the slowest streams, those
+// with the most buffered, are shed until the change fits. It returns false if the
+// stream itself is shed. A maxBytes of 0 means unlimited.
+func (p *syncPauses) reserve(pause *syncPause, size, maxBytes int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pause.isShed() {
+		return false
+	}
+	for maxBytes > 0 && p.bufferedBytes+size > maxBytes {
+		slowest := pause
+		for _, other := range p.streams {
+			if other.bufferedBytes > slowest.bufferedBytes {
+				slowest = other
+			}
+		}
+		p.shedLocked(slowest)
+		if slowest == pause {
+			return false
+		}
+	}
+	pause.bufferedBytes += size
+	p.bufferedBytes += size
+	metrics.SetDataBrokerSyncBufferedBytes(context.Background(), p.bufferedBytes)
+	return true
+}
+
+// release releases size bytes reserved for a change once it's removed from the
+// buffer of the stream.
+func (p *syncPauses) release(pause *syncPause, size int64) {
+	p.mu.Lock()
+	p.releaseLocked(pause, size)
+	p.mu.Unlock()
+}
+
+func (p *syncPauses) releaseLocked(pause *syncPause, size int64) {
+	// the buffer of a shed stream was released when it was shed
+	if pause.isShed() || size == 0 {
+		return
+	}
+	pause.bufferedBytes -= size
+	p.bufferedBytes -= size
+	metrics.SetDataBrokerSyncBufferedBytes(context.Background(), p.bufferedBytes)
+}
+
+// shedLocked releases the buffer of the stream and ends it, so that its client
+// syncs the changes from the change log again.
+func (p *syncPauses) shedLocked(pause *syncPause) {
+	log.Warn().
+		Str("stream_id", pause.id).
+		Int64("buffered_bytes", pause.bufferedBytes).
+		Msg("databroker: max notification buffer bytes reached, shedding the slowest sync stream")
+	p.bufferedBytes -= pause.bufferedBytes
+	pause.bufferedBytes = 0
+	close(pause.shed)
+	metrics.SetDataBrokerSyncBufferedBytes(context.Background(), p.bufferedBytes)
+}
+
+func (p *syncPauses) get(streamID string) (*syncPause, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pause, ok := p.streams[streamID]
+	return pause, ok
+}
+
+// A syncPause is the paused state of a Sync stream.
+type syncPause struct {
+	id string
+	// shed is closed when the stream is shed to bound the memory used by the
+	// buffers of all the streams.
+	shed chan struct{}
+	// bufferedBytes is the size of the changes buffered for the stream. It's
+	// guarded by the mutex of syncPauses.
+	bufferedBytes int64
+
+	mu sync.Mutex
+	// resumed is closed when the stream is resumed. It's nil while the stream
+	// isn't paused.
+	resumed chan struct{}
+}
+
+func (pause *syncPause) isShed() bool {
+	select {
+	case <-pause.shed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pause *syncPause) pause() {
+	pause.mu.Lock()
+	if pause.resumed == nil {
+		pause.resumed = make(chan struct{})
+	}
+	pause.mu.Unlock()
+}
+
+func (pause *syncPause) resume() {
+	pause.mu.Lock()
+	if pause.resumed != nil {
+		close(pause.resumed)
+		pause.resumed = nil
+	}
+	pause.mu.Unlock()
+}
+
+// resumedC returns a channel which is closed when the stream is resumed, or nil
+// if it isn't paused.
+func (pause *syncPause) resumedC() <-chan struct{} {
+	pause.mu.Lock()
+	defer pause.mu.Unlock()
+	return pause.resumed
+}
+
+// A pausableRecordStream is a RecordStream which returns no records while its Sync
+// stream is paused. Meanwhile the changes are read ahead from the underlying
+// stream into a buffer, up to its limit, and returned in order once resumed.
+//
+// The buffers of all the streams are bounded by maxBytes. A stream which is shed
+// to stay within it ends with a ResourceExhausted error.
+type pausableRecordStream struct {
+	storage.RecordStream
+	ctx      context.Context
+	pauses   *syncPauses
+	pause    *syncPause
+	limit    int
+	maxBytes int64
+
+	buffer  []*databroker.Record
+	current *databroker.Record
+}
+
+func newPausableRecordStream(
+	ctx context.Context,
+	pauses *syncPauses,
+	pause *syncPause,
+	limit int,
+	maxBytes int64,
+	underlying storage.RecordStream,
+) *pausableRecordStream {
+	return &pausableRecordStream{
+		RecordStream: underlying,
+		ctx:          ctx,
+		pauses:       pauses,
+		pause:        pause,
+		limit:        limit,
+		maxBytes:     maxBytes,
+	}
+}
+
+func (stream *pausableRecordStream) Next(block bool) bool {
+	for {
+		if stream.pause.isShed() {
+			stream.buffer = nil
+			return false
+		}
+
+		resumed := stream.pause.resumedC()
+		if resumed == nil {
+			if len(stream.buffer) > 0 {
+				stream.current, stream.buffer = stream.buffer[0], stream.buffer[1:]
+				stream.pauses.release(stream.pause, int64(proto.Size(stream.current)))
+				return true
+			}
+			if !stream.RecordStream.Next(block) {
+				return false
+			}
+			if stream.pause.resumedC() == nil {
+				stream.current = stream.RecordStream.Record()
+				return true
+			}
+			// paused while waiting for the record
+			stream.bufferRecord(stream.RecordStream.Record())
+			continue
+		}
+
+		if len(stream.buffer) < stream.limit && stream.RecordStream.Next(false) {
+			stream.bufferRecord(stream.RecordStream.Record())
+			continue
+		}
+
+		// once the buffer is full, changes are left in the underlying stream
+		// until the stream is resumed
+		var poll <-chan time.Time
+		var timer *time.Timer
+		if len(stream.buffer) < stream.limit {
+			timer = time.NewTimer(syncPausePollInterval)
+			poll = timer.C
+		}
+		select {
+		case <-stream.ctx.Done():
+		case <-stream.pause.shed:
+		case <-resumed:
+		case <-poll:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if stream.ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// bufferRecord buffers a record until the stream is resumed, unless the stream is
+// shed to make room for it.
+func (stream *pausableRecordStream) bufferRecord(record *databroker.Record) {
+	// a record which failed verification ends the underlying stream with its error
+	if record == nil {
+		return
+	}
+	if stream.pauses.reserve(stream.pause, int64(proto.Size(record)), stream.maxBytes) {
+		stream.buffer = append(stream.buffer, record)
+	}
+}
+
+func (stream *pausableRecordStream) Record() *databroker.Record {
+	return stream.current
+}
+
+func (stream *pausableRecordStream) Err() error {
+	if err := stream.RecordStream.Err(); err != nil {
+		return err
+	}
+	if stream.pause.isShed() {
+		return status.Error(codes.ResourceExhausted,
+			"sync stream shed to bound the memory used by notification buffers, re-sync required")
+	}
+	return stream.ctx.Err()
+}
+
+// PauseSync pauses the delivery of changes on the Sync stream with the given id.
+// Pausing a paused stream does nothing.
+func (srv *Server) PauseSync(ctx context.Context, req *databroker.PauseSyncRequest) (*databroker.PauseSyncResponse, error) {
+	_, span := trace.StartSpan(ctx, "databroker.grpc.PauseSync")
+	defer span.End()
+
+	pause, ok := srv.syncPauses.get(req.GetStreamId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sync stream not found: %s", req.GetStreamId())
+	}
+	pause.pause()
+	srv.log.Info().Str("stream_id", req.GetStreamId()).Msg("sync paused")
+
+	_, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.PauseSyncResponse{ServerVersion: version}, nil
+}
+
+// ResumeSync resumes the delivery of changes on the Sync stream with the given id,
+// starting with those buffered while it was paused. Resuming a stream which isn't
+// paused does nothing.
+func (srv *Server) ResumeSync(ctx context.Context, req *databroker.ResumeSyncRequest) (*databroker.ResumeSyncResponse, error) {
+	_, span := trace.StartSpan(ctx, "databroker.grpc.ResumeSync")
+	defer span.End()
+
+	pause, ok := srv.syncPauses.get(req.GetStreamId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sync stream not found: %s", req.GetStreamId())
+	}
+	pause.resume()
+	srv.log.Info().Str("stream_id", req.GetStreamId()).Msg("sync resumed")
+
+	_, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.ResumeSyncResponse{ServerVersion: version}, nil
+}
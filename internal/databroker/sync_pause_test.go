@@ -0,0 +1,178 @@
+package databroker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestServer_PauseSync(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	// a buffer smaller than the changes made while paused, so that some are left
+	// in the change log until the stream is resumed
+	srv := newServer(newServerConfig(WithSyncPauseBufferSize(2)))
+	client := newTestClient(t, srv)
+
+	put := func(t *testing.T, id string) {
+		_, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: id},
+		})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.Sync(ctx, &databroker.SyncRequest{
+		ServerVersion: srv.version,
+		StreamId:      "STREAM",
+	})
+	require.NoError(t, err)
+	received := make(chan string)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- res.GetRecord().GetId()
+		}
+	}()
+
+	// the stream is registered once it delivers a record
+	put(t, "1")
+	assert.Equal(t, "1", <-received)
+
+	_, err = client.PauseSync(ctx, &databroker.PauseSyncRequest{StreamId: "STREAM"})
+	require.NoError(t, err)
+	for i := 2; i <= 6; i++ {
+		put(t, fmt.Sprint(i))
+	}
+	select {
+	case id := <-received:
+		t.Fatalf("unexpected record delivered while paused: %s", id)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	_, err = client.ResumeSync(ctx, &databroker.ResumeSyncRequest{StreamId: "STREAM"})
+	require.NoError(t, err)
+	var ids []string
+	for len(ids) < 5 {
+		select {
+		case id := <-received:
+			ids = append(ids, id)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the buffered records")
+		}
+	}
+	assert.Equal(t, []string{"2", "3", "4", "5", "6"}, ids, "the buffered changes should be delivered in order")
+
+	put(t, "7")
+	assert.Equal(t, "7", <-received, "changes should be delivered once resumed")
+
+	t.Run("duplicate stream id", func(t *testing.T) {
+		stream, err := client.Sync(ctx, &databroker.SyncRequest{
+			ServerVersion: srv.version,
+			StreamId:      "STREAM",
+		})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+	t.Run("unknown stream id", func(t *testing.T) {
+		_, err := client.PauseSync(ctx, &databroker.PauseSyncRequest{StreamId: "UNKNOWN"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = client.ResumeSync(ctx, &databroker.ResumeSyncRequest{StreamId: "UNKNOWN"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestServer_MaxNotificationBufferBytes(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	// room for about four of the records buffered for all the streams
+	const maxBytes = 4500
+	srv := newServer(newServerConfig(WithMaxNotificationBufferBytes(maxBytes)))
+	client := newTestClient(t, srv)
+
+	data, err := anypb.New(wrapperspb.Bytes(make([]byte, 1000)))
+	require.NoError(t, err)
+	put := func(t *testing.T, id string) {
+		_, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: id, Data: data},
+		})
+		require.NoError(t, err)
+	}
+	bufferedBytes := func() int64 {
+		srv.syncPauses.mu.Lock()
+		defer srv.syncPauses.mu.Unlock()
+		return srv.syncPauses.bufferedBytes
+	}
+
+	type result struct {
+		id  string
+		err error
+	}
+	startSync := func(t *testing.T, streamID string) <-chan result {
+		stream, err := client.Sync(ctx, &databroker.SyncRequest{
+			ServerVersion: srv.version,
+			StreamId:      streamID,
+		})
+		require.NoError(t, err)
+		results := make(chan result, 10)
+		go func() {
+			for {
+				res, err := stream.Recv()
+				if err != nil {
+					results <- result{err: err}
+					close(results)
+					return
+				}
+				results <- result{id: res.GetRecord().GetId()}
+			}
+		}()
+		return results
+	}
+
+	slow, fast := startSync(t, "SLOW"), startSync(t, "FAST")
+	put(t, "0")
+	assert.Equal(t, "0", (<-slow).id)
+	assert.Equal(t, "0", (<-fast).id)
+
+	// the slow stream stalls while many changes are made
+	_, err = client.PauseSync(ctx, &databroker.PauseSyncRequest{StreamId: "SLOW"})
+	require.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		put(t, fmt.Sprint(i))
+		assert.Equal(t, fmt.Sprint(i), (<-fast).id)
+	}
+	assert.Eventually(t, func() bool { return bufferedBytes() > 4000 }, time.Second*5, time.Millisecond*10,
+		"the changes should be buffered for the slow stream")
+
+	// once the fast stream stalls too, the buffers exceed the limit
+	_, err = client.PauseSync(ctx, &databroker.PauseSyncRequest{StreamId: "FAST"})
+	require.NoError(t, err)
+	put(t, "5")
+
+	res := <-slow
+	assert.Equal(t, codes.ResourceExhausted, status.Code(res.err), "the slowest stream should be shed")
+	assert.Eventually(t, func() bool { return bufferedBytes() > 0 }, time.Second*5, time.Millisecond*10,
+		"the change should be buffered for the fast stream")
+	assert.LessOrEqual(t, bufferedBytes(), int64(maxBytes))
+
+	_, err = client.ResumeSync(ctx, &databroker.ResumeSyncRequest{StreamId: "FAST"})
+	require.NoError(t, err)
+	assert.Equal(t, "5", (<-fast).id, "the fast stream should keep its buffered changes")
+	assert.Equal(t, int64(0), bufferedBytes())
+}
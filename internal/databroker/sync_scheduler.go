@@ -0,0 +1,131 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+)
+
+// A syncScheduler bounds the number of records being sent on Sync streams at
+// once, and shares the sends between the streams in proportion to their weights,
+// so that a few streams with many records to send can't starve the others.
+//
+// Sends are scheduled with start-time fair queuing: each stream has a virtual
+// time, which advances by the inverse of its weight with each send, and the
+// waiting stream with the earliest virtual time goes next. A stream which was
+// idle resumes at the current virtual time, so it can't save up sends.
+type syncScheduler struct {
+	mu       sync.Mutex
+	inFlight int
+	streams  []*syncSchedulerStream
+	vtime    float64
+}
+
+type syncSchedulerStream struct {
+	weight float64
+	vtime  float64
+	// pending is closed when the stream's send is scheduled. It's nil when the
+	// stream isn't waiting.
+	pending chan struct{}
+}
+
+// register adds a stream with the given weight to the scheduler. The stream must
+// be unregistered when it's closed.
+func (s *syncScheduler) register(weight int) *syncSchedulerStream {
+	if weight <= 0 {
+		weight = 1
+	}
+	st := &syncSchedulerStream{weight: float64(weight)}
+
+	s.mu.Lock()
+	s.streams = append(s.streams, st)
+	s.mu.Unlock()
+	return st
+}
+
+func (s *syncScheduler) unregister(st *syncSchedulerStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.streams {
+		if s.streams[i] == st {
+			s.streams = append(s.streams[:i], s.streams[i+1:]...)
+			return
+		}
+	}
+}
+
+// acquire waits for the stream's turn to send a record, while at most capacity
+// records are sent at once. release must be called once the record is sent.
+func (s *syncScheduler) acquire(ctx context.Context, st *syncSchedulerStream, capacity int) error {
+	s.mu.Lock()
+	ready := make(chan struct{})
+	st.pending = ready
+	if st.vtime < s.vtime {
+		st.vtime = s.vtime
+	}
+	s.dispatchLocked(capacity)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st.pending == ready {
+		st.pending = nil
+	} else {
+		// the send was scheduled concurrently, so give the slot to another stream
+		s.inFlight--
+		s.dispatchLocked(capacity)
+	}
+	return ctx.Err()
+}
+
+// release frees the slot of a sent record.
+func (s *syncScheduler) release(capacity int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	s.dispatchLocked(capacity)
+}
+
+func (s *syncScheduler) dispatchLocked(capacity int) {
+	for s.inFlight < capacity {
+		st := s.nextLocked()
+		if st == nil {
+			return
+		}
+		close(st.pending)
+		st.pending = nil
+		s.inFlight++
+	}
+}
+
+// nextLocked returns the next waiting stream to schedule, or nil if no streams
+// are waiting.
+func (s *syncScheduler) nextLocked() *syncSchedulerStream {
+	var next *syncSchedulerStream
+	for _, st := range s.streams {
+		if st.pending != nil && (next == nil || st.vtime < next.vtime) {
+			next = st
+		}
+	}
+	if next != nil {
+		s.vtime = next.vtime
+		next.vtime += 1 / next.weight
+	}
+	return next
+}
+
+// syncWeight returns the scheduling weight of Sync streams from the given client
+// service.
+func (cfg *serverConfig) syncWeight(service string) int {
+	if weight, ok := cfg.syncWeights[service]; ok {
+		return weight
+	}
+	return 1
+}
@@ -0,0 +1,103 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncScheduler(t *testing.T) {
+	t.Run("light streams aren't starved", func(t *testing.T) {
+		ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+		defer clearTimeout()
+
+		var s syncScheduler
+		waiting := func() int {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			n := 0
+			for _, st := range s.streams {
+				if st.pending != nil {
+					n++
+				}
+			}
+			return n
+		}
+
+		// hold the only slot until every stream is waiting
+		blocker := s.register(1)
+		require.NoError(t, s.acquire(ctx, blocker, 1))
+
+		var mu sync.Mutex
+		var sent []string
+		var wg sync.WaitGroup
+		consume := func(name string, n int) {
+			st := s.register(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.unregister(st)
+				for i := 0; i < n; i++ {
+					if !assert.NoError(t, s.acquire(ctx, st, 1)) {
+						return
+					}
+					mu.Lock()
+					sent = append(sent, name)
+					mu.Unlock()
+					s.release(1)
+				}
+			}()
+		}
+		consume("heavy", 1000)
+		for _, name := range []string{"light-1", "light-2", "light-3"} {
+			consume(name, 10)
+		}
+		require.Eventually(t, func() bool { return waiting() == 4 }, time.Second, time.Millisecond)
+		s.release(1)
+		wg.Wait()
+
+		heavy, lights := 0, 0
+		for _, name := range sent {
+			if name == "heavy" {
+				heavy++
+			} else {
+				lights++
+			}
+			if lights == 30 {
+				break
+			}
+		}
+		// with equal weights the heavy stream gets a quarter of the sends while the
+		// light streams are waiting, or about 10 of them
+		assert.LessOrEqual(t, heavy, 20, "light streams should finish while the heavy stream is still sending")
+	})
+	t.Run("weights", func(t *testing.T) {
+		var s syncScheduler
+		heavy, light := s.register(3), s.register(1)
+
+		counts := map[*syncSchedulerStream]int{}
+		for i := 0; i < 40; i++ {
+			heavy.pending, light.pending = make(chan struct{}), make(chan struct{})
+			counts[s.nextLocked()]++
+		}
+		assert.Equal(t, 30, counts[heavy])
+		assert.Equal(t, 10, counts[light])
+	})
+	t.Run("canceled", func(t *testing.T) {
+		var s syncScheduler
+		a, b := s.register(1), s.register(1)
+		require.NoError(t, s.acquire(context.Background(), a, 1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, s.acquire(ctx, b, 1), context.Canceled)
+
+		s.release(1)
+		require.NoError(t, s.acquire(context.Background(), b, 1))
+		s.release(1)
+	})
+}
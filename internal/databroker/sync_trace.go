@@ -0,0 +1,79 @@
+package databroker
+
+import (
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// A syncTrace records the lifecycle of a Sync stream on its span. The records sent
+// without waiting for changes are annotated as a batch when the stream catches up.
+// Spans which aren't sampled ignore all of it.
+type syncTrace struct {
+	span *octrace.Span
+
+	records            int64
+	firstRecordVersion uint64
+	lastRecordVersion  uint64
+}
+
+func newSyncTrace(span *octrace.Span, req *databroker.SyncRequest, labels syncLabels, compression string) *syncTrace {
+	st := &syncTrace{span: span}
+	if span.IsRecordingEvents() {
+		span.AddAttributes(
+			octrace.StringAttribute("databroker.sync.client_service", labels.service),
+			octrace.StringAttribute("databroker.sync.client_instance", labels.instance),
+			octrace.Int64Attribute("databroker.sync.server_version", int64(req.GetServerVersion())),
+			octrace.Int64Attribute("databroker.sync.record_version", int64(req.GetRecordVersion())),
+			octrace.StringAttribute("databroker.sync.compression", compression),
+			// a stream which doesn't start from the beginning resumes one which was
+			// interrupted, usually by a reconnect
+			octrace.BoolAttribute("databroker.sync.resumed", req.GetRecordVersion() > 0),
+		)
+	}
+	return st
+}
+
+// delivered adds a sent record to the current batch.
+func (st *syncTrace) delivered(record *databroker.Record) {
+	if st.records == 0 {
+		st.firstRecordVersion = record.GetVersion()
+	}
+	st.lastRecordVersion = record.GetVersion()
+	st.records++
+}
+
+// endBatch annotates the records sent since the last batch, if any.
+func (st *syncTrace) endBatch() {
+	if st.records == 0 {
+		return
+	}
+	if st.span.IsRecordingEvents() {
+		st.span.Annotate([]octrace.Attribute{
+			octrace.Int64Attribute("records", st.records),
+			octrace.Int64Attribute("first_record_version", int64(st.firstRecordVersion)),
+			octrace.Int64Attribute("last_record_version", int64(st.lastRecordVersion)),
+		}, "delivered batch")
+	}
+	st.records = 0
+}
+
+// resync annotates that the client has to re-sync, and why.
+func (st *syncTrace) resync(reason string) {
+	if st.span.IsRecordingEvents() {
+		st.span.Annotate([]octrace.Attribute{
+			octrace.StringAttribute("reason", reason),
+		}, "re-sync required")
+	}
+}
+
+// end annotates the last batch and sets the span status from the error the
+// stream ended with.
+func (st *syncTrace) end(err error) {
+	st.endBatch()
+	if err != nil {
+		s := status.Convert(err)
+		st.span.SetStatus(octrace.Status{Code: int32(s.Code()), Message: s.Message()})
+	}
+}
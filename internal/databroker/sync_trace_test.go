@@ -0,0 +1,114 @@
+package databroker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type testSpanExporter struct {
+	mu    sync.Mutex
+	spans []*octrace.SpanData
+}
+
+func (e *testSpanExporter) ExportSpan(sd *octrace.SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, sd)
+	e.mu.Unlock()
+}
+
+func (e *testSpanExporter) find(name string) *octrace.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, sd := range e.spans {
+		if sd.Name == name {
+			return sd
+		}
+	}
+	return nil
+}
+
+func TestSyncTrace(t *testing.T) {
+	exporter := new(testSpanExporter)
+	octrace.RegisterExporter(exporter)
+	defer octrace.UnregisterExporter(exporter)
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.AlwaysSample()})
+	defer octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(1e-4)})
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	srv := newServer(newServerConfig())
+	client := newTestClient(t, srv)
+
+	for _, id := range []string{"1", "2", "3"} {
+		_, err := srv.Put(ctx, &databroker.PutRequest{
+			Record: &databroker.Record{Type: "TYPE", Id: id},
+		})
+		require.NoError(t, err)
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Sync(streamCtx, &databroker.SyncRequest{ServerVersion: srv.version})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := stream.Recv()
+		require.NoError(t, err)
+	}
+
+	_, err = srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "4"},
+	})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	cancel()
+
+	var sd *octrace.SpanData
+	require.Eventually(t, func() bool {
+		sd = exporter.find("databroker.grpc.Sync")
+		return sd != nil
+	}, time.Second*5, time.Millisecond*10, "the stream span should be exported when the stream closes")
+
+	var batches []int64
+	for _, annotation := range sd.Annotations {
+		if annotation.Message == "delivered batch" {
+			batches = append(batches, annotation.Attributes["records"].(int64))
+		}
+	}
+	assert.Equal(t, []int64{3, 1}, batches, "each batch delivered should be annotated")
+	assert.Equal(t, false, sd.Attributes["databroker.sync.resumed"])
+
+	t.Run("re-sync", func(t *testing.T) {
+		stream, err := client.Sync(ctx, &databroker.SyncRequest{ServerVersion: srv.version + 1})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.Aborted, status.Code(err))
+
+		var messages []string
+		require.Eventually(t, func() bool {
+			exporter.mu.Lock()
+			defer exporter.mu.Unlock()
+			messages = nil
+			for _, sd := range exporter.spans {
+				if sd.Name != "databroker.grpc.Sync" || sd.Status.Code != int32(codes.Aborted) {
+					continue
+				}
+				for _, annotation := range sd.Annotations {
+					messages = append(messages, annotation.Message)
+				}
+			}
+			return len(messages) > 0
+		}, time.Second*5, time.Millisecond*10)
+		assert.Equal(t, []string{"re-sync required"}, messages)
+	})
+}
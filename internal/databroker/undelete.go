@@ -0,0 +1,133 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// Undelete restores a deleted record to its last version before the deletion. The
+// restored record is written as a new version, so Sync streams are notified of
+// it like any other change. The last version is read from the change log, so a
+// record can only be restored while its changes are retained: once it has been
+// permanently deleted, or its changes were scrubbed, NotFound is returned.
+func (srv *Server) Undelete(ctx context.Context, req *databroker.UndeleteRequest) (*databroker.UndeleteResponse, error) {
+	ctx, span := srv.startRequestSpan(ctx, "databroker.grpc.Undelete")
+	defer span.End()
+
+	log.Ctx(ctx).Info().
+		Str("peer", grpcutil.GetPeerAddr(ctx)).
+		Str("type", req.GetType()).
+		Str("id", req.GetId()).
+		Msg("undelete")
+
+	if err := srv.checkSafeMode(); err != nil {
+		return nil, err
+	}
+	if err := srv.getConfig().checkRecordType(req.GetType()); err != nil {
+		return nil, err
+	}
+
+	release, err := srv.syncOps.acquire(ctx, srv.getConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	endWrite, err := srv.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer endWrite()
+
+	unlockRecord := srv.recordLocks.lock(req.GetType(), req.GetId())
+	defer unlockRecord()
+
+	db, version, err := srv.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := db.Get(storage.WithConsistency(ctx, storage.ConsistencyStrong), req.GetType(), req.GetId())
+	switch {
+	case err == nil && current.GetDeletedAt() == nil:
+		return nil, status.Errorf(codes.FailedPrecondition, "record %s/%s is not deleted", req.GetType(), req.GetId())
+	case err != nil && !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+
+	record, err := getLastLiveVersion(ctx, db, req.GetType(), req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	record.DeletedAt = nil
+	record.Version = 0
+	if err := srv.validateRecord(record); err != nil {
+		return nil, err
+	}
+
+	unlockQuota, err := srv.lockRecordQuota(ctx, db, record)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockQuota()
+
+	srv.stampLastWriter(ctx, req.GetActor(), record)
+	srv.recordRecordBytes(ctx, record)
+	if err := db.Put(ctx, record); err != nil {
+		return nil, err
+	}
+	srv.recordLastWrite(ctx, record.GetType(), record.GetModifiedAt().AsTime())
+	srv.recordLoads.invalidate(loadedRecordKey{recordType: record.GetType(), id: record.GetId()})
+	if err := srv.writeAuditEvents(ctx, newAuditEvent("undelete", record)); err != nil {
+		return nil, err
+	}
+	return &databroker.UndeleteResponse{
+		ServerVersion: version,
+		Record:        record,
+	}, nil
+}
+
+// getLastLiveVersion returns the last version of the record before it was
+// deleted, from the changes retained by the backend. It returns NotFound if the
+// record's latest change isn't a deletion, or the version before it isn't
+// retained.
+func getLastLiveVersion(ctx context.Context, db storage.Backend, recordType, id string) (*databroker.Record, error) {
+	stream, err := db.Sync(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.Close() }()
+
+	var latest, live *databroker.Record
+	for stream.Next(false) {
+		change := stream.Record()
+		if change == nil {
+			// the change failed verification, which is returned by Err
+			break
+		}
+		if change.GetType() != recordType || change.GetId() != id {
+			continue
+		}
+		latest = change
+		if change.GetDeletedAt() == nil {
+			live = change
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	if latest == nil || latest.GetDeletedAt() == nil || live == nil {
+		return nil, status.Error(codes.NotFound, "deleted record not found")
+	}
+	return proto.Clone(live).(*databroker.Record), nil
+}
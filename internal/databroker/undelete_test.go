@@ -0,0 +1,87 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+func TestServer_Undelete(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	srv := newServer(newServerConfig())
+	client := newTestClient(t, srv)
+
+	data, err := anypb.New(&user.User{Id: "u1", Name: "NAME"})
+	require.NoError(t, err)
+	_, err = srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: data.GetTypeUrl(), Id: "u1", Data: data},
+	})
+	require.NoError(t, err)
+
+	_, err = srv.Undelete(ctx, &databroker.UndeleteRequest{Type: data.GetTypeUrl(), Id: "u1"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "live records can't be undeleted")
+
+	deleted, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: data.GetTypeUrl(), Id: "u1", DeletedAt: timestamppb.Now()},
+	})
+	require.NoError(t, err)
+	_, err = srv.Get(ctx, &databroker.GetRequest{Type: data.GetTypeUrl(), Id: "u1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err := client.Sync(ctx, &databroker.SyncRequest{
+		ServerVersion: srv.version,
+		RecordVersion: deleted.GetRecord().GetVersion(),
+	})
+	require.NoError(t, err)
+
+	res, err := srv.Undelete(ctx, &databroker.UndeleteRequest{Type: data.GetTypeUrl(), Id: "u1", Actor: "ADMIN"})
+	require.NoError(t, err)
+	assert.Nil(t, res.GetRecord().GetDeletedAt())
+	assert.Greater(t, res.GetRecord().GetVersion(), deleted.GetRecord().GetVersion(), "the record should be restored with a new version")
+	assert.Equal(t, "ADMIN", res.GetRecord().GetLastWriter().GetActor())
+
+	got, err := srv.Get(ctx, &databroker.GetRequest{Type: data.GetTypeUrl(), Id: "u1"})
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(data, got.GetRecord().GetData()), "the data before the deletion should be restored")
+
+	synced, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, res.GetRecord().GetVersion(), synced.GetRecord().GetVersion(), "watchers should be notified")
+	assert.Nil(t, synced.GetRecord().GetDeletedAt())
+
+	_, err = srv.Undelete(ctx, &databroker.UndeleteRequest{Type: data.GetTypeUrl(), Id: "UNKNOWN"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	t.Run("permanently deleted", func(t *testing.T) {
+		srv := newServer(newServerConfig())
+		srv.backend = inmemory.New(inmemory.WithExpiry(time.Millisecond))
+		defer srv.backend.Close()
+
+		_, err := srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: "1", Data: data}})
+		require.NoError(t, err)
+		_, err = srv.Put(ctx, &databroker.PutRequest{Record: &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()}})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			res, err := srv.DumpChangeLog(ctx, &databroker.DumpChangeLogRequest{Type: "TYPE"})
+			return err == nil && len(res.GetRecords()) == 0
+		}, time.Second*5, time.Millisecond*100)
+
+		_, err = srv.Undelete(ctx, &databroker.UndeleteRequest{Type: "TYPE", Id: "1"})
+		assert.Equal(t, codes.NotFound, status.Code(err), "permanently deleted records can't be undeleted")
+	})
+}
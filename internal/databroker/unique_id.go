@@ -0,0 +1,53 @@
+package databroker
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// lockUniqueID checks that the record's id isn't used by a record of a different
+// type, if ids are globally unique, and holds the lock until the returned
+// function is called so that a concurrent put can't claim the id under another
+// type. Deletions are always accepted.
+func (srv *Server) lockUniqueID(ctx context.Context, db storage.Backend, record *databroker.Record) (unlock func(), err error) {
+	if !srv.getConfig().globallyUniqueIDs || record.GetDeletedAt() != nil {
+		return func() {}, nil
+	}
+
+	srv.uniqueIDMu.Lock()
+	unlock = srv.uniqueIDMu.Unlock
+
+	recordTypes, err := db.ListRecordTypes(ctx)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	ctx = storage.WithConsistency(ctx, storage.ConsistencyStrong)
+	for _, recordType := range recordTypes {
+		// the server version is stored alongside the records, but isn't one
+		if recordType == record.GetType() || recordType == recordTypeServerVersion {
+			continue
+		}
+		existing, err := db.Get(ctx, recordType, record.GetId())
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			continue
+		case err != nil:
+			unlock()
+			return nil, err
+		}
+		if existing.GetDeletedAt() != nil {
+			continue
+		}
+		unlock()
+		return nil, status.Errorf(codes.AlreadyExists,
+			"record id %s is already used by a record of type %s", record.GetId(), recordType)
+	}
+	return unlock, nil
+}
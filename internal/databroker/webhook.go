@@ -0,0 +1,174 @@
+package databroker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+const (
+	// DefaultWebhookBufferSize is the default maximum number of record changes
+	// buffered for each webhook URL.
+	DefaultWebhookBufferSize = 1000
+	// DefaultWebhookMaxAttempts is the default number of times the delivery of a
+	// record change to a webhook URL is attempted.
+	DefaultWebhookMaxAttempts = 5
+
+	// WebhookSignatureHeader is the header of a webhook request which holds the
+	// base64-encoded HMAC of its body, keyed by the shared key.
+	WebhookSignatureHeader = "X-Pomerium-Signature"
+
+	webhookTimeout = 10 * time.Second
+)
+
+// A webhookNotifier POSTs the record changes of a storage backend to the webhook
+// URLs. Changes are read from the backend's change feed, so writes never wait
+// for a webhook. Each URL has its own buffer, so a slow URL doesn't hold back the
+// others, and changes are dropped for a URL while its buffer is full.
+type webhookNotifier struct {
+	log            zerolog.Logger
+	client         *http.Client
+	secret         func() []byte
+	includePayload bool
+	serialization  ChangeSerialization
+	installationID string
+	maxAttempts    int
+	queues         map[string]chan []byte
+}
+
+// newWebhookNotifierLocked creates a webhook notifier for the configured webhook
+// URLs, and starts their deliveries until ctx is done.
+func (srv *Server) newWebhookNotifierLocked(ctx context.Context) *webhookNotifier {
+	n := &webhookNotifier{
+		log:            srv.log,
+		client:         &http.Client{Timeout: webhookTimeout},
+		secret:         func() []byte { return srv.getConfig().secret },
+		includePayload: srv.cfg.webhookIncludePayload,
+		serialization:  srv.cfg.webhookSerialization,
+		installationID: srv.cfg.installationID,
+		maxAttempts:    srv.cfg.webhookMaxAttempts,
+		queues:         make(map[string]chan []byte, len(srv.cfg.webhookURLs)),
+	}
+	for _, rawURL := range srv.cfg.webhookURLs {
+		if _, ok := n.queues[rawURL]; ok {
+			continue
+		}
+		queue := make(chan []byte, srv.cfg.webhookBufferSize)
+		n.queues[rawURL] = queue
+		go n.deliver(ctx, rawURL, queue)
+	}
+	return n
+}
+
+func (n *webhookNotifier) enqueue(ctx context.Context, record *databroker.Record) {
+	body, err := n.marshal(record)
+	if err != nil {
+		n.log.Error().Err(err).
+			Str("type", record.GetType()).
+			Str("id", record.GetId()).
+			Msg("failed to marshal webhook event")
+		return
+	}
+	for rawURL, queue := range n.queues {
+		select {
+		case queue <- body:
+		default:
+			n.log.Warn().
+				Str("url", rawURL).
+				Str("type", record.GetType()).
+				Str("id", record.GetId()).
+				Uint64("version", record.GetVersion()).
+				Msg("webhook buffer is full, dropping record change")
+			metrics.RecordDataBrokerWebhookEventDropped(ctx)
+		}
+	}
+}
+
+func (n *webhookNotifier) marshal(record *databroker.Record) ([]byte, error) {
+	switch n.serialization {
+	case ChangeSerializationJSON:
+		return marshalChangeEvent(record, n.includePayload)
+	case ChangeSerializationCloudEvents:
+		return marshalCloudEvent(record, n.includePayload, n.installationID)
+	}
+	return nil, fmt.Errorf("unsupported webhook serialization: %s", n.serialization)
+}
+
+func (n *webhookNotifier) contentType() string {
+	if n.serialization == ChangeSerializationCloudEvents {
+		return cloudEventsContentType
+	}
+	return "application/json"
+}
+
+// deliver POSTs the queued events to the webhook URL in order, until ctx is done.
+func (n *webhookNotifier) deliver(ctx context.Context, rawURL string, queue <-chan []byte) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-queue:
+			if err := n.post(ctx, rawURL, body); err != nil && ctx.Err() == nil {
+				n.log.Error().Err(err).Str("url", rawURL).Msg("failed to deliver webhook event")
+			}
+		}
+	}
+}
+
+// post POSTs the body to the webhook URL, retrying with backoff on connection
+// errors, 429s and 5xxs, up to the maximum number of attempts.
+func (n *webhookNotifier) post(ctx context.Context, rawURL string, body []byte) error {
+	backoff := changeFeedRetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = n.postOnce(ctx, rawURL, body)
+		if err == nil || !retry || attempt >= n.maxAttempts {
+			return err
+		}
+		n.log.Debug().Err(err).Str("url", rawURL).Int("attempt", attempt).Msg("webhook delivery failed, retrying")
+		if !sleepContext(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff = nextChangeFeedBackoff(backoff)
+	}
+}
+
+func (n *webhookNotifier) postOnce(ctx context.Context, rawURL string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", n.contentType())
+	if secret := n.secret(); len(secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader,
+			base64.StdEncoding.EncodeToString(cryptutil.GenerateHMAC(body, string(secret))))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+}
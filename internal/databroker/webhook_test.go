@@ -0,0 +1,151 @@
+package databroker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestServer_Webhooks(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	sharedKey := cryptutil.NewKey()
+
+	var mu sync.Mutex
+	var attempts int
+	events := make(chan changeEvent, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signature, _ := base64.StdEncoding.DecodeString(r.Header.Get(WebhookSignatureHeader))
+		if !assert.True(t, cryptutil.CheckHMAC(body, signature, string(sharedKey)), "invalid signature") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		attempts++
+		fail := attempts == 1
+		mu.Unlock()
+		if fail {
+			// the first delivery is retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var evt changeEvent
+		assert.NoError(t, json.Unmarshal(body, &evt))
+		events <- evt
+	}))
+	defer receiver.Close()
+
+	srv := New(
+		WithSharedKey(base64.StdEncoding.EncodeToString(sharedKey)),
+		WithWebhookURL(receiver.URL),
+	)
+	defer func() { _ = srv.Close() }()
+
+	put, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1"},
+	})
+	require.NoError(t, err)
+	deleted, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()},
+	})
+	require.NoError(t, err)
+
+	var received []changeEvent
+	for len(received) < 2 {
+		select {
+		case evt := <-events:
+			evt.Time = time.Time{}
+			received = append(received, evt)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the webhook events")
+		}
+	}
+	assert.Equal(t, []changeEvent{
+		{Type: "TYPE", ID: "1", Version: put.GetRecord().GetVersion(), Operation: "put"},
+		{Type: "TYPE", ID: "1", Version: deleted.GetRecord().GetVersion(), Operation: "delete"},
+	}, received)
+
+	mu.Lock()
+	assert.Equal(t, 3, attempts, "the failed delivery should be retried")
+	mu.Unlock()
+}
+
+func TestServer_WebhookCloudEvents(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	events := make(chan map[string]interface{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/cloudevents+json", r.Header.Get("Content-Type"))
+		var evt map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&evt))
+		events <- evt
+	}))
+	defer receiver.Close()
+
+	srv := New(
+		WithInstallationID("INSTALLATION"),
+		WithWebhookURL(receiver.URL),
+		WithWebhookSerialization(ChangeSerializationCloudEvents),
+	)
+	defer func() { _ = srv.Close() }()
+
+	put, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1"},
+	})
+	require.NoError(t, err)
+	deleted, err := srv.Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()},
+	})
+	require.NoError(t, err)
+
+	for _, expected := range []struct {
+		operation string
+		record    *databroker.Record
+	}{
+		{"put", put.GetRecord()},
+		{"delete", deleted.GetRecord()},
+	} {
+		var evt map[string]interface{}
+		select {
+		case evt = <-events:
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the webhook events")
+		}
+
+		// the required context attributes of the CloudEvents 1.0 spec, and the
+		// optional ones which are set
+		assert.Equal(t, "1.0", evt["specversion"])
+		assert.Equal(t, fmt.Sprintf("TYPE/1/%d", expected.record.GetVersion()), evt["id"])
+		assert.Equal(t, "urn:pomerium:databroker:INSTALLATION", evt["source"])
+		assert.Equal(t, "io.pomerium.databroker.record."+expected.operation, evt["type"])
+		assert.Equal(t, "TYPE/1", evt["subject"])
+		assert.Equal(t, "application/json", evt["datacontenttype"])
+		eventTime, err := time.Parse(time.RFC3339Nano, evt["time"].(string))
+		assert.NoError(t, err, "the time should be an RFC 3339 timestamp")
+		assert.True(t, eventTime.Equal(expected.record.GetModifiedAt().AsTime()))
+
+		data, ok := evt["data"].(map[string]interface{})
+		require.True(t, ok, "the data should be the JSON change event")
+		assert.Equal(t, expected.operation, data["operation"])
+		assert.Equal(t, float64(expected.record.GetVersion()), data["version"])
+	}
+}
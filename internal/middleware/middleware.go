@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
+
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
@@ -78,9 +80,24 @@ func TimeoutHandlerFunc(timeout time.Duration, timeoutError string) func(next ht
 	}
 }
 
+// bcryptPrefixes are the prefixes of the versions of bcrypt hashes.
+var bcryptPrefixes = []string{"$2a$", "$2b$", "$2y$"}
+
+// IsBcryptHash returns true if the password is a bcrypt hash rather than plaintext.
+func IsBcryptHash(password string) bool {
+	for _, prefix := range bcryptPrefixes {
+		if strings.HasPrefix(password, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // RequireBasicAuth creates a new handler that requires basic auth from the client before
-// calling the underlying handler.
+// calling the underlying handler. The password may be a bcrypt hash, in which case the
+// given password is compared against the hash.
 func RequireBasicAuth(username, password string) func(next http.Handler) http.Handler {
+	hashed := IsBcryptHash(password)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			u, p, ok := r.BasicAuth()
@@ -91,12 +108,21 @@ func RequireBasicAuth(username, password string) func(next http.Handler) http.Ha
 			}
 
 			givenUser := sha256.Sum256([]byte(u))
-			givenPass := sha256.Sum256([]byte(p))
 			requiredUser := sha256.Sum256([]byte(username))
-			requiredPass := sha256.Sum256([]byte(password))
+			userOK := subtle.ConstantTimeCompare(givenUser[:], requiredUser[:]) == 1
+
+			// the password is checked even if the user is wrong, so that an unknown
+			// user takes as long to reject as a wrong password
+			var passOK bool
+			if hashed {
+				passOK = bcrypt.CompareHashAndPassword([]byte(password), []byte(p)) == nil
+			} else {
+				givenPass := sha256.Sum256([]byte(p))
+				requiredPass := sha256.Sum256([]byte(password))
+				passOK = subtle.ConstantTimeCompare(givenPass[:], requiredPass[:]) == 1
+			}
 
-			if subtle.ConstantTimeCompare(givenUser[:], requiredUser[:]) != 1 ||
-				subtle.ConstantTimeCompare(givenPass[:], requiredPass[:]) != 1 {
+			if !userOK || !passOK {
 				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
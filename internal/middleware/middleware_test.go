@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
@@ -175,6 +176,10 @@ func TestRequireBasicAuth(t *testing.T) {
 		{"bad user", "foo", "bar", "buzz", "bar", 401},
 		{"empty", "", "", "", "", 401}, // don't add auth
 		{"empty user", "", "bar", "", "bar", 200},
+		{"bcrypt", "foo", "bar", "foo", bcryptHash(t, "bar"), 200},
+		{"bcrypt bad pass", "foo", "buzz", "foo", bcryptHash(t, "bar"), 401},
+		{"bcrypt bad user", "buzz", "bar", "foo", bcryptHash(t, "bar"), 401},
+		{"plaintext with a dollar prefix", "foo", "$2bar", "foo", "$2bar", 200},
 	}
 
 	for _, tt := range tests {
@@ -196,3 +201,12 @@ func TestRequireBasicAuth(t *testing.T) {
 		})
 	}
 }
+
+func bcryptHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/middleware"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	pb "github.com/pomerium/pomerium/pkg/grpc/registry"
 
@@ -33,6 +34,11 @@ func (r *Reporter) OnConfigChange(cfg *config.Config) {
 		log.Error().Err(err).Msg("service registry reporter")
 		return
 	}
+	if len(services) == 0 {
+		log.Info().Str("metrics_address", cfg.Options.MetricsAddr).
+			Msg("service registry reporter: metrics are served on a unix socket, which can't be scraped remotely, not reporting")
+		return
+	}
 
 	sharedKey, err := base64.StdEncoding.DecodeString(cfg.Options.SharedKey)
 	if err != nil {
@@ -53,6 +59,10 @@ func (r *Reporter) OnConfigChange(cfg *config.Config) {
 		CAFile:                  cfg.Options.CAFile,
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		Compression:             cfg.Options.GRPCCompression,
+		TLSMinVersion:           cfg.Options.GetGRPCTLSMinVersion(),
+		TLSCipherSuites:         cfg.Options.GetGRPCTLSCipherSuites(),
+		MaxRecvMsgSize:          cfg.Options.GRPCServerMaxSendMsgSize,
 		WithInsecure:            cfg.Options.GRPCInsecure,
 		InstallationID:          cfg.Options.InstallationID,
 		ServiceName:             cfg.Options.Services,
@@ -68,7 +78,13 @@ func (r *Reporter) OnConfigChange(cfg *config.Config) {
 	r.cancel = cancel
 }
 
+// getReportedServices returns the services to report to the registry. Metrics
+// served on a unix socket aren't reported, as other hosts can't scrape them.
 func getReportedServices(cfg *config.Config) ([]*pb.Service, error) {
+	if _, ok := config.MetricsSocketPath(cfg.Options.MetricsAddr); ok {
+		return nil, nil
+	}
+
 	mu, err := metricsURL(*cfg.Options)
 	if err != nil {
 		return nil, err
@@ -95,7 +111,13 @@ func metricsURL(o config.Options) (*url.URL, error) {
 		if len(parts) != 2 {
 			return nil, fmt.Errorf("expected username:password for basic auth")
 		}
-		u.User = url.UserPassword(parts[0], parts[1])
+		// a bcrypt hash can't be used by scrapers to authenticate, so the
+		// credentials are left out rather than advertising the hash
+		if middleware.IsBcryptHash(parts[1]) {
+			log.Warn().Msg("metrics basic auth password is a bcrypt hash, not reporting credentials to the service registry")
+		} else {
+			u.User = url.UserPassword(parts[0], parts[1])
+		}
 	}
 
 	if o.MetricsCertificate != "" || o.MetricsCertificateFile != "" {
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/pomerium/pomerium/config"
@@ -31,3 +32,26 @@ func TestMetricsURL(t *testing.T) {
 		assert.Error(t, err, opt)
 	}
 }
+
+func TestMetricsURLBcrypt(t *testing.T) {
+	hash := "$2a$10$Rke0dUhQkeGLaBnIGnaS8.wXT0/hXMcLfEkuZ5ItQh3QN6nYlCvYa"
+	u, err := metricsURL(config.Options{
+		MetricsAddr:      "my.host:9090",
+		MetricsBasicAuth: base64.StdEncoding.EncodeToString([]byte("myuser:" + hash)),
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://my.host:9090/metrics", u.String(), "a bcrypt hash should not be advertised")
+	}
+}
+
+func TestGetReportedServicesUnixSocket(t *testing.T) {
+	for _, addr := range []string{"unix:/run/pomerium/metrics.sock", "/run/pomerium/metrics.sock"} {
+		services, err := getReportedServices(&config.Config{Options: &config.Options{MetricsAddr: addr}})
+		assert.NoError(t, err, addr)
+		assert.Empty(t, services, addr)
+	}
+
+	services, err := getReportedServices(&config.Config{Options: &config.Options{MetricsAddr: "my.host:9090"}})
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+}
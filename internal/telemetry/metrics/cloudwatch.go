@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+const (
+	// cloudWatchMaxDatumsPerRequest is the maximum number of metric datums in a
+	// single PutMetricData request.
+	cloudWatchMaxDatumsPerRequest = 1000
+	// cloudWatchMaxDimensions is the maximum number of dimensions of a metric.
+	cloudWatchMaxDimensions = 30
+
+	// CloudWatchBackendDimension is the name of the dimension for the storage
+	// backend of the metrics forwarded to CloudWatch.
+	CloudWatchBackendDimension = "backend"
+)
+
+// cloudWatchMetricPrefixes are the prefixes of the metrics forwarded to
+// CloudWatch: the databroker and storage metrics.
+var cloudWatchMetricPrefixes = []string{"pomerium_databroker_", "pomerium_storage_"}
+
+// A CloudWatchDimension is a name/value pair of a CloudWatch metric.
+type CloudWatchDimension struct {
+	Name  string
+	Value string
+}
+
+// A CloudWatchDatum is a value of a CloudWatch metric.
+type CloudWatchDatum struct {
+	MetricName string
+	Dimensions []CloudWatchDimension
+	Value      float64
+	// Unit is a CloudWatch unit, such as "Count" or "None".
+	Unit      string
+	Timestamp time.Time
+}
+
+// A CloudWatchClient publishes metric data to CloudWatch.
+type CloudWatchClient interface {
+	PutMetricData(ctx context.Context, namespace string, data []CloudWatchDatum) error
+}
+
+// A CloudWatchForwarder periodically forwards the databroker and storage metrics
+// to CloudWatch, with prometheus labels, the installation id and the storage
+// backend mapped to dimensions.
+type CloudWatchForwarder struct {
+	gatherer       prom.Gatherer
+	client         CloudWatchClient
+	namespace      string
+	installationID string
+	backend        string
+
+	// counters are forwarded as deltas since the last flush
+	counters map[string]float64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// NewCloudWatchForwarder creates a new CloudWatchForwarder which publishes
+// metrics in the namespace with the client every interval until closed.
+func NewCloudWatchForwarder(
+	client CloudWatchClient,
+	namespace string,
+	interval time.Duration,
+	installationID, backend string,
+) (*CloudWatchForwarder, error) {
+	if _, err := getGlobalExporter(); err != nil {
+		return nil, err
+	}
+	return newCloudWatchForwarder(prom.DefaultGatherer, client, namespace, interval, installationID, backend), nil
+}
+
+func newCloudWatchForwarder(
+	gatherer prom.Gatherer,
+	client CloudWatchClient,
+	namespace string,
+	interval time.Duration,
+	installationID, backend string,
+) *CloudWatchForwarder {
+	fwd := &CloudWatchForwarder{
+		gatherer:       gatherer,
+		client:         client,
+		namespace:      namespace,
+		installationID: installationID,
+		backend:        backend,
+		counters:       make(map[string]float64),
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go fwd.run(interval)
+	return fwd
+}
+
+// Close stops the forwarder.
+func (fwd *CloudWatchForwarder) Close() error {
+	fwd.closeOnce.Do(func() {
+		close(fwd.closed)
+		<-fwd.done
+	})
+	return nil
+}
+
+func (fwd *CloudWatchForwarder) run(interval time.Duration) {
+	defer close(fwd.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fwd.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := fwd.flush(ctx, time.Now())
+		cancel()
+		if err != nil {
+			log.Warn().Err(err).Msg("telemetry/metrics: failed to forward metrics to cloudwatch")
+		}
+	}
+}
+
+func (fwd *CloudWatchForwarder) flush(ctx context.Context, now time.Time) error {
+	families, err := fwd.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("telemetry/metrics: failed to gather metrics: %w", err)
+	}
+
+	data := fwd.datums(families, now)
+	for len(data) > 0 {
+		batch := data
+		if len(batch) > cloudWatchMaxDatumsPerRequest {
+			batch = batch[:cloudWatchMaxDatumsPerRequest]
+		}
+		data = data[len(batch):]
+		if err := fwd.client.PutMetricData(ctx, fwd.namespace, batch); err != nil {
+			return fmt.Errorf("telemetry/metrics: failed to put cloudwatch metric data: %w", err)
+		}
+	}
+	return nil
+}
+
+func (fwd *CloudWatchForwarder) datums(families []*io_prometheus_client.MetricFamily, now time.Time) []CloudWatchDatum {
+	var data []CloudWatchDatum
+	add := func(name string, value float64, unit string, dimensions []CloudWatchDimension) {
+		// cloudwatch rejects values which aren't finite
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		data = append(data, CloudWatchDatum{
+			MetricName: name,
+			Dimensions: dimensions,
+			Value:      value,
+			Unit:       unit,
+			Timestamp:  now,
+		})
+	}
+
+	for _, family := range families {
+		name := family.GetName()
+		if !isCloudWatchMetric(name) {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			dimensions := fwd.dimensions(m.GetLabel())
+			switch family.GetType() {
+			case io_prometheus_client.MetricType_COUNTER:
+				key := name + "|" + m.String()
+				value := m.GetCounter().GetValue()
+				delta := value - fwd.counters[key]
+				if delta < 0 {
+					// the counter was reset
+					delta = value
+				}
+				fwd.counters[key] = value
+				add(name, delta, "Count", dimensions)
+			case io_prometheus_client.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue(), "None", dimensions)
+			case io_prometheus_client.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue(), "None", dimensions)
+			case io_prometheus_client.MetricType_HISTOGRAM:
+				add(name+"_count", float64(m.GetHistogram().GetSampleCount()), "Count", dimensions)
+				add(name+"_sum", m.GetHistogram().GetSampleSum(), "None", dimensions)
+			case io_prometheus_client.MetricType_SUMMARY:
+				add(name+"_count", float64(m.GetSummary().GetSampleCount()), "Count", dimensions)
+				add(name+"_sum", m.GetSummary().GetSampleSum(), "None", dimensions)
+			}
+		}
+	}
+	return data
+}
+
+func (fwd *CloudWatchForwarder) dimensions(labels []*io_prometheus_client.LabelPair) []CloudWatchDimension {
+	dimensions := make([]CloudWatchDimension, 0, len(labels)+2)
+	if fwd.installationID != "" {
+		dimensions = append(dimensions, CloudWatchDimension{Name: metrics.InstallationIDLabel, Value: fwd.installationID})
+	}
+	if fwd.backend != "" {
+		dimensions = append(dimensions, CloudWatchDimension{Name: CloudWatchBackendDimension, Value: fwd.backend})
+	}
+	sorted := append([]*io_prometheus_client.LabelPair{}, labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetName() < sorted[j].GetName() })
+	for _, label := range sorted {
+		// cloudwatch rejects empty dimension values
+		if label.GetValue() == "" || label.GetName() == metrics.InstallationIDLabel ||
+			label.GetName() == CloudWatchBackendDimension {
+			continue
+		}
+		dimensions = append(dimensions, CloudWatchDimension{Name: label.GetName(), Value: label.GetValue()})
+	}
+	if len(dimensions) > cloudWatchMaxDimensions {
+		dimensions = dimensions[:cloudWatchMaxDimensions]
+	}
+	return dimensions
+}
+
+func isCloudWatchMetric(name string) bool {
+	for _, prefix := range cloudWatchMetricPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
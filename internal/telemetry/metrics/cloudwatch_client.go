@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+type cloudWatchClient struct {
+	client *cloudwatch.Client
+}
+
+// NewCloudWatchClient creates a new CloudWatchClient which publishes metric data
+// to the CloudWatch API of the region. Credentials are resolved with the default
+// AWS credential chain, so the environment variables, the shared config files, a
+// web identity token (such as with IAM roles for service accounts), the ECS task
+// role and the EC2 instance profile are all supported, and temporary credentials
+// are refreshed before they expire.
+func NewCloudWatchClient(ctx context.Context, region string) (CloudWatchClient, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: failed to load AWS config: %w", err)
+	}
+	return &cloudWatchClient{client: cloudwatch.NewFromConfig(cfg)}, nil
+}
+
+func (c *cloudWatchClient) PutMetricData(ctx context.Context, namespace string, data []CloudWatchDatum) error {
+	_, err := c.client.PutMetricData(ctx, newPutMetricDataInput(namespace, data))
+	return err
+}
+
+func newPutMetricDataInput(namespace string, data []CloudWatchDatum) *cloudwatch.PutMetricDataInput {
+	input := &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(namespace),
+	}
+	for _, datum := range data {
+		metricDatum := types.MetricDatum{
+			MetricName: aws.String(datum.MetricName),
+			Value:      aws.Float64(datum.Value),
+		}
+		if datum.Unit != "" {
+			metricDatum.Unit = types.StandardUnit(datum.Unit)
+		}
+		if !datum.Timestamp.IsZero() {
+			metricDatum.Timestamp = aws.Time(datum.Timestamp)
+		}
+		for _, dimension := range datum.Dimensions {
+			metricDatum.Dimensions = append(metricDatum.Dimensions, types.Dimension{
+				Name:  aws.String(dimension.Name),
+				Value: aws.String(dimension.Value),
+			})
+		}
+		input.MetricData = append(input.MetricData, metricDatum)
+	}
+	return input
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCloudWatchClient struct {
+	mu         sync.Mutex
+	namespaces []string
+	data       []CloudWatchDatum
+}
+
+func (client *mockCloudWatchClient) PutMetricData(ctx context.Context, namespace string, data []CloudWatchDatum) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.namespaces = append(client.namespaces, namespace)
+	client.data = append(client.data, data...)
+	return nil
+}
+
+func TestCloudWatchForwarder(t *testing.T) {
+	reg := prom.NewRegistry()
+	gauge := prom.NewGaugeVec(prom.GaugeOpts{Name: "pomerium_databroker_test_gauge"}, []string{"service"})
+	reg.MustRegister(gauge)
+	gauge.WithLabelValues("databroker").Set(42)
+	other := prom.NewGauge(prom.GaugeOpts{Name: "pomerium_http_test_gauge"})
+	reg.MustRegister(other)
+	other.Set(1)
+
+	client := &mockCloudWatchClient{}
+	fwd := newCloudWatchForwarder(reg, client, "Pomerium", time.Hour, "INSTALLATION_ID", "redis")
+	defer func() { _ = fwd.Close() }()
+
+	now := time.Now()
+	require.NoError(t, fwd.flush(context.Background(), now))
+
+	assert.Equal(t, []string{"Pomerium"}, client.namespaces)
+	assert.Equal(t, []CloudWatchDatum{{
+		MetricName: "pomerium_databroker_test_gauge",
+		Dimensions: []CloudWatchDimension{
+			{Name: "installation_id", Value: "INSTALLATION_ID"},
+			{Name: "backend", Value: "redis"},
+			{Name: "service", Value: "databroker"},
+		},
+		Value:     42,
+		Unit:      "None",
+		Timestamp: now,
+	}}, client.data, "only the databroker and storage metrics should be pushed")
+}
+
+func TestNewPutMetricDataInput(t *testing.T) {
+	now := time.Date(2021, 8, 30, 12, 36, 0, 0, time.UTC)
+	input := newPutMetricDataInput("Pomerium", []CloudWatchDatum{
+		{
+			MetricName: "pomerium_databroker_test_gauge",
+			Dimensions: []CloudWatchDimension{{Name: "service", Value: "databroker"}},
+			Value:      42,
+			Unit:       "None",
+			Timestamp:  now,
+		},
+		{MetricName: "pomerium_storage_test_total", Value: 1},
+	})
+
+	assert.Equal(t, "Pomerium", aws.ToString(input.Namespace))
+	require.Len(t, input.MetricData, 2)
+	assert.Equal(t, "pomerium_databroker_test_gauge", aws.ToString(input.MetricData[0].MetricName))
+	assert.Equal(t, 42.0, aws.ToFloat64(input.MetricData[0].Value))
+	assert.Equal(t, types.StandardUnitNone, input.MetricData[0].Unit)
+	assert.Equal(t, now, aws.ToTime(input.MetricData[0].Timestamp))
+	require.Len(t, input.MetricData[0].Dimensions, 1)
+	assert.Equal(t, "service", aws.ToString(input.MetricData[0].Dimensions[0].Name))
+	assert.Equal(t, "databroker", aws.ToString(input.MetricData[0].Dimensions[0].Value))
+	assert.Empty(t, input.MetricData[1].Unit, "the unit should be omitted if not set")
+	assert.Nil(t, input.MetricData[1].Timestamp, "the timestamp should be omitted if not set")
+}
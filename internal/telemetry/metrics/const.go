@@ -15,9 +15,19 @@ var (
 	TagKeyHost        = tag.MustNewKey("host")
 	TagKeyDestination = tag.MustNewKey("destination")
 
-	TagKeyStorageOperation = tag.MustNewKey("operation")
-	TagKeyStorageResult    = tag.MustNewKey("result")
-	TagKeyStorageBackend   = tag.MustNewKey("backend")
+	TagKeyStorageOperation  = tag.MustNewKey("operation")
+	TagKeyStorageResult     = tag.MustNewKey("result")
+	TagKeyStorageBackend    = tag.MustNewKey("backend")
+	TagKeyStorageRecordType = tag.MustNewKey("record_type")
+	TagKeyStoragePolicy     = tag.MustNewKey("policy")
+	TagKeyStorageErrorClass = tag.MustNewKey("error_class")
+	TagKeyStoragePageSize   = tag.MustNewKey("page_size")
+
+	TagKeyQueue       = tag.MustNewKey("queue")
+	TagKeyCompression = tag.MustNewKey("compression")
+
+	TagKeyClientService  = tag.MustNewKey("client_service")
+	TagKeyClientInstance = tag.MustNewKey("client_instance")
 )
 
 // Default distributions used by views in this package.
@@ -32,6 +42,13 @@ var (
 		1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024,
 		2048, 4096, 8192, 16384,
 	)
+	dataBrokerRecordSizeDistribution = view.Distribution(
+		64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304,
+	)
+	// 1m, 10m, 1h, 6h, 1d, 7d, 30d, 90d
+	dataBrokerRecordAgeDistribution = view.Distribution(
+		60, 600, 3600, 21600, 86400, 604800, 2592000, 7776000,
+	)
 	DefaultMillisecondsDistribution = ocgrpc.DefaultMillisecondsDistribution
 )
 
@@ -44,5 +61,6 @@ var (
 		HTTPServerViews,
 		InfoViews,
 		StorageViews,
+		DataBrokerViews,
 	}
 )
@@ -0,0 +1,432 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var (
+	// DataBrokerViews contains opencensus views for databroker server metrics.
+	DataBrokerViews = []*view.View{
+		DataBrokerSyncStreamsRejectedView,
+		DataBrokerQueueDepthView,
+		DataBrokerRecordBytesView,
+		DataBrokerSignatureVerifyFailuresView,
+		DataBrokerSyncRecordsSentView,
+		DataBrokerDeletePermanentlyAfterView,
+		DataBrokerSyncCompressionSavedBytesView,
+		DataBrokerRecordsWithoutExpiryView,
+		DataBrokerRecordAgeView,
+		DataBrokerKeyRotationsView,
+		DataBrokerWebhookEventsDroppedView,
+		DataBrokerAuditEventsDroppedView,
+		DataBrokerLastWriteTimestampView,
+		DataBrokerSyncBufferedBytesView,
+	}
+
+	dataBrokerSyncStreamsRejected = stats.Int64(
+		"databroker_sync_streams_rejected_total",
+		"Total databroker sync streams rejected",
+		"1")
+
+	// DataBrokerSyncStreamsRejectedView is an OpenCensus view that counts the
+	// sync streams rejected because the maximum number of streams was reached.
+	DataBrokerSyncStreamsRejectedView = &view.View{
+		Name:        dataBrokerSyncStreamsRejected.Name(),
+		Description: dataBrokerSyncStreamsRejected.Description(),
+		Measure:     dataBrokerSyncStreamsRejected,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerQueueDepth = stats.Int64(
+		"databroker_queue_depth",
+		"Number of items waiting in databroker internal queues",
+		"1")
+
+	// DataBrokerQueueDepthView is an OpenCensus view that tracks the depth of
+	// databroker internal queues by queue.
+	DataBrokerQueueDepthView = &view.View{
+		Name:        dataBrokerQueueDepth.Name(),
+		Description: dataBrokerQueueDepth.Description(),
+		Measure:     dataBrokerQueueDepth,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyQueue},
+		Aggregation: view.LastValue(),
+	}
+
+	dataBrokerRecordBytes = stats.Int64(
+		"databroker_record_bytes",
+		"Size in bytes of records written to the databroker",
+		stats.UnitBytes)
+
+	// DataBrokerRecordBytesView is an OpenCensus view that tracks the size
+	// distribution of records written to the databroker by record type.
+	DataBrokerRecordBytesView = &view.View{
+		Name:        dataBrokerRecordBytes.Name(),
+		Description: dataBrokerRecordBytes.Description(),
+		Measure:     dataBrokerRecordBytes,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyStorageRecordType},
+		Aggregation: dataBrokerRecordSizeDistribution,
+	}
+
+	dataBrokerSignatureVerifyFailures = stats.Int64(
+		"databroker_signature_verify_failures_total",
+		"Total databroker records which failed signature verification on read",
+		"1")
+
+	// DataBrokerSignatureVerifyFailuresView is an OpenCensus view that counts the
+	// records read from storage which could not be verified with the current key,
+	// by record type.
+	DataBrokerSignatureVerifyFailuresView = &view.View{
+		Name:        dataBrokerSignatureVerifyFailures.Name(),
+		Description: dataBrokerSignatureVerifyFailures.Description(),
+		Measure:     dataBrokerSignatureVerifyFailures,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyStorageRecordType},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerSyncRecordsSent = stats.Int64(
+		"databroker_sync_records_sent_total",
+		"Total records sent to clients on databroker sync streams",
+		"1")
+
+	// DataBrokerSyncRecordsSentView is an OpenCensus view that counts the records
+	// sent on sync streams, by the labels the client identified itself with.
+	DataBrokerSyncRecordsSentView = &view.View{
+		Name:        dataBrokerSyncRecordsSent.Name(),
+		Description: dataBrokerSyncRecordsSent.Description(),
+		Measure:     dataBrokerSyncRecordsSent,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyClientService, TagKeyClientInstance},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerDeletePermanentlyAfter = stats.Float64(
+		"databroker_delete_permanently_after_seconds",
+		"Configured duration after which deleted databroker records are removed permanently",
+		stats.UnitSeconds)
+
+	// DataBrokerDeletePermanentlyAfterView is an OpenCensus view that tracks the
+	// configured delete permanently after duration.
+	DataBrokerDeletePermanentlyAfterView = &view.View{
+		Name:        dataBrokerDeletePermanentlyAfter.Name(),
+		Description: dataBrokerDeletePermanentlyAfter.Description(),
+		Measure:     dataBrokerDeletePermanentlyAfter,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.LastValue(),
+	}
+
+	dataBrokerSyncCompressionSavedBytes = stats.Int64(
+		"databroker_sync_compression_saved_bytes_total",
+		"Total bytes saved by compressing records sent on databroker sync streams",
+		stats.UnitBytes)
+
+	// DataBrokerSyncCompressionSavedBytesView is an OpenCensus view that sums the
+	// bytes saved by compressing records sent on sync streams, by codec.
+	DataBrokerSyncCompressionSavedBytesView = &view.View{
+		Name:        dataBrokerSyncCompressionSavedBytes.Name(),
+		Description: dataBrokerSyncCompressionSavedBytes.Description(),
+		Measure:     dataBrokerSyncCompressionSavedBytes,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyCompression},
+		Aggregation: view.Sum(),
+	}
+
+	dataBrokerRecordsWithoutExpiry = stats.Int64(
+		"databroker_records_without_expiry_total",
+		"Total databroker records written without an expiry for a type which requires one",
+		"1")
+
+	// DataBrokerRecordsWithoutExpiryView is an OpenCensus view that counts the
+	// records written without an expiry for a type which requires one, by record
+	// type.
+	DataBrokerRecordsWithoutExpiryView = &view.View{
+		Name:        dataBrokerRecordsWithoutExpiry.Name(),
+		Description: dataBrokerRecordsWithoutExpiry.Description(),
+		Measure:     dataBrokerRecordsWithoutExpiry,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyStorageRecordType},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerRecordAge = stats.Float64(
+		"databroker_record_age_seconds",
+		"Time since databroker records were last modified, sampled periodically",
+		stats.UnitSeconds)
+
+	// DataBrokerRecordAgeView is an OpenCensus view that tracks the age
+	// distribution of the stored records by record type. Every record is observed
+	// once per sample.
+	DataBrokerRecordAgeView = &view.View{
+		Name:        dataBrokerRecordAge.Name(),
+		Description: dataBrokerRecordAge.Description(),
+		Measure:     dataBrokerRecordAge,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyStorageRecordType},
+		Aggregation: dataBrokerRecordAgeDistribution,
+	}
+
+	dataBrokerKeyRotations = stats.Int64(
+		"databroker_key_rotations_total",
+		"Total databroker shared key rotations",
+		"1")
+
+	// DataBrokerKeyRotationsView is an OpenCensus view that counts the changes of
+	// the databroker shared key.
+	DataBrokerKeyRotationsView = &view.View{
+		Name:        dataBrokerKeyRotations.Name(),
+		Description: dataBrokerKeyRotations.Description(),
+		Measure:     dataBrokerKeyRotations,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerWebhookEventsDropped = stats.Int64(
+		"databroker_webhook_events_dropped_total",
+		"Total databroker webhook events dropped",
+		"1")
+
+	// DataBrokerWebhookEventsDroppedView is an OpenCensus view that counts the
+	// record change events dropped because the buffer of a webhook URL was full.
+	DataBrokerWebhookEventsDroppedView = &view.View{
+		Name:        dataBrokerWebhookEventsDropped.Name(),
+		Description: dataBrokerWebhookEventsDropped.Description(),
+		Measure:     dataBrokerWebhookEventsDropped,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerAuditEventsDropped = stats.Int64(
+		"databroker_audit_events_dropped_total",
+		"Total databroker audit events dropped",
+		"1")
+
+	// DataBrokerAuditEventsDroppedView is an OpenCensus view that counts the
+	// audit events of writes dropped because the audit buffer was full.
+	DataBrokerAuditEventsDroppedView = &view.View{
+		Name:        dataBrokerAuditEventsDropped.Name(),
+		Description: dataBrokerAuditEventsDropped.Description(),
+		Measure:     dataBrokerAuditEventsDropped,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	dataBrokerLastWriteTimestamp = stats.Float64(
+		"databroker_last_write_timestamp_seconds",
+		"Unix time of the latest write to the databroker",
+		stats.UnitSeconds)
+
+	// DataBrokerLastWriteTimestampView is an OpenCensus view that tracks the time of
+	// the latest write of a record, by record type.
+	DataBrokerLastWriteTimestampView = &view.View{
+		Name:        dataBrokerLastWriteTimestamp.Name(),
+		Description: dataBrokerLastWriteTimestamp.Description(),
+		Measure:     dataBrokerLastWriteTimestamp,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyStorageRecordType},
+		Aggregation: view.LastValue(),
+	}
+
+	dataBrokerSyncBufferedBytes = stats.Int64(
+		"databroker_sync_buffered_bytes",
+		"Total size of the changes buffered for paused databroker sync streams",
+		stats.UnitBytes)
+
+	// DataBrokerSyncBufferedBytesView is an OpenCensus view that tracks the total
+	// size of the changes buffered for paused sync streams.
+	DataBrokerSyncBufferedBytesView = &view.View{
+		Name:        dataBrokerSyncBufferedBytes.Name(),
+		Description: dataBrokerSyncBufferedBytes.Description(),
+		Measure:     dataBrokerSyncBufferedBytes,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.LastValue(),
+	}
+)
+
+// RecordDataBrokerSyncStreamRejected records that a sync stream was rejected.
+func RecordDataBrokerSyncStreamRejected(ctx context.Context) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerSyncStreamsRejected.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// SetDataBrokerQueueDepth records the current depth of a databroker queue.
+func SetDataBrokerQueueDepth(ctx context.Context, queue string, depth int64) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyQueue, queue),
+		},
+		dataBrokerQueueDepth.M(depth),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// SetDataBrokerSyncBufferedBytes records the total size of the changes buffered
+// for paused sync streams.
+func SetDataBrokerSyncBufferedBytes(ctx context.Context, size int64) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerSyncBufferedBytes.M(size),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerRecordBytes records the size of a record written to the
+// databroker. The record type should be bounded to avoid high cardinality.
+func RecordDataBrokerRecordBytes(ctx context.Context, recordType string, size int64) {
+	mutators := []tag.Mutator{
+		tag.Upsert(TagKeyService, "databroker"),
+		tag.Upsert(TagKeyStorageRecordType, recordType),
+	}
+	err := stats.RecordWithTags(ctx, mutators, dataBrokerRecordBytes.M(size))
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+	dataBrokerRecordBytesNative.observe(ctx, mutators, float64(size))
+}
+
+// RecordDataBrokerSignatureVerifyFailure records that a record read from storage
+// failed signature verification.
+func RecordDataBrokerSignatureVerifyFailure(ctx context.Context, recordType string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyStorageRecordType, recordType),
+		},
+		dataBrokerSignatureVerifyFailures.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerSyncRecordSent records that a record was sent on a sync stream.
+// The client labels must be validated to avoid high cardinality.
+func RecordDataBrokerSyncRecordSent(ctx context.Context, clientService, clientInstance string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyClientService, clientService),
+			tag.Upsert(TagKeyClientInstance, clientInstance),
+		},
+		dataBrokerSyncRecordsSent.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// SetDataBrokerDeletePermanentlyAfter records the configured duration after which
+// deleted records are removed permanently.
+func SetDataBrokerDeletePermanentlyAfter(ctx context.Context, d time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerDeletePermanentlyAfter.M(d.Seconds()),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerSyncCompressionSavedBytes records the bytes saved by compressing
+// a record sent on a sync stream with the given codec.
+func RecordDataBrokerSyncCompressionSavedBytes(ctx context.Context, codec string, saved int64) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyCompression, codec),
+		},
+		dataBrokerSyncCompressionSavedBytes.M(saved),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerRecordWithoutExpiry records that a record was written without
+// an expiry for a type which requires one.
+func RecordDataBrokerRecordWithoutExpiry(ctx context.Context, recordType string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyStorageRecordType, recordType),
+		},
+		dataBrokerRecordsWithoutExpiry.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerRecordAge records the age of a stored record, as observed by a
+// periodic sample. The record type should be bounded to avoid high cardinality.
+func RecordDataBrokerRecordAge(ctx context.Context, recordType string, age time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyStorageRecordType, recordType),
+		},
+		dataBrokerRecordAge.M(age.Seconds()),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerKeyRotation records that the shared key changed.
+func RecordDataBrokerKeyRotation(ctx context.Context) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerKeyRotations.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerWebhookEventDropped records that a webhook event was dropped.
+func RecordDataBrokerWebhookEventDropped(ctx context.Context) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerWebhookEventsDropped.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordDataBrokerAuditEventDropped records that an audit event was dropped.
+func RecordDataBrokerAuditEventDropped(ctx context.Context) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		dataBrokerAuditEventsDropped.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// SetDataBrokerLastWriteTimestamp records the time of the latest write of a
+// record. The record type should be bounded to avoid high cardinality.
+func SetDataBrokerLastWriteTimestamp(ctx context.Context, recordType string, t time.Time) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "databroker"),
+			tag.Upsert(TagKeyStorageRecordType, recordType),
+		},
+		dataBrokerLastWriteTimestamp.M(float64(t.UnixNano())/float64(time.Second)),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
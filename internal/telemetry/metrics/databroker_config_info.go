@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+// DataBrokerConfigInfo is the key values of the effective databroker config. Only
+// values with a bounded number of possibilities belong here, and never secrets.
+type DataBrokerConfigInfo struct {
+	StorageType       string
+	GetAllPageSize    int
+	EncryptionEnabled bool
+	ReadOnly          bool
+}
+
+var dataBrokerConfigInfo = new(dataBrokerConfigInfoProducer)
+
+// dataBrokerConfigInfoProducer produces the databroker config info gauge from the
+// last config set. Unlike a view, the series of a previous config stops being
+// exported, so there is only ever a single series.
+type dataBrokerConfigInfoProducer struct {
+	registerOnce sync.Once
+
+	mu   sync.Mutex
+	info *DataBrokerConfigInfo
+}
+
+// SetDataBrokerConfigInfo sets the databroker config info gauge to 1, labeled with
+// the given config. It replaces the series of the previously set config.
+func SetDataBrokerConfigInfo(info DataBrokerConfigInfo) {
+	dataBrokerConfigInfo.registerOnce.Do(func() {
+		metricproducer.GlobalManager().AddProducer(dataBrokerConfigInfo)
+	})
+
+	dataBrokerConfigInfo.mu.Lock()
+	dataBrokerConfigInfo.info = &info
+	dataBrokerConfigInfo.mu.Unlock()
+}
+
+// ClearDataBrokerConfigInfo stops exporting the databroker config info gauge.
+func ClearDataBrokerConfigInfo() {
+	dataBrokerConfigInfo.mu.Lock()
+	dataBrokerConfigInfo.info = nil
+	dataBrokerConfigInfo.mu.Unlock()
+}
+
+func (p *dataBrokerConfigInfoProducer) Read() []*metricdata.Metric {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.info == nil {
+		return nil
+	}
+
+	now := time.Now()
+	return []*metricdata.Metric{{
+		Descriptor: metricdata.Descriptor{
+			Name:        metrics.DataBrokerConfigInfo,
+			Description: "Effective databroker config",
+			Unit:        metricdata.UnitDimensionless,
+			Type:        metricdata.TypeGaugeInt64,
+			LabelKeys: []metricdata.LabelKey{
+				{Key: metrics.ServiceLabel},
+				{Key: metrics.StorageTypeLabel},
+				{Key: metrics.GetAllPageSizeLabel},
+				{Key: metrics.EncryptionEnabledLabel},
+				{Key: metrics.ReadOnlyLabel},
+			},
+		},
+		TimeSeries: []*metricdata.TimeSeries{{
+			LabelValues: []metricdata.LabelValue{
+				metricdata.NewLabelValue("databroker"),
+				metricdata.NewLabelValue(p.info.StorageType),
+				metricdata.NewLabelValue(strconv.Itoa(p.info.GetAllPageSize)),
+				metricdata.NewLabelValue(strconv.FormatBool(p.info.EncryptionEnabled)),
+				metricdata.NewLabelValue(strconv.FormatBool(p.info.ReadOnly)),
+			},
+			Points:    []metricdata.Point{metricdata.NewInt64Point(now, 1)},
+			StartTime: now,
+		}},
+	}}
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func Test_RecordDataBrokerSyncStreamRejected(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerSyncStreamRejected(context.Background())
+	RecordDataBrokerSyncStreamRejected(context.Background())
+
+	testDataRetrieval(DataBrokerSyncStreamsRejectedView, t, "{ { {service databroker} }&{2")
+}
+
+func Test_SetDataBrokerQueueDepth(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	SetDataBrokerQueueDepth(context.Background(), "sync_operation", 5)
+	SetDataBrokerQueueDepth(context.Background(), "sync_operation", 3)
+
+	testDataRetrieval(DataBrokerQueueDepthView, t, "{ { {queue sync_operation}{service databroker} }&{3")
+}
+
+func Test_SetDataBrokerSyncBufferedBytes(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	SetDataBrokerSyncBufferedBytes(context.Background(), 100)
+	SetDataBrokerSyncBufferedBytes(context.Background(), 40)
+
+	testDataRetrieval(DataBrokerSyncBufferedBytesView, t, "{ { {service databroker} }&{40")
+}
+
+func Test_RecordDataBrokerRecordBytes(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerRecordBytes(context.Background(), "TYPE", 100)
+	RecordDataBrokerRecordBytes(context.Background(), "TYPE", 300)
+
+	testDataRetrieval(DataBrokerRecordBytesView, t, "{ { {record_type TYPE}{service databroker} }&{2 100 300 200 20000 [0 1 1 0 0 0 0 0 0 0]")
+}
+
+func Test_RecordDataBrokerSignatureVerifyFailure(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerSignatureVerifyFailure(context.Background(), "TYPE")
+	RecordDataBrokerSignatureVerifyFailure(context.Background(), "TYPE")
+
+	testDataRetrieval(DataBrokerSignatureVerifyFailuresView, t, "{ { {record_type TYPE}{service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerSyncRecordSent(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerSyncRecordSent(context.Background(), "authorize", "authorize-1")
+	RecordDataBrokerSyncRecordSent(context.Background(), "authorize", "authorize-1")
+
+	testDataRetrieval(DataBrokerSyncRecordsSentView, t, "{ { {client_instance authorize-1}{client_service authorize}{service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerRecordWithoutExpiry(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerRecordWithoutExpiry(context.Background(), "TYPE")
+	RecordDataBrokerRecordWithoutExpiry(context.Background(), "TYPE")
+
+	testDataRetrieval(DataBrokerRecordsWithoutExpiryView, t, "{ { {record_type TYPE}{service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerKeyRotation(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerKeyRotation(context.Background())
+	RecordDataBrokerKeyRotation(context.Background())
+
+	testDataRetrieval(DataBrokerKeyRotationsView, t, "{ { {service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerWebhookEventDropped(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerWebhookEventDropped(context.Background())
+	RecordDataBrokerWebhookEventDropped(context.Background())
+
+	testDataRetrieval(DataBrokerWebhookEventsDroppedView, t, "{ { {service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerAuditEventDropped(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerAuditEventDropped(context.Background())
+	RecordDataBrokerAuditEventDropped(context.Background())
+
+	testDataRetrieval(DataBrokerAuditEventsDroppedView, t, "{ { {service databroker} }&{2")
+}
+
+func Test_RecordDataBrokerRecordAge(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerRecordAge(context.Background(), "TYPE", time.Second*30)
+	RecordDataBrokerRecordAge(context.Background(), "TYPE", time.Hour*2)
+
+	testDataRetrieval(DataBrokerRecordAgeView, t, "{ { {record_type TYPE}{service databroker} }&{2 30 7200 3615 2.570445e+07 [1 0 0 1 0 0 0 0 0]")
+}
+
+func Test_SetDataBrokerDeletePermanentlyAfter(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	SetDataBrokerDeletePermanentlyAfter(context.Background(), time.Hour)
+	SetDataBrokerDeletePermanentlyAfter(context.Background(), time.Minute*90)
+
+	testDataRetrieval(DataBrokerDeletePermanentlyAfterView, t, "{ { {service databroker} }&{5400")
+}
+
+func Test_RecordDataBrokerSyncCompressionSavedBytes(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	RecordDataBrokerSyncCompressionSavedBytes(context.Background(), "zstd", 100)
+	RecordDataBrokerSyncCompressionSavedBytes(context.Background(), "zstd", 50)
+
+	rows, err := view.RetrieveData(DataBrokerSyncCompressionSavedBytesView.Name)
+	require.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.ElementsMatch(t, []tag.Tag{
+			{Key: TagKeyService, Value: "databroker"},
+			{Key: TagKeyCompression, Value: "zstd"},
+		}, rows[0].Tags)
+		assert.Equal(t, float64(150), rows[0].Data.(*view.SumData).Value)
+	}
+}
+
+func Test_SetDataBrokerLastWriteTimestamp(t *testing.T) {
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+	SetDataBrokerLastWriteTimestamp(context.Background(), "TYPE", time.Unix(1000, 0))
+	SetDataBrokerLastWriteTimestamp(context.Background(), "TYPE", time.Unix(2000, 500000000))
+
+	testDataRetrieval(DataBrokerLastWriteTimestampView, t, "{ { {record_type TYPE}{service databroker} }&{2000.5")
+}
@@ -75,6 +75,7 @@ func RecordIdentityManagerLastRefresh() {
 // SetConfigInfo records the status, checksum and timestamp of a configuration
 // reload. You must register InfoViews or the related config views before calling
 func SetConfigInfo(service, configName string, checksum uint64, success bool) {
+	SetMetricEventTime("pomerium_"+metrics.ConfigLastReloadSuccess, time.Now())
 	if success {
 		registry.setConfigChecksum(service, configName, checksum)
 
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	// nativeHistogramBucketFactor is the maximum growth factor from one native
+	// histogram bucket boundary to the next. It's rounded down to the closest
+	// resolution, 2^(2^-3) or about 1.09.
+	nativeHistogramBucketFactor = 1.1
+	// nativeHistogramMaxBucketNumber bounds the buckets of each series. A series
+	// with more buckets has its resolution halved, rather than being reset.
+	nativeHistogramMaxBucketNumber = 160
+)
+
+var (
+	// nativeHistogramRegistry holds the native histograms. It's separate from the
+	// default registry, in which the views are exported under the same names.
+	nativeHistogramRegistry = prom.NewRegistry()
+
+	storageOperationDurationNative = newNativeHistogramVec(StorageOperationDurationView)
+	dataBrokerRecordBytesNative    = newNativeHistogramVec(DataBrokerRecordBytesView)
+)
+
+// A nativeHistogramVec mirrors an opencensus distribution view as a prometheus
+// histogram, with both the view's classic buckets and a native histogram, for
+// each series of the view.
+type nativeHistogramVec struct {
+	// keys are the tag keys of the view, in the order of the label names. They're
+	// copied, as registering the view sorts its tag keys.
+	keys []tag.Key
+	vec  *prom.HistogramVec
+}
+
+func newNativeHistogramVec(v *view.View) *nativeHistogramVec {
+	keys := append([]tag.Key(nil), v.TagKeys...)
+	labelNames := make([]string, 0, len(keys))
+	for _, key := range keys {
+		labelNames = append(labelNames, key.Name())
+	}
+	vec := prom.NewHistogramVec(prom.HistogramOpts{
+		Namespace:                      "pomerium",
+		Name:                           v.Name,
+		Help:                           v.Description,
+		Buckets:                        v.Aggregation.Buckets,
+		NativeHistogramBucketFactor:    nativeHistogramBucketFactor,
+		NativeHistogramMaxBucketNumber: nativeHistogramMaxBucketNumber,
+	}, labelNames)
+	nativeHistogramRegistry.MustRegister(vec)
+	return &nativeHistogramVec{keys: keys, vec: vec}
+}
+
+// observe adds a value to the series of the view identified by the tags of the
+// context and mutators, the same way it's recorded in the view.
+func (vec *nativeHistogramVec) observe(ctx context.Context, mutators []tag.Mutator, value float64) {
+	ctx, err := tag.New(ctx, mutators...)
+	if err != nil {
+		return
+	}
+	m := tag.FromContext(ctx)
+	labelValues := make([]string, 0, len(vec.keys))
+	for _, key := range vec.keys {
+		v, _ := m.Value(key)
+		labelValues = append(labelValues, v)
+	}
+	vec.vec.WithLabelValues(labelValues...).Observe(value)
+}
+
+// applyNativeHistograms replaces the families which are also accumulated as
+// native histograms with those. Their classic buckets, sample count and sum are
+// those of the native histogram, so that they're consistent with each other.
+func applyNativeHistograms(families map[string]*io_prometheus_client.MetricFamily) error {
+	native, err := nativeHistogramRegistry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range native {
+		if _, ok := families[family.GetName()]; ok {
+			families[family.GetName()] = family
+		}
+	}
+	return nil
+}
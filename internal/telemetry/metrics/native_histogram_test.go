@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PrometheusHandlerNativeHistograms(t *testing.T) {
+	ctx := context.Background()
+
+	scrape := func(t *testing.T, accept string, options ...PrometheusOption) *httptest.ResponseRecorder {
+		h, err := PrometheusHandler(&url.URL{}, "test_installation_id", options...)
+		require.NoError(t, err)
+		req := httptest.NewRequest("GET", "http://test.local/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	const acceptProtobuf = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3`
+
+	// the views are registered with the first handler, so create one before recording
+	scrape(t, "", WithNativeHistograms(true))
+	// series accumulate for the life of the process, so each run uses its own
+	tags := &StorageOperationTags{Operation: "get", Backend: fmt.Sprintf("native-histogram-test-%d", time.Now().UnixNano())}
+	for i := 0; i < 3; i++ {
+		RecordStorageOperation(ctx, tags, time.Millisecond*5)
+	}
+	RecordStorageOperation(ctx, tags, 0)
+
+	t.Run("protobuf", func(t *testing.T) {
+		var histogram *io_prometheus_client.Histogram
+		// views are updated asynchronously, so the series of the classic buckets
+		// may not be exposed right away
+		require.Eventually(t, func() bool {
+			rec := scrape(t, acceptProtobuf, WithNativeHistograms(true))
+			assert.Equal(t, string(expfmt.FmtProtoDelim), rec.Header().Get("Content-Type"))
+			histogram = findHistogram(t, rec.Body, "pomerium_storage_operation_duration_ms", "backend", tags.Backend)
+			return histogram != nil
+		}, time.Second*5, time.Millisecond*10, "the histogram should be exposed")
+		assert.Equal(t, uint64(4), histogram.GetSampleCount())
+		buckets := histogram.GetBucket()
+		if assert.NotEmpty(t, buckets, "classic buckets should still be exposed") {
+			assert.Equal(t, histogram.GetSampleCount(), buckets[len(buckets)-1].GetCumulativeCount(),
+				"the classic buckets should be consistent with the sample count")
+		}
+		assert.Equal(t, int32(3), histogram.GetSchema(), "native histogram should be exposed")
+		assert.Equal(t, uint64(1), histogram.GetZeroCount())
+		if assert.Len(t, histogram.GetPositiveSpan(), 1) {
+			assert.Equal(t, int32(19), histogram.GetPositiveSpan()[0].GetOffset())
+			assert.Equal(t, uint32(1), histogram.GetPositiveSpan()[0].GetLength())
+		}
+		assert.Equal(t, []int64{3}, histogram.GetPositiveDelta())
+	})
+	t.Run("text", func(t *testing.T) {
+		rec := scrape(t, "text/plain;version=0.0.4", WithNativeHistograms(true))
+		assert.NotEqual(t, string(expfmt.FmtProtoDelim), rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "pomerium_storage_operation_duration_ms_bucket")
+	})
+	t.Run("disabled", func(t *testing.T) {
+		rec := scrape(t, acceptProtobuf)
+		assert.NotEqual(t, string(expfmt.FmtProtoDelim), rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "pomerium_storage_operation_duration_ms_bucket",
+			"classic buckets should be served in the text format by default")
+	})
+}
+
+// findHistogram returns the histogram of the metric with the given label in the
+// family with the given name, decoded from the delimited protobuf format.
+func findHistogram(t *testing.T, r io.Reader, name, labelName, labelValue string) *io_prometheus_client.Histogram {
+	decoder := expfmt.NewDecoder(r, expfmt.FmtProtoDelim)
+	for {
+		var family io_prometheus_client.MetricFamily
+		err := decoder.Decode(&family)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		require.NoError(t, err)
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == labelName && label.GetValue() == labelValue {
+					return metric.GetHistogram()
+				}
+			}
+		}
+	}
+}
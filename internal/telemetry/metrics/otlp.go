@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/version"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+// otlpExportTimeout bounds a single export, so that an unreachable collector
+// doesn't hold up the next flush.
+const otlpExportTimeout = 10 * time.Second
+
+type otlpConfig struct {
+	tlsConfig *tls.Config
+	insecure  bool
+	headers   map[string]string
+}
+
+// An OTLPOption customizes the OTLP forwarder.
+type OTLPOption func(*otlpConfig)
+
+// WithOTLPTLSConfig sets the TLS configuration of the connection to the collector.
+// By default the collector is verified with the system's certificate authorities.
+func WithOTLPTLSConfig(tlsConfig *tls.Config) OTLPOption {
+	return func(cfg *otlpConfig) {
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithOTLPInsecure connects to the collector without TLS.
+func WithOTLPInsecure(insecure bool) OTLPOption {
+	return func(cfg *otlpConfig) {
+		cfg.insecure = insecure
+	}
+}
+
+// WithOTLPHeaders sets headers sent to the collector with every export, such as
+// its credentials.
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(cfg *otlpConfig) {
+		cfg.headers = headers
+	}
+}
+
+// An OTLPForwarder periodically pushes metrics to an OpenTelemetry collector with
+// the OTLP gRPC protocol. The service name is the service.name resource attribute
+// and the installation id is added as a label to every data point, as in the
+// prometheus exposition. Counters and histograms are sent as cumulative values.
+type OTLPForwarder struct {
+	gatherer       prom.Gatherer
+	conn           *grpc.ClientConn
+	client         colmetricspb.MetricsServiceClient
+	headers        metadata.MD
+	serviceName    string
+	installationID string
+	startTime      time.Time
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// NewOTLPForwarder creates a new OTLPForwarder which exports metrics to the
+// collector at addr every interval until closed. The connection is made in the
+// background, so an unreachable collector only fails the exports.
+func NewOTLPForwarder(addr string, interval time.Duration, serviceName, installationID string, options ...OTLPOption) (*OTLPForwarder, error) {
+	if _, err := getGlobalExporter(); err != nil {
+		return nil, err
+	}
+	return newOTLPForwarder(prom.DefaultGatherer, addr, interval, serviceName, installationID, options...)
+}
+
+func newOTLPForwarder(
+	gatherer prom.Gatherer,
+	addr string,
+	interval time.Duration,
+	serviceName, installationID string,
+	options ...OTLPOption,
+) (*OTLPForwarder, error) {
+	cfg := new(otlpConfig)
+	for _, option := range options {
+		option(cfg)
+	}
+
+	creds := grpc.WithInsecure()
+	if !cfg.insecure {
+		tlsConfig := cfg.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	conn, err := grpc.Dial(addr, creds)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: failed to connect to otlp collector: %w", err)
+	}
+
+	fwd := &OTLPForwarder{
+		gatherer:       gatherer,
+		conn:           conn,
+		client:         colmetricspb.NewMetricsServiceClient(conn),
+		headers:        metadata.New(cfg.headers),
+		serviceName:    serviceName,
+		installationID: installationID,
+		startTime:      time.Now(),
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go fwd.run(interval)
+	return fwd, nil
+}
+
+// Close stops the forwarder.
+func (fwd *OTLPForwarder) Close() error {
+	var err error
+	fwd.closeOnce.Do(func() {
+		close(fwd.closed)
+		<-fwd.done
+		err = fwd.conn.Close()
+	})
+	return err
+}
+
+func (fwd *OTLPForwarder) run(interval time.Duration) {
+	defer close(fwd.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fwd.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if err := fwd.flush(); err != nil {
+			log.Warn().Err(err).Msg("telemetry/metrics: failed to export metrics to otlp collector")
+		}
+	}
+}
+
+func (fwd *OTLPForwarder) flush() error {
+	families, err := fwd.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("telemetry/metrics: failed to gather metrics: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+	defer cancel()
+	ctx = metadata.NewOutgoingContext(ctx, fwd.headers)
+
+	_, err = fwd.client.Export(ctx, fwd.request(families, time.Now()))
+	if err != nil {
+		return fmt.Errorf("telemetry/metrics: failed to export metrics: %w", err)
+	}
+	return nil
+}
+
+// request returns an ExportMetricsServiceRequest with the metric families.
+func (fwd *OTLPForwarder) request(families []*io_prometheus_client.MetricFamily, now time.Time) *colmetricspb.ExportMetricsServiceRequest {
+	scopeMetrics := &metricspb.ScopeMetrics{
+		Scope: &commonpb.InstrumentationScope{
+			Name:    "pomerium",
+			Version: version.FullVersion(),
+		},
+	}
+	for _, family := range families {
+		if metric := fwd.metric(family, now); metric != nil {
+			scopeMetrics.Metrics = append(scopeMetrics.Metrics, metric)
+		}
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{otlpStringKeyValue("service.name", fwd.serviceName)},
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{scopeMetrics},
+		}},
+	}
+}
+
+// metric converts the metric family to an OTLP Metric, or returns nil if it has
+// no data points.
+func (fwd *OTLPForwarder) metric(family *io_prometheus_client.MetricFamily, now time.Time) *metricspb.Metric {
+	if len(family.GetMetric()) == 0 {
+		return nil
+	}
+
+	metric := &metricspb.Metric{
+		Name:        family.GetName(),
+		Description: family.GetHelp(),
+	}
+	switch family.GetType() {
+	case io_prometheus_client.MetricType_COUNTER:
+		sum := &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}
+		for _, m := range family.GetMetric() {
+			sum.DataPoints = append(sum.DataPoints, fwd.numberDataPoint(m.GetLabel(), m.GetCounter().GetValue(), now))
+		}
+		metric.Data = &metricspb.Metric_Sum{Sum: sum}
+	case io_prometheus_client.MetricType_GAUGE, io_prometheus_client.MetricType_UNTYPED:
+		gauge := new(metricspb.Gauge)
+		for _, m := range family.GetMetric() {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == io_prometheus_client.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, fwd.numberDataPoint(m.GetLabel(), value, now))
+		}
+		metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+	case io_prometheus_client.MetricType_HISTOGRAM:
+		histogram := &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}
+		for _, m := range family.GetMetric() {
+			histogram.DataPoints = append(histogram.DataPoints, fwd.histogramDataPoint(m.GetLabel(), m.GetHistogram(), now))
+		}
+		metric.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+	case io_prometheus_client.MetricType_SUMMARY:
+		summary := new(metricspb.Summary)
+		for _, m := range family.GetMetric() {
+			summary.DataPoints = append(summary.DataPoints, fwd.summaryDataPoint(m.GetLabel(), m.GetSummary(), now))
+		}
+		metric.Data = &metricspb.Metric_Summary{Summary: summary}
+	default:
+		return nil
+	}
+	return metric
+}
+
+func (fwd *OTLPForwarder) numberDataPoint(labels []*io_prometheus_client.LabelPair, value float64, now time.Time) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        fwd.attributes(labels),
+		StartTimeUnixNano: uint64(fwd.startTime.UnixNano()),
+		TimeUnixNano:      uint64(now.UnixNano()),
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// histogramDataPoint converts the cumulative prometheus buckets to the per-bucket
+// counts of OTLP, with the +Inf bucket as the implicit last bucket.
+func (fwd *OTLPForwarder) histogramDataPoint(labels []*io_prometheus_client.LabelPair, h *io_prometheus_client.Histogram, now time.Time) *metricspb.HistogramDataPoint {
+	sum := h.GetSampleSum()
+	dp := &metricspb.HistogramDataPoint{
+		Attributes:        fwd.attributes(labels),
+		StartTimeUnixNano: uint64(fwd.startTime.UnixNano()),
+		TimeUnixNano:      uint64(now.UnixNano()),
+		Count:             h.GetSampleCount(),
+		Sum:               &sum,
+	}
+	var previous uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		dp.BucketCounts = append(dp.BucketCounts, bucket.GetCumulativeCount()-previous)
+		dp.ExplicitBounds = append(dp.ExplicitBounds, bucket.GetUpperBound())
+		previous = bucket.GetCumulativeCount()
+	}
+	dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-previous)
+	return dp
+}
+
+func (fwd *OTLPForwarder) summaryDataPoint(labels []*io_prometheus_client.LabelPair, s *io_prometheus_client.Summary, now time.Time) *metricspb.SummaryDataPoint {
+	dp := &metricspb.SummaryDataPoint{
+		Attributes:        fwd.attributes(labels),
+		StartTimeUnixNano: uint64(fwd.startTime.UnixNano()),
+		TimeUnixNano:      uint64(now.UnixNano()),
+		Count:             s.GetSampleCount(),
+		Sum:               s.GetSampleSum(),
+	}
+	for _, q := range s.GetQuantile() {
+		dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+			Quantile: q.GetQuantile(),
+			Value:    q.GetValue(),
+		})
+	}
+	return dp
+}
+
+func (fwd *OTLPForwarder) attributes(labels []*io_prometheus_client.LabelPair) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(labels)+1)
+	for _, label := range labels {
+		attributes = append(attributes, otlpStringKeyValue(label.GetName(), label.GetValue()))
+	}
+	if fwd.installationID != "" {
+		attributes = append(attributes, otlpStringKeyValue(metrics.InstallationIDLabel, fwd.installationID))
+	}
+	return attributes
+}
+
+func otlpStringKeyValue(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+type testOTLPCollector struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	requests chan *colmetricspb.ExportMetricsServiceRequest
+	metadata chan metadata.MD
+}
+
+func (c *testOTLPCollector) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	select {
+	case c.requests <- req:
+		c.metadata <- md
+	default:
+	}
+	return new(colmetricspb.ExportMetricsServiceResponse), nil
+}
+
+// startTestOTLPCollector starts a collector which receives the first request,
+// and returns its address.
+func startTestOTLPCollector(t *testing.T, options ...grpc.ServerOption) (string, *testOTLPCollector) {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { li.Close() })
+
+	collector := &testOTLPCollector{
+		requests: make(chan *colmetricspb.ExportMetricsServiceRequest, 1),
+		metadata: make(chan metadata.MD, 1),
+	}
+	srv := grpc.NewServer(options...)
+	colmetricspb.RegisterMetricsServiceServer(srv, collector)
+	go func() { _ = srv.Serve(li) }()
+	t.Cleanup(srv.Stop)
+	return li.Addr().String(), collector
+}
+
+func TestOTLPForwarder(t *testing.T) {
+	reg := prom.NewRegistry()
+	gauge := prom.NewGaugeVec(prom.GaugeOpts{Name: "test_gauge", Help: "A test gauge"}, []string{"service"})
+	reg.MustRegister(gauge)
+	gauge.WithLabelValues("proxy").Set(42)
+	counter := prom.NewCounter(prom.CounterOpts{Name: "test_total"})
+	reg.MustRegister(counter)
+	counter.Add(3)
+	histogram := prom.NewHistogram(prom.HistogramOpts{Name: "test_seconds", Buckets: []float64{1, 2}})
+	reg.MustRegister(histogram)
+	histogram.Observe(1.5)
+	histogram.Observe(3)
+
+	receive := func(t *testing.T, collector *testOTLPCollector) (*colmetricspb.ExportMetricsServiceRequest, metadata.MD) {
+		select {
+		case req := <-collector.requests:
+			return req, <-collector.metadata
+		case <-time.After(time.Second * 5):
+			t.Fatal("expected metrics to be exported")
+			return nil, nil
+		}
+	}
+
+	t.Run("insecure", func(t *testing.T) {
+		addr, collector := startTestOTLPCollector(t)
+		fwd, err := newOTLPForwarder(reg, addr, time.Millisecond*10, "pomerium-proxy", "INSTALLATION_ID",
+			WithOTLPInsecure(true))
+		require.NoError(t, err)
+		defer fwd.Close()
+
+		req, _ := receive(t, collector)
+		require.Len(t, req.GetResourceMetrics(), 1)
+		rm := req.GetResourceMetrics()[0]
+		assert.Equal(t, []*commonpb.KeyValue{otlpStringKeyValue("service.name", "pomerium-proxy")},
+			rm.GetResource().GetAttributes())
+		require.Len(t, rm.GetScopeMetrics(), 1)
+		assert.Equal(t, "pomerium", rm.GetScopeMetrics()[0].GetScope().GetName())
+
+		ms := map[string]*metricspb.Metric{}
+		for _, m := range rm.GetScopeMetrics()[0].GetMetrics() {
+			ms[m.GetName()] = m
+		}
+
+		if assert.Contains(t, ms, "test_gauge") {
+			assert.Equal(t, "A test gauge", ms["test_gauge"].GetDescription())
+			dps := ms["test_gauge"].GetGauge().GetDataPoints()
+			if assert.Len(t, dps, 1) {
+				assert.Equal(t, 42.0, dps[0].GetAsDouble())
+				assert.Equal(t, []*commonpb.KeyValue{
+					otlpStringKeyValue("service", "proxy"),
+					otlpStringKeyValue("installation_id", "INSTALLATION_ID"),
+				}, dps[0].GetAttributes())
+			}
+		}
+		if assert.Contains(t, ms, "test_total") {
+			sum := ms["test_total"].GetSum()
+			assert.True(t, sum.GetIsMonotonic())
+			assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.GetAggregationTemporality())
+			if assert.Len(t, sum.GetDataPoints(), 1) {
+				assert.Equal(t, 3.0, sum.GetDataPoints()[0].GetAsDouble())
+			}
+		}
+		if assert.Contains(t, ms, "test_seconds") {
+			h := ms["test_seconds"].GetHistogram()
+			assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, h.GetAggregationTemporality())
+			if assert.Len(t, h.GetDataPoints(), 1) {
+				dp := h.GetDataPoints()[0]
+				assert.Equal(t, uint64(2), dp.GetCount())
+				assert.Equal(t, 4.5, dp.GetSum())
+				assert.Equal(t, []float64{1, 2}, dp.GetExplicitBounds())
+				assert.Equal(t, []uint64{0, 1, 1}, dp.GetBucketCounts(), "the +Inf bucket should be the implicit last bucket")
+				assert.NotZero(t, dp.GetStartTimeUnixNano())
+				assert.Greater(t, dp.GetTimeUnixNano(), dp.GetStartTimeUnixNano())
+			}
+		}
+	})
+	t.Run("tls", func(t *testing.T) {
+		cert, err := cryptutil.GenerateSelfSignedCertificate("collector.example.com")
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		roots := x509.NewCertPool()
+		roots.AddCert(leaf)
+
+		addr, collector := startTestOTLPCollector(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{*cert},
+		})))
+		fwd, err := newOTLPForwarder(reg, addr, time.Millisecond*10, "pomerium-proxy", "",
+			WithOTLPTLSConfig(&tls.Config{RootCAs: roots, ServerName: "collector.example.com"}),
+			WithOTLPHeaders(map[string]string{"Authorization": "Bearer TOKEN"}))
+		require.NoError(t, err)
+		defer fwd.Close()
+
+		req, md := receive(t, collector)
+		assert.NotEmpty(t, req.GetResourceMetrics())
+		assert.Equal(t, []string{"Bearer TOKEN"}, md.Get("authorization"), "headers should be sent with the export")
+	})
+}
+
+func TestOTLPForwarderUnreachable(t *testing.T) {
+	// the connection is made in the background, so an unreachable collector
+	// doesn't prevent the forwarder from being created
+	fwd, err := newOTLPForwarder(prom.NewRegistry(), "127.0.0.1:1", time.Hour, "pomerium", "")
+	require.NoError(t, err)
+	assert.Error(t, fwd.flush())
+	assert.NoError(t, fwd.Close())
+}
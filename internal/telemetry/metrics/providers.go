@@ -1,12 +1,18 @@
 package metrics
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	prom "github.com/prometheus/client_golang/prometheus"
@@ -20,9 +26,79 @@ import (
 	log "github.com/pomerium/pomerium/internal/log"
 )
 
+const (
+	// DefaultEnvoyStatsTimeout is the default timeout for fetching envoy stats.
+	DefaultEnvoyStatsTimeout = time.Second * 5
+
+	envoyStatsAvailableMetric = "pomerium_envoy_stats_available"
+)
+
+type prometheusConfig struct {
+	envoyStatsTimeout      time.Duration
+	envoyStatsCacheTTL     time.Duration
+	eventTimestampFamilies map[string]struct{}
+	nativeHistograms       bool
+}
+
+// A PrometheusOption customizes the prometheus handler.
+type PrometheusOption func(*prometheusConfig)
+
+// WithEnvoyStatsTimeout sets the maximum amount of time to wait for envoy stats
+// on each scrape.
+func WithEnvoyStatsTimeout(timeout time.Duration) PrometheusOption {
+	return func(cfg *prometheusConfig) {
+		cfg.envoyStatsTimeout = timeout
+	}
+}
+
+// WithEnvoyStatsCacheTTL sets how long envoy stats are cached for so that bursts
+// of scrapes don't hammer the envoy admin interface. 0 disables caching.
+func WithEnvoyStatsCacheTTL(ttl time.Duration) PrometheusOption {
+	return func(cfg *prometheusConfig) {
+		cfg.envoyStatsCacheTTL = ttl
+	}
+}
+
+// WithEventTimestamps enables explicit timestamps on the samples of the given
+// metric families. The timestamp is the time of the underlying event, as set by
+// SetMetricEventTime, rather than the scrape time. Families without an event time
+// are exposed without a timestamp.
+func WithEventTimestamps(families []string) PrometheusOption {
+	return func(cfg *prometheusConfig) {
+		cfg.eventTimestampFamilies = make(map[string]struct{}, len(families))
+		for _, family := range families {
+			cfg.eventTimestampFamilies[family] = struct{}{}
+		}
+	}
+}
+
+// WithNativeHistograms exposes the databroker's storage operation duration and
+// record size histograms as prometheus native histograms, in addition to their
+// classic buckets, to scrapes which negotiate the protobuf exposition format.
+// Other scrapes are served the text format with classic buckets only.
+func WithNativeHistograms(enabled bool) PrometheusOption {
+	return func(cfg *prometheusConfig) {
+		cfg.nativeHistograms = enabled
+	}
+}
+
+// eventTimes holds the time of the last event for each metric family.
+var eventTimes sync.Map
+
+// SetMetricEventTime sets the time the event underlying the given metric family
+// occurred. It is only exposed for families enabled with WithEventTimestamps.
+func SetMetricEventTime(family string, t time.Time) {
+	eventTimes.Store(family, t)
+}
+
 // PrometheusHandler creates an exporter that exports stats to Prometheus
 // and returns a handler suitable for exporting metrics.
-func PrometheusHandler(envoyURL *url.URL, installationID string) (http.Handler, error) {
+func PrometheusHandler(envoyURL *url.URL, installationID string, options ...PrometheusOption) (http.Handler, error) {
+	cfg := &prometheusConfig{envoyStatsTimeout: DefaultEnvoyStatsTimeout}
+	for _, option := range options {
+		option(cfg)
+	}
+
 	exporter, err := getGlobalExporter()
 	if err != nil {
 		return nil, err
@@ -35,10 +111,71 @@ func PrometheusHandler(envoyURL *url.URL, installationID string) (http.Handler,
 		return nil, fmt.Errorf("telemetry/metrics: invalid proxy URL: %w", err)
 	}
 
-	mux.Handle("/metrics", newProxyMetricsHandler(exporter, *envoyMetricsURL, installationID))
+	envoyStats := &envoyStatsFetcher{
+		url:     *envoyMetricsURL,
+		timeout: cfg.envoyStatsTimeout,
+		ttl:     cfg.envoyStatsCacheTTL,
+	}
+	mux.Handle("/metrics", newProxyMetricsHandler(exporter, envoyStats, installationID, cfg))
 	return mux, nil
 }
 
+// An envoyStatsFetcher fetches stats from the envoy admin interface, optionally
+// caching them for a short time.
+type envoyStatsFetcher struct {
+	url     url.URL
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	stats   []byte
+	expires time.Time
+}
+
+func (fetcher *envoyStatsFetcher) fetch(ctx context.Context) ([]byte, error) {
+	// holding the lock while fetching means concurrent scrapes share a single request
+	fetcher.mu.Lock()
+	defer fetcher.mu.Unlock()
+
+	now := time.Now()
+	if fetcher.stats != nil && now.Before(fetcher.expires) {
+		return fetcher.stats, nil
+	}
+
+	if fetcher.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fetcher.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fetcher.url.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: failed to create request for envoy: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: fail to fetch proxy metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telemetry/metrics: unexpected status code fetching proxy metrics: %d", resp.StatusCode)
+	}
+
+	stats, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: fail to read proxy metrics: %w", err)
+	}
+
+	if fetcher.ttl > 0 {
+		fetcher.stats = stats
+		// add up to 10% jitter so that multiple instances don't refresh in lockstep
+		fetcher.expires = now.Add(fetcher.ttl + time.Duration(rand.Int63n(int64(fetcher.ttl)/10+1)))
+	}
+	return stats, nil
+}
+
 var (
 	globalExporter     *ocprom.Exporter
 	globalExporterErr  error
@@ -79,56 +216,103 @@ func registerDefaultViews() error {
 
 // newProxyMetricsHandler creates a subrequest to the envoy control plane for metrics and
 // combines them with our own
-func newProxyMetricsHandler(exporter *ocprom.Exporter, envoyURL url.URL, installationID string) http.HandlerFunc {
+func newProxyMetricsHandler(
+	exporter *ocprom.Exporter,
+	envoyStats *envoyStatsFetcher,
+	installationID string,
+	cfg *prometheusConfig,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Ensure we don't get entangled with compression from ocprom
+		mw := &metricsWriter{
+			format:                 expfmt.FmtText,
+			installationID:         installationID,
+			eventTimestampFamilies: cfg.eventTimestampFamilies,
+		}
+		// native histograms can only be encoded in the protobuf format
+		if cfg.nativeHistograms && expfmt.Negotiate(r.Header) == expfmt.FmtProtoDelim {
+			mw.format = expfmt.FmtProtoDelim
+			mw.nativeHistograms = true
+			w.Header().Set("Content-Type", string(mw.format))
+		}
+		mw.encoder = expfmt.NewEncoder(w, mw.format)
+
+		// Ensure we don't get entangled with compression or content negotiation
+		// from ocprom, whose metrics are always read in the text format
 		r.Header.Del("Accept-Encoding")
+		r.Header.Del("Accept")
 
 		rec := httptest.NewRecorder()
 		exporter.ServeHTTP(rec, r)
 
-		err := writeMetricsWithInstallationID(w, rec.Body, installationID)
+		err := mw.write(rec.Body)
 		if err != nil {
 			log.Error().Err(err).Send()
 			return
 		}
 
-		req, err := http.NewRequestWithContext(r.Context(), "GET", envoyURL.String(), nil)
+		stats, err := envoyStats.fetch(r.Context())
 		if err != nil {
-			log.Error().Err(err).Msg("telemetry/metrics: failed to create request for envoy")
-			return
-		}
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			log.Error().Err(err).Msg("telemetry/metrics: fail to fetch proxy metrics")
+			// serve the app metrics and mark the envoy stats as missing rather than failing the scrape
+			log.Error().Err(err).Send()
+			_ = mw.writeEnvoyStatsAvailable(false)
 			return
 		}
-		defer resp.Body.Close()
 
-		err = writeMetricsWithInstallationID(w, resp.Body, installationID)
+		err = mw.write(bytes.NewReader(stats))
 		if err != nil {
 			log.Error().Err(err).Send()
 			return
 		}
+		_ = mw.writeEnvoyStatsAvailable(true)
+	}
+}
+
+// A metricsWriter re-encodes metrics in the text format, labeled with the
+// installation id, in the negotiated format.
+type metricsWriter struct {
+	encoder                expfmt.Encoder
+	format                 expfmt.Format
+	installationID         string
+	eventTimestampFamilies map[string]struct{}
+	nativeHistograms       bool
+}
+
+func (mw *metricsWriter) writeEnvoyStatsAvailable(available bool) error {
+	value := 0
+	if available {
+		value = 1
 	}
+	return mw.write(strings.NewReader(fmt.Sprintf(
+		"# HELP %[1]s Whether envoy stats were available for this scrape\n# TYPE %[1]s gauge\n%[1]s %[2]d\n",
+		envoyStatsAvailableMetric, value,
+	)))
 }
 
-func writeMetricsWithInstallationID(w io.Writer, r io.Reader, installationID string) error {
+func (mw *metricsWriter) write(r io.Reader) error {
 	var parser expfmt.TextParser
 	ms, err := parser.TextToMetricFamilies(r)
 	if err != nil {
 		return fmt.Errorf("telemetry/metric: failed to read prometheus metrics: %w", err)
 	}
+	if mw.nativeHistograms {
+		err = applyNativeHistograms(ms)
+		if err != nil {
+			return fmt.Errorf("telemetry/metric: failed to gather native histograms: %w", err)
+		}
+	}
 
-	for _, m := range ms {
+	for name, m := range ms {
+		timestamp := getEventTimestamp(name, mw.eventTimestampFamilies)
 		for _, mm := range m.Metric {
 			mm.Label = append(mm.Label, &io_prometheus_client.LabelPair{
 				Name:  proto.String(metrics.InstallationIDLabel),
-				Value: proto.String(installationID),
+				Value: proto.String(mw.installationID),
 			})
+			if timestamp != nil {
+				mm.TimestampMs = timestamp
+			}
 		}
-		_, err = expfmt.MetricFamilyToText(w, m)
+		err = mw.encoder.Encode(m)
 		if err != nil {
 			return fmt.Errorf("telemetry/metric: failed to write prometheus metrics: %w", err)
 		}
@@ -136,3 +320,16 @@ func writeMetricsWithInstallationID(w io.Writer, r io.Reader, installationID str
 
 	return nil
 }
+
+// getEventTimestamp returns the event timestamp in milliseconds for the given
+// metric family, or nil if event timestamps aren't enabled or set for it.
+func getEventTimestamp(family string, eventTimestampFamilies map[string]struct{}) *int64 {
+	if _, ok := eventTimestampFamilies[family]; !ok {
+		return nil
+	}
+	v, ok := eventTimes.Load(family)
+	if !ok {
+		return nil
+	}
+	return proto.Int64(v.(time.Time).UnixNano() / int64(time.Millisecond))
+}
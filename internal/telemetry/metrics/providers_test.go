@@ -6,7 +6,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func newEnvoyMetricsHandler() http.HandlerFunc {
@@ -67,3 +69,122 @@ func Test_PrometheusHandler(t *testing.T) {
 		}
 	})
 }
+
+func Test_PrometheusHandlerEnvoyStats(t *testing.T) {
+	scrape := func(t *testing.T, h http.Handler) []byte {
+		req := httptest.NewRequest("GET", "http://test.local/metrics", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("Metrics endpoint failed to respond: %d", rec.Code)
+		}
+		return rec.Body.Bytes()
+	}
+
+	t.Run("slow envoy", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-unblock:
+			case <-r.Context().Done():
+			}
+		}))
+		defer srv.Close()
+		envoyURL, _ := url.Parse(srv.URL)
+
+		h, err := PrometheusHandler(envoyURL, "test_installation_id", WithEnvoyStatsTimeout(time.Millisecond*50))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		b := scrape(t, h)
+		if elapsed := time.Since(start); elapsed > time.Second*2 {
+			t.Errorf("scrape took too long: %s", elapsed)
+		}
+		if m, _ := regexp.Match(`(?m)^go_.*`, b); !m {
+			t.Errorf("Metrics endpoint did not contain internal metrics: %s", b)
+		}
+		if m, _ := regexp.Match(`(?m)^pomerium_envoy_stats_available\{.*\} 0$`, b); !m {
+			t.Errorf("Metrics endpoint did not mark envoy stats as missing: %s", b)
+		}
+	})
+
+	t.Run("failing envoy", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "ERROR", http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+		envoyURL, _ := url.Parse(srv.URL)
+
+		b := getMetrics(t, envoyURL)
+		if m, _ := regexp.Match(`(?m)^go_.*`, b); !m {
+			t.Errorf("Metrics endpoint did not contain internal metrics: %s", b)
+		}
+		if m, _ := regexp.Match(`(?m)^pomerium_envoy_stats_available\{.*\} 0$`, b); !m {
+			t.Errorf("Metrics endpoint did not mark envoy stats as missing: %s", b)
+		}
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		var requests int32
+		handler := newEnvoyMetricsHandler()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			handler(w, r)
+		}))
+		defer srv.Close()
+		envoyURL, _ := url.Parse(srv.URL)
+
+		h, err := PrometheusHandler(envoyURL, "test_installation_id", WithEnvoyStatsCacheTTL(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			b := scrape(t, h)
+			if m, _ := regexp.Match(`(?m)^# TYPE envoy_.*`, b); !m {
+				t.Errorf("Metrics endpoint did not contain envoy metrics: %s", b)
+			}
+		}
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("expected envoy stats to be fetched once, got %d", n)
+		}
+	})
+}
+
+func Test_PrometheusHandlerEventTimestamps(t *testing.T) {
+	srv := httptest.NewServer(newEnvoyMetricsHandler())
+	defer srv.Close()
+	envoyURL, _ := url.Parse(srv.URL)
+
+	eventTime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	SetMetricEventTime("envoy_server_initialization_time_ms", eventTime)
+
+	scrape := func(t *testing.T, options ...PrometheusOption) []byte {
+		h, err := PrometheusHandler(envoyURL, "test_installation_id", options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "http://test.local/metrics", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Body.Bytes()
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		b := scrape(t, WithEventTimestamps([]string{"envoy_server_initialization_time_ms"}))
+		if m, _ := regexp.Match(`(?m)^envoy_server_initialization_time_ms_bucket\{.*\} 1 1614600000000$`, b); !m {
+			t.Errorf("Metrics endpoint did not contain the event timestamp: %s", b)
+		}
+		if m, _ := regexp.Match(`(?m)^pomerium_envoy_stats_available\{.*\} 1$`, b); !m {
+			t.Errorf("Metrics endpoint added a timestamp to other families: %s", b)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		b := scrape(t)
+		if m, _ := regexp.Match(`(?m)^envoy_server_initialization_time_ms_bucket\{.*\} 1$`, b); !m {
+			t.Errorf("Metrics endpoint should not contain timestamps: %s", b)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+// A RouteSessionCount is the number of session records associated with a route.
+type RouteSessionCount struct {
+	RouteID string
+	From    string
+	Count   int64
+}
+
+var routeSessions = new(routeSessionsProducer)
+
+// routeSessionsProducer produces the route sessions gauge from the last counts
+// set. Unlike a view, routes which are removed stop being exported.
+type routeSessionsProducer struct {
+	registerOnce sync.Once
+
+	mu     sync.Mutex
+	counts []RouteSessionCount
+}
+
+// SetDataBrokerRouteSessions sets the number of session records associated with
+// each route. Routes which aren't given are no longer exported, so the number of
+// series is bounded by the configured routes.
+func SetDataBrokerRouteSessions(counts []RouteSessionCount) {
+	routeSessions.registerOnce.Do(func() {
+		metricproducer.GlobalManager().AddProducer(routeSessions)
+	})
+
+	routeSessions.mu.Lock()
+	routeSessions.counts = append([]RouteSessionCount(nil), counts...)
+	routeSessions.mu.Unlock()
+}
+
+func (p *routeSessionsProducer) Read() []*metricdata.Metric {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.counts) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	timeSeries := make([]*metricdata.TimeSeries, 0, len(p.counts))
+	for _, count := range p.counts {
+		timeSeries = append(timeSeries, &metricdata.TimeSeries{
+			LabelValues: []metricdata.LabelValue{
+				metricdata.NewLabelValue("databroker"),
+				metricdata.NewLabelValue(count.RouteID),
+				metricdata.NewLabelValue(count.From),
+			},
+			Points:    []metricdata.Point{metricdata.NewInt64Point(now, count.Count)},
+			StartTime: now,
+		})
+	}
+	return []*metricdata.Metric{{
+		Descriptor: metricdata.Descriptor{
+			Name:        metrics.DataBrokerRouteSessions,
+			Description: "Number of session records associated with each route",
+			Unit:        metricdata.UnitDimensionless,
+			Type:        metricdata.TypeGaugeInt64,
+			LabelKeys: []metricdata.LabelKey{
+				{Key: metrics.ServiceLabel},
+				{Key: metrics.RouteLabel},
+				{Key: metrics.FromLabel},
+			},
+		},
+		TimeSeries: timeSeries,
+	}}
+}
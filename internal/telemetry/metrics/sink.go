@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// DefaultMetricSinkInterval is the default interval at which metrics are exported
+// to metric sinks.
+const DefaultMetricSinkInterval = time.Second * 10
+
+// A MetricSink receives metrics. Any opencensus metricexport.Exporter may be used
+// as a sink.
+type MetricSink interface {
+	// ExportMetrics receives the current value of every metric.
+	ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error
+}
+
+// MetricSinks fans out metrics to a set of registered sinks. Prometheus is the
+// default sink and reads the same metrics when it is scraped; all other sinks
+// receive them every interval.
+type MetricSinks struct {
+	reader *metricexport.Reader
+
+	mu    sync.RWMutex
+	sinks []MetricSink
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// NewMetricSinks creates a new MetricSinks which exports metrics to the registered
+// sinks every interval until closed.
+func NewMetricSinks(interval time.Duration) *MetricSinks {
+	s := &MetricSinks{
+		reader: metricexport.NewReader(),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// Register registers a sink. The default views are registered if they haven't
+// been already.
+func (s *MetricSinks) Register(sink MetricSink) error {
+	if _, err := getGlobalExporter(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.sinks = append(s.sinks, sink)
+	s.mu.Unlock()
+	return nil
+}
+
+// Unregister unregisters a sink.
+func (s *MetricSinks) Unregister(sink MetricSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.sinks {
+		if existing == sink {
+			s.sinks = append(s.sinks[:i:i], s.sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flush exports the current metrics to the registered sinks immediately.
+func (s *MetricSinks) Flush(ctx context.Context) error {
+	s.mu.RLock()
+	sinks := s.sinks
+	s.mu.RUnlock()
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	fanout := &metricSinkFanout{sinks: sinks}
+	s.reader.ReadAndExport(fanout)
+	return fanout.err.ErrorOrNil()
+}
+
+// Close stops exporting metrics to the sinks.
+func (s *MetricSinks) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		<-s.done
+	})
+	return nil
+}
+
+func (s *MetricSinks) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Flush(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("telemetry/metrics: failed to export metrics to sinks")
+		}
+	}
+}
+
+// metricSinkFanout exports metrics to every sink. A sink which fails doesn't
+// prevent the others from receiving the metrics.
+type metricSinkFanout struct {
+	sinks []MetricSink
+	err   *multierror.Error
+}
+
+func (fanout *metricSinkFanout) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	for _, sink := range fanout.sinks {
+		if err := sink.ExportMetrics(ctx, metrics); err != nil {
+			fanout.err = multierror.Append(fanout.err, err)
+		}
+	}
+	return nil
+}
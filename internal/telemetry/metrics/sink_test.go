@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/stats/view"
+)
+
+type fakeMetricSink struct {
+	mu      sync.Mutex
+	metrics []*metricdata.Metric
+}
+
+func (sink *fakeMetricSink) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	sink.mu.Lock()
+	sink.metrics = append(sink.metrics, metrics...)
+	sink.mu.Unlock()
+	return nil
+}
+
+func (sink *fakeMetricSink) reset() {
+	sink.mu.Lock()
+	sink.metrics = nil
+	sink.mu.Unlock()
+}
+
+func (sink *fakeMetricSink) queueDepth(queue string) (float64, bool) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	for _, m := range sink.metrics {
+		if m.Descriptor.Name != dataBrokerQueueDepth.Name() {
+			continue
+		}
+		for _, ts := range m.TimeSeries {
+			for i, key := range m.Descriptor.LabelKeys {
+				if key.Key == TagKeyQueue.Name() && ts.LabelValues[i].Value == queue {
+					return float64(ts.Points[len(ts.Points)-1].Value.(int64)), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func prometheusQueueDepth(queue string) (float64, bool) {
+	// metrics registered by other tests may fail to be gathered, but the
+	// families that could be gathered are still returned
+	families, _ := prom.DefaultGatherer.Gather()
+	for _, family := range families {
+		if family.GetName() != "pomerium_"+dataBrokerQueueDepth.Name() {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == TagKeyQueue.Name() && label.GetValue() == queue {
+					return m.GetGauge().GetValue(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestMetricSinks(t *testing.T) {
+	ctx := context.Background()
+	view.Unregister(DataBrokerViews...)
+	view.Register(DataBrokerViews...)
+
+	sinks := NewMetricSinks(time.Hour)
+	defer func() { _ = sinks.Close() }()
+
+	sink1, sink2 := new(fakeMetricSink), new(fakeMetricSink)
+	require.NoError(t, sinks.Register(sink1))
+	require.NoError(t, sinks.Register(sink2))
+
+	SetDataBrokerQueueDepth(ctx, "sink_test", 7)
+	// measurements are recorded asynchronously
+	var expect float64
+	require.Eventually(t, func() bool {
+		var ok bool
+		expect, ok = prometheusQueueDepth("sink_test")
+		return ok
+	}, time.Second*5, time.Millisecond*10, "prometheus should have the observation")
+
+	require.NoError(t, sinks.Flush(ctx))
+	for _, sink := range []*fakeMetricSink{sink1, sink2} {
+		value, ok := sink.queueDepth("sink_test")
+		require.True(t, ok, "sink should have the observation")
+		assert.Equal(t, expect, value, "sink should receive the same observation as prometheus")
+	}
+
+	t.Run("unregister", func(t *testing.T) {
+		sinks.Unregister(sink2)
+		sink1.reset()
+		sink2.reset()
+		require.NoError(t, sinks.Flush(ctx))
+
+		_, ok := sink1.queueDepth("sink_test")
+		assert.True(t, ok)
+		_, ok = sink2.queueDepth("sink_test")
+		assert.False(t, ok, "unregistered sinks should not receive metrics")
+	})
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+// statsdMaxPacketSize is the maximum size of a single UDP packet sent to StatsD.
+const statsdMaxPacketSize = 1432
+
+// A StatsDForwarder periodically forwards metrics to a StatsD server using the
+// DogStatsD format, with prometheus labels mapped to tags.
+type StatsDForwarder struct {
+	gatherer       prom.Gatherer
+	conn           net.Conn
+	installationID string
+
+	// counters are forwarded as deltas since the last flush
+	counters map[string]float64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// NewStatsDForwarder creates a new StatsDForwarder which sends metrics to addr
+// every interval until closed.
+func NewStatsDForwarder(addr string, interval time.Duration, installationID string) (*StatsDForwarder, error) {
+	if _, err := getGlobalExporter(); err != nil {
+		return nil, err
+	}
+	return newStatsDForwarder(prom.DefaultGatherer, addr, interval, installationID)
+}
+
+func newStatsDForwarder(gatherer prom.Gatherer, addr string, interval time.Duration, installationID string) (*StatsDForwarder, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: failed to connect to statsd: %w", err)
+	}
+
+	fwd := &StatsDForwarder{
+		gatherer:       gatherer,
+		conn:           conn,
+		installationID: installationID,
+		counters:       make(map[string]float64),
+		closed:         make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go fwd.run(interval)
+	return fwd, nil
+}
+
+// Close stops the forwarder.
+func (fwd *StatsDForwarder) Close() error {
+	var err error
+	fwd.closeOnce.Do(func() {
+		close(fwd.closed)
+		<-fwd.done
+		err = fwd.conn.Close()
+	})
+	return err
+}
+
+func (fwd *StatsDForwarder) run(interval time.Duration) {
+	defer close(fwd.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fwd.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if err := fwd.flush(); err != nil {
+			log.Warn().Err(err).Msg("telemetry/metrics: failed to forward metrics to statsd")
+		}
+	}
+}
+
+func (fwd *StatsDForwarder) flush() error {
+	families, err := fwd.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("telemetry/metrics: failed to gather metrics: %w", err)
+	}
+
+	var buf bytes.Buffer
+	for _, line := range fwd.lines(families) {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > statsdMaxPacketSize {
+			if _, err := fwd.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := fwd.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fwd *StatsDForwarder) lines(families []*io_prometheus_client.MetricFamily) []string {
+	var lines []string
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			tags := fwd.tags(m.GetLabel())
+			switch family.GetType() {
+			case io_prometheus_client.MetricType_COUNTER:
+				key := name + "|" + tags
+				value := m.GetCounter().GetValue()
+				delta := value - fwd.counters[key]
+				if delta < 0 {
+					// the counter was reset
+					delta = value
+				}
+				fwd.counters[key] = value
+				lines = append(lines, statsdLine(name, delta, "c", tags))
+			case io_prometheus_client.MetricType_GAUGE:
+				lines = append(lines, statsdLine(name, m.GetGauge().GetValue(), "g", tags))
+			case io_prometheus_client.MetricType_UNTYPED:
+				lines = append(lines, statsdLine(name, m.GetUntyped().GetValue(), "g", tags))
+			case io_prometheus_client.MetricType_HISTOGRAM:
+				lines = append(lines,
+					statsdLine(name+"_count", float64(m.GetHistogram().GetSampleCount()), "g", tags),
+					statsdLine(name+"_sum", m.GetHistogram().GetSampleSum(), "g", tags))
+			case io_prometheus_client.MetricType_SUMMARY:
+				lines = append(lines,
+					statsdLine(name+"_count", float64(m.GetSummary().GetSampleCount()), "g", tags),
+					statsdLine(name+"_sum", m.GetSummary().GetSampleSum(), "g", tags))
+			}
+		}
+	}
+	return lines
+}
+
+func (fwd *StatsDForwarder) tags(labels []*io_prometheus_client.LabelPair) string {
+	tags := make([]string, 0, len(labels)+1)
+	for _, label := range labels {
+		tags = append(tags, statsdSanitize(label.GetName())+":"+statsdSanitize(label.GetValue()))
+	}
+	if fwd.installationID != "" {
+		tags = append(tags, metrics.InstallationIDLabel+":"+statsdSanitize(fwd.installationID))
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+func statsdLine(name string, value float64, typ, tags string) string {
+	line := statsdSanitize(name) + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + typ
+	if tags != "" {
+		line += "|#" + tags
+	}
+	return line
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "\n", "_")
+
+func statsdSanitize(s string) string {
+	return statsdReplacer.Replace(s)
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsDForwarder(t *testing.T) {
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer receiver.Close()
+
+	reg := prom.NewRegistry()
+	gauge := prom.NewGaugeVec(prom.GaugeOpts{Name: "test_gauge"}, []string{"service"})
+	reg.MustRegister(gauge)
+	gauge.WithLabelValues("proxy").Set(42)
+	counter := prom.NewCounter(prom.CounterOpts{Name: "test_total"})
+	reg.MustRegister(counter)
+	counter.Add(3)
+
+	fwd, err := newStatsDForwarder(reg, receiver.LocalAddr().String(), time.Millisecond*10, "INSTALLATION_ID")
+	require.NoError(t, err)
+
+	require.NoError(t, receiver.SetReadDeadline(time.Now().Add(time.Second*5)))
+	buf := make([]byte, statsdMaxPacketSize)
+	n, _, err := receiver.ReadFrom(buf)
+	require.NoError(t, err)
+	lines := strings.Split(string(buf[:n]), "\n")
+	assert.Contains(t, lines, "test_gauge:42|g|#installation_id:INSTALLATION_ID,service:proxy")
+	assert.Contains(t, lines, "test_total:3|c|#installation_id:INSTALLATION_ID")
+
+	// counters should be forwarded as deltas
+	n, _, err = receiver.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Contains(t, strings.Split(string(buf[:n]), "\n"), "test_total:0|c|#installation_id:INSTALLATION_ID")
+
+	assert.NoError(t, fwd.Close())
+}
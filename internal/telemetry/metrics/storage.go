@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"go.opencensus.io/stats"
@@ -13,7 +14,11 @@ import (
 
 var (
 	// StorageViews contains opencensus views for storage system metrics
-	StorageViews = []*view.View{StorageOperationDurationView}
+	StorageViews = []*view.View{
+		StorageOperationDurationView, StorageCorruptedRecordsView, StorageConnectionsRecycledView,
+		StorageOperationsInFlightView, StorageOperationsQueuedView, StorageRetentionReclaimedView,
+		StorageOperationErrorsView, StorageGetAllPageDurationView,
+	}
 
 	storageOperationDuration = stats.Int64(
 		"storage_operation_duration_ms",
@@ -21,21 +26,146 @@ var (
 		"ms")
 
 	// StorageOperationDurationView is an OpenCensus view that tracks storage client
-	// latency by operation, result and backend
+	// latency by operation, result, backend and, if enabled, record type
 	StorageOperationDurationView = &view.View{
 		Name:        storageOperationDuration.Name(),
 		Description: storageOperationDuration.Description(),
 		Measure:     storageOperationDuration,
-		TagKeys:     []tag.Key{TagKeyStorageOperation, TagKeyStorageResult, TagKeyStorageBackend, TagKeyService},
+		TagKeys: []tag.Key{
+			TagKeyStorageOperation, TagKeyStorageResult, TagKeyStorageBackend,
+			TagKeyStorageRecordType, TagKeyService,
+		},
+		Aggregation: DefaultMillisecondsDistribution,
+	}
+
+	storageOperationErrors = stats.Int64(
+		"storage_operation_errors_total",
+		"Total storage operations which failed",
+		"1")
+
+	// StorageOperationErrorsView is an OpenCensus view that counts the storage
+	// operations which failed by operation, backend and class of error
+	StorageOperationErrorsView = &view.View{
+		Name:        storageOperationErrors.Name(),
+		Description: storageOperationErrors.Description(),
+		Measure:     storageOperationErrors,
+		TagKeys: []tag.Key{
+			TagKeyStorageOperation, TagKeyStorageBackend, TagKeyStorageErrorClass, TagKeyService,
+		},
+		Aggregation: view.Count(),
+	}
+
+	storageGetAllPageDuration = stats.Int64(
+		"storage_getall_page_duration_ms",
+		"Duration in ms to read a page of records from storage",
+		"ms")
+
+	// StorageGetAllPageDurationView is an OpenCensus view that tracks the latency
+	// of reading each page of records when all the records are read, by backend
+	// and page size
+	StorageGetAllPageDurationView = &view.View{
+		Name:        storageGetAllPageDuration.Name(),
+		Description: storageGetAllPageDuration.Description(),
+		Measure:     storageGetAllPageDuration,
+		TagKeys:     []tag.Key{TagKeyStorageBackend, TagKeyStoragePageSize, TagKeyService},
 		Aggregation: DefaultMillisecondsDistribution,
 	}
+
+	storageCorruptedRecords = stats.Int64(
+		"storage_corrupted_records_total",
+		"Total storage records which failed checksum verification",
+		"1")
+
+	// StorageCorruptedRecordsView is an OpenCensus view that counts the records
+	// read from storage whose checksum did not match their data
+	StorageCorruptedRecordsView = &view.View{
+		Name:        storageCorruptedRecords.Name(),
+		Description: storageCorruptedRecords.Description(),
+		Measure:     storageCorruptedRecords,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	storageConnectionsRecycled = stats.Int64(
+		"storage_connections_recycled_total",
+		"Total storage connections recycled after repeated timeouts",
+		"1")
+
+	// StorageConnectionsRecycledView is an OpenCensus view that counts the storage
+	// connections closed and re-opened by the watchdog, by backend
+	StorageConnectionsRecycledView = &view.View{
+		Name:        storageConnectionsRecycled.Name(),
+		Description: storageConnectionsRecycled.Description(),
+		Measure:     storageConnectionsRecycled,
+		TagKeys:     []tag.Key{TagKeyStorageBackend, TagKeyService},
+		Aggregation: view.Count(),
+	}
+
+	storageOperationsInFlight = stats.Int64(
+		"storage_operations_in_flight",
+		"Number of storage operations in flight",
+		"1")
+
+	// StorageOperationsInFlightView is an OpenCensus view that tracks the number
+	// of storage operations in flight, if their concurrency is limited
+	StorageOperationsInFlightView = &view.View{
+		Name:        storageOperationsInFlight.Name(),
+		Description: storageOperationsInFlight.Description(),
+		Measure:     storageOperationsInFlight,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.LastValue(),
+	}
+
+	storageOperationsQueued = stats.Int64(
+		"storage_operations_queued",
+		"Number of storage operations waiting for the concurrency limit",
+		"1")
+
+	// StorageOperationsQueuedView is an OpenCensus view that tracks the number of
+	// storage operations waiting for a slot under the concurrency limit
+	StorageOperationsQueuedView = &view.View{
+		Name:        storageOperationsQueued.Name(),
+		Description: storageOperationsQueued.Description(),
+		Measure:     storageOperationsQueued,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: view.LastValue(),
+	}
+
+	storageRetentionReclaimed = stats.Int64(
+		"storage_retention_reclaimed_total",
+		"Total records and record versions reclaimed by retention policies",
+		"1")
+
+	// StorageRetentionReclaimedView is an OpenCensus view that counts the records
+	// deleted and the record versions pruned by retention policies, by record type
+	// and policy
+	StorageRetentionReclaimedView = &view.View{
+		Name:        storageRetentionReclaimed.Name(),
+		Description: storageRetentionReclaimed.Description(),
+		Measure:     storageRetentionReclaimed,
+		TagKeys:     []tag.Key{TagKeyStorageRecordType, TagKeyStoragePolicy, TagKeyService},
+		Aggregation: view.Sum(),
+	}
 )
 
+// StorageRecordTypeOther is the record_type tag value used for record types
+// outside the known set.
+const StorageRecordTypeOther = "other"
+
+// StorageErrorClassOther is the error_class tag value used for errors which
+// weren't classified.
+const StorageErrorClassOther = "other"
+
 // StorageOperationTags contains tags to apply when recording a storage operation
 type StorageOperationTags struct {
 	Operation string
 	Error     error
-	Backend   string
+	// ErrorClass is the class of the error, such as "not_found" or "timeout". If
+	// empty, errors are counted as "other".
+	ErrorClass string
+	Backend    string
+	// RecordType is optional. If empty the record_type tag is omitted.
+	RecordType string
 }
 
 // RecordStorageOperation records the duration of a storage operation with the corresponding tags
@@ -45,16 +175,113 @@ func RecordStorageOperation(ctx context.Context, tags *StorageOperationTags, dur
 		result = "error"
 	}
 
+	mutators := []tag.Mutator{
+		tag.Upsert(TagKeyStorageOperation, tags.Operation),
+		tag.Upsert(TagKeyStorageResult, result),
+		tag.Upsert(TagKeyStorageBackend, tags.Backend),
+		// TODO service tag does not consistently come in from RPCs.  Requires
+		// follow up
+		tag.Upsert(TagKeyService, "databroker"),
+	}
+	if tags.RecordType != "" {
+		mutators = append(mutators, tag.Upsert(TagKeyStorageRecordType, tags.RecordType))
+	}
+
 	err := stats.RecordWithTags(ctx,
+		mutators,
+		storageOperationDuration.M(duration.Milliseconds()),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+	storageOperationDurationNative.observe(ctx, mutators, float64(duration.Milliseconds()))
+
+	if tags.Error == nil {
+		return
+	}
+	errorClass := tags.ErrorClass
+	if errorClass == "" {
+		errorClass = StorageErrorClassOther
+	}
+	err = stats.RecordWithTags(ctx,
 		[]tag.Mutator{
 			tag.Upsert(TagKeyStorageOperation, tags.Operation),
-			tag.Upsert(TagKeyStorageResult, result),
 			tag.Upsert(TagKeyStorageBackend, tags.Backend),
-			// TODO service tag does not consistently come in from RPCs.  Requires
-			// follow up
+			tag.Upsert(TagKeyStorageErrorClass, errorClass),
 			tag.Upsert(TagKeyService, "databroker"),
 		},
-		storageOperationDuration.M(duration.Milliseconds()),
+		storageOperationErrors.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordStorageGetAllPage records the duration of reading a page of records of
+// the given page size, when all the records are read from storage
+func RecordStorageGetAllPage(ctx context.Context, backend string, pageSize int, duration time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyStorageBackend, backend),
+			tag.Upsert(TagKeyStoragePageSize, strconv.Itoa(pageSize)),
+			tag.Upsert(TagKeyService, "databroker"),
+		},
+		storageGetAllPageDuration.M(duration.Milliseconds()),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordStorageCorruption records that a corrupted record was read from storage
+func RecordStorageCorruption(ctx context.Context) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		storageCorruptedRecords.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordStorageConnectionRecycled records that a storage connection was recycled
+// after repeated timeouts
+func RecordStorageConnectionRecycled(ctx context.Context, backend string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyStorageBackend, backend),
+			tag.Upsert(TagKeyService, "databroker"),
+		},
+		storageConnectionsRecycled.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// SetStorageConcurrentOperations records the number of storage operations in
+// flight and queued under the concurrency limit
+func SetStorageConcurrentOperations(ctx context.Context, inFlight, queued int64) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyService, "databroker")},
+		storageOperationsInFlight.M(inFlight),
+		storageOperationsQueued.M(queued),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordStorageRetentionReclaimed records the number of records or record
+// versions of a type reclaimed by a retention policy
+func RecordStorageRetentionReclaimed(ctx context.Context, recordType, policy string, reclaimed int) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyStorageRecordType, recordType),
+			tag.Upsert(TagKeyStoragePolicy, policy),
+			tag.Upsert(TagKeyService, "databroker"),
+		},
+		storageRetentionReclaimed.M(int64(reclaimed)),
 	)
 	if err != nil {
 		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
@@ -17,6 +17,7 @@ func Test_RecordStorageOperation(t *testing.T) {
 		want     string
 	}{
 		{"success", &StorageOperationTags{Operation: "test", Backend: "testengine"}, time.Millisecond * 5, "{ { {backend testengine}{operation test}{result success}{service databroker} }&{1 5 5 5 0"},
+		{"record type", &StorageOperationTags{Operation: "test", Backend: "testengine", RecordType: "TYPE"}, time.Millisecond * 5, "{ { {backend testengine}{operation test}{record_type TYPE}{result success}{service databroker} }&{1 5 5 5 0"},
 		{"error", &StorageOperationTags{Operation: "failtest", Backend: "failengine", Error: errors.New("failure")}, time.Millisecond * 5, "{ { {backend failengine}{operation failtest}{result error}{service databroker} }&{1 5 5 5 0"},
 	}
 
@@ -30,3 +31,69 @@ func Test_RecordStorageOperation(t *testing.T) {
 		})
 	}
 }
+
+func Test_RecordStorageOperationErrors(t *testing.T) {
+	getErrorCounts := func(t *testing.T) map[string]int64 {
+		rows, err := view.RetrieveData(StorageOperationErrorsView.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int64)
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == TagKeyStorageErrorClass {
+					counts[tag.Value] += row.Data.(*view.CountData).Value
+				}
+			}
+		}
+		return counts
+	}
+
+	view.Unregister(StorageViews...)
+	view.Register(StorageViews...)
+
+	RecordStorageOperation(context.Background(), &StorageOperationTags{Operation: "get", Backend: "testengine"}, time.Millisecond)
+	for i := 0; i < 2; i++ {
+		RecordStorageOperation(context.Background(), &StorageOperationTags{
+			Operation: "get", Backend: "testengine", Error: errors.New("failure"), ErrorClass: "not_found",
+		}, time.Millisecond)
+	}
+	RecordStorageOperation(context.Background(), &StorageOperationTags{
+		Operation: "put", Backend: "testengine", Error: errors.New("failure"),
+	}, time.Millisecond)
+
+	got := getErrorCounts(t)
+	want := map[string]int64{"not_found": 2, StorageErrorClassOther: 1}
+	if len(got) != len(want) || got["not_found"] != 2 || got[StorageErrorClassOther] != 1 {
+		t.Errorf("unexpected error counts: want %v, got %v", want, got)
+	}
+}
+
+func Test_RecordStorageGetAllPage(t *testing.T) {
+	view.Unregister(StorageViews...)
+	view.Register(StorageViews...)
+
+	RecordStorageGetAllPage(context.Background(), "memory", 100, time.Millisecond*5)
+
+	testDataRetrieval(StorageGetAllPageDurationView, t, "{ { {backend memory}{page_size 100}{service databroker} }&{1 5 5 5 0")
+}
+
+func Test_RecordStorageConnectionRecycled(t *testing.T) {
+	view.Unregister(StorageViews...)
+	view.Register(StorageViews...)
+	RecordStorageConnectionRecycled(context.Background(), "redis")
+	RecordStorageConnectionRecycled(context.Background(), "redis")
+
+	testDataRetrieval(StorageConnectionsRecycledView, t, "{ { {backend redis}{service databroker} }&{2")
+}
+
+func Test_SetStorageConcurrentOperations(t *testing.T) {
+	view.Unregister(StorageViews...)
+	view.Register(StorageViews...)
+
+	SetStorageConcurrentOperations(context.Background(), 3, 1)
+	SetStorageConcurrentOperations(context.Background(), 4, 2)
+
+	testDataRetrieval(StorageOperationsInFlightView, t, "{ { {service databroker} }&{4")
+	testDataRetrieval(StorageOperationsQueuedView, t, "{ { {service databroker} }&{2")
+}
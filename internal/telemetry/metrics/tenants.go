@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TenantMetricsPathPrefix is the path prefix under which each tenant's metrics
+// are served, as /metrics/{tenant}.
+const TenantMetricsPathPrefix = "/metrics/"
+
+// TenantRegistries holds a separate prometheus registry for each tenant, so that
+// metrics can be partitioned per tenant without adding a tenant label.
+type TenantRegistries struct {
+	mu         sync.RWMutex
+	registries map[string]*prom.Registry
+}
+
+// NewTenantRegistries creates a new TenantRegistries.
+func NewTenantRegistries() *TenantRegistries {
+	return &TenantRegistries{
+		registries: make(map[string]*prom.Registry),
+	}
+}
+
+// SetTenants sets the known tenants. Registries are created for new tenants and
+// removed for tenants which are no longer known. Existing registries are kept.
+func (t *TenantRegistries) SetTenants(tenants []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	registries := make(map[string]*prom.Registry, len(tenants))
+	for _, tenant := range tenants {
+		if reg, ok := t.registries[tenant]; ok {
+			registries[tenant] = reg
+		} else {
+			registries[tenant] = prom.NewRegistry()
+		}
+	}
+	t.registries = registries
+}
+
+// Registry returns the registry for the given tenant. It returns false if the
+// tenant is unknown.
+func (t *TenantRegistries) Registry(tenant string) (prom.Registerer, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	reg, ok := t.registries[tenant]
+	if !ok {
+		return nil, false
+	}
+	return reg, true
+}
+
+// ServeHTTP serves the metrics of the tenant named by the path segment following
+// TenantMetricsPathPrefix. Unknown tenants are not found.
+func (t *TenantRegistries) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := strings.TrimPrefix(r.URL.Path, TenantMetricsPathPrefix)
+	if tenant == r.URL.Path || tenant == "" || strings.Contains(tenant, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	t.mu.RLock()
+	reg, ok := t.registries[tenant]
+	t.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
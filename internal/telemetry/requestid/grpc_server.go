@@ -41,6 +41,16 @@ func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	}
 }
 
+// FromIncomingContext gets the request id from the context, if it was populated by
+// one of the server interceptors, or otherwise from the incoming metadata. A new
+// request id is returned if the request doesn't have one.
+func FromIncomingContext(ctx context.Context) string {
+	if requestID := FromContext(ctx); requestID != "" {
+		return requestID
+	}
+	return fromMetadata(ctx)
+}
+
 func fromMetadata(ctx context.Context) string {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
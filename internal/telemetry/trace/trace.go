@@ -22,6 +22,10 @@ const (
 	JaegerTracingProviderName = "jaeger"
 	// ZipkinTracingProviderName is the name of the tracing provider Zipkin.
 	ZipkinTracingProviderName = "zipkin"
+
+	// InstallationIDAttribute is the span attribute which identifies the
+	// installation of pomerium which emitted the span.
+	InstallationIDAttribute = "pomerium.installation_id"
 )
 
 // TracingOptions contains the configurations settings for a http server.
@@ -30,6 +34,9 @@ type TracingOptions struct {
 	Provider string
 	Service  string
 	Debug    bool
+	// InstallationID, if set, is added to every exported span so that traces
+	// can be grouped by installation.
+	InstallationID string
 
 	// Datadog
 	DatadogAddress string
@@ -75,6 +82,10 @@ func RegisterTracing(opts *TracingOptions) (trace.Exporter, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts.InstallationID != "" {
+		exporter = newInstallationIDExporter(opts.InstallationID, exporter)
+	}
+	trace.RegisterExporter(exporter)
 	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(opts.SampleRate)})
 
 	log.Debug().Interface("Opts", opts).Msg("telemetry/trace: exporter created")
@@ -95,7 +106,6 @@ func registerDatadog(opts *TracingOptions) (trace.Exporter, error) {
 	if err != nil {
 		return nil, err
 	}
-	trace.RegisterExporter(dex)
 	return dex, nil
 }
 
@@ -111,7 +121,6 @@ func registerJaeger(opts *TracingOptions) (trace.Exporter, error) {
 	if err != nil {
 		return nil, err
 	}
-	trace.RegisterExporter(jex)
 	return jex, nil
 }
 
@@ -123,10 +132,33 @@ func registerZipkin(opts *TracingOptions) (trace.Exporter, error) {
 
 	reporter := zipkinHTTP.NewReporter(opts.ZipkinEndpoint.String())
 
-	exporter := ocZipkin.NewExporter(reporter, localEndpoint)
-	trace.RegisterExporter(exporter)
+	return ocZipkin.NewExporter(reporter, localEndpoint), nil
+}
 
-	return exporter, nil
+// An installationIDExporter adds the installation id attribute to spans before
+// exporting them. OpenCensus has no notion of a tracer resource, so the attribute
+// is added to each span instead.
+type installationIDExporter struct {
+	installationID string
+	underlying     trace.Exporter
+}
+
+func newInstallationIDExporter(installationID string, underlying trace.Exporter) trace.Exporter {
+	return &installationIDExporter{
+		installationID: installationID,
+		underlying:     underlying,
+	}
+}
+
+func (e *installationIDExporter) ExportSpan(sd *trace.SpanData) {
+	// the span data may be shared with other exporters, so copy it
+	cp := *sd
+	cp.Attributes = make(map[string]interface{}, len(sd.Attributes)+1)
+	for k, v := range sd.Attributes {
+		cp.Attributes[k] = v
+	}
+	cp.Attributes[InstallationIDAttribute] = e.installationID
+	e.underlying.ExportSpan(&cp)
 }
 
 // StartSpan starts a new child span of the current span in the context. If
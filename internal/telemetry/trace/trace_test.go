@@ -1,8 +1,12 @@
 package trace
 
 import (
+	"context"
 	"net/url"
+	"sync"
 	"testing"
+
+	"go.opencensus.io/trace"
 )
 
 func TestRegisterTracing(t *testing.T) {
@@ -25,3 +29,38 @@ func TestRegisterTracing(t *testing.T) {
 		})
 	}
 }
+
+type testExporter struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (e *testExporter) ExportSpan(sd *trace.SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, sd)
+	e.mu.Unlock()
+}
+
+func TestInstallationIDExporter(t *testing.T) {
+	underlying := new(testExporter)
+	exporter := newInstallationIDExporter("INSTALLATION-1", underlying)
+	trace.RegisterExporter(exporter)
+	defer trace.UnregisterExporter(exporter)
+
+	_, span := StartSpan(context.Background(), "databroker.grpc.Put", trace.WithSampler(trace.AlwaysSample()))
+	span.AddAttributes(trace.StringAttribute("type", "TYPE"))
+	span.End()
+
+	underlying.mu.Lock()
+	defer underlying.mu.Unlock()
+	if len(underlying.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(underlying.spans))
+	}
+	attrs := underlying.spans[0].Attributes
+	if got := attrs[InstallationIDAttribute]; got != "INSTALLATION-1" {
+		t.Errorf("expected installation id attribute, got %v", got)
+	}
+	if got := attrs["type"]; got != "TYPE" {
+		t.Errorf("expected existing attributes to be kept, got %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ory/dockertest/v3"
+)
+
+const firestoreEmulatorHostEnv = "FIRESTORE_EMULATOR_HOST"
+
+// WithTestFirestore creates a test Firestore emulator instance using docker. The
+// FIRESTORE_EMULATOR_HOST environment variable is set while the handler runs, and
+// the handler is given a connection string for a test project.
+func WithTestFirestore(handler func(rawURL string) error) error {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), maxWait)
+	defer clearTimeout()
+
+	// uses a sensible default on windows (tcp/http) and linux/osx (socket)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return err
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository:   "gcr.io/google.com/cloudsdktool/google-cloud-cli",
+		Tag:          "emulators",
+		Cmd:          []string{"gcloud", "emulators", "firestore", "start", "--host-port=0.0.0.0:8080"},
+		ExposedPorts: []string{"8080/tcp"},
+	})
+	if err != nil {
+		return err
+	}
+	_ = resource.Expire(uint(maxWait.Seconds()))
+
+	host := resource.GetHostPort("8080/tcp")
+	if err := pool.Retry(func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		}
+		return nil
+	}); err != nil {
+		_ = pool.Purge(resource)
+		return err
+	}
+
+	previous, hadPrevious := os.LookupEnv(firestoreEmulatorHostEnv)
+	_ = os.Setenv(firestoreEmulatorHostEnv, host)
+	e := handler("firestore://test-project")
+	if hadPrevious {
+		_ = os.Setenv(firestoreEmulatorHostEnv, previous)
+	} else {
+		_ = os.Unsetenv(firestoreEmulatorHostEnv)
+	}
+
+	if err := pool.Purge(resource); err != nil {
+		return err
+	}
+
+	return e
+}
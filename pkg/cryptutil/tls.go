@@ -6,12 +6,57 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/caddyserver/certmagic"
 
 	"github.com/pomerium/pomerium/internal/log"
 )
 
+// tlsVersions maps the supported names of minimum TLS versions to their ids.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCipherSuites maps the OpenSSL names of the supported TLS 1.2 cipher suites,
+// as used by envoy, to their ids.
+var tlsCipherSuites = map[string]uint16{
+	"ECDHE-ECDSA-AES256-GCM-SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-RSA-AES256-GCM-SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"ECDHE-ECDSA-AES128-GCM-SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-RSA-AES128-GCM-SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"ECDHE-ECDSA-CHACHA20-POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"ECDHE-RSA-CHACHA20-POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+// GetTLSVersion returns the id of a TLS version given as "1.2" or "1.3".
+func GetTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version: %s", name)
+	}
+	return version, nil
+}
+
+// GetTLSCipherSuites returns the ids of the TLS 1.2 cipher suites with the given
+// OpenSSL names, such as "ECDHE-RSA-AES128-GCM-SHA256".
+func GetTLSCipherSuites(names []string) ([]uint16, error) {
+	var ids []uint16
+	for _, name := range names {
+		id, ok := tlsCipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // GetCertPool gets a cert pool for the given CA or CAFile.
 func GetCertPool(ca, caFile string) (*x509.CertPool, error) {
 	rootCAs, err := x509.SystemCertPool()
@@ -42,6 +87,72 @@ func GetCertPool(ca, caFile string) (*x509.CertPool, error) {
 	return rootCAs, nil
 }
 
+// GetCertPoolFromFiles returns a cert pool containing the system certificate
+// authorities and the certificate authorities in each of the given files. A path
+// may also be a directory, in which case every PEM file (.pem or .crt) in it is
+// loaded.
+func GetCertPoolFromFiles(caFiles ...string) (*x509.CertPool, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		log.Error().Err(err).Msg("pkg/cryptutil: failed getting system cert pool making new one")
+		rootCAs = x509.NewCertPool()
+	}
+
+	for _, caFile := range caFiles {
+		if caFile == "" {
+			continue
+		}
+
+		fi, err := os.Stat(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate authority file (%s): %w", caFile, err)
+		}
+
+		paths := []string{caFile}
+		if fi.IsDir() {
+			paths, err = getPEMFilesInDir(caFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, p := range paths {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read certificate authority file (%s): %w", p, err)
+			}
+			if ok := rootCAs.AppendCertsFromPEM(data); !ok {
+				return nil, fmt.Errorf("failed to append any PEM-encoded certificates from %s", p)
+			}
+			log.Debug().Str("file", p).Msg("pkg/cryptutil: added custom certificate authority")
+		}
+	}
+
+	return rootCAs, nil
+}
+
+func getPEMFilesInDir(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate authority directory (%s): %w", dir, err)
+	}
+
+	var paths []string
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".pem", ".crt":
+			paths = append(paths, filepath.Join(dir, fi.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no PEM files found in certificate authority directory (%s)", dir)
+	}
+	return paths, nil
+}
+
 // GetCertificateForDomain returns the tls Certificate which matches the given domain name.
 // It should handle both exact matches and wildcard matches. If none of those match, the first certificate will be used.
 // Finally if there are no matching certificates one will be generated.
@@ -84,3 +195,101 @@ func matchesDomain(cert *tls.Certificate, domain string) bool {
 
 	return false
 }
+
+// A CertificateReloader loads a certificate and key pair from files, and reloads
+// it when the files change, so that new connections always present the current
+// certificate after it's rotated on disk.
+type CertificateReloader struct {
+	certFile, keyFile string
+	minCheckInterval  time.Duration
+	now               func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certStamp fileStamp
+	keyStamp  fileStamp
+	lastCheck time.Time
+}
+
+// fileStamp identifies the version of a file.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+// NewCertificateReloader creates a new CertificateReloader for the given certificate
+// and key files. The files are checked for changes when a certificate is requested,
+// at most once every minCheckInterval. It returns an error if the files can't be
+// loaded initially.
+func NewCertificateReloader(certFile, keyFile string, minCheckInterval time.Duration) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile:         certFile,
+		keyFile:          keyFile,
+		minCheckInterval: minCheckInterval,
+		now:              time.Now,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files
+// changed since it was loaded. If the changed files can't be loaded, for example
+// because only one of them has been replaced so far, the previous certificate is
+// returned and the reload is retried on the next check.
+func (r *CertificateReloader) GetCertificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := r.now(); now.Sub(r.lastCheck) >= r.minCheckInterval {
+		r.lastCheck = now
+		if err := r.reloadIfChangedLocked(); err != nil {
+			log.Error().Err(err).Str("file", r.certFile).Msg("pkg/cryptutil: failed to reload certificate, using the previous one")
+		}
+	}
+	return r.cert
+}
+
+// GetClientCertificate implements the tls.Config GetClientCertificate callback.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.GetCertificate(), nil
+}
+
+func (r *CertificateReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastCheck = r.now()
+	return r.reloadIfChangedLocked()
+}
+
+func (r *CertificateReloader) reloadIfChangedLocked() error {
+	certStamp, err := statFile(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := statFile(r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && certStamp == r.certStamp && keyStamp == r.keyStamp {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate (%s): %w", r.certFile, err)
+	}
+	r.cert = &cert
+	r.certStamp, r.keyStamp = certStamp, keyStamp
+	return nil
+}
+
+func statFile(name string) (fileStamp, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to read certificate file (%s): %w", name, err)
+	}
+	return fileStamp{modTime: fi.ModTime().UnixNano(), size: fi.Size()}, nil
+}
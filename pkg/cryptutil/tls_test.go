@@ -1,10 +1,22 @@
 package cryptutil
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetCertificateForDomain(t *testing.T) {
@@ -61,3 +73,194 @@ func TestGetCertificateForDomain(t *testing.T) {
 		assert.NotNil(t, found)
 	})
 }
+
+func TestGetCertPoolFromFiles(t *testing.T) {
+	newCA := func(t *testing.T, name string) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	newLeaf := func(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "redis.example.com"},
+			DNSNames:     []string{"redis.example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert
+	}
+
+	ca1, ca1Key, ca1PEM := newCA(t, "CA 1")
+	ca2, ca2Key, ca2PEM := newCA(t, "CA 2")
+	leaf1 := newLeaf(t, ca1, ca1Key)
+	leaf2 := newLeaf(t, ca2, ca2Key)
+
+	dir := t.TempDir()
+	ca1File := filepath.Join(dir, "ca1.pem")
+	ca2File := filepath.Join(dir, "ca2.pem")
+	require.NoError(t, ioutil.WriteFile(ca1File, ca1PEM, 0o600))
+	require.NoError(t, ioutil.WriteFile(ca2File, ca2PEM, 0o600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a cert"), 0o600))
+
+	verify := func(pool *x509.CertPool, leaf *x509.Certificate) error {
+		_, err := leaf.Verify(x509.VerifyOptions{DNSName: "redis.example.com", Roots: pool})
+		return err
+	}
+
+	t.Run("files", func(t *testing.T) {
+		pool, err := GetCertPoolFromFiles(ca1File, ca2File)
+		require.NoError(t, err)
+		assert.NoError(t, verify(pool, leaf1))
+		assert.NoError(t, verify(pool, leaf2))
+	})
+	t.Run("directory", func(t *testing.T) {
+		pool, err := GetCertPoolFromFiles(dir)
+		require.NoError(t, err)
+		assert.NoError(t, verify(pool, leaf1))
+		assert.NoError(t, verify(pool, leaf2))
+	})
+	t.Run("single file", func(t *testing.T) {
+		pool, err := GetCertPoolFromFiles(ca1File)
+		require.NoError(t, err)
+		assert.NoError(t, verify(pool, leaf1))
+		assert.Error(t, verify(pool, leaf2))
+	})
+	t.Run("unreadable file", func(t *testing.T) {
+		_, err := GetCertPoolFromFiles(ca1File, filepath.Join(dir, "missing.pem"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "missing.pem")
+	})
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert := func(t *testing.T, name string, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+		require.NoError(t, err)
+		keyPEM, err := EncodePrivateKey(key)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+		require.NoError(t, ioutil.WriteFile(keyFile, keyPEM, 0o600))
+		// the modification time may not change between writes on some filesystems
+		require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	}
+
+	serverCert, err := GenerateSelfSignedCertificate("storage.example.com")
+	require.NoError(t, err)
+	li, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	require.NoError(t, err)
+	defer li.Close()
+	presented := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := li.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				presented <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	writeCert(t, "client 1", time.Now().Add(-time.Minute))
+	r, err := NewCertificateReloader(certFile, keyFile, 0)
+	require.NoError(t, err)
+	connect := func(t *testing.T) string {
+		conn, err := tls.Dial("tcp", li.Addr().String(), &tls.Config{
+			// nolint: gosec
+			InsecureSkipVerify:   true,
+			GetClientCertificate: r.GetClientCertificate,
+		})
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.Handshake())
+		select {
+		case name := <-presented:
+			return name
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for the handshake")
+			return ""
+		}
+	}
+
+	assert.Equal(t, "client 1", connect(t))
+
+	writeCert(t, "client 2", time.Now())
+	assert.Equal(t, "client 2", connect(t), "new connections should present the rotated certificate")
+
+	t.Run("invalid", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(keyFile, []byte("NOT PEM"), 0o600))
+		assert.Equal(t, "client 2", connect(t), "the previous certificate should be kept")
+	})
+	t.Run("min check interval", func(t *testing.T) {
+		now := time.Now()
+		r.now = func() time.Time { return now }
+		r.minCheckInterval = time.Minute
+		writeCert(t, "client 3", time.Now().Add(time.Minute))
+		assert.Equal(t, "client 2", connect(t))
+
+		now = now.Add(time.Minute)
+		assert.Equal(t, "client 3", connect(t), "the files should be checked once the interval elapses")
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, err := NewCertificateReloader(filepath.Join(dir, "missing.pem"), keyFile, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestGetTLSVersion(t *testing.T) {
+	version, err := GetTLSVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = GetTLSVersion("1.0")
+	assert.Error(t, err)
+}
+
+func TestGetTLSCipherSuites(t *testing.T) {
+	ids, err := GetTLSCipherSuites([]string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-ECDSA-CHACHA20-POLY1305"})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}, ids)
+
+	_, err = GetTLSCipherSuites([]string{"RC4-SHA"})
+	assert.Error(t, err)
+}
@@ -43,6 +43,17 @@ type Options struct {
 	RequestTimeout time.Duration
 	// ClientDNSRoundRobin enables or disables DNS resolver based load balancing
 	ClientDNSRoundRobin bool
+	// Compression enables gzip compression of requests. Responses are compressed
+	// by servers which support it.
+	Compression bool
+	// MaxRecvMsgSize sets the maximum size in bytes of messages the client can
+	// receive. It should match the server's maximum send message size. 0 uses the
+	// gRPC default of 4MB.
+	MaxRecvMsgSize int
+	// TLSMinVersion sets the minimum TLS version. 0 uses TLS 1.2.
+	TLSMinVersion uint16
+	// TLSCipherSuites sets the TLS 1.2 cipher suites. nil uses the defaults.
+	TLSCipherSuites []uint16
 
 	// WithInsecure disables transport security for this ClientConn.
 	// Note that transport security is required unless WithInsecure is set.
@@ -59,7 +70,16 @@ type Options struct {
 }
 
 // NewGRPCClientConn returns a new gRPC pomerium service client connection.
-func NewGRPCClientConn(opts *Options) (*grpc.ClientConn, error) {
+//
+// The other dial options are appended to the built-in ones, such as for the
+// interceptors, credentials or balancers of a service mesh. Chained interceptors
+// run after the built-in ones, so requests still get a request id, a timeout and
+// the signed JWT. Options which set a single value replace the built-in one
+// instead: transport credentials replace the TLS or insecure transport, a stats
+// handler replaces the telemetry one, and default call options or a default
+// service config replace wait-for-ready, the maximum receive message size and
+// round robin balancing. Service configs from the resolver stay disabled.
+func NewGRPCClientConn(opts *Options, other ...grpc.DialOption) (*grpc.ClientConn, error) {
 	if len(opts.Addrs) == 0 {
 		return nil, errors.New("internal/grpc: connection address required")
 	}
@@ -102,6 +122,10 @@ func NewGRPCClientConn(opts *Options) (*grpc.ClientConn, error) {
 		grpc.WithStatsHandler(clientStatsHandler.Handler),
 		grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
 		grpc.WithDisableServiceConfig(),
+		grpcutil.WithGRPCCompression(opts.Compression),
+	}
+	if opts.MaxRecvMsgSize > 0 {
+		dialOptions = append(dialOptions, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(opts.MaxRecvMsgSize)))
 	}
 
 	if opts.WithInsecure {
@@ -113,7 +137,15 @@ func NewGRPCClientConn(opts *Options) (*grpc.ClientConn, error) {
 			return nil, err
 		}
 
-		cert := credentials.NewTLS(&tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12})
+		minVersion := opts.TLSMinVersion
+		if minVersion == 0 {
+			minVersion = tls.VersionTLS12
+		}
+		cert := credentials.NewTLS(&tls.Config{
+			RootCAs:      rootCAs,
+			MinVersion:   minVersion,
+			CipherSuites: opts.TLSCipherSuites,
+		})
 
 		// override allowed certificate name string, typically used when doing behind ingress connection
 		if opts.OverrideCertificateName != "" {
@@ -127,6 +159,7 @@ func NewGRPCClientConn(opts *Options) (*grpc.ClientConn, error) {
 		dialOptions = append(dialOptions, grpc.WithTransportCredentials(cert))
 	}
 
+	dialOptions = append(dialOptions, other...)
 	return grpc.Dial(connAddr, dialOptions...)
 }
 
@@ -156,8 +189,9 @@ var grpcClientConns = struct {
 
 // GetGRPCClientConn returns a gRPC client connection for the given name. If a connection for that name has already been
 // established the existing connection will be returned. If any options change for that connection, the existing
-// connection will be closed and a new one established.
-func GetGRPCClientConn(name string, opts *Options) (*grpc.ClientConn, error) {
+// connection will be closed and a new one established. The other dial options are passed to NewGRPCClientConn. They
+// can't be compared, so they only apply when a connection is established.
+func GetGRPCClientConn(name string, opts *Options, other ...grpc.DialOption) (*grpc.ClientConn, error) {
 	grpcClientConns.Lock()
 	defer grpcClientConns.Unlock()
 
@@ -173,7 +207,7 @@ func GetGRPCClientConn(name string, opts *Options) (*grpc.ClientConn, error) {
 		}
 	}
 
-	cc, err := NewGRPCClientConn(opts)
+	cc, err := NewGRPCClientConn(opts, other...)
 	if err != nil {
 		return nil, err
 	}
@@ -2,13 +2,17 @@ package grpc
 
 import (
 	"context"
+	"net"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func Test_grpcTimeoutInterceptor(t *testing.T) {
@@ -76,6 +80,33 @@ func TestNewGRPC(t *testing.T) {
 	}
 }
 
+func TestNewGRPCDialOptions(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	var methods []string
+	cc, err := NewGRPCClientConn(&Options{
+		Addrs:        []*url.URL{{Scheme: "http", Host: li.Addr().String()}},
+		WithInsecure: true,
+	}, grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		methods = append(methods, method)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(cc).Check(ctx, new(grpc_health_v1.HealthCheckRequest))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/grpc.health.v1.Health/Check"}, methods, "the custom interceptor should run")
+}
+
 func TestGetGRPC(t *testing.T) {
 	cc1, err := GetGRPCClientConn("example", &Options{
 		Addrs: mustParseURLs("https://localhost.example"),
@@ -0,0 +1,111 @@
+package databroker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// Compression codecs for records sent on Sync streams.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// SupportedCompressions are the supported compression codecs, in order of
+// preference.
+var SupportedCompressions = []string{CompressionZstd, CompressionGzip}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func getZstd() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// IsSupportedCompression returns true if the compression codec is supported.
+func IsSupportedCompression(codec string) bool {
+	for _, supported := range SupportedCompressions {
+		if codec == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress compresses data with the given codec.
+func Compress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, _, err := getZstd()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("databroker: unsupported compression codec: %s", codec)
+}
+
+// Decompress decompresses data compressed with the given codec.
+func Decompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case CompressionZstd:
+		_, decoder, err := getZstd()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("databroker: unsupported compression codec: %s", codec)
+}
+
+// DecompressRecord returns the record of the response, decompressing it if it
+// was sent compressed. Heartbeats have no record, so nil is returned.
+func (x *SyncResponse) DecompressRecord() (*Record, error) {
+	if x.GetCompression() == "" {
+		return x.GetRecord(), nil
+	}
+
+	data, err := Decompress(x.GetCompression(), x.GetCompressedRecord())
+	if err != nil {
+		return nil, fmt.Errorf("databroker: error decompressing record: %w", err)
+	}
+	record := new(Record)
+	if err := proto.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("databroker: error unmarshaling decompressed record: %w", err)
+	}
+	return record, nil
+}
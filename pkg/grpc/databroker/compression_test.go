@@ -0,0 +1,35 @@
+package databroker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSyncResponse_DecompressRecord(t *testing.T) {
+	record := &Record{Version: 1, Type: "TYPE", Id: strings.Repeat("ID", 100)}
+	data, err := proto.Marshal(record)
+	require.NoError(t, err)
+
+	for _, codec := range SupportedCompressions {
+		t.Run(codec, func(t *testing.T) {
+			compressed, err := Compress(codec, data)
+			require.NoError(t, err)
+			assert.Less(t, len(compressed), len(data))
+
+			actual, err := (&SyncResponse{CompressedRecord: compressed, Compression: codec}).DecompressRecord()
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(record, actual))
+		})
+	}
+
+	actual, err := (&SyncResponse{Record: record}).DecompressRecord()
+	require.NoError(t, err)
+	assert.Equal(t, record, actual, "uncompressed records should be returned as is")
+
+	_, err = (&SyncResponse{CompressedRecord: data, Compression: "br"}).DecompressRecord()
+	assert.Error(t, err)
+}
@@ -6,8 +6,20 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
+// ProtocolVersion is the version of the sync protocol implemented by this
+// package's clients. It's advertised to the server on SyncLatest and Sync
+// streams, and is incremented whenever the semantics of syncing change in a way
+// which is incompatible with older clients.
+const ProtocolVersion = 1
+
 // GetUserID gets the databroker user id from a provider user id.
 func GetUserID(provider, providerUserID string) string {
 	return provider + "/" + providerUserID
@@ -36,15 +48,50 @@ func ApplyOffsetAndLimit(all []*Record, offset, limit int) (records []*Record, t
 	return records, len(all)
 }
 
-// InitialSync performs a sync latest and then returns all the results.
+// IsResetRequired returns true if the error from a Sync stream indicates that the
+// requested record version is no longer available, so the client must reset by
+// syncing the latest records.
+func IsResetRequired(err error) bool {
+	return status.Code(err) == codes.OutOfRange
+}
+
+// InitialSync performs a sync latest and then returns all the results. Streams
+// truncated by the server are continued until all the results are returned. The
+// record version is that of the first stream, so that syncing from it doesn't
+// miss any changes.
 func InitialSync(
 	ctx context.Context,
 	client DataBrokerServiceClient,
 	req *SyncLatestRequest,
 ) (records []*Record, recordVersion, serverVersion uint64, err error) {
-	stream, err := client.SyncLatest(ctx, req)
+	req = proto.Clone(req).(*SyncLatestRequest)
+	for first := true; ; first = false {
+		page, pageRecordVersion, pageServerVersion, nextCursor, err := syncLatest(ctx, client, req)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if !first && pageServerVersion != serverVersion {
+			return nil, 0, 0, fmt.Errorf("databroker: server version changed during initial sync")
+		}
+		records = append(records, page...)
+		if first {
+			recordVersion, serverVersion = pageRecordVersion, pageServerVersion
+		}
+		if nextCursor == "" {
+			return records, recordVersion, serverVersion, nil
+		}
+		req.Cursor = nextCursor
+	}
+}
+
+func syncLatest(
+	ctx context.Context,
+	client DataBrokerServiceClient,
+	req *SyncLatestRequest,
+) (records []*Record, recordVersion, serverVersion uint64, nextCursor string, err error) {
+	stream, err := client.SyncLatest(grpcutil.WithOutgoingProtocolVersion(ctx, ProtocolVersion), req)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, 0, 0, "", err
 	}
 
 loop:
@@ -54,13 +101,14 @@ loop:
 		case err == io.EOF:
 			break loop
 		case err != nil:
-			return nil, 0, 0, err
+			return nil, 0, 0, "", err
 		}
 
 		switch res := res.GetResponse().(type) {
 		case *SyncLatestResponse_Versions:
 			recordVersion = res.Versions.GetLatestRecordVersion()
 			serverVersion = res.Versions.GetServerVersion()
+			nextCursor = res.Versions.GetNextCursor()
 		case *SyncLatestResponse_Record:
 			records = append(records, res.Record)
 		default:
@@ -68,5 +116,5 @@ loop:
 		}
 	}
 
-	return records, recordVersion, serverVersion, nil
+	return records, recordVersion, serverVersion, nextCursor, nil
 }
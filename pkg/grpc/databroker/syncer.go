@@ -11,10 +11,17 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
 type syncerConfig struct {
 	typeURL string
+	labels  map[string]string
+
+	reconnectInitialInterval time.Duration
+	reconnectMaxInterval     time.Duration
+
+	onConnectionState func(state SyncerConnectionState, retryIn time.Duration)
 }
 
 // A SyncerOption customizes the syncer configuration.
@@ -35,6 +42,61 @@ func WithTypeURL(typeURL string) SyncerOption {
 	}
 }
 
+// WithLabels sets the labels sent on Sync requests to identify the client. Only the
+// "service" and "instance" labels are accepted by the server.
+func WithLabels(labels map[string]string) SyncerOption {
+	return func(cfg *syncerConfig) {
+		cfg.labels = labels
+	}
+}
+
+// WithReconnectBackoff sets the initial and maximum delay between reconnection
+// attempts. The delay grows exponentially up to the maximum, and is randomized so
+// that clients don't reconnect in lockstep after a server restart. Zero values
+// leave the defaults of 500ms and 1m.
+func WithReconnectBackoff(initialInterval, maxInterval time.Duration) SyncerOption {
+	return func(cfg *syncerConfig) {
+		cfg.reconnectInitialInterval = initialInterval
+		cfg.reconnectMaxInterval = maxInterval
+	}
+}
+
+// WithConnectionStateHandler sets a function which is called when the connection
+// state of the syncer changes. It is called for every failed attempt while
+// disconnected, with the delay before the next attempt as retryIn. Otherwise
+// retryIn is 0. The function is called synchronously from Run.
+func WithConnectionStateHandler(fn func(state SyncerConnectionState, retryIn time.Duration)) SyncerOption {
+	return func(cfg *syncerConfig) {
+		cfg.onConnectionState = fn
+	}
+}
+
+// SyncerConnectionState is the state of a Syncer's connection to the databroker.
+type SyncerConnectionState int
+
+// SyncerConnectionState values.
+const (
+	// SyncerConnecting is the state before the first connection is established.
+	SyncerConnecting SyncerConnectionState = iota
+	// SyncerConnected is the state while a connection is established.
+	SyncerConnected
+	// SyncerDisconnected is the state while waiting to reconnect after an error.
+	SyncerDisconnected
+)
+
+// String returns the name of the connection state.
+func (state SyncerConnectionState) String() string {
+	switch state {
+	case SyncerConnecting:
+		return "connecting"
+	case SyncerConnected:
+		return "connected"
+	case SyncerDisconnected:
+		return "disconnected"
+	}
+	return fmt.Sprintf("SyncerConnectionState(%d)", int(state))
+}
+
 // A SyncerHandler receives sync events from the Syncer.
 type SyncerHandler interface {
 	GetDataBrokerServiceClient() DataBrokerServiceClient
@@ -54,6 +116,8 @@ type Syncer struct {
 	recordVersion uint64
 	serverVersion uint64
 
+	connectionState SyncerConnectionState
+
 	closeCtx       context.Context
 	closeCtxCancel func()
 }
@@ -62,10 +126,18 @@ type Syncer struct {
 func NewSyncer(handler SyncerHandler, options ...SyncerOption) *Syncer {
 	closeCtx, closeCtxCancel := context.WithCancel(context.Background())
 
+	cfg := getSyncerConfig(options...)
 	bo := backoff.NewExponentialBackOff()
+	if cfg.reconnectInitialInterval > 0 {
+		bo.InitialInterval = cfg.reconnectInitialInterval
+	}
+	if cfg.reconnectMaxInterval > 0 {
+		bo.MaxInterval = cfg.reconnectMaxInterval
+	}
 	bo.MaxElapsedTime = 0
+	bo.Reset()
 	return &Syncer{
-		cfg:     getSyncerConfig(options...),
+		cfg:     cfg,
 		handler: handler,
 		backoff: bo,
 
@@ -97,10 +169,16 @@ func (syncer *Syncer) Run(ctx context.Context) error {
 		}
 
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			retryIn := syncer.backoff.NextBackOff()
+			syncer.setConnectionState(SyncerDisconnected, retryIn)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-time.After(syncer.backoff.NextBackOff()):
+			case <-time.After(retryIn):
 			}
 		}
 	}
@@ -116,6 +194,7 @@ func (syncer *Syncer) init(ctx context.Context) error {
 		return err
 	}
 	syncer.backoff.Reset()
+	syncer.setConnectionState(SyncerConnected, 0)
 
 	// reset the records as we have to sync latest
 	syncer.handler.ClearRecords(ctx)
@@ -128,15 +207,23 @@ func (syncer *Syncer) init(ctx context.Context) error {
 }
 
 func (syncer *Syncer) sync(ctx context.Context) error {
+	ctx = grpcutil.WithOutgoingProtocolVersion(ctx, ProtocolVersion)
 	stream, err := syncer.handler.GetDataBrokerServiceClient().Sync(ctx, &SyncRequest{
-		ServerVersion: syncer.serverVersion,
-		RecordVersion: syncer.recordVersion,
+		ServerVersion:     syncer.serverVersion,
+		RecordVersion:     syncer.recordVersion,
+		Labels:            syncer.cfg.labels,
+		AcceptCompression: SupportedCompressions,
+		AcceptHeartbeats:  true,
 	})
 	if err != nil {
 		syncer.log().Error().Err(err).Msg("error during sync")
 		return err
 	}
+	syncer.setConnectionState(SyncerConnected, 0)
 
+	// the backoff is only reset once the server responds, so that a server which
+	// fails streams right away is still backed off from
+	responded := false
 	for {
 		res, err := stream.Recv()
 		if status.Code(err) == codes.Aborted {
@@ -144,24 +231,53 @@ func (syncer *Syncer) sync(ctx context.Context) error {
 			// server version changed, so re-init
 			syncer.serverVersion = 0
 			return nil
+		} else if IsResetRequired(err) {
+			syncer.log().Error().Err(err).Msg("aborted sync due to unavailable record version")
+			// changes were missed, so re-init
+			syncer.serverVersion = 0
+			return nil
 		} else if err != nil {
 			return err
 		}
+		if !responded {
+			responded = true
+			syncer.backoff.Reset()
+		}
 
-		if syncer.recordVersion != res.GetRecord().GetVersion()-1 {
+		record, err := res.DecompressRecord()
+		if err != nil {
+			return err
+		}
+
+		// responses without a record are heartbeats sent on idle streams
+		if record == nil {
+			continue
+		}
+
+		if syncer.recordVersion != record.GetVersion()-1 {
 			syncer.log().Error().Err(err).
-				Uint64("received", res.GetRecord().GetVersion()).
+				Uint64("received", record.GetVersion()).
 				Msg("aborted sync due to missing record")
 			syncer.serverVersion = 0
 			return fmt.Errorf("missing record version")
 		}
-		syncer.recordVersion = res.GetRecord().GetVersion()
-		if syncer.cfg.typeURL == "" || syncer.cfg.typeURL == res.GetRecord().GetType() {
-			syncer.handler.UpdateRecords(ctx, []*Record{res.GetRecord()})
+		syncer.recordVersion = record.GetVersion()
+		if syncer.cfg.typeURL == "" || syncer.cfg.typeURL == record.GetType() {
+			syncer.handler.UpdateRecords(ctx, []*Record{record})
 		}
 	}
 }
 
+func (syncer *Syncer) setConnectionState(state SyncerConnectionState, retryIn time.Duration) {
+	if state == syncer.connectionState && state != SyncerDisconnected {
+		return
+	}
+	syncer.connectionState = state
+	if syncer.cfg.onConnectionState != nil {
+		syncer.cfg.onConnectionState(state, retryIn)
+	}
+}
+
 func (syncer *Syncer) log() *zerolog.Logger {
 	l := log.With().Str("service", "syncer").
 		Str("type", syncer.cfg.typeURL).
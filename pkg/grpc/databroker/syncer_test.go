@@ -3,9 +3,11 @@ package databroker
 import (
 	"context"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
+	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
@@ -220,3 +222,171 @@ func TestSyncer(t *testing.T) {
 
 	assert.NoError(t, syncer.Close())
 }
+
+// unavailableClient fails Sync and SyncLatest calls with Unavailable while down,
+// simulating an unreachable server.
+type unavailableClient struct {
+	DataBrokerServiceClient
+	down func() bool
+}
+
+func (c unavailableClient) Sync(ctx context.Context, in *SyncRequest, opts ...grpc.CallOption) (DataBrokerService_SyncClient, error) {
+	if c.down() {
+		return nil, status.Error(codes.Unavailable, "UNAVAILABLE")
+	}
+	return c.DataBrokerServiceClient.Sync(ctx, in, opts...)
+}
+
+func (c unavailableClient) SyncLatest(ctx context.Context, in *SyncLatestRequest, opts ...grpc.CallOption) (DataBrokerService_SyncLatestClient, error) {
+	if c.down() {
+		return nil, status.Error(codes.Unavailable, "UNAVAILABLE")
+	}
+	return c.DataBrokerServiceClient.SyncLatest(ctx, in, opts...)
+}
+
+func TestSyncerReconnect(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	const (
+		initialInterval = time.Millisecond * 10
+		maxInterval     = time.Millisecond * 80
+		failedAttempts  = 7
+	)
+
+	lis := bufconn.Listen(1)
+	r1 := &Record{Version: 1000, Id: "r1"}
+	r2 := &Record{Version: 1001, Id: "r2"}
+	r3 := &Record{Version: 1002, Id: "r3"}
+
+	var mu sync.Mutex
+	var syncRequests []*SyncRequest
+	syncLatestCount := 0
+	down := 0
+
+	gs := grpc.NewServer()
+	RegisterDataBrokerServiceServer(gs, testServer{
+		sync: func(request *SyncRequest, server DataBrokerService_SyncServer) error {
+			mu.Lock()
+			syncRequests = append(syncRequests, request)
+			n := len(syncRequests)
+			mu.Unlock()
+
+			switch n {
+			case 1:
+				_ = server.Send(&SyncResponse{ServerVersion: 2000, Record: r2})
+				// simulate a server restart
+				mu.Lock()
+				down = failedAttempts
+				mu.Unlock()
+				return status.Error(codes.Unavailable, "RESTARTING")
+			default:
+				_ = server.Send(&SyncResponse{ServerVersion: 2000, Record: r3})
+				<-server.Context().Done()
+				return nil
+			}
+		},
+		syncLatest: func(req *SyncLatestRequest, server DataBrokerService_SyncLatestServer) error {
+			mu.Lock()
+			syncLatestCount++
+			mu.Unlock()
+			_ = server.Send(&SyncLatestResponse{
+				Response: &SyncLatestResponse_Record{Record: r1},
+			})
+			_ = server.Send(&SyncLatestResponse{
+				Response: &SyncLatestResponse_Versions{
+					Versions: &Versions{LatestRecordVersion: r1.Version, ServerVersion: 2000},
+				},
+			})
+			return nil
+		},
+	})
+	go func() { _ = gs.Serve(lis) }()
+	defer gs.Stop()
+
+	gc, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	defer func() { _ = gc.Close() }()
+
+	var retries []time.Duration
+	connected := make(chan struct{}, 10)
+	updateCh := make(chan []*Record, 10)
+	syncer := NewSyncer(testSyncerHandler{
+		getDataBrokerServiceClient: func() DataBrokerServiceClient {
+			return unavailableClient{
+				DataBrokerServiceClient: NewDataBrokerServiceClient(gc),
+				down: func() bool {
+					mu.Lock()
+					defer mu.Unlock()
+					if down > 0 {
+						down--
+						return true
+					}
+					return false
+				},
+			}
+		},
+		clearRecords: func(ctx context.Context) {},
+		updateRecords: func(ctx context.Context, records []*Record) {
+			updateCh <- records
+		},
+	},
+		WithReconnectBackoff(initialInterval, maxInterval),
+		WithConnectionStateHandler(func(state SyncerConnectionState, retryIn time.Duration) {
+			switch state {
+			case SyncerDisconnected:
+				retries = append(retries, retryIn)
+			case SyncerConnected:
+				connected <- struct{}{}
+			}
+		}),
+	)
+	defer func() { _ = syncer.Close() }()
+	go func() { _ = syncer.Run(ctx) }()
+
+	var received []string
+	for len(received) < 3 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("expected records to be synced", received)
+		case records := <-updateCh:
+			for _, record := range records {
+				received = append(received, record.GetId())
+			}
+		}
+	}
+	assert.Equal(t, []string{"r1", "r2", "r3"}, received)
+	assert.Len(t, connected, 2, "should report the initial connection and the reconnection")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 1, syncLatestCount, "should not re-sync all records after reconnecting")
+	if assert.Len(t, syncRequests, 2) {
+		assert.Equal(t, r2.Version, syncRequests[1].GetRecordVersion(),
+			"should resume from the last received version")
+	}
+
+	// the attempt after the restart and each of the failed attempts
+	require.Len(t, retries, failedAttempts+1)
+	jittered := false
+	expect := float64(initialInterval)
+	for _, retry := range retries {
+		assert.GreaterOrEqual(t, retry, initialInterval/2)
+		assert.LessOrEqual(t, retry, maxInterval*3/2, "backoff should be capped")
+		if retry != time.Duration(expect) {
+			jittered = true
+		}
+		expect *= backoff.DefaultMultiplier
+		if expect > float64(maxInterval) {
+			expect = float64(maxInterval)
+		}
+	}
+	assert.True(t, jittered, "backoff should be jittered")
+	assert.Greater(t, retries[len(retries)-1]+retries[len(retries)-2], retries[0]+retries[1],
+		"backoff should grow")
+}
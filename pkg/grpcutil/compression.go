@@ -0,0 +1,21 @@
+package grpcutil
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+)
+
+// WithGRPCCompression returns a DialOption that compresses requests with gzip if
+// enabled.
+//
+// Compression is negotiated rather than forced: importing this package registers
+// the gzip compressor, so servers accept compressed requests and only compress
+// their responses to clients which compressed their request. Clients without
+// compression are unaffected. Servers must support gzip before compression is
+// enabled on clients.
+func WithGRPCCompression(enabled bool) grpc.DialOption {
+	if !enabled {
+		return grpc.EmptyDialOption{}
+	}
+	return grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name))
+}
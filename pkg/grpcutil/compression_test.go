@@ -0,0 +1,99 @@
+package grpcutil
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// compressionStatsHandler records the compression used by incoming and outgoing
+// messages.
+type compressionStatsHandler struct {
+	mu          sync.Mutex
+	compression []string
+}
+
+func (h *compressionStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch s := s.(type) {
+	case *stats.InHeader:
+		h.record(s.Compression)
+	case *stats.OutHeader:
+		h.record(s.Compression)
+	}
+}
+
+func (h *compressionStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func (h *compressionStatsHandler) record(compression string) {
+	h.mu.Lock()
+	h.compression = append(h.compression, compression)
+	h.mu.Unlock()
+}
+
+func (h *compressionStatsHandler) reset() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	compression := h.compression
+	h.compression = nil
+	return compression
+}
+
+func TestWithGRPCCompression(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	li := bufconn.Listen(1024 * 1024)
+	serverStats := new(compressionStatsHandler)
+	srv := grpc.NewServer(grpc.StatsHandler(serverStats))
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	check := func(t *testing.T, enabled bool) {
+		clientStats := new(compressionStatsHandler)
+		cc, err := grpc.DialContext(ctx, "bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+				return li.Dial()
+			}),
+			grpc.WithInsecure(),
+			grpc.WithStatsHandler(clientStats),
+			WithGRPCCompression(enabled))
+		require.NoError(t, err)
+		defer cc.Close()
+
+		serverStats.reset()
+		res, err := grpc_health_v1.NewHealthClient(cc).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.GetStatus())
+
+		expect := ""
+		if enabled {
+			expect = "gzip"
+		}
+		// the server should receive the request and send the response with
+		// the compression chosen by the client
+		assert.Equal(t, []string{expect, expect}, serverStats.reset())
+		assert.Contains(t, clientStats.reset(), expect)
+	}
+
+	t.Run("enabled", func(t *testing.T) { check(t, true) })
+	t.Run("disabled", func(t *testing.T) { check(t, false) })
+}
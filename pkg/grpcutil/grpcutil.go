@@ -3,6 +3,9 @@ package grpcutil
 
 import (
 	"context"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
@@ -55,6 +58,144 @@ func JWTFromGRPCRequest(ctx context.Context) (rawjwt string, ok bool) {
 	return rawjwts[0], true
 }
 
+// SyncOperationMetadataKey is the key in the metadata used to tag requests which
+// are part of a single logical sync operation.
+const SyncOperationMetadataKey = "x-pomerium-sync-operation"
+
+// WithOutgoingSyncOperation appends a metadata header for the sync operation to a context.
+func WithOutgoingSyncOperation(ctx context.Context, operation string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, SyncOperationMetadataKey, operation)
+}
+
+// SyncOperationFromGRPCRequest returns the sync operation from the gRPC request.
+func SyncOperationFromGRPCRequest(ctx context.Context) (operation string, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	operations := md.Get(SyncOperationMetadataKey)
+	if len(operations) == 0 {
+		return "", false
+	}
+
+	return operations[0], true
+}
+
+// ActorMetadataKey is the key in the metadata used to describe who or what is
+// making a request.
+const ActorMetadataKey = "x-pomerium-actor"
+
+// WithOutgoingActor appends a metadata header for the actor to a context.
+func WithOutgoingActor(ctx context.Context, actor string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ActorMetadataKey, actor)
+}
+
+// ActorFromGRPCRequest returns the actor from the gRPC request.
+func ActorFromGRPCRequest(ctx context.Context) (actor string, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	actors := md.Get(ActorMetadataKey)
+	if len(actors) == 0 {
+		return "", false
+	}
+
+	return actors[0], true
+}
+
+// InstallationIDMetadataKey is the key in the metadata used to identify the
+// installation making a request.
+const InstallationIDMetadataKey = "x-pomerium-installation-id"
+
+// WithOutgoingInstallationID appends a metadata header for the installation id to a context.
+func WithOutgoingInstallationID(ctx context.Context, installationID string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, InstallationIDMetadataKey, installationID)
+}
+
+// InstallationIDFromGRPCRequest returns the installation id from the gRPC request.
+func InstallationIDFromGRPCRequest(ctx context.Context) (installationID string, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	installationIDs := md.Get(InstallationIDMetadataKey)
+	if len(installationIDs) == 0 {
+		return "", false
+	}
+
+	return installationIDs[0], true
+}
+
+// ProtocolVersionMetadataKey is the key in the metadata used by databroker clients
+// to advertise the version of the sync protocol they implement.
+const ProtocolVersionMetadataKey = "x-pomerium-protocol-version"
+
+// WithOutgoingProtocolVersion appends a metadata header for the protocol version to a context.
+func WithOutgoingProtocolVersion(ctx context.Context, version int) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ProtocolVersionMetadataKey, strconv.Itoa(version))
+}
+
+// ProtocolVersionFromGRPCRequest returns the protocol version from the gRPC
+// request. Versions which aren't a non-negative integer are ignored.
+func ProtocolVersionFromGRPCRequest(ctx context.Context) (version int, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	versions := md.Get(ProtocolVersionMetadataKey)
+	if len(versions) == 0 {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(versions[0])
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// CacheControlMetadataKey is the key in the response metadata used to hint how
+// long clients may cache the response. Its value is "max-age=<seconds>" if the
+// response is cacheable, and "no-store" otherwise.
+const CacheControlMetadataKey = "x-pomerium-cache-control"
+
+// CacheControlMetadata returns the response metadata hinting that the response
+// may be cached for the ttl, truncated to seconds. A ttl under a second isn't
+// cacheable.
+func CacheControlMetadata(ttl time.Duration) metadata.MD {
+	if seconds := int64(ttl / time.Second); seconds > 0 {
+		return metadata.Pairs(CacheControlMetadataKey, "max-age="+strconv.FormatInt(seconds, 10))
+	}
+	return metadata.Pairs(CacheControlMetadataKey, "no-store")
+}
+
+// CacheTTLFromMetadata returns how long the response with the given metadata may
+// be cached, which is 0 if it's not cacheable. ok is false if the response has no
+// valid cache hint.
+func CacheTTLFromMetadata(md metadata.MD) (ttl time.Duration, ok bool) {
+	values := md.Get(CacheControlMetadataKey)
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	if values[0] == "no-store" {
+		return 0, true
+	}
+	if !strings.HasPrefix(values[0], "max-age=") {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(values[0], "max-age="), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
 // GetPeerAddr returns the peer address.
 func GetPeerAddr(ctx context.Context) string {
 	p, ok := peer.FromContext(ctx)
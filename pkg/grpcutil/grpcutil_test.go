@@ -3,6 +3,7 @@ package grpcutil
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/metadata"
@@ -49,3 +50,58 @@ func TestJWTFromGRPCRequest(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, rawjwt, found)
 }
+
+func TestSyncOperationFromGRPCRequest(t *testing.T) {
+	ctx := context.Background()
+	ctx = WithOutgoingSyncOperation(ctx, "EXAMPLE")
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !assert.True(t, ok) {
+		return
+	}
+	operation, ok := SyncOperationFromGRPCRequest(metadata.NewIncomingContext(context.Background(), md))
+	assert.True(t, ok)
+	assert.Equal(t, "EXAMPLE", operation)
+}
+
+func TestActorFromGRPCRequest(t *testing.T) {
+	ctx := context.Background()
+	ctx = WithOutgoingActor(ctx, "directory-sync")
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !assert.True(t, ok) {
+		return
+	}
+	actor, ok := ActorFromGRPCRequest(metadata.NewIncomingContext(context.Background(), md))
+	assert.True(t, ok)
+	assert.Equal(t, "directory-sync", actor)
+}
+
+func TestProtocolVersionFromGRPCRequest(t *testing.T) {
+	ctx := context.Background()
+	ctx = WithOutgoingProtocolVersion(ctx, 2)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !assert.True(t, ok) {
+		return
+	}
+	version, ok := ProtocolVersionFromGRPCRequest(metadata.NewIncomingContext(context.Background(), md))
+	assert.True(t, ok)
+	assert.Equal(t, 2, version)
+
+	_, ok = ProtocolVersionFromGRPCRequest(metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(ProtocolVersionMetadataKey, "latest")))
+	assert.False(t, ok, "versions which aren't integers should be ignored")
+}
+
+func TestCacheTTLFromMetadata(t *testing.T) {
+	ttl, ok := CacheTTLFromMetadata(CacheControlMetadata(90 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Second, ttl)
+
+	ttl, ok = CacheTTLFromMetadata(CacheControlMetadata(500 * time.Millisecond))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), ttl, "a ttl under a second shouldn't be cacheable")
+
+	_, ok = CacheTTLFromMetadata(metadata.Pairs(CacheControlMetadataKey, "max-age=soon"))
+	assert.False(t, ok)
+	_, ok = CacheTTLFromMetadata(metadata.MD{})
+	assert.False(t, ok)
+}
@@ -19,15 +19,25 @@ const (
 	PolicyCountTotal = "policy_count_total"
 	// ConfigChecksumDecimal should only be used to compare config on a single node, it will be different in multi-node environment
 	ConfigChecksumDecimal = "config_checksum_decimal"
+	// DataBrokerRouteSessions is the number of session records associated with each route
+	DataBrokerRouteSessions = "databroker_route_sessions"
+	// DataBrokerConfigInfo is set to 1, and labeled with the key values of the effective databroker config
+	DataBrokerConfigInfo = "databroker_config_info"
 )
 
 // labels
 const (
-	InstallationIDLabel = "installation_id"
-	ServiceLabel        = "service"
-	ConfigLabel         = "config"
-	VersionLabel        = "version"
-	RevisionLabel       = "revision"
-	GoVersionLabel      = "goversion"
-	HostLabel           = "host"
+	InstallationIDLabel    = "installation_id"
+	ServiceLabel           = "service"
+	ConfigLabel            = "config"
+	VersionLabel           = "version"
+	RevisionLabel          = "revision"
+	GoVersionLabel         = "goversion"
+	HostLabel              = "host"
+	RouteLabel             = "route"
+	FromLabel              = "from"
+	StorageTypeLabel       = "storage_type"
+	GetAllPageSizeLabel    = "get_all_page_size"
+	EncryptionEnabledLabel = "encryption_enabled"
+	ReadOnlyLabel          = "read_only"
 )
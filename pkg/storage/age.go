@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+type recordAgeSamplerBackend struct {
+	Backend
+	recordTypeLabel func(recordType string) string
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewRecordAgeSamplerBackend creates a new backend which periodically records the
+// age of every record in the underlying backend, since it was last modified, in
+// the databroker_record_age_seconds metric. Records are sampled periodically,
+// rather than when they're read, to bound the cost. The record type label is
+// mapped with recordTypeLabel to bound its cardinality.
+func NewRecordAgeSamplerBackend(interval time.Duration, recordTypeLabel func(recordType string) string, underlying Backend) Backend {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &recordAgeSamplerBackend{
+		Backend:         underlying,
+		recordTypeLabel: recordTypeLabel,
+		cancel:          cancel,
+	}
+	go backend.run(ctx, interval)
+	return backend
+}
+
+func (backend *recordAgeSamplerBackend) Close() error {
+	backend.closeOnce.Do(backend.cancel)
+	return backend.Backend.Close()
+}
+
+func (backend *recordAgeSamplerBackend) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := backend.sample(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("storage: error sampling record ages")
+		}
+	}
+}
+
+// sample records the age of every record at now.
+func (backend *recordAgeSamplerBackend) sample(ctx context.Context, now time.Time) error {
+	records, _, err := backend.Backend.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.GetDeletedAt() != nil || record.GetModifiedAt() == nil {
+			continue
+		}
+		age := now.Sub(record.GetModifiedAt().AsTime())
+		if age < 0 {
+			age = 0
+		}
+		metrics.RecordDataBrokerRecordAge(ctx, backend.recordTypeLabel(record.GetType()), age)
+	}
+	return nil
+}
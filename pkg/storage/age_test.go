@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestRecordAgeSamplerBackend(t *testing.T) {
+	view.Unregister(metrics.DataBrokerRecordAgeView)
+	require.NoError(t, view.Register(metrics.DataBrokerRecordAgeView))
+	defer view.Unregister(metrics.DataBrokerRecordAgeView)
+
+	now := time.Now()
+	record := func(recordType string, age time.Duration) *databroker.Record {
+		return &databroker.Record{Type: recordType, ModifiedAt: timestamppb.New(now.Add(-age))}
+	}
+	deleted := record("SESSION", time.Hour*24*365)
+	deleted.DeletedAt = timestamppb.New(now)
+
+	backend := &recordAgeSamplerBackend{
+		Backend: &mockBackend{
+			getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+				return []*databroker.Record{
+					record("SESSION", time.Second*30),
+					record("SESSION", time.Hour*2),
+					record("SESSION", time.Hour*24*3),
+					record("USER", time.Hour*24*100),
+					record("UNKNOWN", time.Minute*5),
+					deleted,
+				}, 1, nil
+			},
+		},
+		recordTypeLabel: func(recordType string) string {
+			if recordType == "UNKNOWN" {
+				return metrics.StorageRecordTypeOther
+			}
+			return recordType
+		},
+	}
+	require.NoError(t, backend.sample(context.Background(), now))
+
+	rows, err := view.RetrieveData(metrics.DataBrokerRecordAgeView.Name)
+	require.NoError(t, err)
+
+	counts := map[string][]int64{}
+	for _, row := range rows {
+		for _, tag := range row.Tags {
+			if tag.Key == metrics.TagKeyStorageRecordType {
+				counts[tag.Value] = row.Data.(*view.DistributionData).CountPerBucket
+			}
+		}
+	}
+	// buckets: <1m, <10m, <1h, <6h, <1d, <7d, <30d, <90d, >=90d
+	assert.Equal(t, map[string][]int64{
+		"SESSION":                      {1, 0, 0, 1, 0, 1, 0, 0, 0},
+		"USER":                         {0, 0, 0, 0, 0, 0, 0, 0, 1},
+		metrics.StorageRecordTypeOther: {0, 1, 0, 0, 0, 0, 0, 0, 0},
+	}, counts)
+	for _, row := range rows {
+		assert.Contains(t, row.Tags, tag.Tag{Key: metrics.TagKeyService, Value: "databroker"})
+	}
+}
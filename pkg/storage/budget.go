@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeadlineBudgetExhausted indicates that a multi-step operation wasn't started,
+// or was rolled back, because too little time was left before the deadline of the
+// calling context to complete it and still clean up after a failure.
+var ErrDeadlineBudgetExhausted = errors.New("storage: deadline budget exhausted")
+
+// A deadlineBudget splits the time left before the deadline of a context between
+// the steps of a multi-step operation and the cleanup undoing them on failure.
+type deadlineBudget struct {
+	stepCtx    context.Context
+	cleanupCtx context.Context
+	cancel     func()
+}
+
+// newDeadlineBudget creates a new deadline budget which reserves the given amount
+// of time for cleanup. The steps run with a context which ends reserve before the
+// deadline, and the cleanup with a context which isn't cancelled with the caller's
+// and ends at the deadline, or after reserve if there is no deadline. An error
+// wrapping ErrDeadlineBudgetExhausted is returned if no time is left for the steps.
+func newDeadlineBudget(ctx context.Context, reserve time.Duration) (*deadlineBudget, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok || reserve <= 0 {
+		cleanupCtx, cancel := context.Context(detachedContext{ctx}), func() {}
+		if reserve > 0 {
+			cleanupCtx, cancel = context.WithTimeout(cleanupCtx, reserve)
+		}
+		return &deadlineBudget{stepCtx: ctx, cleanupCtx: cleanupCtx, cancel: cancel}, nil
+	}
+
+	if remaining := time.Until(deadline); remaining <= reserve {
+		return nil, fmt.Errorf("%w: %s left, %s reserved for cleanup",
+			ErrDeadlineBudgetExhausted, remaining, reserve)
+	}
+	stepCtx, cancelStep := context.WithDeadline(ctx, deadline.Add(-reserve))
+	cleanupCtx, cancelCleanup := context.WithDeadline(detachedContext{ctx}, deadline)
+	return &deadlineBudget{
+		stepCtx:    stepCtx,
+		cleanupCtx: cleanupCtx,
+		cancel: func() {
+			cancelStep()
+			cancelCleanup()
+		},
+	}, nil
+}
+
+// checkStep returns an error wrapping ErrDeadlineBudgetExhausted if the time for
+// the steps is up. It's checked before each step, since not every backend observes
+// the context.
+func (budget *deadlineBudget) checkStep() error {
+	if err := budget.stepCtx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDeadlineBudgetExhausted, err)
+	}
+	return nil
+}
+
+// A detachedContext carries the values of its parent without its cancellation or
+// deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)           { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}                 { return nil }
+func (detachedContext) Err() error                            { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{} { return ctx.parent.Value(key) }
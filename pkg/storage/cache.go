@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	lru "github.com/hashicorp/golang-lru"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type readCacheKey struct {
+	recordType string
+	id         string
+}
+
+// A readCacheEntry is a cached record. Entries with a zero expiresAt don't expire.
+type readCacheEntry struct {
+	record    *databroker.Record
+	expiresAt time.Time
+}
+
+type readCacheBackend struct {
+	underlying Backend
+	ttl        time.Duration
+	cache      *lru.Cache
+	serveStale bool
+
+	// generation is incremented on every invalidation so that a Get which raced
+	// with a change doesn't re-populate the cache with a stale record
+	mu         sync.Mutex
+	generation uint64
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewReadCacheBackend creates a new backend which caches up to size records
+// returned by Get in-process. Cached records are invalidated whenever they change,
+// either via Put or via a change observed on the underlying backend's Sync stream.
+// As a safety net against missed invalidations, cached records are also refetched
+// once they are older than ttl. A ttl of 0 disables expiry. Reads with
+// ConsistencyStrong bypass the cache and refresh it.
+func NewReadCacheBackend(size int, ttl time.Duration, underlying Backend) (Backend, error) {
+	return newReadCacheBackend(size, ttl, false, underlying)
+}
+
+// NewStaleOnErrorReadCacheBackend creates a new read cache backend like
+// NewReadCacheBackend, except that a Get which fails with an error other than
+// ErrNotFound returns the last cached value for the record instead, if there is
+// one, even if it has expired. Such reads are reported as stale to contexts
+// created by WithStaleReadTracking. This trades consistency for availability
+// while the underlying backend is unreachable. Reads with ConsistencyStrong are
+// never served stale values.
+func NewStaleOnErrorReadCacheBackend(size int, ttl time.Duration, underlying Backend) (Backend, error) {
+	return newReadCacheBackend(size, ttl, true, underlying)
+}
+
+func newReadCacheBackend(size int, ttl time.Duration, serveStale bool, underlying Backend) (Backend, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &readCacheBackend{
+		underlying: underlying,
+		ttl:        ttl,
+		cache:      cache,
+		serveStale: serveStale,
+		cancel:     cancel,
+	}
+	go c.runInvalidator(ctx)
+	return c, nil
+}
+
+func (c *readCacheBackend) Close() error {
+	c.closeOnce.Do(c.cancel)
+	return c.underlying.Close()
+}
+
+func (c *readCacheBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	key := readCacheKey{recordType: recordType, id: id}
+	strong := GetConsistency(ctx) == ConsistencyStrong
+	v, cached := c.cache.Get(key)
+	if cached && !strong {
+		entry := v.(readCacheEntry)
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			return proto.Clone(entry.record).(*databroker.Record), nil
+		}
+	}
+
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	record, err := c.underlying.Get(ctx, recordType, id)
+	if err != nil {
+		if c.serveStale && cached && !strong && !errors.Is(err, ErrNotFound) {
+			log.Warn().Err(err).
+				Str("type", recordType).
+				Str("id", id).
+				Msg("storage: serving stale cached record after storage error")
+			markStaleRead(ctx)
+			return proto.Clone(v.(readCacheEntry).record).(*databroker.Record), nil
+		}
+		return nil, err
+	}
+
+	// deleted records are only returned to reads which include them, so they
+	// aren't cached
+	c.mu.Lock()
+	if c.generation == generation && record.GetDeletedAt() == nil {
+		c.cache.Add(key, c.newEntry(record))
+	}
+	c.mu.Unlock()
+
+	return record, nil
+}
+
+func (c *readCacheBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	return c.underlying.GetAll(ctx)
+}
+
+func (c *readCacheBackend) Put(ctx context.Context, record *databroker.Record) error {
+	err := c.underlying.Put(ctx, record)
+	c.invalidate(record.GetType(), record.GetId())
+	return err
+}
+
+func (c *readCacheBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	err := c.underlying.ReplaceAll(ctx, recordType, records)
+	// any record of the type may have been deleted
+	c.invalidateAll()
+	return err
+}
+
+func (c *readCacheBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	return c.underlying.ListRecordTypes(ctx)
+}
+
+func (c *readCacheBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	return c.underlying.Sync(ctx, version)
+}
+
+// Warmup warms up the underlying backend and then populates the cache with all
+// the records of the given types.
+func (c *readCacheBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	err := Warmup(ctx, c.underlying, recordTypes)
+	if err != nil {
+		return err
+	}
+	if len(recordTypes) == 0 {
+		return nil
+	}
+
+	lookup := make(map[string]struct{}, len(recordTypes))
+	for _, recordType := range recordTypes {
+		lookup[recordType] = struct{}{}
+	}
+
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	records, _, err := c.underlying.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		// records changed while prefetching, so they may be stale
+		return nil
+	}
+	for _, record := range records {
+		if _, ok := lookup[record.GetType()]; !ok || record.GetDeletedAt() != nil {
+			continue
+		}
+		c.cache.Add(readCacheKey{recordType: record.GetType(), id: record.GetId()}, c.newEntry(record))
+	}
+	return nil
+}
+
+func (c *readCacheBackend) newEntry(record *databroker.Record) readCacheEntry {
+	entry := readCacheEntry{record: proto.Clone(record).(*databroker.Record)}
+	if c.ttl > 0 {
+		entry.expiresAt = time.Now().Add(c.ttl)
+	}
+	return entry
+}
+
+func (c *readCacheBackend) invalidate(recordType, id string) {
+	c.mu.Lock()
+	c.generation++
+	c.cache.Remove(readCacheKey{recordType: recordType, id: id})
+	c.mu.Unlock()
+}
+
+func (c *readCacheBackend) invalidateAll() {
+	c.mu.Lock()
+	c.generation++
+	c.cache.Purge()
+	c.mu.Unlock()
+}
+
+// InvalidateCache drops the cached records of the given type and id. An empty id
+// drops every record of the type, and an empty type drops every record.
+func (c *readCacheBackend) InvalidateCache(recordType, id string) bool {
+	switch {
+	case recordType == "":
+		c.invalidateAll()
+	case id == "":
+		c.invalidateType(recordType)
+	default:
+		c.invalidate(recordType, id)
+	}
+	return true
+}
+
+func (c *readCacheBackend) invalidateType(recordType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, key := range c.cache.Keys() {
+		if key.(readCacheKey).recordType == recordType {
+			c.cache.Remove(key)
+		}
+	}
+}
+
+// expireAll expires every cached record so that it's refetched, while keeping it
+// around to be served stale if the refetch fails.
+func (c *readCacheBackend) expireAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	now := time.Now()
+	// keys are returned oldest first, so re-adding them preserves their order
+	for _, key := range c.cache.Keys() {
+		if v, ok := c.cache.Peek(key); ok {
+			entry := v.(readCacheEntry)
+			entry.expiresAt = now
+			c.cache.Add(key, entry)
+		}
+	}
+}
+
+// runInvalidator watches the underlying backend for changes and evicts any
+// changed records from the cache. Changes made by other servers sharing the same
+// storage are observed this way.
+func (c *readCacheBackend) runInvalidator(ctx context.Context) {
+	watchChanges(ctx, c.underlying, func(record *databroker.Record) {
+		c.invalidate(record.GetType(), record.GetId())
+	}, func(err error) {
+		// changes may have been missed, so nothing in the cache can be trusted
+		if c.serveStale {
+			log.Warn().Err(err).Msg("storage: read cache invalidation stream closed, expiring cache")
+			c.expireAll()
+			return
+		}
+		log.Warn().Err(err).Msg("storage: read cache invalidation stream closed, purging cache")
+		c.invalidateAll()
+	})
+}
+
+// watchChanges calls onChange for every change to records in the backend until
+// the context is done. If the change stream fails, onReset is called and the
+// stream is re-established with backoff.
+func watchChanges(
+	ctx context.Context,
+	backend Backend,
+	onChange func(record *databroker.Record),
+	onReset func(err error),
+) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+
+	var version uint64
+	for {
+		stream, err := backend.Sync(ctx, version)
+		if err == nil {
+			for stream.Next(true) {
+				record := stream.Record()
+				if record == nil {
+					continue
+				}
+				bo.Reset()
+				version = record.GetVersion()
+				onChange(record)
+			}
+			err = stream.Err()
+			_ = stream.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		onReset(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bo.NextBackOff()):
+		}
+	}
+}
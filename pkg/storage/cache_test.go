@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestReadCacheBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var getCount int64
+	m := map[string]*databroker.Record{}
+	stream := newMockRecordStream(ctx)
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = record
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			atomic.AddInt64(&getCount, 1)
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return stream, nil
+		},
+	}
+
+	c, err := NewReadCacheBackend(10, time.Minute, backend)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	data1, _ := anypb.New(wrapperspb.String("1"))
+	data2, _ := anypb.New(wrapperspb.String("2"))
+	data3, _ := anypb.New(wrapperspb.String("3"))
+	require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", Data: data1}))
+
+	record, err := c.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	assert.Equal(t, data1.Value, record.GetData().GetValue())
+	record, err = c.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	assert.Equal(t, data1.Value, record.GetData().GetValue())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&getCount), "second get should be served from the cache")
+
+	t.Run("put invalidates", func(t *testing.T) {
+		require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", Data: data2}))
+
+		record, err := c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, data2.Value, record.GetData().GetValue())
+		assert.Equal(t, int64(2), atomic.LoadInt64(&getCount))
+	})
+	t.Run("change notification invalidates", func(t *testing.T) {
+		m["1"] = &databroker.Record{Type: "TYPE", Id: "1", Data: data3}
+		stream.records <- &databroker.Record{Type: "TYPE", Id: "1", Version: 3}
+
+		assert.Eventually(t, func() bool {
+			record, err := c.Get(ctx, "TYPE", "1")
+			return err == nil && assert.ObjectsAreEqual(data3.Value, record.GetData().GetValue())
+		}, time.Second*5, time.Millisecond*10)
+	})
+	t.Run("strong consistency", func(t *testing.T) {
+		_, err := c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		before := atomic.LoadInt64(&getCount)
+
+		// the record changed in storage without an invalidation
+		m["1"] = &databroker.Record{Type: "TYPE", Id: "1", Data: data1}
+		record, err := c.Get(WithConsistency(ctx, ConsistencyStrong), "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, data1.Value, record.GetData().GetValue())
+		assert.Equal(t, before+1, atomic.LoadInt64(&getCount), "strong reads should bypass the cache")
+
+		record, err = c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, data1.Value, record.GetData().GetValue(), "strong reads should refresh the cache")
+		assert.Equal(t, before+1, atomic.LoadInt64(&getCount))
+	})
+	t.Run("ttl", func(t *testing.T) {
+		c, err := NewReadCacheBackend(10, time.Millisecond, backend)
+		require.NoError(t, err)
+		defer func() { _ = c.Close() }()
+
+		_, err = c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		before := atomic.LoadInt64(&getCount)
+
+		time.Sleep(time.Millisecond * 5)
+		_, err = c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, before+1, atomic.LoadInt64(&getCount), "expired entries should be refetched without an invalidation")
+	})
+}
+
+type mockWarmerBackend struct {
+	*mockBackend
+	warmups int64
+}
+
+func (m *mockWarmerBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	atomic.AddInt64(&m.warmups, 1)
+	return nil
+}
+
+func TestReadCacheBackendWarmup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var getCount int64
+	backend := &mockWarmerBackend{mockBackend: &mockBackend{
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			atomic.AddInt64(&getCount, 1)
+			return &databroker.Record{Type: recordType, Id: id}, nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			return []*databroker.Record{
+				{Type: "A", Id: "1"},
+				{Type: "A", Id: "2"},
+				{Type: "B", Id: "1"},
+			}, 1, nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return newMockRecordStream(ctx), nil
+		},
+	}}
+
+	c, err := NewReadCacheBackend(10, time.Minute, NewChecksumBackend(backend))
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	require.NoError(t, Warmup(ctx, c, []string{"A"}))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&backend.warmups), "underlying backend should be warmed up")
+
+	for _, id := range []string{"1", "2"} {
+		record, err := c.Get(ctx, "A", id)
+		require.NoError(t, err)
+		assert.Equal(t, id, record.GetId())
+	}
+	assert.Equal(t, int64(0), atomic.LoadInt64(&getCount), "prefetched records should be served from the cache")
+
+	_, err = c.Get(ctx, "B", "1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&getCount), "other record types should not be prefetched")
+}
+
+func TestStaleOnErrorReadCacheBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var getErr error
+	backend := &mockBackend{
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			if getErr != nil {
+				return nil, getErr
+			}
+			return &databroker.Record{Type: recordType, Id: id}, nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return newMockRecordStream(ctx), nil
+		},
+	}
+
+	c, err := NewStaleOnErrorReadCacheBackend(10, time.Millisecond, backend)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	_, err = c.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	getErr = errors.New("storage unreachable")
+	staleCtx, stale := WithStaleReadTracking(ctx)
+	record, err := c.Get(staleCtx, "TYPE", "1")
+	require.NoError(t, err, "the expired cached record should be served on error")
+	assert.Equal(t, "1", record.GetId())
+	assert.True(t, stale(), "the read should be reported as stale")
+
+	staleCtx, stale = WithStaleReadTracking(ctx)
+	_, err = c.Get(staleCtx, "TYPE", "2")
+	assert.ErrorIs(t, err, getErr, "records which were never cached should fail")
+	assert.False(t, stale())
+
+	_, err = c.Get(WithConsistency(ctx, ConsistencyStrong), "TYPE", "1")
+	assert.ErrorIs(t, err, getErr, "strong reads should never be served stale")
+
+	getErr = ErrNotFound
+	_, err = c.Get(ctx, "TYPE", "1")
+	assert.ErrorIs(t, err, ErrNotFound, "records which were not found should not be served stale")
+}
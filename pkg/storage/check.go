@@ -0,0 +1,89 @@
+package storage
+
+import "context"
+
+// A Checker is a Backend which can check that its storage is reachable, for
+// example by running a lightweight query over its connections.
+type Checker interface {
+	// Check returns an error if the storage can't be reached. It returns when the
+	// context is done rather than waiting on a dead connection.
+	Check(ctx context.Context) error
+}
+
+// Check checks that the backend's storage is reachable if it supports it.
+func Check(ctx context.Context, backend Backend) error {
+	c, ok := backend.(Checker)
+	if !ok {
+		return nil
+	}
+	return c.Check(ctx)
+}
+
+// Check checks each of the backends records are routed to. It returns the error
+// of the first of them which can't be reached.
+func (backend *routedBackend) Check(ctx context.Context) error {
+	for _, b := range backend.backends {
+		if err := Check(ctx, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checksumBackend) Check(ctx context.Context) error {
+	return Check(ctx, c.underlying)
+}
+
+func (backend *signedBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.underlying)
+}
+
+func (e *encryptedBackend) Check(ctx context.Context) error {
+	return Check(ctx, e.underlying)
+}
+
+func (e *expiryBackend) Check(ctx context.Context) error {
+	return Check(ctx, e.Backend)
+}
+
+func (c *negativeCacheBackend) Check(ctx context.Context) error {
+	return Check(ctx, c.Backend)
+}
+
+func (backend *deletedGracePeriodBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (c *readCacheBackend) Check(ctx context.Context) error {
+	return Check(ctx, c.underlying)
+}
+
+func (backend *statementTimeoutBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (backend *slowOperationLogBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (backend *recordAgeSamplerBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (backend *concurrencyLimitBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (backend *retentionBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+func (backend *tracingBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.Backend)
+}
+
+// Check checks the current backend. The watchdog reconnects a backend which
+// keeps timing out on its own, so checking doesn't count towards that.
+func (backend *watchdogBackend) Check(ctx context.Context) error {
+	return Check(ctx, backend.get())
+}
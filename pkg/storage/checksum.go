@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// ErrCorrupted indicates that a record's data does not match its stored checksum.
+var ErrCorrupted = errors.New("record corrupted")
+
+type checksumRecordStream struct {
+	underlying RecordStream
+	err        error
+}
+
+func (c *checksumRecordStream) Close() error {
+	return c.underlying.Close()
+}
+
+// Next stops the stream after a record failed checksum verification, so that
+// Err returns ErrCorrupted rather than the stream skipping the record.
+func (c *checksumRecordStream) Next(wait bool) bool {
+	return c.err == nil && c.underlying.Next(wait)
+}
+
+func (c *checksumRecordStream) Record() *databroker.Record {
+	r := c.underlying.Record()
+	if r != nil {
+		if err := verifyChecksum(context.Background(), r); err != nil {
+			c.err = err
+			return nil
+		}
+	}
+	return r
+}
+
+func (c *checksumRecordStream) Err() error {
+	if c.err == nil {
+		c.err = c.underlying.Err()
+	}
+	return c.err
+}
+
+type checksumBackend struct {
+	underlying Backend
+}
+
+// NewChecksumBackend creates a new backend which stores a checksum of each record's
+// data and verifies it when the record is read back. This detects corruption in the
+// underlying storage.
+func NewChecksumBackend(underlying Backend) Backend {
+	return &checksumBackend{
+		underlying: underlying,
+	}
+}
+
+func (c *checksumBackend) Close() error {
+	return c.underlying.Close()
+}
+
+func (c *checksumBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	record, err := c.underlying.Get(ctx, recordType, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (c *checksumBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	records, version, err := c.underlying.GetAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, record := range records {
+		if err := verifyChecksum(ctx, record); err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, version, nil
+}
+
+func (c *checksumBackend) Put(ctx context.Context, record *databroker.Record) error {
+	record.Checksum = ComputeChecksum(record)
+	return c.underlying.Put(ctx, record)
+}
+
+func (c *checksumBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	for _, record := range records {
+		record.Checksum = ComputeChecksum(record)
+	}
+	return c.underlying.ReplaceAll(ctx, recordType, records)
+}
+
+func (c *checksumBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	return c.underlying.ListRecordTypes(ctx)
+}
+
+func (c *checksumBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	stream, err := c.underlying.Sync(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumRecordStream{
+		underlying: stream,
+	}, nil
+}
+
+// ComputeChecksum returns a SHA-256 checksum of a record's data. Records with
+// byte-identical data have the same checksum.
+func ComputeChecksum(record *databroker.Record) []byte {
+	h := sha256.New()
+	_, _ = h.Write([]byte(record.GetData().GetTypeUrl()))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(record.GetData().GetValue())
+	return h.Sum(nil)
+}
+
+func verifyChecksum(ctx context.Context, record *databroker.Record) error {
+	// records written before checksums were introduced won't have one
+	if len(record.GetChecksum()) == 0 {
+		return nil
+	}
+
+	if subtle.ConstantTimeCompare(record.GetChecksum(), ComputeChecksum(record)) != 1 {
+		metrics.RecordStorageCorruption(ctx)
+		return ErrCorrupted
+	}
+	return nil
+}
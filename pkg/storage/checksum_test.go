@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestChecksumBackend(t *testing.T) {
+	ctx := context.Background()
+
+	m := map[string]*databroker.Record{}
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = proto.Clone(record).(*databroker.Record)
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return proto.Clone(record).(*databroker.Record), nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			var records []*databroker.Record
+			for _, record := range m {
+				records = append(records, proto.Clone(record).(*databroker.Record))
+			}
+			return records, 0, nil
+		},
+	}
+
+	c := NewChecksumBackend(backend)
+
+	any, _ := anypb.New(wrapperspb.String("HELLO WORLD"))
+	require.NoError(t, c.Put(ctx, &databroker.Record{
+		Id:   "TEST-1",
+		Data: any,
+	}))
+	assert.NotEmpty(t, m["TEST-1"].GetChecksum(), "checksum should be stored")
+
+	record, err := c.Get(ctx, "", "TEST-1")
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(any, record.GetData()))
+
+	t.Run("last writer", func(t *testing.T) {
+		record := &databroker.Record{Id: "TEST-1", Data: any}
+		expect := ComputeChecksum(record)
+		record.LastWriter = &databroker.RecordWriter{InstallationId: "INSTALLATION-1", Actor: "ACTOR-1"}
+		assert.Equal(t, expect, ComputeChecksum(record), "last writer should not affect the checksum")
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		m["TEST-1"].Data.Value[len(m["TEST-1"].Data.Value)-1] ^= 0xff
+
+		_, err := c.Get(ctx, "", "TEST-1")
+		assert.ErrorIs(t, err, ErrCorrupted)
+
+		_, _, err = c.GetAll(ctx)
+		assert.ErrorIs(t, err, ErrCorrupted)
+	})
+	t.Run("no checksum", func(t *testing.T) {
+		m["TEST-2"] = &databroker.Record{Id: "TEST-2", Data: any}
+
+		_, err := c.Get(ctx, "", "TEST-2")
+		assert.NoError(t, err)
+	})
+}
+
+type sliceRecordStream struct {
+	records []*databroker.Record
+	record  *databroker.Record
+}
+
+func (s *sliceRecordStream) Close() error { return nil }
+
+func (s *sliceRecordStream) Next(_ bool) bool {
+	if len(s.records) == 0 {
+		return false
+	}
+	s.record, s.records = s.records[0], s.records[1:]
+	return true
+}
+
+func (s *sliceRecordStream) Record() *databroker.Record { return s.record }
+
+func (s *sliceRecordStream) Err() error { return nil }
+
+func TestChecksumRecordStream(t *testing.T) {
+	ctx := context.Background()
+
+	var records []*databroker.Record
+	for i := 1; i <= 3; i++ {
+		any, _ := anypb.New(wrapperspb.Int64(int64(i)))
+		record := &databroker.Record{Version: uint64(i), Id: fmt.Sprint(i), Data: any}
+		record.Checksum = ComputeChecksum(record)
+		records = append(records, record)
+	}
+	// corrupt the record in the middle of the stream
+	records[1].Data.Value[len(records[1].Data.Value)-1] ^= 0xff
+
+	c := NewChecksumBackend(&mockBackend{
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return &sliceRecordStream{records: records}, nil
+		},
+	})
+	stream, err := c.Sync(ctx, 0)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var versions []uint64
+	for stream.Next(false) {
+		if record := stream.Record(); record != nil {
+			versions = append(versions, record.GetVersion())
+		}
+	}
+	assert.Equal(t, []uint64{1}, versions, "the stream should stop at the corrupted record")
+	assert.ErrorIs(t, stream.Err(), ErrCorrupted)
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type concurrencyLimitBackend struct {
+	Backend
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inFlight int64
+	queued   int64
+}
+
+// NewConcurrencyLimitBackend creates a new backend which limits the number of
+// operations on the underlying backend in flight at once to max. Operations beyond
+// the limit are queued until a slot is free, or their context is done. Sync
+// streams only hold a slot while they're being opened. The number of operations
+// in flight and queued are recorded in the storage_operations_in_flight and
+// storage_operations_queued metrics.
+func NewConcurrencyLimitBackend(max int, underlying Backend) Backend {
+	return &concurrencyLimitBackend{
+		Backend: underlying,
+		slots:   make(chan struct{}, max),
+	}
+}
+
+func (backend *concurrencyLimitBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return backend.Backend.Get(ctx, recordType, id)
+}
+
+func (backend *concurrencyLimitBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	return backend.Backend.GetAll(ctx)
+}
+
+func (backend *concurrencyLimitBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return StreamAll(ctx, backend.Backend, batchSize, fn)
+}
+
+func (backend *concurrencyLimitBackend) Put(ctx context.Context, record *databroker.Record) error {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return backend.Backend.Put(ctx, record)
+}
+
+func (backend *concurrencyLimitBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return backend.Backend.ReplaceAll(ctx, recordType, records)
+}
+
+func (backend *concurrencyLimitBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return backend.Backend.Sync(ctx, version)
+}
+
+func (backend *concurrencyLimitBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	release, err := backend.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return backend.Backend.ListRecordTypes(ctx)
+}
+
+// acquire waits for a free slot. The returned function must be called to free it
+// once the operation completes.
+func (backend *concurrencyLimitBackend) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case backend.slots <- struct{}{}:
+	default:
+		backend.update(0, 1)
+		select {
+		case backend.slots <- struct{}{}:
+			backend.update(0, -1)
+		case <-ctx.Done():
+			backend.update(0, -1)
+			return nil, ctx.Err()
+		}
+	}
+	backend.update(1, 0)
+	return func() {
+		<-backend.slots
+		backend.update(-1, 0)
+	}, nil
+}
+
+func (backend *concurrencyLimitBackend) update(inFlight, queued int64) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	backend.inFlight += inFlight
+	backend.queued += queued
+	metrics.SetStorageConcurrentOperations(context.Background(), backend.inFlight, backend.queued)
+}
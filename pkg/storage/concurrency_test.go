@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestConcurrencyLimitBackend(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	var inFlight, maxInFlight int32
+	unblock := make(chan struct{})
+	backend := NewConcurrencyLimitBackend(3, &mockBackend{
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			select {
+			case <-unblock:
+			case <-time.After(time.Millisecond):
+			}
+			return &databroker.Record{Type: recordType, Id: id}, nil
+		},
+	})
+
+	var wg sync.WaitGroup
+	var completed int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := backend.Get(ctx, "TYPE", "1"); assert.NoError(t, err) {
+				atomic.AddInt32(&completed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(20), completed, "all operations should eventually complete")
+	assert.LessOrEqual(t, maxInFlight, int32(3), "operations in flight should never exceed the limit")
+
+	t.Run("canceled while queued", func(t *testing.T) {
+		started := make(chan struct{})
+		backend := NewConcurrencyLimitBackend(1, &mockBackend{
+			get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+				close(started)
+				<-unblock
+				return &databroker.Record{Type: recordType, Id: id}, nil
+			},
+		})
+		go func() { _, _ = backend.Get(ctx, "TYPE", "1") }()
+		<-started
+
+		queuedCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+		defer cancel()
+		_, err := backend.Get(queuedCtx, "TYPE", "2")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		close(unblock)
+	})
+}
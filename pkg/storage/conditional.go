@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type expectedVersionKey struct{}
+
+type expectedVersion struct {
+	recordType, id string
+	version        uint64
+}
+
+// WithExpectedVersion returns a new context whose Put of the given record, such
+// as a delete, is only applied if the record is at the expected version. Backends
+// which support it compare the version atomically with the Put, and fail it with
+// an error wrapping ErrVersionConflict. Other writes made with the context, such
+// as cascaded deletes, aren't affected.
+func WithExpectedVersion(ctx context.Context, recordType, id string, version uint64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, expectedVersion{recordType: recordType, id: id, version: version})
+}
+
+// CheckExpectedVersion returns an error wrapping ErrVersionConflict if the context
+// expects the given record to be at a different version than the current one. A
+// nil current record doesn't exist, or was deleted.
+func CheckExpectedVersion(ctx context.Context, record, current *databroker.Record) error {
+	expected, ok := ctx.Value(expectedVersionKey{}).(expectedVersion)
+	if !ok || expected.recordType != record.GetType() || expected.id != record.GetId() {
+		return nil
+	}
+	if current == nil || current.GetDeletedAt() != nil {
+		return fmt.Errorf("%w: %s/%s doesn't exist, expected version %d",
+			ErrVersionConflict, record.GetType(), record.GetId(), expected.version)
+	}
+	if current.GetVersion() != expected.version {
+		return fmt.Errorf("%w: %s/%s is at version %d, expected version %d",
+			ErrVersionConflict, record.GetType(), record.GetId(), current.GetVersion(), expected.version)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// Consistency is the consistency required of a read.
+type Consistency int
+
+const (
+	// ConsistencyDefault allows reads to be served from caches, which may lag
+	// behind the underlying storage.
+	ConsistencyDefault Consistency = iota
+	// ConsistencyStrong requires reads to bypass any caches and be served by the
+	// underlying storage.
+	ConsistencyStrong
+)
+
+type consistencyKey struct{}
+
+// WithConsistency returns a new context which overrides the consistency of the
+// reads made with it.
+func WithConsistency(ctx context.Context, consistency Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, consistency)
+}
+
+// GetConsistency returns the consistency required by the context.
+func GetConsistency(ctx context.Context) Consistency {
+	consistency, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return consistency
+}
+
+type includeDeletedKey struct{}
+
+// WithIncludeDeleted returns a new context whose reads of a single record also
+// return the record if it was deleted, flagged as deleted, for as long as the
+// storage keeps it.
+func WithIncludeDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// GetIncludeDeleted returns true if the context's reads should include deleted
+// records.
+func GetIncludeDeleted(ctx context.Context) bool {
+	includeDeleted, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return includeDeleted
+}
+
+type preserveModifiedAtKey struct{}
+
+// WithPreserveModifiedAt returns a new context whose writes keep the modification
+// time set on the records, rather than setting it to the time of the write, so
+// that restored records and changes keep their place in the retention of the
+// changes. Records without a modification time are still set to the time of the
+// write.
+func WithPreserveModifiedAt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, preserveModifiedAtKey{}, true)
+}
+
+// GetPreserveModifiedAt returns the modification time to set on a record written
+// with the context: the record's own if the context preserves it, or else now.
+func GetPreserveModifiedAt(ctx context.Context, record *databroker.Record) *timestamppb.Timestamp {
+	if preserve, _ := ctx.Value(preserveModifiedAtKey{}).(bool); preserve && record.GetModifiedAt() != nil {
+		return record.GetModifiedAt()
+	}
+	return timestamppb.Now()
+}
+
+type staleReadKey struct{}
+
+// WithStaleReadTracking returns a new context which tracks whether any of the
+// reads made with it were served a stale cached value, and a function which
+// reports whether they were.
+func WithStaleReadTracking(ctx context.Context) (context.Context, func() bool) {
+	stale := new(int32)
+	return context.WithValue(ctx, staleReadKey{}, stale), func() bool {
+		return atomic.LoadInt32(stale) == 1
+	}
+}
+
+// markStaleRead records that a read made with the context was served stale.
+func markStaleRead(ctx context.Context) {
+	if stale, ok := ctx.Value(staleReadKey{}).(*int32); ok {
+		atomic.StoreInt32(stale, 1)
+	}
+}
+
+// WaitForVersion waits until the reads from the backend reflect at least the
+// given record version, which is the case once the change at that version, or a
+// later one, shows in the backend's change log. It only waits for backends which
+// read from a replica or cache which lags behind the writes, until ctx is done.
+func WaitForVersion(ctx context.Context, backend Backend, version uint64) error {
+	if version == 0 {
+		return nil
+	}
+
+	stream, err := backend.Sync(ctx, version-1)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+
+	if stream.Next(true) {
+		return nil
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -3,18 +3,28 @@ package storage
 import (
 	"context"
 	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
 
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
+// ErrVerificationFailed indicates that a record's data could not be verified with
+// the current key, either because it was written with a different key or because
+// it was tampered with.
+var ErrVerificationFailed = errors.New("record failed signature verification")
+
 type encryptedRecordStream struct {
 	underlying RecordStream
-	backend    *encryptedBackend
+	decrypt    func(ctx context.Context, record *databroker.Record) (*databroker.Record, error)
 	err        error
 }
 
@@ -30,7 +40,7 @@ func (e *encryptedRecordStream) Record() *databroker.Record {
 	r := e.underlying.Record()
 	if r != nil {
 		var err error
-		r, err = e.backend.decryptRecord(r)
+		r, err = e.decrypt(context.Background(), r)
 		if err != nil {
 			e.err = err
 		}
@@ -45,22 +55,133 @@ func (e *encryptedRecordStream) Err() error {
 	return e.err
 }
 
+// A SecretRotator is a Backend which encrypts records with a secret which can be
+// rotated in place, without recreating the backend, so that open Sync streams
+// carry on across the rotation.
+type SecretRotator interface {
+	// RotateSecret sets the secret records are encrypted with. The previous
+	// secrets are only used to decrypt records written with them before the
+	// rotation.
+	RotateSecret(secret []byte, previousSecrets [][]byte) error
+}
+
+// secretCiphers are the ciphers of the current secret and of the previous
+// secrets, which together are the keys records are verified with.
+type secretCiphers struct {
+	current  cipher.AEAD
+	previous []cipher.AEAD
+}
+
+func newSecretCiphers(secret []byte, previousSecrets [][]byte) (*secretCiphers, error) {
+	current, err := cryptutil.NewAEADCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	ciphers := &secretCiphers{current: current}
+	for _, previousSecret := range previousSecrets {
+		c, err := cryptutil.NewAEADCipher(previousSecret)
+		if err != nil {
+			return nil, err
+		}
+		ciphers.previous = append(ciphers.previous, c)
+	}
+	return ciphers, nil
+}
+
+// decrypt decrypts the ciphertext with the current secret, or else with the first
+// of the previous secrets it was encrypted with. The error from the current
+// secret is returned if none of them match.
+func (ciphers *secretCiphers) decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	plaintext, err := cryptutil.Decrypt(ciphers.current, ciphertext, additionalData)
+	if err == nil {
+		return plaintext, nil
+	}
+	for _, c := range ciphers.previous {
+		if plaintext, previousErr := cryptutil.Decrypt(c, ciphertext, additionalData); previousErr == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, err
+}
+
 type encryptedBackend struct {
 	underlying Backend
-	cipher     cipher.AEAD
+	// secrets holds the *secretCiphers, which are replaced when the secret is
+	// rotated
+	secrets atomic.Value
+
+	// typeKeyIDs are the ids of the current keys of the record types with keys
+	// of their own, and keyCiphers the ciphers of every key by id
+	typeKeyIDs map[string]string
+	keyCiphers map[string]cipher.AEAD
 }
 
 // NewEncryptedBackend creates a new encrypted backend.
 func NewEncryptedBackend(secret []byte, underlying Backend) (Backend, error) {
-	c, err := cryptutil.NewAEADCipher(secret)
+	return NewTypeKeyEncryptedBackend(secret, nil, underlying)
+}
+
+// NewTypeKeyEncryptedBackend creates a new encrypted backend which encrypts the
+// records of the types in typeKeys with a key derived from the last of the type's
+// keys, rather than the secret. The earlier keys are only used to decrypt records
+// written before the type's key was rotated. Records of the other types are
+// encrypted with the secret. The stored data identifies the key it was encrypted
+// with, so that records can always be decrypted while their key is configured.
+func NewTypeKeyEncryptedBackend(secret []byte, typeKeys map[string][][]byte, underlying Backend) (Backend, error) {
+	return newEncryptedBackend(secret, typeKeys, underlying)
+}
+
+func newEncryptedBackend(secret []byte, typeKeys map[string][][]byte, underlying Backend) (*encryptedBackend, error) {
+	secrets, err := newSecretCiphers(secret, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return &encryptedBackend{
+	e := &encryptedBackend{
 		underlying: underlying,
-		cipher:     c,
-	}, nil
+		typeKeyIDs: make(map[string]string, len(typeKeys)),
+		keyCiphers: make(map[string]cipher.AEAD),
+	}
+	e.secrets.Store(secrets)
+	for recordType, keys := range typeKeys {
+		for _, key := range keys {
+			derived := deriveTypeKey(recordType, key)
+			c, err := cryptutil.NewAEADCipher(derived)
+			if err != nil {
+				return nil, err
+			}
+			keyID := typeKeyID(recordType, derived)
+			e.keyCiphers[keyID] = c
+			e.typeKeyIDs[recordType] = keyID
+		}
+	}
+	return e, nil
+}
+
+// deriveTypeKey derives the key used to encrypt the records of a type from one
+// of its configured keys.
+func deriveTypeKey(recordType string, key []byte) []byte {
+	return cryptutil.Hash("databroker record type encryption key: "+recordType, key)
+}
+
+// typeKeyID identifies a derived key without revealing it.
+func typeKeyID(recordType string, derived []byte) string {
+	return recordType + ":" + hex.EncodeToString(cryptutil.Hash("databroker record type encryption key id", derived)[:8])
+}
+
+// RotateSecret rotates the secret in place. Records being read concurrently are
+// decrypted with either the old or the new secrets.
+func (e *encryptedBackend) RotateSecret(secret []byte, previousSecrets [][]byte) error {
+	secrets, err := newSecretCiphers(secret, previousSecrets)
+	if err != nil {
+		return err
+	}
+	e.secrets.Store(secrets)
+	return nil
+}
+
+func (e *encryptedBackend) getSecrets() *secretCiphers {
+	return e.secrets.Load().(*secretCiphers)
 }
 
 func (e *encryptedBackend) Close() error {
@@ -72,7 +193,7 @@ func (e *encryptedBackend) Get(ctx context.Context, recordType, id string) (*dat
 	if err != nil {
 		return nil, err
 	}
-	record, err = e.decryptRecord(record)
+	record, err = e.decryptRecord(ctx, record)
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +206,7 @@ func (e *encryptedBackend) GetAll(ctx context.Context) ([]*databroker.Record, ui
 		return nil, 0, err
 	}
 	for i := range records {
-		records[i], err = e.decryptRecord(records[i])
+		records[i], err = e.decryptRecord(ctx, records[i])
 		if err != nil {
 			return nil, 0, err
 		}
@@ -94,7 +215,7 @@ func (e *encryptedBackend) GetAll(ctx context.Context) ([]*databroker.Record, ui
 }
 
 func (e *encryptedBackend) Put(ctx context.Context, record *databroker.Record) error {
-	encrypted, err := e.encrypt(record.GetData())
+	encrypted, err := e.encrypt(record.GetType(), record.GetData())
 	if err != nil {
 		return err
 	}
@@ -105,6 +226,25 @@ func (e *encryptedBackend) Put(ctx context.Context, record *databroker.Record) e
 	return e.underlying.Put(ctx, newRecord)
 }
 
+func (e *encryptedBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	newRecords := make([]*databroker.Record, len(records))
+	for i, record := range records {
+		encrypted, err := e.encrypt(record.GetType(), record.GetData())
+		if err != nil {
+			return err
+		}
+
+		newRecords[i] = proto.Clone(record).(*databroker.Record)
+		newRecords[i].Data = encrypted
+	}
+
+	return e.underlying.ReplaceAll(ctx, recordType, newRecords)
+}
+
+func (e *encryptedBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	return e.underlying.ListRecordTypes(ctx)
+}
+
 func (e *encryptedBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
 	stream, err := e.underlying.Sync(ctx, version)
 	if err != nil {
@@ -112,23 +252,29 @@ func (e *encryptedBackend) Sync(ctx context.Context, version uint64) (RecordStre
 	}
 	return &encryptedRecordStream{
 		underlying: stream,
-		backend:    e,
+		decrypt:    e.decryptRecord,
 	}, nil
 }
 
-func (e *encryptedBackend) decryptRecord(in *databroker.Record) (out *databroker.Record, err error) {
+func (e *encryptedBackend) decryptRecord(ctx context.Context, in *databroker.Record) (out *databroker.Record, err error) {
 	data, err := e.decrypt(in.Data)
+	if errors.Is(err, ErrVerificationFailed) {
+		metrics.RecordDataBrokerSignatureVerifyFailure(ctx, in.GetType())
+	}
 	if err != nil {
 		return nil, err
 	}
 	// Create a new record so that we don't re-use any internal state
 	return &databroker.Record{
-		Version:    in.Version,
-		Type:       data.TypeUrl,
-		Id:         in.Id,
-		Data:       data,
-		ModifiedAt: in.ModifiedAt,
-		DeletedAt:  in.DeletedAt,
+		Version:       in.Version,
+		Type:          data.TypeUrl,
+		Id:            in.Id,
+		Data:          data,
+		ModifiedAt:    in.ModifiedAt,
+		DeletedAt:     in.DeletedAt,
+		SchemaVersion: in.SchemaVersion,
+		Signature:     in.Signature,
+		LastWriter:    in.LastWriter,
 	}, nil
 }
 
@@ -137,15 +283,30 @@ func (e *encryptedBackend) decrypt(in *anypb.Any) (out *anypb.Any, err error) {
 		return nil, nil
 	}
 
-	var encrypted wrapperspb.BytesValue
-	err = in.UnmarshalTo(&encrypted)
-	if err != nil {
-		return nil, err
-	}
+	var plaintext []byte
+	if in.MessageIs((*databroker.EncryptedData)(nil)) {
+		var encrypted databroker.EncryptedData
+		err = in.UnmarshalTo(&encrypted)
+		if err != nil {
+			return nil, err
+		}
 
-	plaintext, err := cryptutil.Decrypt(e.cipher, encrypted.Value, nil)
+		c, ok := e.keyCiphers[encrypted.GetKeyId()]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown key %s", ErrVerificationFailed, encrypted.GetKeyId())
+		}
+		plaintext, err = cryptutil.Decrypt(c, encrypted.GetCiphertext(), []byte(encrypted.GetKeyId()))
+	} else {
+		var encrypted wrapperspb.BytesValue
+		err = in.UnmarshalTo(&encrypted)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err = e.getSecrets().decrypt(encrypted.Value, nil)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
 	}
 
 	out = new(anypb.Any)
@@ -157,13 +318,21 @@ func (e *encryptedBackend) decrypt(in *anypb.Any) (out *anypb.Any, err error) {
 	return out, nil
 }
 
-func (e *encryptedBackend) encrypt(in *anypb.Any) (out *anypb.Any, err error) {
+func (e *encryptedBackend) encrypt(recordType string, in *anypb.Any) (out *anypb.Any, err error) {
 	plaintext, err := proto.Marshal(in)
 	if err != nil {
 		return nil, err
 	}
 
-	encrypted := cryptutil.Encrypt(e.cipher, plaintext, nil)
+	// bind the ciphertext to its key id, so the id can't be swapped for another
+	if keyID, ok := e.typeKeyIDs[recordType]; ok {
+		return anypb.New(&databroker.EncryptedData{
+			KeyId:      keyID,
+			Ciphertext: cryptutil.Encrypt(e.keyCiphers[keyID], plaintext, []byte(keyID)),
+		})
+	}
+
+	encrypted := cryptutil.Encrypt(e.getSecrets().current, plaintext, nil)
 
 	out, err = anypb.New(&wrapperspb.BytesValue{
 		Value: encrypted,
@@ -4,11 +4,16 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
@@ -82,3 +87,179 @@ func TestEncryptedBackend(t *testing.T) {
 		assert.Equal(t, any.TypeUrl, records[0].Type, "record type should be preserved")
 	}
 }
+
+func TestEncryptedBackendVerificationFailure(t *testing.T) {
+	ctx := context.Background()
+
+	view.Unregister(metrics.DataBrokerSignatureVerifyFailuresView)
+	require.NoError(t, view.Register(metrics.DataBrokerSignatureVerifyFailuresView))
+	defer view.Unregister(metrics.DataBrokerSignatureVerifyFailuresView)
+
+	m := map[string]*databroker.Record{}
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = record
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+	}
+
+	// the record is written with a key which is no longer in use
+	oldKey, err := NewEncryptedBackend(cryptutil.NewKey(), backend)
+	require.NoError(t, err)
+	any, _ := anypb.New(wrapperspb.String("HELLO WORLD"))
+	require.NoError(t, oldKey.Put(ctx, &databroker.Record{Type: any.TypeUrl, Id: "TEST-1", Data: any}))
+
+	newKey, err := NewEncryptedBackend(cryptutil.NewKey(), backend)
+	require.NoError(t, err)
+	_, err = newKey.Get(ctx, any.TypeUrl, "TEST-1")
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+
+	rows, err := view.RetrieveData(metrics.DataBrokerSignatureVerifyFailuresView.Name)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Contains(t, rows[0].Tags, tag.Tag{Key: metrics.TagKeyStorageRecordType, Value: any.TypeUrl})
+	assert.Equal(t, int64(1), rows[0].Data.(*view.CountData).Value)
+}
+
+func TestTypeKeyEncryptedBackend(t *testing.T) {
+	ctx := context.Background()
+
+	m := map[string]*databroker.Record{}
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetType()+"/"+record.GetId()] = record
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[recordType+"/"+id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+	}
+
+	secret, sessionKey, userKey := cryptutil.NewKey(), cryptutil.NewKey(), cryptutil.NewKey()
+	e, err := NewTypeKeyEncryptedBackend(secret, map[string][][]byte{
+		"SESSION": {sessionKey},
+		"USER":    {userKey},
+	}, backend)
+	require.NoError(t, err)
+
+	for _, recordType := range []string{"SESSION", "USER", "OTHER"} {
+		data, err := anypb.New(wrapperspb.String(recordType + " DATA"))
+		require.NoError(t, err)
+		require.NoError(t, e.Put(ctx, &databroker.Record{Type: recordType, Id: "1", Data: data}))
+	}
+
+	keyID := func(recordType string) string {
+		var encrypted databroker.EncryptedData
+		if m[recordType+"/1"].GetData().UnmarshalTo(&encrypted) != nil {
+			return ""
+		}
+		return encrypted.GetKeyId()
+	}
+	assert.NotEmpty(t, keyID("SESSION"))
+	assert.NotEmpty(t, keyID("USER"))
+	assert.NotEqual(t, keyID("SESSION"), keyID("USER"), "should encrypt each type with its own key")
+	assert.Empty(t, keyID("OTHER"), "should encrypt other types with the shared key")
+
+	getString := func(e Backend, recordType string) (string, error) {
+		record, err := e.Get(ctx, recordType, "1")
+		if err != nil {
+			return "", err
+		}
+		var value wrapperspb.StringValue
+		require.NoError(t, record.GetData().UnmarshalTo(&value))
+		return value.GetValue(), nil
+	}
+	for _, recordType := range []string{"SESSION", "USER", "OTHER"} {
+		value, err := getString(e, recordType)
+		assert.NoError(t, err)
+		assert.Equal(t, recordType+" DATA", value)
+	}
+
+	t.Run("rotated", func(t *testing.T) {
+		rotated, err := NewTypeKeyEncryptedBackend(secret, map[string][][]byte{
+			"SESSION": {sessionKey, cryptutil.NewKey()},
+		}, backend)
+		require.NoError(t, err)
+
+		value, err := getString(rotated, "SESSION")
+		assert.NoError(t, err, "should decrypt records written with the previous key")
+		assert.Equal(t, "SESSION DATA", value)
+
+		_, err = getString(rotated, "USER")
+		assert.ErrorIs(t, err, ErrVerificationFailed, "should not decrypt records without their key")
+	})
+}
+
+func TestEncryptedBackendRotateSecret(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	view.Unregister(metrics.DataBrokerSignatureVerifyFailuresView)
+	require.NoError(t, view.Register(metrics.DataBrokerSignatureVerifyFailuresView))
+	defer view.Unregister(metrics.DataBrokerSignatureVerifyFailuresView)
+
+	stream := newMockRecordStream(ctx)
+	stream.records = make(chan *databroker.Record, 10)
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			stream.records <- record
+			return nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return stream, nil
+		},
+	}
+
+	oldSecret, newSecret := cryptutil.NewKey(), cryptutil.NewKey()
+	e, err := NewEncryptedBackend(oldSecret, backend)
+	require.NoError(t, err)
+	s, err := e.Sync(ctx, 0)
+	require.NoError(t, err)
+
+	put := func(t *testing.T, id string) {
+		data, err := anypb.New(wrapperspb.String("DATA " + id))
+		require.NoError(t, err)
+		require.NoError(t, e.Put(ctx, &databroker.Record{Type: data.TypeUrl, Id: id, Data: data}))
+	}
+	next := func(t *testing.T) string {
+		require.True(t, s.Next(true))
+		record := s.Record()
+		require.NoError(t, s.Err())
+		var value wrapperspb.StringValue
+		require.NoError(t, record.GetData().UnmarshalTo(&value))
+		return value.GetValue()
+	}
+
+	put(t, "1")
+	assert.Equal(t, "DATA 1", next(t))
+
+	// a change written with the old secret is still in flight when it's rotated
+	put(t, "2")
+	require.NoError(t, e.(SecretRotator).RotateSecret(newSecret, [][]byte{oldSecret}))
+	put(t, "3")
+	assert.Equal(t, "DATA 2", next(t), "changes written with the previous secret should be delivered")
+	assert.Equal(t, "DATA 3", next(t), "changes written with the new secret should be delivered")
+
+	rows, err := view.RetrieveData(metrics.DataBrokerSignatureVerifyFailuresView.Name)
+	require.NoError(t, err)
+	assert.Empty(t, rows, "no records should fail verification")
+
+	t.Run("without previous secret", func(t *testing.T) {
+		put(t, "4")
+		require.NoError(t, e.(SecretRotator).RotateSecret(cryptutil.NewKey(), nil))
+		require.True(t, s.Next(true))
+		s.Record()
+		assert.ErrorIs(t, s.Err(), ErrVerificationFailed)
+	})
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+// ErrorClass returns the class of a storage error, for the error_class label of
+// operation metrics. It returns "" for a nil error.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrVersionConflict):
+		return "conflict"
+	case errors.Is(err, ErrCorrupted), errors.Is(err, ErrVerificationFailed):
+		return "corrupted"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrDeadlineBudgetExhausted):
+		return "timeout"
+	default:
+		return metrics.StorageErrorClassOther
+	}
+}
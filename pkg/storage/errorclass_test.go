@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		expect string
+	}{
+		{nil, ""},
+		{ErrNotFound, "not_found"},
+		{fmt.Errorf("get: %w", ErrNotFound), "not_found"},
+		{ErrVersionConflict, "conflict"},
+		{ErrCorrupted, "corrupted"},
+		{ErrUnsupported, "unsupported"},
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "timeout"},
+		{ErrDeadlineBudgetExhausted, "timeout"},
+		{errors.New("connection refused"), "other"},
+	} {
+		assert.Equal(t, tc.expect, ErrorClass(tc.err), "%v", tc.err)
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// expiresAtFieldName is the name of the top-level timestamp field used to
+// determine when a record expires.
+const expiresAtFieldName = "expires_at"
+
+type expiryBackend struct {
+	Backend
+	skewTolerance time.Duration
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewExpiryBackend creates a new backend which periodically scans the underlying
+// backend for records whose embedded `expires_at` timestamp has passed and deletes
+// them. This is intended for backends without native per-record expiry.
+func NewExpiryBackend(interval time.Duration, underlying Backend) Backend {
+	return NewExpiryBackendWithSkewTolerance(interval, 0, underlying)
+}
+
+// NewExpiryBackendWithSkewTolerance creates a new expiry backend like
+// NewExpiryBackend, except that records are only deleted once they expired more
+// than the skew tolerance ago, so that records aren't deleted prematurely by a
+// node whose clock is ahead of the clock of the node which set their expiry.
+func NewExpiryBackendWithSkewTolerance(interval, skewTolerance time.Duration, underlying Backend) Backend {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &expiryBackend{
+		Backend:       underlying,
+		skewTolerance: skewTolerance,
+		cancel:        cancel,
+	}
+	go backend.run(ctx, interval)
+	return backend
+}
+
+func (backend *expiryBackend) Close() error {
+	backend.closeOnce.Do(backend.cancel)
+	return backend.Backend.Close()
+}
+
+func (backend *expiryBackend) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := backend.scan(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("storage: error scanning for expired records")
+		}
+	}
+}
+
+// scan deletes any records which expired before now, less the skew tolerance.
+func (backend *expiryBackend) scan(ctx context.Context, now time.Time) error {
+	records, _, err := backend.Backend.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-backend.skewTolerance)
+
+	for _, record := range records {
+		if !isExpired(record, cutoff) {
+			continue
+		}
+
+		// re-check the latest version in case the record was refreshed since GetAll
+		record, err = backend.Backend.Get(ctx, record.GetType(), record.GetId())
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !isExpired(record, cutoff) {
+			continue
+		}
+
+		record = proto.Clone(record).(*databroker.Record)
+		record.DeletedAt = timestamppb.New(now)
+		if err := backend.Backend.Put(ctx, record); err != nil {
+			return err
+		}
+		log.Debug().
+			Str("type", record.GetType()).
+			Str("id", record.GetId()).
+			Msg("storage: deleted expired record")
+	}
+
+	return nil
+}
+
+func isExpired(record *databroker.Record, now time.Time) bool {
+	if record.GetDeletedAt() != nil {
+		return false
+	}
+	expiresAt, ok := ExpiresAt(record)
+	return ok && expiresAt.Before(now)
+}
+
+// ExpiresAt returns the expiry of the record, from its top-level `expires_at`
+// timestamp field. False is returned if the record doesn't have an expiry.
+func ExpiresAt(record *databroker.Record) (time.Time, bool) {
+	if record.GetData() == nil {
+		return time.Time{}, false
+	}
+
+	msg, err := record.GetData().UnmarshalNew()
+	if err != nil {
+		// ignore unknown types
+		return time.Time{}, false
+	}
+
+	fd := msg.ProtoReflect().Descriptor().Fields().ByName(expiresAtFieldName)
+	if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.Cardinality() == protoreflect.Repeated ||
+		!msg.ProtoReflect().Has(fd) {
+		return time.Time{}, false
+	}
+
+	expiresAt, ok := msg.ProtoReflect().Get(fd).Message().Interface().(*timestamppb.Timestamp)
+	if !ok || expiresAt == nil || !expiresAt.IsValid() {
+		return time.Time{}, false
+	}
+	return expiresAt.AsTime(), true
+}
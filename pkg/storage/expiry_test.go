@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestExpiryBackend(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	m := map[string]*databroker.Record{}
+	var deleted []string
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			if record.GetDeletedAt() != nil {
+				deleted = append(deleted, record.GetId())
+			}
+			m[record.GetId()] = proto.Clone(record).(*databroker.Record)
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return proto.Clone(record).(*databroker.Record), nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			var records []*databroker.Record
+			for _, record := range m {
+				records = append(records, proto.Clone(record).(*databroker.Record))
+			}
+			return records, 0, nil
+		},
+	}
+	c := NewExpiryBackend(time.Hour, backend).(*expiryBackend)
+	defer func() { _ = c.Close() }()
+
+	put := func(id string, data proto.Message) {
+		any, err := anypb.New(data)
+		require.NoError(t, err)
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: any.GetTypeUrl(), Id: id, Data: any}))
+	}
+	put("past", &session.Session{Id: "past", ExpiresAt: timestamppb.New(now.Add(-time.Minute))})
+	put("future", &session.Session{Id: "future", ExpiresAt: timestamppb.New(now.Add(time.Minute))})
+	put("no-expiry", &session.Session{Id: "no-expiry"})
+	put("other", wrapperspb.String("HELLO WORLD"))
+
+	require.NoError(t, c.scan(ctx, now))
+	assert.Equal(t, []string{"past"}, deleted)
+	assert.NotNil(t, m["past"].GetDeletedAt())
+	assert.Nil(t, m["future"].GetDeletedAt())
+
+	t.Run("already deleted", func(t *testing.T) {
+		deleted = nil
+		require.NoError(t, c.scan(ctx, now))
+		assert.Empty(t, deleted)
+	})
+	t.Run("skew tolerance", func(t *testing.T) {
+		c := NewExpiryBackendWithSkewTolerance(time.Hour, 5*time.Second, backend).(*expiryBackend)
+		defer func() { _ = c.Close() }()
+
+		deleted = nil
+		put("within-skew", &session.Session{Id: "within-skew", ExpiresAt: timestamppb.New(now.Add(-2 * time.Second))})
+		put("past-skew", &session.Session{Id: "past-skew", ExpiresAt: timestamppb.New(now.Add(-time.Minute))})
+		require.NoError(t, c.scan(ctx, now))
+		assert.Equal(t, []string{"past-skew"}, deleted)
+		assert.Nil(t, m["within-skew"].GetDeletedAt(), "a record within the skew of its expiry should be retained")
+	})
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type fieldEncryptedBackend struct {
+	*encryptedBackend
+	fields map[string][]string
+}
+
+// NewFieldEncryptedBackend creates a new backend which encrypts only the given
+// fields of records of the given record types, leaving the rest of their data
+// readable, and searchable, in the underlying storage. Fields are dot-separated
+// paths of protobuf field names, such as "oauth_token.access_token", and must
+// refer to string or bytes fields. Records of any other type are encrypted in
+// full, as with NewEncryptedBackend.
+func NewFieldEncryptedBackend(secret []byte, fields map[string][]string, underlying Backend) (Backend, error) {
+	e, err := newEncryptedBackend(secret, nil, underlying)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fieldEncryptedBackend{
+		encryptedBackend: e,
+		fields:           fields,
+	}, nil
+}
+
+func (e *fieldEncryptedBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	record, err := e.underlying.Get(ctx, recordType, id)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptRecord(ctx, record)
+}
+
+func (e *fieldEncryptedBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	records, version, err := e.underlying.GetAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range records {
+		records[i], err = e.decryptRecord(ctx, records[i])
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, version, nil
+}
+
+func (e *fieldEncryptedBackend) Put(ctx context.Context, record *databroker.Record) error {
+	newRecord, err := e.encryptRecord(record)
+	if err != nil {
+		return err
+	}
+	return e.underlying.Put(ctx, newRecord)
+}
+
+func (e *fieldEncryptedBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	newRecords := make([]*databroker.Record, len(records))
+	for i, record := range records {
+		var err error
+		newRecords[i], err = e.encryptRecord(record)
+		if err != nil {
+			return err
+		}
+	}
+	return e.underlying.ReplaceAll(ctx, recordType, newRecords)
+}
+
+func (e *fieldEncryptedBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	stream, err := e.underlying.Sync(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedRecordStream{
+		underlying: stream,
+		decrypt:    e.decryptRecord,
+	}, nil
+}
+
+func (e *fieldEncryptedBackend) encryptRecord(record *databroker.Record) (*databroker.Record, error) {
+	paths, ok := e.fields[record.GetType()]
+	if !ok {
+		encrypted, err := e.encrypt(record.GetType(), record.GetData())
+		if err != nil {
+			return nil, err
+		}
+		newRecord := proto.Clone(record).(*databroker.Record)
+		newRecord.Data = encrypted
+		return newRecord, nil
+	}
+
+	newRecord := proto.Clone(record).(*databroker.Record)
+	if record.GetData() == nil {
+		return newRecord, nil
+	}
+
+	msg, err := record.GetData().UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		ad := fieldAdditionalData(record, path)
+		err = transformField(msg.ProtoReflect(), path, func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error) {
+			if fd.Kind() == protoreflect.StringKind {
+				ciphertext := cryptutil.Encrypt(e.getSecrets().current, []byte(v.String()), ad)
+				return protoreflect.ValueOfString(base64.StdEncoding.EncodeToString(ciphertext)), nil
+			}
+			return protoreflect.ValueOfBytes(cryptutil.Encrypt(e.getSecrets().current, v.Bytes(), ad)), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	newRecord.Data, err = anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return newRecord, nil
+}
+
+func (e *fieldEncryptedBackend) decryptRecord(ctx context.Context, in *databroker.Record) (*databroker.Record, error) {
+	paths, ok := e.fields[in.GetType()]
+	// records written before field encryption was enabled for their type are
+	// encrypted in full
+	if !ok || (in.GetData() != nil && in.GetData().GetTypeUrl() != in.GetType()) {
+		return e.encryptedBackend.decryptRecord(ctx, in)
+	}
+
+	out := proto.Clone(in).(*databroker.Record)
+	if in.GetData() == nil {
+		return out, nil
+	}
+
+	msg, err := in.GetData().UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		ad := fieldAdditionalData(in, path)
+		err = transformField(msg.ProtoReflect(), path, func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error) {
+			var ciphertext []byte
+			if fd.Kind() == protoreflect.StringKind {
+				var err error
+				ciphertext, err = base64.StdEncoding.DecodeString(v.String())
+				if err != nil {
+					return protoreflect.Value{}, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+				}
+			} else {
+				ciphertext = v.Bytes()
+			}
+			plaintext, err := e.getSecrets().decrypt(ciphertext, ad)
+			if err != nil {
+				return protoreflect.Value{}, fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+			}
+			if fd.Kind() == protoreflect.StringKind {
+				return protoreflect.ValueOfString(string(plaintext)), nil
+			}
+			return protoreflect.ValueOfBytes(plaintext), nil
+		})
+		if errors.Is(err, ErrVerificationFailed) {
+			metrics.RecordDataBrokerSignatureVerifyFailure(ctx, in.GetType())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	out.Data, err = anypb.New(msg)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fieldAdditionalData binds an encrypted field to its record, so that it can't be
+// copied to another record or field.
+func fieldAdditionalData(record *databroker.Record, path string) []byte {
+	return []byte(record.GetType() + "\x00" + record.GetId() + "\x00" + path)
+}
+
+// transformField replaces the value of the string or bytes field at the given
+// path with the result of fn. Unset fields are left unset.
+func transformField(
+	msg protoreflect.Message,
+	path string,
+	fn func(fd protoreflect.FieldDescriptor, v protoreflect.Value) (protoreflect.Value, error),
+) error {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return fmt.Errorf("storage: unknown field %s in %s", path, msg.Descriptor().FullName())
+		}
+		if fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("storage: unsupported repeated field %s in %s", path, msg.Descriptor().FullName())
+		}
+		if !msg.Has(fd) {
+			return nil
+		}
+
+		if i < len(names)-1 {
+			if fd.Kind() != protoreflect.MessageKind {
+				return fmt.Errorf("storage: field %s in %s is not a message", name, msg.Descriptor().FullName())
+			}
+			msg = msg.Mutable(fd).Message()
+			continue
+		}
+
+		if fd.Kind() != protoreflect.StringKind && fd.Kind() != protoreflect.BytesKind {
+			return fmt.Errorf("storage: field %s in %s must be a string or bytes field", path, msg.Descriptor().FullName())
+		}
+		v, err := fn(fd, msg.Get(fd))
+		if err != nil {
+			return err
+		}
+		msg.Set(fd, v)
+	}
+	return nil
+}
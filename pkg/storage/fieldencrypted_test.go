@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestFieldEncryptedBackend(t *testing.T) {
+	ctx := context.Background()
+
+	m := map[string]*databroker.Record{}
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = record
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return proto.Clone(record).(*databroker.Record), nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			var records []*databroker.Record
+			for _, record := range m {
+				records = append(records, proto.Clone(record).(*databroker.Record))
+			}
+			return records, 0, nil
+		},
+	}
+
+	s := &session.Session{
+		Id:         "session-1",
+		UserId:     "user-1",
+		OauthToken: &session.OAuthToken{AccessToken: "ACCESS-TOKEN"},
+	}
+	data, err := anypb.New(s)
+	require.NoError(t, err)
+
+	e, err := NewFieldEncryptedBackend(cryptutil.NewKey(), map[string][]string{
+		data.GetTypeUrl(): {"oauth_token.access_token"},
+	}, backend)
+	require.NoError(t, err)
+
+	require.NoError(t, e.Put(ctx, &databroker.Record{
+		Type: data.GetTypeUrl(),
+		Id:   "session-1",
+		Data: data,
+	}))
+
+	stored := m["session-1"]
+	require.NotNil(t, stored)
+	var storedSession session.Session
+	require.NoError(t, stored.GetData().UnmarshalTo(&storedSession))
+	assert.NotEqual(t, "ACCESS-TOKEN", storedSession.GetOauthToken().GetAccessToken(), "field should be encrypted")
+	assert.NotEmpty(t, storedSession.GetOauthToken().GetAccessToken())
+	assert.Equal(t, "user-1", storedSession.GetUserId(), "other fields should be preserved")
+	assert.True(t, MatchAny(stored.GetData(), "user-1"), "other fields should be searchable")
+	assert.False(t, MatchAny(stored.GetData(), "ACCESS-TOKEN"), "encrypted field should not be searchable")
+
+	record, err := e.Get(ctx, data.GetTypeUrl(), "session-1")
+	require.NoError(t, err)
+	var actual session.Session
+	require.NoError(t, record.GetData().UnmarshalTo(&actual))
+	assert.True(t, proto.Equal(s, &actual), "field should be decrypted")
+
+	records, _, err := e.GetAll(ctx)
+	require.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		require.NoError(t, records[0].GetData().UnmarshalTo(&actual))
+		assert.True(t, proto.Equal(s, &actual), "field should be decrypted")
+	}
+
+	t.Run("other types", func(t *testing.T) {
+		other, _ := anypb.New(wrapperspb.String("HELLO WORLD"))
+		require.NoError(t, e.Put(ctx, &databroker.Record{
+			Type: other.GetTypeUrl(),
+			Id:   "other-1",
+			Data: other,
+		}))
+		assert.NotEqual(t, other.GetTypeUrl(), m["other-1"].GetData().GetTypeUrl(), "record should be encrypted in full")
+
+		record, err := e.Get(ctx, other.GetTypeUrl(), "other-1")
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(other, record.GetData()))
+		delete(m, "other-1")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := proto.Clone(&storedSession).(*session.Session)
+		tampered.UserId = "user-2"
+		tamperedData, err := anypb.New(tampered)
+		require.NoError(t, err)
+		m["session-2"] = &databroker.Record{
+			Type: data.GetTypeUrl(),
+			Id:   "session-2",
+			Data: tamperedData,
+		}
+		defer delete(m, "session-2")
+
+		_, err = e.Get(ctx, data.GetTypeUrl(), "session-2")
+		assert.ErrorIs(t, err, ErrVerificationFailed, "encrypted field should be bound to its record")
+	})
+}
@@ -0,0 +1,447 @@
+// Package firestore implements the storage.Backend interface for Google Cloud
+// Firestore.
+//
+// The connection string has the form firestore://PROJECT_ID[/COLLECTION_PREFIX].
+// Records are stored in the {prefix}_records collection, every change is added
+// to the {prefix}_changes collection and the latest version is kept in the
+// {prefix}_meta/version document. The prefix defaults to "pomerium".
+//
+// Consistency: every write is a Firestore transaction which reads and increments
+// the version document, so writes are serialized and each change gets the next
+// version with no gaps. Get returns the latest committed record. GetAll is a
+// read-only transaction, so the records are a consistent snapshot as of the
+// returned version. Sync streams read the changes in version order and are woken
+// by a snapshot listener on the version document, so they see every committed
+// change exactly once, though possibly after the listener's propagation delay.
+// As all writes contend on the version document, write throughput is limited to
+// what Firestore sustains for a single document.
+//
+// Changes are stamped with an expire_at time. Permanent deletion relies on a
+// Firestore TTL policy on the expire_at field of the {prefix}_changes collection
+// group, which must be configured separately. Deleted records are removed from
+// the records collection immediately.
+package firestore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/signal"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	defaultCollectionPrefix = "pomerium"
+	versionDocID            = "version"
+	syncPageSize            = 100
+	watchPollInterval       = 30 * time.Second
+)
+
+type recordDoc struct {
+	Type    string `firestore:"type"`
+	ID      string `firestore:"id"`
+	Version int64  `firestore:"version"`
+	Data    []byte `firestore:"data"`
+}
+
+type changeDoc struct {
+	Version  int64     `firestore:"version"`
+	Data     []byte    `firestore:"data"`
+	ExpireAt time.Time `firestore:"expire_at"`
+}
+
+type versionDoc struct {
+	Version int64 `firestore:"version"`
+}
+
+// Backend implements the storage.Backend on top of Firestore.
+type Backend struct {
+	cfg *config
+
+	client   *firestore.Client
+	records  *firestore.CollectionRef
+	changes  *firestore.CollectionRef
+	version  *firestore.DocumentRef
+	onChange *signal.Signal
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New creates a new Firestore storage backend. The client authenticates with
+// Application Default Credentials unless a credentials file is given. The
+// FIRESTORE_EMULATOR_HOST environment variable is honored.
+func New(rawURL string, options ...Option) (*Backend, error) {
+	projectID, prefix, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := getConfig(options...)
+	var clientOptions []option.ClientOption
+	if cfg.credentialsFile != "" {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(cfg.credentialsFile))
+	}
+	client, err := firestore.NewClient(context.Background(), projectID, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("firestore: failed to create client: %w", err)
+	}
+
+	backend := &Backend{
+		cfg:      cfg,
+		client:   client,
+		records:  client.Collection(prefix + "_records"),
+		changes:  client.Collection(prefix + "_changes"),
+		version:  client.Collection(prefix + "_meta").Doc(versionDocID),
+		onChange: signal.New(),
+		closed:   make(chan struct{}),
+	}
+	go backend.listenForVersionChanges()
+	return backend, nil
+}
+
+func parseURL(rawURL string) (projectID, prefix string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("firestore: invalid connection string: %w", err)
+	}
+	if u.Scheme != "firestore" {
+		return "", "", fmt.Errorf("firestore: unsupported connection string scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("firestore: connection string is missing the project id")
+	}
+
+	prefix = strings.Trim(u.Path, "/")
+	if prefix == "" {
+		prefix = defaultCollectionPrefix
+	} else if strings.Contains(prefix, "/") {
+		return "", "", fmt.Errorf("firestore: invalid collection prefix: %s", prefix)
+	}
+	return u.Host, prefix, nil
+}
+
+// Close closes the underlying Firestore client and any watchers.
+func (backend *Backend) Close() error {
+	var err error
+	backend.closeOnce.Do(func() {
+		close(backend.closed)
+		err = backend.client.Close()
+	})
+	return err
+}
+
+// Get gets a record from Firestore.
+func (backend *Backend) Get(ctx context.Context, recordType, id string) (_ *databroker.Record, err error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.firestore.Get")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "get", recordType, err) }(time.Now())
+
+	snapshot, err := backend.records.Doc(recordDocID(recordType, id)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return unmarshalRecord(snapshot)
+}
+
+// GetAll gets all the records from Firestore, along with the version they are
+// current as of.
+func (backend *Backend) GetAll(ctx context.Context) (records []*databroker.Record, latestRecordVersion uint64, err error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.firestore.GetAll")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "getall", "", err) }(time.Now())
+
+	err = backend.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		records = nil
+
+		var err error
+		latestRecordVersion, err = getVersion(tx, backend.version)
+		if err != nil {
+			return err
+		}
+
+		snapshots, err := tx.Documents(backend.records).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			record, err := unmarshalRecord(snapshot)
+			if err != nil {
+				log.Warn().Err(err).Msg("firestore: invalid record detected")
+				continue
+			}
+			records = append(records, record)
+		}
+		return nil
+	}, firestore.ReadOnly)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, latestRecordVersion, nil
+}
+
+// Put puts a record into Firestore.
+func (backend *Backend) Put(ctx context.Context, record *databroker.Record) (err error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.firestore.Put")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "put", record.GetType(), err) }(time.Now())
+
+	return backend.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		version, err := getVersion(tx, backend.version)
+		if err != nil {
+			return err
+		}
+
+		version++
+		record.ModifiedAt = storage.GetPreserveModifiedAt(ctx, record)
+		record.Version = version
+		if err := backend.write(tx, record); err != nil {
+			return err
+		}
+		return tx.Set(backend.version, versionDoc{Version: int64(version)})
+	})
+}
+
+// ReplaceAll replaces all the records of the given type in Firestore in a single
+// transaction. Firestore limits the number of writes in a transaction, so only a
+// limited number of records can be replaced at once.
+func (backend *Backend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) (err error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.firestore.ReplaceAll")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "replaceall", recordType, err) }(time.Now())
+
+	keep := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		if record.GetType() != recordType {
+			return fmt.Errorf("firestore: record type %s does not match %s", record.GetType(), recordType)
+		}
+		keep[record.GetId()] = struct{}{}
+	}
+
+	return backend.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		version, err := getVersion(tx, backend.version)
+		if err != nil {
+			return err
+		}
+
+		// find the existing records of this type which should be deleted
+		snapshots, err := tx.Documents(backend.records.Where("type", "==", recordType)).GetAll()
+		if err != nil {
+			return err
+		}
+		now := timestamppb.Now()
+		var deleted []*databroker.Record
+		for _, snapshot := range snapshots {
+			record, err := unmarshalRecord(snapshot)
+			if err != nil {
+				log.Warn().Err(err).Msg("firestore: invalid record detected")
+				var doc recordDoc
+				_ = snapshot.DataTo(&doc)
+				record = &databroker.Record{Type: recordType, Id: doc.ID}
+			}
+			if _, ok := keep[record.GetId()]; ok {
+				continue
+			}
+			record.DeletedAt = now
+			deleted = append(deleted, record)
+		}
+
+		changes := append(append([]*databroker.Record{}, records...), deleted...)
+		for _, record := range changes {
+			version++
+			record.ModifiedAt = now
+			record.Version = version
+			if err := backend.write(tx, record); err != nil {
+				return err
+			}
+		}
+		return tx.Set(backend.version, versionDoc{Version: int64(version)})
+	})
+}
+
+// Sync returns a record stream of any records changed after the specified version.
+func (backend *Backend) Sync(ctx context.Context, version uint64) (storage.RecordStream, error) {
+	return newRecordStream(ctx, backend, version), nil
+}
+
+// ListRecordTypes lists the distinct types of the records in Firestore.
+func (backend *Backend) ListRecordTypes(ctx context.Context) (_ []string, err error) {
+	ctx, span := trace.StartSpan(ctx, "databroker.firestore.ListRecordTypes")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "listrecordtypes", "", err) }(time.Now())
+
+	snapshots, err := backend.records.Select("type").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := map[string]struct{}{}
+	for _, snapshot := range snapshots {
+		var doc recordDoc
+		if err := snapshot.DataTo(&doc); err != nil {
+			return nil, err
+		}
+		lookup[doc.Type] = struct{}{}
+	}
+
+	recordTypes := make([]string, 0, len(lookup))
+	for recordType := range lookup {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	return recordTypes, nil
+}
+
+// write writes the record and its change in the transaction. Deleted records are
+// removed from the records collection.
+func (backend *Backend) write(tx *firestore.Transaction, record *databroker.Record) error {
+	bs, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	ref := backend.records.Doc(recordDocID(record.GetType(), record.GetId()))
+	if record.GetDeletedAt() != nil {
+		err = tx.Delete(ref)
+	} else {
+		err = tx.Set(ref, recordDoc{
+			Type:    record.GetType(),
+			ID:      record.GetId(),
+			Version: int64(record.GetVersion()),
+			Data:    bs,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(backend.changes.Doc(changeDocID(record.GetVersion())), changeDoc{
+		Version:  int64(record.GetVersion()),
+		Data:     bs,
+		ExpireAt: record.GetModifiedAt().AsTime().Add(backend.cfg.expiryFor(record.GetType())),
+	})
+}
+
+// getChanges returns the changes after the given version, in version order, and
+// the version of the last change read.
+func (backend *Backend) getChanges(ctx context.Context, after uint64, limit int) ([]*databroker.Record, uint64, error) {
+	snapshots, err := backend.changes.
+		Where("version", ">", int64(after)).
+		OrderBy("version", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).
+		GetAll()
+	if err != nil {
+		return nil, after, err
+	}
+
+	records := make([]*databroker.Record, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		var doc changeDoc
+		if err := snapshot.DataTo(&doc); err != nil {
+			return nil, after, err
+		}
+		after = uint64(doc.Version)
+
+		var record databroker.Record
+		if err := proto.Unmarshal(doc.Data, &record); err != nil {
+			log.Warn().Err(err).Msg("firestore: invalid record detected")
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, after, nil
+}
+
+// listenForVersionChanges notifies record streams when the version document
+// changes.
+func (backend *Backend) listenForVersionChanges() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-backend.closed
+		cancel()
+	}()
+
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+
+outer:
+	for {
+		iter := backend.version.Snapshots(ctx)
+		for {
+			_, err := iter.Next()
+			if err != nil {
+				iter.Stop()
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(bo.NextBackOff()):
+				}
+				continue outer
+			}
+			bo.Reset()
+
+			backend.onChange.Broadcast()
+		}
+	}
+}
+
+func getVersion(tx *firestore.Transaction, ref *firestore.DocumentRef) (uint64, error) {
+	snapshot, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var doc versionDoc
+	if err := snapshot.DataTo(&doc); err != nil {
+		return 0, err
+	}
+	return uint64(doc.Version), nil
+}
+
+func unmarshalRecord(snapshot *firestore.DocumentSnapshot) (*databroker.Record, error) {
+	var doc recordDoc
+	if err := snapshot.DataTo(&doc); err != nil {
+		return nil, err
+	}
+
+	var record databroker.Record
+	if err := proto.Unmarshal(doc.Data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// recordDocID returns the document id for a record. Document ids may not contain
+// slashes, so the type and id are encoded.
+func recordDocID(recordType, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(recordType)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// changeDocID returns the document id for a change. Versions are zero-padded so
+// that the ids sort in version order.
+func changeDocID(version uint64) string {
+	return fmt.Sprintf("%020d", version)
+}
@@ -0,0 +1,185 @@
+package firestore
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestBackend(t *testing.T) {
+	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
+		t.Skip("Github action can not run docker on MacOS")
+	}
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*30)
+	defer clearTimeout()
+
+	require.NoError(t, testutil.WithTestFirestore(func(rawURL string) error {
+		backend, err := New(rawURL)
+		require.NoError(t, err)
+		defer func() { _ = backend.Close() }()
+
+		t.Run("get missing record", func(t *testing.T) {
+			record, err := backend.Get(ctx, "TYPE", "abcd")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.Nil(t, record)
+		})
+		t.Run("get record", func(t *testing.T) {
+			data := new(anypb.Any)
+			assert.NoError(t, backend.Put(ctx, &databroker.Record{
+				Type: "TYPE",
+				Id:   "a/b",
+				Data: data,
+			}))
+			record, err := backend.Get(ctx, "TYPE", "a/b")
+			require.NoError(t, err)
+			if assert.NotNil(t, record) {
+				assert.Equal(t, "a/b", record.Id)
+				assert.NotNil(t, record.ModifiedAt)
+				assert.Equal(t, "TYPE", record.Type)
+				assert.Equal(t, uint64(1), record.Version)
+			}
+		})
+		t.Run("delete record", func(t *testing.T) {
+			assert.NoError(t, backend.Put(ctx, &databroker.Record{
+				Type:      "TYPE",
+				Id:        "a/b",
+				DeletedAt: timestamppb.Now(),
+			}))
+			record, err := backend.Get(ctx, "TYPE", "a/b")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.Nil(t, record)
+		})
+		t.Run("get all records", func(t *testing.T) {
+			for _, id := range []string{"1", "2", "3"} {
+				require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: id}))
+			}
+			records, version, err := backend.GetAll(ctx)
+			assert.NoError(t, err)
+			assert.Len(t, records, 3)
+			assert.Equal(t, uint64(5), version)
+		})
+		t.Run("replace all", func(t *testing.T) {
+			for _, id := range []string{"A", "B", "C"} {
+				require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "REPLACE", Id: id}))
+			}
+			_, version, err := backend.GetAll(ctx)
+			require.NoError(t, err)
+
+			require.NoError(t, backend.ReplaceAll(ctx, "REPLACE", []*databroker.Record{
+				{Type: "REPLACE", Id: "B"},
+				{Type: "REPLACE", Id: "C"},
+				{Type: "REPLACE", Id: "D"},
+			}))
+
+			_, err = backend.Get(ctx, "REPLACE", "A")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			for _, id := range []string{"B", "C", "D"} {
+				_, err = backend.Get(ctx, "REPLACE", id)
+				assert.NoError(t, err)
+			}
+
+			stream, err := backend.Sync(ctx, version)
+			require.NoError(t, err)
+			defer stream.Close()
+			changes := map[string]bool{}
+			for len(changes) < 4 && stream.Next(true) {
+				changes[stream.Record().GetId()] = stream.Record().GetDeletedAt() != nil
+			}
+			assert.Equal(t, map[string]bool{"A": true, "B": false, "C": false, "D": false}, changes)
+		})
+		t.Run("list record types", func(t *testing.T) {
+			recordTypes, err := backend.ListRecordTypes(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"REPLACE", "TYPE"}, recordTypes)
+		})
+		return nil
+	}))
+}
+
+func TestSync(t *testing.T) {
+	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
+		t.Skip("Github action can not run docker on MacOS")
+	}
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*30)
+	defer clearTimeout()
+
+	require.NoError(t, testutil.WithTestFirestore(func(rawURL string) error {
+		backend1, err := New(rawURL)
+		require.NoError(t, err)
+		defer func() { _ = backend1.Close() }()
+
+		backend2, err := New(rawURL)
+		require.NoError(t, err)
+		defer func() { _ = backend2.Close() }()
+
+		require.NoError(t, backend1.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+
+		stream, err := backend1.Sync(ctx, 1)
+		require.NoError(t, err)
+		defer stream.Close()
+		assert.False(t, stream.Next(false), "no changes should be returned after the version")
+
+		// the listener should wake the blocked stream for a write from another backend
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			_ = backend2.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2"})
+			_ = backend2.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2", DeletedAt: timestamppb.Now()})
+		}()
+
+		var versions []uint64
+		for len(versions) < 2 && stream.Next(true) {
+			versions = append(versions, stream.Record().GetVersion())
+		}
+		require.NoError(t, stream.Err())
+		assert.Equal(t, []uint64{2, 3}, versions)
+		return nil
+	}))
+}
+
+func TestParseURL(t *testing.T) {
+	for _, tc := range []struct {
+		rawURL    string
+		projectID string
+		prefix    string
+		err       bool
+	}{
+		{"firestore://my-project", "my-project", "pomerium", false},
+		{"firestore://my-project/", "my-project", "pomerium", false},
+		{"firestore://my-project/staging", "my-project", "staging", false},
+		{"firestore://my-project/a/b", "", "", true},
+		{"firestore:///staging", "", "", true},
+		{"redis://localhost:6379", "", "", true},
+	} {
+		projectID, prefix, err := parseURL(tc.rawURL)
+		if tc.err {
+			assert.Error(t, err, tc.rawURL)
+			continue
+		}
+		assert.NoError(t, err, tc.rawURL)
+		assert.Equal(t, tc.projectID, projectID, tc.rawURL)
+		assert.Equal(t, tc.prefix, prefix, tc.rawURL)
+	}
+}
+
+func TestDocIDs(t *testing.T) {
+	assert.NotContains(t, recordDocID("type.googleapis.com/session.Session", "a/b"), "/")
+	assert.NotEqual(t, recordDocID("a.b", "c"), recordDocID("a", "b.c"))
+
+	ids := []string{changeDocID(10), changeDocID(9), changeDocID(100)}
+	sort.Strings(ids)
+	assert.Equal(t, []string{changeDocID(9), changeDocID(10), changeDocID(100)}, ids)
+}
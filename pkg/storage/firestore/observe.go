@@ -0,0 +1,20 @@
+package firestore
+
+import (
+	"context"
+	"time"
+
+	pomeriumconfig "github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func recordOperation(ctx context.Context, cfg *config, startTime time.Time, operation, recordType string, err error) {
+	metrics.RecordStorageOperation(ctx, &metrics.StorageOperationTags{
+		Operation:  operation,
+		Error:      err,
+		ErrorClass: storage.ErrorClass(err),
+		Backend:    pomeriumconfig.StorageFirestoreName,
+		RecordType: cfg.recordTypeLabel(recordType),
+	}, time.Since(startTime))
+}
@@ -0,0 +1,45 @@
+package firestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+func TestRecordOperation(t *testing.T) {
+	getTags := func(t *testing.T, v *view.View, key string) []string {
+		rows, err := view.RetrieveData(v.Name)
+		require.NoError(t, err)
+
+		var values []string
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key.Name() == key {
+					values = append(values, tag.Value)
+				}
+			}
+		}
+		return values
+	}
+
+	view.Unregister(metrics.StorageViews...)
+	require.NoError(t, view.Register(metrics.StorageViews...))
+	defer view.Unregister(metrics.StorageViews...)
+
+	ctx := context.Background()
+	cfg := getConfig(WithRecordTypeMetrics(true), WithKnownRecordTypes([]string{"known"}))
+	recordOperation(ctx, cfg, time.Now(), "put", "known", nil)
+	recordOperation(ctx, cfg, time.Now(), "get", "unknown", storage.ErrNotFound)
+
+	assert.ElementsMatch(t, []string{"get", "put"}, getTags(t, metrics.StorageOperationDurationView, "operation"))
+	assert.ElementsMatch(t, []string{"known", "other"}, getTags(t, metrics.StorageOperationDurationView, "record_type"))
+	assert.ElementsMatch(t, []string{"firestore", "firestore"}, getTags(t, metrics.StorageOperationDurationView, "backend"))
+	assert.Equal(t, []string{"not_found"}, getTags(t, metrics.StorageOperationErrorsView, "error_class"))
+}
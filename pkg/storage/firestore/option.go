@@ -0,0 +1,93 @@
+package firestore
+
+import (
+	"time"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+type config struct {
+	expiry          time.Duration
+	typeExpiries    map[string]time.Duration
+	credentialsFile string
+
+	recordTypeMetrics bool
+	knownRecordTypes  map[string]struct{}
+}
+
+// Option customizes a Backend.
+type Option func(*config)
+
+// WithExpiry sets the expiry for changes. Changes are stamped with an expire_at
+// time, and are removed by a Firestore TTL policy on that field.
+func WithExpiry(expiry time.Duration) Option {
+	return func(cfg *config) {
+		cfg.expiry = expiry
+	}
+}
+
+// WithTypeExpiries sets the expiry for the changes of records of the given types,
+// overriding the expiry set by WithExpiry.
+func WithTypeExpiries(expiries map[string]time.Duration) Option {
+	return func(cfg *config) {
+		cfg.typeExpiries = expiries
+	}
+}
+
+// expiryFor returns the expiry for the changes of records of the given type.
+func (cfg *config) expiryFor(recordType string) time.Duration {
+	if expiry, ok := cfg.typeExpiries[recordType]; ok {
+		return expiry
+	}
+	return cfg.expiry
+}
+
+// WithCredentialsFile sets the service account credentials file used to
+// authenticate. If unset, Application Default Credentials are used.
+func WithCredentialsFile(filePath string) Option {
+	return func(cfg *config) {
+		cfg.credentialsFile = filePath
+	}
+}
+
+// WithRecordTypeMetrics enables the record_type label on operation metrics.
+func WithRecordTypeMetrics(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.recordTypeMetrics = enabled
+	}
+}
+
+// WithKnownRecordTypes bounds the record_type label on operation metrics to the
+// given record types. Any other record type is reported as "other". If unset the
+// label is not bounded.
+func WithKnownRecordTypes(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.knownRecordTypes = make(map[string]struct{}, len(recordTypes))
+		for _, recordType := range recordTypes {
+			cfg.knownRecordTypes[recordType] = struct{}{}
+		}
+	}
+}
+
+// recordTypeLabel returns the value of the record_type label for the given
+// record type, or "" if the label is disabled.
+func (cfg *config) recordTypeLabel(recordType string) string {
+	if !cfg.recordTypeMetrics || recordType == "" {
+		return ""
+	}
+	if cfg.knownRecordTypes != nil {
+		if _, ok := cfg.knownRecordTypes[recordType]; !ok {
+			return metrics.StorageRecordTypeOther
+		}
+	}
+	return recordType
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	WithExpiry(time.Hour * 24)(cfg)
+	for _, o := range options {
+		o(cfg)
+	}
+	return cfg
+}
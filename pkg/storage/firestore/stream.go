@@ -0,0 +1,90 @@
+package firestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type recordStream struct {
+	ctx     context.Context
+	backend *Backend
+
+	changed chan struct{}
+	version uint64
+	pending []*databroker.Record
+	record  *databroker.Record
+	err     error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newRecordStream(ctx context.Context, backend *Backend, version uint64) *recordStream {
+	return &recordStream{
+		ctx:     ctx,
+		backend: backend,
+
+		changed: backend.onChange.Bind(),
+		version: version,
+
+		closed: make(chan struct{}),
+	}
+}
+
+func (stream *recordStream) Close() error {
+	stream.closeOnce.Do(func() {
+		stream.backend.onChange.Unbind(stream.changed)
+		close(stream.closed)
+	})
+	return nil
+}
+
+func (stream *recordStream) Next(block bool) bool {
+	if stream.err != nil {
+		return false
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if len(stream.pending) == 0 {
+			var err error
+			stream.pending, stream.version, err = stream.backend.getChanges(stream.ctx, stream.version, syncPageSize)
+			if err != nil {
+				stream.err = err
+				return false
+			}
+		}
+
+		if len(stream.pending) > 0 {
+			stream.record, stream.pending = stream.pending[0], stream.pending[1:]
+			return true
+		}
+
+		if block {
+			select {
+			case <-stream.ctx.Done():
+				stream.err = stream.ctx.Err()
+				return false
+			case <-stream.closed:
+				return false
+			case <-ticker.C: // check again
+			case <-stream.changed: // check again
+			}
+		} else {
+			return false
+		}
+	}
+}
+
+func (stream *recordStream) Record() *databroker.Record {
+	return stream.record
+}
+
+func (stream *recordStream) Err() error {
+	return stream.err
+}
@@ -0,0 +1,72 @@
+package storage
+
+import "context"
+
+// A Flusher is a Backend which buffers writes, and can flush them so that the
+// underlying storage is at a consistent point.
+type Flusher interface {
+	// Flush writes any buffered state to the underlying storage.
+	Flush(ctx context.Context) error
+}
+
+// Flush flushes the backend if it supports it.
+func Flush(ctx context.Context, backend Backend) error {
+	f, ok := backend.(Flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush(ctx)
+}
+
+func (c *checksumBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, c.underlying)
+}
+
+func (backend *signedBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.underlying)
+}
+
+func (e *encryptedBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, e.underlying)
+}
+
+func (e *expiryBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, e.Backend)
+}
+
+func (c *negativeCacheBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, c.Backend)
+}
+
+func (backend *deletedGracePeriodBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (c *readCacheBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, c.underlying)
+}
+
+func (backend *statementTimeoutBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (backend *slowOperationLogBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (backend *routedBackend) Flush(ctx context.Context) error {
+	for _, underlying := range backend.backends {
+		if err := Flush(ctx, underlying); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (backend *recordAgeSamplerBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (backend *concurrencyLimitBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type deletedGracePeriodBackend struct {
+	Backend
+	gracePeriod time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	deleted map[readCacheKey]*databroker.Record
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewDeletedGracePeriodBackend creates a new backend which keeps returning deleted
+// records from GetAll, flagged as deleted, until the grace period after their
+// deletion has passed. This gives consumers of GetAll a chance to reconcile the
+// deletion. Deleted records are also returned from Get, if the context includes
+// deleted records. Deletions made by other servers sharing the same storage are observed
+// via the underlying backend's Sync stream.
+func NewDeletedGracePeriodBackend(gracePeriod time.Duration, underlying Backend) Backend {
+	return newDeletedGracePeriodBackend(gracePeriod, underlying, time.Now)
+}
+
+func newDeletedGracePeriodBackend(gracePeriod time.Duration, underlying Backend, now func() time.Time) *deletedGracePeriodBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &deletedGracePeriodBackend{
+		Backend:     underlying,
+		gracePeriod: gracePeriod,
+		now:         now,
+		deleted:     make(map[readCacheKey]*databroker.Record),
+		cancel:      cancel,
+	}
+	go watchChanges(ctx, underlying, backend.observe, func(err error) {
+		// deletions made while the stream was down will be missed, but the
+		// records already tracked are still accurate
+		log.Warn().Err(err).Msg("storage: deleted record grace period stream closed")
+	})
+	return backend
+}
+
+func (backend *deletedGracePeriodBackend) Close() error {
+	backend.closeOnce.Do(backend.cancel)
+	return backend.Backend.Close()
+}
+
+// GetAll returns all the records from the underlying backend, along with any
+// records deleted within the grace period.
+func (backend *deletedGracePeriodBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	records, latestRecordVersion, err := backend.Backend.GetAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	live := make(map[readCacheKey]struct{}, len(records))
+	for _, record := range records {
+		live[readCacheKey{recordType: record.GetType(), id: record.GetId()}] = struct{}{}
+	}
+
+	backend.mu.Lock()
+	backend.removeExpiredLocked()
+	for key, record := range backend.deleted {
+		if _, ok := live[key]; ok {
+			continue
+		}
+		records = append(records, proto.Clone(record).(*databroker.Record))
+	}
+	backend.mu.Unlock()
+
+	return records, latestRecordVersion, nil
+}
+
+// Get returns the record from the underlying backend. If the record was deleted
+// within the grace period and the context includes deleted records, the deleted
+// record is returned instead.
+func (backend *deletedGracePeriodBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	record, err := backend.Backend.Get(ctx, recordType, id)
+	if err != ErrNotFound || !GetIncludeDeleted(ctx) {
+		return record, err
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	deleted, ok := backend.deleted[readCacheKey{recordType: recordType, id: id}]
+	if !ok || backend.isExpired(deleted) {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(deleted).(*databroker.Record), nil
+}
+
+func (backend *deletedGracePeriodBackend) Put(ctx context.Context, record *databroker.Record) error {
+	err := backend.Backend.Put(ctx, record)
+	if err != nil {
+		return err
+	}
+	// track the deletion right away rather than waiting for the change stream
+	backend.observe(record)
+	return nil
+}
+
+// observe tracks deleted records and stops tracking records which are re-created.
+func (backend *deletedGracePeriodBackend) observe(record *databroker.Record) {
+	key := readCacheKey{recordType: record.GetType(), id: record.GetId()}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	if existing, ok := backend.deleted[key]; ok && existing.GetVersion() > record.GetVersion() {
+		// an older change
+		return
+	}
+
+	if record.GetDeletedAt() == nil || backend.isExpired(record) {
+		delete(backend.deleted, key)
+		return
+	}
+	backend.deleted[key] = proto.Clone(record).(*databroker.Record)
+}
+
+func (backend *deletedGracePeriodBackend) removeExpiredLocked() {
+	for key, record := range backend.deleted {
+		if backend.isExpired(record) {
+			delete(backend.deleted, key)
+		}
+	}
+}
+
+func (backend *deletedGracePeriodBackend) isExpired(record *databroker.Record) bool {
+	return !backend.now().Before(record.GetDeletedAt().AsTime().Add(backend.gracePeriod))
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestDeletedGracePeriodBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var mu sync.Mutex
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	var version uint64
+	m := map[string]*databroker.Record{}
+	stream := newMockRecordStream(ctx)
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			version++
+			record.Version = version
+			if record.GetDeletedAt() != nil {
+				delete(m, record.GetId())
+			} else {
+				m[record.GetId()] = record
+			}
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			var records []*databroker.Record
+			for _, record := range m {
+				records = append(records, record)
+			}
+			return records, version, nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return stream, nil
+		},
+	}
+
+	c := newDeletedGracePeriodBackend(time.Minute, backend, func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	defer func() { _ = c.Close() }()
+
+	getAll := func() map[string]bool {
+		records, _, err := c.GetAll(ctx)
+		require.NoError(t, err)
+		deleted := map[string]bool{}
+		for _, record := range records {
+			deleted[record.GetId()] = record.GetDeletedAt() != nil
+		}
+		return deleted
+	}
+
+	require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+	require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2"}))
+	require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.New(now)}))
+	assert.Equal(t, map[string]bool{"1": true, "2": false}, getAll(),
+		"deleted record should be returned flagged within the grace period")
+
+	_, err := c.Get(ctx, "TYPE", "1")
+	assert.Equal(t, ErrNotFound, err, "deleted record should not be returned by default")
+	record, err := c.Get(WithIncludeDeleted(ctx), "TYPE", "1")
+	if assert.NoError(t, err) {
+		assert.NotNil(t, record.GetDeletedAt(), "deleted record should be flagged")
+	}
+
+	advance(time.Minute)
+	_, err = c.Get(WithIncludeDeleted(ctx), "TYPE", "1")
+	assert.Equal(t, ErrNotFound, err, "deleted record should not be returned after the grace period")
+	assert.Equal(t, map[string]bool{"2": false}, getAll(),
+		"deleted record should be excluded after the grace period")
+
+	t.Run("recreated", func(t *testing.T) {
+		require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "3", DeletedAt: timestamppb.New(now)}))
+		require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "3"}))
+		assert.Equal(t, map[string]bool{"2": false, "3": false}, getAll())
+	})
+	t.Run("change notification", func(t *testing.T) {
+		stream.records <- &databroker.Record{Type: "TYPE", Id: "4", Version: 100, DeletedAt: timestamppb.New(now)}
+		assert.Eventually(t, func() bool {
+			return getAll()["4"]
+		}, time.Second*5, time.Millisecond*10, "deletions from other servers should be observed")
+	})
+}
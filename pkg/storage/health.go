@@ -0,0 +1,94 @@
+package storage
+
+// BackendHealth is the health of one of the backends which a backend routes
+// records to, such as a storage route or a shard.
+type BackendHealth struct {
+	// Name is the name of the shard, for the shards of a sharded backend.
+	Name string
+	// Default is true for the default backend of a routed backend, which stores
+	// the records of every type without a route.
+	Default bool
+	// RecordTypes are the record types routed to the backend.
+	RecordTypes []string
+	// Err is why the backend is unhealthy, or nil if it's healthy.
+	Err error
+}
+
+// Healthy reports whether the backend is healthy.
+func (h BackendHealth) Healthy() bool {
+	return h.Err == nil
+}
+
+// A HealthReporter is a Backend which routes records to several backends, and
+// reports the health of each of them, so that one of them failing can be told
+// apart from all of them failing.
+type HealthReporter interface {
+	// BackendHealth returns the health of each of the backends.
+	BackendHealth() []BackendHealth
+}
+
+// GetBackendHealth returns the health of each of the backends the backend routes
+// records to. It returns nil if the backend doesn't route records.
+func GetBackendHealth(backend Backend) []BackendHealth {
+	r, ok := backend.(HealthReporter)
+	if !ok {
+		return nil
+	}
+	return r.BackendHealth()
+}
+
+func (c *checksumBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(c.underlying)
+}
+
+func (backend *signedBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.underlying)
+}
+
+func (e *encryptedBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(e.underlying)
+}
+
+func (e *expiryBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(e.Backend)
+}
+
+func (c *negativeCacheBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(c.Backend)
+}
+
+func (backend *deletedGracePeriodBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (c *readCacheBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(c.underlying)
+}
+
+func (backend *statementTimeoutBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *slowOperationLogBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *recordAgeSamplerBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *concurrencyLimitBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *retentionBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *tracingBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.Backend)
+}
+
+func (backend *watchdogBackend) BackendHealth() []BackendHealth {
+	return GetBackendHealth(backend.get())
+}
@@ -4,6 +4,7 @@ package inmemory
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/signal"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/storage"
@@ -44,9 +46,16 @@ type Backend struct {
 	closeOnce   sync.Once
 	closed      chan struct{}
 
+	// persistMu serializes writes of the persisted state, so that an older
+	// snapshot never replaces a newer one
+	persistMu        sync.Mutex
+	persistedVersion uint64
+
 	mu      sync.RWMutex
 	lookup  map[recordKey]*databroker.Record
 	changes *btree.BTree
+	// recordTypes counts the records in lookup by type
+	recordTypes map[string]int
 }
 
 // New creates a new in-memory backend storage.
@@ -58,8 +67,20 @@ func New(options ...Option) *Backend {
 		closed:   make(chan struct{}),
 		lookup:   make(map[recordKey]*databroker.Record),
 		changes:  btree.New(cfg.degree),
+
+		recordTypes: make(map[string]int),
+	}
+	if cfg.persistPath != "" {
+		backend.load(cfg.persistPath)
+		backend.persistedVersion = backend.lastVersion
+		if cfg.persistDurability == PersistPeriodic && cfg.persistInterval > 0 {
+			go backend.persistPeriodically()
+		}
 	}
-	if cfg.expiry != 0 {
+	if cfg.compactOnStartup && cfg.expiry != 0 {
+		backend.compact(time.Now())
+	}
+	if cfg.expiry != 0 && !cfg.disableSweep {
 		go func() {
 			ticker := time.NewTicker(time.Second)
 			defer ticker.Stop()
@@ -70,13 +91,26 @@ func New(options ...Option) *Backend {
 				case <-ticker.C:
 				}
 
-				backend.removeChangesBefore(time.Now().Add(-cfg.expiry))
+				backend.sweep(time.Now())
 			}
 		}()
 	}
 	return backend
 }
 
+// sweep removes the expired changes at now, if now is within a sweep window and
+// sweeps aren't disabled.
+func (backend *Backend) sweep(now time.Time) {
+	if backend.cfg.disableSweep || !backend.cfg.sweepWindows.Contains(now) {
+		return
+	}
+	if len(backend.cfg.typeExpiries) > 0 {
+		backend.removeExpiredChanges(now)
+		return
+	}
+	backend.removeChangesBefore(now.Add(-backend.cfg.expiry))
+}
+
 func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 	backend.mu.Lock()
 	defer backend.mu.Unlock()
@@ -100,22 +134,94 @@ func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 	}
 }
 
-// Close closes the in-memory store and erases any stored data.
+// removeExpiredChanges removes the changes expired at now by the expiry of the
+// type of their record. Changes are removed wherever they are in the change log,
+// up to the first change which hasn't expired for any type.
+func (backend *Backend) removeExpiredChanges(now time.Time) {
+	latestCutoff := now.Add(-backend.cfg.minExpiry())
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	var expired []btree.Item
+	backend.changes.Ascend(func(item btree.Item) bool {
+		change, ok := item.(recordChange)
+		if !ok {
+			panic(fmt.Sprintf("invalid type in changes btree: %T", item))
+		}
+		modifiedAt := change.record.GetModifiedAt().AsTime()
+		if !modifiedAt.Before(latestCutoff) {
+			return false
+		}
+		if modifiedAt.Before(now.Add(-backend.cfg.expiryFor(change.record.GetType()))) {
+			expired = append(expired, item)
+		}
+		return true
+	})
+	for _, item := range expired {
+		backend.changes.Delete(item)
+	}
+}
+
+// compact removes the expired changes at now of the records which were deleted,
+// wherever they are in the change log. Unlike a sweep it isn't limited to the
+// oldest changes, or to the sweep windows.
+func (backend *Backend) compact(now time.Time) {
+	backend.mu.Lock()
+	var expired []btree.Item
+	backend.changes.Ascend(func(item btree.Item) bool {
+		change, ok := item.(recordChange)
+		if !ok {
+			panic(fmt.Sprintf("invalid type in changes btree: %T", item))
+		}
+		key := recordKey{Type: change.record.GetType(), ID: change.record.GetId()}
+		cutoff := now.Add(-backend.cfg.expiryFor(change.record.GetType()))
+		if _, live := backend.lookup[key]; !live && change.record.GetModifiedAt().AsTime().Before(cutoff) {
+			expired = append(expired, item)
+		}
+		return true
+	})
+	for _, item := range expired {
+		backend.changes.Delete(item)
+	}
+	backend.mu.Unlock()
+
+	log.Info().Int("removed", len(expired)).Msg("inmemory: compacted deleted records")
+}
+
+// Close closes the in-memory store and erases any stored data. If a persist path
+// is set, the data is first written to it.
 func (backend *Backend) Close() error {
+	var err error
 	backend.closeOnce.Do(func() {
+		backend.persistMu.Lock()
+		defer backend.persistMu.Unlock()
+
 		close(backend.closed)
 
+		if backend.cfg.persistPath != "" {
+			err = backend.persistLocked(backend.cfg.persistPath)
+		}
+
 		backend.mu.Lock()
 		defer backend.mu.Unlock()
 
 		backend.lookup = map[recordKey]*databroker.Record{}
 		backend.changes = btree.New(backend.cfg.degree)
+		backend.recordTypes = map[string]int{}
 	})
+	return err
+}
+
+// Check always succeeds, as the in-memory store can't become unreachable.
+func (backend *Backend) Check(_ context.Context) error {
 	return nil
 }
 
 // Get gets a record from the in-memory store.
-func (backend *Backend) Get(_ context.Context, recordType, id string) (*databroker.Record, error) {
+func (backend *Backend) Get(ctx context.Context, recordType, id string) (_ *databroker.Record, err error) {
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "get", recordType, err) }(time.Now())
+
 	backend.mu.RLock()
 	defer backend.mu.RUnlock()
 
@@ -129,7 +235,9 @@ func (backend *Backend) Get(_ context.Context, recordType, id string) (*databrok
 }
 
 // GetAll gets all the records from the in-memory store.
-func (backend *Backend) GetAll(_ context.Context) ([]*databroker.Record, uint64, error) {
+func (backend *Backend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "getall", "", nil) }(time.Now())
+
 	backend.mu.RLock()
 	defer backend.mu.RUnlock()
 
@@ -140,28 +248,181 @@ func (backend *Backend) GetAll(_ context.Context) ([]*databroker.Record, uint64,
 	return records, backend.lastVersion, nil
 }
 
-// Put puts a record into the in-memory store.
-func (backend *Backend) Put(_ context.Context, record *databroker.Record) error {
+// Put puts a record into the in-memory store. If the context expects the record to
+// be at a version, it's compared while the store is locked.
+func (backend *Backend) Put(ctx context.Context, record *databroker.Record) (err error) {
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "put", record.GetType(), err) }(time.Now())
+
 	if record == nil {
 		return fmt.Errorf("records cannot be nil")
 	}
 
 	backend.mu.Lock()
-	defer backend.mu.Unlock()
-	defer backend.onChange.Broadcast()
+	current := backend.lookup[recordKey{Type: record.GetType(), ID: record.GetId()}]
+	if err := storage.CheckExpectedVersion(ctx, record, current); err != nil {
+		backend.mu.Unlock()
+		return err
+	}
+	backend.putAtLocked(record, storage.GetPreserveModifiedAt(ctx, record))
+	backend.mu.Unlock()
+	backend.onChange.Broadcast()
+
+	return backend.persistWrite()
+}
 
-	record.ModifiedAt = timestamppb.Now()
+// ReplaceAll replaces all the records of the given type in the in-memory store.
+func (backend *Backend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) (err error) {
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "replaceall", recordType, err) }(time.Now())
+
+	keep := make(map[recordKey]struct{}, len(records))
+	for _, record := range records {
+		if record == nil {
+			return fmt.Errorf("records cannot be nil")
+		}
+		if record.GetType() != recordType {
+			return fmt.Errorf("record type %s does not match %s", record.GetType(), recordType)
+		}
+		keep[recordKey{Type: record.GetType(), ID: record.GetId()}] = struct{}{}
+	}
+
+	backend.mu.Lock()
+	for _, record := range records {
+		backend.putLocked(record)
+	}
+	for key, record := range backend.lookup {
+		if key.Type != recordType {
+			continue
+		}
+		if _, ok := keep[key]; ok {
+			continue
+		}
+		record = dup(record)
+		record.DeletedAt = timestamppb.Now()
+		backend.putLocked(record)
+	}
+	backend.mu.Unlock()
+	backend.onChange.Broadcast()
+
+	return backend.persistWrite()
+}
+
+func (backend *Backend) putLocked(record *databroker.Record) {
+	backend.putAtLocked(record, timestamppb.Now())
+}
+
+// putAtLocked puts the record, modified at the given time.
+func (backend *Backend) putAtLocked(record *databroker.Record, modifiedAt *timestamppb.Timestamp) {
+	key := recordKey{Type: record.GetType(), ID: record.GetId()}
+	if record.GetDeletedAt() != nil && backend.cfg.isImmediateDelete(record.GetType()) {
+		backend.scrubChangesForLocked(key, record.GetDeletedAt())
+		record.Data = nil
+		record.Checksum = nil
+		record.Signature = nil
+	}
+
+	record.ModifiedAt = modifiedAt
 	record.Version = backend.nextVersion()
 	backend.changes.ReplaceOrInsert(recordChange{record: dup(record)})
 
-	key := recordKey{Type: record.GetType(), ID: record.GetId()}
+	_, exists := backend.lookup[key]
 	if record.GetDeletedAt() != nil {
 		delete(backend.lookup, key)
+		if exists {
+			backend.removeRecordTypeLocked(key.Type)
+		}
 	} else {
 		backend.lookup[key] = dup(record)
+		if !exists {
+			backend.recordTypes[key.Type]++
+		}
 	}
+}
 
-	return nil
+func (backend *Backend) removeRecordTypeLocked(recordType string) {
+	backend.recordTypes[recordType]--
+	if backend.recordTypes[recordType] <= 0 {
+		delete(backend.recordTypes, recordType)
+	}
+}
+
+// ListRecordTypes lists the distinct types of the records in the in-memory store.
+// Types whose records have all been deleted are excluded.
+func (backend *Backend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "listrecordtypes", "", nil) }(time.Now())
+
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+
+	recordTypes := make([]string, 0, len(backend.recordTypes))
+	for recordType := range backend.recordTypes {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	return recordTypes, nil
+}
+
+// scrubChangesForLocked removes the data from all the previous changes for the
+// given record and marks them as deleted. The changes are kept, rather than
+// removed, so that streamed versions remain contiguous.
+func (backend *Backend) scrubChangesForLocked(key recordKey, deletedAt *timestamppb.Timestamp) {
+	var scrubbed []*databroker.Record
+	backend.changes.Ascend(func(item btree.Item) bool {
+		change, ok := item.(recordChange)
+		if !ok {
+			panic(fmt.Sprintf("invalid type in changes btree: %T", item))
+		}
+		if change.record.GetType() == key.Type && change.record.GetId() == key.ID {
+			record := dup(change.record)
+			record.Data = nil
+			record.Checksum = nil
+			record.Signature = nil
+			record.DeletedAt = deletedAt
+			scrubbed = append(scrubbed, record)
+		}
+		return true
+	})
+	for _, record := range scrubbed {
+		backend.changes.ReplaceOrInsert(recordChange{record: record})
+	}
+}
+
+// PruneVersions prunes all but the latest max versions of each record of the
+// given type from the change log. Like deleted records' changes, pruned versions
+// are scrubbed of their data and marked as deleted rather than removed, so that
+// streamed versions remain contiguous.
+func (backend *Backend) PruneVersions(_ context.Context, recordType string, max int) (int, error) {
+	if max <= 0 {
+		return 0, nil
+	}
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	versions := make(map[string]int)
+	var pruned []*databroker.Record
+	backend.changes.Descend(func(item btree.Item) bool {
+		change, ok := item.(recordChange)
+		if !ok {
+			panic(fmt.Sprintf("invalid type in changes btree: %T", item))
+		}
+		if change.record.GetType() != recordType || change.record.GetDeletedAt() != nil {
+			return true
+		}
+		versions[change.record.GetId()]++
+		if versions[change.record.GetId()] > max {
+			record := dup(change.record)
+			record.Data = nil
+			record.Checksum = nil
+			record.Signature = nil
+			record.DeletedAt = timestamppb.Now()
+			pruned = append(pruned, record)
+		}
+		return true
+	})
+	for _, record := range pruned {
+		backend.changes.ReplaceOrInsert(recordChange{record: record})
+	}
+	return len(pruned), nil
 }
 
 // Sync returns a record stream for any changes after version.
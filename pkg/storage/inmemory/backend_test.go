@@ -2,7 +2,9 @@ package inmemory
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
 )
 
 func TestBackend(t *testing.T) {
@@ -98,6 +101,127 @@ func TestExpiry(t *testing.T) {
 	require.Len(t, records, 0)
 }
 
+func TestPreserveModifiedAt(t *testing.T) {
+	ctx := context.Background()
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	modifiedAt := timestamppb.New(time.Now().Add(-time.Hour))
+	require.NoError(t, backend.Put(storage.WithPreserveModifiedAt(ctx), &databroker.Record{Type: "TYPE", Id: "2", ModifiedAt: modifiedAt}))
+	record, err := backend.Get(ctx, "TYPE", "2")
+	require.NoError(t, err)
+	assert.Equal(t, modifiedAt.AsTime(), record.GetModifiedAt().AsTime())
+
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", ModifiedAt: modifiedAt}))
+	record, err = backend.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	assert.True(t, record.GetModifiedAt().AsTime().After(modifiedAt.AsTime()),
+		"the modification time should be set to the time of the write")
+
+	backend.removeChangesBefore(time.Now().Add(-time.Minute))
+	stream, err := backend.Sync(ctx, 0)
+	require.NoError(t, err)
+	var ids []string
+	for stream.Next(false) {
+		ids = append(ids, stream.Record().GetId())
+	}
+	_ = stream.Close()
+	assert.Equal(t, []string{"1"}, ids, "the change should be removed by its preserved modification time")
+}
+
+func TestTypeExpiries(t *testing.T) {
+	ctx := context.Background()
+	backend := New(
+		WithExpiry(time.Hour),
+		WithTypeExpiries(map[string]time.Duration{"DIRECTORY": time.Minute, "SESSION": time.Hour * 2}))
+	defer func() { _ = backend.Close() }()
+
+	for _, recordType := range []string{"SESSION", "DIRECTORY", "USER", "DIRECTORY"} {
+		assert.NoError(t, backend.Put(ctx, &databroker.Record{
+			Type:      recordType,
+			Id:        "1",
+			DeletedAt: timestamppb.Now(),
+		}))
+	}
+	changes := func() []string {
+		stream, err := backend.Sync(ctx, 0)
+		require.NoError(t, err)
+		defer func() { _ = stream.Close() }()
+		var recordTypes []string
+		for stream.Next(false) {
+			recordTypes = append(recordTypes, stream.Record().GetType())
+		}
+		return recordTypes
+	}
+
+	backend.sweep(time.Now().Add(time.Minute * 5))
+	assert.Equal(t, []string{"SESSION", "USER"}, changes(), "should remove the changes of types with a shorter expiry")
+
+	backend.sweep(time.Now().Add(time.Minute * 90))
+	assert.Equal(t, []string{"SESSION"}, changes(), "should fall back to the expiry")
+
+	backend.sweep(time.Now().Add(time.Hour * 3))
+	assert.Empty(t, changes())
+}
+
+func TestSweepWindows(t *testing.T) {
+	ctx := context.Background()
+	windows, err := storage.ParseSweepWindows([]string{"01:00-05:00"})
+	require.NoError(t, err)
+	backend := New(WithExpiry(0), WithSweepWindows(windows))
+	defer func() { _ = backend.Close() }()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, backend.Put(ctx, &databroker.Record{
+			Type: "TYPE",
+			Id:   fmt.Sprint(i),
+		}))
+	}
+	countChanges := func() int {
+		stream, err := backend.Sync(ctx, 0)
+		require.NoError(t, err)
+		defer func() { _ = stream.Close() }()
+		n := 0
+		for stream.Next(false) {
+			n++
+		}
+		return n
+	}
+
+	tomorrow := time.Now().UTC().Truncate(time.Hour * 24).Add(time.Hour * 24)
+	backend.sweep(tomorrow.Add(time.Hour * 12))
+	assert.Equal(t, 10, countChanges(), "should defer the sweep outside the window")
+
+	backend.sweep(tomorrow.Add(time.Hour * 3))
+	assert.Equal(t, 0, countChanges(), "should sweep inside the window")
+}
+
+func TestDisableSweep(t *testing.T) {
+	ctx := context.Background()
+	backend := New(WithExpiry(time.Millisecond), WithDisableSweep(true))
+	defer func() { _ = backend.Close() }()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, backend.Put(ctx, &databroker.Record{
+			Type:      "TYPE",
+			Id:        fmt.Sprint(i),
+			DeletedAt: timestamppb.Now(),
+		}))
+	}
+
+	backend.sweep(time.Now().Add(time.Hour))
+
+	stream, err := backend.Sync(ctx, 0)
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+	n := 0
+	for stream.Next(false) {
+		assert.NotNil(t, stream.Record().GetDeletedAt())
+		n++
+	}
+	assert.Equal(t, 10, n, "deleted records should remain past their retention")
+}
+
 func TestConcurrency(t *testing.T) {
 	ctx := context.Background()
 	backend := New()
@@ -150,3 +274,244 @@ func TestStream(t *testing.T) {
 	})
 	require.NoError(t, eg.Wait())
 }
+
+func TestReplaceAll(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	getIDs := func(records []*databroker.Record) []string {
+		var ids []string
+		for _, record := range records {
+			if record.GetType() == "TYPE" {
+				ids = append(ids, record.GetId())
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	for _, id := range []string{"A", "B", "C"} {
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: id}))
+	}
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "OTHER", Id: "A"}))
+	_, version, err := backend.GetAll(ctx)
+	require.NoError(t, err)
+
+	stream, err := backend.Sync(ctx, version)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	// watchers should only ever observe the before or after state
+	var eg errgroup.Group
+	done := make(chan struct{})
+	eg.Go(func() error {
+		for {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+			records, _, err := backend.GetAll(ctx)
+			if err != nil {
+				return err
+			}
+			ids := getIDs(records)
+			if !assert.ObjectsAreEqual([]string{"A", "B", "C"}, ids) &&
+				!assert.ObjectsAreEqual([]string{"B", "C", "D"}, ids) {
+				return fmt.Errorf("observed a half-applied state: %v", ids)
+			}
+		}
+	})
+
+	require.NoError(t, backend.ReplaceAll(ctx, "TYPE", []*databroker.Record{
+		{Type: "TYPE", Id: "B"},
+		{Type: "TYPE", Id: "C"},
+		{Type: "TYPE", Id: "D"},
+	}))
+	close(done)
+	assert.NoError(t, eg.Wait())
+
+	records, _, err := backend.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B", "C", "D"}, getIDs(records))
+	_, err = backend.Get(ctx, "OTHER", "A")
+	assert.NoError(t, err, "other types should be untouched")
+
+	// all the changes should be available to the stream at once
+	changes := map[string]bool{}
+	for stream.Next(false) {
+		changes[stream.Record().GetId()] = stream.Record().GetDeletedAt() != nil
+	}
+	assert.Equal(t, map[string]bool{"A": true, "B": false, "C": false, "D": false}, changes)
+
+	t.Run("mismatched type", func(t *testing.T) {
+		assert.Error(t, backend.ReplaceAll(ctx, "TYPE", []*databroker.Record{{Type: "OTHER", Id: "A"}}))
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	stream, err := backend.Sync(ctx, 0)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	t.Run("commit", func(t *testing.T) {
+		require.NoError(t, storage.WithinTransaction(ctx, backend, func(tx storage.Transaction) error {
+			if err := tx.Put(ctx, &databroker.Record{Type: "TYPE", Id: "A"}); err != nil {
+				return err
+			}
+			if _, err := tx.Get(ctx, "TYPE", "A"); err != nil {
+				return err
+			}
+			return tx.Put(ctx, &databroker.Record{Type: "TYPE", Id: "B"})
+		}))
+
+		for _, id := range []string{"A", "B"} {
+			_, err := backend.Get(ctx, "TYPE", id)
+			assert.NoError(t, err)
+		}
+		var ids []string
+		for stream.Next(false) {
+			ids = append(ids, stream.Record().GetId())
+		}
+		assert.Equal(t, []string{"A", "B"}, ids)
+	})
+	t.Run("rollback", func(t *testing.T) {
+		errRollback := errors.New("rollback")
+		assert.ErrorIs(t, storage.WithinTransaction(ctx, backend, func(tx storage.Transaction) error {
+			_ = tx.Put(ctx, &databroker.Record{Type: "TYPE", Id: "C"})
+			_ = tx.Put(ctx, &databroker.Record{Type: "TYPE", Id: "D"})
+			return errRollback
+		}), errRollback)
+
+		for _, id := range []string{"C", "D"} {
+			_, err := backend.Get(ctx, "TYPE", id)
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+		assert.False(t, stream.Next(false), "no changes should be streamed")
+	})
+}
+
+func TestImmediateDelete(t *testing.T) {
+	ctx := context.Background()
+	backend := New(WithImmediateDelete([]string{"IMMEDIATE"}))
+	defer func() { _ = backend.Close() }()
+
+	data, _ := anypb.New(&databroker.Record{Id: "DATA"})
+	for _, recordType := range []string{"IMMEDIATE", "NORMAL"} {
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: recordType, Id: "1", Data: data}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: recordType, Id: "1", Data: data, DeletedAt: timestamppb.Now()}))
+	}
+
+	stream, err := backend.Sync(ctx, 0)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var versions []uint64
+	for stream.Next(false) {
+		record := stream.Record()
+		versions = append(versions, record.GetVersion())
+		if record.GetType() == "IMMEDIATE" {
+			assert.NotNil(t, record.GetDeletedAt())
+			assert.Nil(t, record.GetData(), "immediately deleted records should not be recoverable")
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4}, versions, "versions should remain contiguous")
+	assert.NotNil(t, backend.getSince(3)[0].GetData(), "soft-deleted records should keep their data")
+}
+
+func TestPruneVersions(t *testing.T) {
+	ctx := context.Background()
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	data, _ := anypb.New(&databroker.Record{Id: "DATA"})
+	for i := 0; i < 3; i++ {
+		for _, key := range [][2]string{{"PRUNED", "1"}, {"PRUNED", "2"}, {"OTHER", "1"}} {
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: key[0], Id: key[1], Data: data}))
+		}
+	}
+
+	pruned, err := backend.PruneVersions(ctx, "PRUNED", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned, "the oldest version of each record should be pruned")
+	pruned, err = backend.PruneVersions(ctx, "PRUNED", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned, "pruned versions should not be pruned again")
+
+	var versions []uint64
+	retained := map[string]int{}
+	for _, record := range backend.getSince(0) {
+		versions = append(versions, record.GetVersion())
+		if record.GetDeletedAt() == nil {
+			retained[record.GetType()+"/"+record.GetId()]++
+		} else {
+			assert.Nil(t, record.GetData(), "pruned versions should not be recoverable")
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9}, versions, "versions should remain contiguous")
+	assert.Equal(t, map[string]int{"PRUNED/1": 2, "PRUNED/2": 2, "OTHER/1": 3}, retained)
+
+	record, err := backend.Get(ctx, "PRUNED", "1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), record.GetVersion(), "the latest version should be unaffected")
+}
+
+func TestExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+	read, err := backend.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	// the record changes after it's read
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+
+	del := func(version uint64) error {
+		return backend.Put(storage.WithExpectedVersion(ctx, "TYPE", "1", version),
+			&databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()})
+	}
+	assert.ErrorIs(t, del(read.GetVersion()), storage.ErrVersionConflict)
+	_, err = backend.Get(ctx, "TYPE", "1")
+	assert.NoError(t, err, "the record should not be deleted")
+
+	assert.NoError(t, del(read.GetVersion()+1))
+	_, err = backend.Get(ctx, "TYPE", "1")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, del(read.GetVersion()+1), storage.ErrVersionConflict, "a deleted record should conflict")
+
+	// other records are unaffected by the expected version
+	assert.NoError(t, backend.Put(storage.WithExpectedVersion(ctx, "TYPE", "1", 1),
+		&databroker.Record{Type: "TYPE", Id: "2"}))
+}
+
+func TestListRecordTypes(t *testing.T) {
+	ctx := context.Background()
+	backend := New()
+	defer func() { _ = backend.Close() }()
+
+	for _, record := range []*databroker.Record{
+		{Type: "A", Id: "1"},
+		{Type: "A", Id: "2"},
+		{Type: "B", Id: "1"},
+		{Type: "C", Id: "1"},
+		{Type: "C", Id: "1", DeletedAt: timestamppb.Now()},
+	} {
+		require.NoError(t, backend.Put(ctx, record))
+	}
+	recordTypes, err := backend.ListRecordTypes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A", "B"}, recordTypes, "types with only deleted records should be excluded")
+
+	require.NoError(t, backend.ReplaceAll(ctx, "A", nil))
+	recordTypes, err = backend.ListRecordTypes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"B"}, recordTypes)
+}
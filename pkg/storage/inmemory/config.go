@@ -1,10 +1,30 @@
 package inmemory
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
 
 type config struct {
-	degree int
-	expiry time.Duration
+	degree      int
+	expiry      time.Duration
+	persistPath string
+
+	persistDurability PersistDurability
+	persistInterval   time.Duration
+	compactOnStartup  bool
+
+	sweepWindows storage.SweepWindows
+	disableSweep bool
+
+	immediateDeleteTypes map[string]struct{}
+	typeExpiries         map[string]time.Duration
+
+	recordTypeMetrics bool
+	knownRecordTypes  map[string]struct{}
 }
 
 // An Option customizes the in-memory backend.
@@ -14,6 +34,8 @@ func getConfig(options ...Option) *config {
 	cfg := &config{
 		degree: 16,
 		expiry: time.Hour,
+
+		persistInterval: DefaultPersistInterval,
 	}
 	for _, option := range options {
 		option(cfg)
@@ -34,3 +56,168 @@ func WithExpiry(expiry time.Duration) Option {
 		cfg.expiry = expiry
 	}
 }
+
+// WithSweepWindows restricts the sweeps for expired changes to the given windows.
+// Changes which expire outside the windows are removed once a window opens.
+func WithSweepWindows(windows storage.SweepWindows) Option {
+	return func(cfg *config) {
+		cfg.sweepWindows = windows
+	}
+}
+
+// WithDisableSweep disables the sweeps for expired changes, for when they're
+// removed by an external process instead.
+func WithDisableSweep(disabled bool) Option {
+	return func(cfg *config) {
+		cfg.disableSweep = disabled
+	}
+}
+
+// WithPersistPath sets a file to persist the backend's state to. State is loaded
+// from the file when the backend is created and written to it when the backend is
+// closed, and as often as the persist durability requires.
+func WithPersistPath(path string) Option {
+	return func(cfg *config) {
+		cfg.persistPath = path
+	}
+}
+
+// DefaultPersistInterval is the default interval between writes of the persisted
+// state with PersistPeriodic durability.
+const DefaultPersistInterval = time.Second * 10
+
+// A PersistDurability determines how often the persisted state is written, and so
+// how many writes may be lost if the process exits without closing the backend.
+// Every write of the persisted state is fsync'd.
+type PersistDurability int
+
+// PersistDurability values.
+const (
+	// PersistOnShutdown writes the state only when the backend is closed or
+	// flushed. Nothing is lost on a clean shutdown, but every write since startup
+	// or the last flush is lost on a crash.
+	PersistOnShutdown PersistDurability = iota
+	// PersistPeriodic also writes the state every persist interval, if it
+	// changed. Up to a persist interval of writes is lost on a crash.
+	PersistPeriodic
+	// PersistEveryWrite writes the state before every Put and ReplaceAll returns.
+	// No acknowledged writes are lost on a crash, but every write pays for writing
+	// out the whole state.
+	PersistEveryWrite
+)
+
+// String returns the name of the persist durability.
+func (durability PersistDurability) String() string {
+	switch durability {
+	case PersistOnShutdown:
+		return "shutdown"
+	case PersistPeriodic:
+		return "periodic"
+	case PersistEveryWrite:
+		return "every-write"
+	}
+	return fmt.Sprintf("PersistDurability(%d)", int(durability))
+}
+
+// WithPersistDurability sets how often the state is written to the persist path.
+// The default is PersistOnShutdown.
+func WithPersistDurability(durability PersistDurability) Option {
+	return func(cfg *config) {
+		cfg.persistDurability = durability
+	}
+}
+
+// WithPersistInterval sets the interval between writes of the persisted state with
+// PersistPeriodic durability.
+func WithPersistInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.persistInterval = interval
+	}
+}
+
+// WithCompactOnStartup enables a compaction pass when the backend is created, after
+// its state is restored from the persist path, which drops the expired changes of
+// deleted records immediately, regardless of the sweep windows.
+func WithCompactOnStartup(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.compactOnStartup = enabled
+	}
+}
+
+// WithImmediateDelete sets record types which are deleted immediately. When a
+// record of one of these types is deleted, its previous changes are removed and
+// the change for the deletion doesn't include the record data.
+func WithImmediateDelete(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.immediateDeleteTypes = make(map[string]struct{}, len(recordTypes))
+		for _, recordType := range recordTypes {
+			cfg.immediateDeleteTypes[recordType] = struct{}{}
+		}
+	}
+}
+
+func (cfg *config) isImmediateDelete(recordType string) bool {
+	_, ok := cfg.immediateDeleteTypes[recordType]
+	return ok
+}
+
+// WithTypeExpiries sets the expiry for the changes of records of the given types,
+// overriding the expiry set by WithExpiry. An expiry of 0 expires the changes of
+// the type at the next sweep.
+func WithTypeExpiries(expiries map[string]time.Duration) Option {
+	return func(cfg *config) {
+		cfg.typeExpiries = expiries
+	}
+}
+
+// expiryFor returns the expiry for the changes of records of the given type.
+func (cfg *config) expiryFor(recordType string) time.Duration {
+	if expiry, ok := cfg.typeExpiries[recordType]; ok {
+		return expiry
+	}
+	return cfg.expiry
+}
+
+// minExpiry returns the shortest expiry for the changes of records of any type.
+func (cfg *config) minExpiry() time.Duration {
+	expiry := cfg.expiry
+	for _, typeExpiry := range cfg.typeExpiries {
+		if typeExpiry < expiry {
+			expiry = typeExpiry
+		}
+	}
+	return expiry
+}
+
+// WithRecordTypeMetrics enables the record_type label on operation metrics.
+func WithRecordTypeMetrics(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.recordTypeMetrics = enabled
+	}
+}
+
+// WithKnownRecordTypes bounds the record_type label on operation metrics to the
+// given record types. Any other record type is reported as "other". If unset the
+// label is not bounded.
+func WithKnownRecordTypes(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.knownRecordTypes = make(map[string]struct{}, len(recordTypes))
+		for _, recordType := range recordTypes {
+			cfg.knownRecordTypes[recordType] = struct{}{}
+		}
+	}
+}
+
+// recordTypeLabel returns the value of the record_type label for the given
+// record type, or "" if the label is disabled.
+func (cfg *config) recordTypeLabel(recordType string) string {
+	if !cfg.recordTypeMetrics || recordType == "" {
+		return ""
+	}
+	if cfg.knownRecordTypes != nil {
+		if _, ok := cfg.knownRecordTypes[recordType]; !ok {
+			return metrics.StorageRecordTypeOther
+		}
+	}
+	return recordType
+}
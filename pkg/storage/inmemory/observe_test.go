@@ -0,0 +1,46 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestRecordOperation(t *testing.T) {
+	getTags := func(t *testing.T, v *view.View, key string) []string {
+		rows, err := view.RetrieveData(v.Name)
+		require.NoError(t, err)
+
+		var values []string
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key.Name() == key {
+					values = append(values, tag.Value)
+				}
+			}
+		}
+		return values
+	}
+
+	view.Unregister(metrics.StorageViews...)
+	require.NoError(t, view.Register(metrics.StorageViews...))
+	defer view.Unregister(metrics.StorageViews...)
+
+	ctx := context.Background()
+	backend := New(WithRecordTypeMetrics(true), WithKnownRecordTypes([]string{"known"}))
+	defer func() { _ = backend.Close() }()
+
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "known", Id: "1"}))
+	_, err := backend.Get(ctx, "unknown", "1")
+	require.Error(t, err)
+
+	assert.ElementsMatch(t, []string{"get", "put"}, getTags(t, metrics.StorageOperationDurationView, "operation"))
+	assert.ElementsMatch(t, []string{"known", "other"}, getTags(t, metrics.StorageOperationDurationView, "record_type"))
+	assert.Equal(t, []string{"not_found"}, getTags(t, metrics.StorageOperationErrorsView, "error_class"))
+}
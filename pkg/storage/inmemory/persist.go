@@ -0,0 +1,119 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// load restores the backend's state from the file at path. A missing file is
+// ignored and a corrupt file is logged, leaving the backend empty.
+func (backend *Backend) load(path string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Info().Str("path", path).Msg("inmemory: no persisted state found, starting empty")
+		return
+	} else if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("inmemory: failed to open persisted state, starting empty")
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := backend.Restore(f); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("inmemory: failed to load persisted state, starting empty")
+		return
+	}
+	log.Info().Str("path", path).Msg("inmemory: loaded persisted state")
+}
+
+// persist writes a snapshot of the backend's state to the file at path, unless the
+// backend is closed, in which case the state was already persisted by Close.
+func (backend *Backend) persist(path string) error {
+	backend.persistMu.Lock()
+	defer backend.persistMu.Unlock()
+
+	select {
+	case <-backend.closed:
+		return nil
+	default:
+	}
+	return backend.persistLocked(path)
+}
+
+// persistLocked writes a snapshot of the backend's state to the file at path. The
+// snapshot is written to a temporary file first so that a failed write never
+// corrupts existing state.
+func (backend *Backend) persistLocked(path string) error {
+	version := atomic.LoadUint64(&backend.lastVersion)
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("inmemory: error creating persisted state file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	err = backend.Snapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("inmemory: error writing persisted state: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("inmemory: error writing persisted state: %w", err)
+	}
+	backend.persistedVersion = version
+	return nil
+}
+
+// persistWrite writes a snapshot of the backend's state after a write, if every
+// write must be durable.
+func (backend *Backend) persistWrite() error {
+	if backend.cfg.persistPath == "" || backend.cfg.persistDurability != PersistEveryWrite {
+		return nil
+	}
+	return backend.persist(backend.cfg.persistPath)
+}
+
+// persistPeriodically writes a snapshot of the backend's state every persist
+// interval, if it changed, until the backend is closed.
+func (backend *Backend) persistPeriodically() {
+	ticker := time.NewTicker(backend.cfg.persistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-backend.closed:
+			return
+		case <-ticker.C:
+		}
+
+		backend.persistMu.Lock()
+		changed := atomic.LoadUint64(&backend.lastVersion) != backend.persistedVersion
+		backend.persistMu.Unlock()
+		if !changed {
+			continue
+		}
+
+		if err := backend.persist(backend.cfg.persistPath); err != nil {
+			log.Warn().Err(err).Str("path", backend.cfg.persistPath).Msg("inmemory: failed to persist state")
+		}
+	}
+}
+
+// Flush writes a snapshot of the backend's state to the persist path, if one is
+// set, so that the persisted state is consistent with the backend.
+func (backend *Backend) Flush(ctx context.Context) error {
+	if backend.cfg.persistPath == "" {
+		return nil
+	}
+	return backend.persist(backend.cfg.persistPath)
+}
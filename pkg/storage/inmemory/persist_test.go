@@ -0,0 +1,145 @@
+package inmemory
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestPersistPath(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("restart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+		backend := New(WithPersistPath(path))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2"}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2", DeletedAt: timestamppb.Now()}))
+		require.NoError(t, backend.Close())
+
+		restarted := New(WithPersistPath(path))
+		defer func() { _ = restarted.Close() }()
+
+		record, err := restarted.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), record.GetVersion())
+
+		records, version, err := restarted.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 1)
+		assert.Equal(t, uint64(3), version)
+		assert.Len(t, restarted.getSince(0), 3, "should restore soft-deleted records")
+	})
+	t.Run("compact on startup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+		backend := New(WithPersistPath(path))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2"}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2", DeletedAt: timestamppb.Now()}))
+		require.NoError(t, backend.Close())
+
+		// every change is expired by the time the store is restored
+		time.Sleep(time.Millisecond * 10)
+
+		restarted := New(WithPersistPath(path), WithExpiry(time.Millisecond))
+		assert.Len(t, restarted.getSince(0), 3, "should keep expired changes until they're swept")
+		require.NoError(t, restarted.Close())
+
+		compacted := New(WithPersistPath(path), WithExpiry(time.Millisecond), WithCompactOnStartup(true))
+		defer func() { _ = compacted.Close() }()
+		changes := compacted.getSince(0)
+		if assert.Len(t, changes, 1, "should remove the expired changes of deleted records") {
+			assert.Equal(t, "1", changes[0].GetId())
+		}
+		_, err := compacted.Get(ctx, "TYPE", "1")
+		assert.NoError(t, err, "should keep live records")
+	})
+	t.Run("flush", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+		backend := New(WithPersistPath(path))
+		defer func() { _ = backend.Close() }()
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+		require.NoError(t, backend.Flush(ctx))
+
+		flushed := New(WithPersistPath(path))
+		defer func() { _ = flushed.Close() }()
+		_, err := flushed.Get(ctx, "TYPE", "1")
+		assert.NoError(t, err, "flushed records should be persisted before close")
+	})
+	t.Run("periodic", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+		backend := New(WithPersistPath(path),
+			WithPersistDurability(PersistPeriodic),
+			WithPersistInterval(time.Millisecond*10))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+
+		// the backend isn't closed, as if the process exited abruptly
+		assert.Eventually(t, func() bool {
+			restarted := New(WithPersistPath(path))
+			defer func() { _ = restarted.Close() }()
+			_, err := restarted.Get(ctx, "TYPE", "1")
+			return err == nil
+		}, time.Second*5, time.Millisecond*10, "writes should be persisted within the persist interval")
+
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2"}))
+		require.NoError(t, backend.Close())
+
+		restarted := New(WithPersistPath(path))
+		defer func() { _ = restarted.Close() }()
+		records, _, err := restarted.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 2, "writes should survive a clean shutdown")
+	})
+	t.Run("every write", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+		backend := New(WithPersistPath(path), WithPersistDurability(PersistEveryWrite))
+		defer func() { _ = backend.Close() }()
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+		require.NoError(t, backend.ReplaceAll(ctx, "OTHER", []*databroker.Record{{Type: "OTHER", Id: "1"}}))
+
+		restarted := New(WithPersistPath(path))
+		defer func() { _ = restarted.Close() }()
+		records, _, err := restarted.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 2, "acknowledged writes should be persisted")
+	})
+	t.Run("missing", func(t *testing.T) {
+		backend := New(WithPersistPath(filepath.Join(t.TempDir(), "missing")))
+		defer func() { _ = backend.Close() }()
+
+		records, version, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+		assert.Equal(t, uint64(0), version)
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "corrupt")
+		require.NoError(t, ioutil.WriteFile(path, []byte("CORRUPT"), 0o600))
+
+		backend := New(WithPersistPath(path))
+		records, _, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, records, "should start empty")
+
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+		require.NoError(t, backend.Close(), "should overwrite the corrupt file")
+
+		restarted := New(WithPersistPath(path))
+		defer func() { _ = restarted.Close() }()
+		_, err = restarted.Get(ctx, "TYPE", "1")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,193 @@
+package inmemory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/btree"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// snapshotMagic identifies an in-memory backend snapshot.
+var snapshotMagic = []byte("pomerium-inmemory-snapshot\n")
+
+// snapshotFormatVersion is the version of the snapshot format written by Snapshot.
+// It must be incremented whenever the format changes. Restore rejects snapshots
+// with a newer format version than it knows about.
+const snapshotFormatVersion = 1
+
+// maxSnapshotRecordSize limits the size of a single record in a snapshot so that a
+// corrupt snapshot doesn't cause a huge allocation.
+const maxSnapshotRecordSize = 64 << 20
+
+// Snapshot writes the full state of the backend to w. This includes all the records,
+// the record version and the change log, which contains soft-deleted records.
+//
+// The format is:
+//
+//	magic
+//	uvarint format version
+//	uvarint last version
+//	uvarint number of records, followed by each length-prefixed record
+//	uvarint number of changes, followed by each length-prefixed record
+func (backend *Backend) Snapshot(w io.Writer) error {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	sw := &snapshotWriter{w: bw}
+	sw.write(snapshotMagic)
+	sw.writeUvarint(snapshotFormatVersion)
+	sw.writeUvarint(backend.lastVersion)
+
+	sw.writeUvarint(uint64(len(backend.lookup)))
+	for _, record := range backend.lookup {
+		sw.writeRecord(record)
+	}
+
+	sw.writeUvarint(uint64(backend.changes.Len()))
+	backend.changes.Ascend(func(item btree.Item) bool {
+		change, ok := item.(recordChange)
+		if !ok {
+			panic(fmt.Sprintf("invalid type in changes btree: %T", item))
+		}
+		sw.writeRecord(change.record)
+		return sw.err == nil
+	})
+
+	if sw.err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", sw.err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the full state of the backend with a snapshot read from r. If the
+// snapshot is invalid the backend is left unchanged.
+func (backend *Backend) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return fmt.Errorf("inmemory: invalid snapshot")
+	}
+
+	formatVersion, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("inmemory: error reading snapshot: %w", err)
+	}
+	if formatVersion != snapshotFormatVersion {
+		return fmt.Errorf("inmemory: unsupported snapshot format version: %d", formatVersion)
+	}
+
+	lastVersion, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("inmemory: error reading snapshot: %w", err)
+	}
+
+	records, err := readSnapshotRecords(br)
+	if err != nil {
+		return fmt.Errorf("inmemory: error reading snapshot records: %w", err)
+	}
+	lookup := make(map[recordKey]*databroker.Record, len(records))
+	recordTypes := make(map[string]int)
+	for _, record := range records {
+		key := recordKey{Type: record.GetType(), ID: record.GetId()}
+		if _, ok := lookup[key]; !ok {
+			recordTypes[key.Type]++
+		}
+		lookup[key] = record
+	}
+
+	changeRecords, err := readSnapshotRecords(br)
+	if err != nil {
+		return fmt.Errorf("inmemory: error reading snapshot changes: %w", err)
+	}
+	changes := btree.New(backend.cfg.degree)
+	for _, record := range changeRecords {
+		changes.ReplaceOrInsert(recordChange{record: record})
+	}
+
+	backend.mu.Lock()
+	backend.lastVersion = lastVersion
+	backend.lookup = lookup
+	backend.changes = changes
+	backend.recordTypes = recordTypes
+	backend.mu.Unlock()
+
+	backend.onChange.Broadcast()
+	return nil
+}
+
+func readSnapshotRecords(br *bufio.Reader) ([]*databroker.Record, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*databroker.Record
+	for i := uint64(0); i < n; i++ {
+		sz, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if sz > maxSnapshotRecordSize {
+			return nil, fmt.Errorf("record too large: %d", sz)
+		}
+
+		bs := make([]byte, sz)
+		if _, err := io.ReadFull(br, bs); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		record := new(databroker.Record)
+		if err := proto.Unmarshal(bs, record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// A snapshotWriter writes snapshot data, remembering the first error.
+type snapshotWriter struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapshotWriter) write(bs []byte) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = sw.w.Write(bs)
+}
+
+func (sw *snapshotWriter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(sw.buf[:], v)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) writeRecord(record *databroker.Record) {
+	if sw.err != nil {
+		return
+	}
+	bs, err := proto.Marshal(record)
+	if err != nil {
+		sw.err = err
+		return
+	}
+	sw.writeUvarint(uint64(len(bs)))
+	sw.write(bs)
+}
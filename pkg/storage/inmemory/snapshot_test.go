@@ -0,0 +1,92 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	backend := New()
+	defer func() { _ = backend.Close() }()
+	for i := 0; i < 10; i++ {
+		data, err := anypb.New(timestamppb.Now())
+		require.NoError(t, err)
+		require.NoError(t, backend.Put(ctx, &databroker.Record{
+			Type:          "TYPE",
+			Id:            fmt.Sprint(i),
+			Data:          data,
+			SchemaVersion: 2,
+		}))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, backend.Put(ctx, &databroker.Record{
+			Type:      "TYPE",
+			Id:        fmt.Sprint(i),
+			DeletedAt: timestamppb.Now(),
+		}))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.Snapshot(&buf))
+
+	restored := New()
+	defer func() { _ = restored.Close() }()
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+
+	sortRecords := func(records []*databroker.Record) []*databroker.Record {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].GetId() < records[j].GetId()
+		})
+		return records
+	}
+
+	expectRecords, expectVersion, err := backend.GetAll(ctx)
+	require.NoError(t, err)
+	actualRecords, actualVersion, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, expectVersion, actualVersion)
+	assert.Len(t, actualRecords, 7)
+	assert.Empty(t, cmp.Diff(sortRecords(expectRecords), sortRecords(actualRecords), protocmp.Transform()))
+
+	expectChanges := backend.getSince(0)
+	actualChanges := restored.getSince(0)
+	assert.Len(t, actualChanges, 13)
+	assert.Empty(t, cmp.Diff(expectChanges, actualChanges, protocmp.Transform()),
+		"should restore the change log, including soft-deleted records")
+
+	require.NoError(t, restored.Put(ctx, &databroker.Record{Type: "TYPE", Id: "new"}))
+	record, err := restored.Get(ctx, "TYPE", "new")
+	require.NoError(t, err)
+	assert.Equal(t, expectVersion+1, record.GetVersion(), "should continue from the restored version")
+
+	t.Run("invalid", func(t *testing.T) {
+		b := New()
+		defer func() { _ = b.Close() }()
+		require.NoError(t, b.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+
+		assert.Error(t, b.Restore(bytes.NewReader([]byte("not a snapshot"))))
+		assert.Error(t, b.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-5])), "should reject truncated snapshots")
+
+		future := append([]byte{}, snapshotMagic...)
+		future = append(future, snapshotFormatVersion+1)
+		err := b.Restore(bytes.NewReader(future))
+		assert.Contains(t, fmt.Sprint(err), "unsupported snapshot format version")
+
+		_, err = b.Get(ctx, "TYPE", "1")
+		assert.NoError(t, err, "a failed restore should leave the backend unchanged")
+	})
+}
@@ -0,0 +1,61 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// WithinTransaction calls fn with a transaction. The backend is locked while fn
+// runs, so fn must not call the backend directly.
+func (backend *Backend) WithinTransaction(ctx context.Context, fn func(tx storage.Transaction) error) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	tx := &transaction{
+		backend: backend,
+		pending: make(map[recordKey]*databroker.Record),
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if len(tx.records) == 0 {
+		return nil
+	}
+	for _, record := range tx.records {
+		backend.putLocked(record)
+	}
+	backend.onChange.Broadcast()
+	return nil
+}
+
+type transaction struct {
+	backend *Backend
+	records []*databroker.Record
+	pending map[recordKey]*databroker.Record
+}
+
+func (tx *transaction) Get(_ context.Context, recordType, id string) (*databroker.Record, error) {
+	key := recordKey{Type: recordType, ID: id}
+	record, ok := tx.pending[key]
+	if !ok {
+		record, ok = tx.backend.lookup[key]
+	}
+	if !ok || record.GetDeletedAt() != nil {
+		return nil, storage.ErrNotFound
+	}
+	return dup(record), nil
+}
+
+func (tx *transaction) Put(_ context.Context, record *databroker.Record) error {
+	if record == nil {
+		return fmt.Errorf("records cannot be nil")
+	}
+
+	tx.records = append(tx.records, record)
+	tx.pending[recordKey{Type: record.GetType(), ID: record.GetId()}] = dup(record)
+	return nil
+}
@@ -0,0 +1,20 @@
+package storage
+
+// A CacheInvalidator is a Backend which caches records in-process, and can drop
+// them so that they're refetched from the underlying storage.
+type CacheInvalidator interface {
+	// InvalidateCache drops the cached records of the given type and id. An empty
+	// id drops every record of the type, and an empty type drops every record. It
+	// reports whether the backend has a cache.
+	InvalidateCache(recordType, id string) bool
+}
+
+// InvalidateCache invalidates the backend's cache if it has one. It reports
+// whether the backend supports it.
+func InvalidateCache(backend Backend, recordType, id string) bool {
+	c, ok := backend.(CacheInvalidator)
+	if !ok {
+		return false
+	}
+	return c.InvalidateCache(recordType, id)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// negativeCacheSize is the maximum number of not-found results to cache.
+const negativeCacheSize = 10000
+
+type negativeCacheBackend struct {
+	Backend
+	ttl   time.Duration
+	cache *lru.Cache
+
+	// generation is incremented on every invalidation so that a Get which raced
+	// with a Put doesn't cache a stale not-found result
+	mu         sync.Mutex
+	generation uint64
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewNegativeCacheBackend creates a new backend which caches not-found results
+// from Get for the given ttl. A cached result is invalidated as soon as the
+// record is written, either via Put or via a change observed on the underlying
+// backend's Sync stream. Reads with ConsistencyStrong, or which include deleted
+// records, bypass the cache.
+func NewNegativeCacheBackend(ttl time.Duration, underlying Backend) (Backend, error) {
+	cache, err := lru.New(negativeCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &negativeCacheBackend{
+		Backend: underlying,
+		ttl:     ttl,
+		cache:   cache,
+		cancel:  cancel,
+	}
+	go watchChanges(ctx, underlying, func(record *databroker.Record) {
+		c.invalidate(record.GetType(), record.GetId())
+	}, func(err error) {
+		log.Warn().Err(err).Msg("storage: negative cache invalidation stream closed, purging cache")
+		c.invalidateAll()
+	})
+	return c, nil
+}
+
+func (c *negativeCacheBackend) Close() error {
+	c.closeOnce.Do(c.cancel)
+	return c.Backend.Close()
+}
+
+func (c *negativeCacheBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	key := readCacheKey{recordType: recordType, id: id}
+
+	c.mu.Lock()
+	if v, ok := c.cache.Get(key); ok {
+		if time.Now().Before(v.(time.Time)) && GetConsistency(ctx) != ConsistencyStrong && !GetIncludeDeleted(ctx) {
+			c.mu.Unlock()
+			return nil, ErrNotFound
+		}
+		c.cache.Remove(key)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	record, err := c.Backend.Get(ctx, recordType, id)
+	if err == ErrNotFound {
+		c.mu.Lock()
+		if c.generation == generation {
+			c.cache.Add(key, time.Now().Add(c.ttl))
+		}
+		c.mu.Unlock()
+	}
+	return record, err
+}
+
+func (c *negativeCacheBackend) Put(ctx context.Context, record *databroker.Record) error {
+	err := c.Backend.Put(ctx, record)
+	c.invalidate(record.GetType(), record.GetId())
+	return err
+}
+
+func (c *negativeCacheBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	err := c.Backend.ReplaceAll(ctx, recordType, records)
+	c.invalidateAll()
+	return err
+}
+
+func (c *negativeCacheBackend) invalidate(recordType, id string) {
+	c.mu.Lock()
+	c.generation++
+	c.cache.Remove(readCacheKey{recordType: recordType, id: id})
+	c.mu.Unlock()
+}
+
+func (c *negativeCacheBackend) invalidateAll() {
+	c.mu.Lock()
+	c.generation++
+	c.cache.Purge()
+	c.mu.Unlock()
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestNegativeCacheBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var getCount int64
+	m := map[string]*databroker.Record{}
+	stream := newMockRecordStream(ctx)
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = record
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			atomic.AddInt64(&getCount, 1)
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+		sync: func(ctx context.Context, version uint64) (RecordStream, error) {
+			return stream, nil
+		},
+	}
+
+	c, err := NewNegativeCacheBackend(time.Minute, backend)
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	_, err = c.Get(ctx, "TYPE", "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Get(ctx, "TYPE", "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&getCount), "second miss should be served from the cache")
+
+	t.Run("put invalidates", func(t *testing.T) {
+		require.NoError(t, c.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1"}))
+
+		record, err := c.Get(ctx, "TYPE", "1")
+		require.NoError(t, err)
+		assert.Equal(t, "1", record.GetId())
+	})
+	t.Run("change notification invalidates", func(t *testing.T) {
+		_, err := c.Get(ctx, "TYPE", "2")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		m["2"] = &databroker.Record{Type: "TYPE", Id: "2"}
+		stream.records <- &databroker.Record{Type: "TYPE", Id: "2", Version: 2}
+
+		assert.Eventually(t, func() bool {
+			_, err := c.Get(ctx, "TYPE", "2")
+			return err == nil
+		}, time.Second*5, time.Millisecond*10)
+	})
+	t.Run("strong consistency", func(t *testing.T) {
+		_, err := c.Get(ctx, "TYPE", "4")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// the record was created in storage without an invalidation
+		m["4"] = &databroker.Record{Type: "TYPE", Id: "4"}
+		_, err = c.Get(ctx, "TYPE", "4")
+		assert.ErrorIs(t, err, ErrNotFound)
+		record, err := c.Get(WithConsistency(ctx, ConsistencyStrong), "TYPE", "4")
+		require.NoError(t, err, "strong reads should bypass the cache")
+		assert.Equal(t, "4", record.GetId())
+	})
+	t.Run("expires", func(t *testing.T) {
+		c, err := NewNegativeCacheBackend(time.Millisecond, backend)
+		require.NoError(t, err)
+		defer func() { _ = c.Close() }()
+
+		_, err = c.Get(ctx, "TYPE", "3")
+		assert.ErrorIs(t, err, ErrNotFound)
+		before := atomic.LoadInt64(&getCount)
+		time.Sleep(time.Millisecond * 5)
+		_, err = c.Get(ctx, "TYPE", "3")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, before+1, atomic.LoadInt64(&getCount))
+	})
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"bytes"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// compressedChangeMarker prefixes the compressed changes in the change log. It's
+// followed by the codec, another marker and the compressed record. A marshaled
+// record never starts with a zero byte, since 0 isn't a valid field number, so
+// changes written uncompressed are told apart from compressed ones whether or not
+// compression is enabled.
+const compressedChangeMarker = 0
+
+// marshalChange marshals a record for the change log, compressed with the given
+// codec. The record is stored uncompressed if there's no codec or it doesn't
+// compress.
+func marshalChange(codec string, record *databroker.Record) ([]byte, error) {
+	bs, err := proto.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if codec == "" {
+		return bs, nil
+	}
+
+	compressed, err := databroker.Compress(codec, bs)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed)+len(codec)+2 >= len(bs) {
+		return bs, nil
+	}
+
+	change := make([]byte, 0, len(compressed)+len(codec)+2)
+	change = append(change, compressedChangeMarker)
+	change = append(change, codec...)
+	change = append(change, compressedChangeMarker)
+	change = append(change, compressed...)
+	return change, nil
+}
+
+// unmarshalChange unmarshals a record from the change log, whether it was stored
+// compressed or not.
+func unmarshalChange(change []byte, record *databroker.Record) error {
+	if !isCompressedChange(change) {
+		return proto.Unmarshal(change, record)
+	}
+
+	i := bytes.IndexByte(change[1:], compressedChangeMarker)
+	if i < 0 {
+		return fmt.Errorf("redis: invalid compressed change")
+	}
+	codec := string(change[1 : i+1])
+	bs, err := databroker.Decompress(codec, change[i+2:])
+	if err != nil {
+		return fmt.Errorf("redis: invalid %s compressed change: %w", codec, err)
+	}
+	return proto.Unmarshal(bs, record)
+}
+
+func isCompressedChange(change []byte) bool {
+	return len(change) > 0 && change[0] == compressedChangeMarker
+}
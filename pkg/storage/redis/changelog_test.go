@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+func TestChangeCompression(t *testing.T) {
+	record := &databroker.Record{
+		Version: 1,
+		Type:    "TYPE",
+		Id:      "ID",
+		Data:    protoutil.NewAnyString(strings.Repeat("compressible ", 100)),
+	}
+	uncompressed, err := proto.Marshal(record)
+	require.NoError(t, err)
+
+	for _, codec := range databroker.SupportedCompressions {
+		t.Run(codec, func(t *testing.T) {
+			change, err := marshalChange(codec, record)
+			require.NoError(t, err)
+			assert.True(t, isCompressedChange(change))
+			assert.Less(t, len(change), len(uncompressed))
+
+			// changes are read the same way whether or not compression is enabled
+			var got databroker.Record
+			require.NoError(t, unmarshalChange(change, &got))
+			assert.True(t, proto.Equal(record, &got), "expected %v, got %v", record, &got)
+		})
+	}
+	t.Run("uncompressed", func(t *testing.T) {
+		change, err := marshalChange("", record)
+		require.NoError(t, err)
+		assert.Equal(t, uncompressed, change, "changes should be stored as is without compression")
+
+		var got databroker.Record
+		require.NoError(t, unmarshalChange(change, &got))
+		assert.True(t, proto.Equal(record, &got), "expected %v, got %v", record, &got)
+	})
+	t.Run("incompressible", func(t *testing.T) {
+		small := &databroker.Record{Version: 1, Type: "TYPE", Id: "ID"}
+		change, err := marshalChange(databroker.CompressionGzip, small)
+		require.NoError(t, err)
+		assert.False(t, isCompressedChange(change), "changes which don't compress should be stored as is")
+	})
+	t.Run("invalid", func(t *testing.T) {
+		var got databroker.Record
+		assert.Error(t, unmarshalChange([]byte{compressedChangeMarker, 'g', 'z'}, &got))
+		assert.Error(t, unmarshalChange(append([]byte{compressedChangeMarker}, "gzip\x00garbage"...), &got))
+	})
+}
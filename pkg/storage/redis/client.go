@@ -11,6 +11,9 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/strset"
+
+	"github.com/pomerium/pomerium/internal/log"
 )
 
 var (
@@ -43,7 +46,32 @@ var (
 	)
 )
 
-func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClient, error) {
+// paramAliases maps alternative query param names, as used by other datastores,
+// to the names used here.
+var paramAliases = map[string]string{
+	"pool_max_conns":  "pool_size",
+	"connect_timeout": "dial_timeout",
+}
+
+var (
+	poolParams = []string{
+		"max_retries", "min_retry_backoff", "max_retry_backoff",
+		"dial_timeout", "read_timeout", "write_timeout",
+		"pool_size", "min_idle_conns", "max_conn_age",
+		"pool_timeout", "idle_timeout", "idle_check_frequency",
+	}
+	standardParams = set.NewStringSet(append([]string{"db"}, poolParams...)...)
+	clusterParams  = set.NewStringSet(append([]string{
+		"max_redirects", "read_only", "route_by_latency", "route_randomly",
+	}, poolParams...)...)
+	sentinelParams = set.NewStringSet(append([]string{
+		"slave_only", "route_by_latency", "route_randomly", "use_disconnected_slaves",
+		"query_sentinel_randomly", "username", "password",
+	}, poolParams...)...)
+)
+
+func newClientFromURL(rawurl string, cfg *config, refresher *dnsRefresher) (redis.UniversalClient, error) {
+	tlsConfig := cfg.tls
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, err
@@ -51,7 +79,7 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 
 	switch {
 	case standardSchemes.Has(u.Scheme):
-		opts, err := redis.ParseURL(rawurl)
+		opts, err := ParseURL(rawurl)
 		if err != nil {
 			return nil, err
 		}
@@ -59,6 +87,9 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 		if opts.TLSConfig != nil {
 			opts.TLSConfig = tlsConfig
 		}
+		cfg.applyPoolOptions(&opts.PoolSize, &opts.MinIdleConns, &opts.DialTimeout)
+		cfg.applyCredentials(&opts.Username, &opts.Password)
+		cfg.applyDialer(refresher, &opts.Dialer, opts.DialTimeout, opts.TLSConfig)
 		return redis.NewClient(opts), nil
 
 	case clusterSchemes.Has(u.Scheme):
@@ -69,6 +100,9 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 		if opts.TLSConfig != nil {
 			opts.TLSConfig = tlsConfig
 		}
+		cfg.applyPoolOptions(&opts.PoolSize, &opts.MinIdleConns, &opts.DialTimeout)
+		cfg.applyCredentials(&opts.Username, &opts.Password)
+		cfg.applyDialer(refresher, &opts.Dialer, opts.DialTimeout, opts.TLSConfig)
 		return redis.NewClusterClient(opts), nil
 
 	case sentinelSchemes.Has(u.Scheme):
@@ -79,6 +113,9 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 		if opts.TLSConfig != nil {
 			opts.TLSConfig = tlsConfig
 		}
+		cfg.applyPoolOptions(&opts.PoolSize, &opts.MinIdleConns, &opts.DialTimeout)
+		cfg.applyCredentials(&opts.Username, &opts.Password)
+		cfg.applyDialer(refresher, &opts.Dialer, opts.DialTimeout, opts.TLSConfig)
 		return redis.NewFailoverClient(opts), nil
 
 	case sentinelClusterSchemes.Has(u.Scheme):
@@ -89,6 +126,9 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 		if opts.TLSConfig != nil {
 			opts.TLSConfig = tlsConfig
 		}
+		cfg.applyPoolOptions(&opts.PoolSize, &opts.MinIdleConns, &opts.DialTimeout)
+		cfg.applyCredentials(&opts.Username, &opts.Password)
+		cfg.applyDialer(refresher, &opts.Dialer, opts.DialTimeout, opts.TLSConfig)
 		return redis.NewFailoverClusterClient(opts), nil
 
 	default:
@@ -96,6 +136,102 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 	}
 }
 
+// applyDialer replaces the default dialer with one using the configured TCP
+// keepalive and tracked by the DNS refresher, if either is set.
+func (cfg *config) applyDialer(refresher *dnsRefresher, dialer *dialFunc, dialTimeout time.Duration, tlsConfig *tls.Config) {
+	keepAlive, ok := cfg.tcpKeepAlivePeriod()
+	if refresher == nil && !ok {
+		return
+	}
+	if dialTimeout == 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	*dialer = newDialer(dialTimeout, keepAlive, tlsConfig)
+	if refresher != nil {
+		*dialer = refresher.wrapDialer(*dialer)
+	}
+}
+
+// ParseURL parses a standard redis URL. Format is:
+//
+//    redis://[username:password@]host:port[/db][?param1=value1[&param2=value=2&...]]
+//    unix://[username:password@]/path/to/socket[?db=db[&param1=value1&...]]
+//
+// TLS is supported with rediss. Supported query params:
+//
+//    max_retries: int
+//    min_retry_backoff: duration
+//    max_retry_backoff: duration
+//    dial_timeout (or connect_timeout): duration
+//    read_timeout: duration
+//    write_timeout: duration
+//    pool_size (or pool_max_conns): int
+//    min_idle_conns: int
+//    max_conn_age: duration
+//    pool_timeout: duration
+//    idle_timeout: duration
+//    idle_check_frequency: duration
+//
+// Unknown query params are logged and ignored.
+func ParseURL(rawurl string) (*redis.Options, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	q := getQueryParams(u, standardParams)
+
+	// only the db param is understood by the underlying parser
+	base := *u
+	base.RawQuery = ""
+	if db := q.Get("db"); db != "" && u.Scheme == "unix" {
+		base.RawQuery = url.Values{"db": {db}}.Encode()
+	}
+	opts, err := redis.ParseURL(base.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := parseIntParam(&opts.MaxRetries, q, "max_retries"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.MinRetryBackoff, q, "min_retry_backoff"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.MaxRetryBackoff, q, "max_retry_backoff"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.DialTimeout, q, "dial_timeout"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.ReadTimeout, q, "read_timeout"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.WriteTimeout, q, "write_timeout"); err != nil {
+		return nil, err
+	}
+	if err := parseIntParam(&opts.PoolSize, q, "pool_size"); err != nil {
+		return nil, err
+	}
+	if err := parseIntParam(&opts.MinIdleConns, q, "min_idle_conns"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.MaxConnAge, q, "max_conn_age"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.PoolTimeout, q, "pool_timeout"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.IdleTimeout, q, "idle_timeout"); err != nil {
+		return nil, err
+	}
+	if err := parseDurationParam(&opts.IdleCheckFrequency, q, "idle_check_frequency"); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
 // ParseClusterURL parses a redis-cluster URL. Format is:
 //
 //    redis+cluster://[username:password@]host:port[,host2:port2,...]/[?param1=value1[&param2=value=2&...]]
@@ -109,16 +245,17 @@ func newClientFromURL(rawurl string, tlsConfig *tls.Config) (redis.UniversalClie
 //    max_retries: int
 //    min_retry_backoff: duration
 //    max_retry_backoff: duration
-//    dial_timeout: duration
+//    dial_timeout (or connect_timeout): duration
 //    read_timeout: duration
 //    write_timeout: duration
-//    pool_size: int
+//    pool_size (or pool_max_conns): int
 //    min_idle_conns: int
 //    max_conn_age: duration
 //    pool_timeout: duration
 //    idle_timeout: duration
 //    idle_check_frequency: duration
 //
+// Unknown query params are logged and ignored.
 func ParseClusterURL(rawurl string) (*redis.ClusterOptions, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
@@ -138,7 +275,7 @@ func ParseClusterURL(rawurl string) (*redis.ClusterOptions, error) {
 			net.JoinHostPort(host, port))
 	}
 
-	q := u.Query()
+	q := getQueryParams(u, clusterParams)
 	if err := parseIntParam(&opts.MaxRedirects, q, "max_redirects"); err != nil {
 		return nil, err
 	}
@@ -213,16 +350,17 @@ func ParseClusterURL(rawurl string) (*redis.ClusterOptions, error) {
 //    max_retries: int
 //    min_retry_backoff: duration
 //    max_retry_backoff: duration
-//    dial_timeout: duration
+//    dial_timeout (or connect_timeout): duration
 //    read_timeout: duration
 //    write_timeout: duration
-//    pool_size: int
+//    pool_size (or pool_max_conns): int
 //    min_idle_conns: int
 //    max_conn_age: duration
 //    pool_timeout: duration
 //    idle_timeout: duration
 //    idle_check_frequency: duration
 //
+// Unknown query params are logged and ignored.
 func ParseSentinelURL(rawurl string) (*redis.FailoverOptions, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
@@ -257,7 +395,7 @@ func ParseSentinelURL(rawurl string) (*redis.FailoverOptions, error) {
 		opts.SentinelPassword, _ = u.User.Password()
 	}
 
-	q := u.Query()
+	q := getQueryParams(u, sentinelParams)
 	if err := parseBoolParam(&opts.SlaveOnly, q, "slave_only"); err != nil {
 		return nil, err
 	}
@@ -319,6 +457,26 @@ func ParseSentinelURL(rawurl string) (*redis.FailoverOptions, error) {
 	return opts, nil
 }
 
+// getQueryParams returns the query params of the URL with any aliases resolved.
+// Params which aren't known are logged and ignored.
+func getQueryParams(u *url.URL, known *strset.Set) url.Values {
+	q := u.Query()
+	for alias, name := range paramAliases {
+		if vs, ok := q[alias]; ok {
+			if _, exists := q[name]; !exists {
+				q[name] = vs
+			}
+			delete(q, alias)
+		}
+	}
+	for name := range q {
+		if !known.Has(name) {
+			log.Warn().Str("param", name).Msg("redis: ignoring unknown connection string query param")
+		}
+	}
+	return q
+}
+
 func parseBoolParam(dst *bool, values url.Values, name string) error {
 	v := values.Get(name)
 	if v == "" {
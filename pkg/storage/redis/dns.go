@@ -0,0 +1,152 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// defaultDialTimeout is the go-redis default dial timeout.
+const defaultDialTimeout = 5 * time.Second
+
+// defaultTCPKeepAlive is the go-redis default TCP keepalive period.
+const defaultTCPKeepAlive = 5 * time.Minute
+
+type dialFunc = func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialer returns a dialer equivalent to the default go-redis dialer, with the
+// given TCP keepalive period. A negative period disables keepalives.
+func newDialer(dialTimeout, keepAlive time.Duration, tlsConfig *tls.Config) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		netDialer := newNetDialer(dialTimeout, keepAlive)
+		if tlsConfig == nil {
+			return netDialer.DialContext(ctx, network, addr)
+		}
+		return tls.DialWithDialer(netDialer, network, addr, tlsConfig)
+	}
+}
+
+func newNetDialer(dialTimeout, keepAlive time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: keepAlive,
+	}
+}
+
+// A dnsRefresher tracks the connections dialed to hostnames and periodically
+// re-resolves the hostnames, closing any connections to IPs which have been removed.
+// The redis client will then re-dial using the new IPs.
+type dnsRefresher struct {
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu    sync.Mutex
+	conns map[*dnsRefresherConn]struct{}
+}
+
+func newDNSRefresher(lookupHost func(ctx context.Context, host string) ([]string, error)) *dnsRefresher {
+	return &dnsRefresher{
+		lookupHost: lookupHost,
+		conns:      make(map[*dnsRefresherConn]struct{}),
+	}
+}
+
+// wrapDialer returns a dialer which tracks the connections created by dial.
+func (r *dnsRefresher) wrapDialer(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			// IPs and unix sockets never need to be re-resolved
+			return conn, nil
+		}
+
+		c := &dnsRefresherConn{Conn: conn, refresher: r, host: host}
+		r.mu.Lock()
+		r.conns[c] = struct{}{}
+		r.mu.Unlock()
+		return c, nil
+	}
+}
+
+// run refreshes the tracked connections at the given interval until done is closed.
+func (r *dnsRefresher) run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		r.refresh(ctx)
+		cancel()
+	}
+}
+
+// refresh re-resolves the hostnames of all the tracked connections and closes any
+// connections to IPs which the hostname no longer resolves to.
+func (r *dnsRefresher) refresh(ctx context.Context) {
+	r.mu.Lock()
+	byHost := map[string][]*dnsRefresherConn{}
+	for c := range r.conns {
+		byHost[c.host] = append(byHost[c.host], c)
+	}
+	r.mu.Unlock()
+
+	for host, conns := range byHost {
+		addrs, err := r.lookupHost(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			// keep the existing connections if the hostname can't be resolved
+			log.Warn().Err(err).Str("host", host).Msg("redis: failed to refresh DNS")
+			continue
+		}
+
+		ips := make(map[string]struct{}, len(addrs))
+		for _, addr := range addrs {
+			ips[normalizeIP(addr)] = struct{}{}
+		}
+
+		for _, c := range conns {
+			ip, _, err := net.SplitHostPort(c.RemoteAddr().String())
+			if err != nil {
+				continue
+			}
+			if _, ok := ips[normalizeIP(ip)]; ok {
+				continue
+			}
+			log.Info().Str("host", host).Str("ip", ip).Msg("redis: closing connection to removed IP")
+			_ = c.Close()
+		}
+	}
+}
+
+func normalizeIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+// A dnsRefresherConn is a connection tracked by a dnsRefresher.
+type dnsRefresherConn struct {
+	net.Conn
+	refresher *dnsRefresher
+	host      string
+}
+
+func (c *dnsRefresherConn) Close() error {
+	c.refresher.mu.Lock()
+	delete(c.refresher.conns, c)
+	c.refresher.mu.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockConn struct {
+	net.Conn
+	remoteAddr net.Addr
+	closed     int32
+}
+
+func (c *mockConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *mockConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *mockConn) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func TestDNSRefresher(t *testing.T) {
+	var mu sync.Mutex
+	ips := []string{"10.0.0.1", "10.0.0.2"}
+	refresher := newDNSRefresher(func(ctx context.Context, host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return ips, nil
+	})
+
+	next := 0
+	dial := refresher.wrapDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ip := ips[next%len(ips)]
+		next++
+		return &mockConn{remoteAddr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 6379}}, nil
+	})
+
+	var conns []*mockConn
+	for i := 0; i < 4; i++ {
+		conn, err := dial(context.Background(), "tcp", "redis.example.com:6379")
+		require.NoError(t, err)
+		conns = append(conns, conn.(*dnsRefresherConn).Conn.(*mockConn))
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go refresher.run(done, time.Millisecond*10)
+
+	// remove the first IP
+	mu.Lock()
+	ips = []string{"10.0.0.2", "10.0.0.3"}
+	mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		return conns[0].isClosed() && conns[2].isClosed()
+	}, time.Second*5, time.Millisecond*10, "connections to the removed IP should be closed")
+	assert.False(t, conns[1].isClosed(), "connections to remaining IPs should be kept")
+	assert.False(t, conns[3].isClosed(), "connections to remaining IPs should be kept")
+
+	t.Run("ip", func(t *testing.T) {
+		conn, err := dial(context.Background(), "tcp", "10.0.0.2:6379")
+		require.NoError(t, err)
+		_, ok := conn.(*dnsRefresherConn)
+		assert.False(t, ok, "connections to IPs should not be tracked")
+	})
+}
@@ -9,6 +9,7 @@ import (
 	pomeriumconfig "github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/storage"
 )
 
 type logger struct {
@@ -22,10 +23,12 @@ func init() {
 	redis.SetLogger(logger{})
 }
 
-func recordOperation(ctx context.Context, startTime time.Time, operation string, err error) {
+func recordOperation(ctx context.Context, cfg *config, startTime time.Time, operation, recordType string, err error) {
 	metrics.RecordStorageOperation(ctx, &metrics.StorageOperationTags{
-		Operation: operation,
-		Error:     err,
-		Backend:   pomeriumconfig.StorageRedisName,
+		Operation:  operation,
+		Error:      err,
+		ErrorClass: storage.ErrorClass(err),
+		Backend:    pomeriumconfig.StorageRedisName,
+		RecordType: cfg.recordTypeLabel(recordType),
 	}, time.Since(startTime))
 }
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+func TestRecordOperation(t *testing.T) {
+	getRecordTypes := func(t *testing.T) []string {
+		rows, err := view.RetrieveData(metrics.StorageOperationDurationView.Name)
+		require.NoError(t, err)
+
+		var recordTypes []string
+		for _, row := range rows {
+			for _, tag := range row.Tags {
+				if tag.Key == metrics.TagKeyStorageRecordType {
+					recordTypes = append(recordTypes, tag.Value)
+				}
+			}
+		}
+		return recordTypes
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options []Option
+		expect  []string
+	}{
+		{"disabled", nil, nil},
+		{"unbounded", []Option{WithRecordTypeMetrics(true)}, []string{"known", "unknown"}},
+		{"bounded", []Option{
+			WithRecordTypeMetrics(true),
+			WithKnownRecordTypes([]string{"known"}),
+		}, []string{"known", "other"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			view.Unregister(metrics.StorageViews...)
+			require.NoError(t, view.Register(metrics.StorageViews...))
+			defer view.Unregister(metrics.StorageViews...)
+
+			cfg := getConfig(tc.options...)
+			recordOperation(context.Background(), cfg, time.Now(), "get", "known", nil)
+			recordOperation(context.Background(), cfg, time.Now(), "get", "unknown", nil)
+
+			assert.ElementsMatch(t, tc.expect, getRecordTypes(t))
+		})
+	}
+}
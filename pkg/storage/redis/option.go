@@ -3,11 +3,36 @@ package redis
 import (
 	"crypto/tls"
 	"time"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/storage"
 )
 
 type config struct {
-	tls    *tls.Config
-	expiry time.Duration
+	tls          *tls.Config
+	expiry       time.Duration
+	sweepWindows storage.SweepWindows
+	disableSweep bool
+	poolSize     int
+	minIdleConns int
+	dialTimeout  time.Duration
+
+	username string
+	password string
+
+	tcpKeepAlive *time.Duration
+
+	dnsRefreshInterval time.Duration
+
+	immediateDeleteTypes map[string]struct{}
+	typeExpiries         map[string]time.Duration
+
+	recordTypeMetrics bool
+	knownRecordTypes  map[string]struct{}
+
+	keyPrefix string
+
+	changeCompression string
 }
 
 // Option customizes a Backend.
@@ -27,6 +52,215 @@ func WithExpiry(expiry time.Duration) Option {
 	}
 }
 
+// WithSweepWindows restricts the sweeps for expired changes to the given windows.
+// Changes which expire outside the windows are removed once a window opens.
+func WithSweepWindows(windows storage.SweepWindows) Option {
+	return func(cfg *config) {
+		cfg.sweepWindows = windows
+	}
+}
+
+// WithDisableSweep disables the sweeps for expired changes, for when they're
+// removed by an external process instead.
+func WithDisableSweep(disabled bool) Option {
+	return func(cfg *config) {
+		cfg.disableSweep = disabled
+	}
+}
+
+// WithPoolSize sets the maximum number of connections in the pool. It takes
+// precedence over the pool_size connection string query param.
+func WithPoolSize(poolSize int) Option {
+	return func(cfg *config) {
+		cfg.poolSize = poolSize
+	}
+}
+
+// WithMinIdleConns sets the minimum number of idle connections kept in the pool.
+// It takes precedence over the min_idle_conns connection string query param.
+func WithMinIdleConns(minIdleConns int) Option {
+	return func(cfg *config) {
+		cfg.minIdleConns = minIdleConns
+	}
+}
+
+// WithDialTimeout sets the timeout for establishing new connections. It takes
+// precedence over the dial_timeout connection string query param.
+func WithDialTimeout(dialTimeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.dialTimeout = dialTimeout
+	}
+}
+
+// WithCredentials sets the username and password used to authenticate with
+// redis ACLs. They take precedence over any credentials in the connection
+// string. An empty username or password leaves the connection string's.
+func WithCredentials(username, password string) Option {
+	return func(cfg *config) {
+		cfg.username = username
+		cfg.password = password
+	}
+}
+
+// WithTCPKeepAlive sets the TCP keepalive period for connections, so that
+// connections dropped by stateful firewalls are detected promptly. 0 disables
+// keepalives. If unset the go-redis default is used.
+func WithTCPKeepAlive(period time.Duration) Option {
+	return func(cfg *config) {
+		cfg.tcpKeepAlive = &period
+	}
+}
+
+// tcpKeepAlivePeriod returns the TCP keepalive period to use for the net.Dialer
+// and whether it was configured.
+func (cfg *config) tcpKeepAlivePeriod() (time.Duration, bool) {
+	switch {
+	case cfg.tcpKeepAlive == nil:
+		return defaultTCPKeepAlive, false
+	case *cfg.tcpKeepAlive <= 0:
+		// a negative keepalive disables keepalives for a net.Dialer
+		return -1, true
+	default:
+		return *cfg.tcpKeepAlive, true
+	}
+}
+
+// WithDNSRefreshInterval sets the interval at which the hostnames of the redis
+// endpoints are re-resolved. Connections to IPs which are no longer returned are
+// closed so that new connections use the current IPs. 0 disables refreshes.
+func WithDNSRefreshInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.dnsRefreshInterval = interval
+	}
+}
+
+// WithImmediateDelete sets record types which are deleted immediately. When a
+// record of one of these types is deleted, the data is removed from its previous
+// changes and the change for the deletion doesn't include the record data. The
+// versions of the changes of these records are indexed, so that a deletion only
+// reads the record's own changes rather than the whole change log. Changes
+// written before a type is set aren't indexed, so they keep their data until
+// they expire.
+func WithImmediateDelete(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.immediateDeleteTypes = make(map[string]struct{}, len(recordTypes))
+		for _, recordType := range recordTypes {
+			cfg.immediateDeleteTypes[recordType] = struct{}{}
+		}
+	}
+}
+
+func (cfg *config) isImmediateDelete(recordType string) bool {
+	_, ok := cfg.immediateDeleteTypes[recordType]
+	return ok
+}
+
+// WithTypeExpiries sets the expiry for the changes of records of the given types,
+// overriding the expiry set by WithExpiry. An expiry of 0 expires the changes of
+// the type at the next sweep.
+func WithTypeExpiries(expiries map[string]time.Duration) Option {
+	return func(cfg *config) {
+		cfg.typeExpiries = expiries
+	}
+}
+
+// expiryFor returns the expiry for the changes of records of the given type.
+func (cfg *config) expiryFor(recordType string) time.Duration {
+	if expiry, ok := cfg.typeExpiries[recordType]; ok {
+		return expiry
+	}
+	return cfg.expiry
+}
+
+// minExpiry returns the shortest expiry for the changes of records of any type.
+func (cfg *config) minExpiry() time.Duration {
+	expiry := cfg.expiry
+	for _, typeExpiry := range cfg.typeExpiries {
+		if typeExpiry < expiry {
+			expiry = typeExpiry
+		}
+	}
+	return expiry
+}
+
+// WithKeyPrefix namespaces the keys the records, changes and versions are stored
+// in, so that multiple installations can share a redis server without seeing
+// each other's records or version changes. An empty prefix uses the keys used
+// without a prefix. The prefix must not contain braces.
+func WithKeyPrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.keyPrefix = prefix
+	}
+}
+
+// WithChangeCompression compresses the records stored in the change log with the
+// given codec, to reduce the size of the change log. The current records aren't
+// compressed. Changes stored with compression enabled are still read once it's
+// disabled, and changes stored before it was enabled are read as is.
+func WithChangeCompression(codec string) Option {
+	return func(cfg *config) {
+		cfg.changeCompression = codec
+	}
+}
+
+// WithRecordTypeMetrics enables the record_type label on operation metrics.
+func WithRecordTypeMetrics(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.recordTypeMetrics = enabled
+	}
+}
+
+// WithKnownRecordTypes bounds the record_type label on operation metrics to the
+// given record types. Any other record type is reported as "other". If unset the
+// label is not bounded.
+func WithKnownRecordTypes(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.knownRecordTypes = make(map[string]struct{}, len(recordTypes))
+		for _, recordType := range recordTypes {
+			cfg.knownRecordTypes[recordType] = struct{}{}
+		}
+	}
+}
+
+// recordTypeLabel returns the value of the record_type label for the given
+// record type, or "" if the label is disabled.
+func (cfg *config) recordTypeLabel(recordType string) string {
+	if !cfg.recordTypeMetrics || recordType == "" {
+		return ""
+	}
+	if cfg.knownRecordTypes != nil {
+		if _, ok := cfg.knownRecordTypes[recordType]; !ok {
+			return metrics.StorageRecordTypeOther
+		}
+	}
+	return recordType
+}
+
+// applyPoolOptions overrides any pool settings from the connection string with
+// explicitly configured options.
+func (cfg *config) applyPoolOptions(poolSize, minIdleConns *int, dialTimeout *time.Duration) {
+	if cfg.poolSize > 0 {
+		*poolSize = cfg.poolSize
+	}
+	if cfg.minIdleConns > 0 {
+		*minIdleConns = cfg.minIdleConns
+	}
+	if cfg.dialTimeout > 0 {
+		*dialTimeout = cfg.dialTimeout
+	}
+}
+
+// applyCredentials overrides any credentials from the connection string with
+// explicitly configured credentials.
+func (cfg *config) applyCredentials(username, password *string) {
+	if cfg.username != "" {
+		*username = cfg.username
+	}
+	if cfg.password != "" {
+		*password = cfg.password
+	}
+}
+
 func getConfig(options ...Option) *config {
 	cfg := new(config)
 	WithExpiry(time.Hour * 24)(cfg)
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// ListRecordTypes lists the distinct types of the records in redis. The record
+// types are maintained in a set as records are written. Types whose records have
+// all been deleted are excluded.
+func (backend *Backend) ListRecordTypes(ctx context.Context) (recordTypes []string, err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.ListRecordTypes")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "listrecordtypes", "", err) }(time.Now())
+
+	if err := backend.backfillRecordTypes(ctx); err != nil {
+		return nil, err
+	}
+
+	members, err := backend.client.SMembers(ctx, backend.keys.recordTypes).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	recordTypes = make([]string, 0, len(members))
+	for _, recordType := range members {
+		ok, err := backend.hasRecordsOfType(ctx, recordType)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			recordTypes = append(recordTypes, recordType)
+		}
+	}
+	sort.Strings(recordTypes)
+	return recordTypes, nil
+}
+
+// backfillRecordTypes adds the types of all the existing records to the record
+// types set, for records written before the set was maintained. It is only done
+// once.
+func (backend *Backend) backfillRecordTypes(ctx context.Context) error {
+	backend.recordTypesMu.Lock()
+	defer backend.recordTypesMu.Unlock()
+
+	if backend.recordTypesBackfilled {
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+	iter := backend.client.HScan(ctx, backend.keys.records, 0, "", 0).Iterator()
+	for iter.Next(ctx) {
+		// skip the field
+		if !iter.Next(ctx) {
+			break
+		}
+
+		var record databroker.Record
+		if err := proto.Unmarshal([]byte(iter.Val()), &record); err != nil {
+			log.Warn().Err(err).Msg("redis: invalid record detected")
+			continue
+		}
+		seen[record.GetType()] = struct{}{}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(seen) > 0 {
+		members := make([]interface{}, 0, len(seen))
+		for recordType := range seen {
+			members = append(members, recordType)
+		}
+		if err := backend.client.SAdd(ctx, backend.keys.recordTypes, members...).Err(); err != nil {
+			return err
+		}
+	}
+
+	backend.recordTypesBackfilled = true
+	return nil
+}
+
+// hasRecordsOfType returns true if there is at least one record of the given type.
+func (backend *Backend) hasRecordsOfType(ctx context.Context, recordType string) (bool, error) {
+	_, prefix := backend.getHashKey(recordType, "")
+	iter := backend.client.HScan(ctx, backend.keys.records, 0, escapeGlob(prefix)+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		// skip the field
+		if !iter.Next(ctx) {
+			break
+		}
+
+		// the prefix may also match record types which contain a slash
+		var record databroker.Record
+		if err := proto.Unmarshal([]byte(iter.Val()), &record); err != nil {
+			continue
+		}
+		if record.GetType() == recordType {
+			return true, nil
+		}
+	}
+	return false, iter.Err()
+}
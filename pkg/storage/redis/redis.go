@@ -5,6 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,14 +27,41 @@ import (
 const (
 	maxTransactionRetries = 100
 	watchPollInterval     = 30 * time.Second
+)
+
+// keys are the names of the redis keys a Backend stores its data in.
+type keys struct {
+	lastVersion   string
+	lastVersionCh string
+	records       string
+	changes       string
+	// recordTypes is the set of record types which have been written
+	recordTypes string
+	// recordChanges is the prefix of the sorted sets indexing the versions of
+	// the changes of each record of an immediately deleted type
+	recordChanges string
+}
 
+// newKeys returns the keys of a Backend with the given key prefix. Backends with
+// different prefixes share no keys, including the channel version changes are
+// published on. Without a prefix the keys are those used before prefixes were
+// supported.
+func newKeys(prefix string) keys {
 	// we rely on transactions in redis, so all redis-cluster keys need to be
 	// on the same node. Using a `hash tag` gives us this capability.
-	lastVersionKey   = "{pomerium}.last_version"
-	lastVersionChKey = "{pomerium}.last_version_ch"
-	recordHashKey    = "{pomerium}.records"
-	changesSetKey    = "{pomerium}.changes"
-)
+	tag := "{pomerium}"
+	if prefix != "" {
+		tag = "{pomerium:" + prefix + "}"
+	}
+	return keys{
+		lastVersion:   tag + ".last_version",
+		lastVersionCh: tag + ".last_version_ch",
+		records:       tag + ".records",
+		changes:       tag + ".changes",
+		recordTypes:   tag + ".record_types",
+		recordChanges: tag + ".record_changes.",
+	}
+}
 
 // custom errors
 var (
@@ -40,11 +70,15 @@ var (
 
 // Backend implements the storage.Backend on top of redis.
 type Backend struct {
-	cfg *config
+	cfg  *config
+	keys keys
 
 	client   redis.UniversalClient
 	onChange *signal.Signal
 
+	recordTypesMu         sync.Mutex
+	recordTypesBackfilled bool
+
 	closeOnce sync.Once
 	closed    chan struct{}
 }
@@ -52,19 +86,33 @@ type Backend struct {
 // New creates a new redis storage backend.
 func New(rawURL string, options ...Option) (*Backend, error) {
 	cfg := getConfig(options...)
+	if strings.ContainsAny(cfg.keyPrefix, "{}") {
+		return nil, fmt.Errorf("redis: invalid key prefix: %s", cfg.keyPrefix)
+	}
+	if cfg.changeCompression != "" && !databroker.IsSupportedCompression(cfg.changeCompression) {
+		return nil, fmt.Errorf("redis: unsupported change compression codec: %s", cfg.changeCompression)
+	}
 	backend := &Backend{
 		cfg:      cfg,
+		keys:     newKeys(cfg.keyPrefix),
 		closed:   make(chan struct{}),
 		onChange: signal.New(),
 	}
+	var refresher *dnsRefresher
+	if cfg.dnsRefreshInterval > 0 {
+		refresher = newDNSRefresher(net.DefaultResolver.LookupHost)
+	}
 	var err error
-	backend.client, err = newClientFromURL(rawURL, backend.cfg.tls)
+	backend.client, err = newClientFromURL(rawURL, backend.cfg, refresher)
 	if err != nil {
 		return nil, err
 	}
+	if refresher != nil {
+		go refresher.run(backend.closed, cfg.dnsRefreshInterval)
+	}
 	metrics.AddRedisMetrics(backend.client.PoolStats)
 	go backend.listenForVersionChanges()
-	if cfg.expiry != 0 {
+	if cfg.expiry != 0 && !cfg.disableSweep {
 		go func() {
 			ticker := time.NewTicker(time.Minute)
 			defer ticker.Stop()
@@ -75,7 +123,7 @@ func New(rawURL string, options ...Option) (*Backend, error) {
 				case <-ticker.C:
 				}
 
-				backend.removeChangesBefore(time.Now().Add(-cfg.expiry))
+				backend.sweep(time.Now())
 			}
 		}()
 	}
@@ -92,13 +140,23 @@ func (backend *Backend) Close() error {
 	return err
 }
 
+// Check pings redis over one of the pooled connections, which are dialed with the
+// backend's TLS settings. It fails once the context is done.
+func (backend *Backend) Check(ctx context.Context) (err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.Check")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "check", "", err) }(time.Now())
+
+	return backend.client.Ping(ctx).Err()
+}
+
 // Get gets a record from redis.
 func (backend *Backend) Get(ctx context.Context, recordType, id string) (_ *databroker.Record, err error) {
 	_, span := trace.StartSpan(ctx, "databroker.redis.Get")
 	defer span.End()
-	defer func(start time.Time) { recordOperation(ctx, start, "get", err) }(time.Now())
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "get", recordType, err) }(time.Now())
 
-	key, field := getHashKey(recordType, id)
+	key, field := backend.getHashKey(recordType, id)
 	cmd := backend.client.HGet(ctx, key, field)
 	raw, err := cmd.Result()
 	if err == redis.Nil {
@@ -120,11 +178,11 @@ func (backend *Backend) Get(ctx context.Context, recordType, id string) (_ *data
 func (backend *Backend) GetAll(ctx context.Context) (records []*databroker.Record, latestRecordVersion uint64, err error) {
 	_, span := trace.StartSpan(ctx, "databroker.redis.GetAll")
 	defer span.End()
-	defer func(start time.Time) { recordOperation(ctx, start, "getall", err) }(time.Now())
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "getall", "", err) }(time.Now())
 
 	p := backend.client.Pipeline()
-	lastVersionCmd := p.Get(ctx, lastVersionKey)
-	resultsCmd := p.HVals(ctx, recordHashKey)
+	lastVersionCmd := p.Get(ctx, backend.keys.lastVersion)
+	resultsCmd := p.HVals(ctx, backend.keys.records)
 	_, err = p.Exec(ctx)
 	if err != nil {
 		return nil, 0, err
@@ -154,38 +212,321 @@ func (backend *Backend) GetAll(ctx context.Context) (records []*databroker.Recor
 	return records, latestRecordVersion, nil
 }
 
+// StreamAll streams all the records in redis as they're scanned, in batches of
+// about batchSize records. Unlike GetAll, the records aren't a snapshot: records
+// changed while scanning may be newer than the returned version.
+func (backend *Backend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (latestRecordVersion uint64, err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.StreamAll")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "streamall", "", err) }(time.Now())
+
+	latestRecordVersion, err = backend.client.Get(ctx, backend.keys.lastVersion).Uint64()
+	if errors.Is(err, redis.Nil) {
+		latestRecordVersion = 0
+	} else if err != nil {
+		return 0, err
+	}
+
+	// HSCAN may return a field more than once
+	seen := map[string]struct{}{}
+	var cursor uint64
+	for {
+		var results []string
+		results, cursor, err = backend.client.HScan(ctx, backend.keys.records, cursor, "", int64(batchSize)).Result()
+		if err != nil {
+			return 0, err
+		}
+
+		records := make([]*databroker.Record, 0, len(results)/2)
+		for i := 0; i+1 < len(results); i += 2 {
+			if _, ok := seen[results[i]]; ok {
+				continue
+			}
+			seen[results[i]] = struct{}{}
+
+			var record databroker.Record
+			err := proto.Unmarshal([]byte(results[i+1]), &record)
+			if err != nil {
+				log.Warn().Err(err).Msg("redis: invalid record detected")
+				continue
+			}
+			records = append(records, &record)
+		}
+		if len(records) > 0 {
+			if err = fn(records); err != nil {
+				return 0, err
+			}
+		}
+
+		if cursor == 0 {
+			return latestRecordVersion, nil
+		}
+	}
+}
+
 // Put puts a record into redis.
 func (backend *Backend) Put(ctx context.Context, record *databroker.Record) (err error) {
 	_, span := trace.StartSpan(ctx, "databroker.redis.Put")
 	defer span.End()
-	defer func(start time.Time) { recordOperation(ctx, start, "put", err) }(time.Now())
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "put", record.GetType(), err) }(time.Now())
 
+	indexChanges := backend.cfg.isImmediateDelete(record.GetType())
+	immediateDelete := indexChanges && record.GetDeletedAt() != nil
+	var scrubbed []redis.Z
+	var oldestVersion uint64
 	return backend.incrementVersion(ctx,
 		func(tx *redis.Tx, version uint64) error {
-			record.ModifiedAt = timestamppb.Now()
+			// the expected version is compared in the transaction, so it fails if
+			// the record is changed before it's committed
+			if err := backend.checkExpectedVersion(ctx, tx, record); err != nil {
+				return err
+			}
+
+			record.ModifiedAt = storage.GetPreserveModifiedAt(ctx, record)
 			record.Version = version
-			return nil
+			var err error
+			switch {
+			case immediateDelete:
+				record.Data = nil
+				record.Checksum = nil
+				record.Signature = nil
+
+				scrubbed, err = backend.getChangesFor(ctx, tx, record.GetType(), record.GetId())
+			case indexChanges:
+				oldestVersion, err = backend.getOldestChangeVersion(ctx, tx)
+			}
+			return err
 		},
 		func(p redis.Pipeliner, version uint64) error {
 			bs, err := proto.Marshal(record)
 			if err != nil {
 				return err
 			}
+			changeBytes, err := marshalChange(backend.cfg.changeCompression, record)
+			if err != nil {
+				return err
+			}
+
+			// replace the previous changes for the record with scrubbed copies
+			for _, z := range scrubbed {
+				var change databroker.Record
+				if err := unmarshalChange([]byte(z.Member.(string)), &change); err != nil {
+					return err
+				}
+				change.Data = nil
+				change.Checksum = nil
+				change.Signature = nil
+				change.DeletedAt = record.GetDeletedAt()
+				scrubbedBytes, err := marshalChange(backend.cfg.changeCompression, &change)
+				if err != nil {
+					return err
+				}
+				p.ZRem(ctx, backend.keys.changes, z.Member)
+				p.ZAdd(ctx, backend.keys.changes, &redis.Z{Score: z.Score, Member: scrubbedBytes})
+			}
+			switch {
+			case immediateDelete:
+				// the scrubbed changes don't need to be found again
+				p.Del(ctx, backend.getRecordChangesKey(record.GetType(), record.GetId()))
+			case indexChanges:
+				backend.indexChange(ctx, p, record, oldestVersion)
+			}
 
-			key, field := getHashKey(record.GetType(), record.GetId())
+			key, field := backend.getHashKey(record.GetType(), record.GetId())
 			if record.DeletedAt != nil {
 				p.HDel(ctx, key, field)
 			} else {
 				p.HSet(ctx, key, field, bs)
+				p.SAdd(ctx, backend.keys.recordTypes, record.GetType())
 			}
-			p.ZAdd(ctx, changesSetKey, &redis.Z{
+			p.ZAdd(ctx, backend.keys.changes, &redis.Z{
 				Score:  float64(version),
-				Member: bs,
+				Member: changeBytes,
 			})
 			return nil
 		})
 }
 
+// checkExpectedVersion returns an error wrapping storage.ErrVersionConflict if
+// the context expects the record to be at a different version than the current
+// one.
+func (backend *Backend) checkExpectedVersion(ctx context.Context, tx *redis.Tx, record *databroker.Record) error {
+	if storage.CheckExpectedVersion(ctx, record, nil) == nil {
+		// no version is expected
+		return nil
+	}
+
+	key, field := backend.getHashKey(record.GetType(), record.GetId())
+	raw, err := tx.HGet(ctx, key, field).Result()
+	if errors.Is(err, redis.Nil) {
+		return storage.CheckExpectedVersion(ctx, record, nil)
+	} else if err != nil {
+		return err
+	}
+	var current databroker.Record
+	if err := proto.Unmarshal([]byte(raw), &current); err != nil {
+		return err
+	}
+	return storage.CheckExpectedVersion(ctx, record, &current)
+}
+
+// getChangesFor returns the changes for the given record which are still in the
+// change log, from the index of their versions.
+func (backend *Backend) getChangesFor(ctx context.Context, tx *redis.Tx, recordType, id string) ([]redis.Z, error) {
+	versions, err := tx.ZRange(ctx, backend.getRecordChangesKey(recordType, id), 0, -1).Result()
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+
+	cmds := make([]*redis.ZSliceCmd, 0, len(versions))
+	_, err = tx.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, version := range versions {
+			cmds = append(cmds, p.ZRangeByScoreWithScores(ctx, backend.keys.changes, &redis.ZRangeBy{
+				Min: version,
+				Max: version,
+			}))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []redis.Z
+	for _, cmd := range cmds {
+		changes = append(changes, cmd.Val()...)
+	}
+	return changes, nil
+}
+
+// getOldestChangeVersion returns the version of the oldest change in the change
+// log, or 0 if it's empty.
+func (backend *Backend) getOldestChangeVersion(ctx context.Context, tx *redis.Tx) (uint64, error) {
+	oldest, err := tx.ZRangeWithScores(ctx, backend.keys.changes, 0, 0).Result()
+	if err != nil || len(oldest) == 0 {
+		return 0, err
+	}
+	return uint64(oldest[0].Score), nil
+}
+
+// indexChange adds the version of the change for a record to the index of the
+// versions of its changes, and trims the versions of the changes which have been
+// removed from the change log.
+func (backend *Backend) indexChange(ctx context.Context, p redis.Pipeliner, record *databroker.Record, oldestVersion uint64) {
+	key := backend.getRecordChangesKey(record.GetType(), record.GetId())
+	p.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatUint(oldestVersion, 10))
+	p.ZAdd(ctx, key, &redis.Z{
+		Score:  float64(record.GetVersion()),
+		Member: strconv.FormatUint(record.GetVersion(), 10),
+	})
+}
+
+// ReplaceAll replaces all the records of the given type in redis in a single transaction.
+func (backend *Backend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) (err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.ReplaceAll")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "replaceall", recordType, err) }(time.Now())
+
+	keep := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		if record.GetType() != recordType {
+			return fmt.Errorf("redis: record type %s does not match %s", record.GetType(), recordType)
+		}
+		_, field := backend.getHashKey(record.GetType(), record.GetId())
+		keep[field] = struct{}{}
+	}
+
+	txf := func(tx *redis.Tx) error {
+		version, err := tx.Get(ctx, backend.keys.lastVersion).Uint64()
+		if errors.Is(err, redis.Nil) {
+			version = 0
+		} else if err != nil {
+			return err
+		}
+
+		// find the existing records of this type which should be deleted
+		_, prefix := backend.getHashKey(recordType, "")
+		var deleted []*databroker.Record
+		iter := tx.HScan(ctx, backend.keys.records, 0, escapeGlob(prefix)+"*", 0).Iterator()
+		for iter.Next(ctx) {
+			field := iter.Val()
+			if !iter.Next(ctx) {
+				break
+			}
+			if _, ok := keep[field]; ok {
+				continue
+			}
+
+			var record databroker.Record
+			if err := proto.Unmarshal([]byte(iter.Val()), &record); err != nil {
+				log.Warn().Err(err).Msg("redis: invalid record detected")
+				record = databroker.Record{Type: recordType, Id: strings.TrimPrefix(field, prefix)}
+			}
+			deleted = append(deleted, &record)
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+
+		now := timestamppb.Now()
+		for _, record := range deleted {
+			record.DeletedAt = now
+			if backend.cfg.isImmediateDelete(recordType) {
+				record.Data = nil
+				record.Checksum = nil
+				record.Signature = nil
+			}
+		}
+		changes := append(append([]*databroker.Record{}, records...), deleted...)
+
+		var oldestVersion uint64
+		if backend.cfg.isImmediateDelete(recordType) {
+			oldestVersion, err = backend.getOldestChangeVersion(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			for _, record := range changes {
+				version++
+				record.ModifiedAt = now
+				record.Version = version
+
+				bs, err := proto.Marshal(record)
+				if err != nil {
+					return err
+				}
+				changeBytes, err := marshalChange(backend.cfg.changeCompression, record)
+				if err != nil {
+					return err
+				}
+
+				key, field := backend.getHashKey(record.GetType(), record.GetId())
+				if record.DeletedAt != nil {
+					p.HDel(ctx, key, field)
+				} else {
+					p.HSet(ctx, key, field, bs)
+					p.SAdd(ctx, backend.keys.recordTypes, record.GetType())
+				}
+				p.ZAdd(ctx, backend.keys.changes, &redis.Z{
+					Score:  float64(version),
+					Member: changeBytes,
+				})
+				if backend.cfg.isImmediateDelete(recordType) {
+					backend.indexChange(ctx, p, record, oldestVersion)
+				}
+			}
+			p.Set(ctx, backend.keys.lastVersion, version, 0)
+			p.Publish(ctx, backend.keys.lastVersionCh, version)
+			return nil
+		})
+		return err
+	}
+
+	return backend.runTransaction(ctx, txf)
+}
+
 // Sync returns a record stream of any records changed after the specified version.
 func (backend *Backend) Sync(ctx context.Context, version uint64) (storage.RecordStream, error) {
 	return newRecordStream(ctx, backend, version), nil
@@ -199,7 +540,7 @@ func (backend *Backend) incrementVersion(ctx context.Context,
 ) error {
 	// code is modeled on https://pkg.go.dev/github.com/go-redis/redis/v8#example-Client.Watch
 	txf := func(tx *redis.Tx) error {
-		version, err := tx.Get(ctx, lastVersionKey).Uint64()
+		version, err := tx.Get(ctx, backend.keys.lastVersion).Uint64()
 		if errors.Is(err, redis.Nil) {
 			version = 0
 		} else if err != nil {
@@ -218,17 +559,23 @@ func (backend *Backend) incrementVersion(ctx context.Context,
 			if err != nil {
 				return err
 			}
-			p.Set(ctx, lastVersionKey, version, 0)
-			p.Publish(ctx, lastVersionChKey, version)
+			p.Set(ctx, backend.keys.lastVersion, version, 0)
+			p.Publish(ctx, backend.keys.lastVersionCh, version)
 			return nil
 		})
 		return err
 	}
 
+	return backend.runTransaction(ctx, txf)
+}
+
+// runTransaction runs txf while watching the last version key, retrying if the
+// last version changes before the transaction is committed.
+func (backend *Backend) runTransaction(ctx context.Context, txf func(tx *redis.Tx) error) error {
 	bo := backoff.NewExponentialBackOff()
 	bo.MaxElapsedTime = 0
 	for i := 0; i < maxTransactionRetries; i++ {
-		err := backend.client.Watch(ctx, txf, lastVersionKey)
+		err := backend.client.Watch(ctx, txf, backend.keys.lastVersion)
 		if errors.Is(err, redis.TxFailedErr) {
 			select {
 			case <-ctx.Done():
@@ -258,7 +605,7 @@ func (backend *Backend) listenForVersionChanges() {
 
 outer:
 	for {
-		pubsub := backend.client.Subscribe(ctx, lastVersionChKey)
+		pubsub := backend.client.Subscribe(ctx, backend.keys.lastVersionCh)
 		for {
 			msg, err := pubsub.Receive(ctx)
 			if err != nil {
@@ -280,10 +627,82 @@ outer:
 	}
 }
 
+// sweep removes the expired changes at now, if now is within a sweep window and
+// sweeps aren't disabled.
+func (backend *Backend) sweep(now time.Time) {
+	if backend.cfg.disableSweep || !backend.cfg.sweepWindows.Contains(now) {
+		return
+	}
+	if len(backend.cfg.typeExpiries) > 0 {
+		backend.removeExpiredChanges(now)
+		return
+	}
+	backend.removeChangesBefore(now.Add(-backend.cfg.expiry))
+}
+
+// removeExpiredChangesBatchSize is the number of changes read at a time when
+// removing the changes expired by the expiry of the type of their record.
+const removeExpiredChangesBatchSize = 100
+
+// removeExpiredChanges removes the changes expired at now by the expiry of the
+// type of their record. Changes are removed wherever they are in the change log,
+// up to the first change which hasn't expired for any type.
+func (backend *Backend) removeExpiredChanges(now time.Time) {
+	ctx := context.Background()
+	latestCutoff := now.Add(-backend.cfg.minExpiry())
+
+	// kept is the number of unexpired changes before the next batch
+	var kept int64
+	for {
+		results, err := backend.client.ZRangeByScore(ctx, backend.keys.changes, &redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    "+inf",
+			Offset: kept,
+			Count:  removeExpiredChangesBatchSize,
+		}).Result()
+		if err != nil {
+			log.Error().Err(err).Msg("redis: error retrieving changes for expiration")
+			return
+		}
+
+		var expired []interface{}
+		done := len(results) < removeExpiredChangesBatchSize
+		for _, result := range results {
+			var record databroker.Record
+			if err := unmarshalChange([]byte(result), &record); err != nil {
+				log.Warn().Err(err).Msg("redis: invalid record detected")
+				expired = append(expired, result)
+				continue
+			}
+
+			modifiedAt := record.GetModifiedAt().AsTime()
+			if modifiedAt.After(latestCutoff) {
+				done = true
+				break
+			}
+			if modifiedAt.After(now.Add(-backend.cfg.expiryFor(record.GetType()))) {
+				kept++
+				continue
+			}
+			expired = append(expired, result)
+		}
+
+		if len(expired) > 0 {
+			if err := backend.client.ZRem(ctx, backend.keys.changes, expired...).Err(); err != nil {
+				log.Error().Err(err).Msg("redis: error removing members")
+				return
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
 func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 	ctx := context.Background()
 	for {
-		cmd := backend.client.ZRangeByScore(ctx, changesSetKey, &redis.ZRangeBy{
+		cmd := backend.client.ZRangeByScore(ctx, backend.keys.changes, &redis.ZRangeBy{
 			Min:    "-inf",
 			Max:    "+inf",
 			Offset: 0,
@@ -301,7 +720,7 @@ func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 		}
 
 		var record databroker.Record
-		err = proto.Unmarshal([]byte(results[0]), &record)
+		err = unmarshalChange([]byte(results[0]), &record)
 		if err != nil {
 			log.Warn().Err(err).Msg("redis: invalid record detected")
 			record.ModifiedAt = timestamppb.New(cutoff.Add(-time.Second)) // set the modified so will delete it
@@ -313,7 +732,7 @@ func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 		}
 
 		// remove the record
-		err = backend.client.ZRem(ctx, changesSetKey, results[0]).Err()
+		err = backend.client.ZRem(ctx, backend.keys.changes, results[0]).Err()
 		if err != nil {
 			log.Error().Err(err).Msg("redis: error removing member")
 			return
@@ -321,6 +740,19 @@ func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 	}
 }
 
-func getHashKey(recordType, id string) (key, field string) {
-	return recordHashKey, fmt.Sprintf("%s/%s", recordType, id)
+var globReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// escapeGlob escapes any redis glob-style pattern characters in s.
+func escapeGlob(s string) string {
+	return globReplacer.Replace(s)
+}
+
+func (backend *Backend) getHashKey(recordType, id string) (key, field string) {
+	return backend.keys.records, fmt.Sprintf("%s/%s", recordType, id)
+}
+
+// getRecordChangesKey returns the key of the index of the versions of the changes
+// of a record. It shares the hash tag of the other keys.
+func (backend *Backend) getRecordChangesKey(recordType, id string) string {
+	return backend.keys.recordChanges + recordType + "/" + id
 }
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/pomerium/pomerium/internal/testutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
 )
 
 func TestBackend(t *testing.T) {
@@ -76,6 +78,109 @@ func TestBackend(t *testing.T) {
 			assert.Len(t, records, 1000)
 			assert.Equal(t, uint64(1002), version)
 		})
+		t.Run("stream all records", func(t *testing.T) {
+			ids := map[string]struct{}{}
+			batches := 0
+			version, err := backend.StreamAll(ctx, 100, func(records []*databroker.Record) error {
+				batches++
+				for _, record := range records {
+					ids[record.GetId()] = struct{}{}
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, ids, 1000)
+			assert.Greater(t, batches, 1, "records should be streamed in batches")
+			assert.Equal(t, uint64(1002), version)
+		})
+		t.Run("replace all", func(t *testing.T) {
+			for _, id := range []string{"A", "B", "C"} {
+				require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "REPLACE", Id: id}))
+			}
+			_, version, err := backend.GetAll(ctx)
+			require.NoError(t, err)
+
+			require.NoError(t, backend.ReplaceAll(ctx, "REPLACE", []*databroker.Record{
+				{Type: "REPLACE", Id: "B"},
+				{Type: "REPLACE", Id: "C"},
+				{Type: "REPLACE", Id: "D"},
+			}))
+
+			_, err = backend.Get(ctx, "REPLACE", "A")
+			assert.Error(t, err)
+			for _, id := range []string{"B", "C", "D"} {
+				_, err = backend.Get(ctx, "REPLACE", id)
+				assert.NoError(t, err)
+			}
+
+			stream, err := backend.Sync(ctx, version)
+			require.NoError(t, err)
+			defer stream.Close()
+			changes := map[string]bool{}
+			for len(changes) < 4 && stream.Next(true) {
+				changes[stream.Record().GetId()] = stream.Record().GetDeletedAt() != nil
+			}
+			assert.Equal(t, map[string]bool{"A": true, "B": false, "C": false, "D": false}, changes)
+		})
+		t.Run("transaction", func(t *testing.T) {
+			require.NoError(t, backend.WithinTransaction(ctx, func(tx storage.Transaction) error {
+				if err := tx.Put(ctx, &databroker.Record{Type: "TX", Id: "A"}); err != nil {
+					return err
+				}
+				if _, err := tx.Get(ctx, "TX", "A"); err != nil {
+					return err
+				}
+				return tx.Put(ctx, &databroker.Record{Type: "TX", Id: "B"})
+			}))
+			for _, id := range []string{"A", "B"} {
+				_, err := backend.Get(ctx, "TX", id)
+				assert.NoError(t, err)
+			}
+
+			errRollback := errors.New("rollback")
+			assert.ErrorIs(t, backend.WithinTransaction(ctx, func(tx storage.Transaction) error {
+				_ = tx.Put(ctx, &databroker.Record{Type: "TX", Id: "C"})
+				_ = tx.Put(ctx, &databroker.Record{Type: "TX", Id: "D"})
+				return errRollback
+			}), errRollback)
+			for _, id := range []string{"C", "D"} {
+				_, err := backend.Get(ctx, "TX", id)
+				assert.ErrorIs(t, err, storage.ErrNotFound)
+			}
+		})
+		t.Run("list record types", func(t *testing.T) {
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "LIST/A", Id: "1"}))
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "LIST/B", Id: "1"}))
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "LIST/B", Id: "1", DeletedAt: timestamppb.Now()}))
+
+			recordTypes, err := backend.ListRecordTypes(ctx)
+			require.NoError(t, err)
+			assert.Contains(t, recordTypes, "LIST/A")
+			assert.NotContains(t, recordTypes, "LIST/B", "types with only deleted records should be excluded")
+		})
+		t.Run("expected version", func(t *testing.T) {
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "EXPECTED", Id: "1"}))
+			read, err := backend.Get(ctx, "EXPECTED", "1")
+			require.NoError(t, err)
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "EXPECTED", Id: "1"}))
+
+			del := func(version uint64) error {
+				return backend.Put(storage.WithExpectedVersion(ctx, "EXPECTED", "1", version),
+					&databroker.Record{Type: "EXPECTED", Id: "1", DeletedAt: timestamppb.Now()})
+			}
+			assert.ErrorIs(t, del(read.GetVersion()), storage.ErrVersionConflict)
+			assert.NoError(t, del(read.GetVersion()+1))
+			_, err = backend.Get(ctx, "EXPECTED", "1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		})
+		t.Run("warmup", func(t *testing.T) {
+			require.NoError(t, backend.Warmup(ctx, nil))
+			expect := backend.minIdleConns()
+			if expect < 1 {
+				expect = 1
+			}
+			assert.GreaterOrEqual(t, int(backend.client.PoolStats().TotalConns), expect)
+		})
 		return nil
 	}
 
@@ -153,6 +258,102 @@ func TestChangeSignal(t *testing.T) {
 	}))
 }
 
+func TestKeyPrefix(t *testing.T) {
+	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
+		t.Skip("Github action can not run docker on MacOS")
+	}
+
+	assert.Equal(t, keys{
+		lastVersion:   "{pomerium}.last_version",
+		lastVersionCh: "{pomerium}.last_version_ch",
+		records:       "{pomerium}.records",
+		changes:       "{pomerium}.changes",
+		recordTypes:   "{pomerium}.record_types",
+	}, newKeys(""), "the keys without a prefix should be unchanged")
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	require.NoError(t, testutil.WithTestRedis(false, func(rawURL string) error {
+		backendA, err := New(rawURL, WithKeyPrefix("a"))
+		require.NoError(t, err)
+		defer func() { _ = backendA.Close() }()
+
+		backendB, err := New(rawURL, WithKeyPrefix("b"))
+		require.NoError(t, err)
+		defer func() { _ = backendB.Close() }()
+
+		chB := backendB.onChange.Bind()
+		defer backendB.onChange.Unbind(chB)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, backendA.Put(ctx, &databroker.Record{
+				Type: "TYPE",
+				Id:   fmt.Sprint(i),
+			}))
+		}
+		require.NoError(t, backendB.Put(ctx, &databroker.Record{
+			Type: "OTHER",
+			Id:   "0",
+		}))
+		// drain the signal of backend b's own put, if subscribed in time
+		select {
+		case <-chB:
+		case <-time.After(time.Millisecond * 500):
+		}
+
+		records, version, err := backendA.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 10)
+		assert.Equal(t, uint64(10), version)
+
+		records, version, err = backendB.GetAll(ctx)
+		require.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, "OTHER", records[0].GetType())
+		}
+		assert.Equal(t, uint64(1), version, "versions should be counted per prefix")
+
+		_, err = backendB.Get(ctx, "TYPE", "0")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		recordTypes, err := backendB.ListRecordTypes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"OTHER"}, recordTypes)
+
+		stream, err := backendB.Sync(ctx, 0)
+		require.NoError(t, err)
+		var changes []*databroker.Record
+		for stream.Next(false) {
+			changes = append(changes, stream.Record())
+		}
+		_ = stream.Close()
+		assert.Len(t, changes, 1, "sync should only return the changes of the prefix")
+
+		require.NoError(t, backendA.Put(ctx, &databroker.Record{
+			Type: "TYPE",
+			Id:   "10",
+		}))
+		select {
+		case <-chB:
+			t.Error("backend b should not be notified of changes to backend a")
+		case <-time.After(time.Millisecond * 500):
+		}
+
+		backendA.removeChangesBefore(time.Now().Add(time.Second))
+		stream, err = backendB.Sync(ctx, 0)
+		require.NoError(t, err)
+		changes = nil
+		for stream.Next(false) {
+			changes = append(changes, stream.Record())
+		}
+		_ = stream.Close()
+		assert.Len(t, changes, 1, "sweeps should only remove the changes of the prefix")
+
+		return nil
+	}))
+}
+
 func TestExpiry(t *testing.T) {
 	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
 		t.Skip("Github action can not run docker on MacOS")
@@ -193,3 +394,49 @@ func TestExpiry(t *testing.T) {
 		return nil
 	}))
 }
+
+func TestImmediateDelete(t *testing.T) {
+	if os.Getenv("GITHUB_ACTION") != "" && runtime.GOOS == "darwin" {
+		t.Skip("Github action can not run docker on MacOS")
+	}
+
+	ctx := context.Background()
+	require.NoError(t, testutil.WithTestRedis(false, func(rawURL string) error {
+		backend, err := New(rawURL, WithImmediateDelete([]string{"TYPE"}))
+		require.NoError(t, err)
+		defer func() { _ = backend.Close() }()
+
+		data, _ := anypb.New(timestamppb.Now())
+		for i := 0; i < 3; i++ {
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", Data: data}))
+			require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "2", Data: data}))
+		}
+		require.NoError(t, backend.ReplaceAll(ctx, "OTHER", []*databroker.Record{{Type: "OTHER", Id: "1", Data: data}}))
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()}))
+
+		stream, err := backend.Sync(ctx, 0)
+		require.NoError(t, err)
+		withData := map[string]int{}
+		for stream.Next(false) {
+			record := stream.Record()
+			if record.GetData() != nil {
+				withData[record.GetType()+"/"+record.GetId()]++
+			}
+		}
+		_ = stream.Close()
+		assert.Equal(t, map[string]int{"TYPE/2": 3, "OTHER/1": 1}, withData,
+			"the data should only be removed from the changes of the deleted record")
+
+		n, err := backend.client.Exists(ctx, backend.getRecordChangesKey("TYPE", "1")).Result()
+		require.NoError(t, err)
+		assert.Zero(t, n, "the index of the changes of the deleted record should be removed")
+		versions, err := backend.client.ZCard(ctx, backend.getRecordChangesKey("TYPE", "2")).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), versions)
+		n, err = backend.client.Exists(ctx, backend.getRecordChangesKey("OTHER", "1")).Result()
+		require.NoError(t, err)
+		assert.Zero(t, n, "the changes of other types shouldn't be indexed")
+
+		return nil
+	}))
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+)
+
+// PrimaryVersion returns the latest record version of the primary. When the
+// connection string enables reads from the replicas of a cluster, with read_only,
+// route_by_latency or route_randomly, GetAll may be served by a replica which lags
+// behind. Transactions always run on the primary, so the version is read in one.
+// With slave_only every command, this one included, is served by a replica.
+func (backend *Backend) PrimaryVersion(ctx context.Context) (version uint64, err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.PrimaryVersion")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "primaryversion", "", err) }(time.Now())
+
+	var cmd *redis.StringCmd
+	_, err = backend.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		cmd = p.Get(ctx, backend.keys.lastVersion)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return cmd.Uint64()
+}
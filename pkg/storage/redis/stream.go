@@ -7,7 +7,6 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/golang/protobuf/proto"
 
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
@@ -55,7 +54,7 @@ func (stream *recordStream) Next(block bool) bool {
 	defer ticker.Stop()
 
 	for {
-		cmd := stream.backend.client.ZRangeByScore(stream.ctx, changesSetKey, &redis.ZRangeBy{
+		cmd := stream.backend.client.ZRangeByScore(stream.ctx, stream.backend.keys.changes, &redis.ZRangeBy{
 			Min:    fmt.Sprintf("(%d", stream.version),
 			Max:    "+inf",
 			Offset: 0,
@@ -70,7 +69,7 @@ func (stream *recordStream) Next(block bool) bool {
 		if len(results) > 0 {
 			result := results[0]
 			var record databroker.Record
-			err = proto.Unmarshal([]byte(result), &record)
+			err = unmarshalChange([]byte(result), &record)
 			if err != nil {
 				log.Warn().Err(err).Msg("redis: invalid record detected")
 			} else {
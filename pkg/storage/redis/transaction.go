@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// WithinTransaction calls fn with a transaction. The records put in the transaction
+// are committed with MULTI/EXEC. If any other write happens before the commit, fn is
+// called again.
+func (backend *Backend) WithinTransaction(ctx context.Context, fn func(tx storage.Transaction) error) (err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.WithinTransaction")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "transaction", "", err) }(time.Now())
+
+	txf := func(tx *redis.Tx) error {
+		version, err := tx.Get(ctx, backend.keys.lastVersion).Uint64()
+		if errors.Is(err, redis.Nil) {
+			version = 0
+		} else if err != nil {
+			return err
+		}
+
+		rtx := &transaction{
+			backend: backend,
+			tx:      tx,
+			pending: make(map[string]*databroker.Record),
+		}
+		if err := fn(rtx); err != nil {
+			return err
+		}
+		if len(rtx.records) == 0 {
+			return nil
+		}
+
+		now := timestamppb.Now()
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			for _, record := range rtx.records {
+				version++
+				record.ModifiedAt = now
+				record.Version = version
+
+				bs, err := proto.Marshal(record)
+				if err != nil {
+					return err
+				}
+				changeBytes, err := marshalChange(backend.cfg.changeCompression, record)
+				if err != nil {
+					return err
+				}
+
+				key, field := backend.getHashKey(record.GetType(), record.GetId())
+				if record.DeletedAt != nil {
+					p.HDel(ctx, key, field)
+				} else {
+					p.HSet(ctx, key, field, bs)
+					p.SAdd(ctx, backend.keys.recordTypes, record.GetType())
+				}
+				p.ZAdd(ctx, backend.keys.changes, &redis.Z{
+					Score:  float64(version),
+					Member: changeBytes,
+				})
+			}
+			p.Set(ctx, backend.keys.lastVersion, version, 0)
+			p.Publish(ctx, backend.keys.lastVersionCh, version)
+			return nil
+		})
+		return err
+	}
+
+	return backend.runTransaction(ctx, txf)
+}
+
+type transaction struct {
+	backend *Backend
+	tx      *redis.Tx
+	records []*databroker.Record
+	pending map[string]*databroker.Record
+}
+
+func (rtx *transaction) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	key, field := rtx.backend.getHashKey(recordType, id)
+	if record, ok := rtx.pending[field]; ok {
+		if record.GetDeletedAt() != nil {
+			return nil, storage.ErrNotFound
+		}
+		return proto.Clone(record).(*databroker.Record), nil
+	}
+
+	raw, err := rtx.tx.HGet(ctx, key, field).Result()
+	if err == redis.Nil {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var record databroker.Record
+	if err := proto.Unmarshal([]byte(raw), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (rtx *transaction) Put(_ context.Context, record *databroker.Record) error {
+	if record == nil {
+		return fmt.Errorf("redis: records cannot be nil")
+	}
+
+	_, field := rtx.backend.getHashKey(record.GetType(), record.GetId())
+	rtx.records = append(rtx.records, record)
+	rtx.pending[field] = proto.Clone(record).(*databroker.Record)
+	return nil
+}
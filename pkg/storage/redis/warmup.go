@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+)
+
+// Warmup opens the minimum number of idle connections in the pool, so that the
+// first requests don't have to wait on dialing. At least one connection is opened.
+// Records are not prefetched.
+func (backend *Backend) Warmup(ctx context.Context, _ []string) (err error) {
+	_, span := trace.StartSpan(ctx, "databroker.redis.Warmup")
+	defer span.End()
+	defer func(start time.Time) { recordOperation(ctx, backend.cfg, start, "warmup", "", err) }(time.Now())
+
+	n := 1
+	if minIdleConns := backend.minIdleConns(); minIdleConns > n {
+		n = minIdleConns
+	}
+
+	// each concurrent ping holds a connection, so n connections will be opened
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < n; i++ {
+		eg.Go(func() error {
+			return backend.client.Ping(ctx).Err()
+		})
+	}
+	return eg.Wait()
+}
+
+func (backend *Backend) minIdleConns() int {
+	switch client := backend.client.(type) {
+	case *redis.Client:
+		return client.Options().MinIdleConns
+	case *redis.ClusterClient:
+		return client.Options().MinIdleConns
+	}
+	return 0
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// ErrDeleteVetoed indicates that a delete was vetoed by a DeleteStrategy because
+// the record is still referenced.
+var ErrDeleteVetoed = errors.New("storage: delete vetoed")
+
+// A DeleteStrategy decides what happens to the records which still reference a
+// record of its type when that record is permanently deleted.
+type DeleteStrategy interface {
+	// Name names the strategy in logs and errors.
+	Name() string
+	// OnDelete is called before the given record is deleted. It returns the related
+	// records to delete along with it, or an error to veto the delete.
+	OnDelete(ctx context.Context, backend Backend, record *databroker.Record) ([]*databroker.Record, error)
+}
+
+// A ReferenceFunc reports whether record references the referenced record.
+type ReferenceFunc func(referenced, record *databroker.Record) bool
+
+type cascadeDeleteStrategy struct {
+	recordType string
+	references ReferenceFunc
+}
+
+// NewCascadeDeleteStrategy creates a new delete strategy which deletes the records
+// of the given type which reference a deleted record along with it.
+func NewCascadeDeleteStrategy(recordType string, references ReferenceFunc) DeleteStrategy {
+	return cascadeDeleteStrategy{recordType: recordType, references: references}
+}
+
+func (strategy cascadeDeleteStrategy) Name() string {
+	return "cascade"
+}
+
+func (strategy cascadeDeleteStrategy) OnDelete(ctx context.Context, backend Backend, record *databroker.Record) ([]*databroker.Record, error) {
+	return getReferences(ctx, backend, strategy.recordType, record, strategy.references)
+}
+
+type restrictDeleteStrategy struct {
+	recordType string
+	references ReferenceFunc
+}
+
+// NewRestrictDeleteStrategy creates a new delete strategy which vetoes the delete
+// of a record while any record of the given type references it.
+func NewRestrictDeleteStrategy(recordType string, references ReferenceFunc) DeleteStrategy {
+	return restrictDeleteStrategy{recordType: recordType, references: references}
+}
+
+func (strategy restrictDeleteStrategy) Name() string {
+	return "restrict"
+}
+
+func (strategy restrictDeleteStrategy) OnDelete(ctx context.Context, backend Backend, record *databroker.Record) ([]*databroker.Record, error) {
+	references, err := getReferences(ctx, backend, strategy.recordType, record, strategy.references)
+	if err != nil {
+		return nil, err
+	}
+	if len(references) > 0 {
+		return nil, fmt.Errorf("referenced by %d %s records", len(references), strategy.recordType)
+	}
+	return nil, nil
+}
+
+// getReferences returns the live records of the given type which reference the
+// referenced record.
+func getReferences(
+	ctx context.Context,
+	backend Backend,
+	recordType string,
+	referenced *databroker.Record,
+	references ReferenceFunc,
+) ([]*databroker.Record, error) {
+	records, _, err := backend.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var referencing []*databroker.Record
+	for _, record := range records {
+		if record.GetType() == recordType && record.GetDeletedAt() == nil && references(referenced, record) {
+			referencing = append(referencing, record)
+		}
+	}
+	return referencing, nil
+}
+
+type referentialIntegrityBackend struct {
+	Backend
+	strategies     map[string][]DeleteStrategy
+	cleanupReserve time.Duration
+}
+
+// A relatedDelete is a record deleted along with the record it references.
+type relatedDelete struct {
+	record     *databroker.Record
+	referenced *databroker.Record
+}
+
+// NewReferentialIntegrityBackend creates a new backend which applies the delete
+// strategies of a record's type before the record is deleted, so that deleting a
+// record doesn't orphan the records which reference it. When a strategy vetoes
+// the delete, nothing is deleted and an error wrapping ErrDeleteVetoed is
+// returned. Otherwise the related records are deleted first, with the strategies
+// of their own types applied in turn, followed by the record itself.
+//
+// The underlying backend needn't support transactions, so if a cascade fails part
+// way, the related records already deleted are put back. The cleanupReserve is the
+// time reserved before the deadline of the calling context for putting them back:
+// a cascade isn't started, or is stopped and rolled back, once no more than that
+// is left, and fails with an error wrapping ErrDeadlineBudgetExhausted. Records
+// which are put back get new versions.
+func NewReferentialIntegrityBackend(strategies map[string][]DeleteStrategy, cleanupReserve time.Duration, underlying Backend) Backend {
+	return &referentialIntegrityBackend{
+		Backend:        underlying,
+		strategies:     strategies,
+		cleanupReserve: cleanupReserve,
+	}
+}
+
+func (backend *referentialIntegrityBackend) Put(ctx context.Context, record *databroker.Record) error {
+	if record.GetDeletedAt() == nil || len(backend.strategies[record.GetType()]) == 0 {
+		return backend.Backend.Put(ctx, record)
+	}
+
+	related, err := backend.plan(ctx, record, map[readCacheKey]struct{}{})
+	if err != nil {
+		return err
+	}
+	return backend.apply(ctx, deletesOf(record, related), func(ctx context.Context) error {
+		return backend.Backend.Put(ctx, record)
+	})
+}
+
+func (backend *referentialIntegrityBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	if len(backend.strategies[recordType]) == 0 {
+		return backend.Backend.ReplaceAll(ctx, recordType, records)
+	}
+
+	existing, _, err := backend.Backend.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		if record.GetDeletedAt() == nil {
+			kept[record.GetId()] = struct{}{}
+		}
+	}
+
+	// the records removed by the replace are deleted by it, so only the records
+	// related to them are deleted here
+	visited := make(map[readCacheKey]struct{})
+	var removed []*databroker.Record
+	for _, record := range existing {
+		if _, ok := kept[record.GetId()]; record.GetType() != recordType || record.GetDeletedAt() != nil || ok {
+			continue
+		}
+		visited[readCacheKey{recordType: record.GetType(), id: record.GetId()}] = struct{}{}
+		removed = append(removed, record)
+	}
+	// every removed record is planned before anything is deleted, so a veto leaves
+	// the records as they were
+	related := make([][]*databroker.Record, len(removed))
+	for i, record := range removed {
+		related[i], err = backend.plan(ctx, record, visited)
+		if err != nil {
+			return err
+		}
+	}
+	var deletes []relatedDelete
+	for i, record := range removed {
+		deletes = append(deletes, deletesOf(record, related[i])...)
+	}
+	return backend.apply(ctx, deletes, func(ctx context.Context) error {
+		return backend.Backend.ReplaceAll(ctx, recordType, records)
+	})
+}
+
+// plan returns the related records to delete along with the given record, in the
+// order they must be deleted, by applying the delete strategies recursively. The
+// visited records are skipped, so reference cycles terminate.
+func (backend *referentialIntegrityBackend) plan(
+	ctx context.Context,
+	record *databroker.Record,
+	visited map[readCacheKey]struct{},
+) ([]*databroker.Record, error) {
+	visited[readCacheKey{recordType: record.GetType(), id: record.GetId()}] = struct{}{}
+
+	var planned []*databroker.Record
+	for _, strategy := range backend.strategies[record.GetType()] {
+		related, err := strategy.OnDelete(ctx, backend.Backend, record)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s/%s by %s strategy: %v",
+				ErrDeleteVetoed, record.GetType(), record.GetId(), strategy.Name(), err)
+		}
+
+		for _, r := range related {
+			key := readCacheKey{recordType: r.GetType(), id: r.GetId()}
+			if _, ok := visited[key]; ok {
+				continue
+			}
+			// the records related to r are deleted before r itself
+			rRelated, err := backend.plan(ctx, r, visited)
+			if err != nil {
+				return nil, err
+			}
+			planned = append(planned, rRelated...)
+			planned = append(planned, r)
+		}
+	}
+	return planned, nil
+}
+
+func deletesOf(referenced *databroker.Record, related []*databroker.Record) []relatedDelete {
+	deletes := make([]relatedDelete, len(related))
+	for i, r := range related {
+		deletes[i] = relatedDelete{record: r, referenced: referenced}
+	}
+	return deletes
+}
+
+// apply deletes the related records in order, followed by the final write. If any
+// of them fails, the related records already deleted are put back.
+func (backend *referentialIntegrityBackend) apply(
+	ctx context.Context,
+	deletes []relatedDelete,
+	final func(ctx context.Context) error,
+) error {
+	if len(deletes) == 0 {
+		return final(ctx)
+	}
+
+	budget, err := newDeadlineBudget(ctx, backend.cleanupReserve)
+	if err != nil {
+		return err
+	}
+	defer budget.cancel()
+
+	var deleted []*databroker.Record
+	err = func() error {
+		for _, d := range deletes {
+			if err := budget.checkStep(); err != nil {
+				return err
+			}
+			r := proto.Clone(d.record).(*databroker.Record)
+			r.DeletedAt = d.referenced.GetDeletedAt()
+			if r.DeletedAt == nil {
+				// removed by a replace
+				r.DeletedAt = timestamppb.Now()
+			}
+			if err := backend.Backend.Put(budget.stepCtx, r); err != nil {
+				return err
+			}
+			deleted = append(deleted, d.record)
+			log.Debug().
+				Str("type", r.GetType()).
+				Str("id", r.GetId()).
+				Str("referenced_type", d.referenced.GetType()).
+				Str("referenced_id", d.referenced.GetId()).
+				Msg("storage: cascaded delete")
+		}
+		if err := budget.checkStep(); err != nil {
+			return err
+		}
+		return final(budget.stepCtx)
+	}()
+	if err == nil {
+		return nil
+	}
+	if budget.stepCtx.Err() != nil && !errors.Is(err, ErrDeadlineBudgetExhausted) {
+		err = fmt.Errorf("%w: %v", ErrDeadlineBudgetExhausted, err)
+	}
+
+	for i := len(deleted) - 1; i >= 0; i-- {
+		if rerr := backend.Backend.Put(budget.cleanupCtx, deleted[i]); rerr != nil {
+			log.Error().Err(rerr).
+				Str("type", deleted[i].GetType()).
+				Str("id", deleted[i].GetId()).
+				Msg("storage: failed to roll back cascaded delete")
+			return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+	}
+	if len(deleted) > 0 {
+		log.Warn().Err(err).Int("restored", len(deleted)).Msg("storage: rolled back cascaded deletes")
+	}
+	return err
+}
+
+func (backend *referentialIntegrityBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, backend.Backend, batchSize, fn)
+}
+
+func (backend *referentialIntegrityBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (backend *referentialIntegrityBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.Backend, recordType, max)
+}
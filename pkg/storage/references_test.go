@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestReferentialIntegrityBackend(t *testing.T) {
+	ctx := context.Background()
+
+	var m map[string]*databroker.Record
+	var deleted []string
+	underlying := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			key := record.GetType() + "/" + record.GetId()
+			if record.GetDeletedAt() != nil {
+				deleted = append(deleted, key)
+				delete(m, key)
+				return nil
+			}
+			m[key] = proto.Clone(record).(*databroker.Record)
+			return nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			var records []*databroker.Record
+			for _, record := range m {
+				records = append(records, proto.Clone(record).(*databroker.Record))
+			}
+			return records, 0, nil
+		},
+		replaceAll: func(ctx context.Context, recordType string, records []*databroker.Record) error {
+			for key, record := range m {
+				if record.GetType() == recordType {
+					deleted = append(deleted, key)
+					delete(m, key)
+				}
+			}
+			for _, record := range records {
+				m[record.GetType()+"/"+record.GetId()] = record
+			}
+			return nil
+		},
+	}
+	reset := func() {
+		m = map[string]*databroker.Record{}
+		deleted = nil
+		for _, record := range []*databroker.Record{
+			{Type: "USER", Id: "u1"},
+			{Type: "USER", Id: "u2"},
+			{Type: "SESSION", Id: "s1", Data: newStructAny(t, map[string]interface{}{"user_id": "u1"})},
+			{Type: "SESSION", Id: "s2", Data: newStructAny(t, map[string]interface{}{"user_id": "u2"})},
+			{Type: "TOKEN", Id: "t1", Data: newStructAny(t, map[string]interface{}{"session_id": "s1"})},
+		} {
+			m[record.GetType()+"/"+record.GetId()] = record
+		}
+	}
+	referencedBy := func(field string) ReferenceFunc {
+		return func(referenced, record *databroker.Record) bool {
+			var s structpb.Struct
+			if err := record.GetData().UnmarshalTo(&s); err != nil {
+				return false
+			}
+			return s.GetFields()[field].GetStringValue() == referenced.GetId()
+		}
+	}
+
+	t.Run("cascade", func(t *testing.T) {
+		reset()
+		backend := NewReferentialIntegrityBackend(map[string][]DeleteStrategy{
+			"USER":    {NewCascadeDeleteStrategy("SESSION", referencedBy("user_id"))},
+			"SESSION": {NewCascadeDeleteStrategy("TOKEN", referencedBy("session_id"))},
+		}, 0, underlying)
+
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "USER", Id: "u1", DeletedAt: timestamppb.Now()}))
+		assert.Equal(t, []string{"TOKEN/t1", "SESSION/s1", "USER/u1"}, deleted,
+			"the referencing records should be deleted first")
+		assert.Contains(t, m, "SESSION/s2")
+	})
+	t.Run("restrict", func(t *testing.T) {
+		reset()
+		backend := NewReferentialIntegrityBackend(map[string][]DeleteStrategy{
+			"USER":    {NewCascadeDeleteStrategy("SESSION", referencedBy("user_id"))},
+			"SESSION": {NewRestrictDeleteStrategy("TOKEN", referencedBy("session_id"))},
+		}, 0, underlying)
+
+		err := backend.Put(ctx, &databroker.Record{Type: "USER", Id: "u1", DeletedAt: timestamppb.Now()})
+		assert.True(t, errors.Is(err, ErrDeleteVetoed), "expected the delete to be vetoed, got: %v", err)
+		assert.Empty(t, deleted, "nothing should be deleted when the delete is vetoed")
+
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "USER", Id: "u2", DeletedAt: timestamppb.Now()}))
+		assert.Equal(t, []string{"SESSION/s2", "USER/u2"}, deleted)
+	})
+	t.Run("replace all", func(t *testing.T) {
+		reset()
+		backend := NewReferentialIntegrityBackend(map[string][]DeleteStrategy{
+			"USER": {NewCascadeDeleteStrategy("SESSION", referencedBy("user_id"))},
+		}, 0, underlying)
+
+		require.NoError(t, backend.ReplaceAll(ctx, "USER", []*databroker.Record{{Type: "USER", Id: "u2"}}))
+		assert.NotContains(t, m, "SESSION/s1", "the sessions of removed users should be deleted")
+		assert.Contains(t, m, "SESSION/s2")
+	})
+	t.Run("deadline", func(t *testing.T) {
+		slow := &mockBackend{
+			put: func(ctx context.Context, record *databroker.Record) error {
+				time.Sleep(time.Millisecond * 50)
+				return underlying.put(ctx, record)
+			},
+			getAll: underlying.getAll,
+		}
+		backend := NewReferentialIntegrityBackend(map[string][]DeleteStrategy{
+			"USER":    {NewCascadeDeleteStrategy("SESSION", referencedBy("user_id"))},
+			"SESSION": {NewCascadeDeleteStrategy("TOKEN", referencedBy("session_id"))},
+		}, time.Millisecond*200, slow)
+		keys := func() []string {
+			var keys []string
+			for key := range m {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			return keys
+		}
+		deleteUser := func(timeout time.Duration) error {
+			ctx, clearTimeout := context.WithTimeout(ctx, timeout)
+			defer clearTimeout()
+			return backend.Put(ctx, &databroker.Record{Type: "USER", Id: "u1", DeletedAt: timestamppb.Now()})
+		}
+
+		reset()
+		before := keys()
+		err := deleteUser(time.Millisecond * 100)
+		assert.True(t, errors.Is(err, ErrDeadlineBudgetExhausted), "expected the budget to be exhausted, got: %v", err)
+		assert.Empty(t, deleted, "nothing should be deleted without time for the cleanup")
+
+		// the three deletes don't all fit before the reserve
+		reset()
+		err = deleteUser(time.Millisecond * 250)
+		assert.True(t, errors.Is(err, ErrDeadlineBudgetExhausted), "expected the budget to be exhausted, got: %v", err)
+		assert.NotEmpty(t, deleted)
+		assert.NotContains(t, deleted, "USER/u1")
+		assert.Equal(t, before, keys(), "the cascaded delete should be rolled back")
+
+		reset()
+		require.NoError(t, deleteUser(time.Second*5))
+		assert.Equal(t, []string{"TOKEN/t1", "SESSION/s1", "USER/u1"}, deleted)
+	})
+}
+
+func newStructAny(t *testing.T, fields map[string]interface{}) *anypb.Any {
+	s, err := structpb.NewStruct(fields)
+	require.NoError(t, err)
+	data, err := anypb.New(s)
+	require.NoError(t, err)
+	return data
+}
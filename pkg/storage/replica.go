@@ -0,0 +1,77 @@
+package storage
+
+import "context"
+
+// A ReplicatedBackend is a Backend whose reads may be served by a replica which
+// lags behind the primary, so that the version returned by GetAll may be older
+// than the latest version written.
+type ReplicatedBackend interface {
+	// PrimaryVersion returns the latest record version of the primary.
+	PrimaryVersion(ctx context.Context) (uint64, error)
+}
+
+// PrimaryVersion returns the latest record version of the primary if the backend
+// may read from a replica. ErrUnsupported is returned otherwise.
+func PrimaryVersion(ctx context.Context, backend Backend) (uint64, error) {
+	r, ok := backend.(ReplicatedBackend)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return r.PrimaryVersion(ctx)
+}
+
+func (c *checksumBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, c.underlying)
+}
+
+func (backend *signedBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.underlying)
+}
+
+func (e *encryptedBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, e.underlying)
+}
+
+func (e *expiryBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, e.Backend)
+}
+
+func (backend *retentionBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (c *negativeCacheBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, c.Backend)
+}
+
+func (backend *deletedGracePeriodBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (c *readCacheBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, c.underlying)
+}
+
+func (backend *statementTimeoutBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (backend *slowOperationLogBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (backend *recordAgeSamplerBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (backend *concurrencyLimitBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (backend *tracingBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.Backend)
+}
+
+func (backend *watchdogBackend) PrimaryVersion(ctx context.Context) (uint64, error) {
+	return PrimaryVersion(ctx, backend.get())
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// AnyRecordType is the record type of the retention policies which apply to the
+// records of every type, along with the policies of their own type.
+const AnyRecordType = "*"
+
+// A RetentionPolicy reclaims the records of a type, or their previous versions,
+// which it no longer retains.
+type RetentionPolicy interface {
+	// Name names the policy in logs and metrics.
+	Name() string
+	// Reclaim reclaims the data of the given records, which are the current
+	// records of the type, no longer retained at now. It returns the number of
+	// records or versions reclaimed.
+	Reclaim(ctx context.Context, backend Backend, recordType string, records []*databroker.Record, now time.Time) (int, error)
+}
+
+type maxVersionsRetentionPolicy struct {
+	max int
+}
+
+// NewMaxVersionsRetentionPolicy creates a new retention policy which keeps at most
+// max versions of each record. Previous versions are pruned from the backend's
+// change log, for backends which implement VersionPruner.
+func NewMaxVersionsRetentionPolicy(max int) RetentionPolicy {
+	return maxVersionsRetentionPolicy{max: max}
+}
+
+func (policy maxVersionsRetentionPolicy) Name() string {
+	return "max_versions"
+}
+
+func (policy maxVersionsRetentionPolicy) Reclaim(ctx context.Context, backend Backend, recordType string, _ []*databroker.Record, _ time.Time) (int, error) {
+	return PruneVersions(ctx, backend, recordType, policy.max)
+}
+
+type maxIdleAgeRetentionPolicy struct {
+	maxIdleAge time.Duration
+}
+
+// NewMaxIdleAgeRetentionPolicy creates a new retention policy which deletes records
+// which haven't been modified for longer than maxIdleAge.
+func NewMaxIdleAgeRetentionPolicy(maxIdleAge time.Duration) RetentionPolicy {
+	return maxIdleAgeRetentionPolicy{maxIdleAge: maxIdleAge}
+}
+
+func (policy maxIdleAgeRetentionPolicy) Name() string {
+	return "max_idle_age"
+}
+
+func (policy maxIdleAgeRetentionPolicy) Reclaim(ctx context.Context, backend Backend, _ string, records []*databroker.Record, now time.Time) (int, error) {
+	cutoff := now.Add(-policy.maxIdleAge)
+	isIdle := func(record *databroker.Record) bool {
+		return record.GetDeletedAt() == nil && record.GetModifiedAt() != nil &&
+			record.GetModifiedAt().AsTime().Before(cutoff)
+	}
+
+	var deleted int
+	for _, record := range records {
+		if !isIdle(record) {
+			continue
+		}
+
+		// re-check the latest version in case the record was modified since it was listed
+		record, err := backend.Get(ctx, record.GetType(), record.GetId())
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return deleted, err
+		}
+		if !isIdle(record) {
+			continue
+		}
+
+		record = proto.Clone(record).(*databroker.Record)
+		record.DeletedAt = timestamppb.New(now)
+		if err := backend.Put(ctx, record); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// A VersionPruner is a Backend which retains the previous versions of records in
+// its change log, and can prune them.
+type VersionPruner interface {
+	// PruneVersions prunes all but the latest max versions of each record of the
+	// given type. It returns the number of versions pruned.
+	PruneVersions(ctx context.Context, recordType string, max int) (int, error)
+}
+
+// PruneVersions prunes the previous versions of the records of the given type if
+// the backend supports it. Otherwise every version is retained.
+func PruneVersions(ctx context.Context, backend Backend, recordType string, max int) (int, error) {
+	p, ok := backend.(VersionPruner)
+	if !ok {
+		return 0, nil
+	}
+	return p.PruneVersions(ctx, recordType, max)
+}
+
+type retentionBackend struct {
+	Backend
+	policies map[string][]RetentionPolicy
+
+	closeOnce sync.Once
+	cancel    context.CancelFunc
+}
+
+// NewRetentionBackend creates a new backend which periodically applies the
+// retention policies of each record type to the records of the underlying backend.
+// The policies of AnyRecordType are applied to the records of every type. The
+// policies of a type are composed: a record is reclaimed by whichever of them
+// triggers first. The number of records reclaimed by each policy is recorded in
+// the storage_retention_reclaimed_total metric.
+func NewRetentionBackend(interval time.Duration, policies map[string][]RetentionPolicy, underlying Backend) Backend {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &retentionBackend{
+		Backend:  underlying,
+		policies: policies,
+		cancel:   cancel,
+	}
+	go backend.run(ctx, interval)
+	return backend
+}
+
+func (backend *retentionBackend) Close() error {
+	backend.closeOnce.Do(backend.cancel)
+	return backend.Backend.Close()
+}
+
+func (backend *retentionBackend) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := backend.apply(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("storage: error applying retention policies")
+		}
+	}
+}
+
+// apply applies the retention policies at now.
+func (backend *retentionBackend) apply(ctx context.Context, now time.Time) error {
+	records, _, err := backend.Backend.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	anyPolicies := backend.policies[AnyRecordType]
+	byType := make(map[string][]*databroker.Record, len(backend.policies))
+	for _, record := range records {
+		if _, ok := backend.policies[record.GetType()]; ok || len(anyPolicies) > 0 {
+			byType[record.GetType()] = append(byType[record.GetType()], record)
+		}
+	}
+
+	recordTypes := make([]string, 0, len(backend.policies))
+	for recordType := range backend.policies {
+		if recordType != AnyRecordType {
+			recordTypes = append(recordTypes, recordType)
+		}
+	}
+	for recordType := range byType {
+		if _, ok := backend.policies[recordType]; !ok {
+			recordTypes = append(recordTypes, recordType)
+		}
+	}
+	sort.Strings(recordTypes)
+
+	for _, recordType := range recordTypes {
+		policies := make([]RetentionPolicy, 0, len(backend.policies[recordType])+len(anyPolicies))
+		policies = append(policies, backend.policies[recordType]...)
+		policies = append(policies, anyPolicies...)
+		for _, policy := range policies {
+			reclaimed, err := policy.Reclaim(ctx, backend.Backend, recordType, byType[recordType], now)
+			if reclaimed > 0 {
+				metrics.RecordStorageRetentionReclaimed(ctx, recordType, policy.Name(), reclaimed)
+				log.Debug().
+					Str("type", recordType).
+					Str("policy", policy.Name()).
+					Int("reclaimed", reclaimed).
+					Msg("storage: reclaimed records")
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checksumBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, c.underlying, recordType, max)
+}
+
+func (backend *signedBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.underlying, recordType, max)
+}
+
+func (e *encryptedBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, e.underlying, recordType, max)
+}
+
+func (backend *statementTimeoutBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.Backend, recordType, max)
+}
+
+func (backend *slowOperationLogBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.Backend, recordType, max)
+}
+
+func (backend *watchdogBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.get(), recordType, max)
+}
+
+func (backend *routedBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	var pruned int
+	for i, underlying := range backend.backends {
+		if !backend.router.stores(i, recordType) {
+			continue
+		}
+		n, err := PruneVersions(ctx, underlying, recordType, max)
+		pruned += n
+		if err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+func (backend *concurrencyLimitBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	return PruneVersions(ctx, backend.Backend, recordType, max)
+}
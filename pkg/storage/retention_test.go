@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type pruningBackend struct {
+	*mockBackend
+	pruned map[string]int
+}
+
+func (backend *pruningBackend) PruneVersions(ctx context.Context, recordType string, max int) (int, error) {
+	backend.pruned[recordType] = max
+	return 1, nil
+}
+
+func TestRetentionBackend(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	m := map[string]*databroker.Record{}
+	var deleted []string
+	underlying := &pruningBackend{
+		mockBackend: &mockBackend{
+			put: func(ctx context.Context, record *databroker.Record) error {
+				if record.GetDeletedAt() != nil {
+					deleted = append(deleted, record.GetType()+"/"+record.GetId())
+				}
+				m[record.GetType()+"/"+record.GetId()] = proto.Clone(record).(*databroker.Record)
+				return nil
+			},
+			get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+				record, ok := m[recordType+"/"+id]
+				if !ok {
+					return nil, ErrNotFound
+				}
+				return proto.Clone(record).(*databroker.Record), nil
+			},
+			getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+				var records []*databroker.Record
+				for _, record := range m {
+					if record.GetDeletedAt() == nil {
+						records = append(records, proto.Clone(record).(*databroker.Record))
+					}
+				}
+				return records, 0, nil
+			},
+		},
+		pruned: map[string]int{},
+	}
+	put := func(recordType, id string, modifiedAt time.Time) {
+		m[recordType+"/"+id] = &databroker.Record{Type: recordType, Id: id, ModifiedAt: timestamppb.New(modifiedAt)}
+	}
+	put("IDLE", "idle", now.Add(-time.Hour))
+	put("IDLE", "active", now.Add(-time.Minute))
+	put("COMPOSED", "idle", now.Add(-time.Hour))
+	put("COMPOSED", "active", now.Add(-time.Minute))
+	put("VERSIONED", "idle", now.Add(-time.Hour))
+	put("NONE", "idle", now.Add(-time.Hour))
+
+	backend := NewRetentionBackend(time.Hour, map[string][]RetentionPolicy{
+		"IDLE":      {NewMaxIdleAgeRetentionPolicy(time.Minute * 30)},
+		"VERSIONED": {NewMaxVersionsRetentionPolicy(3)},
+		"COMPOSED": {
+			NewMaxVersionsRetentionPolicy(5),
+			NewMaxIdleAgeRetentionPolicy(time.Hour * 2),
+			NewMaxIdleAgeRetentionPolicy(time.Minute * 30),
+		},
+	}, underlying).(*retentionBackend)
+	defer func() { _ = backend.Close() }()
+
+	require.NoError(t, backend.apply(ctx, now))
+	sort.Strings(deleted)
+	assert.Equal(t, []string{"COMPOSED/idle", "IDLE/idle"}, deleted,
+		"records idle for longer than the max idle age of any of their policies should be deleted")
+	assert.Equal(t, map[string]int{"COMPOSED": 5, "VERSIONED": 3}, underlying.pruned,
+		"the versions of types with a max versions policy should be pruned")
+
+	t.Run("modified since listed", func(t *testing.T) {
+		deleted = nil
+		put("IDLE", "refreshed", now.Add(-time.Hour))
+		policy := NewMaxIdleAgeRetentionPolicy(time.Minute * 30)
+		record, err := underlying.Get(ctx, "IDLE", "refreshed")
+		require.NoError(t, err)
+		put("IDLE", "refreshed", now)
+
+		reclaimed, err := policy.Reclaim(ctx, underlying, "IDLE", []*databroker.Record{record}, now)
+		require.NoError(t, err)
+		assert.Equal(t, 0, reclaimed)
+		assert.Empty(t, deleted, "records modified since they were listed should be retained")
+	})
+	t.Run("any record type", func(t *testing.T) {
+		underlying.pruned = map[string]int{}
+		backend := NewRetentionBackend(time.Hour, map[string][]RetentionPolicy{
+			"VERSIONED":   {NewMaxVersionsRetentionPolicy(3)},
+			AnyRecordType: {NewMaxVersionsRetentionPolicy(2)},
+		}, underlying).(*retentionBackend)
+		defer func() { _ = backend.Close() }()
+
+		require.NoError(t, backend.apply(ctx, now))
+		assert.Equal(t, map[string]int{"COMPOSED": 2, "IDLE": 2, "NONE": 2, "VERSIONED": 2}, underlying.pruned,
+			"the policies of any record type should be applied to every type, after their own")
+	})
+}
@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/signal"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// routedMaxChanges is the maximum number of changes a routed backend keeps for
+// syncing. Syncing from before the oldest change results in a version gap.
+const routedMaxChanges = 100000
+
+// routedRetryInterval is how long to wait before re-syncing a routed backend
+// whose record stream failed.
+const routedRetryInterval = time.Second
+
+// A router decides which of the backends of a routed backend stores a record.
+type router interface {
+	// route returns the index of the backend storing the record with the given
+	// type and id.
+	route(recordType, id string) int
+	// stores reports whether the i-th backend may store records of the given type.
+	stores(i int, recordType string) bool
+}
+
+// A typeRouter routes records by type, to the backend index of the type. Types
+// without an index are routed to the first backend.
+type typeRouter map[string]int
+
+func (r typeRouter) route(recordType, _ string) int {
+	return r[recordType]
+}
+
+func (r typeRouter) stores(i int, recordType string) bool {
+	return r[recordType] == i
+}
+
+type routedBackend struct {
+	backends []Backend
+	router   router
+	onChange *signal.Signal
+
+	// health describes each of the backends, with the error of its sync while
+	// it's failing
+	health []BackendHealth
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	cancel    context.CancelFunc
+
+	mu      sync.RWMutex
+	version uint64
+	changes []*databroker.Record
+}
+
+// NewRoutedBackend creates a new backend which stores the records of each of the
+// routed types in its own backend, and all other records in the default backend.
+//
+// The changes of all the backends are merged into a single change log, so that
+// they can be synced with one stream. The change log is versioned by the routed
+// backend itself, so record versions on Sync streams differ from the versions
+// returned by Get and GetAll. Only the changes since the routed backend was
+// created are kept. Each backend's health is reported separately, by its syncing
+// of changes, so that one of them failing doesn't hide the others' health.
+func NewRoutedBackend(ctx context.Context, defaultBackend Backend, routes map[string]Backend) (Backend, error) {
+	// the first of the distinct backends is the default, and the others are in
+	// the order of their first record type
+	recordTypes := make([]string, 0, len(routes))
+	for recordType := range routes {
+		recordTypes = append(recordTypes, recordType)
+	}
+	sort.Strings(recordTypes)
+	backends := []Backend{defaultBackend}
+	r := make(typeRouter, len(routes))
+	for _, recordType := range recordTypes {
+		underlying := routes[recordType]
+		idx := -1
+		for i, b := range backends {
+			if b == underlying {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			idx = len(backends)
+			backends = append(backends, underlying)
+		}
+		r[recordType] = idx
+	}
+	backend, err := newRoutedBackend(ctx, backends, r)
+	if err != nil {
+		return nil, err
+	}
+	backend.health[0].Default = true
+	for recordType, i := range r {
+		backend.health[i].RecordTypes = append(backend.health[i].RecordTypes, recordType)
+	}
+	for i := range backend.health {
+		sort.Strings(backend.health[i].RecordTypes)
+	}
+	return backend, nil
+}
+
+func newRoutedBackend(ctx context.Context, backends []Backend, r router) (*routedBackend, error) {
+	backend := &routedBackend{
+		backends: backends,
+		router:   r,
+		onChange: signal.New(),
+		health:   make([]BackendHealth, len(backends)),
+		closed:   make(chan struct{}),
+	}
+
+	// start syncing every backend before returning, so that no changes are missed
+	syncCtx, cancel := context.WithCancel(context.Background())
+	backend.cancel = cancel
+	streams := make([]RecordStream, len(backend.backends))
+	versions := make([]uint64, len(backend.backends))
+	for i, underlying := range backend.backends {
+		_, version, err := underlying.GetAll(ctx)
+		if err == nil {
+			streams[i], err = underlying.Sync(syncCtx, version)
+		}
+		if err != nil {
+			cancel()
+			for _, stream := range streams[:i] {
+				_ = stream.Close()
+			}
+			return nil, fmt.Errorf("storage: error syncing routed backend: %w", err)
+		}
+		versions[i] = version
+	}
+	for i := range backend.backends {
+		go backend.run(syncCtx, i, streams[i], versions[i])
+	}
+	return backend, nil
+}
+
+// run merges the changes of the i-th backend into the change log.
+func (backend *routedBackend) run(ctx context.Context, i int, stream RecordStream, version uint64) {
+	for {
+		for stream.Next(true) {
+			record := stream.Record()
+			if record == nil {
+				// the record failed verification, which is returned by Err
+				break
+			}
+			version = record.GetVersion()
+			if backend.owns(i, record) {
+				backend.appendChange(record)
+			}
+		}
+		err := stream.Err()
+		_ = stream.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("storage: routed backend record stream ended")
+		}
+		log.Error().Err(err).Msg("storage: error syncing routed backend, retrying")
+		backend.setSyncErr(i, err)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(routedRetryInterval):
+			}
+
+			stream, err = backend.backends[i].Sync(ctx, version)
+			if err == nil {
+				break
+			}
+			log.Error().Err(err).Msg("storage: error syncing routed backend, retrying")
+			backend.setSyncErr(i, err)
+		}
+		backend.setSyncErr(i, nil)
+	}
+}
+
+func (backend *routedBackend) setSyncErr(i int, err error) {
+	backend.mu.Lock()
+	backend.health[i].Err = err
+	backend.mu.Unlock()
+}
+
+// BackendHealth returns the health of each of the backends. A backend is
+// unhealthy while syncing its changes fails, or while any of the backends it
+// routes records to itself is unhealthy.
+func (backend *routedBackend) BackendHealth() []BackendHealth {
+	backend.mu.RLock()
+	health := make([]BackendHealth, len(backend.health))
+	copy(health, backend.health)
+	backend.mu.RUnlock()
+
+	for i := range health {
+		if health[i].Err != nil {
+			continue
+		}
+		for _, h := range GetBackendHealth(backend.backends[i]) {
+			if h.Err != nil {
+				health[i].Err = h.Err
+				break
+			}
+		}
+	}
+	return health
+}
+
+func (backend *routedBackend) appendChange(record *databroker.Record) {
+	record = proto.Clone(record).(*databroker.Record)
+
+	backend.mu.Lock()
+	backend.version++
+	record.Version = backend.version
+	backend.changes = append(backend.changes, record)
+	if len(backend.changes) > routedMaxChanges {
+		backend.changes = append([]*databroker.Record(nil), backend.changes[len(backend.changes)-routedMaxChanges:]...)
+	}
+	backend.mu.Unlock()
+
+	backend.onChange.Broadcast()
+}
+
+// getSince returns the changes after version.
+func (backend *routedBackend) getSince(version uint64) []*databroker.Record {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+
+	if len(backend.changes) == 0 || version >= backend.version {
+		return nil
+	}
+	start := 0
+	if first := backend.changes[0].GetVersion(); version >= first {
+		start = int(version - first + 1)
+	}
+	records := make([]*databroker.Record, 0, len(backend.changes)-start)
+	for _, record := range backend.changes[start:] {
+		records = append(records, proto.Clone(record).(*databroker.Record))
+	}
+	return records
+}
+
+// owns reports whether the i-th backend stores the record. Copies of records
+// left in other backends, such as after the routes change, are ignored.
+func (backend *routedBackend) owns(i int, record *databroker.Record) bool {
+	return backend.router.route(record.GetType(), record.GetId()) == i
+}
+
+func (backend *routedBackend) route(recordType, id string) Backend {
+	return backend.backends[backend.router.route(recordType, id)]
+}
+
+func (backend *routedBackend) Close() error {
+	var errs *multierror.Error
+	backend.closeOnce.Do(func() {
+		backend.cancel()
+		close(backend.closed)
+		for _, underlying := range backend.backends {
+			if err := underlying.Close(); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+	})
+	return errs.ErrorOrNil()
+}
+
+func (backend *routedBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	return backend.route(recordType, id).Get(ctx, recordType, id)
+}
+
+// GetAll gets all the records of all the backends. The returned version is the
+// version of the change log, so that syncing from it doesn't miss any changes.
+func (backend *routedBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	backend.mu.RLock()
+	version := backend.version
+	backend.mu.RUnlock()
+
+	var all []*databroker.Record
+	for i, underlying := range backend.backends {
+		records, _, err := underlying.GetAll(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, record := range records {
+			if backend.owns(i, record) {
+				all = append(all, record)
+			}
+		}
+	}
+	return all, version, nil
+}
+
+func (backend *routedBackend) Put(ctx context.Context, record *databroker.Record) error {
+	return backend.route(record.GetType(), record.GetId()).Put(ctx, record)
+}
+
+// ReplaceAll replaces the records of the type in every backend which may store
+// them with the records routed to it. When there's more than one, the replace
+// isn't atomic across them.
+func (backend *routedBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	for i, underlying := range backend.backends {
+		if !backend.router.stores(i, recordType) {
+			continue
+		}
+		var routed []*databroker.Record
+		for _, record := range records {
+			if backend.owns(i, record) {
+				routed = append(routed, record)
+			}
+		}
+		if err := underlying.ReplaceAll(ctx, recordType, routed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (backend *routedBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	return newRoutedRecordStream(ctx, backend, version), nil
+}
+
+func (backend *routedBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	var recordTypes []string
+	seen := make(map[string]struct{})
+	for i, underlying := range backend.backends {
+		types, err := underlying.ListRecordTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, recordType := range types {
+			if _, ok := seen[recordType]; !ok && backend.router.stores(i, recordType) {
+				seen[recordType] = struct{}{}
+				recordTypes = append(recordTypes, recordType)
+			}
+		}
+	}
+	sort.Strings(recordTypes)
+	return recordTypes, nil
+}
+
+type routedRecordStream struct {
+	ctx     context.Context
+	backend *routedBackend
+
+	changed chan struct{}
+	ready   []*databroker.Record
+	version uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newRoutedRecordStream(ctx context.Context, backend *routedBackend, version uint64) *routedRecordStream {
+	return &routedRecordStream{
+		ctx:     ctx,
+		backend: backend,
+
+		changed: backend.onChange.Bind(),
+		version: version,
+
+		closed: make(chan struct{}),
+	}
+}
+
+func (stream *routedRecordStream) Close() error {
+	stream.closeOnce.Do(func() {
+		stream.backend.onChange.Unbind(stream.changed)
+		close(stream.closed)
+	})
+	return nil
+}
+
+func (stream *routedRecordStream) Next(block bool) bool {
+	if len(stream.ready) > 0 {
+		stream.ready = stream.ready[1:]
+	}
+	if len(stream.ready) > 0 {
+		return true
+	}
+
+	for {
+		stream.ready = stream.backend.getSince(stream.version)
+		if len(stream.ready) > 0 {
+			stream.version = stream.ready[len(stream.ready)-1].GetVersion()
+			return true
+		}
+
+		if !block {
+			return false
+		}
+		select {
+		case <-stream.ctx.Done():
+			return false
+		case <-stream.closed:
+			return false
+		case <-stream.backend.closed:
+			return false
+		case <-stream.changed:
+		}
+	}
+}
+
+func (stream *routedRecordStream) Record() *databroker.Record {
+	if len(stream.ready) > 0 {
+		return stream.ready[0]
+	}
+	return nil
+}
+
+func (stream *routedRecordStream) Err() error {
+	select {
+	case <-stream.ctx.Done():
+		return stream.ctx.Err()
+	case <-stream.closed:
+		return ErrStreamClosed
+	case <-stream.backend.closed:
+		return ErrStreamClosed
+	default:
+		return nil
+	}
+}
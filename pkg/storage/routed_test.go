@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// newRoutedMockBackend returns a mock backend which stores records in memory
+// and streams its changes.
+func newRoutedMockBackend() *mockBackend {
+	var mu sync.Mutex
+	var version uint64
+	var stream *mockRecordStream
+	records := map[string]*databroker.Record{}
+	return &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			mu.Lock()
+			version++
+			record.Version = version
+			records[record.GetType()+"/"+record.GetId()] = proto.Clone(record).(*databroker.Record)
+			s := stream
+			mu.Unlock()
+			if s != nil {
+				s.records <- proto.Clone(record).(*databroker.Record)
+			}
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			record, ok := records[recordType+"/"+id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return record, nil
+		},
+		getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var all []*databroker.Record
+			for _, record := range records {
+				all = append(all, record)
+			}
+			return all, version, nil
+		},
+		replaceAll: func(ctx context.Context, recordType string, replacements []*databroker.Record) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for key, record := range records {
+				if record.GetType() == recordType {
+					delete(records, key)
+				}
+			}
+			for _, record := range replacements {
+				version++
+				record.Version = version
+				records[record.GetType()+"/"+record.GetId()] = proto.Clone(record).(*databroker.Record)
+			}
+			return nil
+		},
+		sync: func(ctx context.Context, _ uint64) (RecordStream, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			stream = newMockRecordStream(ctx)
+			return stream, nil
+		},
+	}
+}
+
+func TestRoutedBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	sessions, users := newRoutedMockBackend(), newRoutedMockBackend()
+	backend, err := NewRoutedBackend(ctx, users, map[string]Backend{"session": sessions})
+	require.NoError(t, err)
+	defer backend.Close()
+
+	_, version, err := backend.GetAll(ctx)
+	require.NoError(t, err)
+	stream, err := backend.Sync(ctx, version)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "session", Id: "s1"}))
+	require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "user", Id: "u1"}))
+
+	t.Run("put", func(t *testing.T) {
+		_, err := sessions.Get(ctx, "session", "s1")
+		assert.NoError(t, err)
+		_, err = sessions.Get(ctx, "user", "u1")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = users.Get(ctx, "user", "u1")
+		assert.NoError(t, err)
+		_, err = users.Get(ctx, "session", "s1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("get", func(t *testing.T) {
+		record, err := backend.Get(ctx, "session", "s1")
+		assert.NoError(t, err)
+		assert.Equal(t, "s1", record.GetId())
+
+		records, _, err := backend.GetAll(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+	})
+	t.Run("sync", func(t *testing.T) {
+		var synced []*databroker.Record
+		for len(synced) < 2 && stream.Next(true) {
+			synced = append(synced, stream.Record())
+		}
+		require.NoError(t, stream.Err())
+		require.Len(t, synced, 2)
+
+		assert.ElementsMatch(t, []string{"session", "user"},
+			[]string{synced[0].GetType(), synced[1].GetType()})
+		assert.Equal(t, version+1, synced[0].GetVersion())
+		assert.Equal(t, version+2, synced[1].GetVersion())
+	})
+}
+
+func TestRoutedBackend_BackendHealth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	sessions, users := newRoutedMockBackend(), newRoutedMockBackend()
+	// the sessions backend becomes unreachable once its stream fails
+	streamCtx, failStream := context.WithCancel(ctx)
+	var unreachable int32
+	sync := sessions.sync
+	sessions.sync = func(_ context.Context, version uint64) (RecordStream, error) {
+		if atomic.LoadInt32(&unreachable) == 1 {
+			return nil, errors.New("unreachable")
+		}
+		return sync(streamCtx, version)
+	}
+	backend, err := NewRoutedBackend(ctx, users, map[string]Backend{"session": sessions, "group": sessions})
+	require.NoError(t, err)
+	defer backend.Close()
+
+	assert.Equal(t, []BackendHealth{
+		{Default: true},
+		{RecordTypes: []string{"group", "session"}},
+	}, GetBackendHealth(backend))
+
+	atomic.StoreInt32(&unreachable, 1)
+	failStream()
+	require.Eventually(t, func() bool {
+		return !GetBackendHealth(backend)[1].Healthy()
+	}, time.Second*5, time.Millisecond*10)
+
+	health := GetBackendHealth(backend)
+	assert.True(t, health[0].Healthy(), "the default backend should still be healthy")
+	assert.True(t, health[0].Default)
+	assert.Equal(t, []string{"group", "session"}, health[1].RecordTypes)
+	assert.Error(t, health[1].Err)
+
+	assert.Nil(t, GetBackendHealth(users), "backends which don't route records have no backend health")
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// shardedVirtualNodes is the number of points each shard has on the hash ring.
+// More points spread the records more evenly across the shards.
+const shardedVirtualNodes = 128
+
+// A hashRing routes records to shards by a consistent hash of their type and id.
+// The points of each shard on the ring are derived from its name, so adding or
+// removing a shard only moves the records between it and its neighbours on the
+// ring: about 1/N of them for N shards.
+type hashRing struct {
+	// points are the sorted points on the ring, and shards the index of the
+	// shard each point belongs to
+	points []uint64
+	shards []int
+}
+
+func newHashRing(names []string) *hashRing {
+	type point struct {
+		hash  uint64
+		shard int
+	}
+	points := make([]point, 0, len(names)*shardedVirtualNodes)
+	for i, name := range names {
+		for j := 0; j < shardedVirtualNodes; j++ {
+			points = append(points, point{hash: xxhash.Sum64String(name + "#" + strconv.Itoa(j)), shard: i})
+		}
+	}
+	// ties are broken by shard name, so that the ring doesn't depend on the order
+	// of the shards
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return names[points[i].shard] < names[points[j].shard]
+	})
+
+	ring := &hashRing{
+		points: make([]uint64, len(points)),
+		shards: make([]int, len(points)),
+	}
+	for i, p := range points {
+		ring.points[i], ring.shards[i] = p.hash, p.shard
+	}
+	return ring
+}
+
+// route returns the index of the shard of the record with the given type and id:
+// the shard of the first point on the ring at or after the hash of the record.
+func (ring *hashRing) route(recordType, id string) int {
+	h := xxhash.Sum64String(recordType + "\x00" + id)
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= h })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.shards[i]
+}
+
+// stores reports that every shard may store records of every type.
+func (ring *hashRing) stores(int, string) bool {
+	return true
+}
+
+// NewShardedBackend creates a new backend which distributes records across the
+// shards, by name, using a consistent hash of their type and id, so that storage
+// can be scaled horizontally with homogeneous backends.
+//
+// Like a routed backend, the changes of all the shards are merged into a single
+// change log with its own versions. When a shard is added or removed the records
+// which move to another shard aren't migrated: records left in a shard which no
+// longer owns them are ignored, so they have to be written again, for example by
+// their ReplaceAll source.
+func NewShardedBackend(ctx context.Context, shards map[string]Backend) (Backend, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("storage: at least one shard is required")
+	}
+
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	backends := make([]Backend, len(names))
+	for i, name := range names {
+		backends[i] = shards[name]
+	}
+
+	backend, err := newRoutedBackend(ctx, backends, newHashRing(names))
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		backend.health[i].Name = name
+	}
+	return backend, nil
+}
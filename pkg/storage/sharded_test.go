@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestShardedBackend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	const n = 300
+	shards := map[string]*mockBackend{
+		"a": newRoutedMockBackend(),
+		"b": newRoutedMockBackend(),
+		"c": newRoutedMockBackend(),
+	}
+	backend, err := NewShardedBackend(ctx, map[string]Backend{
+		"a": shards["a"],
+		"b": shards["b"],
+		"c": shards["c"],
+	})
+	require.NoError(t, err)
+	defer backend.Close()
+
+	_, version, err := backend.GetAll(ctx)
+	require.NoError(t, err)
+	stream, err := backend.Sync(ctx, version)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: fmt.Sprint(i)}))
+	}
+
+	t.Run("distribute", func(t *testing.T) {
+		for name, shard := range shards {
+			records, _, err := shard.GetAll(ctx)
+			require.NoError(t, err)
+			assert.Greater(t, len(records), n/6, "shard %s should store its share of the records", name)
+			assert.Less(t, len(records), n/2, "shard %s should store its share of the records", name)
+		}
+
+		records, _, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, n)
+		record, err := backend.Get(ctx, "TYPE", "42")
+		require.NoError(t, err)
+		assert.Equal(t, "42", record.GetId())
+	})
+	t.Run("sync", func(t *testing.T) {
+		ids := map[string]struct{}{}
+		for len(ids) < n && stream.Next(true) {
+			ids[stream.Record().GetId()] = struct{}{}
+			assert.Equal(t, version+uint64(len(ids)), stream.Record().GetVersion())
+		}
+		require.NoError(t, stream.Err())
+		assert.Len(t, ids, n, "the changes of every shard should be synced")
+	})
+	t.Run("replace all", func(t *testing.T) {
+		require.NoError(t, backend.ReplaceAll(ctx, "TYPE", []*databroker.Record{
+			{Type: "TYPE", Id: "1"},
+			{Type: "TYPE", Id: "2"},
+		}))
+		records, _, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 2)
+	})
+}
+
+func TestHashRing(t *testing.T) {
+	const n = 10000
+	names := []string{"a", "b", "c"}
+	ring, reduced := newHashRing(names), newHashRing([]string{"a", "b"})
+
+	moved := 0
+	for i := 0; i < n; i++ {
+		id := fmt.Sprint(i)
+		before, after := names[ring.route("TYPE", id)], names[reduced.route("TYPE", id)]
+		if before == after {
+			continue
+		}
+		moved++
+		assert.Equal(t, "c", before, "only the records of the removed shard should move")
+	}
+	assert.Greater(t, moved, n/6)
+	assert.Less(t, moved, n/2, "about a third of the records should move")
+
+	assert.Equal(t, ring.route("TYPE", "1"), newHashRing(names).route("TYPE", "1"),
+		"the ring should be deterministic")
+}
@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// Signature algorithms.
+const (
+	SignatureAlgorithmHMACSHA256 = "hmac-sha256"
+	SignatureAlgorithmEd25519    = "ed25519"
+)
+
+// A Signer signs records, such as with a key held in memory or by an HSM.
+type Signer interface {
+	// Algorithm names the algorithm of the signatures. It's stored with each
+	// signature, so that it's verified with the right verifier.
+	Algorithm() string
+	// KeyID identifies the key of the signatures among the keys of the algorithm.
+	KeyID() string
+	// Sign returns the signature of the message.
+	Sign(message []byte) ([]byte, error)
+}
+
+// A Verifier verifies the signatures of a signer.
+type Verifier interface {
+	// Algorithm names the algorithm of the signatures the verifier verifies.
+	Algorithm() string
+	// KeyID identifies the key of the signatures the verifier verifies.
+	KeyID() string
+	// Verify returns an error if the signature isn't a valid signature of the
+	// message.
+	Verify(message, signature []byte) error
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// NewHMACSigner creates a new signer, which is also its verifier, which signs
+// records with an HMAC-SHA256 keyed by a key derived from the given secret.
+func NewHMACSigner(secret []byte) interface {
+	Signer
+	Verifier
+} {
+	key := cryptutil.Hash("databroker record signing key", secret)
+	return hmacSigner{
+		keyID: hex.EncodeToString(cryptutil.Hash("databroker record signing key id", key)[:8]),
+		key:   key,
+	}
+}
+
+func (signer hmacSigner) Algorithm() string { return SignatureAlgorithmHMACSHA256 }
+func (signer hmacSigner) KeyID() string     { return signer.keyID }
+
+func (signer hmacSigner) Sign(message []byte) ([]byte, error) {
+	return cryptutil.GenerateHMAC(message, string(signer.key)), nil
+}
+
+func (signer hmacSigner) Verify(message, signature []byte) error {
+	if !cryptutil.CheckHMAC(message, signature, string(signer.key)) {
+		return errors.New("invalid hmac")
+	}
+	return nil
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a new signer which signs records with the given
+// Ed25519 private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return ed25519Signer{keyID: keyID, key: key}
+}
+
+func (signer ed25519Signer) Algorithm() string { return SignatureAlgorithmEd25519 }
+func (signer ed25519Signer) KeyID() string     { return signer.keyID }
+
+func (signer ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(signer.key, message), nil
+}
+
+type ed25519Verifier struct {
+	keyID string
+	key   ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a new verifier of the signatures of the Ed25519
+// private key of the given public key.
+func NewEd25519Verifier(keyID string, key ed25519.PublicKey) Verifier {
+	return ed25519Verifier{keyID: keyID, key: key}
+}
+
+func (verifier ed25519Verifier) Algorithm() string { return SignatureAlgorithmEd25519 }
+func (verifier ed25519Verifier) KeyID() string     { return verifier.keyID }
+
+func (verifier ed25519Verifier) Verify(message, signature []byte) error {
+	if len(verifier.key) != ed25519.PublicKeySize || !ed25519.Verify(verifier.key, message, signature) {
+		return errors.New("invalid ed25519 signature")
+	}
+	return nil
+}
+
+type verifierKey struct {
+	algorithm, keyID string
+}
+
+// signingKeys are the signer of the records written to a signed backend, and the
+// verifiers of the records read from it by algorithm and key id.
+type signingKeys struct {
+	signer    Signer
+	verifiers map[verifierKey]Verifier
+}
+
+func newSigningKeys(signer Signer, verifiers []Verifier) *signingKeys {
+	keys := &signingKeys{
+		signer:    signer,
+		verifiers: make(map[verifierKey]Verifier, len(verifiers)+1),
+	}
+	for _, verifier := range verifiers {
+		keys.verifiers[verifierKey{algorithm: verifier.Algorithm(), keyID: verifier.KeyID()}] = verifier
+	}
+	// verify the records the signer writes, if it's also a verifier
+	if verifier, ok := signer.(Verifier); ok {
+		keys.verifiers[verifierKey{algorithm: signer.Algorithm(), keyID: signer.KeyID()}] = verifier
+	}
+	return keys
+}
+
+type signedRecordStream struct {
+	underlying RecordStream
+	verify     func(ctx context.Context, record *databroker.Record) error
+	err        error
+}
+
+func (s *signedRecordStream) Close() error {
+	return s.underlying.Close()
+}
+
+func (s *signedRecordStream) Next(wait bool) bool {
+	return s.err == nil && s.underlying.Next(wait)
+}
+
+// Record returns the current record, or nil if it fails verification, in which
+// case Err returns the error and the stream ends.
+func (s *signedRecordStream) Record() *databroker.Record {
+	r := s.underlying.Record()
+	if r != nil {
+		if err := s.verify(context.Background(), r); err != nil {
+			s.err = err
+			return nil
+		}
+	}
+	return r
+}
+
+func (s *signedRecordStream) Err() error {
+	if s.err == nil {
+		s.err = s.underlying.Err()
+	}
+	return s.err
+}
+
+// A SignedBackendOption customizes a signed backend.
+type SignedBackendOption func(*signedBackendConfig)
+
+type signedBackendConfig struct {
+	acceptUnsigned bool
+}
+
+// WithAcceptUnsignedRecords sets whether records without a signature are accepted,
+// such as while migrating records written before signing was enabled. It defaults
+// to false, since anything which can write to the storage could otherwise bypass
+// verification by removing a record's signature.
+func WithAcceptUnsignedRecords(accept bool) SignedBackendOption {
+	return func(cfg *signedBackendConfig) {
+		cfg.acceptUnsigned = accept
+	}
+}
+
+type signedBackend struct {
+	underlying Backend
+	cfg        signedBackendConfig
+	// keys holds the *signingKeys, which are replaced when a shared key signed
+	// backend's secret is rotated
+	keys atomic.Value
+}
+
+// NewSignedBackend creates a new backend which signs the records written to it
+// with the signer, and verifies the records read from it with the verifier of
+// the algorithm and key id of their signature. The signature covers the record's
+// type, id and data as stored by the underlying backend, and is stored in the
+// record. Records without a signature are rejected, unless they're deleted and
+// their data was scrubbed, or unsigned records are accepted with
+// WithAcceptUnsignedRecords. An error wrapping ErrVerificationFailed is returned
+// for records which fail verification.
+func NewSignedBackend(signer Signer, verifiers []Verifier, underlying Backend, options ...SignedBackendOption) Backend {
+	return newSignedBackend(signer, verifiers, underlying, options...)
+}
+
+func newSignedBackend(signer Signer, verifiers []Verifier, underlying Backend, options ...SignedBackendOption) *signedBackend {
+	backend := &signedBackend{underlying: underlying}
+	for _, option := range options {
+		option(&backend.cfg)
+	}
+	backend.keys.Store(newSigningKeys(signer, verifiers))
+	return backend
+}
+
+func (backend *signedBackend) getKeys() *signingKeys {
+	return backend.keys.Load().(*signingKeys)
+}
+
+func (backend *signedBackend) Close() error {
+	return backend.underlying.Close()
+}
+
+func (backend *signedBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	record, err := backend.underlying.Get(ctx, recordType, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.verify(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (backend *signedBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	records, version, err := backend.underlying.GetAll(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, record := range records {
+		if err := backend.verify(ctx, record); err != nil {
+			return nil, 0, err
+		}
+	}
+	return records, version, nil
+}
+
+func (backend *signedBackend) Put(ctx context.Context, record *databroker.Record) error {
+	if err := backend.sign(record); err != nil {
+		return err
+	}
+	return backend.underlying.Put(ctx, record)
+}
+
+func (backend *signedBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	for _, record := range records {
+		if err := backend.sign(record); err != nil {
+			return err
+		}
+	}
+	return backend.underlying.ReplaceAll(ctx, recordType, records)
+}
+
+func (backend *signedBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	return backend.underlying.ListRecordTypes(ctx)
+}
+
+func (backend *signedBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	stream, err := backend.underlying.Sync(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &signedRecordStream{
+		underlying: stream,
+		verify:     backend.verify,
+	}, nil
+}
+
+func (backend *signedBackend) sign(record *databroker.Record) error {
+	signer := backend.getKeys().signer
+	signature, err := signer.Sign(signedMessage(record))
+	if err != nil {
+		return fmt.Errorf("failed to sign record: %w", err)
+	}
+	record.Signature = &databroker.RecordSignature{
+		Algorithm: signer.Algorithm(),
+		KeyId:     signer.KeyID(),
+		Value:     signature,
+	}
+	return nil
+}
+
+func (backend *signedBackend) verify(ctx context.Context, record *databroker.Record) error {
+	signature := record.GetSignature()
+	if signature == nil {
+		// the changes of deleted records are scrubbed of their data and signature
+		// by the storage backends, and there's no data left to protect
+		if backend.cfg.acceptUnsigned || (record.GetDeletedAt() != nil && record.GetData() == nil) {
+			return nil
+		}
+		metrics.RecordDataBrokerSignatureVerifyFailure(ctx, record.GetType())
+		return fmt.Errorf("%w: record is not signed", ErrVerificationFailed)
+	}
+
+	verifier, ok := backend.getKeys().verifiers[verifierKey{algorithm: signature.GetAlgorithm(), keyID: signature.GetKeyId()}]
+	var err error
+	if !ok {
+		err = fmt.Errorf("%w: no verifier for %s key %s",
+			ErrVerificationFailed, signature.GetAlgorithm(), signature.GetKeyId())
+	} else if verr := verifier.Verify(signedMessage(record), signature.GetValue()); verr != nil {
+		err = fmt.Errorf("%w: %v", ErrVerificationFailed, verr)
+	}
+	if err != nil {
+		metrics.RecordDataBrokerSignatureVerifyFailure(ctx, record.GetType())
+	}
+	return err
+}
+
+// signedMessage returns the message signed for a record: its type, id and data,
+// each prefixed by its length.
+func signedMessage(record *databroker.Record) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("databroker record signature\x00")
+	for _, field := range [][]byte{
+		[]byte(record.GetType()),
+		[]byte(record.GetId()),
+		[]byte(record.GetData().GetTypeUrl()),
+		record.GetData().GetValue(),
+	} {
+		_ = binary.Write(&buf, binary.BigEndian, uint64(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+type sharedKeySignedBackend struct {
+	*signedBackend
+	verifiers []Verifier
+}
+
+// NewSharedKeySignedBackend creates a new signed backend which signs records with
+// an HMAC keyed by the secret. Records are verified with the secret and with the
+// given verifiers. The secret can be rotated in place, and the previous secrets
+// are then used to verify the records written with them.
+func NewSharedKeySignedBackend(secret []byte, verifiers []Verifier, underlying Backend, options ...SignedBackendOption) Backend {
+	return &sharedKeySignedBackend{
+		signedBackend: newSignedBackend(NewHMACSigner(secret), verifiers, underlying, options...),
+		verifiers:     verifiers,
+	}
+}
+
+// RotateSecret rotates the secret in place. Records being read concurrently are
+// verified with either the old or the new secrets.
+func (backend *sharedKeySignedBackend) RotateSecret(secret []byte, previousSecrets [][]byte) error {
+	verifiers := make([]Verifier, 0, len(backend.verifiers)+len(previousSecrets))
+	verifiers = append(verifiers, backend.verifiers...)
+	for _, previousSecret := range previousSecrets {
+		verifiers = append(verifiers, NewHMACSigner(previousSecret))
+	}
+	backend.keys.Store(newSigningKeys(NewHMACSigner(secret), verifiers))
+	return nil
+}
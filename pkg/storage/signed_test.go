@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestSignedBackend(t *testing.T) {
+	ctx := context.Background()
+
+	m := map[string]*databroker.Record{}
+	backend := &mockBackend{
+		put: func(ctx context.Context, record *databroker.Record) error {
+			m[record.GetId()] = proto.Clone(record).(*databroker.Record)
+			return nil
+		},
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			record, ok := m[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return proto.Clone(record).(*databroker.Record), nil
+		},
+	}
+
+	pub1, priv1, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub2, priv2, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hmacSigner := NewHMACSigner([]byte("SECRET"))
+	verifiers := []Verifier{
+		NewEd25519Verifier("KEY-1", pub1),
+		NewEd25519Verifier("KEY-2", pub2),
+		hmacSigner,
+	}
+
+	data, _ := anypb.New(wrapperspb.String("HELLO WORLD"))
+
+	t.Run("ed25519", func(t *testing.T) {
+		s := NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend)
+		require.NoError(t, s.Put(ctx, &databroker.Record{Type: "TYPE", Id: "ED25519", Data: data}))
+		signature := m["ED25519"].GetSignature()
+		assert.Equal(t, SignatureAlgorithmEd25519, signature.GetAlgorithm())
+		assert.Equal(t, "KEY-1", signature.GetKeyId())
+
+		record, err := s.Get(ctx, "TYPE", "ED25519")
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(data, record.GetData()))
+	})
+	t.Run("multiple verifiers", func(t *testing.T) {
+		require.NoError(t, NewSignedBackend(NewEd25519Signer("KEY-2", priv2), nil, backend).
+			Put(ctx, &databroker.Record{Type: "TYPE", Id: "KEY-2", Data: data}))
+		require.NoError(t, NewSignedBackend(hmacSigner, nil, backend).
+			Put(ctx, &databroker.Record{Type: "TYPE", Id: "HMAC", Data: data}))
+
+		// records signed with any of the algorithms verify with the verifier set
+		s := NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend)
+		for _, id := range []string{"ED25519", "KEY-2", "HMAC"} {
+			_, err := s.Get(ctx, "TYPE", id)
+			assert.NoError(t, err, id)
+		}
+
+		// but not without the verifier of the key
+		_, err := NewSignedBackend(NewEd25519Signer("KEY-1", priv1), nil, backend).Get(ctx, "TYPE", "KEY-2")
+		assert.True(t, errors.Is(err, ErrVerificationFailed))
+	})
+	t.Run("tampered", func(t *testing.T) {
+		s := NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend)
+		require.NoError(t, s.Put(ctx, &databroker.Record{Type: "TYPE", Id: "TAMPERED", Data: data}))
+
+		m["TAMPERED"].Data, _ = anypb.New(wrapperspb.String("HELLO WORLD!"))
+		_, err := s.Get(ctx, "TYPE", "TAMPERED")
+		assert.True(t, errors.Is(err, ErrVerificationFailed))
+
+		// the signature of one key isn't accepted for another
+		m["TAMPERED"].Data = data
+		m["TAMPERED"].Signature.KeyId = "KEY-2"
+		_, err = s.Get(ctx, "TYPE", "TAMPERED")
+		assert.True(t, errors.Is(err, ErrVerificationFailed))
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		m["UNSIGNED"] = &databroker.Record{Type: "TYPE", Id: "UNSIGNED", Data: data}
+		_, err := NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend).Get(ctx, "TYPE", "UNSIGNED")
+		assert.True(t, errors.Is(err, ErrVerificationFailed), "unsigned records should be rejected")
+
+		_, err = NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend,
+			WithAcceptUnsignedRecords(true)).Get(ctx, "TYPE", "UNSIGNED")
+		assert.NoError(t, err, "unsigned records should be accepted when enabled")
+
+		m["SCRUBBED"] = &databroker.Record{Type: "TYPE", Id: "SCRUBBED", DeletedAt: timestamppb.Now()}
+		_, err = NewSignedBackend(NewEd25519Signer("KEY-1", priv1), verifiers, backend).Get(ctx, "TYPE", "SCRUBBED")
+		assert.NoError(t, err, "scrubbed deleted records should be accepted")
+	})
+	t.Run("rotate shared key", func(t *testing.T) {
+		s := NewSharedKeySignedBackend([]byte("SECRET"), nil, backend)
+		require.NoError(t, s.Put(ctx, &databroker.Record{Type: "TYPE", Id: "ROTATED", Data: data}))
+
+		require.NoError(t, s.(SecretRotator).RotateSecret([]byte("NEW SECRET"), [][]byte{[]byte("SECRET")}))
+		_, err := s.Get(ctx, "TYPE", "ROTATED")
+		assert.NoError(t, err, "records signed with a previous key should verify")
+
+		require.NoError(t, s.(SecretRotator).RotateSecret([]byte("NEW SECRET"), nil))
+		_, err = s.Get(ctx, "TYPE", "ROTATED")
+		assert.True(t, errors.Is(err, ErrVerificationFailed))
+	})
+}
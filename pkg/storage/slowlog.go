@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type slowOperationLogBackend struct {
+	Backend
+	threshold  time.Duration
+	sampleRate float64
+}
+
+// NewSlowOperationLogBackend creates a new backend which logs the operations on
+// the underlying backend which take longer than the threshold, with the operation,
+// record type and duration, like a slow query log. Only the given fraction of the
+// slow operations, between 0 and 1, is logged, so that a slow storage doesn't
+// flood the logs. They're logged to the logger of the context, if any, so that
+// they carry the request id, and otherwise to the global logger. Sync streams
+// aren't logged.
+func NewSlowOperationLogBackend(threshold time.Duration, sampleRate float64, underlying Backend) Backend {
+	return &slowOperationLogBackend{
+		Backend:    underlying,
+		threshold:  threshold,
+		sampleRate: sampleRate,
+	}
+}
+
+func (backend *slowOperationLogBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	start := time.Now()
+	record, err := backend.Backend.Get(ctx, recordType, id)
+	backend.log(ctx, start, "get", recordType, err)
+	return record, err
+}
+
+func (backend *slowOperationLogBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	start := time.Now()
+	records, version, err := backend.Backend.GetAll(ctx)
+	backend.log(ctx, start, "get_all", "", err)
+	return records, version, err
+}
+
+func (backend *slowOperationLogBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	start := time.Now()
+	version, err := StreamAll(ctx, backend.Backend, batchSize, fn)
+	backend.log(ctx, start, "stream_all", "", err)
+	return version, err
+}
+
+func (backend *slowOperationLogBackend) Put(ctx context.Context, record *databroker.Record) error {
+	start := time.Now()
+	err := backend.Backend.Put(ctx, record)
+	backend.log(ctx, start, "put", record.GetType(), err)
+	return err
+}
+
+func (backend *slowOperationLogBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	start := time.Now()
+	err := backend.Backend.ReplaceAll(ctx, recordType, records)
+	backend.log(ctx, start, "replace_all", recordType, err)
+	return err
+}
+
+func (backend *slowOperationLogBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	recordTypes, err := backend.Backend.ListRecordTypes(ctx)
+	backend.log(ctx, start, "list_record_types", "", err)
+	return recordTypes, err
+}
+
+func (backend *slowOperationLogBackend) log(ctx context.Context, start time.Time, operation, recordType string, err error) {
+	duration := time.Since(start)
+	if duration <= backend.threshold || rand.Float64() >= backend.sampleRate { // nolint: gosec
+		return
+	}
+
+	logger := log.Ctx(ctx)
+	if logger.GetLevel() == zerolog.Disabled {
+		logger = log.Logger()
+	}
+	evt := logger.Warn().
+		Str("operation", operation).
+		Dur("duration", duration).
+		Dur("threshold", backend.threshold)
+	if recordType != "" {
+		evt = evt.Str("type", recordType)
+	}
+	if err != nil && err != ErrNotFound {
+		evt = evt.Err(err)
+	}
+	evt.Msg("storage: slow operation")
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestSlowOperationLogBackend(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ctx := logger.WithContext(context.Background())
+
+	underlying := &mockBackend{
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			if id == "slow" {
+				time.Sleep(time.Millisecond * 50)
+			}
+			return &databroker.Record{Type: recordType, Id: id}, nil
+		},
+	}
+
+	t.Run("over threshold", func(t *testing.T) {
+		buf.Reset()
+		backend := NewSlowOperationLogBackend(time.Millisecond*20, 1, underlying)
+		_, err := backend.Get(ctx, "TYPE", "slow")
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), `"message":"storage: slow operation"`)
+		assert.Contains(t, buf.String(), `"operation":"get"`)
+		assert.Contains(t, buf.String(), `"type":"TYPE"`)
+		assert.Contains(t, buf.String(), `"duration":`)
+	})
+	t.Run("under threshold", func(t *testing.T) {
+		buf.Reset()
+		backend := NewSlowOperationLogBackend(time.Millisecond*20, 1, underlying)
+		_, err := backend.Get(ctx, "TYPE", "fast")
+		assert.NoError(t, err)
+		assert.Empty(t, buf.String())
+	})
+	t.Run("not sampled", func(t *testing.T) {
+		buf.Reset()
+		backend := NewSlowOperationLogBackend(time.Millisecond*20, 0, underlying)
+		_, err := backend.Get(ctx, "TYPE", "slow")
+		assert.NoError(t, err)
+		assert.Empty(t, buf.String())
+	})
+}
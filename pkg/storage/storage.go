@@ -15,8 +15,10 @@ import (
 
 // Errors
 var (
-	ErrNotFound     = errors.New("record not found")
-	ErrStreamClosed = errors.New("record stream closed")
+	ErrNotFound        = errors.New("record not found")
+	ErrStreamClosed    = errors.New("record stream closed")
+	ErrUnsupported     = errors.New("operation not supported by the storage backend")
+	ErrVersionConflict = errors.New("record version conflict")
 )
 
 // A RecordStream is a stream of records.
@@ -44,8 +46,44 @@ type Backend interface {
 	GetAll(ctx context.Context) (records []*databroker.Record, version uint64, err error)
 	// Put is used to insert or update a record.
 	Put(ctx context.Context, record *databroker.Record) error
+	// ReplaceAll atomically replaces all the records of the given type with the
+	// given records. Existing records of the type which aren't given are deleted.
+	// Watchers observe either all of the changes or none of them.
+	ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error
 	// Sync syncs record changes after the specified version.
 	Sync(ctx context.Context, version uint64) (RecordStream, error)
+	// ListRecordTypes lists the distinct types of the records in the backend.
+	// Types which only have deleted records are excluded.
+	ListRecordTypes(ctx context.Context) ([]string, error)
+}
+
+// A Transaction reads and writes records within a call to WithinTransaction.
+type Transaction interface {
+	// Get is used to retrieve a record. Records put in the transaction are visible.
+	Get(ctx context.Context, recordType, id string) (*databroker.Record, error)
+	// Put is used to insert or update a record when the transaction is committed.
+	Put(ctx context.Context, record *databroker.Record) error
+}
+
+// A TransactionalBackend is a Backend which supports transactions.
+type TransactionalBackend interface {
+	Backend
+	// WithinTransaction calls fn with a transaction. If fn returns nil, all the
+	// records put in the transaction are committed atomically and watchers are
+	// notified. Otherwise nothing is committed. fn may be called more than once if
+	// the transaction conflicts with another write.
+	WithinTransaction(ctx context.Context, fn func(tx Transaction) error) error
+}
+
+// WithinTransaction calls fn with a transaction on the backend and commits the
+// records put in it all-or-nothing. ErrUnsupported is returned if the backend
+// doesn't support transactions.
+func WithinTransaction(ctx context.Context, backend Backend, fn func(tx Transaction) error) error {
+	tb, ok := backend.(TransactionalBackend)
+	if !ok {
+		return ErrUnsupported
+	}
+	return tb.WithinTransaction(ctx, fn)
 }
 
 // MatchAny searches any data with a query.
@@ -15,6 +15,10 @@ type mockBackend struct {
 	put    func(ctx context.Context, record *databroker.Record) error
 	get    func(ctx context.Context, recordType, id string) (*databroker.Record, error)
 	getAll func(ctx context.Context) ([]*databroker.Record, uint64, error)
+	sync   func(ctx context.Context, version uint64) (RecordStream, error)
+
+	replaceAll      func(ctx context.Context, recordType string, records []*databroker.Record) error
+	listRecordTypes func(ctx context.Context) ([]string, error)
 }
 
 func (m *mockBackend) Close() error {
@@ -25,6 +29,10 @@ func (m *mockBackend) Put(ctx context.Context, record *databroker.Record) error
 	return m.put(ctx, record)
 }
 
+func (m *mockBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	return m.replaceAll(ctx, recordType, records)
+}
+
 func (m *mockBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
 	return m.get(ctx, recordType, id)
 }
@@ -34,7 +42,48 @@ func (m *mockBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64,
 }
 
 func (m *mockBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
-	panic("implement me")
+	if m.sync == nil {
+		panic("implement me")
+	}
+	return m.sync(ctx, version)
+}
+
+func (m *mockBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	return m.listRecordTypes(ctx)
+}
+
+type mockRecordStream struct {
+	ctx     context.Context
+	records chan *databroker.Record
+	record  *databroker.Record
+}
+
+func newMockRecordStream(ctx context.Context) *mockRecordStream {
+	return &mockRecordStream{
+		ctx:     ctx,
+		records: make(chan *databroker.Record),
+	}
+}
+
+func (m *mockRecordStream) Close() error {
+	return nil
+}
+
+func (m *mockRecordStream) Next(block bool) bool {
+	select {
+	case <-m.ctx.Done():
+		return false
+	case m.record = <-m.records:
+		return true
+	}
+}
+
+func (m *mockRecordStream) Record() *databroker.Record {
+	return m.record
+}
+
+func (m *mockRecordStream) Err() error {
+	return m.ctx.Err()
 }
 
 func TestMatchAny(t *testing.T) {
@@ -46,3 +95,11 @@ func TestMatchAny(t *testing.T) {
 	assert.True(t, MatchAny(data, "email"))
 	assert.False(t, MatchAny(data, "nope"))
 }
+
+func TestWithinTransaction(t *testing.T) {
+	err := WithinTransaction(context.Background(), &mockBackend{}, func(tx Transaction) error {
+		t.Error("fn should not be called")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// An AllStreamer is a Backend which can stream all of its records as they're read
+// from the underlying storage, rather than reading them all before returning.
+type AllStreamer interface {
+	// StreamAll calls fn with batches of all the records, as they're read.
+	// batchSize is a hint for the number of records in each batch. The returned
+	// version is the latest record version as of before the records were read, so
+	// changes made while streaming are also returned by Sync from that version.
+	StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (version uint64, err error)
+}
+
+// StreamAll streams all the records of the backend in batches of about batchSize
+// records. If the backend doesn't support streaming, all the records are read
+// with GetAll, and then passed to fn in batches of batchSize.
+func StreamAll(ctx context.Context, backend Backend, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	if s, ok := backend.(AllStreamer); ok {
+		return s.StreamAll(ctx, batchSize, fn)
+	}
+
+	records, version, err := backend.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if batchSize <= 0 {
+		batchSize = len(records)
+	}
+	for len(records) > 0 {
+		batch := records
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		records = records[len(batch):]
+		if err := fn(batch); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+func (c *checksumBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, c.underlying, batchSize, func(records []*databroker.Record) error {
+		for _, record := range records {
+			if err := verifyChecksum(ctx, record); err != nil {
+				return err
+			}
+		}
+		return fn(records)
+	})
+}
+
+func (backend *signedBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, backend.underlying, batchSize, func(records []*databroker.Record) error {
+		for _, record := range records {
+			if err := backend.verify(ctx, record); err != nil {
+				return err
+			}
+		}
+		return fn(records)
+	})
+}
+
+func (e *encryptedBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, e.underlying, batchSize, func(records []*databroker.Record) error {
+		for i := range records {
+			var err error
+			records[i], err = e.decryptRecord(ctx, records[i])
+			if err != nil {
+				return err
+			}
+		}
+		return fn(records)
+	})
+}
+
+func (e *fieldEncryptedBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, e.underlying, batchSize, func(records []*databroker.Record) error {
+		for i := range records {
+			var err error
+			records[i], err = e.decryptRecord(ctx, records[i])
+			if err != nil {
+				return err
+			}
+		}
+		return fn(records)
+	})
+}
+
+func (e *expiryBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, e.Backend, batchSize, fn)
+}
+
+func (c *negativeCacheBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, c.Backend, batchSize, fn)
+}
+
+func (c *readCacheBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, c.underlying, batchSize, fn)
+}
+
+func (backend *recordAgeSamplerBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return StreamAll(ctx, backend.Backend, batchSize, fn)
+}
+
+// StreamAll streams the records of the underlying backend, followed by the
+// records deleted within the grace period which weren't streamed.
+func (backend *deletedGracePeriodBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	live := make(map[readCacheKey]struct{})
+	version, err := StreamAll(ctx, backend.Backend, batchSize, func(records []*databroker.Record) error {
+		for _, record := range records {
+			live[readCacheKey{recordType: record.GetType(), id: record.GetId()}] = struct{}{}
+		}
+		return fn(records)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted []*databroker.Record
+	backend.mu.Lock()
+	backend.removeExpiredLocked()
+	for key, record := range backend.deleted {
+		if _, ok := live[key]; ok {
+			continue
+		}
+		deleted = append(deleted, proto.Clone(record).(*databroker.Record))
+	}
+	backend.mu.Unlock()
+
+	if len(deleted) > 0 {
+		if err := fn(deleted); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// StreamAll bounds the time spent reading each batch by the statement timeout,
+// rather than the whole stream, since the time spent in fn depends on the
+// consumer of the records.
+func (backend *statementTimeoutBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	statementCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var timedOut int32
+	timer := time.AfterFunc(backend.timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		cancel()
+	})
+	defer timer.Stop()
+
+	version, err := StreamAll(statementCtx, backend.Backend, batchSize, func(records []*databroker.Record) error {
+		if !timer.Stop() {
+			return statementCtx.Err()
+		}
+		defer timer.Reset(backend.timeout)
+		return fn(records)
+	})
+	// if the caller's context is done, the request deadline was hit rather than
+	// the statement timeout
+	if err != nil && ctx.Err() == nil && atomic.LoadInt32(&timedOut) == 1 {
+		return 0, fmt.Errorf("%w after %s: %v", ErrStatementTimeout, backend.timeout, err)
+	}
+	return version, err
+}
+
+func (backend *watchdogBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	current := backend.get()
+	var fnErr error
+	version, err := StreamAll(ctx, current, batchSize, func(records []*databroker.Record) error {
+		fnErr = fn(records)
+		return fnErr
+	})
+	// errors from the consumer of the records don't reflect on the connection
+	if fnErr == nil {
+		backend.observe(ctx, current, err)
+	}
+	return version, err
+}
+
+func (backend *routedBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	backend.mu.RLock()
+	version := backend.version
+	backend.mu.RUnlock()
+
+	for i, underlying := range backend.backends {
+		i := i
+		_, err := StreamAll(ctx, underlying, batchSize, func(records []*databroker.Record) error {
+			var routed []*databroker.Record
+			for _, record := range records {
+				if backend.owns(i, record) {
+					routed = append(routed, record)
+				}
+			}
+			if len(routed) == 0 {
+				return nil
+			}
+			return fn(routed)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type mockAllStreamer struct {
+	*mockBackend
+	streamAll func(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error)
+}
+
+func (m *mockAllStreamer) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	return m.streamAll(ctx, batchSize, fn)
+}
+
+func TestStreamAll(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("batches", func(t *testing.T) {
+		backend := &mockBackend{
+			getAll: func(ctx context.Context) ([]*databroker.Record, uint64, error) {
+				var records []*databroker.Record
+				for i := 0; i < 5; i++ {
+					records = append(records, &databroker.Record{Type: "TYPE", Id: fmt.Sprint(i)})
+				}
+				return records, 5, nil
+			},
+		}
+
+		var sizes []int
+		version, err := StreamAll(ctx, backend, 2, func(records []*databroker.Record) error {
+			sizes = append(sizes, len(records))
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), version)
+		assert.Equal(t, []int{2, 2, 1}, sizes, "backends which don't stream should be batched by the batch size")
+	})
+	t.Run("decorated", func(t *testing.T) {
+		streamed := false
+		backend := NewChecksumBackend(&mockAllStreamer{
+			mockBackend: &mockBackend{},
+			streamAll: func(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+				streamed = true
+				record := &databroker.Record{Type: "TYPE", Id: "1"}
+				record.Checksum = ComputeChecksum(record)
+				return 1, fn([]*databroker.Record{record})
+			},
+		})
+
+		version, err := StreamAll(ctx, backend, 10, func(records []*databroker.Record) error {
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), version)
+		assert.True(t, streamed, "decorators should stream from the underlying backend")
+	})
+	t.Run("statement timeout", func(t *testing.T) {
+		stuck := false
+		backend := NewStatementTimeoutBackend(time.Millisecond*50, &mockAllStreamer{
+			mockBackend: &mockBackend{},
+			streamAll: func(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+				for i := 0; i < 2; i++ {
+					if stuck {
+						<-ctx.Done()
+						return 0, ctx.Err()
+					}
+					if err := fn([]*databroker.Record{{Type: "TYPE", Id: fmt.Sprint(i)}}); err != nil {
+						return 0, err
+					}
+				}
+				return 2, nil
+			},
+		})
+
+		// a slow consumer of the records shouldn't time out
+		_, err := StreamAll(ctx, backend, 1, func(records []*databroker.Record) error {
+			time.Sleep(time.Millisecond * 100)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		stuck = true
+		_, err = StreamAll(ctx, backend, 1, func(records []*databroker.Record) error {
+			return nil
+		})
+		assert.True(t, errors.Is(err, ErrStatementTimeout), "slow reads should fail with a statement timeout: %v", err)
+	})
+}
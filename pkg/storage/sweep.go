@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A SweepWindow is a daily range of the time of day, in UTC, during which
+// sweeps for expired changes may run. The range wraps around midnight if the
+// end is before the start.
+type SweepWindow struct {
+	// Start and End are offsets from midnight. Start is inclusive and End is
+	// exclusive.
+	Start, End time.Duration
+}
+
+// SweepWindows are the windows during which sweeps may run. If there are none,
+// sweeps may run at any time.
+type SweepWindows []SweepWindow
+
+// ParseSweepWindows parses sweep windows formatted as time of day ranges in UTC,
+// such as "01:00-05:00" or "22:30-02:00".
+func ParseSweepWindows(specs []string) (SweepWindows, error) {
+	windows := make(SweepWindows, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("storage: invalid sweep window %q, expected HH:MM-HH:MM", spec)
+		}
+		start, err := parseTimeOfDay(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("storage: invalid sweep window %q: %w", spec, err)
+		}
+		end, err := parseTimeOfDay(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("storage: invalid sweep window %q: %w", spec, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("storage: invalid sweep window %q: start and end are the same", spec)
+		}
+		windows = append(windows, SweepWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+func parseTimeOfDay(raw string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true if sweeps may run at t.
+func (windows SweepWindows) Contains(t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	t = t.UTC()
+	offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	for _, w := range windows {
+		if w.Start < w.End {
+			if offset >= w.Start && offset < w.End {
+				return true
+			}
+		} else if offset >= w.Start || offset < w.End {
+			return true
+		}
+	}
+	return false
+}
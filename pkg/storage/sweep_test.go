@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweepWindows(t *testing.T) {
+	windows, err := ParseSweepWindows([]string{"01:00-05:00", "22:30-00:30"})
+	require.NoError(t, err)
+	assert.Equal(t, SweepWindows{
+		{Start: time.Hour, End: time.Hour * 5},
+		{Start: time.Hour*22 + time.Minute*30, End: time.Minute * 30},
+	}, windows)
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2021, 4, 1, hour, minute, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		t      time.Time
+		expect bool
+	}{
+		{at(0, 59), false},
+		{at(1, 0), true},
+		{at(4, 59), true},
+		{at(5, 0), false},
+		{at(12, 0), false},
+		{at(22, 30), true},
+		{at(0, 15), true},
+		{at(0, 30), false},
+	} {
+		assert.Equal(t, tc.expect, windows.Contains(tc.t), "at %s", tc.t.Format("15:04"))
+	}
+	assert.True(t, SweepWindows(nil).Contains(at(12, 0)), "should always sweep without windows")
+
+	for _, spec := range []string{"01:00", "1am-5am", "01:00-01:00", "01:00-25:00"} {
+		_, err := ParseSweepWindows([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
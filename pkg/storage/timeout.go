@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// ErrStatementTimeout indicates that a storage operation took longer than the
+// statement timeout.
+var ErrStatementTimeout = errors.New("storage statement timed out")
+
+type statementTimeoutBackend struct {
+	Backend
+	timeout time.Duration
+}
+
+// NewStatementTimeoutBackend creates a new backend which bounds each operation
+// on the underlying backend by the timeout, independently of the deadline of the
+// calling context. An operation which runs past the timeout is cancelled and
+// fails with ErrStatementTimeout. Sync streams aren't bounded.
+func NewStatementTimeoutBackend(timeout time.Duration, underlying Backend) Backend {
+	return &statementTimeoutBackend{
+		Backend: underlying,
+		timeout: timeout,
+	}
+}
+
+func (backend *statementTimeoutBackend) Get(ctx context.Context, recordType, id string) (record *databroker.Record, err error) {
+	err = backend.withTimeout(ctx, func(ctx context.Context) error {
+		record, err = backend.Backend.Get(ctx, recordType, id)
+		return err
+	})
+	return record, err
+}
+
+func (backend *statementTimeoutBackend) GetAll(ctx context.Context) (records []*databroker.Record, version uint64, err error) {
+	err = backend.withTimeout(ctx, func(ctx context.Context) error {
+		records, version, err = backend.Backend.GetAll(ctx)
+		return err
+	})
+	return records, version, err
+}
+
+func (backend *statementTimeoutBackend) Put(ctx context.Context, record *databroker.Record) error {
+	return backend.withTimeout(ctx, func(ctx context.Context) error {
+		return backend.Backend.Put(ctx, record)
+	})
+}
+
+func (backend *statementTimeoutBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	return backend.withTimeout(ctx, func(ctx context.Context) error {
+		return backend.Backend.ReplaceAll(ctx, recordType, records)
+	})
+}
+
+func (backend *statementTimeoutBackend) ListRecordTypes(ctx context.Context) (recordTypes []string, err error) {
+	err = backend.withTimeout(ctx, func(ctx context.Context) error {
+		recordTypes, err = backend.Backend.ListRecordTypes(ctx)
+		return err
+	})
+	return recordTypes, err
+}
+
+func (backend *statementTimeoutBackend) withTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	statementCtx, cancel := context.WithTimeout(ctx, backend.timeout)
+	defer cancel()
+
+	err := fn(statementCtx)
+	// if the caller's context is done, the request deadline was hit rather than
+	// the statement timeout
+	if err != nil && ctx.Err() == nil && errors.Is(statementCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrStatementTimeout, backend.timeout, err)
+	}
+	return err
+}
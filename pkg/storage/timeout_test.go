@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestStatementTimeoutBackend(t *testing.T) {
+	slow := &mockBackend{
+		get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second * 10):
+				return &databroker.Record{Type: recordType, Id: id}, nil
+			}
+		},
+		put: func(ctx context.Context, record *databroker.Record) error {
+			return nil
+		},
+	}
+	backend := NewStatementTimeoutBackend(time.Millisecond*50, slow)
+
+	start := time.Now()
+	_, err := backend.Get(context.Background(), "TYPE", "1")
+	assert.True(t, errors.Is(err, ErrStatementTimeout), "slow statements should fail with a statement timeout: %v", err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "slow statements should be cancelled at the statement timeout")
+
+	t.Run("request deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		_, err := backend.Get(ctx, "TYPE", "1")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.False(t, errors.Is(err, ErrStatementTimeout), "the request deadline should not be reported as a statement timeout")
+	})
+	t.Run("fast", func(t *testing.T) {
+		assert.NoError(t, backend.Put(context.Background(), &databroker.Record{Type: "TYPE", Id: "1"}))
+	})
+}
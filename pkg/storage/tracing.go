@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+
+	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// RequestIDAttribute is the name of the log field and span attribute holding the
+// id of the request a storage operation is made for.
+const RequestIDAttribute = "request-id"
+
+type tracingBackend struct {
+	Backend
+}
+
+// NewTracingBackend creates a new backend which traces every operation on the
+// underlying backend in a span tagged with the id of the request the operation is
+// made for, from the context, so that a single request can be followed through
+// storage. Operations are also logged at the debug level to the logger of the
+// context, if any, which is expected to carry the request id too.
+func NewTracingBackend(underlying Backend) Backend {
+	return &tracingBackend{Backend: underlying}
+}
+
+func (backend *tracingBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	ctx, span := backend.startSpan(ctx, "Get", recordType)
+	defer span.End()
+	record, err := backend.Backend.Get(ctx, recordType, id)
+	backend.end(ctx, span, "get", recordType, err)
+	return record, err
+}
+
+func (backend *tracingBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	ctx, span := backend.startSpan(ctx, "GetAll", "")
+	defer span.End()
+	records, version, err := backend.Backend.GetAll(ctx)
+	backend.end(ctx, span, "get_all", "", err)
+	return records, version, err
+}
+
+func (backend *tracingBackend) StreamAll(ctx context.Context, batchSize int, fn func(records []*databroker.Record) error) (uint64, error) {
+	ctx, span := backend.startSpan(ctx, "StreamAll", "")
+	defer span.End()
+	version, err := StreamAll(ctx, backend.Backend, batchSize, fn)
+	backend.end(ctx, span, "stream_all", "", err)
+	return version, err
+}
+
+func (backend *tracingBackend) Put(ctx context.Context, record *databroker.Record) error {
+	ctx, span := backend.startSpan(ctx, "Put", record.GetType())
+	defer span.End()
+	err := backend.Backend.Put(ctx, record)
+	backend.end(ctx, span, "put", record.GetType(), err)
+	return err
+}
+
+func (backend *tracingBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	ctx, span := backend.startSpan(ctx, "ReplaceAll", recordType)
+	defer span.End()
+	err := backend.Backend.ReplaceAll(ctx, recordType, records)
+	backend.end(ctx, span, "replace_all", recordType, err)
+	return err
+}
+
+func (backend *tracingBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	ctx, span := backend.startSpan(ctx, "ListRecordTypes", "")
+	defer span.End()
+	recordTypes, err := backend.Backend.ListRecordTypes(ctx)
+	backend.end(ctx, span, "list_record_types", "", err)
+	return recordTypes, err
+}
+
+func (backend *tracingBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, backend.Backend, recordTypes)
+}
+
+func (backend *tracingBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.Backend)
+}
+
+func (backend *tracingBackend) InvalidateCache(recordType, id string) bool {
+	return InvalidateCache(backend.Backend, recordType, id)
+}
+
+func (backend *tracingBackend) startSpan(ctx context.Context, operation, recordType string) (context.Context, *octrace.Span) {
+	ctx, span := trace.StartSpan(ctx, "databroker.storage."+operation)
+	if requestID := requestid.FromContext(ctx); requestID != "" {
+		span.AddAttributes(octrace.StringAttribute(RequestIDAttribute, requestID))
+	}
+	if recordType != "" {
+		span.AddAttributes(octrace.StringAttribute("type", recordType))
+	}
+	return ctx, span
+}
+
+func (backend *tracingBackend) end(ctx context.Context, span *octrace.Span, operation, recordType string, err error) {
+	if err != nil && err != ErrNotFound {
+		span.SetStatus(octrace.Status{Code: octrace.StatusCodeUnknown, Message: err.Error()})
+	}
+	log.Ctx(ctx).Debug().
+		Str("operation", operation).
+		Str("type", recordType).
+		Err(err).
+		Msg("storage: operation")
+}
@@ -0,0 +1,44 @@
+package storage
+
+import "context"
+
+// A Warmer is a Backend which can be warmed up before use, for example by opening
+// connections or prefetching records.
+type Warmer interface {
+	// Warmup prepares the backend for use. Records of the given types may be
+	// prefetched.
+	Warmup(ctx context.Context, recordTypes []string) error
+}
+
+// Warmup warms up the backend if it supports it.
+func Warmup(ctx context.Context, backend Backend, recordTypes []string) error {
+	w, ok := backend.(Warmer)
+	if !ok {
+		return nil
+	}
+	return w.Warmup(ctx, recordTypes)
+}
+
+func (c *checksumBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, c.underlying, recordTypes)
+}
+
+func (backend *signedBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, backend.underlying, recordTypes)
+}
+
+func (e *encryptedBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, e.underlying, recordTypes)
+}
+
+func (e *expiryBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, e.Backend, recordTypes)
+}
+
+func (c *negativeCacheBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, c.Backend, recordTypes)
+}
+
+func (backend *deletedGracePeriodBackend) Warmup(ctx context.Context, recordTypes []string) error {
+	return Warmup(ctx, backend.Backend, recordTypes)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type watchdogBackend struct {
+	name      string
+	threshold int
+	connect   func() (Backend, error)
+
+	mu       sync.RWMutex
+	current  Backend
+	timeouts int
+	closed   bool
+}
+
+// NewWatchdogBackend creates a new backend which recycles the connection to the
+// storage after threshold consecutive operations time out, since a connection
+// can get stuck in a state where every operation times out without it being
+// closed. The connection is recycled by closing the current backend and creating
+// a new one with connect. Recycles are counted in the
+// storage_connections_recycled_total metric, labeled by name.
+func NewWatchdogBackend(name string, threshold int, connect func() (Backend, error)) (Backend, error) {
+	current, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	return &watchdogBackend{
+		name:      name,
+		threshold: threshold,
+		connect:   connect,
+		current:   current,
+	}, nil
+}
+
+func (backend *watchdogBackend) Close() error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	backend.closed = true
+	return backend.current.Close()
+}
+
+func (backend *watchdogBackend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	current := backend.get()
+	record, err := current.Get(ctx, recordType, id)
+	backend.observe(ctx, current, err)
+	return record, err
+}
+
+func (backend *watchdogBackend) GetAll(ctx context.Context) ([]*databroker.Record, uint64, error) {
+	current := backend.get()
+	records, version, err := current.GetAll(ctx)
+	backend.observe(ctx, current, err)
+	return records, version, err
+}
+
+func (backend *watchdogBackend) Put(ctx context.Context, record *databroker.Record) error {
+	current := backend.get()
+	err := current.Put(ctx, record)
+	backend.observe(ctx, current, err)
+	return err
+}
+
+func (backend *watchdogBackend) ReplaceAll(ctx context.Context, recordType string, records []*databroker.Record) error {
+	current := backend.get()
+	err := current.ReplaceAll(ctx, recordType, records)
+	backend.observe(ctx, current, err)
+	return err
+}
+
+func (backend *watchdogBackend) Sync(ctx context.Context, version uint64) (RecordStream, error) {
+	current := backend.get()
+	stream, err := current.Sync(ctx, version)
+	backend.observe(ctx, current, err)
+	return stream, err
+}
+
+func (backend *watchdogBackend) ListRecordTypes(ctx context.Context) ([]string, error) {
+	current := backend.get()
+	recordTypes, err := current.ListRecordTypes(ctx)
+	backend.observe(ctx, current, err)
+	return recordTypes, err
+}
+
+func (backend *watchdogBackend) Flush(ctx context.Context) error {
+	return Flush(ctx, backend.get())
+}
+
+func (backend *watchdogBackend) get() Backend {
+	backend.mu.RLock()
+	current := backend.current
+	backend.mu.RUnlock()
+	return current
+}
+
+// observe tracks the consecutive timeouts of the operations on the current
+// backend, and recycles it once they reach the threshold.
+func (backend *watchdogBackend) observe(ctx context.Context, used Backend, err error) {
+	timedOut := errors.Is(err, ErrStatementTimeout) || errors.Is(err, context.DeadlineExceeded)
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	// ignore operations on a backend which has already been recycled
+	if used != backend.current || backend.closed {
+		return
+	}
+	if !timedOut {
+		backend.timeouts = 0
+		return
+	}
+	backend.timeouts++
+	if backend.timeouts < backend.threshold {
+		return
+	}
+
+	next, err := backend.connect()
+	if err != nil {
+		// keep the current connection, and try again on the next timeout
+		log.Error().Err(err).Str("backend", backend.name).Msg("storage: failed to recycle connection")
+		return
+	}
+	log.Warn().
+		Str("backend", backend.name).
+		Int("timeouts", backend.timeouts).
+		Msg("storage: recycling connection after repeated timeouts")
+	if err := backend.current.Close(); err != nil {
+		log.Warn().Err(err).Str("backend", backend.name).Msg("storage: error closing stuck connection")
+	}
+	backend.current = next
+	backend.timeouts = 0
+	metrics.RecordStorageConnectionRecycled(ctx, backend.name)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type closeTrackingBackend struct {
+	*mockBackend
+	closed bool
+}
+
+func (backend *closeTrackingBackend) Close() error {
+	backend.closed = true
+	return nil
+}
+
+func TestWatchdogBackend(t *testing.T) {
+	view.Unregister(metrics.StorageConnectionsRecycledView)
+	require.NoError(t, view.Register(metrics.StorageConnectionsRecycledView))
+	defer view.Unregister(metrics.StorageConnectionsRecycledView)
+
+	ctx := context.Background()
+
+	// the first connection is stuck, every operation on it times out
+	var connections []*closeTrackingBackend
+	var stuck bool
+	connect := func() (Backend, error) {
+		stuck = len(connections) == 0
+		connection := &closeTrackingBackend{mockBackend: &mockBackend{
+			get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+				if stuck {
+					return nil, fmt.Errorf("%w after 1s: %v", ErrStatementTimeout, context.DeadlineExceeded)
+				}
+				return &databroker.Record{Type: recordType, Id: id}, nil
+			},
+		}}
+		connections = append(connections, connection)
+		return connection, nil
+	}
+
+	backend, err := NewWatchdogBackend("redis", 3, connect)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := backend.Get(ctx, "TYPE", "1")
+		assert.ErrorIs(t, err, ErrStatementTimeout)
+	}
+	assert.Len(t, connections, 1, "should not recycle the connection before the threshold")
+
+	_, err = backend.Get(ctx, "TYPE", "1")
+	assert.ErrorIs(t, err, ErrStatementTimeout)
+	require.Len(t, connections, 2, "should recycle the connection at the threshold")
+	assert.True(t, connections[0].closed, "should close the stuck connection")
+
+	record, err := backend.Get(ctx, "TYPE", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", record.GetId())
+
+	rows, err := view.RetrieveData(metrics.StorageConnectionsRecycledView.Name)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, int64(1), rows[0].Data.(*view.CountData).Value)
+
+	t.Run("successes reset the count", func(t *testing.T) {
+		calls := 0
+		backend, err := NewWatchdogBackend("redis", 2, func() (Backend, error) {
+			calls++
+			return &mockBackend{
+				get: func(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+					if id == "slow" {
+						return nil, context.DeadlineExceeded
+					}
+					return &databroker.Record{Type: recordType, Id: id}, nil
+				},
+			}, nil
+		})
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, _ = backend.Get(ctx, "TYPE", "slow")
+			_, _ = backend.Get(ctx, "TYPE", "fast")
+		}
+		assert.Equal(t, 1, calls, "should only recycle after consecutive timeouts")
+	})
+}